@@ -2,16 +2,22 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"fmt"
 	"log"
 	"log/slog"
 	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"regexp"
 	"strings"
 	"syscall"
 	"time"
 
+	"github.com/golang-jwt/jwt/v5"
 	"google.golang.org/grpc"
 
 	"github.com/Prashant2307200/auth-service/internal/config"
@@ -20,15 +26,23 @@ import (
 	"github.com/Prashant2307200/auth-service/internal/infrastructure/transport/http/logging"
 	"github.com/Prashant2307200/auth-service/internal/infrastructure/transport/http/middleware"
 	"github.com/Prashant2307200/auth-service/internal/infrastructure/transport/http/utils"
+	"github.com/Prashant2307200/auth-service/internal/infrastructure/transport/http/utils/response"
 	"github.com/Prashant2307200/auth-service/internal/seeder"
 	"github.com/Prashant2307200/auth-service/internal/service"
 	authgrpcproto "github.com/Prashant2307200/auth-service/internal/transport/grpc/proto"
 	grpcserver "github.com/Prashant2307200/auth-service/internal/transport/grpc/server"
 	"github.com/Prashant2307200/auth-service/internal/usecase"
+	"github.com/Prashant2307200/auth-service/internal/usecase/interfaces"
+	"github.com/Prashant2307200/auth-service/pkg/crypto"
+	"github.com/Prashant2307200/auth-service/pkg/csrf"
 	"github.com/Prashant2307200/auth-service/pkg/db"
+	"github.com/Prashant2307200/auth-service/pkg/domainverify"
 	"github.com/Prashant2307200/auth-service/pkg/invitetoken"
 	"github.com/Prashant2307200/auth-service/pkg/ratelimit"
 	"github.com/Prashant2307200/auth-service/pkg/rdb"
+	"github.com/Prashant2307200/auth-service/pkg/saml"
+	"github.com/Prashant2307200/auth-service/pkg/securecookie"
+	"github.com/Prashant2307200/auth-service/pkg/webauthn"
 )
 
 func main() {
@@ -84,6 +98,12 @@ func main() {
 		slog.Error("Failed to initialize the audit repository", slog.Any("error", err))
 		os.Exit(1)
 	}
+	roleRepo, err := repository.NewRoleRepo(database.Db)
+	if err != nil {
+		slog.Error("Failed to initialize the role repository", slog.Any("error", err))
+		os.Exit(1)
+	}
+	authorizer := usecase.NewAuthorizer(businessRepo, roleRepo)
 
 	// Seed only in dev, or when explicitly enabled and not in production.
 	// This prevents accidental seeding in production even if the env var is set.
@@ -114,10 +134,16 @@ func main() {
 		slog.Error("Failed to initialize token service", slog.Any("error", err))
 		os.Exit(1)
 	}
+	if err := tokenService.LoadRetiredPublicKeys(cfg.JWT.RetiredPublicKeyPaths); err != nil {
+		slog.Error("Failed to load retired public keys", slog.Any("error", err))
+		os.Exit(1)
+	}
 
 	userUseCase := usecase.NewUserUseCase(userRepo)
 	userHandler := handler.NewUserHandler(userUseCase)
 	businessUseCase := usecase.NewBusinessUseCase(businessRepo, userRepo)
+	businessUseCase.Authorizer = authorizer
+	businessUseCase.DomainVerifier = domainverify.New(cfg.DomainVerification.DNSServer, !cfg.DomainVerification.DisableHTTP)
 	businessHandler := handler.NewBusinessHandler(businessUseCase)
 
 	userRouter := http.NewServeMux()
@@ -126,8 +152,32 @@ func main() {
 	businessRouter := http.NewServeMux()
 	businessHandler.RegisterRoutes(businessRouter)
 
+	sessionService := service.NewSessionService(rdb.Rdb)
+
 	authUseCase := usecase.NewAuthUseCase(userRepo, businessRepo, tokenService, cloudService)
+	authUseCase.Sessions = sessionService
+	authUseCase.AuditRepo = auditRepo
+	authUseCase.LoginPolicies = businessRepo
+	handler.RegisterCollectors(authUseCase.Metrics.RefreshTokenReuseTotal)
+	secrets, err := cookieSecrets(cfg)
+	if err != nil {
+		slog.Error("Failed to load cookie secrets", slog.Any("error", err))
+		os.Exit(1)
+	}
+	cookieCodec, err := securecookie.New(secrets, cfg.Secrets.EncryptCookies)
+	if err != nil {
+		slog.Error("Failed to set up cookie encoding", slog.Any("error", err))
+		os.Exit(1)
+	}
+	cookies := response.NewCookies(cfg.Env, cookieCodec)
+	csrfSigner, err := csrf.NewSigner(secrets...)
+	if err != nil {
+		slog.Error("Failed to set up CSRF protection", slog.Any("error", err))
+		os.Exit(1)
+	}
+
 	authHandler := handler.NewAuthHandler(authUseCase, cfg.Env)
+	authHandler.Cookies = cookies
 
 	var emailService usecase.EmailService = service.NoopEmailService{}
 	if cfg.Email.APIKey != "" {
@@ -140,45 +190,135 @@ func main() {
 	}
 
 	passwordResetRepo := repository.NewPasswordResetRepo(database.Db)
-	passwordResetUC := usecase.NewPasswordResetUsecase(userRepo, passwordResetRepo, emailService, tokenService)
+	passwordResetUC := usecase.NewPasswordResetUsecase(userRepo, passwordResetRepo, emailService, tokenService, sessionService)
 	passwordResetHandler := handler.NewPasswordResetHandler(passwordResetUC)
 
 	emailVerificationRepo := repository.NewEmailVerificationRepo(database.Db)
 	emailVerificationUC := usecase.NewEmailVerificationUsecase(userRepo, emailVerificationRepo, emailService)
 	emailVerificationHandler := handler.NewEmailVerificationHandler(emailVerificationUC)
 
-	mfaRepo := repository.NewMFARepo(database.Db)
-	mfaUC := usecase.NewMFAUsecase(userRepo, mfaRepo)
+	mfaSecrets, err := loadMFAEnvelope(cfg.Encryption)
+	if err != nil {
+		slog.Error("Failed to load MFA master keys", slog.Any("error", err))
+		os.Exit(1)
+	}
+	if mfaSecrets == nil {
+		if cfg.Env == "prod" {
+			slog.Error("MFA_MASTER_KEYS or MFA_MASTER_KEY_FILE is required in prod")
+			os.Exit(1)
+		}
+		slog.Warn("MFA master keys not configured; TOTP secrets are stored unencrypted")
+	}
+	mfaRepo := repository.NewMFARepo(database.Db, mfaSecrets)
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+	if mfaSecrets != nil {
+		go service.NewMFASecretReencrypter(mfaRepo).Run(jobsCtx, time.Hour)
+	}
+
+	denylist := service.NewTokenDenylist(rdb.Rdb, service.DefaultDenylistCapacity)
+	tokenService.Denylist = denylist
+	go denylist.Run(jobsCtx, time.Minute)
+	mfaUC := usecase.NewMFAUsecase(userRepo, mfaRepo, service.NewMFAThrottle(rdb.Rdb, service.DefaultMFAThrottlePolicy))
+	mfaGate := usecase.NewMFAGate(mfaUC, service.NewMFAChallengeStore(rdb.Rdb))
+	authUseCase.MFAGate = mfaGate
 	mfaHandler := handler.NewMFAHandler(mfaUC, userRepo)
 
+	var webAuthnHandler *handler.WebAuthnHandler
+	if cfg.WebAuthn.RPID != "" {
+		rp := &webauthn.RelyingParty{
+			ID:      cfg.WebAuthn.RPID,
+			Name:    cfg.WebAuthn.RPName,
+			Origins: cfg.WebAuthn.Origins,
+			Timeout: usecase.WebAuthnChallengeTTL,
+		}
+		webAuthnUC := usecase.NewWebAuthnUsecase(rp, userRepo, repository.NewWebAuthnRepo(database.Db), service.NewWebAuthnSessionStore(rdb.Rdb))
+		authUseCase.Passkeys = webAuthnUC
+		mfaGate.Passkeys = webAuthnUC
+		webAuthnHandler = handler.NewWebAuthnHandler(webAuthnUC, authUseCase, cfg.Env)
+		webAuthnHandler.Cookies = cookies
+		slog.Info("WebAuthn passkeys enabled", slog.String("rp_id", rp.ID))
+	}
+
 	authRouter := http.NewServeMux()
 	authHandler.RegisterRoutes(authRouter)
 	passwordResetHandler.RegisterRoutes(authRouter)
 	emailVerificationHandler.RegisterRoutes(authRouter)
 	mfaHandler.RegisterRoutes(authRouter)
+	if webAuthnHandler != nil {
+		webAuthnHandler.RegisterRoutes(authRouter)
+	}
 
-	if cfg.OAuth.GoogleClientID != "" && cfg.OAuth.GoogleClientSecret != "" {
-		ssoUC := usecase.NewSSOUsecase(userRepo, tokenService, usecase.SSOConfig{
-			GoogleClientID:     cfg.OAuth.GoogleClientID,
-			GoogleClientSecret: cfg.OAuth.GoogleClientSecret,
-			GoogleRedirectURL:  cfg.OAuth.GoogleRedirectURL,
-		})
+	ssoProviders, err := identityProviders(cfg.OAuth)
+	if err != nil {
+		slog.Error("Invalid identity provider configuration", slog.Any("error", err))
+		os.Exit(1)
+	}
+	if len(ssoProviders) > 0 {
+		ssoUC := usecase.NewSSOUsecase(userRepo, repository.NewUserIdentityRepo(database.Db), tokenService, sessionService, ssoProviders, mfaGate, usecase.NewUserAuditor(auditRepo, businessRepo))
 		ssoHandler := handler.NewSSOHandler(ssoUC, cfg.Env, cfg.Email.BaseURL)
+		ssoHandler.Cookies = cookies
+		ssoHandler.OptionalAuth = middleware.OptionalAuthenticate(tokenService, cookies)
 		ssoHandler.RegisterRoutes(authRouter)
-		slog.Info("Google SSO enabled")
+		authUseCase.SSO = ssoUC
+		slog.Info("SSO enabled", slog.Any("providers", ssoUC.Providers()))
 	}
 
-	sessionService := service.NewSessionService(rdb.Rdb)
-	sessionHandler := handler.NewSessionHandler(sessionService, cfg.Env)
+	samlSP, err := samlServiceProvider(cfg)
+	if err != nil {
+		slog.Error("Invalid SAML service provider configuration", slog.Any("error", err))
+		os.Exit(1)
+	}
+	if samlSP != nil {
+		samlUC := usecase.NewSAMLUsecase(*samlSP, repository.NewSAMLConnectionRepo(database.Db), service.NewSAMLRequestStore(rdb.Rdb), businessRepo, userRepo, repository.NewUserIdentityRepo(database.Db), tokenService, sessionService, auditRepo, mfaGate, authorizer)
+		samlHandler := handler.NewSAMLHandler(samlUC, cfg.Env, cfg.Email.BaseURL)
+		samlHandler.Cookies = cookies
+		samlHandler.RegisterRoutes(authRouter)
+		authUseCase.SAML = samlUC
+		samlHandler.RegisterBusinessRoutes(businessRouter)
+		slog.Info("SAML sign-in enabled", slog.String("base_url", samlSP.BaseURL))
+	}
+
+	sessionHandler := handler.NewSessionHandler(authUseCase, cfg.Env)
 	sessionHandler.RegisterRoutes(authRouter)
+	patUC := usecase.NewPersonalAccessTokenUsecase(repository.NewPersonalAccessTokenRepo(database.Db), businessRepo)
+	patHandler := handler.NewPersonalAccessTokenHandler(patUC)
+	patHandler.RegisterRoutes(authRouter)
+
+	csrfHandler := handler.NewCSRFHandler(csrfSigner)
+	csrfHandler.RegisterRoutes(authRouter)
 
 	auditHandler := handler.NewAuditHandler(auditRepo)
+	auditHandler.Authz = authorizer
 	auditHandler.RegisterRoutes(authRouter)
 	authRateLimiter := ratelimit.NewRateLimiter(0.083, 1)
-	authRouterWithRateLimit := wrapRateLimitedRoutes(authRouter, authRateLimiter, []string{"/register/", "/login/", "/forgot-password", "/reset-password"})
+	// Linking an identity can take the password, so it is limited like login.
+	authRouterWithRateLimit := wrapRateLimitedRoutes(authRouter, authRateLimiter, []string{"/register/", "/login/", "/forgot-password", "/reset-password", "/mfa/challenge", "/webauthn/login/", "/webauthn/mfa/", "/identities/"})
+	// Login pages call discover before every login, so it gets its own,
+	// looser limit; it still keeps domains from being enumerated quickly.
+	discoverRateLimiter := ratelimit.NewRateLimiter(1, 20)
+	authRouterWithRateLimit = wrapRateLimitedRoutes(authRouterWithRateLimit, discoverRateLimiter, []string{"/discover"})
+
+	oauthUC := usecase.NewOAuthUsecase(repository.NewOAuthClientRepo(database.Db), repository.NewOAuthConsentRepo(database.Db), service.NewOAuthGrantStore(rdb.Rdb), userRepo, businessRepo, tokenService, sessionService)
+	frontend := oauthFrontend(cfg)
+	tokenService.Issuer = frontend.Issuer
+	oauthHandler := handler.NewOAuthHandler(oauthUC, frontend, middleware.OptionalAuthenticate(tokenService, cookies))
+	oauthRouter := http.NewServeMux()
+	oauthHandler.RegisterClientRoutes(oauthRouter)
+	oauthHandler.RegisterConsentRoutes(oauthRouter)
+	// Device user codes are short, so limit how fast they can be guessed.
+	deviceRateLimiter := ratelimit.NewRateLimiter(0.2, 10)
+	oauthRouterWithRateLimit := wrapRateLimitedRoutes(oauthRouter, deviceRateLimiter, []string{"/device/"})
+
+	scimUC := usecase.NewSCIMUsecase(frontend.Issuer+"/api/v1/scim/v2", repository.NewSCIMRepo(database.Db), businessRepo, userRepo, auditRepo, authorizer)
+	scimHandler := handler.NewSCIMHandler(scimUC)
+	scimRouter := http.NewServeMux()
+	scimHandler.RegisterRoutes(scimRouter)
+	scimHandler.RegisterBusinessRoutes(businessRouter)
 
 	teamUC := usecase.NewTeamUsecase(memberRepo, auditRepo, service.NoopEmailService{}, invitetoken.NewGenerator(cfg.Secrets.RefreshTokenSecret, 24))
 	teamHandler := handler.NewTeamHandler(teamUC, func(next http.Handler) http.Handler { return next })
+	teamHandler.Authz = authorizer
 	teamRouter := http.NewServeMux()
 	teamHandler.RegisterRoutes(teamRouter)
 	teamHTTP := middleware.TenantFromHeader(http.StripPrefix("/team", teamRouter))
@@ -188,16 +328,32 @@ func main() {
 	go func() {
 		for range cleanupTicker.C {
 			authRateLimiter.Cleanup(1 * time.Hour)
+			deviceRateLimiter.Cleanup(1 * time.Hour)
+			discoverRateLimiter.Cleanup(1 * time.Hour)
+		}
+	}()
+
+	domainCheckTicker := time.NewTicker(1 * time.Minute)
+	defer domainCheckTicker.Stop()
+	go func() {
+		for range domainCheckTicker.C {
+			if _, err := businessUseCase.CheckDueDomains(context.Background()); err != nil {
+				slog.Error("Failed to check business domains", slog.Any("error", err))
+			}
 		}
 	}()
 
 	router := http.NewServeMux()
-	router.Handle("/auth/", http.StripPrefix("/auth", authRouterWithRateLimit))
+	router.Handle("/auth/", http.StripPrefix("/auth", middleware.ClientInfo(authRouterWithRateLimit)))
 	router.Handle("/users/", http.StripPrefix("/users", userRouter))
 	router.Handle("/business/", http.StripPrefix("/business", businessRouter))
 	router.Handle("/team/", teamHTTP)
+	router.Handle("/oauth/", http.StripPrefix("/oauth", oauthRouterWithRateLimit))
+	router.Handle("/scim/v2/", http.StripPrefix("/scim/v2", middleware.ClientInfo(scimRouter)))
 
 	v1 := http.NewServeMux()
+	authHandler.RegisterWellKnownRoutes(v1)
+	oauthHandler.RegisterRoutes(v1)
 
 	// Health endpoints (public)
 	// keep existing health usecase handler for backward compatibility
@@ -216,8 +372,25 @@ func main() {
 		v1.HandleFunc("POST /seed-db", devHandler.SeedDB)
 	}
 
-	authMiddleware := middleware.Authenticate(tokenService, cfg.Env)
-	v1.Handle("/api/v1/", authMiddleware(http.StripPrefix("/api/v1", router)))
+	credentialOrder, err := middleware.ParseCredentialOrder(cfg.HTTPAuth.CredentialOrder)
+	if err != nil {
+		slog.Error("Invalid AUTH_CREDENTIAL_ORDER", slog.Any("error", err))
+		os.Exit(1)
+	}
+	publicRoutes := middleware.NewPublicRoutes()
+	publicRoutes.Mount("/api/v1/auth", authRouter)
+	publicRoutes.Mount("/api/v1/users", userRouter)
+	publicRoutes.Mount("/api/v1/business", businessRouter)
+	publicRoutes.Mount("/api/v1/team", teamRouter)
+	publicRoutes.Mount("/api/v1/oauth", oauthRouter)
+	publicRoutes.Mount("/api/v1/scim/v2", scimRouter)
+	authMiddleware := middleware.Authenticate(tokenService, patUC, middleware.AuthConfig{
+		CredentialOrder: credentialOrder,
+		Public:          publicRoutes,
+		Cookies:         cookies,
+	})
+	csrfMiddleware := middleware.CSRF(csrfSigner, append([]string{cfg.Email.BaseURL}, cfg.HTTPAuth.CSRFTrustedOrigins...))
+	v1.Handle("/api/v1/", authMiddleware(csrfMiddleware(http.StripPrefix("/api/v1", router))))
 
 	// Register Prometheus metrics endpoint after other v1 routes are configured.
 	handler.RegisterMetricsHandler(v1)
@@ -237,6 +410,21 @@ func main() {
 	done := make(chan os.Signal, 1)
 	signal.Notify(done, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
 
+	// SIGHUP re-reads the private key file; a changed key becomes the signing
+	// key while the previous one keeps verifying until its tokens expire.
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+	go func() {
+		for range reload {
+			kid, rotated, err := tokenService.ReloadSigningKey()
+			if err != nil {
+				slog.Error("Failed to reload signing key", slog.Any("error", err))
+				continue
+			}
+			slog.Info("Signing key reloaded", slog.String("kid", kid), slog.Bool("rotated", rotated))
+		}
+	}()
+
 	go func() {
 		err := server.ListenAndServe()
 		if err != nil && err != http.ErrServerClosed {
@@ -297,3 +485,180 @@ func wrapRateLimitedRoutes(handler http.Handler, limiter *ratelimit.RateLimiter,
 		handler.ServeHTTP(w, r)
 	})
 }
+
+// cookieSecrets returns COOKIE_SECRET followed by COOKIE_PREVIOUS_SECRETS.
+// Outside prod a missing secret is replaced by a random one, so cookies and
+// CSRF tokens do not survive a restart.
+func cookieSecrets(cfg *config.Config) ([][]byte, error) {
+	if cfg.Secrets.CookieSecret == "" {
+		if cfg.Env == "prod" {
+			return nil, errors.New("COOKIE_SECRET is required in prod")
+		}
+		slog.Warn("COOKIE_SECRET not configured; cookies and CSRF tokens are signed with a random key")
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, err
+		}
+		return [][]byte{secret}, nil
+	}
+	secrets := [][]byte{[]byte(cfg.Secrets.CookieSecret)}
+	for _, previous := range cfg.Secrets.PreviousCookieSecrets {
+		if previous = strings.TrimSpace(previous); previous != "" {
+			secrets = append(secrets, []byte(previous))
+		}
+	}
+	return secrets, nil
+}
+
+// identityProviderName restricts provider names to what is safe in URL paths
+// and the SSO state cookie.
+var identityProviderName = regexp.MustCompile(`^[a-z0-9-]{1,50}$`)
+
+// identityProviders builds the identity providers users can sign in with:
+// Google, GitHub and Microsoft when their clients are configured, then any
+// generic OpenID Connect issuers.
+func identityProviders(cfg config.OAuth) ([]interfaces.IdentityProvider, error) {
+	var providers []interfaces.IdentityProvider
+	if cfg.GoogleClientID != "" && cfg.GoogleClientSecret != "" {
+		providers = append(providers, service.NewGoogleProvider(service.IdentityProviderConfig{
+			ClientID:     cfg.GoogleClientID,
+			ClientSecret: cfg.GoogleClientSecret,
+			RedirectURL:  cfg.GoogleRedirectURL,
+		}, nil))
+	}
+	if cfg.GitHubClientID != "" && cfg.GitHubClientSecret != "" {
+		providers = append(providers, service.NewGitHubProvider(service.IdentityProviderConfig{
+			ClientID:     cfg.GitHubClientID,
+			ClientSecret: cfg.GitHubClientSecret,
+			RedirectURL:  cfg.GitHubRedirectURL,
+		}, nil))
+	}
+	if cfg.MicrosoftClientID != "" && cfg.MicrosoftClientSecret != "" {
+		providers = append(providers, service.NewMicrosoftProvider(service.IdentityProviderConfig{
+			ClientID:     cfg.MicrosoftClientID,
+			ClientSecret: cfg.MicrosoftClientSecret,
+			RedirectURL:  cfg.MicrosoftRedirectURL,
+		}, cfg.MicrosoftTenant, nil))
+	}
+
+	seen := make(map[string]bool)
+	for _, p := range providers {
+		seen[p.Name()] = true
+	}
+	for _, p := range cfg.OIDCProviders {
+		if !identityProviderName.MatchString(p.Name) || p.Name == "providers" {
+			return nil, fmt.Errorf("invalid oidc provider name %q", p.Name)
+		}
+		if seen[p.Name] {
+			return nil, fmt.Errorf("identity provider %q configured twice", p.Name)
+		}
+		if p.Issuer == "" || p.ClientID == "" {
+			return nil, fmt.Errorf("oidc provider %q needs an issuer and a client_id", p.Name)
+		}
+		seen[p.Name] = true
+		providers = append(providers, service.NewOIDCProvider(service.IdentityProviderConfig{
+			Name:         p.Name,
+			ClientID:     p.ClientID,
+			ClientSecret: p.ClientSecret,
+			RedirectURL:  p.RedirectURL,
+			Scopes:       p.Scopes,
+		}, p.Issuer, nil))
+	}
+	return providers, nil
+}
+
+// loadMFAEnvelope builds the MFA secret envelope from config. It returns nil
+// when no master keys are configured.
+func loadMFAEnvelope(cfg config.Encryption) (*crypto.Envelope, error) {
+	var keys map[string][]byte
+	var err error
+	switch {
+	case cfg.MasterKeyFile != "":
+		keys, err = crypto.LoadMasterKeyFile(cfg.MasterKeyFile)
+	case cfg.MasterKeys != "":
+		keys, err = crypto.ParseMasterKeys(cfg.MasterKeys)
+	default:
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	provider, err := crypto.NewStaticKeyProvider(cfg.ActiveKeyVersion, keys)
+	if err != nil {
+		return nil, err
+	}
+	return crypto.NewEnvelope(provider), nil
+}
+
+// samlServiceProvider loads the key pair the SAML service provider signs
+// with. Without one, prod leaves SAML disabled and other environments
+// generate a throwaway pair, which identity providers must be re-pointed at
+// after every restart.
+func samlServiceProvider(cfg *config.Config) (*usecase.SAMLServiceProvider, error) {
+	sp := &usecase.SAMLServiceProvider{BaseURL: cfg.SAML.BaseURL}
+	if sp.BaseURL == "" {
+		sp.BaseURL = oauthFrontend(cfg).Issuer
+	}
+
+	if cfg.SAML.KeyFile == "" && cfg.SAML.CertificateFile == "" {
+		if cfg.Env == "prod" {
+			slog.Info("SAML_SP_KEY_FILE and SAML_SP_CERT_FILE not set; SAML sign-in disabled")
+			return nil, nil
+		}
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return nil, err
+		}
+		cert, err := saml.NewCertificate(key, "auth-service", 365*24*time.Hour)
+		if err != nil {
+			return nil, err
+		}
+		slog.Warn("SAML service provider key not configured; using a throwaway key pair")
+		sp.Key, sp.Certificate = key, cert
+		return sp, nil
+	}
+
+	keyPEM, err := os.ReadFile(cfg.SAML.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read SAML key: %w", err)
+	}
+	if sp.Key, err = jwt.ParseRSAPrivateKeyFromPEM(keyPEM); err != nil {
+		return nil, fmt.Errorf("invalid SAML key: %w", err)
+	}
+	certPEM, err := os.ReadFile(cfg.SAML.CertificateFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read SAML certificate: %w", err)
+	}
+	certs, err := saml.ParseCertificates(string(certPEM))
+	if err != nil {
+		return nil, err
+	}
+	if !sp.Key.PublicKey.Equal(certs[0].PublicKey) {
+		return nil, errors.New("SAML certificate does not match the key")
+	}
+	sp.Certificate = certs[0]
+	return sp, nil
+}
+
+// oauthFrontend resolves where /oauth/authorize and device authorization send
+// users. Unset URLs default to the frontend at APP_BASE_URL, which is assumed
+// to also serve this API when OAUTH_ISSUER is unset.
+func oauthFrontend(cfg *config.Config) handler.OAuthFrontend {
+	as := cfg.AuthorizationServer
+	base := strings.TrimSuffix(cfg.Email.BaseURL, "/")
+	frontend := handler.OAuthFrontend{Issuer: as.Issuer, LoginURL: as.LoginURL, ConsentURL: as.ConsentURL, DeviceURL: as.DeviceURL}
+	if frontend.Issuer == "" {
+		frontend.Issuer = base
+	}
+	if frontend.LoginURL == "" {
+		frontend.LoginURL = base + "/login"
+	}
+	if frontend.ConsentURL == "" {
+		frontend.ConsentURL = base + "/oauth/consent"
+	}
+	if frontend.DeviceURL == "" {
+		frontend.DeviceURL = base + "/device"
+	}
+	frontend.Issuer = strings.TrimSuffix(frontend.Issuer, "/")
+	return frontend
+}
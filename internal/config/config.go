@@ -14,8 +14,12 @@ type Secrets struct {
 	AccessTokenSecret string `yaml:"access_token_secret" env:"ACCESS_TOKEN_SECRET"`
 	// Required: used for refresh token signing (HS256).
 	RefreshTokenSecret string `yaml:"refresh_token_secret" env:"REFRESH_TOKEN_SECRET" env-required:"true"`
-	// Optional: reserved for signed/encrypted cookies; HttpOnly cookies are used without signing today.
+	// Signs cookies and CSRF tokens; at least 32 bytes. Required in prod, random per process elsewhere.
 	CookieSecret string `yaml:"cookie_secret" env:"COOKIE_SECRET"`
+	// Secrets rotated out of CookieSecret; they still verify cookies issued before the rotation.
+	PreviousCookieSecrets []string `yaml:"previous_cookie_secrets" env:"COOKIE_PREVIOUS_SECRETS" env-separator:","`
+	// Encrypts cookie values as well as signing them.
+	EncryptCookies bool `yaml:"encrypt_cookies" env:"COOKIE_ENCRYPT"`
 }
 
 type Cloud struct {
@@ -41,10 +45,105 @@ type Email struct {
 	BaseURL   string `yaml:"base_url" env:"APP_BASE_URL"`
 }
 
+// OAuth configures sign-in with external identity providers. Each built-in
+// provider is enabled when its client ID and secret are set.
 type OAuth struct {
 	GoogleClientID     string `yaml:"google_client_id" env:"GOOGLE_CLIENT_ID"`
 	GoogleClientSecret string `yaml:"google_client_secret" env:"GOOGLE_CLIENT_SECRET"`
 	GoogleRedirectURL  string `yaml:"google_redirect_url" env:"GOOGLE_REDIRECT_URL"`
+
+	GitHubClientID     string `yaml:"github_client_id" env:"GITHUB_CLIENT_ID"`
+	GitHubClientSecret string `yaml:"github_client_secret" env:"GITHUB_CLIENT_SECRET"`
+	GitHubRedirectURL  string `yaml:"github_redirect_url" env:"GITHUB_REDIRECT_URL"`
+
+	MicrosoftClientID     string `yaml:"microsoft_client_id" env:"MICROSOFT_CLIENT_ID"`
+	MicrosoftClientSecret string `yaml:"microsoft_client_secret" env:"MICROSOFT_CLIENT_SECRET"`
+	MicrosoftRedirectURL  string `yaml:"microsoft_redirect_url" env:"MICROSOFT_REDIRECT_URL"`
+	// MicrosoftTenant restricts sign-in to one directory; it defaults to
+	// "common", which admits any work, school or personal account.
+	MicrosoftTenant string `yaml:"microsoft_tenant" env:"MICROSOFT_TENANT"`
+
+	// OIDCProviders adds any other OpenID Connect issuers. They are only
+	// configurable in the config file.
+	OIDCProviders []OIDCProvider `yaml:"oidc_providers"`
+}
+
+// OIDCProvider is a generic OpenID Connect issuer users can sign in with at
+// /api/v1/auth/sso/{name}.
+type OIDCProvider struct {
+	// Name appears in URLs and must be lowercase letters, digits and dashes.
+	Name         string   `yaml:"name"`
+	Issuer       string   `yaml:"issuer"`
+	ClientID     string   `yaml:"client_id"`
+	ClientSecret string   `yaml:"client_secret"`
+	RedirectURL  string   `yaml:"redirect_url"`
+	Scopes       []string `yaml:"scopes"`
+}
+
+// WebAuthn configures the passkey relying party. Passkeys are disabled when RPID is empty.
+type WebAuthn struct {
+	// RPID is the domain credentials are bound to, e.g. "example.com".
+	RPID   string `yaml:"rp_id" env:"WEBAUTHN_RP_ID"`
+	RPName string `yaml:"rp_name" env:"WEBAUTHN_RP_NAME" env-default:"AuthService"`
+	// Origins lists the exact frontend origins allowed to run ceremonies.
+	Origins []string `yaml:"origins" env:"WEBAUTHN_ORIGINS" env-separator:","`
+}
+
+// SAML configures this service as a SAML service provider. Businesses
+// configure their own identity providers through the API.
+type SAML struct {
+	// KeyFile and CertificateFile hold the PEM RSA key and certificate that
+	// sign AuthnRequests and logout messages. Outside prod a throwaway pair
+	// is generated when they are unset; in prod SAML is disabled instead.
+	KeyFile         string `yaml:"key_file" env:"SAML_SP_KEY_FILE"`
+	CertificateFile string `yaml:"certificate_file" env:"SAML_SP_CERT_FILE"`
+	// BaseURL is the public base URL of this API, under which the SAML
+	// endpoints live; it defaults to the OAuth issuer.
+	BaseURL string `yaml:"base_url" env:"SAML_SP_BASE_URL"`
+}
+
+// AuthorizationServer configures the OAuth endpoints offered to registered
+// clients. Unset URLs are derived from APP_BASE_URL.
+type AuthorizationServer struct {
+	// Issuer is the public base URL of this service, used to send users back
+	// to /oauth/authorize after they sign in.
+	Issuer string `yaml:"issuer" env:"OAUTH_ISSUER"`
+	// LoginURL is the frontend sign-in page; it receives a return_to parameter.
+	LoginURL string `yaml:"login_url" env:"OAUTH_LOGIN_URL"`
+	// ConsentURL is the frontend consent page; it receives a request_id parameter.
+	ConsentURL string `yaml:"consent_url" env:"OAUTH_CONSENT_URL"`
+	// DeviceURL is the frontend page where users enter a device's user code.
+	DeviceURL string `yaml:"device_url" env:"OAUTH_DEVICE_URL"`
+}
+
+// Encryption configures envelope encryption of MFA secrets at rest.
+type Encryption struct {
+	// MasterKeys lists "version:base64key" entries separated by commas; each key is 32 bytes.
+	MasterKeys string `yaml:"master_keys" env:"MFA_MASTER_KEYS"`
+	// MasterKeyFile holds the same entries one per line and is used instead of MasterKeys when set.
+	MasterKeyFile string `yaml:"master_key_file" env:"MFA_MASTER_KEY_FILE"`
+	// ActiveKeyVersion selects the key that wraps new secrets; older versions only decrypt.
+	ActiveKeyVersion string `yaml:"active_key_version" env:"MFA_ACTIVE_KEY_VERSION"`
+}
+
+// HTTPAuth configures how the HTTP API authenticates requests.
+type HTTPAuth struct {
+	// CredentialOrder lists the places checked for a credential, from cookie,
+	// bearer and api_key; the first one present is the one verified.
+	CredentialOrder []string `yaml:"credential_order" env:"AUTH_CREDENTIAL_ORDER" env-separator:","`
+	// CSRFTrustedOrigins lists origins besides APP_BASE_URL's that may send
+	// cookie-authenticated requests that change state.
+	CSRFTrustedOrigins []string `yaml:"csrf_trusted_origins" env:"CSRF_TRUSTED_ORIGINS" env-separator:","`
+}
+
+// DomainVerification configures how ownership of business domains is checked.
+type DomainVerification struct {
+	// DNSServer is a "host:port" resolver used to look up verification TXT
+	// records instead of the system resolver, e.g. "1.1.1.1:53".
+	DNSServer string `yaml:"dns_server" env:"DOMAIN_VERIFY_DNS_SERVER"`
+	// DisableHTTP stops looking for the token in the well-known file, leaving
+	// DNS as the only way to verify a domain.
+	DisableHTTP bool `yaml:"disable_http" env:"DOMAIN_VERIFY_DISABLE_HTTP"`
 }
 
 type Config struct {
@@ -55,11 +154,21 @@ type Config struct {
 	Redis       Redis      `yaml:"redis"`
 	Email       Email      `yaml:"email"`
 	OAuth       OAuth      `yaml:"oauth"`
+	// AuthorizationServer is the OAuth provider side, as opposed to OAuth's sign-in with identity providers.
+	AuthorizationServer AuthorizationServer `yaml:"authorization_server"`
+	Encryption  Encryption `yaml:"encryption"`
+	WebAuthn    WebAuthn   `yaml:"webauthn"`
+	SAML        SAML       `yaml:"saml"`
+	HTTPAuth    HTTPAuth   `yaml:"http_auth"`
+	DomainVerification DomainVerification `yaml:"domain_verification"`
 	PostgresUri string     `yaml:"postgres_uri" env:"POSTGRES_URI" env-required:"true"`
 	// Optional JWT key paths; if empty, code may fall back to legacy defaults.
 	JWT struct {
 		PublicKeyPath  string `yaml:"public_key_path" env:"JWT_PUBLIC_KEY_PATH"`
 		PrivateKeyPath string `yaml:"private_key_path" env:"JWT_PRIVATE_KEY_PATH"`
+		// RetiredPublicKeyPaths lists public keys of signing keys rotated out before
+		// the last restart; they verify tokens for one more access-token TTL.
+		RetiredPublicKeyPaths []string `yaml:"retired_public_key_paths" env:"JWT_RETIRED_PUBLIC_KEY_PATHS" env-separator:","`
 	} `yaml:"jwt"`
 }
 
@@ -14,11 +14,25 @@ const (
 	AuditActionUserMFADisabled            = "user.mfa_disabled"
 	AuditActionUserSessionRevoked         = "user.session_revoked"
 	AuditActionUserAllSessionsRevoked     = "user.all_sessions_revoked"
-	AuditActionUserGoogleLinked           = "user.google_linked"
+	AuditActionUserRefreshTokenReused     = "user.refresh_token_reused"
+	AuditActionUserIdentityLinked         = "user.identity_linked"
+	AuditActionUserIdentityUnlinked       = "user.identity_unlinked"
 	AuditActionTeamInviteSent             = "team.invite_sent"
 	AuditActionTeamInviteAccepted         = "team.invite_accepted"
 	AuditActionTeamMemberRemoved          = "team.member_removed"
 	AuditActionTeamMemberRoleUpdated      = "team.member_role_updated"
+	AuditActionBusinessSAMLConfigured     = "business.saml_configured"
+	AuditActionBusinessSAMLDeleted        = "business.saml_deleted"
+	AuditActionBusinessSCIMTokenCreated   = "business.scim_token_created"
+	AuditActionBusinessSCIMTokenRevoked   = "business.scim_token_revoked"
+	AuditActionSCIMUserCreated            = "scim.user_created"
+	AuditActionSCIMUserUpdated            = "scim.user_updated"
+	AuditActionSCIMUserDeactivated        = "scim.user_deactivated"
+	AuditActionSCIMUserReactivated        = "scim.user_reactivated"
+	AuditActionSCIMUserDeleted            = "scim.user_deleted"
+	AuditActionSCIMGroupCreated           = "scim.group_created"
+	AuditActionSCIMGroupUpdated           = "scim.group_updated"
+	AuditActionSCIMGroupDeleted           = "scim.group_deleted"
 )
 
 // AuditLog represents an immutable audit record for actions performed within a business
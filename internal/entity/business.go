@@ -23,6 +23,15 @@ type Business struct {
 	UpdatedAt    time.Time  `json:"updated_at,omitempty"`
 }
 
+// BusinessLoginPolicy restricts how users whose email is in one of the
+// business's verified domains may sign in.
+type BusinessLoginPolicy struct {
+	BusinessID int64 `json:"business_id"`
+	// PasswordLoginDisabled leaves them to the business's identity provider
+	// and the other sign-in methods.
+	PasswordLoginDisabled bool `json:"password_login_disabled"`
+}
+
 type BusinessUser struct {
 	ID         int64     `json:"id"`
 	BusinessID int64     `json:"business_id"`
@@ -60,4 +69,12 @@ type BusinessDomain struct {
 	VerificationToken string     `json:"verification_token,omitempty"`
 	VerifiedAt        *time.Time `json:"verified_at,omitempty"`
 	CreatedAt         time.Time  `json:"created_at,omitempty"`
+	// VerificationMethod is how the token was last found, "dns" or "http".
+	VerificationMethod string `json:"verification_method,omitempty"`
+	// CheckFailures counts the checks in a row that did not find the token.
+	CheckFailures int        `json:"check_failures"`
+	LastCheckedAt *time.Time `json:"last_checked_at,omitempty"`
+	// NextCheckAt is when the token is looked for again; nil when checks
+	// have stopped.
+	NextCheckAt *time.Time `json:"next_check_at,omitempty"`
 }
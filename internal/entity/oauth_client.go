@@ -0,0 +1,103 @@
+package entity
+
+import (
+	"slices"
+	"time"
+)
+
+// OAuthClient is an application registered to call the OAuth endpoints. Its
+// secret is only ever shown once, at registration; SecretHash is its SHA-256.
+// Public clients, such as SPAs and native apps, have no secret and rely on
+// PKCE alone. Service clients have a BusinessID and act on that business in
+// their own name, through the client_credentials grant. First-party clients
+// are this service's own applications, trusted with the tokens of its
+// sign-in flow.
+type OAuthClient struct {
+	ID           int64    `json:"id"`
+	ClientID     string   `json:"client_id"`
+	Name         string   `json:"name"`
+	SecretHash   string   `json:"-"`
+	Public       bool     `json:"public"`
+	RedirectURIs []string `json:"redirect_uris"`
+	// Scopes lists every scope the client may request.
+	Scopes     []string  `json:"scopes"`
+	BusinessID *int64    `json:"business_id,omitempty"`
+	FirstParty bool      `json:"first_party"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// IsService reports whether the client is a service client scoped to a business.
+func (c *OAuthClient) IsService() bool {
+	return c.BusinessID != nil
+}
+
+// AllowsScopes reports whether every scope in requested is registered for the client.
+func (c *OAuthClient) AllowsScopes(requested []string) bool {
+	for _, s := range requested {
+		if !slices.Contains(c.Scopes, s) {
+			return false
+		}
+	}
+	return true
+}
+
+// HasRedirectURI reports whether uri exactly matches a registered redirect URI.
+func (c *OAuthClient) HasRedirectURI(uri string) bool {
+	return slices.Contains(c.RedirectURIs, uri)
+}
+
+// OAuthAuthorizationRequest is an authorization request waiting for the
+// user's consent.
+type OAuthAuthorizationRequest struct {
+	ClientID    string `json:"client_id"`
+	UserID      int64  `json:"user_id"`
+	RedirectURI string `json:"redirect_uri"`
+	// RedirectURIParam is the redirect_uri as sent, empty when it was omitted;
+	// the token request must repeat it exactly.
+	RedirectURIParam string   `json:"redirect_uri_param"`
+	Scopes           []string `json:"scopes"`
+	State            string   `json:"state"`
+	CodeChallenge    string   `json:"code_challenge"`
+	// Nonce is the OpenID Connect nonce, copied into the ID token.
+	Nonce string `json:"nonce,omitempty"`
+}
+
+// OAuthAuthorizationCode is what an issued authorization code stands for.
+type OAuthAuthorizationCode struct {
+	ClientID         string    `json:"client_id"`
+	UserID           int64     `json:"user_id"`
+	RedirectURIParam string    `json:"redirect_uri_param"`
+	Scopes           []string  `json:"scopes"`
+	CodeChallenge    string    `json:"code_challenge"`
+	Nonce            string    `json:"nonce,omitempty"`
+	AuthTime         time.Time `json:"auth_time"`
+}
+
+// OAuthDeviceStatus is the state of a device authorization.
+type OAuthDeviceStatus string
+
+const (
+	OAuthDevicePending  OAuthDeviceStatus = "pending"
+	OAuthDeviceApproved OAuthDeviceStatus = "approved"
+	OAuthDeviceDenied   OAuthDeviceStatus = "denied"
+)
+
+// OAuthDeviceGrant is a device authorization (RFC 8628) from the moment a
+// device asks for a code until it redeems the user's approval.
+type OAuthDeviceGrant struct {
+	ClientID string            `json:"client_id"`
+	UserCode string            `json:"user_code"`
+	Scopes   []string          `json:"scopes"`
+	Status   OAuthDeviceStatus `json:"status"`
+	// UserID and AuthTime are set once a user has decided.
+	UserID   int64     `json:"user_id,omitempty"`
+	AuthTime time.Time `json:"auth_time,omitempty"`
+}
+
+// OAuthConsent records the scopes a user has granted a client.
+type OAuthConsent struct {
+	ClientID   string    `json:"client_id"`
+	ClientName string    `json:"client_name"`
+	Scopes     []string  `json:"scopes"`
+	GrantedAt  time.Time `json:"granted_at"`
+}
@@ -0,0 +1,47 @@
+package entity
+
+// Permissions a business role can grant its members. Each allows one kind of
+// business or team operation.
+const (
+	PermissionBusinessUpdate = "business:update"
+	PermissionBusinessDelete = "business:delete"
+	PermissionMembersRead    = "members:read"
+	// PermissionMembersInvite covers creating, listing and revoking invites.
+	PermissionMembersInvite = "members:invite"
+	// PermissionMembersManage covers adding and removing members and
+	// changing their roles.
+	PermissionMembersManage = "members:manage"
+	PermissionDomainsManage = "domains:manage"
+	// PermissionSSOManage covers the login policy, SAML and SCIM.
+	PermissionSSOManage = "sso:manage"
+	PermissionAuditRead = "audit:read"
+)
+
+// Permissions lists every permission a role can have.
+var Permissions = []string{
+	PermissionBusinessUpdate,
+	PermissionBusinessDelete,
+	PermissionMembersRead,
+	PermissionMembersInvite,
+	PermissionMembersManage,
+	PermissionDomainsManage,
+	PermissionSSOManage,
+	PermissionAuditRead,
+}
+
+// SystemRoles are the roles every business starts with, one per membership
+// level, and their default permissions. A business's owner always holds
+// every permission.
+var SystemRoles = map[string][]string{
+	RoleNameOwner: Permissions,
+	RoleNameAdmin: {
+		PermissionBusinessUpdate,
+		PermissionMembersRead,
+		PermissionMembersInvite,
+		PermissionMembersManage,
+		PermissionDomainsManage,
+		PermissionSSOManage,
+		PermissionAuditRead,
+	},
+	RoleNameMember: {PermissionMembersRead},
+}
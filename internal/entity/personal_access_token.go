@@ -0,0 +1,48 @@
+package entity
+
+import (
+	"slices"
+	"time"
+)
+
+// PersonalAccessTokenPrefix starts every personal access token, so they are
+// easy to recognise, for example by secret scanners, and to tell apart from
+// JWT access tokens.
+const PersonalAccessTokenPrefix = "pat_"
+
+// Scopes a personal access token can be granted. Each allows reading or
+// changing one resource of the API.
+const (
+	ScopeUsersRead     = "users:read"
+	ScopeUsersWrite    = "users:write"
+	ScopeBusinessRead  = "business:read"
+	ScopeBusinessWrite = "business:write"
+)
+
+// PersonalAccessTokenScopes lists every scope a personal access token can have.
+var PersonalAccessTokenScopes = []string{ScopeUsersRead, ScopeUsersWrite, ScopeBusinessRead, ScopeBusinessWrite}
+
+// PersonalAccessToken is a long-lived token a user creates to script against
+// the API. The token is only shown once, at creation; TokenHash is its
+// SHA-256. A token with a BusinessID acts on that business only.
+type PersonalAccessToken struct {
+	ID         int64      `json:"id"`
+	UserID     int64      `json:"-"`
+	Name       string     `json:"name"`
+	TokenHash  string     `json:"-"`
+	Scopes     []string   `json:"scopes"`
+	BusinessID *int64     `json:"business_id,omitempty"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// HasScope reports whether the token was granted scope.
+func (t *PersonalAccessToken) HasScope(scope string) bool {
+	return slices.Contains(t.Scopes, scope)
+}
+
+// Expired reports whether the token has expired at now.
+func (t *PersonalAccessToken) Expired(now time.Time) bool {
+	return !now.Before(t.ExpiresAt)
+}
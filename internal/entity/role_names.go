@@ -1,6 +1,7 @@
 package entity
 
 const (
+	RoleNameOwner   = "owner"
 	RoleNameAdmin   = "admin"
 	RoleNameManager = "manager"
 	RoleNameMember  = "member"
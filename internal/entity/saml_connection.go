@@ -0,0 +1,39 @@
+package entity
+
+import (
+	"strconv"
+	"time"
+)
+
+// SAMLConnection is a business's SAML identity provider. Its members sign in
+// through it, and are provisioned on first sign-in.
+type SAMLConnection struct {
+	ID         int64 `json:"id"`
+	BusinessID int64 `json:"business_id"`
+	// IdPEntityID, IdPSSOURL, IdPSLOURL and IdPCertificate describe the
+	// identity provider; IdPCertificate holds one or more PEM certificates.
+	IdPEntityID    string `json:"idp_entity_id"`
+	IdPSSOURL      string `json:"idp_sso_url"`
+	IdPSLOURL      string `json:"idp_slo_url,omitempty"`
+	IdPCertificate string `json:"idp_certificate"`
+	// EmailAttribute and UsernameAttribute name the assertion attributes
+	// holding the user's email and username. Without an email attribute the
+	// NameID must be the email.
+	EmailAttribute    string    `json:"email_attribute,omitempty"`
+	UsernameAttribute string    `json:"username_attribute,omitempty"`
+	DefaultRole       int       `json:"default_role"`
+	Enabled           bool      `json:"enabled"`
+	CreatedAt         time.Time `json:"created_at"`
+	UpdatedAt         time.Time `json:"updated_at"`
+}
+
+// SAMLIdentityProvider is the UserIdentity provider of users signed in
+// through businessID's SAML connection, whose subject is the NameID.
+func SAMLIdentityProvider(businessID int64) string {
+	return "saml:" + strconv.FormatInt(businessID, 10)
+}
+
+// SAMLRequest is an AuthnRequest awaiting its Response.
+type SAMLRequest struct {
+	BusinessID int64 `json:"business_id"`
+}
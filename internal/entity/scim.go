@@ -0,0 +1,53 @@
+package entity
+
+import "time"
+
+// SCIMTokenPrefix starts every SCIM provisioning token.
+const SCIMTokenPrefix = "scim_"
+
+// SCIMToken is the bearer token a business's identity provider provisions
+// its members with. A business has at most one; only its hash is stored.
+type SCIMToken struct {
+	ID         int64  `json:"id"`
+	BusinessID int64  `json:"business_id"`
+	TokenHash  string `json:"-"`
+	// CreatedBy is the admin who created the token, to whom SCIM changes are
+	// attributed in the audit log. It is nil once they are deleted.
+	CreatedBy  *int64     `json:"created_by,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// SCIMUser is a user provisioned into a business through SCIM. Its SCIM ID
+// is the user's ID. Inactive users keep their record but are not members.
+type SCIMUser struct {
+	BusinessID  int64
+	UserID      int64
+	UserName    string
+	ExternalID  string
+	GivenName   string
+	FamilyName  string
+	DisplayName string
+	Active      bool
+	// Email is the user's email, read from their account.
+	Email string
+	// Version counts the changes to the record; it makes up its ETag.
+	Version   int
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// SCIMGroup is a group provisioned into a business through SCIM. Members of
+// a group named after a business role are given that role.
+type SCIMGroup struct {
+	ID          int64
+	BusinessID  int64
+	DisplayName string
+	ExternalID  string
+	// MemberIDs are the user IDs of the group's members, all SCIM users of
+	// the business.
+	MemberIDs []int64
+	Version   int
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
@@ -20,7 +20,6 @@ type User struct {
 
 	EmailVerified   bool       `json:"email_verified"`
 	EmailVerifiedAt *time.Time `json:"email_verified_at,omitempty"`
-	GoogleID        *string    `json:"google_id,omitempty"`
 
 	TenantID  int64      `json:"tenant_id,omitempty"`
 	RoleName  string     `json:"role_name,omitempty"`
@@ -0,0 +1,27 @@
+package entity
+
+import "time"
+
+// ExternalIdentity is a user as an external identity provider, such as
+// Google or a company's OpenID Connect issuer, reports them after sign-in.
+type ExternalIdentity struct {
+	Provider string
+	// Subject is the provider's stable ID for the user; emails can change.
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+	Picture       string
+}
+
+// UserIdentity links an external identity to a user. A user may have any
+// number of them, at most one per provider account.
+type UserIdentity struct {
+	ID         int64      `json:"id"`
+	UserID     int64      `json:"-"`
+	Provider   string     `json:"provider"`
+	Subject    string     `json:"-"`
+	Email      string     `json:"email,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
@@ -7,6 +7,8 @@ type UserMFA struct {
 	ID               int64      `json:"id"`
 	UserID           int64      `json:"user_id"`
 	SecretEncrypted  string     `json:"-"`
+	// Secret is the decrypted TOTP secret, filled in by the repository.
+	Secret           string     `json:"-"`
 	BackupCodesHash  []string   `json:"-"`
 	EnabledAt        *time.Time `json:"enabled_at,omitempty"`
 	LastUsedAt       *time.Time `json:"last_used_at,omitempty"`
@@ -16,3 +18,18 @@ type UserMFA struct {
 func (m *UserMFA) IsEnabled() bool {
 	return m.EnabledAt != nil
 }
+
+// MFA challenge methods record which first factor started the challenge.
+// Sign-ins through an identity provider record its name, e.g. MFAMethodGoogle.
+const (
+	MFAMethodPassword = "password"
+	MFAMethodGoogle   = "google"
+)
+
+// MFAChallenge is a login that passed its first factor and is waiting for a
+// TOTP or backup code. It lives in Redis for a few minutes and is single-use.
+type MFAChallenge struct {
+	UserID   int64  `json:"user_id"`
+	Method   string `json:"method"`
+	Attempts int    `json:"attempts"`
+}
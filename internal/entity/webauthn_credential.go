@@ -0,0 +1,33 @@
+package entity
+
+import "time"
+
+// WebAuthnCredential is a passkey or security key registered to a user.
+type WebAuthnCredential struct {
+	ID             int64      `json:"id"`
+	UserID         int64      `json:"-"`
+	CredentialID   []byte     `json:"-"`
+	PublicKey      []byte     `json:"-"`
+	SignCount      uint32     `json:"-"`
+	AAGUID         []byte     `json:"-"`
+	Transports     []string   `json:"transports,omitempty"`
+	Name           string     `json:"name"`
+	BackupEligible bool       `json:"backup_eligible"`
+	BackedUp       bool       `json:"backed_up"`
+	CreatedAt      time.Time  `json:"created_at"`
+	LastUsedAt     *time.Time `json:"last_used_at,omitempty"`
+}
+
+// WebAuthn ceremony purposes, recorded with each pending challenge so a
+// challenge issued for one ceremony cannot complete another.
+const (
+	WebAuthnPurposeRegister = "register"
+	WebAuthnPurposeLogin    = "login"
+	WebAuthnPurposeMFA      = "mfa"
+)
+
+// WebAuthnSession is the server-side state of one in-flight ceremony.
+type WebAuthnSession struct {
+	UserID  int64  `json:"user_id,omitempty"`
+	Purpose string `json:"purpose"`
+}
@@ -3,7 +3,9 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
+	"time"
 
 	"github.com/Prashant2307200/auth-service/internal/entity"
 	"github.com/Prashant2307200/auth-service/internal/usecase/interfaces"
@@ -69,6 +71,14 @@ func (r *BusinessRepo) CreateWithOwner(ctx context.Context, business *entity.Bus
 		return 0, fmt.Errorf("failed to add owner to business: %w", err)
 	}
 
+	roleQuery := `INSERT INTO roles (business_id, name, permissions, created_at, updated_at) VALUES ($1, $2, $3, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)`
+	for _, name := range []string{entity.RoleNameOwner, entity.RoleNameAdmin, entity.RoleNameMember} {
+		permsJSON, _ := json.Marshal(entity.SystemRoles[name])
+		if _, err := tx.ExecContext(ctx, roleQuery, id, name, string(permsJSON)); err != nil {
+			return 0, fmt.Errorf("failed to create %s role: %w", name, err)
+		}
+	}
+
 	if err := tx.Commit(); err != nil {
 		return 0, fmt.Errorf("failed to commit transaction: %w", err)
 	}
@@ -234,6 +244,25 @@ func (r *BusinessRepo) RemoveUser(ctx context.Context, businessID int64, userID
 	return nil
 }
 
+func (r *BusinessRepo) UpdateUserRole(ctx context.Context, businessID int64, userID int64, role int) error {
+	query := `
+		UPDATE business_users SET role = $3
+		WHERE business_id = $1 AND user_id = $2
+	`
+	res, err := db.Exec(ctx, r.Db, query, businessID, userID, role)
+	if err != nil {
+		return fmt.Errorf("failed to update business user role: %w", err)
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return db.HandleNotFoundError(sql.ErrNoRows, "business user", fmt.Sprintf("%d:%d", businessID, userID))
+	}
+	return nil
+}
+
 func (r *BusinessRepo) GetUsers(ctx context.Context, businessID int64) ([]*entity.User, error) {
 	query := `
 		SELECT u.id, u.username, u.email, u.password, u.profile_pic, u.role, u.created_at, u.updated_at
@@ -433,17 +462,30 @@ func (r *BusinessRepo) ListInvites(ctx context.Context, businessID int64) ([]*en
 	return list, nil
 }
 
+const businessDomainColumns = `id, business_id, domain, verified, auto_join_enabled, COALESCE(verification_token, ''), verified_at, created_at,
+	COALESCE(verification_method, ''), check_failures, last_checked_at, next_check_at`
+
+func scanBusinessDomain(row rowScanner) (*entity.BusinessDomain, error) {
+	var d entity.BusinessDomain
+	err := row.Scan(&d.ID, &d.BusinessID, &d.Domain, &d.Verified, &d.AutoJoinEnabled, &d.VerificationToken, &d.VerifiedAt, &d.CreatedAt,
+		&d.VerificationMethod, &d.CheckFailures, &d.LastCheckedAt, &d.NextCheckAt)
+	if err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
 func (r *BusinessRepo) CreateDomain(ctx context.Context, domain *entity.BusinessDomain) (int64, error) {
 	query := `
-		INSERT INTO business_domains (business_id, domain, verified, auto_join_enabled, verification_token, verified_at, created_at)
-		VALUES ($1, $2, $3, $4, $5, $6, CURRENT_TIMESTAMP)
+		INSERT INTO business_domains (business_id, domain, verified, auto_join_enabled, verification_token, verified_at, next_check_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, CURRENT_TIMESTAMP)
 		RETURNING id
 	`
 	var verifiedAt interface{}
 	if domain.VerifiedAt != nil {
 		verifiedAt = domain.VerifiedAt
 	}
-	row, err := db.QueryRow(ctx, r.Db, query, domain.BusinessID, domain.Domain, domain.Verified, domain.AutoJoinEnabled, domain.VerificationToken, verifiedAt)
+	row, err := db.QueryRow(ctx, r.Db, query, domain.BusinessID, domain.Domain, domain.Verified, domain.AutoJoinEnabled, domain.VerificationToken, verifiedAt, domain.NextCheckAt)
 	if err != nil {
 		return 0, fmt.Errorf("failed to create domain: %w", err)
 	}
@@ -455,37 +497,75 @@ func (r *BusinessRepo) CreateDomain(ctx context.Context, domain *entity.Business
 }
 
 func (r *BusinessRepo) GetDomain(ctx context.Context, businessID int64, domain string) (*entity.BusinessDomain, error) {
-	query := `
-		SELECT id, business_id, domain, verified, auto_join_enabled, verification_token, verified_at, created_at
-		FROM business_domains
-		WHERE business_id = $1 AND domain = $2
-	`
+	query := `SELECT ` + businessDomainColumns + ` FROM business_domains WHERE business_id = $1 AND domain = $2`
 	row, err := db.QueryRow(ctx, r.Db, query, businessID, domain)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query domain: %w", err)
 	}
-	var d entity.BusinessDomain
-	if err := row.Scan(&d.ID, &d.BusinessID, &d.Domain, &d.Verified, &d.AutoJoinEnabled, &d.VerificationToken, &d.VerifiedAt, &d.CreatedAt); err != nil {
+	d, err := scanBusinessDomain(row)
+	if err != nil {
 		return nil, db.HandleNotFoundError(err, "domain", domain)
 	}
-	return &d, nil
+	return d, nil
 }
 
 func (r *BusinessRepo) GetDomainByVerificationToken(ctx context.Context, token string) (*entity.BusinessDomain, error) {
-	query := `
-		SELECT id, business_id, domain, verified, auto_join_enabled, verification_token, verified_at, created_at
-		FROM business_domains
-		WHERE verification_token = $1
-	`
+	query := `SELECT ` + businessDomainColumns + ` FROM business_domains WHERE verification_token = $1`
 	row, err := db.QueryRow(ctx, r.Db, query, token)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query domain by token: %w", err)
 	}
-	var d entity.BusinessDomain
-	if err := row.Scan(&d.ID, &d.BusinessID, &d.Domain, &d.Verified, &d.AutoJoinEnabled, &d.VerificationToken, &d.VerifiedAt, &d.CreatedAt); err != nil {
+	d, err := scanBusinessDomain(row)
+	if err != nil {
 		return nil, db.HandleNotFoundError(err, "domain", token)
 	}
-	return &d, nil
+	return d, nil
+}
+
+func (r *BusinessRepo) ListDomains(ctx context.Context, businessID int64) ([]*entity.BusinessDomain, error) {
+	query := `SELECT ` + businessDomainColumns + ` FROM business_domains WHERE business_id = $1 ORDER BY domain`
+	rows, err := db.QueryRows(ctx, r.Db, query, businessID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list domains: %w", err)
+	}
+	return scanBusinessDomains(rows)
+}
+
+// ClaimDueDomains returns up to limit domains whose next check is due at
+// now, and pushes their next check back to leaseUntil so that other
+// instances skip them while they are checked.
+func (r *BusinessRepo) ClaimDueDomains(ctx context.Context, now, leaseUntil time.Time, limit int) ([]*entity.BusinessDomain, error) {
+	query := `
+		UPDATE business_domains SET next_check_at = $2
+		WHERE id IN (
+			SELECT id FROM business_domains
+			WHERE next_check_at <= $1
+			ORDER BY next_check_at
+			LIMIT $3
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING ` + businessDomainColumns
+	rows, err := db.QueryRows(ctx, r.Db, query, now, leaseUntil, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim domains: %w", err)
+	}
+	return scanBusinessDomains(rows)
+}
+
+func scanBusinessDomains(rows *sql.Rows) ([]*entity.BusinessDomain, error) {
+	defer rows.Close()
+	var domains []*entity.BusinessDomain
+	for rows.Next() {
+		d, err := scanBusinessDomain(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan domain: %w", err)
+		}
+		domains = append(domains, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating domain rows: %w", err)
+	}
+	return domains, nil
 }
 
 func (r *BusinessRepo) FindAutoJoinBusinessByEmailDomain(ctx context.Context, emailDomain string) (*entity.Business, error) {
@@ -510,11 +590,39 @@ func (r *BusinessRepo) FindAutoJoinBusinessByEmailDomain(ctx context.Context, em
 	return &business, nil
 }
 
-func (r *BusinessRepo) VerifyDomain(ctx context.Context, domainID int64) error {
-	query := `UPDATE business_domains SET verified = true, verified_at = CURRENT_TIMESTAMP, verification_token = NULL WHERE id = $1`
-	res, err := db.Exec(ctx, r.Db, query, domainID)
+func (r *BusinessRepo) FindPasswordLoginDisabledBusinessByEmailDomain(ctx context.Context, emailDomain string) (*entity.Business, error) {
+	query := `
+		SELECT b.id, b.name, b.slug, b.email, b.owner_id, COALESCE(b.signup_policy, 'closed'), b.created_at, b.updated_at
+		FROM business_domains bd
+		INNER JOIN businesses b ON b.id = bd.business_id
+		WHERE LOWER(bd.domain) = LOWER($1) AND bd.verified = true AND b.password_login_disabled = true
+		ORDER BY bd.verified_at
+		LIMIT 1
+	`
+	row, err := db.QueryRow(ctx, r.Db, query, emailDomain)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find business disabling password login: %w", err)
+	}
+	var business entity.Business
+	if err := row.Scan(&business.ID, &business.Name, &business.Slug, &business.Email, &business.OwnerID, &business.SignupPolicy, &business.CreatedAt, &business.UpdatedAt); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, db.HandleNotFoundError(err, "business", emailDomain)
+	}
+	return &business, nil
+}
+
+const updateDomainCheckQuery = `
+	UPDATE business_domains
+	SET verified = $1, verified_at = $2, verification_method = NULLIF($3, ''), check_failures = $4, last_checked_at = $5, next_check_at = $6
+	WHERE id = $7`
+
+// UpdateDomainCheck records the outcome of a verification check.
+func (r *BusinessRepo) UpdateDomainCheck(ctx context.Context, domain *entity.BusinessDomain) error {
+	res, err := db.Exec(ctx, r.Db, updateDomainCheckQuery, domain.Verified, domain.VerifiedAt, domain.VerificationMethod, domain.CheckFailures, domain.LastCheckedAt, domain.NextCheckAt, domain.ID)
 	if err != nil {
-		return fmt.Errorf("failed to verify domain: %w", err)
+		return fmt.Errorf("failed to update domain check: %w", err)
 	}
 	rows, _ := res.RowsAffected()
 	if rows == 0 {
@@ -523,6 +631,24 @@ func (r *BusinessRepo) VerifyDomain(ctx context.Context, domainID int64) error {
 	return nil
 }
 
+// UpdateClaimedDomainCheck records the outcome of a check like
+// UpdateDomainCheck, but only while the domain's next check is still
+// leaseUntil, that is while the claim the check was made under holds. It
+// reports false when the lease ran out and another instance claimed the
+// domain, or when an admin's check was recorded meanwhile.
+func (r *BusinessRepo) UpdateClaimedDomainCheck(ctx context.Context, domain *entity.BusinessDomain, leaseUntil time.Time) (bool, error) {
+	query := updateDomainCheckQuery + ` AND next_check_at = $8`
+	res, err := db.Exec(ctx, r.Db, query, domain.Verified, domain.VerifiedAt, domain.VerificationMethod, domain.CheckFailures, domain.LastCheckedAt, domain.NextCheckAt, domain.ID, leaseUntil)
+	if err != nil {
+		return false, fmt.Errorf("failed to update domain check: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to update domain check: %w", err)
+	}
+	return n == 1, nil
+}
+
 func (r *BusinessRepo) UpdateDomainAutoJoin(ctx context.Context, domainID int64, businessID int64, enabled bool) error {
 	query := `UPDATE business_domains SET auto_join_enabled = $1 WHERE id = $2 AND business_id = $3`
 	res, err := db.Exec(ctx, r.Db, query, enabled, domainID, businessID)
@@ -535,3 +661,29 @@ func (r *BusinessRepo) UpdateDomainAutoJoin(ctx context.Context, domainID int64,
 	}
 	return nil
 }
+
+func (r *BusinessRepo) GetLoginPolicy(ctx context.Context, businessID int64) (*entity.BusinessLoginPolicy, error) {
+	query := `SELECT id, password_login_disabled FROM businesses WHERE id = $1`
+	row, err := db.QueryRow(ctx, r.Db, query, businessID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query login policy: %w", err)
+	}
+	var policy entity.BusinessLoginPolicy
+	if err := row.Scan(&policy.BusinessID, &policy.PasswordLoginDisabled); err != nil {
+		return nil, db.HandleNotFoundError(err, "business", businessID)
+	}
+	return &policy, nil
+}
+
+func (r *BusinessRepo) UpdateLoginPolicy(ctx context.Context, policy *entity.BusinessLoginPolicy) error {
+	query := `UPDATE businesses SET password_login_disabled = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2`
+	res, err := db.Exec(ctx, r.Db, query, policy.PasswordLoginDisabled, policy.BusinessID)
+	if err != nil {
+		return fmt.Errorf("failed to update login policy: %w", err)
+	}
+	rows, _ := res.RowsAffected()
+	if rows == 0 {
+		return db.HandleNotFoundError(sql.ErrNoRows, "business", policy.BusinessID)
+	}
+	return nil
+}
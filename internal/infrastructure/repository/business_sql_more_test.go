@@ -36,3 +36,30 @@ func TestBusinessRepo_GetBySlug_Update_Delete(t *testing.T) {
 
 	require.NoError(t, mock.ExpectationsWereMet())
 }
+
+func TestBusinessRepo_UpdateClaimedDomainCheck(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	r, err := NewBusinessRepo(db)
+	require.NoError(t, err)
+
+	now := time.Now()
+	lease := now.Add(5 * time.Minute)
+	next := now.Add(24 * time.Hour)
+	d := &entity.BusinessDomain{ID: 3, Verified: true, VerifiedAt: &now, VerificationMethod: "dns", LastCheckedAt: &now, NextCheckAt: &next}
+	query := regexp.QuoteMeta("WHERE id = $7 AND next_check_at = $8")
+
+	mock.ExpectExec(query).WithArgs(true, &now, "dns", 0, &now, &next, int64(3), lease).WillReturnResult(sqlmock.NewResult(0, 1))
+	ok, err := r.UpdateClaimedDomainCheck(context.Background(), d, lease)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	// A lapsed claim leaves the row to whoever holds it now.
+	mock.ExpectExec(query).WithArgs(true, &now, "dns", 0, &now, &next, int64(3), lease).WillReturnResult(sqlmock.NewResult(0, 0))
+	ok, err = r.UpdateClaimedDomainCheck(context.Background(), d, lease)
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
@@ -3,38 +3,66 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
 
 	"github.com/Prashant2307200/auth-service/internal/entity"
+	"github.com/Prashant2307200/auth-service/pkg/crypto"
 	"github.com/lib/pq"
 )
 
 type MFARepository interface {
-	Create(ctx context.Context, userID int64, secretEncrypted string) (*entity.UserMFA, error)
+	// Create stores a new TOTP secret for the user; it is sealed before it is written.
+	Create(ctx context.Context, userID int64, secret string) (*entity.UserMFA, error)
 	GetByUserID(ctx context.Context, userID int64) (*entity.UserMFA, error)
 	Enable(ctx context.Context, userID int64, backupCodesHash []string) error
 	Disable(ctx context.Context, userID int64) error
 	UpdateBackupCodes(ctx context.Context, userID int64, backupCodesHash []string) error
 	UpdateLastUsed(ctx context.Context, userID int64) error
+	// ClaimTOTPStep records step as the last accepted TOTP time-step. It
+	// reports false when the step is not newer than the one already recorded,
+	// meaning the code was used before.
+	ClaimTOTPStep(ctx context.Context, userID int64, step int64) (bool, error)
+	// ClaimBackupCode removes codeHash from the user's backup codes. It
+	// reports false when the code is not among them, meaning it is wrong or
+	// was spent already.
+	ClaimBackupCode(ctx context.Context, userID int64, codeHash string) (bool, error)
 	Delete(ctx context.Context, userID int64) error
+	// ReencryptSecrets re-seals up to limit secrets with id > afterID that are
+	// not under the active master key. It returns the number of rows
+	// rewritten, the ids of rows it could not decrypt and left alone, and the
+	// last id examined, which is 0 once no stale rows remain.
+	ReencryptSecrets(ctx context.Context, afterID int64, limit int) (int, []int64, int64, error)
 }
 
+var ErrMFAEncryptionDisabled = errors.New("MFA secret encryption is not configured")
+
 type mfaRepo struct {
-	db *sql.DB
+	db      *sql.DB
+	secrets *crypto.Envelope
 }
 
-func NewMFARepo(db *sql.DB) MFARepository {
-	return &mfaRepo{db: db}
+// NewMFARepo returns an MFA repository that seals TOTP secrets with secrets.
+// A nil envelope stores them as-is, which is only acceptable in development.
+func NewMFARepo(db *sql.DB, secrets *crypto.Envelope) MFARepository {
+	return &mfaRepo{db: db, secrets: secrets}
 }
 
-func (r *mfaRepo) Create(ctx context.Context, userID int64, secretEncrypted string) (*entity.UserMFA, error) {
+func (r *mfaRepo) Create(ctx context.Context, userID int64, secret string) (*entity.UserMFA, error) {
+	secretEncrypted, err := r.seal(userID, secret)
+	if err != nil {
+		return nil, err
+	}
 	query := `
 		INSERT INTO user_mfa (user_id, secret_encrypted)
 		VALUES ($1, $2)
-		ON CONFLICT (user_id) DO UPDATE SET secret_encrypted = $2, enabled_at = NULL, created_at = NOW()
+		ON CONFLICT (user_id) DO UPDATE SET secret_encrypted = $2, enabled_at = NULL, last_totp_step = NULL, created_at = NOW()
 		RETURNING id, user_id, secret_encrypted, backup_codes_hash, enabled_at, last_used_at, created_at
 	`
 	var mfa entity.UserMFA
-	err := r.db.QueryRowContext(ctx, query, userID, secretEncrypted).Scan(
+	err = r.db.QueryRowContext(ctx, query, userID, secretEncrypted).Scan(
 		&mfa.ID,
 		&mfa.UserID,
 		&mfa.SecretEncrypted,
@@ -46,6 +74,9 @@ func (r *mfaRepo) Create(ctx context.Context, userID int64, secretEncrypted stri
 	if err != nil {
 		return nil, err
 	}
+	if err := r.open(&mfa); err != nil {
+		return nil, err
+	}
 	return &mfa, nil
 }
 
@@ -68,6 +99,9 @@ func (r *mfaRepo) GetByUserID(ctx context.Context, userID int64) (*entity.UserMF
 	if err != nil {
 		return nil, err
 	}
+	if err := r.open(&mfa); err != nil {
+		return nil, err
+	}
 	return &mfa, nil
 }
 
@@ -95,8 +129,148 @@ func (r *mfaRepo) UpdateLastUsed(ctx context.Context, userID int64) error {
 	return err
 }
 
+func (r *mfaRepo) ClaimTOTPStep(ctx context.Context, userID int64, step int64) (bool, error) {
+	query := `
+		UPDATE user_mfa SET last_totp_step = $2, last_used_at = NOW()
+		WHERE user_id = $1 AND (last_totp_step IS NULL OR last_totp_step < $2)
+	`
+	res, err := r.db.ExecContext(ctx, query, userID, step)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+func (r *mfaRepo) ClaimBackupCode(ctx context.Context, userID int64, codeHash string) (bool, error) {
+	query := `
+		UPDATE user_mfa SET backup_codes_hash = array_remove(backup_codes_hash, $2), last_used_at = NOW()
+		WHERE user_id = $1 AND $2 = ANY(backup_codes_hash)
+	`
+	res, err := r.db.ExecContext(ctx, query, userID, codeHash)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
 func (r *mfaRepo) Delete(ctx context.Context, userID int64) error {
 	query := `DELETE FROM user_mfa WHERE user_id = $1`
 	_, err := r.db.ExecContext(ctx, query, userID)
 	return err
 }
+
+func (r *mfaRepo) ReencryptSecrets(ctx context.Context, afterID int64, limit int) (int, []int64, int64, error) {
+	if r.secrets == nil {
+		return 0, nil, 0, ErrMFAEncryptionDisabled
+	}
+
+	query := `
+		SELECT id, user_id, secret_encrypted
+		FROM user_mfa
+		WHERE id > $1 AND secret_encrypted NOT LIKE $2
+		ORDER BY id
+		LIMIT $3
+	`
+	rows, err := r.db.QueryContext(ctx, query, afterID, escapeLike(r.secrets.ActivePrefix())+"%", limit)
+	if err != nil {
+		return 0, nil, 0, err
+	}
+	type staleSecret struct {
+		mfa    entity.UserMFA
+		stored string
+	}
+	var stale []staleSecret
+	for rows.Next() {
+		var s staleSecret
+		if err := rows.Scan(&s.mfa.ID, &s.mfa.UserID, &s.mfa.SecretEncrypted); err != nil {
+			rows.Close()
+			return 0, nil, 0, err
+		}
+		s.stored = s.mfa.SecretEncrypted
+		stale = append(stale, s)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, nil, 0, err
+	}
+	if len(stale) == 0 {
+		return 0, nil, 0, nil
+	}
+
+	rewritten := 0
+	var failed []int64
+	for _, s := range stale {
+		if !r.secrets.NeedsReencrypt(s.stored) {
+			continue
+		}
+		// A row that cannot be opened, say one sealed under a key that was
+		// since removed, must not keep the rest from being rewritten.
+		if err := r.open(&s.mfa); err != nil {
+			failed = append(failed, s.mfa.ID)
+			continue
+		}
+		sealed, err := r.seal(s.mfa.UserID, s.mfa.Secret)
+		if err != nil {
+			return rewritten, failed, 0, err
+		}
+		// Compare-and-swap so a concurrent re-setup is never overwritten.
+		res, err := r.db.ExecContext(ctx,
+			`UPDATE user_mfa SET secret_encrypted = $1 WHERE id = $2 AND secret_encrypted = $3`,
+			sealed, s.mfa.ID, s.stored)
+		if err != nil {
+			return rewritten, failed, 0, err
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			rewritten++
+		}
+	}
+	return rewritten, failed, stale[len(stale)-1].mfa.ID, nil
+}
+
+// seal encrypts secret bound to userID, so a sealed value copied to another
+// user's row fails to decrypt.
+func (r *mfaRepo) seal(userID int64, secret string) (string, error) {
+	if r.secrets == nil {
+		return secret, nil
+	}
+	sealed, err := r.secrets.Encrypt([]byte(secret), mfaSecretAAD(userID))
+	if err != nil {
+		return "", fmt.Errorf("failed to encrypt MFA secret: %w", err)
+	}
+	return sealed, nil
+}
+
+// open fills mfa.Secret from mfa.SecretEncrypted. Rows written before
+// encryption was enabled hold the plaintext secret and are passed through
+// until ReencryptSecrets seals them.
+func (r *mfaRepo) open(mfa *entity.UserMFA) error {
+	if !crypto.IsEnvelope(mfa.SecretEncrypted) {
+		mfa.Secret = mfa.SecretEncrypted
+		return nil
+	}
+	if r.secrets == nil {
+		return ErrMFAEncryptionDisabled
+	}
+	secret, err := r.secrets.Decrypt(mfa.SecretEncrypted, mfaSecretAAD(mfa.UserID))
+	if err != nil {
+		return fmt.Errorf("failed to decrypt MFA secret: %w", err)
+	}
+	mfa.Secret = string(secret)
+	return nil
+}
+
+func mfaSecretAAD(userID int64) []byte {
+	return []byte("user_mfa:" + strconv.FormatInt(userID, 10))
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
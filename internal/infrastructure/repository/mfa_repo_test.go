@@ -0,0 +1,151 @@
+package repository
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql/driver"
+	"regexp"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/Prashant2307200/auth-service/pkg/crypto"
+	"github.com/stretchr/testify/require"
+)
+
+func testEnvelope(t *testing.T, active string, keys map[string][]byte) *crypto.Envelope {
+	t.Helper()
+	provider, err := crypto.NewStaticKeyProvider(active, keys)
+	require.NoError(t, err)
+	return crypto.NewEnvelope(provider)
+}
+
+func randomKey(t *testing.T) []byte {
+	t.Helper()
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	require.NoError(t, err)
+	return key
+}
+
+// sealedArg matches any value sealed under the given key version.
+type sealedArg struct{ version string }
+
+func (a sealedArg) Match(v driver.Value) bool {
+	s, ok := v.(string)
+	if !ok {
+		return false
+	}
+	version, err := crypto.KeyVersion(s)
+	return err == nil && version == a.version
+}
+
+var mfaColumns = []string{"id", "user_id", "secret_encrypted", "backup_codes_hash", "enabled_at", "last_used_at", "created_at"}
+
+func TestMFARepo_CreateSealsSecret(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	env := testEnvelope(t, "v1", map[string][]byte{"v1": randomKey(t)})
+	sealed, err := env.Encrypt([]byte("JBSWY3DPEHPK3PXP"), []byte("user_mfa:7"))
+	require.NoError(t, err)
+
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO user_mfa (user_id, secret_encrypted)")).
+		WithArgs(int64(7), sealedArg{version: "v1"}).
+		WillReturnRows(sqlmock.NewRows(mfaColumns).AddRow(1, 7, sealed, nil, nil, nil, time.Now()))
+
+	got, err := NewMFARepo(db, env).Create(context.Background(), 7, "JBSWY3DPEHPK3PXP")
+	require.NoError(t, err)
+	require.Equal(t, "JBSWY3DPEHPK3PXP", got.Secret)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMFARepo_GetByUserID_RejectsSwappedRow(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	env := testEnvelope(t, "v1", map[string][]byte{"v1": randomKey(t)})
+	otherUsers, err := env.Encrypt([]byte("JBSWY3DPEHPK3PXP"), []byte("user_mfa:8"))
+	require.NoError(t, err)
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM user_mfa")).WithArgs(int64(7)).
+		WillReturnRows(sqlmock.NewRows(mfaColumns).AddRow(1, 7, otherUsers, nil, nil, nil, time.Now()))
+
+	_, err = NewMFARepo(db, env).GetByUserID(context.Background(), 7)
+	require.ErrorIs(t, err, crypto.ErrDecryptFailed)
+}
+
+func TestMFARepo_ReencryptSecrets(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	v1 := randomKey(t)
+	old, err := testEnvelope(t, "v1", map[string][]byte{"v1": v1}).Encrypt([]byte("OLDSECRET"), []byte("user_mfa:7"))
+	require.NoError(t, err)
+	retired, err := testEnvelope(t, "v0", map[string][]byte{"v0": randomKey(t)}).Encrypt([]byte("LOSTSECRET"), []byte("user_mfa:8"))
+	require.NoError(t, err)
+	env := testEnvelope(t, "v2", map[string][]byte{"v1": v1, "v2": randomKey(t)})
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, user_id, secret_encrypted")).
+		WithArgs(int64(0), "enc:v1:v2:%", 100).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "secret_encrypted"}).
+			AddRow(3, 7, old).
+			AddRow(4, 8, retired).
+			AddRow(5, 9, "LEGACYPLAINTEXT"))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE user_mfa SET secret_encrypted = $1 WHERE id = $2 AND secret_encrypted = $3")).
+		WithArgs(sealedArg{version: "v2"}, int64(3), old).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE user_mfa SET secret_encrypted = $1 WHERE id = $2 AND secret_encrypted = $3")).
+		WithArgs(sealedArg{version: "v2"}, int64(5), "LEGACYPLAINTEXT").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	n, failed, lastID, err := NewMFARepo(db, env).ReencryptSecrets(context.Background(), 0, 100)
+	require.NoError(t, err)
+	require.Equal(t, 1, n, "row changed concurrently must not count")
+	require.Equal(t, []int64{4}, failed, "a row under a removed key is skipped, not fatal")
+	require.Equal(t, int64(5), lastID)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMFARepo_ClaimTOTPStep(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	claim := regexp.QuoteMeta("UPDATE user_mfa SET last_totp_step = $2")
+	mock.ExpectExec(claim).WithArgs(int64(7), int64(1000)).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(claim).WithArgs(int64(7), int64(1000)).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	repo := NewMFARepo(db, nil)
+	ok, err := repo.ClaimTOTPStep(context.Background(), 7, 1000)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	ok, err = repo.ClaimTOTPStep(context.Background(), 7, 1000)
+	require.NoError(t, err)
+	require.False(t, ok, "a step that is not newer must be refused")
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMFARepo_ClaimBackupCode(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	claim := regexp.QuoteMeta("UPDATE user_mfa SET backup_codes_hash = array_remove(backup_codes_hash, $2)")
+	mock.ExpectExec(claim).WithArgs(int64(7), "hash").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(claim).WithArgs(int64(7), "hash").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	repo := NewMFARepo(db, nil)
+	ok, err := repo.ClaimBackupCode(context.Background(), 7, "hash")
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	ok, err = repo.ClaimBackupCode(context.Background(), 7, "hash")
+	require.NoError(t, err)
+	require.False(t, ok, "a spent code must be refused")
+	require.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,91 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/Prashant2307200/auth-service/internal/entity"
+	"github.com/lib/pq"
+)
+
+type OAuthClientRepository interface {
+	// Create stores client and fills in its ID and creation time.
+	Create(ctx context.Context, client *entity.OAuthClient) error
+	GetByClientID(ctx context.Context, clientID string) (*entity.OAuthClient, error)
+	List(ctx context.Context) ([]*entity.OAuthClient, error)
+	Delete(ctx context.Context, clientID string) error
+}
+
+type oauthClientRepo struct {
+	db *sql.DB
+}
+
+func NewOAuthClientRepo(db *sql.DB) OAuthClientRepository {
+	return &oauthClientRepo{db: db}
+}
+
+const oauthClientColumns = `id, client_id, name, secret_hash, public, redirect_uris, scopes, business_id, first_party, created_at`
+
+func (r *oauthClientRepo) Create(ctx context.Context, client *entity.OAuthClient) error {
+	query := `
+		INSERT INTO oauth_clients (client_id, name, secret_hash, public, redirect_uris, scopes, business_id, first_party)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id, created_at
+	`
+	return r.db.QueryRowContext(ctx, query,
+		client.ClientID, client.Name, client.SecretHash, client.Public,
+		pq.Array(client.RedirectURIs), pq.Array(client.Scopes), client.BusinessID, client.FirstParty,
+	).Scan(&client.ID, &client.CreatedAt)
+}
+
+func (r *oauthClientRepo) GetByClientID(ctx context.Context, clientID string) (*entity.OAuthClient, error) {
+	query := `SELECT ` + oauthClientColumns + ` FROM oauth_clients WHERE client_id = $1`
+	return scanOAuthClient(r.db.QueryRowContext(ctx, query, clientID))
+}
+
+func (r *oauthClientRepo) List(ctx context.Context) ([]*entity.OAuthClient, error) {
+	query := `SELECT ` + oauthClientColumns + ` FROM oauth_clients ORDER BY created_at`
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var clients []*entity.OAuthClient
+	for rows.Next() {
+		client, err := scanOAuthClient(rows)
+		if err != nil {
+			return nil, err
+		}
+		clients = append(clients, client)
+	}
+	return clients, rows.Err()
+}
+
+func (r *oauthClientRepo) Delete(ctx context.Context, clientID string) error {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM oauth_clients WHERE client_id = $1`, clientID)
+	if err != nil {
+		return err
+	}
+	return requireRowAffected(res)
+}
+
+func scanOAuthClient(row rowScanner) (*entity.OAuthClient, error) {
+	var client entity.OAuthClient
+	err := row.Scan(
+		&client.ID,
+		&client.ClientID,
+		&client.Name,
+		&client.SecretHash,
+		&client.Public,
+		pq.Array(&client.RedirectURIs),
+		pq.Array(&client.Scopes),
+		&client.BusinessID,
+		&client.FirstParty,
+		&client.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &client, nil
+}
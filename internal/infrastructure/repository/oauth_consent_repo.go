@@ -0,0 +1,88 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/Prashant2307200/auth-service/internal/entity"
+	"github.com/lib/pq"
+)
+
+type OAuthConsentRepository interface {
+	// Get returns the scopes the user granted the client, or sql.ErrNoRows.
+	Get(ctx context.Context, userID int64, clientID string) (*entity.OAuthConsent, error)
+	// Grant adds scopes to the user's consent for the client.
+	Grant(ctx context.Context, userID int64, clientID string, scopes []string) error
+	ListByUser(ctx context.Context, userID int64) ([]*entity.OAuthConsent, error)
+	Revoke(ctx context.Context, userID int64, clientID string) error
+}
+
+type oauthConsentRepo struct {
+	db *sql.DB
+}
+
+func NewOAuthConsentRepo(db *sql.DB) OAuthConsentRepository {
+	return &oauthConsentRepo{db: db}
+}
+
+func (r *oauthConsentRepo) Get(ctx context.Context, userID int64, clientID string) (*entity.OAuthConsent, error) {
+	query := `
+		SELECT c.client_id, oc.name, c.scopes, c.granted_at
+		FROM oauth_consents c JOIN oauth_clients oc ON oc.client_id = c.client_id
+		WHERE c.user_id = $1 AND c.client_id = $2
+	`
+	return scanOAuthConsent(r.db.QueryRowContext(ctx, query, userID, clientID))
+}
+
+func (r *oauthConsentRepo) Grant(ctx context.Context, userID int64, clientID string, scopes []string) error {
+	query := `
+		INSERT INTO oauth_consents (user_id, client_id, scopes)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id, client_id) DO UPDATE
+		SET scopes = ARRAY(SELECT DISTINCT unnest(oauth_consents.scopes || EXCLUDED.scopes)),
+			granted_at = NOW()
+	`
+	_, err := r.db.ExecContext(ctx, query, userID, clientID, pq.Array(scopes))
+	return err
+}
+
+func (r *oauthConsentRepo) ListByUser(ctx context.Context, userID int64) ([]*entity.OAuthConsent, error) {
+	query := `
+		SELECT c.client_id, oc.name, c.scopes, c.granted_at
+		FROM oauth_consents c JOIN oauth_clients oc ON oc.client_id = c.client_id
+		WHERE c.user_id = $1
+		ORDER BY c.granted_at DESC
+	`
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var consents []*entity.OAuthConsent
+	for rows.Next() {
+		consent, err := scanOAuthConsent(rows)
+		if err != nil {
+			return nil, err
+		}
+		consents = append(consents, consent)
+	}
+	return consents, rows.Err()
+}
+
+func (r *oauthConsentRepo) Revoke(ctx context.Context, userID int64, clientID string) error {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM oauth_consents WHERE user_id = $1 AND client_id = $2`, userID, clientID)
+	if err != nil {
+		return err
+	}
+	return requireRowAffected(res)
+}
+
+func scanOAuthConsent(row rowScanner) (*entity.OAuthConsent, error) {
+	var consent entity.OAuthConsent
+	err := row.Scan(&consent.ClientID, &consent.ClientName, pq.Array(&consent.Scopes), &consent.GrantedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &consent, nil
+}
@@ -0,0 +1,103 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/Prashant2307200/auth-service/internal/entity"
+	"github.com/lib/pq"
+)
+
+type PersonalAccessTokenRepository interface {
+	// Create stores token and fills in its ID and creation time.
+	Create(ctx context.Context, token *entity.PersonalAccessToken) error
+	GetByHash(ctx context.Context, tokenHash string) (*entity.PersonalAccessToken, error)
+	ListByUser(ctx context.Context, userID int64) ([]*entity.PersonalAccessToken, error)
+	CountByUser(ctx context.Context, userID int64) (int, error)
+	TouchLastUsed(ctx context.Context, id int64) error
+	Delete(ctx context.Context, userID, id int64) error
+}
+
+type personalAccessTokenRepo struct {
+	db *sql.DB
+}
+
+func NewPersonalAccessTokenRepo(db *sql.DB) PersonalAccessTokenRepository {
+	return &personalAccessTokenRepo{db: db}
+}
+
+const personalAccessTokenColumns = `id, user_id, name, token_hash, scopes, business_id, expires_at, last_used_at, created_at`
+
+func (r *personalAccessTokenRepo) Create(ctx context.Context, token *entity.PersonalAccessToken) error {
+	query := `
+		INSERT INTO personal_access_tokens (user_id, name, token_hash, scopes, business_id, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at
+	`
+	return r.db.QueryRowContext(ctx, query,
+		token.UserID, token.Name, token.TokenHash, pq.Array(token.Scopes), token.BusinessID, token.ExpiresAt,
+	).Scan(&token.ID, &token.CreatedAt)
+}
+
+func (r *personalAccessTokenRepo) GetByHash(ctx context.Context, tokenHash string) (*entity.PersonalAccessToken, error) {
+	query := `SELECT ` + personalAccessTokenColumns + ` FROM personal_access_tokens WHERE token_hash = $1`
+	return scanPersonalAccessToken(r.db.QueryRowContext(ctx, query, tokenHash))
+}
+
+func (r *personalAccessTokenRepo) ListByUser(ctx context.Context, userID int64) ([]*entity.PersonalAccessToken, error) {
+	query := `SELECT ` + personalAccessTokenColumns + ` FROM personal_access_tokens WHERE user_id = $1 ORDER BY created_at`
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []*entity.PersonalAccessToken
+	for rows.Next() {
+		token, err := scanPersonalAccessToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens, rows.Err()
+}
+
+func (r *personalAccessTokenRepo) CountByUser(ctx context.Context, userID int64) (int, error) {
+	var n int
+	err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM personal_access_tokens WHERE user_id = $1`, userID).Scan(&n)
+	return n, err
+}
+
+func (r *personalAccessTokenRepo) TouchLastUsed(ctx context.Context, id int64) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE personal_access_tokens SET last_used_at = NOW() WHERE id = $1`, id)
+	return err
+}
+
+func (r *personalAccessTokenRepo) Delete(ctx context.Context, userID, id int64) error {
+	query := `DELETE FROM personal_access_tokens WHERE id = $1 AND user_id = $2`
+	res, err := r.db.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+	return requireRowAffected(res)
+}
+
+func scanPersonalAccessToken(row rowScanner) (*entity.PersonalAccessToken, error) {
+	var token entity.PersonalAccessToken
+	err := row.Scan(
+		&token.ID,
+		&token.UserID,
+		&token.Name,
+		&token.TokenHash,
+		pq.Array(&token.Scopes),
+		&token.BusinessID,
+		&token.ExpiresAt,
+		&token.LastUsedAt,
+		&token.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
@@ -56,6 +56,23 @@ func (r *RolePostgres) GetByID(ctx context.Context, id int64) (*entity.Role, err
 	return &role, nil
 }
 
+func (r *RolePostgres) GetByName(ctx context.Context, businessID int64, name string) (*entity.Role, error) {
+	query := `SELECT id, business_id, name, permissions, created_at, updated_at FROM roles WHERE business_id = $1 AND name = $2`
+	row, err := db.QueryRow(ctx, r.Db, query, businessID, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query role: %w", err)
+	}
+	var role entity.Role
+	var permsStr string
+	if err := row.Scan(&role.ID, &role.BusinessID, &role.Name, &permsStr, &role.CreatedAt, &role.UpdatedAt); err != nil {
+		return nil, db.HandleNotFoundError(err, "role", name)
+	}
+	if len(permsStr) > 0 {
+		_ = json.Unmarshal([]byte(permsStr), &role.Permissions)
+	}
+	return &role, nil
+}
+
 func (r *RolePostgres) ListByBusiness(ctx context.Context, businessID int64) ([]*entity.Role, error) {
 	query := `SELECT id, business_id, name, permissions, created_at, updated_at FROM roles WHERE business_id = $1 ORDER BY name ASC`
 	rows, err := db.QueryRows(ctx, r.Db, query, businessID)
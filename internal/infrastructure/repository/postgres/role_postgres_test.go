@@ -2,6 +2,7 @@ package repository
 
 import (
 	"context"
+	"database/sql"
 	// driver import removed; use sqlmock result constructors instead
 	"regexp"
 	"testing"
@@ -9,6 +10,7 @@ import (
 
 	sqlmock "github.com/DATA-DOG/go-sqlmock"
 	"github.com/Prashant2307200/auth-service/internal/entity"
+	pkgdb "github.com/Prashant2307200/auth-service/pkg/db"
 	"github.com/stretchr/testify/require"
 )
 
@@ -74,3 +76,26 @@ func TestRolePostgres_GetByID_NotFound(t *testing.T) {
 	_, err = rp.GetByID(context.Background(), 999)
 	require.Error(t, err)
 }
+
+func TestRolePostgres_GetByName(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	now := time.Now()
+	query := regexp.QuoteMeta("SELECT id, business_id, name, permissions, created_at, updated_at FROM roles WHERE business_id = $1 AND name = $2")
+	rows := sqlmock.NewRows([]string{"id", "business_id", "name", "permissions", "created_at", "updated_at"}).AddRow(101, 10, "member", `["members:read","audit:read"]`, now, now)
+	mock.ExpectQuery(query).WithArgs(int64(10), "member").WillReturnRows(rows)
+	mock.ExpectQuery(query).WithArgs(int64(10), "viewer").WillReturnError(sql.ErrNoRows)
+
+	rp, err := NewRolePostgres(db)
+	require.NoError(t, err)
+
+	r, err := rp.GetByName(context.Background(), 10, "member")
+	require.NoError(t, err)
+	require.Equal(t, []string{"members:read", "audit:read"}, r.Permissions)
+
+	_, err = rp.GetByName(context.Background(), 10, "viewer")
+	require.ErrorIs(t, err, pkgdb.ErrNotFound)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
@@ -2,8 +2,11 @@ package repository
 
 import (
 	"context"
+	"database/sql"
+	"fmt"
 
 	"github.com/Prashant2307200/auth-service/internal/entity"
+	postgresrepo "github.com/Prashant2307200/auth-service/internal/infrastructure/repository/postgres"
 )
 
 // RoleRepository defines CRUD operations for roles scoped to a business (tenant)
@@ -11,6 +14,16 @@ type RoleRepository interface {
 	Create(ctx context.Context, role *entity.Role) (int64, error)
 	GetByID(ctx context.Context, id int64) (*entity.Role, error)
 	ListByBusiness(ctx context.Context, businessID int64) ([]*entity.Role, error)
+	// GetByName returns the business's role called name; businesses start
+	// with the system roles of entity.SystemRoles.
+	GetByName(ctx context.Context, businessID int64, name string) (*entity.Role, error)
 	Update(ctx context.Context, role *entity.Role) error
 	Delete(ctx context.Context, id int64) error
 }
+
+func NewRoleRepo(database *sql.DB) (RoleRepository, error) {
+	if database == nil {
+		return nil, fmt.Errorf("database cannot be nil")
+	}
+	return postgresrepo.NewRolePostgres(database)
+}
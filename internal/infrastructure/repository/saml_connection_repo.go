@@ -0,0 +1,101 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/Prashant2307200/auth-service/internal/entity"
+)
+
+type SAMLConnectionRepository interface {
+	// Save creates or replaces the business's connection and fills in its ID
+	// and timestamps.
+	Save(ctx context.Context, conn *entity.SAMLConnection) error
+	GetByBusiness(ctx context.Context, businessID int64) (*entity.SAMLConnection, error)
+	// FindByEmailDomain returns the enabled connection of the business that
+	// has verified domain, or sql.ErrNoRows.
+	FindByEmailDomain(ctx context.Context, domain string) (*entity.SAMLConnection, error)
+	Delete(ctx context.Context, businessID int64) error
+}
+
+type samlConnectionRepo struct {
+	db *sql.DB
+}
+
+func NewSAMLConnectionRepo(db *sql.DB) SAMLConnectionRepository {
+	return &samlConnectionRepo{db: db}
+}
+
+const samlConnectionColumns = `id, business_id, idp_entity_id, idp_sso_url, idp_slo_url, idp_certificate,
+	email_attribute, username_attribute, default_role, enabled, created_at, updated_at`
+
+func (r *samlConnectionRepo) Save(ctx context.Context, conn *entity.SAMLConnection) error {
+	query := `
+		INSERT INTO saml_connections (business_id, idp_entity_id, idp_sso_url, idp_slo_url, idp_certificate,
+			email_attribute, username_attribute, default_role, enabled)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (business_id) DO UPDATE SET
+			idp_entity_id = EXCLUDED.idp_entity_id,
+			idp_sso_url = EXCLUDED.idp_sso_url,
+			idp_slo_url = EXCLUDED.idp_slo_url,
+			idp_certificate = EXCLUDED.idp_certificate,
+			email_attribute = EXCLUDED.email_attribute,
+			username_attribute = EXCLUDED.username_attribute,
+			default_role = EXCLUDED.default_role,
+			enabled = EXCLUDED.enabled,
+			updated_at = NOW()
+		RETURNING id, created_at, updated_at
+	`
+	return r.db.QueryRowContext(ctx, query,
+		conn.BusinessID, conn.IdPEntityID, conn.IdPSSOURL, conn.IdPSLOURL, conn.IdPCertificate,
+		conn.EmailAttribute, conn.UsernameAttribute, conn.DefaultRole, conn.Enabled,
+	).Scan(&conn.ID, &conn.CreatedAt, &conn.UpdatedAt)
+}
+
+func (r *samlConnectionRepo) GetByBusiness(ctx context.Context, businessID int64) (*entity.SAMLConnection, error) {
+	query := `SELECT ` + samlConnectionColumns + ` FROM saml_connections WHERE business_id = $1`
+	return scanSAMLConnection(r.db.QueryRowContext(ctx, query, businessID))
+}
+
+func (r *samlConnectionRepo) FindByEmailDomain(ctx context.Context, domain string) (*entity.SAMLConnection, error) {
+	query := `
+		SELECT sc.id, sc.business_id, sc.idp_entity_id, sc.idp_sso_url, sc.idp_slo_url, sc.idp_certificate,
+			sc.email_attribute, sc.username_attribute, sc.default_role, sc.enabled, sc.created_at, sc.updated_at
+		FROM saml_connections sc
+		INNER JOIN business_domains bd ON bd.business_id = sc.business_id
+		WHERE LOWER(bd.domain) = LOWER($1) AND bd.verified = true AND sc.enabled = true
+		ORDER BY bd.verified_at
+		LIMIT 1
+	`
+	return scanSAMLConnection(r.db.QueryRowContext(ctx, query, domain))
+}
+
+func (r *samlConnectionRepo) Delete(ctx context.Context, businessID int64) error {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM saml_connections WHERE business_id = $1`, businessID)
+	if err != nil {
+		return err
+	}
+	return requireRowAffected(res)
+}
+
+func scanSAMLConnection(row rowScanner) (*entity.SAMLConnection, error) {
+	var conn entity.SAMLConnection
+	err := row.Scan(
+		&conn.ID,
+		&conn.BusinessID,
+		&conn.IdPEntityID,
+		&conn.IdPSSOURL,
+		&conn.IdPSLOURL,
+		&conn.IdPCertificate,
+		&conn.EmailAttribute,
+		&conn.UsernameAttribute,
+		&conn.DefaultRole,
+		&conn.Enabled,
+		&conn.CreatedAt,
+		&conn.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &conn, nil
+}
@@ -0,0 +1,332 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/Prashant2307200/auth-service/internal/entity"
+	"github.com/lib/pq"
+)
+
+// SCIMRepository stores SCIM provisioning tokens and the users and groups
+// provisioned through them. Lookups of missing rows return sql.ErrNoRows,
+// as do updates whose expected version is no longer current.
+type SCIMRepository interface {
+	// SaveToken creates or replaces the business's token and fills in its ID
+	// and creation time.
+	SaveToken(ctx context.Context, token *entity.SCIMToken) error
+	GetTokenByBusiness(ctx context.Context, businessID int64) (*entity.SCIMToken, error)
+	GetTokenByHash(ctx context.Context, tokenHash string) (*entity.SCIMToken, error)
+	TouchToken(ctx context.Context, id int64) error
+	DeleteToken(ctx context.Context, businessID int64) error
+
+	// CreateUser stores user and fills in its version and timestamps.
+	CreateUser(ctx context.Context, user *entity.SCIMUser) error
+	GetUser(ctx context.Context, businessID, userID int64) (*entity.SCIMUser, error)
+	ListUsers(ctx context.Context, businessID int64) ([]*entity.SCIMUser, error)
+	// UpdateUser saves user if its stored version is still version, and
+	// fills in the new version.
+	UpdateUser(ctx context.Context, user *entity.SCIMUser, version int) error
+	// DeleteUser deletes the user and takes them out of their groups.
+	DeleteUser(ctx context.Context, businessID, userID int64) error
+
+	// CreateGroup stores group with its members and fills in its ID, version
+	// and timestamps.
+	CreateGroup(ctx context.Context, group *entity.SCIMGroup) error
+	GetGroup(ctx context.Context, businessID, id int64) (*entity.SCIMGroup, error)
+	ListGroups(ctx context.Context, businessID int64) ([]*entity.SCIMGroup, error)
+	// UpdateGroup saves group and its members if its stored version is still
+	// version, and fills in the new version.
+	UpdateGroup(ctx context.Context, group *entity.SCIMGroup, version int) error
+	DeleteGroup(ctx context.Context, businessID, id int64) error
+}
+
+type scimRepo struct {
+	db *sql.DB
+}
+
+func NewSCIMRepo(db *sql.DB) SCIMRepository {
+	return &scimRepo{db: db}
+}
+
+const scimTokenColumns = `id, business_id, token_hash, created_by, last_used_at, created_at`
+
+func (r *scimRepo) SaveToken(ctx context.Context, token *entity.SCIMToken) error {
+	query := `
+		INSERT INTO scim_tokens (business_id, token_hash, created_by)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (business_id) DO UPDATE SET
+			token_hash = EXCLUDED.token_hash,
+			created_by = EXCLUDED.created_by,
+			last_used_at = NULL,
+			created_at = NOW()
+		RETURNING id, created_at
+	`
+	return r.db.QueryRowContext(ctx, query, token.BusinessID, token.TokenHash, token.CreatedBy).Scan(&token.ID, &token.CreatedAt)
+}
+
+func (r *scimRepo) GetTokenByBusiness(ctx context.Context, businessID int64) (*entity.SCIMToken, error) {
+	query := `SELECT ` + scimTokenColumns + ` FROM scim_tokens WHERE business_id = $1`
+	return scanSCIMToken(r.db.QueryRowContext(ctx, query, businessID))
+}
+
+func (r *scimRepo) GetTokenByHash(ctx context.Context, tokenHash string) (*entity.SCIMToken, error) {
+	query := `SELECT ` + scimTokenColumns + ` FROM scim_tokens WHERE token_hash = $1`
+	return scanSCIMToken(r.db.QueryRowContext(ctx, query, tokenHash))
+}
+
+func (r *scimRepo) TouchToken(ctx context.Context, id int64) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE scim_tokens SET last_used_at = NOW() WHERE id = $1`, id)
+	return err
+}
+
+func (r *scimRepo) DeleteToken(ctx context.Context, businessID int64) error {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM scim_tokens WHERE business_id = $1`, businessID)
+	if err != nil {
+		return err
+	}
+	return requireRowAffected(res)
+}
+
+func scanSCIMToken(row rowScanner) (*entity.SCIMToken, error) {
+	var token entity.SCIMToken
+	var createdBy sql.NullInt64
+	var lastUsedAt sql.NullTime
+	if err := row.Scan(&token.ID, &token.BusinessID, &token.TokenHash, &createdBy, &lastUsedAt, &token.CreatedAt); err != nil {
+		return nil, err
+	}
+	if createdBy.Valid {
+		token.CreatedBy = &createdBy.Int64
+	}
+	if lastUsedAt.Valid {
+		token.LastUsedAt = &lastUsedAt.Time
+	}
+	return &token, nil
+}
+
+const scimUserSelect = `
+	SELECT su.business_id, su.user_id, su.user_name, su.external_id, su.given_name, su.family_name,
+		su.display_name, su.active, u.email, su.version, su.created_at, su.updated_at
+	FROM scim_users su
+	INNER JOIN users u ON u.id = su.user_id
+`
+
+func (r *scimRepo) CreateUser(ctx context.Context, user *entity.SCIMUser) error {
+	query := `
+		INSERT INTO scim_users (business_id, user_id, user_name, external_id, given_name, family_name, display_name, active)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING version, created_at, updated_at
+	`
+	return r.db.QueryRowContext(ctx, query,
+		user.BusinessID, user.UserID, user.UserName, user.ExternalID, user.GivenName, user.FamilyName, user.DisplayName, user.Active,
+	).Scan(&user.Version, &user.CreatedAt, &user.UpdatedAt)
+}
+
+func (r *scimRepo) GetUser(ctx context.Context, businessID, userID int64) (*entity.SCIMUser, error) {
+	query := scimUserSelect + ` WHERE su.business_id = $1 AND su.user_id = $2`
+	return scanSCIMUser(r.db.QueryRowContext(ctx, query, businessID, userID))
+}
+
+func (r *scimRepo) ListUsers(ctx context.Context, businessID int64) ([]*entity.SCIMUser, error) {
+	query := scimUserSelect + ` WHERE su.business_id = $1 ORDER BY su.user_id`
+	rows, err := r.db.QueryContext(ctx, query, businessID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []*entity.SCIMUser
+	for rows.Next() {
+		user, err := scanSCIMUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+func (r *scimRepo) UpdateUser(ctx context.Context, user *entity.SCIMUser, version int) error {
+	query := `
+		UPDATE scim_users SET user_name = $4, external_id = $5, given_name = $6, family_name = $7,
+			display_name = $8, active = $9, version = version + 1, updated_at = NOW()
+		WHERE business_id = $1 AND user_id = $2 AND version = $3
+		RETURNING version, updated_at
+	`
+	return r.db.QueryRowContext(ctx, query,
+		user.BusinessID, user.UserID, version,
+		user.UserName, user.ExternalID, user.GivenName, user.FamilyName, user.DisplayName, user.Active,
+	).Scan(&user.Version, &user.UpdatedAt)
+}
+
+func (r *scimRepo) DeleteUser(ctx context.Context, businessID, userID int64) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	// The user's groups change too, so their ETags must.
+	queries := []string{`
+		UPDATE scim_groups SET version = version + 1, updated_at = NOW()
+		WHERE business_id = $1 AND id IN (SELECT group_id FROM scim_group_members WHERE user_id = $2)
+	`, `
+		DELETE FROM scim_group_members
+		WHERE user_id = $2 AND group_id IN (SELECT id FROM scim_groups WHERE business_id = $1)
+	`}
+	for _, q := range queries {
+		if _, err := tx.ExecContext(ctx, q, businessID, userID); err != nil {
+			return err
+		}
+	}
+	res, err := tx.ExecContext(ctx, `DELETE FROM scim_users WHERE business_id = $1 AND user_id = $2`, businessID, userID)
+	if err != nil {
+		return err
+	}
+	if err := requireRowAffected(res); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func scanSCIMUser(row rowScanner) (*entity.SCIMUser, error) {
+	var user entity.SCIMUser
+	err := row.Scan(
+		&user.BusinessID,
+		&user.UserID,
+		&user.UserName,
+		&user.ExternalID,
+		&user.GivenName,
+		&user.FamilyName,
+		&user.DisplayName,
+		&user.Active,
+		&user.Email,
+		&user.Version,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+const scimGroupSelect = `
+	SELECT g.id, g.business_id, g.display_name, g.external_id, g.version, g.created_at, g.updated_at,
+		COALESCE(ARRAY(SELECT m.user_id FROM scim_group_members m WHERE m.group_id = g.id ORDER BY m.user_id), '{}')
+	FROM scim_groups g
+`
+
+func (r *scimRepo) CreateGroup(ctx context.Context, group *entity.SCIMGroup) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	query := `
+		INSERT INTO scim_groups (business_id, display_name, external_id)
+		VALUES ($1, $2, $3)
+		RETURNING id, version, created_at, updated_at
+	`
+	err = tx.QueryRowContext(ctx, query, group.BusinessID, group.DisplayName, group.ExternalID).
+		Scan(&group.ID, &group.Version, &group.CreatedAt, &group.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	if err := insertSCIMGroupMembers(ctx, tx, group); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *scimRepo) GetGroup(ctx context.Context, businessID, id int64) (*entity.SCIMGroup, error) {
+	query := scimGroupSelect + ` WHERE g.business_id = $1 AND g.id = $2`
+	return scanSCIMGroup(r.db.QueryRowContext(ctx, query, businessID, id))
+}
+
+func (r *scimRepo) ListGroups(ctx context.Context, businessID int64) ([]*entity.SCIMGroup, error) {
+	query := scimGroupSelect + ` WHERE g.business_id = $1 ORDER BY g.id`
+	rows, err := r.db.QueryContext(ctx, query, businessID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var groups []*entity.SCIMGroup
+	for rows.Next() {
+		group, err := scanSCIMGroup(rows)
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, group)
+	}
+	return groups, rows.Err()
+}
+
+func (r *scimRepo) UpdateGroup(ctx context.Context, group *entity.SCIMGroup, version int) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	query := `
+		UPDATE scim_groups SET display_name = $4, external_id = $5, version = version + 1, updated_at = NOW()
+		WHERE business_id = $1 AND id = $2 AND version = $3
+		RETURNING version, updated_at
+	`
+	err = tx.QueryRowContext(ctx, query, group.BusinessID, group.ID, version, group.DisplayName, group.ExternalID).
+		Scan(&group.Version, &group.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM scim_group_members WHERE group_id = $1`, group.ID); err != nil {
+		return err
+	}
+	if err := insertSCIMGroupMembers(ctx, tx, group); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func insertSCIMGroupMembers(ctx context.Context, tx *sql.Tx, group *entity.SCIMGroup) error {
+	if len(group.MemberIDs) == 0 {
+		return nil
+	}
+	query := `
+		INSERT INTO scim_group_members (group_id, user_id)
+		SELECT $1, UNNEST($2::BIGINT[])
+		ON CONFLICT DO NOTHING
+	`
+	_, err := tx.ExecContext(ctx, query, group.ID, pq.Array(group.MemberIDs))
+	return err
+}
+
+func (r *scimRepo) DeleteGroup(ctx context.Context, businessID, id int64) error {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM scim_groups WHERE business_id = $1 AND id = $2`, businessID, id)
+	if err != nil {
+		return err
+	}
+	return requireRowAffected(res)
+}
+
+func scanSCIMGroup(row rowScanner) (*entity.SCIMGroup, error) {
+	var group entity.SCIMGroup
+	var memberIDs pq.Int64Array
+	err := row.Scan(
+		&group.ID,
+		&group.BusinessID,
+		&group.DisplayName,
+		&group.ExternalID,
+		&group.Version,
+		&group.CreatedAt,
+		&group.UpdatedAt,
+		&memberIDs,
+	)
+	if err != nil {
+		return nil, err
+	}
+	group.MemberIDs = memberIDs
+	return &group, nil
+}
@@ -134,7 +134,7 @@ func (r *UserRepo) GetByEmail(ctx context.Context, email string) (*entity.User,
 	}
 
 	query := `
-		SELECT id, username, email, password, profile_pic, role, created_at, updated_at 
+		SELECT id, username, email, password, profile_pic, role, created_at, updated_at, COALESCE(email_verified, FALSE)
 		FROM users 
 		WHERE email = $1
 	`
@@ -153,6 +153,7 @@ func (r *UserRepo) GetByEmail(ctx context.Context, email string) (*entity.User,
 		&user.Role,
 		&user.CreatedAt,
 		&user.UpdatedAt,
+		&user.EmailVerified,
 	)
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -253,41 +254,6 @@ func (r *UserRepo) Create(ctx context.Context, user *entity.User) (int64, error)
 	return id, nil
 }
 
-func (r *UserRepo) GetByGoogleID(ctx context.Context, googleID string) (*entity.User, error) {
-	if googleID == "" {
-		return nil, fmt.Errorf("google_id cannot be empty")
-	}
-
-	query := `
-		SELECT id, username, email, password, profile_pic, role, created_at, updated_at 
-		FROM users 
-		WHERE google_id = $1
-	`
-	var user entity.User
-	row, err := db.QueryRow(ctx, r.Db, query, googleID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to query user: %w", err)
-	}
-
-	err = row.Scan(
-		&user.ID,
-		&user.Username,
-		&user.Email,
-		&user.Password,
-		&user.ProfilePic,
-		&user.Role,
-		&user.CreatedAt,
-		&user.UpdatedAt,
-	)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, err
-		}
-		return nil, fmt.Errorf("failed to scan user: %w", err)
-	}
-	return &user, nil
-}
-
 func (r *UserRepo) MarkEmailVerified(ctx context.Context, id int64) error {
 	query := `UPDATE users SET email_verified = TRUE, email_verified_at = NOW(), updated_at = CURRENT_TIMESTAMP WHERE id = $1`
 	res, err := db.Exec(ctx, r.Db, query, id)
@@ -303,22 +269,3 @@ func (r *UserRepo) MarkEmailVerified(ctx context.Context, id int64) error {
 	}
 	return nil
 }
-
-func (r *UserRepo) LinkGoogleID(ctx context.Context, id int64, googleID string) error {
-	if googleID == "" {
-		return fmt.Errorf("google_id cannot be empty")
-	}
-	query := `UPDATE users SET google_id = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2`
-	res, err := db.Exec(ctx, r.Db, query, googleID, id)
-	if err != nil {
-		return fmt.Errorf("failed to link google id: %w", err)
-	}
-	rowsAffected, err := res.RowsAffected()
-	if err != nil {
-		return fmt.Errorf("failed to get rows affected: %w", err)
-	}
-	if rowsAffected == 0 {
-		return db.HandleNotFoundError(sql.ErrNoRows, "user", id)
-	}
-	return nil
-}
@@ -0,0 +1,100 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/Prashant2307200/auth-service/internal/entity"
+)
+
+type UserIdentityRepository interface {
+	// Create stores identity and fills in its ID and creation time.
+	Create(ctx context.Context, identity *entity.UserIdentity) error
+	GetByProviderSubject(ctx context.Context, provider, subject string) (*entity.UserIdentity, error)
+	ListByUser(ctx context.Context, userID int64) ([]*entity.UserIdentity, error)
+	CountByUser(ctx context.Context, userID int64) (int, error)
+	TouchLastUsed(ctx context.Context, id int64) error
+	Delete(ctx context.Context, userID, id int64) error
+}
+
+type userIdentityRepo struct {
+	db *sql.DB
+}
+
+func NewUserIdentityRepo(db *sql.DB) UserIdentityRepository {
+	return &userIdentityRepo{db: db}
+}
+
+const userIdentityColumns = `id, user_id, provider, subject, email, created_at, last_used_at`
+
+func (r *userIdentityRepo) Create(ctx context.Context, identity *entity.UserIdentity) error {
+	query := `
+		INSERT INTO user_identities (user_id, provider, subject, email)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at
+	`
+	return r.db.QueryRowContext(ctx, query,
+		identity.UserID, identity.Provider, identity.Subject, identity.Email,
+	).Scan(&identity.ID, &identity.CreatedAt)
+}
+
+func (r *userIdentityRepo) GetByProviderSubject(ctx context.Context, provider, subject string) (*entity.UserIdentity, error) {
+	query := `SELECT ` + userIdentityColumns + ` FROM user_identities WHERE provider = $1 AND subject = $2`
+	return scanUserIdentity(r.db.QueryRowContext(ctx, query, provider, subject))
+}
+
+func (r *userIdentityRepo) ListByUser(ctx context.Context, userID int64) ([]*entity.UserIdentity, error) {
+	query := `SELECT ` + userIdentityColumns + ` FROM user_identities WHERE user_id = $1 ORDER BY created_at`
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var identities []*entity.UserIdentity
+	for rows.Next() {
+		identity, err := scanUserIdentity(rows)
+		if err != nil {
+			return nil, err
+		}
+		identities = append(identities, identity)
+	}
+	return identities, rows.Err()
+}
+
+func (r *userIdentityRepo) CountByUser(ctx context.Context, userID int64) (int, error) {
+	var n int
+	err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM user_identities WHERE user_id = $1`, userID).Scan(&n)
+	return n, err
+}
+
+func (r *userIdentityRepo) TouchLastUsed(ctx context.Context, id int64) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE user_identities SET last_used_at = NOW() WHERE id = $1`, id)
+	return err
+}
+
+func (r *userIdentityRepo) Delete(ctx context.Context, userID, id int64) error {
+	query := `DELETE FROM user_identities WHERE id = $1 AND user_id = $2`
+	res, err := r.db.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+	return requireRowAffected(res)
+}
+
+func scanUserIdentity(row rowScanner) (*entity.UserIdentity, error) {
+	var identity entity.UserIdentity
+	err := row.Scan(
+		&identity.ID,
+		&identity.UserID,
+		&identity.Provider,
+		&identity.Subject,
+		&identity.Email,
+		&identity.CreatedAt,
+		&identity.LastUsedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &identity, nil
+}
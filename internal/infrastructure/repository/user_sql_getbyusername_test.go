@@ -15,8 +15,8 @@ func TestUserRepo_GetByEmail_Success(t *testing.T) {
 	require.NoError(t, err)
 	defer db.Close()
 
-	rows := sqlmock.NewRows([]string{"id", "username", "email", "password", "profile_pic", "role", "created_at", "updated_at"}).AddRow(2, "bob", "b@b.com", "h", "pic", 0, time.Now(), time.Now())
-	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, email, password, profile_pic, role, created_at, updated_at ")).WithArgs("b@b.com").WillReturnRows(rows)
+	rows := sqlmock.NewRows([]string{"id", "username", "email", "password", "profile_pic", "role", "created_at", "updated_at", "email_verified"}).AddRow(2, "bob", "b@b.com", "h", "pic", 0, time.Now(), time.Now(), true)
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, email, password, profile_pic, role, created_at, updated_at, COALESCE(email_verified, FALSE)")).WithArgs("b@b.com").WillReturnRows(rows)
 
 	r, err := NewUserRepo(db)
 	require.NoError(t, err)
@@ -25,6 +25,7 @@ func TestUserRepo_GetByEmail_Success(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, int64(2), u.ID)
 	require.Equal(t, "b@b.com", u.Email)
+	require.True(t, u.EmailVerified)
 	require.NoError(t, mock.ExpectationsWereMet())
 }
 
@@ -33,7 +34,7 @@ func TestUserRepo_GetByEmail_DBError(t *testing.T) {
 	require.NoError(t, err)
 	defer db.Close()
 
-	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, email, password, profile_pic, role, created_at, updated_at ")).WithArgs("nope").WillReturnError(sqlmock.ErrCancelled)
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, email, password, profile_pic, role, created_at, updated_at, COALESCE(email_verified, FALSE)")).WithArgs("nope").WillReturnError(sqlmock.ErrCancelled)
 
 	r, err := NewUserRepo(db)
 	require.NoError(t, err)
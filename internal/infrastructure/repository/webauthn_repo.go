@@ -0,0 +1,140 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/Prashant2307200/auth-service/internal/entity"
+	"github.com/lib/pq"
+)
+
+type WebAuthnRepository interface {
+	Create(ctx context.Context, cred *entity.WebAuthnCredential) (int64, error)
+	GetByCredentialID(ctx context.Context, credentialID []byte) (*entity.WebAuthnCredential, error)
+	ListByUser(ctx context.Context, userID int64) ([]*entity.WebAuthnCredential, error)
+	CountByUser(ctx context.Context, userID int64) (int, error)
+	// UpdateAfterAssertion records the new signature counter and backup state.
+	UpdateAfterAssertion(ctx context.Context, id int64, signCount uint32, backedUp bool) error
+	Rename(ctx context.Context, userID, id int64, name string) error
+	Delete(ctx context.Context, userID, id int64) error
+}
+
+type webAuthnRepo struct {
+	db *sql.DB
+}
+
+func NewWebAuthnRepo(db *sql.DB) WebAuthnRepository {
+	return &webAuthnRepo{db: db}
+}
+
+const webAuthnColumns = `id, user_id, credential_id, public_key, sign_count, aaguid, transports, name, backup_eligible, backed_up, created_at, last_used_at`
+
+func (r *webAuthnRepo) Create(ctx context.Context, cred *entity.WebAuthnCredential) (int64, error) {
+	query := `
+		INSERT INTO webauthn_credentials (user_id, credential_id, public_key, sign_count, aaguid, transports, name, backup_eligible, backed_up)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING id
+	`
+	var id int64
+	err := r.db.QueryRowContext(ctx, query,
+		cred.UserID, cred.CredentialID, cred.PublicKey, int64(cred.SignCount), cred.AAGUID,
+		pq.Array(cred.Transports), cred.Name, cred.BackupEligible, cred.BackedUp,
+	).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+func (r *webAuthnRepo) GetByCredentialID(ctx context.Context, credentialID []byte) (*entity.WebAuthnCredential, error) {
+	query := `SELECT ` + webAuthnColumns + ` FROM webauthn_credentials WHERE credential_id = $1`
+	return scanWebAuthnCredential(r.db.QueryRowContext(ctx, query, credentialID))
+}
+
+func (r *webAuthnRepo) ListByUser(ctx context.Context, userID int64) ([]*entity.WebAuthnCredential, error) {
+	query := `SELECT ` + webAuthnColumns + ` FROM webauthn_credentials WHERE user_id = $1 ORDER BY created_at`
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var creds []*entity.WebAuthnCredential
+	for rows.Next() {
+		cred, err := scanWebAuthnCredential(rows)
+		if err != nil {
+			return nil, err
+		}
+		creds = append(creds, cred)
+	}
+	return creds, rows.Err()
+}
+
+func (r *webAuthnRepo) CountByUser(ctx context.Context, userID int64) (int, error) {
+	var n int
+	err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM webauthn_credentials WHERE user_id = $1`, userID).Scan(&n)
+	return n, err
+}
+
+func (r *webAuthnRepo) UpdateAfterAssertion(ctx context.Context, id int64, signCount uint32, backedUp bool) error {
+	query := `UPDATE webauthn_credentials SET sign_count = $2, backed_up = $3, last_used_at = NOW() WHERE id = $1`
+	_, err := r.db.ExecContext(ctx, query, id, int64(signCount), backedUp)
+	return err
+}
+
+func (r *webAuthnRepo) Rename(ctx context.Context, userID, id int64, name string) error {
+	query := `UPDATE webauthn_credentials SET name = $3 WHERE id = $1 AND user_id = $2`
+	res, err := r.db.ExecContext(ctx, query, id, userID, name)
+	if err != nil {
+		return err
+	}
+	return requireRowAffected(res)
+}
+
+func (r *webAuthnRepo) Delete(ctx context.Context, userID, id int64) error {
+	query := `DELETE FROM webauthn_credentials WHERE id = $1 AND user_id = $2`
+	res, err := r.db.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+	return requireRowAffected(res)
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanWebAuthnCredential(row rowScanner) (*entity.WebAuthnCredential, error) {
+	var cred entity.WebAuthnCredential
+	var signCount int64
+	err := row.Scan(
+		&cred.ID,
+		&cred.UserID,
+		&cred.CredentialID,
+		&cred.PublicKey,
+		&signCount,
+		&cred.AAGUID,
+		pq.Array(&cred.Transports),
+		&cred.Name,
+		&cred.BackupEligible,
+		&cred.BackedUp,
+		&cred.CreatedAt,
+		&cred.LastUsedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	cred.SignCount = uint32(signCount)
+	return &cred, nil
+}
+
+func requireRowAffected(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
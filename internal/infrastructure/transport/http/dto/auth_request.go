@@ -47,7 +47,63 @@ type MFAVerifyRequest struct {
 	Code string `json:"code" validate:"required,len=6"`
 }
 
+// MFAChallengeRequest completes a login challenge. MFAToken may be omitted
+// when it is sent as the mfa_token cookie (SSO logins).
+type MFAChallengeRequest struct {
+	MFAToken string `json:"mfa_token"`
+	Code     string `json:"code" validate:"required"`
+}
+
 type MFALoginRequest struct {
 	MFAToken string `json:"mfa_token" validate:"required"`
 	Code     string `json:"code" validate:"required"`
 }
+
+// CSRFTokenResponse carries the token to send in X-CSRF-Token.
+type CSRFTokenResponse struct {
+	CSRFToken string `json:"csrf_token"`
+}
+
+// SSOProvidersResponse lists the identity providers users can sign in with.
+type SSOProvidersResponse struct {
+	Providers []string `json:"providers"`
+}
+
+// LinkIdentityRequest confirms the user is present before linking an
+// identity. Either field will do; neither is needed within 10 minutes of
+// signing in.
+type LinkIdentityRequest struct {
+	Password string `json:"password,omitempty"`
+	Code     string `json:"code,omitempty"`
+}
+
+// LinkIdentityResponse is where to send the user to sign in at the provider.
+type LinkIdentityResponse struct {
+	AuthorizationURL string `json:"authorization_url"`
+}
+
+// SAMLLogoutResponse is where to send the user to sign out at the identity
+// provider as well; it is empty when there is nowhere to.
+type SAMLLogoutResponse struct {
+	LogoutURL string `json:"logout_url,omitempty"`
+}
+
+type DiscoverRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+// DiscoverResponse lists the sign-in methods open to an email, the
+// business's identity provider first.
+type DiscoverResponse struct {
+	Domain  string        `json:"domain"`
+	Methods []LoginMethod `json:"methods"`
+}
+
+// LoginMethod is "password", "sso" with the provider to start at URL, or
+// "saml" with the business whose identity provider URL starts at.
+type LoginMethod struct {
+	Type       string `json:"type"`
+	Provider   string `json:"provider,omitempty"`
+	BusinessID int64  `json:"business_id,omitempty"`
+	URL        string `json:"url,omitempty"`
+}
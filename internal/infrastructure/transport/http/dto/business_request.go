@@ -1,5 +1,11 @@
 package dto
 
+import (
+	"time"
+
+	"github.com/Prashant2307200/auth-service/internal/entity"
+)
+
 type BusinessCreateRequest struct {
 	Name  string `json:"name" validate:"required,min=2,max=100"`
 	Slug  string `json:"slug" validate:"required,min=2,max=50"`
@@ -11,3 +17,55 @@ type BusinessUpdateRequest struct {
 	Slug  string `json:"slug,omitempty" validate:"omitempty,min=2,max=50"`
 	Email string `json:"email,omitempty" validate:"omitempty,email"`
 }
+
+// SAMLConnectionRequest configures a business's SAML identity provider,
+// either from its metadata XML or field by field.
+type SAMLConnectionRequest struct {
+	MetadataXML       string `json:"metadata_xml,omitempty"`
+	IdPEntityID       string `json:"idp_entity_id,omitempty"`
+	IdPSSOURL         string `json:"idp_sso_url,omitempty"`
+	IdPSLOURL         string `json:"idp_slo_url,omitempty"`
+	IdPCertificate    string `json:"idp_certificate,omitempty"`
+	EmailAttribute    string `json:"email_attribute,omitempty"`
+	UsernameAttribute string `json:"username_attribute,omitempty"`
+	DefaultRole       int    `json:"default_role"`
+	Enabled           bool   `json:"enabled"`
+}
+
+// SAMLConnectionResponse is a business's connection along with the service
+// provider URLs to register with the identity provider.
+type SAMLConnectionResponse struct {
+	Connection      *entity.SAMLConnection `json:"connection"`
+	ServiceProvider SAMLServiceProvider    `json:"service_provider"`
+}
+
+type SAMLServiceProvider struct {
+	EntityID    string `json:"entity_id"`
+	MetadataURL string `json:"metadata_url"`
+	ACSURL      string `json:"acs_url"`
+	SLOURL      string `json:"slo_url"`
+}
+
+// SCIMTokenResponse describes a business's SCIM token. Token is only set
+// when it was just created.
+type SCIMTokenResponse struct {
+	Token      string     `json:"token,omitempty"`
+	BaseURL    string     `json:"base_url"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+// BusinessDomainResponse is a business domain along with where to publish
+// its verification token.
+type BusinessDomainResponse struct {
+	*entity.BusinessDomain
+	Verification DomainVerificationInstructions `json:"verification"`
+}
+
+// DomainVerificationInstructions offers two ways to publish the token:
+// a TXT record, or a file served over HTTPS holding it on a line of its own.
+type DomainVerificationInstructions struct {
+	TXTRecordName  string `json:"txt_record_name"`
+	TXTRecordValue string `json:"txt_record_value"`
+	WellKnownURL   string `json:"well_known_url"`
+}
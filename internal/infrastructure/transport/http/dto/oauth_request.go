@@ -0,0 +1,100 @@
+package dto
+
+import "github.com/Prashant2307200/auth-service/internal/entity"
+
+type OAuthClientCreateRequest struct {
+	Name         string   `json:"name"`
+	RedirectURIs []string `json:"redirect_uris"`
+	Scopes       []string `json:"scopes"`
+	Public       bool     `json:"public"`
+	// BusinessID registers a service client for the business.
+	BusinessID *int64 `json:"business_id,omitempty"`
+	// FirstParty lets the client revoke the tokens of the first-party
+	// sign-in flow.
+	FirstParty bool `json:"first_party"`
+}
+
+// OAuthClientCreatedResponse is the only response that carries the client
+// secret. Public clients have none.
+type OAuthClientCreatedResponse struct {
+	*entity.OAuthClient
+	ClientSecret string `json:"client_secret,omitempty"`
+}
+
+// OAuthErrorResponse is the error body defined by RFC 6749 §5.2.
+type OAuthErrorResponse struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
+// OAuthTokenResponse is the RFC 6749 §5.1 access token response.
+type OAuthTokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+	Scope       string `json:"scope,omitempty"`
+	IDToken     string `json:"id_token,omitempty"`
+}
+
+// DeviceAuthorizationResponse is the RFC 8628 §3.2 device authorization
+// response.
+type DeviceAuthorizationResponse struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int64  `json:"expires_in"`
+	Interval                int64  `json:"interval"`
+}
+
+// IntrospectionResponse is the RFC 7662 §2.2 response. Inactive tokens carry
+// only active=false.
+type IntrospectionResponse struct {
+	Active   bool   `json:"active"`
+	Sub      string `json:"sub,omitempty"`
+	Tenant   int64  `json:"tenant,omitempty"`
+	ClientID string `json:"client_id,omitempty"`
+	Scope    string `json:"scope,omitempty"`
+	Exp      int64  `json:"exp,omitempty"`
+	Sid      string `json:"sid,omitempty"`
+}
+
+// OAuthConsentRequestResponse is what the consent screen shows the user.
+// Device authorizations have no redirect URI.
+type OAuthConsentRequestResponse struct {
+	ClientID    string   `json:"client_id"`
+	ClientName  string   `json:"client_name"`
+	RedirectURI string   `json:"redirect_uri,omitempty"`
+	Scopes      []string `json:"scopes"`
+}
+
+type OAuthConsentDecisionRequest struct {
+	Approve bool `json:"approve"`
+}
+
+// OAuthConsentDecisionResponse tells the consent screen where to send the
+// user next: back to the client, with a code or an access_denied error.
+type OAuthConsentDecisionResponse struct {
+	RedirectURL string `json:"redirect_url"`
+}
+
+// OpenIDConfiguration is the OpenID Connect discovery document
+// (OIDC Discovery §3).
+type OpenIDConfiguration struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserinfoEndpoint                  string   `json:"userinfo_endpoint"`
+	JwksURI                           string   `json:"jwks_uri"`
+	RevocationEndpoint                string   `json:"revocation_endpoint"`
+	IntrospectionEndpoint             string   `json:"introspection_endpoint"`
+	DeviceAuthorizationEndpoint       string   `json:"device_authorization_endpoint"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+	ClaimsSupported                   []string `json:"claims_supported"`
+}
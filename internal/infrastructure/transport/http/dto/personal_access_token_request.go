@@ -0,0 +1,21 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/Prashant2307200/auth-service/internal/entity"
+)
+
+type PersonalAccessTokenCreateRequest struct {
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	BusinessID *int64     `json:"business_id,omitempty"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+}
+
+// PersonalAccessTokenCreatedResponse is the only response that carries the
+// token itself.
+type PersonalAccessTokenCreatedResponse struct {
+	*entity.PersonalAccessToken
+	Token string `json:"token"`
+}
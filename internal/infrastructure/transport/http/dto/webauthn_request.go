@@ -0,0 +1,39 @@
+package dto
+
+import "github.com/Prashant2307200/auth-service/pkg/webauthn"
+
+// WebAuthnOptionsResponse wraps ceremony options the way navigator.credentials
+// expects them: pass the body straight to create() or get().
+type WebAuthnOptionsResponse struct {
+	PublicKey any `json:"publicKey"`
+}
+
+type WebAuthnRegisterRequest struct {
+	Name       string                       `json:"name"`
+	Credential webauthn.AttestationResponse `json:"credential"`
+}
+
+// WebAuthnLoginBeginRequest optionally narrows a passwordless login to one
+// account; without an email any discoverable passkey may answer.
+type WebAuthnLoginBeginRequest struct {
+	Email string `json:"email"`
+}
+
+type WebAuthnLoginRequest struct {
+	Credential webauthn.AssertionResponse `json:"credential"`
+}
+
+// WebAuthnMFABeginRequest and WebAuthnMFARequest accept the challenge token
+// in the body or, after Google sign-in, in the mfa_token cookie.
+type WebAuthnMFABeginRequest struct {
+	MFAToken string `json:"mfa_token"`
+}
+
+type WebAuthnMFARequest struct {
+	MFAToken   string                     `json:"mfa_token"`
+	Credential webauthn.AssertionResponse `json:"credential"`
+}
+
+type WebAuthnRenameRequest struct {
+	Name string `json:"name"`
+}
@@ -14,6 +14,9 @@ import (
 
 type AuditHandler struct {
 	AuditRepo repository.AuditRepository
+	// Authz checks that the caller may read the tenant's audit log; without
+	// it the route is refused.
+	Authz middleware.PermissionAuthorizer
 }
 
 func NewAuditHandler(auditRepo repository.AuditRepository) *AuditHandler {
@@ -21,7 +24,7 @@ func NewAuditHandler(auditRepo repository.AuditRepository) *AuditHandler {
 }
 
 func (h *AuditHandler) RegisterRoutes(mux *http.ServeMux) {
-	mux.HandleFunc("GET /audit-logs", h.listAuditLogs)
+	mux.Handle("GET /audit-logs", middleware.TenantFromHeader(middleware.RequirePermission(h.Authz, entity.PermissionAuditRead)(http.HandlerFunc(h.listAuditLogs))))
 }
 
 func (h *AuditHandler) listAuditLogs(w http.ResponseWriter, r *http.Request) {
@@ -4,6 +4,8 @@ import (
 	"errors"
 	"log/slog"
 	"net/http"
+	"net/url"
+	"strconv"
 
 	"github.com/Prashant2307200/auth-service/internal/entity"
 	"github.com/Prashant2307200/auth-service/internal/infrastructure/transport/http/dto"
@@ -15,24 +17,33 @@ import (
 )
 
 type AuthHandler struct {
-	UC  *usecase.AuthUseCase
-	ENV string
+	UC      *usecase.AuthUseCase
+	ENV     string
+	Cookies *response.Cookies
 }
 
 func NewAuthHandler(uc *usecase.AuthUseCase, env string) *AuthHandler {
-	return &AuthHandler{UC: uc, ENV: env}
+	return &AuthHandler{UC: uc, ENV: env, Cookies: response.NewCookies(env, nil)}
 }
 
 func (h *AuthHandler) RegisterRoutes(mux *http.ServeMux) {
-	mux.HandleFunc("POST /register/", h.register)
-	mux.HandleFunc("POST /login/", h.login)
+	mux.Handle("POST /register/", middleware.Public(h.register))
+	mux.Handle("POST /login/", middleware.Public(h.login))
+	mux.Handle("POST /discover", middleware.Public(h.discover))
 	mux.HandleFunc("DELETE /logout/", h.logout)
 	mux.HandleFunc("GET /profile/", h.profile)
 	mux.HandleFunc("PUT /profile/", h.updateProfile)
 	mux.HandleFunc("DELETE /profile/", h.deleteProfile)
-	mux.HandleFunc("GET /refresh/", h.refresh)
-	mux.HandleFunc("GET /public-key", h.publicKey)
+	mux.Handle("GET /refresh/", middleware.Public(h.refresh))
+	mux.Handle("GET /public-key", middleware.Public(h.publicKey))
 	mux.HandleFunc("GET /upload-signature", h.uploadSignature)
+	mux.Handle("POST /mfa/challenge", middleware.Public(h.mfaChallenge))
+}
+
+// RegisterWellKnownRoutes registers discovery documents that live at the
+// server root rather than under /api/v1/auth.
+func (h *AuthHandler) RegisterWellKnownRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("GET /.well-known/jwks.json", h.jwks)
 }
 
 func (h *AuthHandler) register(w http.ResponseWriter, r *http.Request) {
@@ -63,13 +74,17 @@ func (h *AuthHandler) register(w http.ResponseWriter, r *http.Request) {
 			response.WriteJson(w, http.StatusBadRequest, map[string]interface{}{"errors": ves})
 			return
 		}
+		if errors.Is(err, usecase.ErrPasswordLoginDisabled) {
+			response.WriteError(w, http.StatusForbidden, err)
+			return
+		}
 		slog.Error("Error registering user", slog.Any("error", err))
 		status := response.ErrorToStatus(err)
 		response.WriteError(w, status, err)
 		return
 	}
 
-	response.SetTokenCookies(w, access_token, refresh_token, h.ENV)
+	h.Cookies.SetTokens(w, access_token, refresh_token)
 	response.WriteSuccess(w, http.StatusOK, "user registered successfully", nil)
 }
 
@@ -106,6 +121,11 @@ func (h *AuthHandler) login(w http.ResponseWriter, r *http.Request) {
 	}
 
 	access_token, refresh_token, err := h.UC.LoginUser(r.Context(), loginDto.Email, loginDto.Password)
+	var mfaErr *usecase.MFARequiredError
+	if errors.As(err, &mfaErr) {
+		response.WriteJson(w, http.StatusOK, usecase.MFALoginResult{MFARequired: true, MFAToken: mfaErr.Token, MFAMethods: mfaErr.Methods})
+		return
+	}
 	if err != nil {
 		// if validation errors, return 400 with structured errors
 		var ves responseErrors
@@ -113,6 +133,10 @@ func (h *AuthHandler) login(w http.ResponseWriter, r *http.Request) {
 			response.WriteJson(w, http.StatusBadRequest, map[string]interface{}{"errors": ves})
 			return
 		}
+		if errors.Is(err, usecase.ErrPasswordLoginDisabled) {
+			response.WriteError(w, http.StatusForbidden, err)
+			return
+		}
 		slog.Error("Error logging in user", slog.String("email", loginDto.Email), slog.Any("error", err))
 		// Don't expose whether user exists or password is wrong for security
 		response.WriteError(w, http.StatusUnauthorized, errors.New("invalid email or password"))
@@ -120,7 +144,73 @@ func (h *AuthHandler) login(w http.ResponseWriter, r *http.Request) {
 	}
 
 	slog.Info("User logged in")
-	response.SetTokenCookies(w, access_token, refresh_token, h.ENV)
+	h.Cookies.SetTokens(w, access_token, refresh_token)
+	response.WriteSuccess(w, http.StatusOK, "user logged in successfully", nil)
+}
+
+// discover answers a login page that asks for the email first with the
+// sign-in methods to offer. URLs are relative to this API's origin.
+func (h *AuthHandler) discover(w http.ResponseWriter, r *http.Request) {
+	req, err := request.ParseJSON[dto.DiscoverRequest](r)
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	discovery, err := h.UC.DiscoverLoginMethods(r.Context(), req.Email)
+	if err != nil {
+		var ves responseErrors
+		if unwrapValidationErrors(err, &ves) {
+			response.WriteJson(w, http.StatusBadRequest, map[string]interface{}{"errors": ves})
+			return
+		}
+		slog.Error("Failed to discover login methods", slog.Any("error", err))
+		response.WriteDomainError(w, err)
+		return
+	}
+
+	res := dto.DiscoverResponse{Domain: discovery.Domain, Methods: []dto.LoginMethod{}}
+	for _, m := range discovery.Methods {
+		method := dto.LoginMethod{Type: m.Type, Provider: m.Provider, BusinessID: m.BusinessID}
+		switch m.Type {
+		case usecase.LoginMethodSSO:
+			method.URL = "/api/v1/auth/sso/" + url.PathEscape(m.Provider)
+		case usecase.LoginMethodSAML:
+			method.URL = "/api/v1/auth/saml/" + strconv.FormatInt(m.BusinessID, 10) + "/login"
+		}
+		res.Methods = append(res.Methods, method)
+	}
+	response.WriteJson(w, http.StatusOK, res)
+}
+
+// mfaChallenge completes a login that was answered with mfa_required. The
+// challenge token comes from the login response body or, for SSO, from the
+// mfa_token cookie set by the callback.
+func (h *AuthHandler) mfaChallenge(w http.ResponseWriter, r *http.Request) {
+
+	req, err := request.ParseJSON[dto.MFAChallengeRequest](r)
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	access_token, refresh_token, err := h.UC.CompleteMFAChallenge(r.Context(), mfaTokenFrom(r, h.Cookies, req.MFAToken), req.Code)
+	if err != nil {
+		slog.Warn("MFA challenge failed", slog.Any("error", err))
+		switch {
+		case errors.Is(err, usecase.ErrMFAChallengeInvalid), errors.Is(err, usecase.ErrMFAChallengeExhausted):
+			h.Cookies.ClearMFAToken(w)
+			response.WriteError(w, http.StatusUnauthorized, err)
+		case errors.Is(err, usecase.ErrMFALocked):
+			writeMFALocked(w, err)
+		case errors.Is(err, usecase.ErrInvalidTOTPCode), errors.Is(err, usecase.ErrInvalidBackupCode):
+			response.WriteError(w, http.StatusUnauthorized, errors.New("invalid code"))
+		default:
+			response.WriteError(w, http.StatusInternalServerError, errors.New("failed to complete MFA challenge"))
+		}
+		return
+	}
+
+	h.Cookies.ClearMFAToken(w)
+	h.Cookies.SetTokens(w, access_token, refresh_token)
 	response.WriteSuccess(w, http.StatusOK, "user logged in successfully", nil)
 }
 
@@ -132,7 +222,9 @@ func (h *AuthHandler) logout(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = h.UC.LogoutUser(r.Context(), id)
+	refreshToken, _ := h.Cookies.Read(r, response.RefreshTokenCookie)
+
+	err = h.UC.LogoutUser(r.Context(), id, refreshToken)
 	if err != nil {
 		slog.Error("Failed to logout user", slog.Int64("user_id", id), slog.Any("error", err))
 		status := response.ErrorToStatus(err)
@@ -140,7 +232,7 @@ func (h *AuthHandler) logout(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	response.DeleteTokenCookies(w, h.ENV)
+	h.Cookies.DeleteTokens(w)
 	response.WriteSuccess(w, http.StatusOK, "user logged out successfully", nil)
 }
 
@@ -262,19 +354,22 @@ func (h *AuthHandler) deleteProfile(w http.ResponseWriter, r *http.Request) {
 
 func (h *AuthHandler) refresh(w http.ResponseWriter, r *http.Request) {
 
-	refreshCookie, err := r.Cookie("refresh_token")
-	if err != nil {
+	refreshToken, ok := h.Cookies.Read(r, response.RefreshTokenCookie)
+	if !ok {
 		response.WriteError(w, http.StatusUnauthorized, errors.New("refresh token not found"))
 		return
 	}
 
-	refresh, access, err := h.UC.RefreshSession(r.Context(), refreshCookie.Value)
+	refresh, access, err := h.UC.RefreshSession(r.Context(), refreshToken)
 	if err != nil {
+		if errors.Is(err, usecase.ErrRefreshTokenReused) {
+			h.Cookies.DeleteTokens(w)
+		}
 		response.WriteError(w, http.StatusUnauthorized, err)
 		return
 	}
 
-	response.SetTokenCookies(w, access, refresh, h.ENV)
+	h.Cookies.SetTokens(w, access, refresh)
 	response.WriteSuccess(w, http.StatusOK, "session refreshed successfully", nil)
 }
 
@@ -293,3 +388,20 @@ func (h *AuthHandler) publicKey(w http.ResponseWriter, r *http.Request) {
 		slog.Error("Failed to write public key response", slog.Any("error", err))
 	}
 }
+
+func (h *AuthHandler) jwks(w http.ResponseWriter, r *http.Request) {
+
+	set, err := h.UC.GetJWKS()
+	if err != nil {
+		slog.Error("Error getting JWKS", slog.Any("error", err))
+		response.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	// Keys change only on rotation; retired keys stay published for a full
+	// access-token TTL, so a short cache is safe for verifiers.
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	if err := response.WriteJson(w, http.StatusOK, set); err != nil {
+		slog.Error("Failed to write JWKS response", slog.Any("error", err))
+	}
+}
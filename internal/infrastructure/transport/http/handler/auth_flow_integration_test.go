@@ -66,10 +66,12 @@ func TestAuthFlow_Integration(t *testing.T) {
 	authHandler := NewAuthHandler(authUC, "dev")
 	authRouter := http.NewServeMux()
 	authHandler.RegisterRoutes(authRouter)
+	publicRoutes := middleware.NewPublicRoutes()
+	publicRoutes.Mount("/api/v1/auth", authRouter)
 
 	router := http.NewServeMux()
 	router.Handle("/auth/", http.StripPrefix("/auth", authRouter))
-	api := middleware.Authenticate(tokenService, "dev")(http.StripPrefix("/api/v1", router))
+	api := middleware.Authenticate(tokenService, nil, middleware.AuthConfig{Public: publicRoutes})(http.StripPrefix("/api/v1", router))
 
 	unique := strconv.FormatInt(time.Now().UnixNano(), 10)
 	registerBody := map[string]any{
@@ -147,10 +149,12 @@ func TestAuthFlow_Integration_RefreshInvalidToken(t *testing.T) {
 	authHandler := NewAuthHandler(authUC, "dev")
 	authRouter := http.NewServeMux()
 	authHandler.RegisterRoutes(authRouter)
+	publicRoutes := middleware.NewPublicRoutes()
+	publicRoutes.Mount("/api/v1/auth", authRouter)
 
 	router := http.NewServeMux()
 	router.Handle("/auth/", http.StripPrefix("/auth", authRouter))
-	api := middleware.Authenticate(tokenService, "dev")(http.StripPrefix("/api/v1", router))
+	api := middleware.Authenticate(tokenService, nil, middleware.AuthConfig{Public: publicRoutes})(http.StripPrefix("/api/v1", router))
 
 	refreshReq := httptest.NewRequest(http.MethodGet, "/api/v1/auth/refresh/", nil)
 	refreshReq.AddCookie(&http.Cookie{Name: "refresh_token", Value: "invalid-refresh-token"})
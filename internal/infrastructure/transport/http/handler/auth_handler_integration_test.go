@@ -13,6 +13,7 @@ import (
 	uutils "github.com/Prashant2307200/auth-service/internal/infrastructure/transport/http/utils"
 	"github.com/Prashant2307200/auth-service/internal/testutil"
 	"github.com/Prashant2307200/auth-service/internal/usecase"
+	"github.com/Prashant2307200/auth-service/internal/usecase/interfaces"
 	"github.com/Prashant2307200/auth-service/pkg/hash"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
@@ -28,9 +29,9 @@ func TestAuthHandler_Register_Success(t *testing.T) {
 	mockUser.On("Create", mock.Anything, mock.AnythingOfType("*entity.User")).Return(int64(1), nil)
 	mockBusiness.On("FindAutoJoinBusinessByEmailDomain", mock.Anything, "example.com").Return(nil, nil)
 	mockBusiness.On("CreateWithOwner", mock.Anything, mock.AnythingOfType("*entity.Business"), int64(1)).Return(int64(99), nil)
-	mockToken.On("GenerateRefreshToken", int64(1)).Return("refresh-token", nil)
-	mockToken.On("StoreRefreshToken", mock.Anything, int64(1), "refresh-token").Return(nil)
-	mockToken.On("GenerateAccessToken", int64(1), int64(99)).Return("access-token", nil)
+	mockToken.On("GenerateRefreshToken", int64(1), mock.AnythingOfType("string")).Return("refresh-token", nil)
+	mockToken.On("StoreRefreshToken", mock.Anything, mock.AnythingOfType("string"), "refresh-token").Return(nil)
+	mockToken.On("GenerateAccessTokenForSession", int64(1), mock.AnythingOfType("string"), int64(99)).Return("access-token", nil)
 
 	uc := usecase.NewAuthUseCase(mockUser, mockBusiness, mockToken, mockCloud)
 	h := NewAuthHandler(uc, "dev")
@@ -85,9 +86,9 @@ func TestAuthHandler_Login_Success(t *testing.T) {
 
 	user := &entity.User{ID: 1, Email: "login@example.com", Password: hashed}
 	mockUser.On("GetByEmail", mock.Anything, "login@example.com").Return(user, nil)
-	mockToken.On("GenerateRefreshToken", int64(1)).Return("refresh-token", nil)
-	mockToken.On("StoreRefreshToken", mock.Anything, int64(1), "refresh-token").Return(nil)
-	mockToken.On("GenerateAccessToken", int64(1)).Return("access-token", nil)
+	mockToken.On("GenerateRefreshToken", int64(1), mock.AnythingOfType("string")).Return("refresh-token", nil)
+	mockToken.On("StoreRefreshToken", mock.Anything, mock.AnythingOfType("string"), "refresh-token").Return(nil)
+	mockToken.On("GenerateAccessTokenForSession", int64(1), mock.AnythingOfType("string")).Return("access-token", nil)
 
 	uc := usecase.NewAuthUseCase(mockUser, mockBusiness, mockToken, mockCloud)
 	h := NewAuthHandler(uc, "dev")
@@ -204,11 +205,11 @@ func TestAuthHandler_Refresh_Success(t *testing.T) {
 	mockToken := &testutil.MockTokenService{}
 	mockCloud := &testutil.MockCloudService{}
 
-	mockToken.On("VerifyRefreshToken", mock.Anything, "old-refresh").Return("7", nil)
-	mockToken.On("GetRefreshToken", mock.Anything, int64(7)).Return("old-refresh", nil)
-	mockToken.On("GenerateRefreshToken", int64(7)).Return("new-refresh", nil)
-	mockToken.On("GenerateAccessToken", int64(7)).Return("new-access", nil)
-	mockToken.On("StoreRefreshToken", mock.Anything, int64(7), "new-refresh").Return(nil)
+	mockToken.On("VerifyRefreshToken", mock.Anything, "old-refresh").Return(&interfaces.RefreshClaims{UserID: 7, SessionID: "sess-7"}, nil)
+	mockToken.On("GetRefreshToken", mock.Anything, "sess-7").Return("old-refresh", nil)
+	mockToken.On("GenerateRefreshToken", int64(7), "sess-7").Return("new-refresh", nil)
+	mockToken.On("GenerateAccessTokenForSession", int64(7), mock.AnythingOfType("string")).Return("new-access", nil)
+	mockToken.On("RotateRefreshToken", mock.Anything, "sess-7", "old-refresh", "new-refresh").Return(true, nil)
 
 	uc := usecase.NewAuthUseCase(mockUser, mockBusiness, mockToken, mockCloud)
 	h := NewAuthHandler(uc, "dev")
@@ -233,7 +234,7 @@ func TestAuthHandler_Refresh_InvalidToken(t *testing.T) {
 	mockToken := &testutil.MockTokenService{}
 	mockCloud := &testutil.MockCloudService{}
 
-	mockToken.On("VerifyRefreshToken", mock.Anything, "bad-refresh").Return("", errors.New("invalid token"))
+	mockToken.On("VerifyRefreshToken", mock.Anything, "bad-refresh").Return(nil, errors.New("invalid token"))
 
 	uc := usecase.NewAuthUseCase(mockUser, mockBusiness, mockToken, mockCloud)
 	h := NewAuthHandler(uc, "dev")
@@ -253,18 +254,26 @@ func TestAuthHandler_Logout_Success(t *testing.T) {
 	mockToken := &testutil.MockTokenService{}
 	mockCloud := &testutil.MockCloudService{}
 
-	mockToken.On("RemoveRefreshToken", mock.Anything, int64(42)).Return(nil)
+	mockSessions := &testutil.MockSessionService{}
+
+	mockToken.On("VerifyRefreshToken", mock.Anything, "refresh-42").Return(&interfaces.RefreshClaims{UserID: 42, SessionID: "sess-42"}, nil)
+	mockToken.On("RemoveRefreshToken", mock.Anything, "sess-42").Return(nil)
+	mockToken.On("RevokeSessionAccessTokens", mock.Anything, "sess-42").Return(nil)
+	mockSessions.On("RevokeSession", mock.Anything, int64(42), "sess-42").Return(nil)
 
 	uc := usecase.NewAuthUseCase(mockUser, mockBusiness, mockToken, mockCloud)
+	uc.Sessions = mockSessions
 	h := NewAuthHandler(uc, "dev")
 
 	req := httptest.NewRequest(http.MethodDelete, "/logout/", nil)
+	req.AddCookie(&http.Cookie{Name: "refresh_token", Value: "refresh-42"})
 	req = req.WithContext(middleware.WithUserID(req.Context(), 42))
 	rr := httptest.NewRecorder()
 	h.logout(rr, req)
 
 	require.Equal(t, http.StatusOK, rr.Code)
 	mockToken.AssertExpectations(t)
+	mockSessions.AssertExpectations(t)
 }
 
 func TestAuthHandler_UpdateProfile_Unauthorized(t *testing.T) {
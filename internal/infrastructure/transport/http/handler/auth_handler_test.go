@@ -13,6 +13,7 @@ import (
 	"github.com/Prashant2307200/auth-service/internal/testutil"
 	"github.com/Prashant2307200/auth-service/internal/usecase"
 	"github.com/Prashant2307200/auth-service/internal/usecase/interfaces"
+	"github.com/Prashant2307200/auth-service/pkg/jwk"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 )
@@ -241,3 +242,26 @@ func TestAuthHandler_UpdateProfile_InvalidProfilePic(t *testing.T) {
 	require.True(t, ok)
 	mockUser.AssertExpectations(t)
 }
+
+func TestAuthHandler_JWKS_Success(t *testing.T) {
+	mockUser := &testutil.MockUserRepo{}
+	mockBusiness := &testutil.MockBusinessRepo{}
+	mockToken := &testutil.MockTokenService{}
+	mockCloud := &testutil.MockCloudService{}
+	mockToken.On("GetJWKS").Return(&jwk.Set{Keys: []jwk.Key{{Kty: "RSA", Kid: "k1", N: "n", E: "AQAB"}}}, nil)
+	uc := usecase.NewAuthUseCase(mockUser, mockBusiness, mockToken, mockCloud)
+	h := NewAuthHandler(uc, "dev")
+
+	mux := http.NewServeMux()
+	h.RegisterWellKnownRoutes(mux)
+	req := httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil)
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+
+	require.Equal(t, http.StatusOK, rr.Code)
+	var set jwk.Set
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &set))
+	require.Len(t, set.Keys, 1)
+	require.Equal(t, "k1", set.Keys[0].Kid)
+	mockToken.AssertExpectations(t)
+}
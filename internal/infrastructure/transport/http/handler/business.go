@@ -7,10 +7,12 @@ import (
 	"strconv"
 
 	"github.com/Prashant2307200/auth-service/internal/entity"
+	"github.com/Prashant2307200/auth-service/internal/infrastructure/transport/http/dto"
 	"github.com/Prashant2307200/auth-service/internal/infrastructure/transport/http/middleware"
 	"github.com/Prashant2307200/auth-service/internal/infrastructure/transport/http/utils/request"
 	"github.com/Prashant2307200/auth-service/internal/infrastructure/transport/http/utils/response"
 	"github.com/Prashant2307200/auth-service/internal/usecase"
+	"github.com/Prashant2307200/auth-service/pkg/domainverify"
 )
 
 type BusinessHandler struct {
@@ -39,6 +41,10 @@ type toggleDomainAutoJoinRequest struct {
 	AutoJoinEnabled bool `json:"auto_join_enabled"`
 }
 
+type loginPolicyRequest struct {
+	PasswordLoginDisabled bool `json:"password_login_disabled"`
+}
+
 func NewBusinessHandler(uc *usecase.BusinessUseCase) *BusinessHandler {
 	return &BusinessHandler{UC: uc}
 }
@@ -55,9 +61,12 @@ func (h *BusinessHandler) RegisterRoutes(mux *http.ServeMux) {
 	mux.HandleFunc("POST /{id}/invites/", h.createInvite)
 	mux.HandleFunc("GET /{id}/invites/", h.listInvites)
 	mux.HandleFunc("DELETE /{id}/invites/{inviteId}/", h.revokeInvite)
+	mux.HandleFunc("GET /{id}/domains/", h.listDomains)
 	mux.HandleFunc("POST /{id}/domains/", h.addDomain)
 	mux.HandleFunc("POST /{id}/domains/verify/", h.verifyDomain)
 	mux.HandleFunc("PUT /{id}/domains/{domainId}/", h.toggleDomainAutoJoin)
+	mux.HandleFunc("GET /{id}/login-policy/", h.getLoginPolicy)
+	mux.HandleFunc("PUT /{id}/login-policy/", h.updateLoginPolicy)
 }
 
 func (h *BusinessHandler) create(w http.ResponseWriter, r *http.Request) {
@@ -340,7 +349,30 @@ func (h *BusinessHandler) addDomain(w http.ResponseWriter, r *http.Request) {
 		response.WriteError(w, http.StatusForbidden, err)
 		return
 	}
-	response.WriteSuccess(w, http.StatusCreated, "domain added successfully", domain)
+	response.WriteSuccess(w, http.StatusCreated, "domain added successfully", domainResponse(domain))
+}
+
+func (h *BusinessHandler) listDomains(w http.ResponseWriter, r *http.Request) {
+	requesterID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.WriteError(w, http.StatusUnauthorized, errors.New("authentication required"))
+		return
+	}
+	businessID, err := request.ParseId(r)
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	domains, err := h.UC.ListDomains(r.Context(), requesterID, businessID)
+	if err != nil {
+		response.WriteError(w, http.StatusForbidden, err)
+		return
+	}
+	resp := make([]dto.BusinessDomainResponse, 0, len(domains))
+	for _, d := range domains {
+		resp = append(resp, domainResponse(d))
+	}
+	response.WriteJson(w, http.StatusOK, resp)
 }
 
 func (h *BusinessHandler) verifyDomain(w http.ResponseWriter, r *http.Request) {
@@ -364,11 +396,31 @@ func (h *BusinessHandler) verifyDomain(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	domain, err := h.UC.VerifyDomain(r.Context(), requesterID, businessID, payload.VerificationToken)
-	if err != nil {
+	switch {
+	case errors.Is(err, usecase.ErrDomainNotVerified):
+		// The domain stays pending and is checked again in the background.
+		response.WriteError(w, http.StatusUnprocessableEntity, err)
+		return
+	case errors.Is(err, usecase.ErrDomainVerificationUnavailable):
+		response.WriteError(w, http.StatusServiceUnavailable, err)
+		return
+	case err != nil:
 		response.WriteError(w, http.StatusForbidden, err)
 		return
 	}
-	response.WriteSuccess(w, http.StatusOK, "domain verified successfully", domain)
+	response.WriteSuccess(w, http.StatusOK, "domain verified successfully", domainResponse(domain))
+}
+
+// domainResponse adds where to publish d's verification token.
+func domainResponse(d *entity.BusinessDomain) dto.BusinessDomainResponse {
+	return dto.BusinessDomainResponse{
+		BusinessDomain: d,
+		Verification: dto.DomainVerificationInstructions{
+			TXTRecordName:  domainverify.RecordPrefix + d.Domain,
+			TXTRecordValue: domainverify.RecordValuePrefix + d.VerificationToken,
+			WellKnownURL:   "https://" + d.Domain + domainverify.WellKnownPath,
+		},
+	}
 }
 
 func (h *BusinessHandler) toggleDomainAutoJoin(w http.ResponseWriter, r *http.Request) {
@@ -399,3 +451,46 @@ func (h *BusinessHandler) toggleDomainAutoJoin(w http.ResponseWriter, r *http.Re
 	}
 	response.WriteSuccess(w, http.StatusOK, "domain auto-join updated successfully", nil)
 }
+
+func (h *BusinessHandler) getLoginPolicy(w http.ResponseWriter, r *http.Request) {
+	requesterID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.WriteError(w, http.StatusUnauthorized, errors.New("authentication required"))
+		return
+	}
+	businessID, err := request.ParseId(r)
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	policy, err := h.UC.GetLoginPolicy(r.Context(), requesterID, businessID)
+	if err != nil {
+		response.WriteError(w, http.StatusForbidden, err)
+		return
+	}
+	response.WriteJson(w, http.StatusOK, policy)
+}
+
+func (h *BusinessHandler) updateLoginPolicy(w http.ResponseWriter, r *http.Request) {
+	requesterID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.WriteError(w, http.StatusUnauthorized, errors.New("authentication required"))
+		return
+	}
+	businessID, err := request.ParseId(r)
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	payload, err := request.ParseJSON[loginPolicyRequest](r)
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	policy := &entity.BusinessLoginPolicy{BusinessID: businessID, PasswordLoginDisabled: payload.PasswordLoginDisabled}
+	if err := h.UC.UpdateLoginPolicy(r.Context(), requesterID, policy); err != nil {
+		response.WriteError(w, http.StatusForbidden, err)
+		return
+	}
+	response.WriteJson(w, http.StatusOK, policy)
+}
@@ -2,9 +2,11 @@ package handler
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"net/http"
 	"net/http/httptest"
+	"slices"
 	"testing"
 	"time"
 
@@ -284,15 +286,26 @@ func TestBusinessHandler_CreateDomain_Success(t *testing.T) {
 	mockBusiness.AssertExpectations(t)
 }
 
+// publishedDomains verifies the domains listed, by DNS.
+type publishedDomains []string
+
+func (p publishedDomains) Verify(_ context.Context, domain, _ string) (string, error) {
+	if slices.Contains(p, domain) {
+		return "dns", nil
+	}
+	return "", errors.New("verification token not found")
+}
+
 func TestBusinessHandler_VerifyDomain_Success(t *testing.T) {
 	mockBusiness := &testutil.MockBusinessRepo{}
 	mockUser := &testutil.MockUserRepo{}
 	domain := &entity.BusinessDomain{ID: 902, BusinessID: 58, Domain: "acme.co", VerificationToken: "verify-token"}
 	mockBusiness.On("GetUserRole", mock.Anything, int64(58), int64(20)).Return(usecase.BusinessRoleAdmin, nil)
 	mockBusiness.On("GetDomainByVerificationToken", mock.Anything, "verify-token").Return(domain, nil)
-	mockBusiness.On("VerifyDomain", mock.Anything, int64(902)).Return(nil)
+	mockBusiness.On("UpdateDomainCheck", mock.Anything, domain).Return(nil)
 
 	uc := usecase.NewBusinessUseCase(mockBusiness, mockUser)
+	uc.DomainVerifier = publishedDomains{"acme.co"}
 	h := NewBusinessHandler(uc)
 
 	req := httptest.NewRequest(http.MethodPost, "/businesses?id=58", bytes.NewBufferString(`{"verification_token":"verify-token"}`))
@@ -306,6 +319,28 @@ func TestBusinessHandler_VerifyDomain_Success(t *testing.T) {
 	mockBusiness.AssertExpectations(t)
 }
 
+func TestBusinessHandler_VerifyDomain_TokenNotPublished(t *testing.T) {
+	mockBusiness := &testutil.MockBusinessRepo{}
+	domain := &entity.BusinessDomain{ID: 904, BusinessID: 58, Domain: "acme.co", VerificationToken: "verify-token"}
+	mockBusiness.On("GetUserRole", mock.Anything, int64(58), int64(20)).Return(usecase.BusinessRoleAdmin, nil)
+	mockBusiness.On("GetDomainByVerificationToken", mock.Anything, "verify-token").Return(domain, nil)
+	mockBusiness.On("UpdateDomainCheck", mock.Anything, domain).Return(nil)
+
+	uc := usecase.NewBusinessUseCase(mockBusiness, &testutil.MockUserRepo{})
+	uc.DomainVerifier = publishedDomains{}
+	h := NewBusinessHandler(uc)
+
+	req := httptest.NewRequest(http.MethodPost, "/businesses?id=58", bytes.NewBufferString(`{"verification_token":"verify-token"}`))
+	req = req.WithContext(middleware.WithUserID(req.Context(), 20))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+
+	h.verifyDomain(rr, req)
+
+	require.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+	mockBusiness.AssertExpectations(t)
+}
+
 func TestBusinessHandler_UpdateDomainAutoJoin_Success(t *testing.T) {
 	mockBusiness := &testutil.MockBusinessRepo{}
 	mockUser := &testutil.MockUserRepo{}
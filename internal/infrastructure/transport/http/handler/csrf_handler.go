@@ -0,0 +1,43 @@
+package handler
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/Prashant2307200/auth-service/internal/infrastructure/transport/http/dto"
+	"github.com/Prashant2307200/auth-service/internal/infrastructure/transport/http/middleware"
+	"github.com/Prashant2307200/auth-service/internal/infrastructure/transport/http/utils/response"
+	"github.com/Prashant2307200/auth-service/pkg/csrf"
+)
+
+type CSRFHandler struct {
+	Signer *csrf.Signer
+}
+
+func NewCSRFHandler(signer *csrf.Signer) *CSRFHandler {
+	return &CSRFHandler{Signer: signer}
+}
+
+// RegisterRoutes mounts the endpoint single-page apps call for the token
+// they send in the X-CSRF-Token header.
+func (h *CSRFHandler) RegisterRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("GET /csrf", h.token)
+}
+
+func (h *CSRFHandler) token(w http.ResponseWriter, r *http.Request) {
+	binding, ok := middleware.CSRFBinding(r.Context())
+	if !ok {
+		response.WriteError(w, http.StatusUnauthorized, errors.New("authentication required"))
+		return
+	}
+
+	token, err := h.Signer.Token(binding)
+	if err != nil {
+		slog.Error("Failed to issue CSRF token", slog.Any("error", err))
+		response.WriteError(w, http.StatusInternalServerError, errors.New("failed to issue CSRF token"))
+		return
+	}
+	setNoStore(w)
+	response.WriteJson(w, http.StatusOK, dto.CSRFTokenResponse{CSRFToken: token})
+}
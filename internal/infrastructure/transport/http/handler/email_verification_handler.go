@@ -21,7 +21,7 @@ func NewEmailVerificationHandler(uc usecase.EmailVerificationUsecase) *EmailVeri
 }
 
 func (h *EmailVerificationHandler) RegisterRoutes(mux *http.ServeMux) {
-	mux.HandleFunc("POST /verify-email", h.verifyEmail)
+	mux.Handle("POST /verify-email", middleware.Public(h.verifyEmail))
 	mux.HandleFunc("POST /resend-verification", h.resendVerification)
 }
 
@@ -38,7 +38,12 @@ func init() {
 	// Register collectors to the default registry. If they are already registered
 	// (e.g. during tests or multiple package initializations), ignore the
 	// AlreadyRegistered error and continue.
-	collectors := []prometheus.Collector{inviteSent, inviteAccepted, invitesRevoked, tokenVerificationsTotal, tokenVerificationDuration}
+	RegisterCollectors(inviteSent, inviteAccepted, invitesRevoked, tokenVerificationsTotal, tokenVerificationDuration)
+}
+
+// RegisterCollectors adds collectors owned by other packages to the default
+// registry so they are exported via /metrics.
+func RegisterCollectors(collectors ...prometheus.Collector) {
 	for _, c := range collectors {
 		if err := prometheus.Register(c); err != nil {
 			var are prometheus.AlreadyRegisteredError
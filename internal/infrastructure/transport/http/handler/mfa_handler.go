@@ -3,7 +3,9 @@ package handler
 import (
 	"errors"
 	"log/slog"
+	"math"
 	"net/http"
+	"strconv"
 
 	"github.com/Prashant2307200/auth-service/internal/infrastructure/transport/http/dto"
 	"github.com/Prashant2307200/auth-service/internal/infrastructure/transport/http/middleware"
@@ -117,6 +119,8 @@ func (h *MFAHandler) disable(w http.ResponseWriter, r *http.Request) {
 		switch {
 		case errors.Is(err, usecase.ErrMFANotEnabled):
 			response.WriteError(w, http.StatusBadRequest, errors.New("MFA is not enabled"))
+		case errors.Is(err, usecase.ErrMFALocked):
+			writeMFALocked(w, err)
 		case errors.Is(err, usecase.ErrInvalidTOTPCode):
 			response.WriteError(w, http.StatusBadRequest, errors.New("invalid code"))
 		default:
@@ -141,19 +145,18 @@ func (h *MFAHandler) verify(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = h.UC.Verify(r.Context(), userID, req.Code)
+	err = h.UC.VerifyCode(r.Context(), userID, req.Code)
 	if err != nil {
-		if errors.Is(err, usecase.ErrInvalidTOTPCode) {
-			err = h.UC.VerifyBackupCode(r.Context(), userID, req.Code)
-			if err != nil {
-				response.WriteError(w, http.StatusBadRequest, errors.New("invalid code"))
-				return
-			}
-		} else {
-			slog.Error("Error verifying MFA", slog.Any("error", err))
+		switch {
+		case errors.Is(err, usecase.ErrMFALocked):
+			writeMFALocked(w, err)
+		case errors.Is(err, usecase.ErrInvalidTOTPCode), errors.Is(err, usecase.ErrMFANotEnabled):
 			response.WriteError(w, http.StatusBadRequest, errors.New("invalid code"))
-			return
+		default:
+			slog.Error("Error verifying MFA", slog.Any("error", err))
+			response.WriteError(w, http.StatusInternalServerError, errors.New("failed to verify MFA"))
 		}
+		return
 	}
 
 	response.WriteSuccess(w, http.StatusOK, "MFA verified successfully", nil)
@@ -178,6 +181,8 @@ func (h *MFAHandler) regenerateBackupCodes(w http.ResponseWriter, r *http.Reques
 		switch {
 		case errors.Is(err, usecase.ErrMFANotEnabled):
 			response.WriteError(w, http.StatusBadRequest, errors.New("MFA is not enabled"))
+		case errors.Is(err, usecase.ErrMFALocked):
+			writeMFALocked(w, err)
 		case errors.Is(err, usecase.ErrInvalidTOTPCode):
 			response.WriteError(w, http.StatusBadRequest, errors.New("invalid code"))
 		default:
@@ -210,3 +215,12 @@ func (h *MFAHandler) status(w http.ResponseWriter, r *http.Request) {
 		"mfa_enabled": enabled,
 	})
 }
+
+// writeMFALocked answers 429 with a Retry-After header for a locked-out user.
+func writeMFALocked(w http.ResponseWriter, err error) {
+	var locked *usecase.MFALockedError
+	if errors.As(err, &locked) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(locked.RetryAfter.Seconds()))))
+	}
+	response.WriteError(w, http.StatusTooManyRequests, errors.New("too many failed attempts, try again later"))
+}
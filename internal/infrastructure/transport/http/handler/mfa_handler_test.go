@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/Prashant2307200/auth-service/internal/entity"
 	"github.com/Prashant2307200/auth-service/internal/infrastructure/transport/http/middleware"
@@ -50,6 +51,11 @@ func (m *mockMFAUsecase) VerifyBackupCode(ctx context.Context, userID int64, cod
 	return args.Error(0)
 }
 
+func (m *mockMFAUsecase) VerifyCode(ctx context.Context, userID int64, code string) error {
+	args := m.Called(ctx, userID, code)
+	return args.Error(0)
+}
+
 func (m *mockMFAUsecase) RegenerateBackupCodes(ctx context.Context, userID int64, code string) ([]string, error) {
 	args := m.Called(ctx, userID, code)
 	if args.Get(0) == nil {
@@ -91,14 +97,6 @@ func (m *mockUserRepoForMFA) GetByEmail(ctx context.Context, email string) (*ent
 	return args.Get(0).(*entity.User), args.Error(1)
 }
 
-func (m *mockUserRepoForMFA) GetByGoogleID(ctx context.Context, googleID string) (*entity.User, error) {
-	args := m.Called(ctx, googleID)
-	if args.Get(0) == nil {
-		return nil, args.Error(1)
-	}
-	return args.Get(0).(*entity.User), args.Error(1)
-}
-
 func (m *mockUserRepoForMFA) Create(ctx context.Context, user *entity.User) (int64, error) {
 	args := m.Called(ctx, user)
 	return args.Get(0).(int64), args.Error(1)
@@ -124,11 +122,6 @@ func (m *mockUserRepoForMFA) MarkEmailVerified(ctx context.Context, userID int64
 	return args.Error(0)
 }
 
-func (m *mockUserRepoForMFA) LinkGoogleID(ctx context.Context, userID int64, googleID string) error {
-	args := m.Called(ctx, userID, googleID)
-	return args.Error(0)
-}
-
 func (m *mockUserRepoForMFA) Search(ctx context.Context, currentID int64, search string) ([]*entity.User, error) {
 	args := m.Called(ctx, currentID, search)
 	if args.Get(0) == nil {
@@ -280,7 +273,7 @@ func TestMFAHandler_Verify_Unauthorized(t *testing.T) {
 func TestMFAHandler_Verify_Success(t *testing.T) {
 	uc := &mockMFAUsecase{}
 	userRepo := &mockUserRepoForMFA{}
-	uc.On("Verify", mock.Anything, int64(1), "123456").Return(nil)
+	uc.On("VerifyCode", mock.Anything, int64(1), "123456").Return(nil)
 	h := NewMFAHandler(uc, userRepo)
 
 	body := `{"code":"123456"}`
@@ -294,6 +287,24 @@ func TestMFAHandler_Verify_Success(t *testing.T) {
 	uc.AssertExpectations(t)
 }
 
+func TestMFAHandler_Verify_LockedOut(t *testing.T) {
+	uc := &mockMFAUsecase{}
+	userRepo := &mockUserRepoForMFA{}
+	uc.On("VerifyCode", mock.Anything, int64(1), "123456").Return(&usecase.MFALockedError{RetryAfter: 90 * time.Second})
+	h := NewMFAHandler(uc, userRepo)
+
+	body := `{"code":"123456"}`
+	req := httptest.NewRequest(http.MethodPost, "/mfa/verify", bytes.NewReader([]byte(body)))
+	req.Header.Set("Content-Type", "application/json")
+	req = req.WithContext(middleware.WithUserID(req.Context(), 1))
+	rr := httptest.NewRecorder()
+	h.verify(rr, req)
+
+	require.Equal(t, http.StatusTooManyRequests, rr.Code)
+	require.Equal(t, "90", rr.Header().Get("Retry-After"))
+	uc.AssertExpectations(t)
+}
+
 func TestMFAHandler_Disable_Unauthorized(t *testing.T) {
 	uc := &mockMFAUsecase{}
 	userRepo := &mockUserRepoForMFA{}
@@ -0,0 +1,568 @@
+package handler
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+
+	"github.com/Prashant2307200/auth-service/internal/entity"
+	"github.com/Prashant2307200/auth-service/internal/infrastructure/transport/http/dto"
+	"github.com/Prashant2307200/auth-service/internal/infrastructure/transport/http/middleware"
+	"github.com/Prashant2307200/auth-service/internal/infrastructure/transport/http/utils/request"
+	"github.com/Prashant2307200/auth-service/internal/infrastructure/transport/http/utils/response"
+	"github.com/Prashant2307200/auth-service/internal/usecase"
+)
+
+const (
+	maxOAuthFormBytes = 64 * 1024
+
+	grantTypeDeviceCode = "urn:ietf:params:oauth:grant-type:device_code"
+)
+
+// OAuthFrontend holds the URLs the authorization endpoint sends users to.
+type OAuthFrontend struct {
+	// Issuer is the public base URL of this service.
+	Issuer string
+	// LoginURL gets a return_to parameter pointing back to /oauth/authorize.
+	LoginURL string
+	// ConsentURL gets the request_id of the request awaiting consent.
+	ConsentURL string
+	// DeviceURL is where users enter the user code shown by a device.
+	DeviceURL string
+}
+
+type OAuthHandler struct {
+	UC       usecase.OAuthUsecase
+	Frontend OAuthFrontend
+	// OptionalAuth identifies the signed-in user, if any, on /oauth/authorize.
+	OptionalAuth func(http.Handler) http.Handler
+}
+
+func NewOAuthHandler(uc usecase.OAuthUsecase, frontend OAuthFrontend, optionalAuth func(http.Handler) http.Handler) *OAuthHandler {
+	return &OAuthHandler{UC: uc, Frontend: frontend, OptionalAuth: optionalAuth}
+}
+
+// RegisterRoutes mounts the endpoints OAuth clients and their users' browsers
+// call. They do not require a session, so they live outside /api/v1.
+func (h *OAuthHandler) RegisterRoutes(mux *http.ServeMux) {
+	mux.Handle("GET /oauth/authorize", h.OptionalAuth(http.HandlerFunc(h.authorize)))
+	mux.HandleFunc("POST /oauth/token", h.token)
+	mux.HandleFunc("POST /oauth/device/code", h.deviceAuthorization)
+	mux.HandleFunc("POST /oauth/introspect", h.introspect)
+	mux.HandleFunc("POST /oauth/revoke", h.revoke)
+	mux.HandleFunc("GET /oauth/userinfo", h.userInfo)
+	mux.HandleFunc("POST /oauth/userinfo", h.userInfo)
+	mux.HandleFunc("GET /.well-known/openid-configuration", h.openIDConfiguration)
+}
+
+// RegisterClientRoutes mounts client administration for signed-in admins.
+func (h *OAuthHandler) RegisterClientRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("GET /clients", h.listClients)
+	mux.HandleFunc("POST /clients", h.createClient)
+	mux.HandleFunc("DELETE /clients/{clientId}", h.deleteClient)
+}
+
+// RegisterConsentRoutes mounts the consent screen API, its counterpart for
+// device user codes, and the signed-in user's management of the clients they
+// consented to.
+func (h *OAuthHandler) RegisterConsentRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("GET /consent/{requestId}", h.getConsentRequest)
+	mux.HandleFunc("POST /consent/{requestId}", h.decideConsent)
+	mux.HandleFunc("GET /device/{userCode}", h.getDeviceRequest)
+	mux.HandleFunc("POST /device/{userCode}", h.decideDevice)
+	mux.HandleFunc("GET /consents", h.listConsents)
+	mux.HandleFunc("DELETE /consents/{clientId}", h.revokeConsent)
+}
+
+func (h *OAuthHandler) authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	req := usecase.AuthorizationRequest{
+		ResponseType:        q.Get("response_type"),
+		ClientID:            q.Get("client_id"),
+		RedirectURI:         q.Get("redirect_uri"),
+		Scope:               q.Get("scope"),
+		State:               q.Get("state"),
+		CodeChallenge:       q.Get("code_challenge"),
+		CodeChallengeMethod: q.Get("code_challenge_method"),
+		Nonce:               q.Get("nonce"),
+	}
+	userID, _ := middleware.GetUserIDFromContext(r.Context())
+
+	result, err := h.UC.Authorize(r.Context(), req, userID)
+	var oauthErr *usecase.OAuthError
+	if errors.As(err, &oauthErr) {
+		// The redirect URI is not trusted, so the error stays with the user.
+		writeOAuthError(w, http.StatusBadRequest, oauthErr.Code, oauthErr.Description)
+		return
+	}
+	if err != nil {
+		slog.Error("Authorization request failed", slog.Any("error", err))
+		writeOAuthError(w, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+
+	switch {
+	case result.LoginRequired:
+		http.Redirect(w, r, withQueryParam(h.Frontend.LoginURL, "return_to", h.Frontend.Issuer+r.URL.RequestURI()), http.StatusFound)
+	case result.ConsentRequestID != "":
+		http.Redirect(w, r, withQueryParam(h.Frontend.ConsentURL, "request_id", result.ConsentRequestID), http.StatusFound)
+	default:
+		http.Redirect(w, r, result.RedirectURL, http.StatusFound)
+	}
+}
+
+func (h *OAuthHandler) token(w http.ResponseWriter, r *http.Request) {
+	client, ok := h.authenticateClient(w, r)
+	if !ok {
+		return
+	}
+	var tok *usecase.OAuthTokenResponse
+	var err error
+	switch r.PostForm.Get("grant_type") {
+	case "authorization_code":
+		tok, err = h.UC.ExchangeAuthorizationCode(r.Context(), client,
+			r.PostForm.Get("code"), r.PostForm.Get("redirect_uri"), r.PostForm.Get("code_verifier"))
+	case "client_credentials":
+		tok, err = h.UC.ClientCredentials(r.Context(), client, r.PostForm.Get("scope"))
+	case grantTypeDeviceCode:
+		tok, err = h.UC.ExchangeDeviceCode(r.Context(), client, r.PostForm.Get("device_code"))
+	default:
+		writeOAuthError(w, http.StatusBadRequest, "unsupported_grant_type", "")
+		return
+	}
+	var oauthErr *usecase.OAuthError
+	if errors.As(err, &oauthErr) {
+		writeOAuthError(w, http.StatusBadRequest, oauthErr.Code, oauthErr.Description)
+		return
+	}
+	if err != nil {
+		slog.Error("Token request failed", slog.String("client_id", client.ClientID), slog.Any("error", err))
+		writeOAuthError(w, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+
+	setNoStore(w)
+	response.WriteJson(w, http.StatusOK, dto.OAuthTokenResponse{
+		AccessToken: tok.AccessToken,
+		TokenType:   tok.TokenType,
+		ExpiresIn:   tok.ExpiresIn,
+		Scope:       tok.Scope,
+		IDToken:     tok.IDToken,
+	})
+}
+
+// deviceAuthorization starts the device authorization grant (RFC 8628 §3.1).
+func (h *OAuthHandler) deviceAuthorization(w http.ResponseWriter, r *http.Request) {
+	client, ok := h.authenticateClient(w, r)
+	if !ok {
+		return
+	}
+
+	auth, err := h.UC.StartDeviceAuthorization(r.Context(), client, r.PostForm.Get("scope"))
+	var oauthErr *usecase.OAuthError
+	if errors.As(err, &oauthErr) {
+		writeOAuthError(w, http.StatusBadRequest, oauthErr.Code, oauthErr.Description)
+		return
+	}
+	if err != nil {
+		slog.Error("Device authorization failed", slog.String("client_id", client.ClientID), slog.Any("error", err))
+		writeOAuthError(w, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+
+	setNoStore(w)
+	response.WriteJson(w, http.StatusOK, dto.DeviceAuthorizationResponse{
+		DeviceCode:              auth.DeviceCode,
+		UserCode:                auth.UserCode,
+		VerificationURI:         h.Frontend.DeviceURL,
+		VerificationURIComplete: withQueryParam(h.Frontend.DeviceURL, "user_code", auth.UserCode),
+		ExpiresIn:               auth.ExpiresIn,
+		Interval:                auth.Interval,
+	})
+}
+
+// userInfo serves the OpenID Connect userinfo endpoint. The access token is
+// sent as a Bearer token (RFC 6750 §2.1).
+func (h *OAuthHandler) userInfo(w http.ResponseWriter, r *http.Request) {
+	token, ok := request.BearerToken(r)
+	if !ok {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="oauth"`)
+		writeOAuthError(w, http.StatusUnauthorized, "invalid_request", "bearer token is required")
+		return
+	}
+
+	claims, err := h.UC.UserInfo(r.Context(), token)
+	switch {
+	case errors.Is(err, usecase.ErrInvalidAccessToken):
+		w.Header().Set("WWW-Authenticate", `Bearer realm="oauth", error="invalid_token"`)
+		writeOAuthError(w, http.StatusUnauthorized, "invalid_token", "")
+		return
+	case errors.Is(err, usecase.ErrInsufficientScope):
+		w.Header().Set("WWW-Authenticate", `Bearer realm="oauth", error="insufficient_scope", scope="openid"`)
+		writeOAuthError(w, http.StatusForbidden, "insufficient_scope", err.Error())
+		return
+	case err != nil:
+		slog.Error("Userinfo request failed", slog.Any("error", err))
+		writeOAuthError(w, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+	setNoStore(w)
+	response.WriteJson(w, http.StatusOK, claims)
+}
+
+func (h *OAuthHandler) openIDConfiguration(w http.ResponseWriter, r *http.Request) {
+	issuer := h.Frontend.Issuer
+	response.WriteJson(w, http.StatusOK, dto.OpenIDConfiguration{
+		Issuer:                            issuer,
+		AuthorizationEndpoint:             issuer + "/oauth/authorize",
+		TokenEndpoint:                     issuer + "/oauth/token",
+		UserinfoEndpoint:                  issuer + "/oauth/userinfo",
+		JwksURI:                           issuer + "/.well-known/jwks.json",
+		RevocationEndpoint:                issuer + "/oauth/revoke",
+		IntrospectionEndpoint:             issuer + "/oauth/introspect",
+		DeviceAuthorizationEndpoint:       issuer + "/oauth/device/code",
+		ScopesSupported:                   []string{usecase.ScopeOpenID, usecase.ScopeProfile, usecase.ScopeEmail},
+		ResponseTypesSupported:            []string{"code"},
+		GrantTypesSupported:               []string{"authorization_code", "client_credentials", grantTypeDeviceCode},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  []string{"RS256"},
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+		CodeChallengeMethodsSupported:     []string{"S256"},
+		ClaimsSupported:                   []string{"iss", "sub", "aud", "exp", "iat", "nonce", "name", "picture", "email", "email_verified"},
+	})
+}
+
+func (h *OAuthHandler) introspect(w http.ResponseWriter, r *http.Request) {
+	client, ok := h.authenticateClient(w, r)
+	if !ok {
+		return
+	}
+	// Introspection reveals tokens of every client; only confidential
+	// clients, typically resource servers, may use it.
+	if client.Public {
+		writeOAuthError(w, http.StatusUnauthorized, "invalid_client", "public clients cannot introspect tokens")
+		return
+	}
+	token := r.PostForm.Get("token")
+	if token == "" {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", "token is required")
+		return
+	}
+
+	info, err := h.UC.Introspect(r.Context(), token, r.PostForm.Get("token_type_hint"))
+	if err != nil {
+		slog.Error("Token introspection failed", slog.Any("error", err))
+		writeOAuthError(w, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+
+	resp := dto.IntrospectionResponse{Active: info.Active}
+	if info.Active {
+		resp.Sub = info.Subject
+		resp.Tenant = info.TenantID
+		resp.ClientID = info.ClientID
+		resp.Scope = info.Scope
+		resp.Exp = info.ExpiresAt.Unix()
+		resp.Sid = info.SessionID
+	}
+	setNoStore(w)
+	response.WriteJson(w, http.StatusOK, resp)
+}
+
+func (h *OAuthHandler) revoke(w http.ResponseWriter, r *http.Request) {
+	client, ok := h.authenticateClient(w, r)
+	if !ok {
+		return
+	}
+	token := r.PostForm.Get("token")
+	if token == "" {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", "token is required")
+		return
+	}
+
+	err := h.UC.Revoke(r.Context(), client, token, r.PostForm.Get("token_type_hint"))
+	if errors.Is(err, usecase.ErrUnauthorizedClient) {
+		writeOAuthError(w, http.StatusBadRequest, "unauthorized_client", err.Error())
+		return
+	}
+	if err != nil {
+		slog.Error("Token revocation failed", slog.String("client_id", client.ClientID), slog.Any("error", err))
+		writeOAuthError(w, http.StatusServiceUnavailable, "temporarily_unavailable", "")
+		return
+	}
+	// RFC 7009 §2.2: invalid tokens also get 200, so clients learn nothing.
+	w.WriteHeader(http.StatusOK)
+}
+
+// authenticateClient parses the form and checks the client credentials, sent
+// with HTTP Basic (client_secret_basic) or in the form (client_secret_post).
+// Public clients send only client_id in the form.
+// It writes the error response itself and reports whether to continue.
+func (h *OAuthHandler) authenticateClient(w http.ResponseWriter, r *http.Request) (*entity.OAuthClient, bool) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxOAuthFormBytes)
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", "malformed form body")
+		return nil, false
+	}
+
+	clientID, secret, basic := r.BasicAuth()
+	if basic {
+		// RFC 6749 §2.3.1 form-encodes both values before Basic encoding.
+		var errID, errSecret error
+		clientID, errID = url.QueryUnescape(clientID)
+		secret, errSecret = url.QueryUnescape(secret)
+		if errID != nil || errSecret != nil {
+			clientID, secret = "", ""
+		}
+	} else {
+		clientID, secret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+
+	client, err := h.UC.AuthenticateClient(r.Context(), clientID, secret)
+	if err != nil {
+		if !errors.Is(err, usecase.ErrInvalidClient) {
+			slog.Error("Client authentication failed", slog.Any("error", err))
+			writeOAuthError(w, http.StatusInternalServerError, "server_error", "")
+			return nil, false
+		}
+		if basic {
+			w.Header().Set("WWW-Authenticate", `Basic realm="oauth"`)
+		}
+		writeOAuthError(w, http.StatusUnauthorized, "invalid_client", "client authentication failed")
+		return nil, false
+	}
+	return client, true
+}
+
+func (h *OAuthHandler) listClients(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.WriteError(w, http.StatusUnauthorized, errors.New("authentication required"))
+		return
+	}
+
+	clients, err := h.UC.ListClients(r.Context(), userID)
+	if err != nil {
+		slog.Error("Failed to list oauth clients", slog.Any("error", err))
+		response.WriteDomainError(w, err)
+		return
+	}
+	if clients == nil {
+		clients = []*entity.OAuthClient{}
+	}
+	response.WriteJson(w, http.StatusOK, clients)
+}
+
+func (h *OAuthHandler) createClient(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.WriteError(w, http.StatusUnauthorized, errors.New("authentication required"))
+		return
+	}
+
+	req, err := request.ParseJSON[dto.OAuthClientCreateRequest](r)
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	client, secret, err := h.UC.CreateClient(r.Context(), userID, usecase.OAuthClientInput{
+		Name:         req.Name,
+		RedirectURIs: req.RedirectURIs,
+		Scopes:       req.Scopes,
+		Public:       req.Public,
+		BusinessID:   req.BusinessID,
+		FirstParty:   req.FirstParty,
+	})
+	if err != nil {
+		slog.Error("Failed to create oauth client", slog.Any("error", err))
+		response.WriteDomainError(w, err)
+		return
+	}
+	setNoStore(w)
+	response.WriteJson(w, http.StatusCreated, dto.OAuthClientCreatedResponse{OAuthClient: client, ClientSecret: secret})
+}
+
+func (h *OAuthHandler) deleteClient(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.WriteError(w, http.StatusUnauthorized, errors.New("authentication required"))
+		return
+	}
+
+	err = h.UC.DeleteClient(r.Context(), userID, r.PathValue("clientId"))
+	if errors.Is(err, usecase.ErrOAuthClientNotFound) {
+		response.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to delete oauth client", slog.Any("error", err))
+		response.WriteDomainError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *OAuthHandler) getConsentRequest(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.WriteError(w, http.StatusUnauthorized, errors.New("authentication required"))
+		return
+	}
+
+	req, err := h.UC.GetConsentRequest(r.Context(), userID, r.PathValue("requestId"))
+	if errors.Is(err, usecase.ErrConsentRequestNotFound) {
+		response.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to load consent request", slog.Any("error", err))
+		response.WriteDomainError(w, err)
+		return
+	}
+	response.WriteJson(w, http.StatusOK, dto.OAuthConsentRequestResponse{
+		ClientID:    req.ClientID,
+		ClientName:  req.ClientName,
+		RedirectURI: req.RedirectURI,
+		Scopes:      req.Scopes,
+	})
+}
+
+func (h *OAuthHandler) decideConsent(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.WriteError(w, http.StatusUnauthorized, errors.New("authentication required"))
+		return
+	}
+
+	req, err := request.ParseJSON[dto.OAuthConsentDecisionRequest](r)
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	redirectURL, err := h.UC.DecideConsent(r.Context(), userID, r.PathValue("requestId"), req.Approve)
+	if errors.Is(err, usecase.ErrConsentRequestNotFound) {
+		response.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to record consent decision", slog.Any("error", err))
+		response.WriteDomainError(w, err)
+		return
+	}
+	setNoStore(w)
+	response.WriteJson(w, http.StatusOK, dto.OAuthConsentDecisionResponse{RedirectURL: redirectURL})
+}
+
+func (h *OAuthHandler) getDeviceRequest(w http.ResponseWriter, r *http.Request) {
+	if _, err := middleware.GetUserIDFromContext(r.Context()); err != nil {
+		response.WriteError(w, http.StatusUnauthorized, errors.New("authentication required"))
+		return
+	}
+
+	req, err := h.UC.GetDeviceRequest(r.Context(), r.PathValue("userCode"))
+	if errors.Is(err, usecase.ErrUserCodeNotFound) {
+		response.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to load device request", slog.Any("error", err))
+		response.WriteDomainError(w, err)
+		return
+	}
+	response.WriteJson(w, http.StatusOK, dto.OAuthConsentRequestResponse{
+		ClientID:   req.ClientID,
+		ClientName: req.ClientName,
+		Scopes:     req.Scopes,
+	})
+}
+
+func (h *OAuthHandler) decideDevice(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.WriteError(w, http.StatusUnauthorized, errors.New("authentication required"))
+		return
+	}
+
+	req, err := request.ParseJSON[dto.OAuthConsentDecisionRequest](r)
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	err = h.UC.DecideDevice(r.Context(), userID, r.PathValue("userCode"), req.Approve)
+	if errors.Is(err, usecase.ErrUserCodeNotFound) {
+		response.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to record device decision", slog.Any("error", err))
+		response.WriteDomainError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *OAuthHandler) listConsents(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.WriteError(w, http.StatusUnauthorized, errors.New("authentication required"))
+		return
+	}
+
+	consents, err := h.UC.ListConsents(r.Context(), userID)
+	if err != nil {
+		slog.Error("Failed to list oauth consents", slog.Any("error", err))
+		response.WriteDomainError(w, err)
+		return
+	}
+	if consents == nil {
+		consents = []*entity.OAuthConsent{}
+	}
+	response.WriteJson(w, http.StatusOK, consents)
+}
+
+func (h *OAuthHandler) revokeConsent(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.WriteError(w, http.StatusUnauthorized, errors.New("authentication required"))
+		return
+	}
+
+	err = h.UC.RevokeConsent(r.Context(), userID, r.PathValue("clientId"))
+	if errors.Is(err, usecase.ErrOAuthConsentNotFound) {
+		response.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to revoke oauth consent", slog.Any("error", err))
+		response.WriteDomainError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// withQueryParam adds key=value to the query of base.
+func withQueryParam(base, key, value string) string {
+	u, err := url.Parse(base)
+	if err != nil {
+		return base
+	}
+	q := u.Query()
+	q.Set(key, value)
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+func writeOAuthError(w http.ResponseWriter, status int, code, description string) {
+	setNoStore(w)
+	response.WriteJson(w, status, dto.OAuthErrorResponse{Error: code, ErrorDescription: description})
+}
+
+// setNoStore keeps token responses out of caches (RFC 6749 §5.1).
+func setNoStore(w http.ResponseWriter) {
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+}
@@ -0,0 +1,476 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Prashant2307200/auth-service/internal/entity"
+	"github.com/Prashant2307200/auth-service/internal/infrastructure/transport/http/middleware"
+	"github.com/Prashant2307200/auth-service/internal/usecase"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type mockOAuthUsecase struct {
+	mock.Mock
+}
+
+func (m *mockOAuthUsecase) CreateClient(ctx context.Context, adminID int64, in usecase.OAuthClientInput) (*entity.OAuthClient, string, error) {
+	args := m.Called(ctx, adminID, in)
+	if args.Get(0) == nil {
+		return nil, "", args.Error(2)
+	}
+	return args.Get(0).(*entity.OAuthClient), args.String(1), args.Error(2)
+}
+
+func (m *mockOAuthUsecase) ListClients(ctx context.Context, adminID int64) ([]*entity.OAuthClient, error) {
+	args := m.Called(ctx, adminID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*entity.OAuthClient), args.Error(1)
+}
+
+func (m *mockOAuthUsecase) DeleteClient(ctx context.Context, adminID int64, clientID string) error {
+	return m.Called(ctx, adminID, clientID).Error(0)
+}
+
+func (m *mockOAuthUsecase) AuthenticateClient(ctx context.Context, clientID, secret string) (*entity.OAuthClient, error) {
+	args := m.Called(ctx, clientID, secret)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*entity.OAuthClient), args.Error(1)
+}
+
+func (m *mockOAuthUsecase) Introspect(ctx context.Context, token, hint string) (*usecase.TokenIntrospection, error) {
+	args := m.Called(ctx, token, hint)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*usecase.TokenIntrospection), args.Error(1)
+}
+
+func (m *mockOAuthUsecase) Revoke(ctx context.Context, client *entity.OAuthClient, token, hint string) error {
+	return m.Called(ctx, client, token, hint).Error(0)
+}
+
+func (m *mockOAuthUsecase) Authorize(ctx context.Context, req usecase.AuthorizationRequest, userID int64) (*usecase.AuthorizationResult, error) {
+	args := m.Called(ctx, req, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*usecase.AuthorizationResult), args.Error(1)
+}
+
+func (m *mockOAuthUsecase) GetConsentRequest(ctx context.Context, userID int64, requestID string) (*usecase.ConsentRequest, error) {
+	args := m.Called(ctx, userID, requestID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*usecase.ConsentRequest), args.Error(1)
+}
+
+func (m *mockOAuthUsecase) DecideConsent(ctx context.Context, userID int64, requestID string, approve bool) (string, error) {
+	args := m.Called(ctx, userID, requestID, approve)
+	return args.String(0), args.Error(1)
+}
+
+func (m *mockOAuthUsecase) ExchangeAuthorizationCode(ctx context.Context, client *entity.OAuthClient, code, redirectURI, codeVerifier string) (*usecase.OAuthTokenResponse, error) {
+	args := m.Called(ctx, client, code, redirectURI, codeVerifier)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*usecase.OAuthTokenResponse), args.Error(1)
+}
+
+func (m *mockOAuthUsecase) ClientCredentials(ctx context.Context, client *entity.OAuthClient, scope string) (*usecase.OAuthTokenResponse, error) {
+	args := m.Called(ctx, client, scope)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*usecase.OAuthTokenResponse), args.Error(1)
+}
+
+func (m *mockOAuthUsecase) StartDeviceAuthorization(ctx context.Context, client *entity.OAuthClient, scope string) (*usecase.DeviceAuthorization, error) {
+	args := m.Called(ctx, client, scope)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*usecase.DeviceAuthorization), args.Error(1)
+}
+
+func (m *mockOAuthUsecase) GetDeviceRequest(ctx context.Context, userCode string) (*usecase.ConsentRequest, error) {
+	args := m.Called(ctx, userCode)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*usecase.ConsentRequest), args.Error(1)
+}
+
+func (m *mockOAuthUsecase) DecideDevice(ctx context.Context, userID int64, userCode string, approve bool) error {
+	return m.Called(ctx, userID, userCode, approve).Error(0)
+}
+
+func (m *mockOAuthUsecase) ExchangeDeviceCode(ctx context.Context, client *entity.OAuthClient, deviceCode string) (*usecase.OAuthTokenResponse, error) {
+	args := m.Called(ctx, client, deviceCode)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*usecase.OAuthTokenResponse), args.Error(1)
+}
+
+func (m *mockOAuthUsecase) ListConsents(ctx context.Context, userID int64) ([]*entity.OAuthConsent, error) {
+	args := m.Called(ctx, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*entity.OAuthConsent), args.Error(1)
+}
+
+func (m *mockOAuthUsecase) UserInfo(ctx context.Context, accessToken string) (map[string]any, error) {
+	args := m.Called(ctx, accessToken)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(map[string]any), args.Error(1)
+}
+
+func (m *mockOAuthUsecase) RevokeConsent(ctx context.Context, userID int64, clientID string) error {
+	return m.Called(ctx, userID, clientID).Error(0)
+}
+
+var testOAuthFrontend = OAuthFrontend{
+	Issuer:     "https://auth.example.com",
+	LoginURL:   "https://app.example.com/login",
+	ConsentURL: "https://app.example.com/oauth/consent",
+	DeviceURL:  "https://app.example.com/device",
+}
+
+// newTestOAuthMux serves the OAuth routes; userID, when non-zero, plays the
+// signed-in user on /oauth/authorize.
+func newTestOAuthMux(uc usecase.OAuthUsecase, userID int64) *http.ServeMux {
+	optionalAuth := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if userID != 0 {
+				r = r.WithContext(middleware.WithUserID(r.Context(), userID))
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+	mux := http.NewServeMux()
+	NewOAuthHandler(uc, testOAuthFrontend, optionalAuth).RegisterRoutes(mux)
+	return mux
+}
+
+func oauthRequest(path string, form url.Values) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return req
+}
+
+func TestOAuthHandler_IntrospectRequiresClientAuth(t *testing.T) {
+	uc := new(mockOAuthUsecase)
+	uc.On("AuthenticateClient", mock.Anything, "client", "wrong").Return(nil, usecase.ErrInvalidClient)
+	mux := newTestOAuthMux(uc, 0)
+
+	req := oauthRequest("/oauth/introspect", url.Values{"token": {"tok"}})
+	req.SetBasicAuth("client", "wrong")
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.NotEmpty(t, rec.Header().Get("WWW-Authenticate"))
+	var body map[string]string
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	assert.Equal(t, "invalid_client", body["error"])
+	uc.AssertNotCalled(t, "Introspect", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestOAuthHandler_Introspect(t *testing.T) {
+	exp := time.Unix(1_900_000_000, 0)
+	uc := new(mockOAuthUsecase)
+	// Basic credentials are form-decoded before checking.
+	uc.On("AuthenticateClient", mock.Anything, "client", "s3cret/+").Return(&entity.OAuthClient{ClientID: "client"}, nil)
+	uc.On("Introspect", mock.Anything, "tok", "access_token").Return(&usecase.TokenIntrospection{
+		Active: true, Subject: "7", TenantID: 3, ExpiresAt: exp, SessionID: "sess-1",
+	}, nil)
+	uc.On("Introspect", mock.Anything, "dead", "").Return(&usecase.TokenIntrospection{Active: false}, nil)
+	mux := newTestOAuthMux(uc, 0)
+
+	req := oauthRequest("/oauth/introspect", url.Values{"token": {"tok"}, "token_type_hint": {"access_token"}})
+	req.SetBasicAuth("client", url.QueryEscape("s3cret/+"))
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "no-store", rec.Header().Get("Cache-Control"))
+	assert.JSONEq(t, `{"active":true,"sub":"7","tenant":3,"exp":1900000000,"sid":"sess-1"}`, rec.Body.String())
+
+	// client_secret_post works too, and inactive tokens report nothing else.
+	req = oauthRequest("/oauth/introspect", url.Values{"token": {"dead"}, "client_id": {"client"}, "client_secret": {"s3cret/+"}})
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"active":false}`, rec.Body.String())
+}
+
+func TestOAuthHandler_Revoke(t *testing.T) {
+	uc := new(mockOAuthUsecase)
+	client := &entity.OAuthClient{ClientID: "client"}
+	uc.On("AuthenticateClient", mock.Anything, "client", "secret").Return(client, nil)
+	uc.On("Revoke", mock.Anything, client, "tok", "refresh_token").Return(nil)
+	mux := newTestOAuthMux(uc, 0)
+
+	req := oauthRequest("/oauth/revoke", url.Values{"token": {"tok"}, "token_type_hint": {"refresh_token"}})
+	req.SetBasicAuth("client", "secret")
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+	uc.AssertExpectations(t)
+
+	req = oauthRequest("/oauth/revoke", url.Values{})
+	req.SetBasicAuth("client", "secret")
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	uc.On("Revoke", mock.Anything, client, "other", "").Return(usecase.ErrUnauthorizedClient)
+	req = oauthRequest("/oauth/revoke", url.Values{"token": {"other"}})
+	req.SetBasicAuth("client", "secret")
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "unauthorized_client")
+}
+
+func TestOAuthHandler_AuthorizeRedirects(t *testing.T) {
+	query := "response_type=code&client_id=spa&state=xyz&code_challenge=abc&code_challenge_method=S256"
+	want := usecase.AuthorizationRequest{ResponseType: "code", ClientID: "spa", State: "xyz", CodeChallenge: "abc", CodeChallengeMethod: "S256"}
+
+	tests := []struct {
+		name     string
+		userID   int64
+		result   *usecase.AuthorizationResult
+		err      error
+		status   int
+		location string
+	}{
+		{
+			name:     "anonymous user signs in first",
+			result:   &usecase.AuthorizationResult{LoginRequired: true},
+			status:   http.StatusFound,
+			location: "https://app.example.com/login?return_to=" + url.QueryEscape("https://auth.example.com/oauth/authorize?"+query),
+		},
+		{
+			name:     "consent screen",
+			userID:   7,
+			result:   &usecase.AuthorizationResult{ConsentRequestID: "req-1"},
+			status:   http.StatusFound,
+			location: "https://app.example.com/oauth/consent?request_id=req-1",
+		},
+		{
+			name:     "back to the client",
+			userID:   7,
+			result:   &usecase.AuthorizationResult{RedirectURL: "https://client.example.com/cb?code=c&state=xyz"},
+			status:   http.StatusFound,
+			location: "https://client.example.com/cb?code=c&state=xyz",
+		},
+		{
+			name:   "untrusted redirect uri",
+			userID: 7,
+			err:    &usecase.OAuthError{Code: "invalid_request", Description: "redirect_uri is not registered for this client"},
+			status: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uc := new(mockOAuthUsecase)
+			if tt.err != nil {
+				uc.On("Authorize", mock.Anything, want, tt.userID).Return(nil, tt.err)
+			} else {
+				uc.On("Authorize", mock.Anything, want, tt.userID).Return(tt.result, nil)
+			}
+			rec := httptest.NewRecorder()
+			newTestOAuthMux(uc, tt.userID).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/oauth/authorize?"+query, nil))
+
+			require.Equal(t, tt.status, rec.Code)
+			assert.Equal(t, tt.location, rec.Header().Get("Location"))
+		})
+	}
+}
+
+func TestOAuthHandler_Token(t *testing.T) {
+	client := &entity.OAuthClient{ClientID: "spa", Public: true}
+	uc := new(mockOAuthUsecase)
+	uc.On("AuthenticateClient", mock.Anything, "spa", "").Return(client, nil)
+	uc.On("ExchangeAuthorizationCode", mock.Anything, client, "good", "https://client.example.com/cb", "verifier").
+		Return(&usecase.OAuthTokenResponse{AccessToken: "at", TokenType: "Bearer", ExpiresIn: 900, Scope: "read"}, nil)
+	uc.On("ExchangeAuthorizationCode", mock.Anything, client, "used", "https://client.example.com/cb", "verifier").
+		Return(nil, &usecase.OAuthError{Code: "invalid_grant", Description: "authorization code is invalid or expired"})
+	mux := newTestOAuthMux(uc, 0)
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"client_id":     {"spa"},
+		"code":          {"good"},
+		"redirect_uri":  {"https://client.example.com/cb"},
+		"code_verifier": {"verifier"},
+	}
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, oauthRequest("/oauth/token", form))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "no-store", rec.Header().Get("Cache-Control"))
+	assert.JSONEq(t, `{"access_token":"at","token_type":"Bearer","expires_in":900,"scope":"read"}`, rec.Body.String())
+
+	form.Set("code", "used")
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, oauthRequest("/oauth/token", form))
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "invalid_grant")
+
+	form.Set("grant_type", "password")
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, oauthRequest("/oauth/token", form))
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "unsupported_grant_type")
+}
+
+func TestOAuthHandler_TokenClientCredentials(t *testing.T) {
+	business := int64(9)
+	client := &entity.OAuthClient{ClientID: "worker", BusinessID: &business}
+	uc := new(mockOAuthUsecase)
+	uc.On("AuthenticateClient", mock.Anything, "worker", "s3cret").Return(client, nil)
+	uc.On("ClientCredentials", mock.Anything, client, "users:read").
+		Return(&usecase.OAuthTokenResponse{AccessToken: "svc", TokenType: "Bearer", ExpiresIn: 900, Scope: "users:read"}, nil)
+	mux := newTestOAuthMux(uc, 0)
+
+	form := url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {"worker"},
+		"client_secret": {"s3cret"},
+		"scope":         {"users:read"},
+	}
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, oauthRequest("/oauth/token", form))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"access_token":"svc","token_type":"Bearer","expires_in":900,"scope":"users:read"}`, rec.Body.String())
+	uc.AssertExpectations(t)
+}
+
+func TestOAuthHandler_DeviceAuthorization(t *testing.T) {
+	client := &entity.OAuthClient{ClientID: "cli", Public: true}
+	uc := new(mockOAuthUsecase)
+	uc.On("AuthenticateClient", mock.Anything, "cli", "").Return(client, nil)
+	uc.On("StartDeviceAuthorization", mock.Anything, client, "read").
+		Return(&usecase.DeviceAuthorization{DeviceCode: "dc", UserCode: "BCDF-GHJK", ExpiresIn: 600, Interval: 5}, nil)
+	uc.On("ExchangeDeviceCode", mock.Anything, client, "dc").
+		Return(nil, &usecase.OAuthError{Code: "authorization_pending", Description: "the user has not approved the request yet"})
+	mux := newTestOAuthMux(uc, 0)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, oauthRequest("/oauth/device/code", url.Values{"client_id": {"cli"}, "scope": {"read"}}))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "no-store", rec.Header().Get("Cache-Control"))
+	assert.JSONEq(t, `{
+		"device_code": "dc",
+		"user_code": "BCDF-GHJK",
+		"verification_uri": "https://app.example.com/device",
+		"verification_uri_complete": "https://app.example.com/device?user_code=BCDF-GHJK",
+		"expires_in": 600,
+		"interval": 5
+	}`, rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, oauthRequest("/oauth/token", url.Values{
+		"grant_type":  {"urn:ietf:params:oauth:grant-type:device_code"},
+		"client_id":   {"cli"},
+		"device_code": {"dc"},
+	}))
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "authorization_pending")
+}
+
+func TestOAuthHandler_DeviceVerification(t *testing.T) {
+	uc := new(mockOAuthUsecase)
+	uc.On("GetDeviceRequest", mock.Anything, "BCDF-GHJK").
+		Return(&usecase.ConsentRequest{ClientID: "cli", ClientName: "CLI", Scopes: []string{"read"}}, nil)
+	uc.On("GetDeviceRequest", mock.Anything, "ZZZZ-ZZZZ").Return(nil, usecase.ErrUserCodeNotFound)
+	uc.On("DecideDevice", mock.Anything, int64(7), "BCDF-GHJK", true).Return(nil)
+	mux := http.NewServeMux()
+	NewOAuthHandler(uc, testOAuthFrontend, nil).RegisterConsentRoutes(mux)
+	signedIn := func(r *http.Request) *http.Request {
+		return r.WithContext(middleware.WithUserID(r.Context(), 7))
+	}
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, signedIn(httptest.NewRequest(http.MethodGet, "/device/BCDF-GHJK", nil)))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"client_id":"cli","client_name":"CLI","scopes":["read"]}`, rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, signedIn(httptest.NewRequest(http.MethodGet, "/device/ZZZZ-ZZZZ", nil)))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/device/BCDF-GHJK", nil))
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	rec = httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/device/BCDF-GHJK", strings.NewReader(`{"approve":true}`))
+	req.Header.Set("Content-Type", "application/json")
+	mux.ServeHTTP(rec, signedIn(req))
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	uc.AssertExpectations(t)
+}
+
+func TestOAuthHandler_OpenIDConfiguration(t *testing.T) {
+	rec := httptest.NewRecorder()
+	newTestOAuthMux(new(mockOAuthUsecase), 0).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/.well-known/openid-configuration", nil))
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	var doc map[string]any
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &doc))
+	assert.Equal(t, "https://auth.example.com", doc["issuer"])
+	assert.Equal(t, "https://auth.example.com/oauth/userinfo", doc["userinfo_endpoint"])
+	assert.Equal(t, "https://auth.example.com/.well-known/jwks.json", doc["jwks_uri"])
+	assert.Equal(t, []any{"S256"}, doc["code_challenge_methods_supported"])
+	assert.Equal(t, "https://auth.example.com/oauth/device/code", doc["device_authorization_endpoint"])
+}
+
+func TestOAuthHandler_UserInfo(t *testing.T) {
+	uc := new(mockOAuthUsecase)
+	uc.On("UserInfo", mock.Anything, "good").Return(map[string]any{"sub": "7", "email": "ada@example.com"}, nil)
+	uc.On("UserInfo", mock.Anything, "expired").Return(nil, usecase.ErrInvalidAccessToken)
+	uc.On("UserInfo", mock.Anything, "first-party").Return(nil, usecase.ErrInsufficientScope)
+	mux := newTestOAuthMux(uc, 0)
+
+	tests := []struct {
+		authorization string
+		status        int
+	}{
+		{"Bearer good", http.StatusOK},
+		{"bearer expired", http.StatusUnauthorized},
+		{"Bearer first-party", http.StatusForbidden},
+		{"", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/oauth/userinfo", nil)
+		if tt.authorization != "" {
+			req.Header.Set("Authorization", tt.authorization)
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		require.Equal(t, tt.status, rec.Code, tt.authorization)
+		if tt.status != http.StatusOK {
+			assert.Contains(t, rec.Header().Get("WWW-Authenticate"), "Bearer")
+		}
+	}
+}
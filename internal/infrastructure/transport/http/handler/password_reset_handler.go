@@ -6,6 +6,7 @@ import (
 	"net/http"
 
 	"github.com/Prashant2307200/auth-service/internal/infrastructure/transport/http/dto"
+	"github.com/Prashant2307200/auth-service/internal/infrastructure/transport/http/middleware"
 	"github.com/Prashant2307200/auth-service/internal/infrastructure/transport/http/utils/request"
 	"github.com/Prashant2307200/auth-service/internal/infrastructure/transport/http/utils/response"
 	"github.com/Prashant2307200/auth-service/internal/usecase"
@@ -20,8 +21,8 @@ func NewPasswordResetHandler(uc usecase.PasswordResetUsecase) *PasswordResetHand
 }
 
 func (h *PasswordResetHandler) RegisterRoutes(mux *http.ServeMux) {
-	mux.HandleFunc("POST /forgot-password", h.forgotPassword)
-	mux.HandleFunc("POST /reset-password", h.resetPassword)
+	mux.Handle("POST /forgot-password", middleware.Public(h.forgotPassword))
+	mux.Handle("POST /reset-password", middleware.Public(h.resetPassword))
 }
 
 func (h *PasswordResetHandler) forgotPassword(w http.ResponseWriter, r *http.Request) {
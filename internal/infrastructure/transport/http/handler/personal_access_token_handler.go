@@ -0,0 +1,104 @@
+package handler
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/Prashant2307200/auth-service/internal/entity"
+	"github.com/Prashant2307200/auth-service/internal/infrastructure/transport/http/dto"
+	"github.com/Prashant2307200/auth-service/internal/infrastructure/transport/http/middleware"
+	"github.com/Prashant2307200/auth-service/internal/infrastructure/transport/http/utils/request"
+	"github.com/Prashant2307200/auth-service/internal/infrastructure/transport/http/utils/response"
+	"github.com/Prashant2307200/auth-service/internal/usecase"
+)
+
+type PersonalAccessTokenHandler struct {
+	UC usecase.PersonalAccessTokenUsecase
+}
+
+func NewPersonalAccessTokenHandler(uc usecase.PersonalAccessTokenUsecase) *PersonalAccessTokenHandler {
+	return &PersonalAccessTokenHandler{UC: uc}
+}
+
+// RegisterRoutes mounts the signed-in user's management of their personal
+// access tokens. The tokens themselves cannot reach these routes.
+func (h *PersonalAccessTokenHandler) RegisterRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("GET /tokens", h.list)
+	mux.HandleFunc("POST /tokens", h.create)
+	mux.HandleFunc("DELETE /tokens/{id}", h.revoke)
+}
+
+func (h *PersonalAccessTokenHandler) list(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.WriteError(w, http.StatusUnauthorized, errors.New("authentication required"))
+		return
+	}
+
+	tokens, err := h.UC.List(r.Context(), userID)
+	if err != nil {
+		slog.Error("Failed to list personal access tokens", slog.Any("error", err))
+		response.WriteDomainError(w, err)
+		return
+	}
+	if tokens == nil {
+		tokens = []*entity.PersonalAccessToken{}
+	}
+	response.WriteJson(w, http.StatusOK, tokens)
+}
+
+func (h *PersonalAccessTokenHandler) create(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.WriteError(w, http.StatusUnauthorized, errors.New("authentication required"))
+		return
+	}
+
+	req, err := request.ParseJSON[dto.PersonalAccessTokenCreateRequest](r)
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	pat, token, err := h.UC.Create(r.Context(), userID, usecase.PersonalAccessTokenInput{
+		Name:       req.Name,
+		Scopes:     req.Scopes,
+		BusinessID: req.BusinessID,
+		ExpiresAt:  req.ExpiresAt,
+	})
+	if err != nil {
+		slog.Error("Failed to create personal access token", slog.Any("error", err))
+		response.WriteDomainError(w, err)
+		return
+	}
+	setNoStore(w)
+	response.WriteJson(w, http.StatusCreated, dto.PersonalAccessTokenCreatedResponse{PersonalAccessToken: pat, Token: token})
+}
+
+func (h *PersonalAccessTokenHandler) revoke(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.WriteError(w, http.StatusUnauthorized, errors.New("authentication required"))
+		return
+	}
+
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, errors.New("invalid token id"))
+		return
+	}
+
+	err = h.UC.Revoke(r.Context(), userID, id)
+	if errors.Is(err, usecase.ErrPersonalAccessTokenNotFound) {
+		response.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to revoke personal access token", slog.Any("error", err))
+		response.WriteDomainError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
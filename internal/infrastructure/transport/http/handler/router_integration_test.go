@@ -47,9 +47,11 @@ func buildTestMux(t *testing.T) http.Handler {
 	authHandler := NewAuthHandler(authUC, "test")
 	authRouter := http.NewServeMux()
 	authHandler.RegisterRoutes(authRouter)
+	publicRoutes := middleware.NewPublicRoutes()
+	publicRoutes.Mount("/api/v1/auth", authRouter)
 	router.Handle("/auth/", http.StripPrefix("/auth", authRouter))
 
-	authMiddleware := middleware.Authenticate(tokenService, "test")
+	authMiddleware := middleware.Authenticate(tokenService, nil, middleware.AuthConfig{Public: publicRoutes})
 	apiHandler := authMiddleware(http.StripPrefix("/api/v1", router))
 
 	healthUC := usecase.NewHealthUseCase(userRepo, nil)
@@ -117,9 +119,11 @@ func TestRouterIntegration_ProtectedRouteSucceedsWithValidToken(t *testing.T) {
 	authHandler := NewAuthHandler(authUC, "test")
 	authRouter := http.NewServeMux()
 	authHandler.RegisterRoutes(authRouter)
+	publicRoutes := middleware.NewPublicRoutes()
+	publicRoutes.Mount("/api/v1/auth", authRouter)
 	router.Handle("/auth/", http.StripPrefix("/auth", authRouter))
 
-	authMiddleware := middleware.Authenticate(tokenService, "test")
+	authMiddleware := middleware.Authenticate(tokenService, nil, middleware.AuthConfig{Public: publicRoutes})
 	apiHandler := authMiddleware(http.StripPrefix("/api/v1", router))
 	healthUC := usecase.NewHealthUseCase(userRepo, nil)
 	healthHandler := NewHealthHandler(healthUC)
@@ -0,0 +1,324 @@
+package handler
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/Prashant2307200/auth-service/internal/entity"
+	"github.com/Prashant2307200/auth-service/internal/infrastructure/transport/http/dto"
+	"github.com/Prashant2307200/auth-service/internal/infrastructure/transport/http/middleware"
+	"github.com/Prashant2307200/auth-service/internal/infrastructure/transport/http/utils/request"
+	"github.com/Prashant2307200/auth-service/internal/infrastructure/transport/http/utils/response"
+	"github.com/Prashant2307200/auth-service/internal/usecase"
+)
+
+// maxSAMLResponseSize bounds the form posted to the assertion consumer
+// service.
+const maxSAMLResponseSize = 2 << 20
+
+// samlRequestCookie holds the ID of the AuthnRequest the browser started
+// until the identity provider posts its answer; a Response must answer it.
+const samlRequestCookie = "saml_request"
+
+type SAMLHandler struct {
+	UC      usecase.SAMLUsecase
+	BaseURL string
+	Cookies *response.Cookies
+}
+
+func NewSAMLHandler(uc usecase.SAMLUsecase, env, baseURL string) *SAMLHandler {
+	return &SAMLHandler{UC: uc, BaseURL: baseURL, Cookies: response.NewCookies(env, nil)}
+}
+
+// RegisterRoutes adds the sign-in endpoints under /auth. The identity
+// provider's browser posts and redirects are public; they carry their own
+// signatures.
+func (h *SAMLHandler) RegisterRoutes(mux *http.ServeMux) {
+	mux.Handle("GET /saml/login", middleware.Public(h.loginForEmail))
+	mux.Handle("GET /saml/{id}/metadata", middleware.Public(h.metadata))
+	mux.Handle("GET /saml/{id}/login", middleware.Public(h.login))
+	mux.Handle("POST /saml/{id}/acs", middleware.Public(h.acs))
+	mux.Handle("GET /saml/{id}/slo", middleware.Public(h.slo))
+	mux.HandleFunc("POST /saml/{id}/logout", h.logout)
+}
+
+// RegisterBusinessRoutes adds connection management for business admins
+// under /business.
+func (h *SAMLHandler) RegisterBusinessRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("GET /{id}/saml/", h.getConnection)
+	mux.HandleFunc("PUT /{id}/saml/", h.configure)
+	mux.HandleFunc("DELETE /{id}/saml/", h.deleteConnection)
+}
+
+func samlBusinessID(r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	return id, err == nil && id > 0
+}
+
+func (h *SAMLHandler) metadata(w http.ResponseWriter, r *http.Request) {
+	businessID, ok := samlBusinessID(r)
+	if !ok {
+		response.WriteError(w, http.StatusNotFound, usecase.ErrSAMLNotConfigured)
+		return
+	}
+	md, err := h.UC.Metadata(r.Context(), businessID)
+	if errors.Is(err, usecase.ErrSAMLNotConfigured) {
+		response.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to build SAML metadata", slog.Int64("business_id", businessID), slog.Any("error", err))
+		response.WriteDomainError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/samlmetadata+xml")
+	_, _ = w.Write(md)
+}
+
+func (h *SAMLHandler) login(w http.ResponseWriter, r *http.Request) {
+	businessID, ok := samlBusinessID(r)
+	if !ok {
+		response.WriteError(w, http.StatusNotFound, usecase.ErrSAMLNotConfigured)
+		return
+	}
+	authURL, requestID, err := h.UC.BeginLogin(r.Context(), businessID)
+	h.redirectToIdP(w, r, authURL, requestID, err)
+}
+
+// loginForEmail sends the user to the identity provider of the business
+// that verified their email's domain.
+func (h *SAMLHandler) loginForEmail(w http.ResponseWriter, r *http.Request) {
+	email := strings.TrimSpace(r.URL.Query().Get("email"))
+	if email == "" {
+		response.WriteError(w, http.StatusBadRequest, errors.New("email is required"))
+		return
+	}
+	authURL, requestID, err := h.UC.BeginLoginForEmail(r.Context(), email)
+	h.redirectToIdP(w, r, authURL, requestID, err)
+}
+
+func (h *SAMLHandler) redirectToIdP(w http.ResponseWriter, r *http.Request, authURL, requestID string, err error) {
+	if errors.Is(err, usecase.ErrSAMLNotConfigured) {
+		response.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		slog.Error("Error starting SAML login", slog.Any("error", err))
+		h.redirectWithError(w, r, "server_error")
+		return
+	}
+	// The identity provider posts its answer cross-site.
+	h.Cookies.SetCrossSite(w, samlRequestCookie, requestID, usecase.SSOLoginTTL)
+	http.Redirect(w, r, authURL, http.StatusSeeOther)
+}
+
+// acs is the assertion consumer service the identity provider posts its
+// Response to.
+func (h *SAMLHandler) acs(w http.ResponseWriter, r *http.Request) {
+	businessID, ok := samlBusinessID(r)
+	if !ok {
+		h.redirectWithError(w, r, "authentication_failed")
+		return
+	}
+	requestID, _ := h.Cookies.Read(r, samlRequestCookie)
+	h.Cookies.ClearCrossSite(w, samlRequestCookie)
+	r.Body = http.MaxBytesReader(w, r.Body, maxSAMLResponseSize)
+	if err := r.ParseForm(); err != nil || r.PostForm.Get("SAMLResponse") == "" {
+		h.redirectWithError(w, r, "authentication_failed")
+		return
+	}
+
+	accessToken, refreshToken, _, isNewUser, err := h.UC.HandleResponse(r.Context(), businessID, r.PostForm.Get("SAMLResponse"), requestID)
+	var mfaErr *usecase.MFARequiredError
+	if errors.As(err, &mfaErr) {
+		h.Cookies.SetMFAToken(w, mfaErr.Token, usecase.MFAChallengeTTL)
+		http.Redirect(w, r, h.BaseURL+"/auth/callback?mfa_required=true&mfa_methods="+url.QueryEscape(strings.Join(mfaErr.Methods, ",")), http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		slog.Error("Error handling SAML response", slog.Int64("business_id", businessID), slog.Any("error", err))
+		switch {
+		case errors.Is(err, usecase.ErrSAMLAuthFailed), errors.Is(err, usecase.ErrSAMLNotConfigured):
+			h.redirectWithError(w, r, "authentication_failed")
+		case errors.Is(err, usecase.ErrSSOEmailMissing):
+			h.redirectWithError(w, r, "email_required")
+		case errors.Is(err, usecase.ErrSSOAccountExists):
+			h.redirectWithError(w, r, "account_exists")
+		case errors.Is(err, usecase.ErrSAMLDomainNotVerified):
+			h.redirectWithError(w, r, "domain_not_verified")
+		default:
+			h.redirectWithError(w, r, "server_error")
+		}
+		return
+	}
+
+	h.Cookies.SetTokens(w, accessToken, refreshToken)
+	redirectURL := h.BaseURL + "/auth/callback"
+	if isNewUser {
+		redirectURL += "?new_user=true"
+	}
+	// 303 turns the identity provider's POST into a GET.
+	http.Redirect(w, r, redirectURL, http.StatusSeeOther)
+}
+
+// slo is the single logout service the identity provider redirects
+// LogoutRequests and LogoutResponses to.
+func (h *SAMLHandler) slo(w http.ResponseWriter, r *http.Request) {
+	businessID, ok := samlBusinessID(r)
+	if !ok {
+		response.WriteError(w, http.StatusNotFound, usecase.ErrSAMLNotConfigured)
+		return
+	}
+	next, err := h.UC.SingleLogout(r.Context(), businessID, r.URL.RawQuery)
+	switch {
+	case errors.Is(err, usecase.ErrSAMLNotConfigured):
+		response.WriteError(w, http.StatusNotFound, err)
+		return
+	case errors.Is(err, usecase.ErrSAMLAuthFailed):
+		response.WriteError(w, http.StatusBadRequest, err)
+		return
+	case err != nil:
+		slog.Error("Error handling SAML logout", slog.Int64("business_id", businessID), slog.Any("error", err))
+		response.WriteDomainError(w, err)
+		return
+	}
+	if next == "" {
+		next = h.BaseURL + "/login"
+	}
+	http.Redirect(w, r, next, http.StatusSeeOther)
+}
+
+// logout signs the user out here and returns where to sign them out at the
+// identity provider.
+func (h *SAMLHandler) logout(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.WriteError(w, http.StatusUnauthorized, errors.New("authentication required"))
+		return
+	}
+	businessID, ok := samlBusinessID(r)
+	if !ok {
+		response.WriteError(w, http.StatusNotFound, usecase.ErrSAMLNotConfigured)
+		return
+	}
+
+	refreshToken, _ := h.Cookies.Read(r, response.RefreshTokenCookie)
+	logoutURL, err := h.UC.Logout(r.Context(), userID, businessID, refreshToken)
+	if err != nil {
+		slog.Error("Failed to logout user", slog.Int64("user_id", userID), slog.Any("error", err))
+		response.WriteDomainError(w, err)
+		return
+	}
+
+	h.Cookies.DeleteTokens(w)
+	setNoStore(w)
+	response.WriteJson(w, http.StatusOK, dto.SAMLLogoutResponse{LogoutURL: logoutURL})
+}
+
+func (h *SAMLHandler) getConnection(w http.ResponseWriter, r *http.Request) {
+	requesterID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.WriteError(w, http.StatusUnauthorized, errors.New("authentication required"))
+		return
+	}
+	businessID, err := request.ParseId(r)
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	conn, err := h.UC.GetConnection(r.Context(), requesterID, businessID)
+	if err != nil {
+		h.writeConnectionError(w, err)
+		return
+	}
+	response.WriteJson(w, http.StatusOK, h.connectionResponse(conn))
+}
+
+func (h *SAMLHandler) configure(w http.ResponseWriter, r *http.Request) {
+	requesterID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.WriteError(w, http.StatusUnauthorized, errors.New("authentication required"))
+		return
+	}
+	businessID, err := request.ParseId(r)
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	req, err := request.ParseJSON[dto.SAMLConnectionRequest](r)
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	conn, err := h.UC.Configure(r.Context(), requesterID, businessID, &entity.SAMLConnection{
+		IdPEntityID:       req.IdPEntityID,
+		IdPSSOURL:         req.IdPSSOURL,
+		IdPSLOURL:         req.IdPSLOURL,
+		IdPCertificate:    req.IdPCertificate,
+		EmailAttribute:    req.EmailAttribute,
+		UsernameAttribute: req.UsernameAttribute,
+		DefaultRole:       req.DefaultRole,
+		Enabled:           req.Enabled,
+	}, []byte(req.MetadataXML))
+	if err != nil {
+		h.writeConnectionError(w, err)
+		return
+	}
+	response.WriteJson(w, http.StatusOK, h.connectionResponse(conn))
+}
+
+func (h *SAMLHandler) deleteConnection(w http.ResponseWriter, r *http.Request) {
+	requesterID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.WriteError(w, http.StatusUnauthorized, errors.New("authentication required"))
+		return
+	}
+	businessID, err := request.ParseId(r)
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := h.UC.DeleteConnection(r.Context(), requesterID, businessID); err != nil {
+		h.writeConnectionError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *SAMLHandler) connectionResponse(conn *entity.SAMLConnection) dto.SAMLConnectionResponse {
+	endpoints := h.UC.Endpoints(conn.BusinessID)
+	return dto.SAMLConnectionResponse{
+		Connection: conn,
+		ServiceProvider: dto.SAMLServiceProvider{
+			EntityID:    endpoints.EntityID,
+			MetadataURL: endpoints.MetadataURL,
+			ACSURL:      endpoints.ACSURL,
+			SLOURL:      endpoints.SLOURL,
+		},
+	}
+}
+
+func (h *SAMLHandler) writeConnectionError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, usecase.ErrSAMLNotAllowed):
+		response.WriteError(w, http.StatusForbidden, err)
+	case errors.Is(err, usecase.ErrSAMLNotConfigured):
+		response.WriteError(w, http.StatusNotFound, err)
+	case errors.Is(err, usecase.ErrSAMLInvalidConfig):
+		response.WriteError(w, http.StatusBadRequest, err)
+	default:
+		slog.Error("Failed to manage SAML connection", slog.Any("error", err))
+		response.WriteDomainError(w, err)
+	}
+}
+
+func (h *SAMLHandler) redirectWithError(w http.ResponseWriter, r *http.Request, errorCode string) {
+	http.Redirect(w, r, h.BaseURL+"/auth/callback?error="+errorCode, http.StatusSeeOther)
+}
@@ -0,0 +1,81 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/Prashant2307200/auth-service/internal/entity"
+	"github.com/Prashant2307200/auth-service/internal/usecase"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSAMLUsecase starts logins with request ID "id-1" and accepts only
+// Responses presented with it.
+type fakeSAMLUsecase struct {
+	usecase.SAMLUsecase
+	gotRequestID string
+}
+
+func (f *fakeSAMLUsecase) BeginLogin(context.Context, int64) (string, string, error) {
+	return "https://idp.example.com/sso?SAMLRequest=x", "id-1", nil
+}
+
+func (f *fakeSAMLUsecase) HandleResponse(_ context.Context, _ int64, _ string, requestID string) (string, string, *entity.User, bool, error) {
+	f.gotRequestID = requestID
+	if requestID != "id-1" {
+		return "", "", nil, false, usecase.ErrSAMLAuthFailed
+	}
+	return "access", "refresh", &entity.User{ID: 1}, false, nil
+}
+
+func TestSAMLHandler_ACSRequiresTheBrowsersRequest(t *testing.T) {
+	uc := &fakeSAMLUsecase{}
+	h := NewSAMLHandler(uc, "dev", "https://app.example.com")
+	mux := http.NewServeMux()
+	h.RegisterRoutes(mux)
+
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/saml/1/login", nil))
+	require.Equal(t, http.StatusSeeOther, rr.Code)
+	var requestCookie *http.Cookie
+	for _, c := range rr.Result().Cookies() {
+		if c.Name == samlRequestCookie {
+			requestCookie = c
+		}
+	}
+	require.NotNil(t, requestCookie)
+	assert.Equal(t, http.SameSiteNoneMode, requestCookie.SameSite)
+
+	post := func(cookie *http.Cookie) *httptest.ResponseRecorder {
+		form := url.Values{"SAMLResponse": {"response"}}
+		req := httptest.NewRequest(http.MethodPost, "/saml/1/acs", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if cookie != nil {
+			req.AddCookie(&http.Cookie{Name: cookie.Name, Value: cookie.Value})
+		}
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// Posted from a browser that did not start the login.
+	rr = post(nil)
+	assert.Equal(t, "", uc.gotRequestID)
+	assert.Contains(t, rr.Header().Get("Location"), "error=authentication_failed")
+
+	rr = post(requestCookie)
+	assert.Equal(t, "id-1", uc.gotRequestID)
+	assert.Equal(t, "https://app.example.com/auth/callback", rr.Header().Get("Location"))
+	cleared := false
+	for _, c := range rr.Result().Cookies() {
+		if c.Name == samlRequestCookie && c.MaxAge < 0 {
+			cleared = true
+		}
+	}
+	assert.True(t, cleared, "request cookie not cleared")
+}
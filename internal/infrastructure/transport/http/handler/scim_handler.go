@@ -0,0 +1,385 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/Prashant2307200/auth-service/internal/entity"
+	"github.com/Prashant2307200/auth-service/internal/infrastructure/transport/http/dto"
+	"github.com/Prashant2307200/auth-service/internal/infrastructure/transport/http/middleware"
+	"github.com/Prashant2307200/auth-service/internal/infrastructure/transport/http/utils/request"
+	"github.com/Prashant2307200/auth-service/internal/infrastructure/transport/http/utils/response"
+	"github.com/Prashant2307200/auth-service/internal/usecase"
+	"github.com/Prashant2307200/auth-service/pkg/scim"
+)
+
+// maxSCIMBodySize bounds SCIM request bodies; a group replacement lists
+// every member.
+const maxSCIMBodySize = 1 << 20
+
+type SCIMHandler struct {
+	UC usecase.SCIMUsecase
+}
+
+func NewSCIMHandler(uc usecase.SCIMUsecase) *SCIMHandler {
+	return &SCIMHandler{UC: uc}
+}
+
+// scimHandlerFunc serves a SCIM request authenticated as client.
+type scimHandlerFunc func(w http.ResponseWriter, r *http.Request, client *entity.SCIMToken)
+
+// RegisterRoutes adds the SCIM 2.0 API under /scim/v2. Its routes are
+// public to Authenticate; they take the business's SCIM token instead.
+func (h *SCIMHandler) RegisterRoutes(mux *http.ServeMux) {
+	mux.Handle("GET /ServiceProviderConfig", middleware.Public(h.authenticated(h.serviceProviderConfig)))
+	mux.Handle("GET /ResourceTypes", middleware.Public(h.authenticated(h.resourceTypes)))
+
+	mux.Handle("GET /Users", middleware.Public(h.authenticated(h.listUsers)))
+	mux.Handle("POST /Users", middleware.Public(h.authenticated(h.createUser)))
+	mux.Handle("GET /Users/{id}", middleware.Public(h.authenticated(h.getUser)))
+	mux.Handle("PUT /Users/{id}", middleware.Public(h.authenticated(h.replaceUser)))
+	mux.Handle("PATCH /Users/{id}", middleware.Public(h.authenticated(h.patchUser)))
+	mux.Handle("DELETE /Users/{id}", middleware.Public(h.authenticated(h.deleteUser)))
+
+	mux.Handle("GET /Groups", middleware.Public(h.authenticated(h.listGroups)))
+	mux.Handle("POST /Groups", middleware.Public(h.authenticated(h.createGroup)))
+	mux.Handle("GET /Groups/{id}", middleware.Public(h.authenticated(h.getGroup)))
+	mux.Handle("PUT /Groups/{id}", middleware.Public(h.authenticated(h.replaceGroup)))
+	mux.Handle("PATCH /Groups/{id}", middleware.Public(h.authenticated(h.patchGroup)))
+	mux.Handle("DELETE /Groups/{id}", middleware.Public(h.authenticated(h.deleteGroup)))
+}
+
+// RegisterBusinessRoutes adds token management for business admins under
+// /business.
+func (h *SCIMHandler) RegisterBusinessRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("GET /{id}/scim/token", h.getToken)
+	mux.HandleFunc("POST /{id}/scim/token", h.createToken)
+	mux.HandleFunc("DELETE /{id}/scim/token", h.revokeToken)
+}
+
+func (h *SCIMHandler) authenticated(next scimHandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, ok := request.BearerToken(r)
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="scim"`)
+			writeSCIMError(w, scim.NewError(http.StatusUnauthorized, "", "authentication required"))
+			return
+		}
+		client, err := h.UC.Authenticate(r.Context(), token)
+		if err != nil {
+			if errors.Is(err, usecase.ErrInvalidSCIMToken) {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="scim", error="invalid_token"`)
+			}
+			h.writeError(w, err)
+			return
+		}
+		next(w, r, client)
+	}
+}
+
+func (h *SCIMHandler) serviceProviderConfig(w http.ResponseWriter, r *http.Request, _ *entity.SCIMToken) {
+	writeSCIM(w, http.StatusOK, scim.ServiceProviderConfig(""))
+}
+
+func (h *SCIMHandler) resourceTypes(w http.ResponseWriter, r *http.Request, _ *entity.SCIMToken) {
+	types := scim.ResourceTypes(h.UC.BaseURL())
+	writeSCIM(w, http.StatusOK, scim.Page(types, scim.ListQuery{StartIndex: 1, Count: len(types)}))
+}
+
+func (h *SCIMHandler) listUsers(w http.ResponseWriter, r *http.Request, client *entity.SCIMToken) {
+	list, err := h.UC.ListUsers(r.Context(), client, scim.ParseListQuery(r))
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	writeSCIM(w, http.StatusOK, list)
+}
+
+func (h *SCIMHandler) getUser(w http.ResponseWriter, r *http.Request, client *entity.SCIMToken) {
+	user, err := h.UC.GetUser(r.Context(), client, r.PathValue("id"))
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	writeSCIMResource(w, r, http.StatusOK, user, user.Meta)
+}
+
+func (h *SCIMHandler) createUser(w http.ResponseWriter, r *http.Request, client *entity.SCIMToken) {
+	var in scim.User
+	if !decodeSCIM(w, r, &in) {
+		return
+	}
+	user, err := h.UC.CreateUser(r.Context(), client, &in)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	writeSCIMResource(w, r, http.StatusCreated, user, user.Meta)
+}
+
+func (h *SCIMHandler) replaceUser(w http.ResponseWriter, r *http.Request, client *entity.SCIMToken) {
+	var in scim.User
+	if !decodeSCIM(w, r, &in) {
+		return
+	}
+	user, err := h.UC.ReplaceUser(r.Context(), client, r.PathValue("id"), &in, r.Header.Get("If-Match"))
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	writeSCIMResource(w, r, http.StatusOK, user, user.Meta)
+}
+
+func (h *SCIMHandler) patchUser(w http.ResponseWriter, r *http.Request, client *entity.SCIMToken) {
+	var in scim.PatchRequest
+	if !decodeSCIM(w, r, &in) {
+		return
+	}
+	user, err := h.UC.PatchUser(r.Context(), client, r.PathValue("id"), in.Operations, r.Header.Get("If-Match"))
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	writeSCIMResource(w, r, http.StatusOK, user, user.Meta)
+}
+
+func (h *SCIMHandler) deleteUser(w http.ResponseWriter, r *http.Request, client *entity.SCIMToken) {
+	if err := h.UC.DeleteUser(r.Context(), client, r.PathValue("id"), r.Header.Get("If-Match")); err != nil {
+		h.writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *SCIMHandler) listGroups(w http.ResponseWriter, r *http.Request, client *entity.SCIMToken) {
+	list, err := h.UC.ListGroups(r.Context(), client, scim.ParseListQuery(r))
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	if excludesMembers(r) {
+		for _, g := range list.Resources {
+			g.Members = nil
+		}
+	}
+	writeSCIM(w, http.StatusOK, list)
+}
+
+func (h *SCIMHandler) getGroup(w http.ResponseWriter, r *http.Request, client *entity.SCIMToken) {
+	group, err := h.UC.GetGroup(r.Context(), client, r.PathValue("id"))
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	if excludesMembers(r) {
+		group.Members = nil
+	}
+	writeSCIMResource(w, r, http.StatusOK, group, group.Meta)
+}
+
+func (h *SCIMHandler) createGroup(w http.ResponseWriter, r *http.Request, client *entity.SCIMToken) {
+	var in scim.Group
+	if !decodeSCIM(w, r, &in) {
+		return
+	}
+	group, err := h.UC.CreateGroup(r.Context(), client, &in)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	writeSCIMResource(w, r, http.StatusCreated, group, group.Meta)
+}
+
+func (h *SCIMHandler) replaceGroup(w http.ResponseWriter, r *http.Request, client *entity.SCIMToken) {
+	var in scim.Group
+	if !decodeSCIM(w, r, &in) {
+		return
+	}
+	group, err := h.UC.ReplaceGroup(r.Context(), client, r.PathValue("id"), &in, r.Header.Get("If-Match"))
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	writeSCIMResource(w, r, http.StatusOK, group, group.Meta)
+}
+
+func (h *SCIMHandler) patchGroup(w http.ResponseWriter, r *http.Request, client *entity.SCIMToken) {
+	var in scim.PatchRequest
+	if !decodeSCIM(w, r, &in) {
+		return
+	}
+	group, err := h.UC.PatchGroup(r.Context(), client, r.PathValue("id"), in.Operations, r.Header.Get("If-Match"))
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	if excludesMembers(r) {
+		group.Members = nil
+	}
+	writeSCIMResource(w, r, http.StatusOK, group, group.Meta)
+}
+
+func (h *SCIMHandler) deleteGroup(w http.ResponseWriter, r *http.Request, client *entity.SCIMToken) {
+	if err := h.UC.DeleteGroup(r.Context(), client, r.PathValue("id"), r.Header.Get("If-Match")); err != nil {
+		h.writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// excludesMembers reports whether the client asked to leave group members
+// out, as identity providers do to keep responses for large groups small.
+func excludesMembers(r *http.Request) bool {
+	for _, attr := range strings.Split(r.URL.Query().Get("excludedAttributes"), ",") {
+		if strings.EqualFold(strings.TrimSpace(attr), "members") {
+			return true
+		}
+	}
+	return false
+}
+
+// decodeSCIM reads a SCIM request body. Unlike request.ParseJSON it ignores
+// unknown attributes: identity providers send extension schemas this
+// service does not keep.
+func decodeSCIM(w http.ResponseWriter, r *http.Request, v any) bool {
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxSCIMBodySize)).Decode(v); err != nil {
+		writeSCIMError(w, scim.BadRequest(scim.ErrorInvalidSyntax, "invalid request body"))
+		return false
+	}
+	return true
+}
+
+func writeSCIM(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", scim.ContentType)
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("Failed to write SCIM response", slog.Any("error", err))
+	}
+}
+
+// writeSCIMResource writes a user or group along with its ETag and, once
+// created, its location. A GET whose If-None-Match matches gets a 304.
+func writeSCIMResource(w http.ResponseWriter, r *http.Request, status int, v any, meta *scim.Meta) {
+	if meta != nil {
+		w.Header().Set("ETag", meta.Version)
+		if status == http.StatusCreated {
+			w.Header().Set("Location", meta.Location)
+		}
+		if r.Method == http.MethodGet && scim.MatchETag(r.Header.Get("If-None-Match"), meta.Version) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+	writeSCIM(w, status, v)
+}
+
+func writeSCIMError(w http.ResponseWriter, err *scim.Error) {
+	writeSCIM(w, err.Status, err)
+}
+
+func (h *SCIMHandler) writeError(w http.ResponseWriter, err error) {
+	var scimErr *scim.Error
+	switch {
+	case errors.As(err, &scimErr):
+		writeSCIMError(w, scimErr)
+	case errors.Is(err, usecase.ErrInvalidSCIMToken):
+		writeSCIMError(w, scim.NewError(http.StatusUnauthorized, "", err.Error()))
+	case errors.Is(err, usecase.ErrSCIMNotFound):
+		writeSCIMError(w, scim.NewError(http.StatusNotFound, "", err.Error()))
+	case errors.Is(err, usecase.ErrSCIMPreconditionFailed):
+		writeSCIMError(w, scim.NewError(http.StatusPreconditionFailed, "", err.Error()))
+	case errors.Is(err, usecase.ErrSCIMConflict):
+		writeSCIMError(w, scim.NewError(http.StatusConflict, scim.ErrorUniqueness, err.Error()))
+	case errors.Is(err, usecase.ErrSCIMInvalidValue):
+		writeSCIMError(w, scim.BadRequest(scim.ErrorInvalidValue, "%s", err.Error()))
+	case errors.Is(err, usecase.ErrSCIMMutability):
+		writeSCIMError(w, scim.BadRequest(scim.ErrorMutability, "%s", err.Error()))
+	default:
+		slog.Error("Failed to serve SCIM request", slog.Any("error", err))
+		writeSCIMError(w, scim.NewError(http.StatusInternalServerError, "", "internal server error"))
+	}
+}
+
+func (h *SCIMHandler) getToken(w http.ResponseWriter, r *http.Request) {
+	requesterID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.WriteError(w, http.StatusUnauthorized, errors.New("authentication required"))
+		return
+	}
+	businessID, err := request.ParseId(r)
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	token, err := h.UC.GetToken(r.Context(), requesterID, businessID)
+	if err != nil {
+		h.writeTokenError(w, err)
+		return
+	}
+	response.WriteJson(w, http.StatusOK, h.tokenResponse(token, ""))
+}
+
+func (h *SCIMHandler) createToken(w http.ResponseWriter, r *http.Request) {
+	requesterID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.WriteError(w, http.StatusUnauthorized, errors.New("authentication required"))
+		return
+	}
+	businessID, err := request.ParseId(r)
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	token, raw, err := h.UC.CreateToken(r.Context(), requesterID, businessID)
+	if err != nil {
+		h.writeTokenError(w, err)
+		return
+	}
+	response.WriteJson(w, http.StatusCreated, h.tokenResponse(token, raw))
+}
+
+func (h *SCIMHandler) revokeToken(w http.ResponseWriter, r *http.Request) {
+	requesterID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.WriteError(w, http.StatusUnauthorized, errors.New("authentication required"))
+		return
+	}
+	businessID, err := request.ParseId(r)
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := h.UC.RevokeToken(r.Context(), requesterID, businessID); err != nil {
+		h.writeTokenError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *SCIMHandler) tokenResponse(token *entity.SCIMToken, raw string) dto.SCIMTokenResponse {
+	return dto.SCIMTokenResponse{
+		Token:      raw,
+		BaseURL:    h.UC.BaseURL(),
+		CreatedAt:  token.CreatedAt,
+		LastUsedAt: token.LastUsedAt,
+	}
+}
+
+func (h *SCIMHandler) writeTokenError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, usecase.ErrSCIMNotAllowed):
+		response.WriteError(w, http.StatusForbidden, err)
+	case errors.Is(err, usecase.ErrSCIMNotEnabled):
+		response.WriteError(w, http.StatusNotFound, err)
+	default:
+		slog.Error("Failed to manage SCIM token", slog.Any("error", err))
+		response.WriteDomainError(w, err)
+	}
+}
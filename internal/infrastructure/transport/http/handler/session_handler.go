@@ -7,16 +7,16 @@ import (
 
 	"github.com/Prashant2307200/auth-service/internal/infrastructure/transport/http/middleware"
 	"github.com/Prashant2307200/auth-service/internal/infrastructure/transport/http/utils/response"
-	"github.com/Prashant2307200/auth-service/internal/service"
+	"github.com/Prashant2307200/auth-service/internal/usecase"
 )
 
 type SessionHandler struct {
-	SessionSvc *service.SessionService
-	ENV        string
+	UC  *usecase.AuthUseCase
+	ENV string
 }
 
-func NewSessionHandler(sessionSvc *service.SessionService, env string) *SessionHandler {
-	return &SessionHandler{SessionSvc: sessionSvc, ENV: env}
+func NewSessionHandler(uc *usecase.AuthUseCase, env string) *SessionHandler {
+	return &SessionHandler{UC: uc, ENV: env}
 }
 
 func (h *SessionHandler) RegisterRoutes(mux *http.ServeMux) {
@@ -32,9 +32,9 @@ func (h *SessionHandler) listSessions(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	currentSessionID := getCurrentSessionID(r)
+	currentSessionID := middleware.GetSessionIDFromContext(r.Context())
 
-	sessions, err := h.SessionSvc.ListUserSessions(r.Context(), userID)
+	sessions, err := h.UC.ListSessions(r.Context(), userID)
 	if err != nil {
 		slog.Error("Error listing sessions", slog.Any("error", err))
 		response.WriteError(w, http.StatusInternalServerError, errors.New("failed to list sessions"))
@@ -84,13 +84,13 @@ func (h *SessionHandler) revokeSession(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	currentSessionID := getCurrentSessionID(r)
+	currentSessionID := middleware.GetSessionIDFromContext(r.Context())
 	if sessionID == currentSessionID {
 		response.WriteError(w, http.StatusBadRequest, errors.New("cannot revoke current session"))
 		return
 	}
 
-	err = h.SessionSvc.RevokeSession(r.Context(), userID, sessionID)
+	err = h.UC.RevokeSession(r.Context(), userID, sessionID)
 	if err != nil {
 		slog.Error("Error revoking session", slog.Any("error", err))
 		response.WriteError(w, http.StatusInternalServerError, errors.New("failed to revoke session"))
@@ -107,9 +107,9 @@ func (h *SessionHandler) revokeAllSessions(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	currentSessionID := getCurrentSessionID(r)
+	currentSessionID := middleware.GetSessionIDFromContext(r.Context())
 
-	err = h.SessionSvc.RevokeAllSessions(r.Context(), userID, currentSessionID)
+	err = h.UC.RevokeOtherSessions(r.Context(), userID, currentSessionID)
 	if err != nil {
 		slog.Error("Error revoking all sessions", slog.Any("error", err))
 		response.WriteError(w, http.StatusInternalServerError, errors.New("failed to revoke sessions"))
@@ -118,11 +118,3 @@ func (h *SessionHandler) revokeAllSessions(w http.ResponseWriter, r *http.Reques
 
 	response.WriteSuccess(w, http.StatusOK, "All other sessions revoked", nil)
 }
-
-func getCurrentSessionID(r *http.Request) string {
-	cookie, err := r.Cookie("session_id")
-	if err != nil {
-		return ""
-	}
-	return cookie.Value
-}
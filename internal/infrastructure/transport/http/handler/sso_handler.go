@@ -1,13 +1,19 @@
 package handler
 
 import (
-	"crypto/rand"
-	"encoding/base64"
 	"errors"
+	"io"
 	"log/slog"
 	"net/http"
-	"time"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
 
+	"github.com/Prashant2307200/auth-service/internal/entity"
+	"github.com/Prashant2307200/auth-service/internal/infrastructure/transport/http/dto"
+	"github.com/Prashant2307200/auth-service/internal/infrastructure/transport/http/middleware"
+	"github.com/Prashant2307200/auth-service/internal/infrastructure/transport/http/utils/request"
 	"github.com/Prashant2307200/auth-service/internal/infrastructure/transport/http/utils/response"
 	"github.com/Prashant2307200/auth-service/internal/usecase"
 )
@@ -16,80 +22,121 @@ type SSOHandler struct {
 	UC      usecase.SSOUsecase
 	ENV     string
 	BaseURL string
+	Cookies *response.Cookies
+	// OptionalAuth identifies the signed-in user on the callback, which must
+	// be the user who started linking an identity. Without it linking fails.
+	OptionalAuth func(http.Handler) http.Handler
 }
 
+// oauthStateCookie holds the sign-in in progress at the identity provider
+// until the callback.
+const oauthStateCookie = "oauth_state"
+
 func NewSSOHandler(uc usecase.SSOUsecase, env, baseURL string) *SSOHandler {
-	return &SSOHandler{UC: uc, ENV: env, BaseURL: baseURL}
+	return &SSOHandler{UC: uc, ENV: env, BaseURL: baseURL, Cookies: response.NewCookies(env, nil)}
 }
 
 func (h *SSOHandler) RegisterRoutes(mux *http.ServeMux) {
-	mux.HandleFunc("GET /google", h.googleRedirect)
-	mux.HandleFunc("GET /google/callback", h.googleCallback)
+	callback := h.callback
+	if h.OptionalAuth != nil {
+		callback = func(w http.ResponseWriter, r *http.Request) {
+			h.OptionalAuth(http.HandlerFunc(h.callback)).ServeHTTP(w, r)
+		}
+	}
+	mux.Handle("GET /sso/providers", middleware.Public(h.providers))
+	mux.Handle("GET /sso/{provider}", middleware.Public(h.redirect))
+	mux.Handle("GET /sso/{provider}/callback", middleware.Public(callback))
+	// The Google routes predate /sso and stay registered as redirect URLs.
+	mux.Handle("GET /google", middleware.Public(h.redirect))
+	mux.Handle("GET /google/callback", middleware.Public(callback))
+
+	mux.HandleFunc("GET /identities", h.listIdentities)
+	mux.HandleFunc("POST /identities/{provider}", h.linkIdentity)
+	mux.HandleFunc("DELETE /identities/{id}", h.unlinkIdentity)
 }
 
-func (h *SSOHandler) googleRedirect(w http.ResponseWriter, r *http.Request) {
-	state := generateStateToken()
-	
-	http.SetCookie(w, &http.Cookie{
-		Name:     "oauth_state",
-		Value:    state,
-		Path:     "/",
-		MaxAge:   int(10 * time.Minute / time.Second),
-		HttpOnly: true,
-		Secure:   h.ENV != "dev",
-		SameSite: http.SameSiteLaxMode,
-	})
+func (h *SSOHandler) providers(w http.ResponseWriter, r *http.Request) {
+	response.WriteJson(w, http.StatusOK, dto.SSOProvidersResponse{Providers: h.UC.Providers()})
+}
 
-	url := h.UC.GetGoogleAuthURL(state)
-	http.Redirect(w, r, url, http.StatusTemporaryRedirect)
+// providerName returns the provider a route is for; the legacy routes are
+// Google's.
+func providerName(r *http.Request) string {
+	if name := r.PathValue("provider"); name != "" {
+		return name
+	}
+	return "google"
 }
 
-func (h *SSOHandler) googleCallback(w http.ResponseWriter, r *http.Request) {
-	stateCookie, err := r.Cookie("oauth_state")
+func (h *SSOHandler) redirect(w http.ResponseWriter, r *http.Request) {
+	login, authURL, err := h.UC.BeginLogin(r.Context(), providerName(r))
+	if errors.Is(err, usecase.ErrUnknownIdentityProvider) {
+		response.WriteError(w, http.StatusNotFound, err)
+		return
+	}
 	if err != nil {
+		slog.Error("Error starting SSO login", slog.String("provider", providerName(r)), slog.Any("error", err))
+		h.redirectWithError(w, r, "server_error")
+		return
+	}
+
+	h.Cookies.Set(w, oauthStateCookie, encodeSSOLogin(login), usecase.SSOLoginTTL)
+	http.Redirect(w, r, authURL, http.StatusTemporaryRedirect)
+}
+
+func (h *SSOHandler) callback(w http.ResponseWriter, r *http.Request) {
+	provider := providerName(r)
+	stored, ok := h.Cookies.Read(r, oauthStateCookie)
+	if !ok {
 		slog.Error("Missing oauth state cookie")
 		h.redirectWithError(w, r, "authentication_failed")
 		return
 	}
-
-	state := r.URL.Query().Get("state")
-	if state != stateCookie.Value {
-		slog.Error("Invalid oauth state")
+	login, ok := decodeSSOLogin(stored)
+	if !ok || login.Provider != provider || r.URL.Query().Get("state") != login.State {
+		slog.Error("Invalid oauth state", slog.String("provider", provider))
 		h.redirectWithError(w, r, "authentication_failed")
 		return
 	}
 
-	http.SetCookie(w, &http.Cookie{
-		Name:     "oauth_state",
-		Value:    "",
-		Path:     "/",
-		MaxAge:   -1,
-		HttpOnly: true,
-	})
+	h.Cookies.Clear(w, oauthStateCookie)
 
 	code := r.URL.Query().Get("code")
 	if code == "" {
 		errorMsg := r.URL.Query().Get("error")
-		slog.Error("OAuth error", slog.String("error", errorMsg))
+		slog.Error("OAuth error", slog.String("provider", provider), slog.String("error", errorMsg))
 		h.redirectWithError(w, r, "authentication_failed")
 		return
 	}
 
-	accessToken, refreshToken, _, isNewUser, err := h.UC.HandleGoogleCallback(r.Context(), code)
+	if login.LinkUserID != 0 {
+		h.completeLink(w, r, login, code)
+		return
+	}
+
+	accessToken, refreshToken, _, isNewUser, err := h.UC.HandleCallback(r.Context(), login, code)
+	var mfaErr *usecase.MFARequiredError
+	if errors.As(err, &mfaErr) {
+		h.Cookies.SetMFAToken(w, mfaErr.Token, usecase.MFAChallengeTTL)
+		http.Redirect(w, r, h.BaseURL+"/auth/callback?mfa_required=true&mfa_methods="+url.QueryEscape(strings.Join(mfaErr.Methods, ",")), http.StatusTemporaryRedirect)
+		return
+	}
 	if err != nil {
-		slog.Error("Error handling Google callback", slog.Any("error", err))
+		slog.Error("Error handling SSO callback", slog.String("provider", provider), slog.Any("error", err))
 		switch {
-		case errors.Is(err, usecase.ErrGoogleAuthFailed):
+		case errors.Is(err, usecase.ErrSSOAuthFailed), errors.Is(err, usecase.ErrUnknownIdentityProvider):
 			h.redirectWithError(w, r, "authentication_failed")
-		case errors.Is(err, usecase.ErrGoogleEmailMissing):
+		case errors.Is(err, usecase.ErrSSOEmailMissing):
 			h.redirectWithError(w, r, "email_required")
+		case errors.Is(err, usecase.ErrSSOAccountExists):
+			h.redirectWithError(w, r, "account_exists")
 		default:
 			h.redirectWithError(w, r, "server_error")
 		}
 		return
 	}
 
-	response.SetTokenCookies(w, accessToken, refreshToken, h.ENV)
+	h.Cookies.SetTokens(w, accessToken, refreshToken)
 
 	redirectURL := h.BaseURL + "/auth/callback"
 	if isNewUser {
@@ -99,13 +146,153 @@ func (h *SSOHandler) googleCallback(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, redirectURL, http.StatusTemporaryRedirect)
 }
 
+// completeLink finishes linking an identity to the user who started it, who
+// must still be the one signed in.
+func (h *SSOHandler) completeLink(w http.ResponseWriter, r *http.Request, login *usecase.SSOLogin, code string) {
+	userID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil || userID != login.LinkUserID {
+		slog.Error("Identity link callback without the linking user", slog.String("provider", login.Provider))
+		h.redirectWithError(w, r, "authentication_failed")
+		return
+	}
+
+	_, err = h.UC.CompleteLink(r.Context(), login, code)
+	if err != nil {
+		slog.Error("Error linking identity", slog.String("provider", login.Provider), slog.Any("error", err))
+		switch {
+		case errors.Is(err, usecase.ErrIdentityAlreadyLinked):
+			h.redirectWithError(w, r, "identity_in_use")
+		case errors.Is(err, usecase.ErrSSOAuthFailed), errors.Is(err, usecase.ErrUnknownIdentityProvider):
+			h.redirectWithError(w, r, "authentication_failed")
+		default:
+			h.redirectWithError(w, r, "server_error")
+		}
+		return
+	}
+	http.Redirect(w, r, h.BaseURL+"/auth/callback?linked="+url.QueryEscape(login.Provider), http.StatusTemporaryRedirect)
+}
+
+func (h *SSOHandler) listIdentities(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.WriteError(w, http.StatusUnauthorized, errors.New("authentication required"))
+		return
+	}
+
+	identities, err := h.UC.ListIdentities(r.Context(), userID)
+	if err != nil {
+		slog.Error("Failed to list identities", slog.Any("error", err))
+		response.WriteDomainError(w, err)
+		return
+	}
+	if identities == nil {
+		identities = []*entity.UserIdentity{}
+	}
+	response.WriteJson(w, http.StatusOK, identities)
+}
+
+// linkIdentity starts linking a provider account to the signed-in user. The
+// browser then follows authorization_url; the provider's callback completes
+// the link.
+func (h *SSOHandler) linkIdentity(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.WriteError(w, http.StatusUnauthorized, errors.New("authentication required"))
+		return
+	}
+
+	req, err := request.ParseJSON[dto.LinkIdentityRequest](r)
+	if errors.Is(err, io.EOF) {
+		req, err = &dto.LinkIdentityRequest{}, nil
+	}
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	login, authURL, err := h.UC.BeginLink(r.Context(), userID, r.PathValue("provider"), usecase.Reauthentication{
+		SessionID: middleware.GetSessionIDFromContext(r.Context()),
+		Password:  req.Password,
+		Code:      req.Code,
+	})
+	switch {
+	case errors.Is(err, usecase.ErrUnknownIdentityProvider):
+		response.WriteError(w, http.StatusNotFound, err)
+		return
+	case errors.Is(err, usecase.ErrReauthenticationRequired):
+		response.WriteError(w, http.StatusForbidden, err)
+		return
+	case errors.Is(err, usecase.ErrMFALocked):
+		response.WriteError(w, http.StatusTooManyRequests, err)
+		return
+	case err != nil:
+		slog.Error("Failed to start identity link", slog.Any("error", err))
+		response.WriteDomainError(w, err)
+		return
+	}
+
+	h.Cookies.Set(w, oauthStateCookie, encodeSSOLogin(login), usecase.SSOLoginTTL)
+	setNoStore(w)
+	response.WriteJson(w, http.StatusOK, dto.LinkIdentityResponse{AuthorizationURL: authURL})
+}
+
+func (h *SSOHandler) unlinkIdentity(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.WriteError(w, http.StatusUnauthorized, errors.New("authentication required"))
+		return
+	}
+
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, errors.New("invalid identity id"))
+		return
+	}
+
+	err = h.UC.Unlink(r.Context(), userID, id)
+	switch {
+	case errors.Is(err, usecase.ErrIdentityNotFound):
+		response.WriteError(w, http.StatusNotFound, err)
+		return
+	case errors.Is(err, usecase.ErrLastLoginMethod):
+		response.WriteError(w, http.StatusConflict, err)
+		return
+	case err != nil:
+		slog.Error("Failed to unlink identity", slog.Any("error", err))
+		response.WriteDomainError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
 func (h *SSOHandler) redirectWithError(w http.ResponseWriter, r *http.Request, errorCode string) {
 	redirectURL := h.BaseURL + "/auth/callback?error=" + errorCode
 	http.Redirect(w, r, redirectURL, http.StatusTemporaryRedirect)
 }
 
-func generateStateToken() string {
-	b := make([]byte, 32)
-	_, _ = rand.Read(b)
-	return base64.URLEncoding.EncodeToString(b)
+// encodeSSOLogin packs login into the state cookie. None of its parts
+// contain dots: provider names are path segments, the rest base64url, hex or
+// decimal.
+func encodeSSOLogin(login *usecase.SSOLogin) string {
+	parts := []string{login.Provider, login.State, login.Nonce, login.Verifier}
+	if login.LinkUserID != 0 {
+		parts = append(parts, strconv.FormatInt(login.LinkUserID, 10))
+	}
+	return strings.Join(parts, ".")
+}
+
+func decodeSSOLogin(v string) (*usecase.SSOLogin, bool) {
+	parts := strings.Split(v, ".")
+	if len(parts) != 4 && len(parts) != 5 || slices.Contains(parts, "") {
+		return nil, false
+	}
+	login := &usecase.SSOLogin{Provider: parts[0], State: parts[1], Nonce: parts[2], Verifier: parts[3]}
+	if len(parts) == 5 {
+		id, err := strconv.ParseInt(parts[4], 10, 64)
+		if err != nil || id <= 0 {
+			return nil, false
+		}
+		login.LinkUserID = id
+	}
+	return login, true
 }
@@ -8,6 +8,7 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/Prashant2307200/auth-service/internal/entity"
 	"github.com/Prashant2307200/auth-service/internal/infrastructure/transport/http/middleware"
 	"github.com/Prashant2307200/auth-service/internal/infrastructure/transport/http/utils/response"
 	"github.com/Prashant2307200/auth-service/internal/usecase"
@@ -16,6 +17,9 @@ import (
 type TeamHandler struct {
 	UC  usecase.TeamUsecase
 	AMW func(http.Handler) http.Handler
+	// Authz checks the caller's permission in the tenant for every route;
+	// without it the routes are refused.
+	Authz middleware.PermissionAuthorizer
 }
 
 func NewTeamHandler(uc usecase.TeamUsecase, authMiddleware func(http.Handler) http.Handler) *TeamHandler {
@@ -24,11 +28,15 @@ func NewTeamHandler(uc usecase.TeamUsecase, authMiddleware func(http.Handler) ht
 
 // RegisterRoutes registers paths under /team/ (full URL: /api/v1/team/... after main router prefix).
 func (h *TeamHandler) RegisterRoutes(mux *http.ServeMux) {
-	mux.HandleFunc("POST /invite", h.invite)
-	mux.HandleFunc("GET /members", h.listMembers)
-	mux.HandleFunc("PATCH /members/{id}/role", h.updateMemberRole)
-	mux.HandleFunc("DELETE /members/{id}", h.removeMember)
-	mux.HandleFunc("POST /invites/{token}/revoke", h.revokeInvitation)
+	mux.Handle("POST /invite", h.require(entity.PermissionMembersInvite, h.invite))
+	mux.Handle("GET /members", h.require(entity.PermissionMembersRead, h.listMembers))
+	mux.Handle("PATCH /members/{id}/role", h.require(entity.PermissionMembersManage, h.updateMemberRole))
+	mux.Handle("DELETE /members/{id}", h.require(entity.PermissionMembersManage, h.removeMember))
+	mux.Handle("POST /invites/{token}/revoke", h.require(entity.PermissionMembersInvite, h.revokeInvitation))
+}
+
+func (h *TeamHandler) require(permission string, handler http.HandlerFunc) http.Handler {
+	return middleware.RequirePermission(h.Authz, permission)(handler)
 }
 
 type inviteRequest struct {
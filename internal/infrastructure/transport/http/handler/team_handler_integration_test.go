@@ -2,6 +2,7 @@ package handler
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"net/http"
@@ -11,6 +12,7 @@ import (
 	"github.com/Prashant2307200/auth-service/internal/entity"
 	"github.com/Prashant2307200/auth-service/internal/infrastructure/transport/http/middleware"
 	"github.com/Prashant2307200/auth-service/internal/testutil"
+	"github.com/Prashant2307200/auth-service/internal/usecase"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 )
@@ -153,3 +155,35 @@ func TestTeamHandler_Invite_InvalidEmail(t *testing.T) {
 	require.Equal(t, http.StatusBadRequest, rr.Code)
 	mockTeam.AssertExpectations(t)
 }
+
+type teamAuthorizer map[string]bool
+
+func (a teamAuthorizer) Authorize(_ context.Context, _, _ int64, permission string) error {
+	if !a[permission] {
+		return usecase.ErrPermissionDenied
+	}
+	return nil
+}
+
+func TestTeamHandler_RoutesRequirePermissions(t *testing.T) {
+	mockTeam := &testutil.MockTeamUsecase{}
+	mockTeam.On("ListMembers", mock.Anything, int64(55)).Return([]*entity.BusinessMember{}, nil)
+
+	h := NewTeamHandler(mockTeam, nil)
+	h.Authz = teamAuthorizer{entity.PermissionMembersRead: true}
+	mux := http.NewServeMux()
+	h.RegisterRoutes(mux)
+
+	serve := func(method, path, body string) int {
+		req := httptest.NewRequest(method, path, bytes.NewReader([]byte(body)))
+		req = middleware.WithTenantID(req.WithContext(middleware.WithUserID(req.Context(), 7)), 55)
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	require.Equal(t, http.StatusOK, serve(http.MethodGet, "/members", ""))
+	require.Equal(t, http.StatusForbidden, serve(http.MethodPost, "/invite", `{"email":"member@example.com","role":0}`))
+	require.Equal(t, http.StatusForbidden, serve(http.MethodDelete, "/members/9", ""))
+	mockTeam.AssertExpectations(t)
+}
@@ -0,0 +1,249 @@
+package handler
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/Prashant2307200/auth-service/internal/infrastructure/transport/http/dto"
+	"github.com/Prashant2307200/auth-service/internal/infrastructure/transport/http/middleware"
+	"github.com/Prashant2307200/auth-service/internal/infrastructure/transport/http/utils/request"
+	"github.com/Prashant2307200/auth-service/internal/infrastructure/transport/http/utils/response"
+	"github.com/Prashant2307200/auth-service/internal/usecase"
+)
+
+type WebAuthnHandler struct {
+	UC      usecase.WebAuthnUsecase
+	Auth    *usecase.AuthUseCase
+	ENV     string
+	Cookies *response.Cookies
+}
+
+func NewWebAuthnHandler(uc usecase.WebAuthnUsecase, auth *usecase.AuthUseCase, env string) *WebAuthnHandler {
+	return &WebAuthnHandler{UC: uc, Auth: auth, ENV: env, Cookies: response.NewCookies(env, nil)}
+}
+
+func (h *WebAuthnHandler) RegisterRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("POST /webauthn/register/begin", h.beginRegistration)
+	mux.HandleFunc("POST /webauthn/register/finish", h.finishRegistration)
+	mux.Handle("POST /webauthn/login/begin", middleware.Public(h.beginLogin))
+	mux.Handle("POST /webauthn/login/finish", middleware.Public(h.finishLogin))
+	mux.Handle("POST /webauthn/mfa/begin", middleware.Public(h.beginMFA))
+	mux.Handle("POST /webauthn/mfa/finish", middleware.Public(h.finishMFA))
+	mux.HandleFunc("GET /webauthn/credentials", h.listCredentials)
+	mux.HandleFunc("PATCH /webauthn/credentials/{id}", h.renameCredential)
+	mux.HandleFunc("DELETE /webauthn/credentials/{id}", h.deleteCredential)
+}
+
+func (h *WebAuthnHandler) beginRegistration(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.WriteError(w, http.StatusUnauthorized, errors.New("authentication required"))
+		return
+	}
+
+	opts, err := h.UC.BeginRegistration(r.Context(), userID)
+	if err != nil {
+		slog.Error("Error starting passkey registration", slog.Int64("user_id", userID), slog.Any("error", err))
+		response.WriteError(w, http.StatusInternalServerError, errors.New("failed to start passkey registration"))
+		return
+	}
+
+	response.WriteJson(w, http.StatusOK, dto.WebAuthnOptionsResponse{PublicKey: opts})
+}
+
+func (h *WebAuthnHandler) finishRegistration(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.WriteError(w, http.StatusUnauthorized, errors.New("authentication required"))
+		return
+	}
+
+	req, err := request.ParseJSON[dto.WebAuthnRegisterRequest](r)
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	cred, err := h.UC.FinishRegistration(r.Context(), userID, req.Name, &req.Credential)
+	if err != nil {
+		slog.Warn("Passkey registration failed", slog.Int64("user_id", userID), slog.Any("error", err))
+		switch {
+		case errors.Is(err, usecase.ErrWebAuthnChallengeInvalid), errors.Is(err, usecase.ErrWebAuthnVerificationFailed):
+			response.WriteError(w, http.StatusBadRequest, err)
+		default:
+			response.WriteError(w, http.StatusInternalServerError, errors.New("failed to register passkey"))
+		}
+		return
+	}
+
+	response.WriteJson(w, http.StatusCreated, cred)
+}
+
+func (h *WebAuthnHandler) beginLogin(w http.ResponseWriter, r *http.Request) {
+	var email string
+	if r.ContentLength != 0 {
+		req, err := request.ParseJSON[dto.WebAuthnLoginBeginRequest](r)
+		if err != nil {
+			response.WriteError(w, http.StatusBadRequest, err)
+			return
+		}
+		email = req.Email
+	}
+
+	opts, err := h.UC.BeginLogin(r.Context(), email)
+	if err != nil {
+		slog.Error("Error starting passkey login", slog.Any("error", err))
+		response.WriteError(w, http.StatusInternalServerError, errors.New("failed to start passkey login"))
+		return
+	}
+
+	response.WriteJson(w, http.StatusOK, dto.WebAuthnOptionsResponse{PublicKey: opts})
+}
+
+func (h *WebAuthnHandler) finishLogin(w http.ResponseWriter, r *http.Request) {
+	req, err := request.ParseJSON[dto.WebAuthnLoginRequest](r)
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	accessToken, refreshToken, err := h.Auth.LoginWithPasskey(r.Context(), &req.Credential)
+	if err != nil {
+		h.writeAssertionError(w, err)
+		return
+	}
+
+	h.Cookies.SetTokens(w, accessToken, refreshToken)
+	response.WriteSuccess(w, http.StatusOK, "user logged in successfully", nil)
+}
+
+func (h *WebAuthnHandler) beginMFA(w http.ResponseWriter, r *http.Request) {
+	req, err := request.ParseJSON[dto.WebAuthnMFABeginRequest](r)
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	opts, err := h.Auth.BeginPasskeyMFA(r.Context(), mfaTokenFrom(r, h.Cookies, req.MFAToken))
+	if err != nil {
+		h.writeAssertionError(w, err)
+		return
+	}
+
+	response.WriteJson(w, http.StatusOK, dto.WebAuthnOptionsResponse{PublicKey: opts})
+}
+
+func (h *WebAuthnHandler) finishMFA(w http.ResponseWriter, r *http.Request) {
+	req, err := request.ParseJSON[dto.WebAuthnMFARequest](r)
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	accessToken, refreshToken, err := h.Auth.CompletePasskeyMFA(r.Context(), mfaTokenFrom(r, h.Cookies, req.MFAToken), &req.Credential)
+	if err != nil {
+		h.writeAssertionError(w, err)
+		return
+	}
+
+	h.Cookies.ClearMFAToken(w)
+	h.Cookies.SetTokens(w, accessToken, refreshToken)
+	response.WriteSuccess(w, http.StatusOK, "user logged in successfully", nil)
+}
+
+func (h *WebAuthnHandler) listCredentials(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.WriteError(w, http.StatusUnauthorized, errors.New("authentication required"))
+		return
+	}
+
+	creds, err := h.UC.ListCredentials(r.Context(), userID)
+	if err != nil {
+		slog.Error("Error listing passkeys", slog.Int64("user_id", userID), slog.Any("error", err))
+		response.WriteError(w, http.StatusInternalServerError, errors.New("failed to list passkeys"))
+		return
+	}
+
+	response.WriteJson(w, http.StatusOK, creds)
+}
+
+func (h *WebAuthnHandler) renameCredential(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.WriteError(w, http.StatusUnauthorized, errors.New("authentication required"))
+		return
+	}
+	id, err := request.ParseId(r)
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	req, err := request.ParseJSON[dto.WebAuthnRenameRequest](r)
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := h.UC.RenameCredential(r.Context(), userID, id, req.Name); err != nil {
+		h.writeCredentialError(w, err)
+		return
+	}
+
+	response.WriteSuccess(w, http.StatusOK, "passkey renamed", nil)
+}
+
+func (h *WebAuthnHandler) deleteCredential(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.WriteError(w, http.StatusUnauthorized, errors.New("authentication required"))
+		return
+	}
+	id, err := request.ParseId(r)
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := h.UC.DeleteCredential(r.Context(), userID, id); err != nil {
+		h.writeCredentialError(w, err)
+		return
+	}
+
+	response.WriteSuccess(w, http.StatusOK, "passkey revoked", nil)
+}
+
+func (h *WebAuthnHandler) writeAssertionError(w http.ResponseWriter, err error) {
+	slog.Warn("Passkey assertion failed", slog.Any("error", err))
+	switch {
+	case errors.Is(err, usecase.ErrMFAChallengeInvalid), errors.Is(err, usecase.ErrMFAChallengeExhausted):
+		h.Cookies.ClearMFAToken(w)
+		response.WriteError(w, http.StatusUnauthorized, err)
+	case errors.Is(err, usecase.ErrWebAuthnChallengeInvalid), errors.Is(err, usecase.ErrWebAuthnVerificationFailed):
+		response.WriteError(w, http.StatusUnauthorized, usecase.ErrWebAuthnVerificationFailed)
+	case errors.Is(err, usecase.ErrWebAuthnCredentialNotFound):
+		response.WriteError(w, http.StatusNotFound, err)
+	default:
+		response.WriteError(w, http.StatusInternalServerError, errors.New("failed to verify passkey"))
+	}
+}
+
+func (h *WebAuthnHandler) writeCredentialError(w http.ResponseWriter, err error) {
+	if errors.Is(err, usecase.ErrWebAuthnCredentialNotFound) {
+		response.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+	slog.Error("Error updating passkey", slog.Any("error", err))
+	response.WriteError(w, http.StatusInternalServerError, errors.New("failed to update passkey"))
+}
+
+// mfaTokenFrom prefers the token in the body and falls back to the cookie
+// set after Google sign-in.
+func mfaTokenFrom(r *http.Request, cookies *response.Cookies, token string) string {
+	if token != "" {
+		return token
+	}
+	token, _ = cookies.Read(r, response.MFATokenCookie)
+	return token
+}
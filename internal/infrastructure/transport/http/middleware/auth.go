@@ -4,64 +4,175 @@ import (
 	"context"
 	"errors"
 	"net/http"
+	"strings"
 	"time"
 
+	"github.com/Prashant2307200/auth-service/internal/entity"
 	"github.com/Prashant2307200/auth-service/internal/infrastructure/transport/http/utils/response"
 	"github.com/Prashant2307200/auth-service/internal/service"
+	"github.com/Prashant2307200/auth-service/internal/usecase/interfaces"
 )
 
 type contextKey string
 
-const userContextKey = contextKey("user")
+const (
+	userContextKey    = contextKey("user")
+	sessionContextKey = contextKey("session")
+	clientContextKey  = contextKey("service_client")
+)
+
+// ServiceClient is the principal of a request made by a service client with
+// a client_credentials token. It acts on its business only.
+type ServiceClient struct {
+	ClientID   string
+	BusinessID int64
+	Scopes     []string
+}
 
-func Authenticate(tokenService *service.JWTTokenService, env string) func(http.Handler) http.Handler {
+// AuthConfig configures Authenticate.
+type AuthConfig struct {
+	// CredentialOrder lists where to look for a credential; the first one
+	// found is the one checked. Empty means DefaultCredentialOrder.
+	CredentialOrder []CredentialSource
+	// Public holds the routes that need no credentials.
+	Public *PublicRoutes
+	// Cookies reads the access token cookie. Nil means plain cookies.
+	Cookies *response.Cookies
+}
+
+// Authenticate requires a signed-in user or a service client on every route
+// but the Public ones. Users present their access token as the cookie or as
+// a Bearer token, scripts a personal access token as a Bearer token or API
+// key, and service clients their client_credentials token as a Bearer token.
+// pats may be nil, disabling personal access tokens.
+func Authenticate(tokenService *service.JWTTokenService, pats PersonalAccessTokenAuthenticator, cfg AuthConfig) func(http.Handler) http.Handler {
+	order := cfg.CredentialOrder
+	if len(order) == 0 {
+		order = DefaultCredentialOrder
+	}
+	cookies := cfg.Cookies
+	if cookies == nil {
+		cookies = response.NewCookies("", nil)
+	}
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 
 			ctxWithTimeout, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 			defer cancel()
 
-			path := r.URL.Path
-
-			publicPaths := []string{
-				"/api/v1/auth/login",
-				"/api/v1/auth/register",
-				"/api/v1/auth/refresh",
-				"/api/v1/auth/public-key",
-				"/health",
-			}
-
-			isPublic := false
-			for _, publicPath := range publicPaths {
-				if path == publicPath || path == publicPath+"/" {
-					isPublic = true
-					break
-				}
-			}
-
-			if isPublic {
+			if cfg.Public.Match(r) {
 				next.ServeHTTP(w, r.WithContext(ctxWithTimeout))
 				return
 			}
 
-			accessCookie, err := r.Cookie("access_token")
-			if err != nil {
-				response.WriteError(w, http.StatusUnauthorized, errors.New("error reading access token"))
+			source, token, found := extractCredential(r, order, cookies)
+			if !found {
+				response.WriteError(w, http.StatusUnauthorized, errors.New("authentication required"))
 				return
 			}
 
-			userID, err := tokenService.VerifyToken(ctxWithTimeout, accessCookie.Value)
+			var ctx context.Context
+			var err error
+			switch {
+			case source == CredentialCookie:
+				ctx, err = authenticateUser(ctxWithTimeout, token, tokenService)
+			case strings.HasPrefix(token, entity.PersonalAccessTokenPrefix):
+				var pat *entity.PersonalAccessToken
+				pat, err = authenticatePersonalAccessToken(ctxWithTimeout, token, pats)
+				if err == nil {
+					if denied := checkPersonalAccessTokenAccess(r, pat); denied != nil {
+						response.WriteError(w, http.StatusForbidden, denied)
+						return
+					}
+					ctx = withPersonalAccessToken(ctxWithTimeout, pat)
+				}
+			case source == CredentialBearer:
+				ctx, err = authenticateBearer(ctxWithTimeout, token, tokenService)
+			default:
+				// API keys are personal access tokens only.
+				err = errors.New("invalid token")
+			}
 			if err != nil {
-				response.WriteError(w, http.StatusUnauthorized, errors.New("invalid token"))
+				response.WriteError(w, http.StatusUnauthorized, err)
 				return
 			}
+			next.ServeHTTP(w, r.WithContext(WithCredentialSource(ctx, source)))
+		})
+	}
+}
 
-			ctx := context.WithValue(ctxWithTimeout, userContextKey, userID)
-			next.ServeHTTP(w, r.WithContext(ctx))
+// OptionalAuthenticate adds the signed-in user to the context when the
+// request carries a valid access token cookie, and otherwise passes the
+// request on unchanged. Handlers decide what an anonymous request gets.
+func OptionalAuthenticate(tokenService *service.JWTTokenService, cookies *response.Cookies) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if token, ok := credentialExtractors[CredentialCookie](r, cookies); ok {
+				if ctx, err := authenticateUser(r.Context(), token, tokenService); err == nil {
+					r = r.WithContext(WithCredentialSource(ctx, CredentialCookie))
+				}
+			}
+			next.ServeHTTP(w, r)
 		})
 	}
 }
 
+// authenticateUser verifies a user's access token and returns ctx with the
+// user and session set.
+func authenticateUser(ctx context.Context, token string, tokenService *service.JWTTokenService) (context.Context, error) {
+	claims, err := tokenService.VerifyAccessToken(ctx, token)
+	if err != nil {
+		return nil, errors.New("invalid token")
+	}
+	return withUserClaims(ctx, claims)
+}
+
+// authenticateBearer accepts a user's access token, as sent by mobile apps,
+// or a service client's token, returning ctx with the client set and the
+// tenant pinned to its business.
+func authenticateBearer(ctx context.Context, token string, tokenService *service.JWTTokenService) (context.Context, error) {
+	claims, err := tokenService.VerifyAccessToken(ctx, token)
+	if err != nil {
+		return nil, errors.New("invalid token")
+	}
+	if !claims.IsServiceClient() {
+		return withUserClaims(ctx, claims)
+	}
+	ctx = context.WithValue(ctx, clientContextKey, &ServiceClient{
+		ClientID:   claims.ClientID,
+		BusinessID: claims.BusinessID,
+		Scopes:     claims.Scopes,
+	})
+	ctx = context.WithValue(ctx, tenantIDKey, claims.BusinessID)
+	return ctx, nil
+}
+
+func withUserClaims(ctx context.Context, claims *interfaces.AccessClaims) (context.Context, error) {
+	// Tokens issued to OAuth clients are limited to their scopes and are
+	// not accepted in place of the user's own session.
+	if claims.ClientID != "" {
+		return nil, errors.New("invalid token")
+	}
+	ctx = context.WithValue(ctx, userContextKey, claims.UserID)
+	ctx = context.WithValue(ctx, sessionContextKey, claims.SessionID)
+	return ctx, nil
+}
+
+// GetServiceClientFromContext returns the service client that made the
+// request, or nil when the principal is a user.
+func GetServiceClientFromContext(ctx context.Context) *ServiceClient {
+	client, _ := ctx.Value(clientContextKey).(*ServiceClient)
+	return client
+}
+
+// WithServiceClient returns a new context with the provided service client
+// set as the principal. Useful for tests.
+func WithServiceClient(ctx context.Context, client *ServiceClient) context.Context {
+	return context.WithValue(ctx, clientContextKey, client)
+}
+
+// GetUserIDFromContext returns the signed-in user. Requests made by service
+// clients have no user and get an error.
 func GetUserIDFromContext(ctx context.Context) (int64, error) {
 	user, ok := ctx.Value(userContextKey).(int64)
 	if !ok {
@@ -70,6 +181,18 @@ func GetUserIDFromContext(ctx context.Context) (int64, error) {
 	return user, nil
 }
 
+// GetSessionIDFromContext returns the session the access token was issued to,
+// or "" for tokens issued outside a session.
+func GetSessionIDFromContext(ctx context.Context) string {
+	sessionID, _ := ctx.Value(sessionContextKey).(string)
+	return sessionID
+}
+
+// WithSessionID returns a new context with the provided session ID set.
+func WithSessionID(ctx context.Context, sessionID string) context.Context {
+	return context.WithValue(ctx, sessionContextKey, sessionID)
+}
+
 // WithUserID returns a new context with the provided user ID set.
 // Useful for tests to inject an authenticated user into request contexts.
 func WithUserID(ctx context.Context, id int64) context.Context {
@@ -2,13 +2,18 @@ package middleware
 
 import (
 	"context"
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/Prashant2307200/auth-service/internal/entity"
+	"github.com/Prashant2307200/auth-service/internal/infrastructure/transport/http/utils/response"
 	"github.com/Prashant2307200/auth-service/internal/service"
 	"github.com/Prashant2307200/auth-service/internal/testutil"
+	"github.com/Prashant2307200/auth-service/pkg/securecookie"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -65,8 +70,25 @@ func TestGetUserIDFromContext(t *testing.T) {
 	}
 }
 
+// testPublicRoutes declares the auth router's public routes the way the
+// handlers do.
+func testPublicRoutes() *PublicRoutes {
+	ok := func(w http.ResponseWriter, r *http.Request) {}
+	auth := http.NewServeMux()
+	auth.Handle("POST /register/", Public(ok))
+	auth.Handle("POST /login/", Public(ok))
+	auth.Handle("GET /refresh/", Public(ok))
+	auth.Handle("GET /public-key", Public(ok))
+	auth.HandleFunc("GET /profile/", ok)
+	public := NewPublicRoutes()
+	public.Mount("/api/v1/auth", auth)
+	return public
+}
+
 func TestAuthenticate(t *testing.T) {
 	tokenService := createTestTokenService(t)
+	userToken, err := tokenService.GenerateAccessTokenForSession(123, "sess-1")
+	require.NoError(t, err)
 
 	tests := []struct {
 		name           string
@@ -74,6 +96,8 @@ func TestAuthenticate(t *testing.T) {
 		setupRequest   func() *http.Request
 		wantStatusCode int
 		wantUserID     int64
+		wantSessionID  string
+		wantSource     CredentialSource
 	}{
 		{
 			name: "public login route",
@@ -107,6 +131,22 @@ func TestAuthenticate(t *testing.T) {
 			},
 			wantStatusCode: http.StatusOK,
 		},
+		{
+			name: "public route with another method",
+			path: "/api/v1/auth/login/",
+			setupRequest: func() *http.Request {
+				return httptest.NewRequest("DELETE", "/api/v1/auth/login/", nil)
+			},
+			wantStatusCode: http.StatusUnauthorized,
+		},
+		{
+			name: "undeclared route",
+			path: "/api/v1/auth/logout/",
+			setupRequest: func() *http.Request {
+				return httptest.NewRequest("DELETE", "/api/v1/auth/logout/", nil)
+			},
+			wantStatusCode: http.StatusUnauthorized,
+		},
 		{
 			name: "protected route without token",
 			path: "/api/v1/auth/profile/",
@@ -144,6 +184,60 @@ func TestAuthenticate(t *testing.T) {
 			},
 			wantStatusCode: http.StatusOK,
 			wantUserID:     123,
+			wantSource:     CredentialCookie,
+		},
+		{
+			name: "session token exposes its session",
+			path: "/api/v1/auth/sessions",
+			setupRequest: func() *http.Request {
+				tokenString, err := tokenService.GenerateAccessTokenForSession(123, "sess-1")
+				require.NoError(t, err)
+
+				req := httptest.NewRequest("GET", "/api/v1/auth/sessions", nil)
+				req.AddCookie(&http.Cookie{Name: "access_token", Value: tokenString})
+				return req
+			},
+			wantStatusCode: http.StatusOK,
+			wantUserID:     123,
+			wantSessionID:  "sess-1",
+			wantSource:     CredentialCookie,
+		},
+		{
+			name: "user token as bearer",
+			path: "/api/v1/auth/sessions",
+			setupRequest: func() *http.Request {
+				req := httptest.NewRequest("GET", "/api/v1/auth/sessions", nil)
+				req.Header.Set("Authorization", "Bearer "+userToken)
+				return req
+			},
+			wantStatusCode: http.StatusOK,
+			wantUserID:     123,
+			wantSessionID:  "sess-1",
+			wantSource:     CredentialBearer,
+		},
+		{
+			name: "cookie wins over bearer",
+			path: "/api/v1/auth/sessions",
+			setupRequest: func() *http.Request {
+				req := httptest.NewRequest("GET", "/api/v1/auth/sessions", nil)
+				req.AddCookie(&http.Cookie{Name: "access_token", Value: userToken})
+				req.Header.Set("Authorization", "Bearer invalid-token")
+				return req
+			},
+			wantStatusCode: http.StatusOK,
+			wantUserID:     123,
+			wantSessionID:  "sess-1",
+			wantSource:     CredentialCookie,
+		},
+		{
+			name: "user token as api key",
+			path: "/api/v1/auth/sessions",
+			setupRequest: func() *http.Request {
+				req := httptest.NewRequest("GET", "/api/v1/auth/sessions", nil)
+				req.Header.Set(APIKeyHeader, userToken)
+				return req
+			},
+			wantStatusCode: http.StatusUnauthorized,
 		},
 	}
 
@@ -152,12 +246,14 @@ func TestAuthenticate(t *testing.T) {
 			req := tt.setupRequest()
 			rr := httptest.NewRecorder()
 
-			handler := Authenticate(tokenService, "test")
+			handler := Authenticate(tokenService, nil, AuthConfig{Public: testPublicRoutes()})
 			nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 				if tt.wantUserID > 0 {
 					userID, err := GetUserIDFromContext(r.Context())
 					assert.NoError(t, err)
 					assert.Equal(t, tt.wantUserID, userID)
+					assert.Equal(t, tt.wantSessionID, GetSessionIDFromContext(r.Context()))
+					assert.Equal(t, tt.wantSource, GetCredentialSource(r.Context()))
 				}
 				w.WriteHeader(http.StatusOK)
 			})
@@ -168,3 +264,183 @@ func TestAuthenticate(t *testing.T) {
 		})
 	}
 }
+
+func TestAuthenticate_ServiceClient(t *testing.T) {
+	tokenService := createTestTokenService(t)
+	serviceToken, err := tokenService.GenerateServiceAccessToken("svc-client", 42, []string{"users:read"})
+	require.NoError(t, err)
+	tests := []struct {
+		name           string
+		token          string
+		tenantHeader   string
+		wantStatusCode int
+	}{
+		{name: "service token", token: serviceToken, wantStatusCode: http.StatusOK},
+		{name: "service token with own tenant", token: serviceToken, tenantHeader: "42", wantStatusCode: http.StatusOK},
+		{name: "service token with other tenant", token: serviceToken, tenantHeader: "7", wantStatusCode: http.StatusForbidden},
+		{name: "invalid bearer", token: "invalid-token", wantStatusCode: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/api/v1/team/members", nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			if tt.tenantHeader != "" {
+				req.Header.Set("X-Tenant-ID", tt.tenantHeader)
+			}
+			rr := httptest.NewRecorder()
+
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				client := GetServiceClientFromContext(r.Context())
+				require.NotNil(t, client)
+				assert.Equal(t, "svc-client", client.ClientID)
+				assert.Equal(t, []string{"users:read"}, client.Scopes)
+				assert.Equal(t, int64(42), GetTenantID(r))
+				_, err := GetUserIDFromContext(r.Context())
+				assert.Error(t, err)
+				w.WriteHeader(http.StatusOK)
+			})
+
+			Authenticate(tokenService, nil, AuthConfig{})(TenantFromHeader(next)).ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.wantStatusCode, rr.Code)
+		})
+	}
+}
+
+type fakePATAuthenticator map[string]*entity.PersonalAccessToken
+
+func (f fakePATAuthenticator) Authenticate(_ context.Context, token string) (*entity.PersonalAccessToken, error) {
+	if pat, ok := f[token]; ok {
+		return pat, nil
+	}
+	return nil, errors.New("unknown token")
+}
+
+func TestAuthenticate_PersonalAccessToken(t *testing.T) {
+	tokenService := createTestTokenService(t)
+	business := int64(42)
+	pats := fakePATAuthenticator{
+		"pat_users":    {ID: 1, UserID: 123, Scopes: []string{entity.ScopeUsersRead}},
+		"pat_business": {ID: 2, UserID: 123, Scopes: []string{entity.ScopeBusinessRead, entity.ScopeBusinessWrite}, BusinessID: &business},
+	}
+
+	tests := []struct {
+		name           string
+		method, path   string
+		token          string
+		apiKey         bool
+		wantStatusCode int
+	}{
+		{name: "read with read scope", method: "GET", path: "/api/v1/users/me", token: "pat_users", wantStatusCode: http.StatusOK},
+		{name: "write without write scope", method: "PUT", path: "/api/v1/users/me", token: "pat_users", wantStatusCode: http.StatusForbidden},
+		{name: "resource outside scopes", method: "GET", path: "/api/v1/business/42", token: "pat_users", wantStatusCode: http.StatusForbidden},
+		{name: "endpoint outside catalog", method: "GET", path: "/api/v1/auth/tokens", token: "pat_users", wantStatusCode: http.StatusForbidden},
+		{name: "bound business", method: "POST", path: "/api/v1/business/42/invites", token: "pat_business", wantStatusCode: http.StatusOK},
+		{name: "other business", method: "GET", path: "/api/v1/business/7", token: "pat_business", wantStatusCode: http.StatusForbidden},
+		{name: "unknown token", method: "GET", path: "/api/v1/users/me", token: "pat_unknown", wantStatusCode: http.StatusUnauthorized},
+		{name: "as api key", method: "GET", path: "/api/v1/users/me", token: "pat_users", apiKey: true, wantStatusCode: http.StatusOK},
+		{name: "api key outside scopes", method: "PUT", path: "/api/v1/users/me", token: "pat_users", apiKey: true, wantStatusCode: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.apiKey {
+				req.Header.Set(APIKeyHeader, tt.token)
+			} else {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rr := httptest.NewRecorder()
+
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				userID, err := GetUserIDFromContext(r.Context())
+				require.NoError(t, err)
+				assert.Equal(t, int64(123), userID)
+				pat := GetPersonalAccessTokenFromContext(r.Context())
+				require.NotNil(t, pat)
+				if pat.BusinessID != nil {
+					assert.Equal(t, business, GetTenantID(r))
+				}
+				w.WriteHeader(http.StatusOK)
+			})
+
+			Authenticate(tokenService, pats, AuthConfig{})(next).ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.wantStatusCode, rr.Code)
+		})
+	}
+}
+
+func TestAuthenticate_CredentialOrder(t *testing.T) {
+	tokenService := createTestTokenService(t)
+	cookieToken, err := tokenService.GenerateAccessToken(1)
+	require.NoError(t, err)
+	bearerToken, err := tokenService.GenerateAccessToken(2)
+	require.NoError(t, err)
+
+	order, err := ParseCredentialOrder([]string{"bearer", " cookie"})
+	require.NoError(t, err)
+	assert.Equal(t, []CredentialSource{CredentialBearer, CredentialCookie}, order)
+
+	req := httptest.NewRequest("GET", "/api/v1/users/", nil)
+	req.AddCookie(&http.Cookie{Name: "access_token", Value: cookieToken})
+	req.Header.Set("Authorization", "Bearer "+bearerToken)
+	rr := httptest.NewRecorder()
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, err := GetUserIDFromContext(r.Context())
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), userID)
+		assert.Equal(t, CredentialBearer, GetCredentialSource(r.Context()))
+	})
+	Authenticate(tokenService, nil, AuthConfig{CredentialOrder: order})(next).ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	// Sources left out of the order are ignored.
+	req = httptest.NewRequest("GET", "/api/v1/users/", nil)
+	req.Header.Set("Authorization", "Bearer "+bearerToken)
+	rr = httptest.NewRecorder()
+	Authenticate(tokenService, nil, AuthConfig{CredentialOrder: []CredentialSource{CredentialCookie}})(next).ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+
+	_, err = ParseCredentialOrder([]string{"header"})
+	assert.Error(t, err)
+	_, err = ParseCredentialOrder([]string{"cookie", "cookie"})
+	assert.Error(t, err)
+	order, err = ParseCredentialOrder(nil)
+	require.NoError(t, err)
+	assert.Equal(t, DefaultCredentialOrder, order)
+}
+
+func TestAuthenticate_EncodedCookie(t *testing.T) {
+	tokenService := createTestTokenService(t)
+	accessToken, err := tokenService.GenerateAccessToken(123)
+	require.NoError(t, err)
+	codec, err := securecookie.New([][]byte{[]byte(strings.Repeat("k", 32))}, true)
+	require.NoError(t, err)
+	cookies := response.NewCookies("prod", codec)
+
+	set := httptest.NewRecorder()
+	cookies.SetTokens(set, accessToken, "refresh")
+	encoded := set.Result().Cookies()[0]
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, err := GetUserIDFromContext(r.Context())
+		require.NoError(t, err)
+		assert.Equal(t, int64(123), userID)
+	})
+	auth := Authenticate(tokenService, nil, AuthConfig{Cookies: cookies})
+
+	req := httptest.NewRequest("GET", "/api/v1/users/", nil)
+	req.AddCookie(&http.Cookie{Name: encoded.Name, Value: encoded.Value})
+	rr := httptest.NewRecorder()
+	auth(next).ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	// The raw token is not accepted in place of the encoded cookie.
+	req = httptest.NewRequest("GET", "/api/v1/users/", nil)
+	req.AddCookie(&http.Cookie{Name: encoded.Name, Value: accessToken})
+	rr = httptest.NewRecorder()
+	auth(next).ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+}
@@ -0,0 +1,23 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/Prashant2307200/auth-service/internal/infrastructure/transport/http/utils/request"
+	"github.com/Prashant2307200/auth-service/internal/service"
+	"github.com/Prashant2307200/auth-service/internal/usecase"
+)
+
+// ClientInfo records the caller's address and device in the request context
+// so sessions started by the request show where they came from.
+func ClientInfo(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userAgent := r.UserAgent()
+		ctx := usecase.WithClientInfo(r.Context(), usecase.ClientInfo{
+			IPAddress:  request.ClientIP(r),
+			UserAgent:  userAgent,
+			DeviceInfo: service.ParseDeviceInfo(userAgent),
+		})
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
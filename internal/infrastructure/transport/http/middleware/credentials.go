@@ -0,0 +1,158 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/Prashant2307200/auth-service/internal/infrastructure/transport/http/utils/request"
+	"github.com/Prashant2307200/auth-service/internal/infrastructure/transport/http/utils/response"
+)
+
+// CredentialSource names where on a request a credential was found.
+type CredentialSource string
+
+const (
+	// CredentialCookie is the access token cookie browsers send.
+	CredentialCookie CredentialSource = "cookie"
+	// CredentialBearer is an "Authorization: Bearer" header.
+	CredentialBearer CredentialSource = "bearer"
+	// CredentialAPIKey is the X-API-Key header, carrying a personal access token.
+	CredentialAPIKey CredentialSource = "api_key"
+)
+
+// APIKeyHeader carries personal access tokens for clients that cannot set
+// the Authorization header.
+const APIKeyHeader = "X-API-Key"
+
+const credentialSourceKey = contextKey("credential_source")
+
+// DefaultCredentialOrder prefers the browser's cookie, so a page that also
+// holds a token cannot switch identity behind the user's back.
+var DefaultCredentialOrder = []CredentialSource{CredentialCookie, CredentialBearer, CredentialAPIKey}
+
+// CredentialExtractor returns the credential a request carries in one place,
+// reporting false when there is none.
+type CredentialExtractor func(r *http.Request, cookies *response.Cookies) (string, bool)
+
+var credentialExtractors = map[CredentialSource]CredentialExtractor{
+	CredentialCookie: func(r *http.Request, cookies *response.Cookies) (string, bool) {
+		return cookies.Read(r, response.AccessTokenCookie)
+	},
+	CredentialBearer: func(r *http.Request, _ *response.Cookies) (string, bool) {
+		return request.BearerToken(r)
+	},
+	CredentialAPIKey: func(r *http.Request, _ *response.Cookies) (string, bool) {
+		key := strings.TrimSpace(r.Header.Get(APIKeyHeader))
+		return key, key != ""
+	},
+}
+
+// ParseCredentialOrder parses credential source names such as
+// "bearer,cookie". Empty input yields DefaultCredentialOrder.
+func ParseCredentialOrder(names []string) ([]CredentialSource, error) {
+	order := make([]CredentialSource, 0, len(names))
+	seen := make(map[CredentialSource]bool, len(names))
+	for _, name := range names {
+		source := CredentialSource(strings.TrimSpace(name))
+		if source == "" {
+			continue
+		}
+		if _, ok := credentialExtractors[source]; !ok {
+			return nil, fmt.Errorf("unknown credential source %q", name)
+		}
+		if seen[source] {
+			return nil, fmt.Errorf("credential source %q listed twice", name)
+		}
+		seen[source] = true
+		order = append(order, source)
+	}
+	if len(order) == 0 {
+		return DefaultCredentialOrder, nil
+	}
+	return order, nil
+}
+
+// extractCredential returns the first credential found in order.
+func extractCredential(r *http.Request, order []CredentialSource, cookies *response.Cookies) (CredentialSource, string, bool) {
+	for _, source := range order {
+		if token, ok := credentialExtractors[source](r, cookies); ok {
+			return source, token, true
+		}
+	}
+	return "", "", false
+}
+
+// GetCredentialSource returns where the request's credential was found, or
+// "" for public routes. Only cookie credentials are sent by browsers on their
+// own, so only they need CSRF checks.
+func GetCredentialSource(ctx context.Context) CredentialSource {
+	source, _ := ctx.Value(credentialSourceKey).(CredentialSource)
+	return source
+}
+
+// WithCredentialSource returns a new context recording where the credential
+// was found. Useful for tests.
+func WithCredentialSource(ctx context.Context, source CredentialSource) context.Context {
+	return context.WithValue(ctx, credentialSourceKey, source)
+}
+
+// publicHandler marks a route that needs no credentials.
+type publicHandler struct {
+	http.Handler
+}
+
+// Public marks a route as reachable without credentials. Authenticate lets
+// requests for it through when its router is mounted on PublicRoutes.
+func Public(h http.HandlerFunc) http.Handler {
+	return publicHandler{h}
+}
+
+// PublicRoutes finds the routes declared Public on the routers mounted
+// behind Authenticate, using the routers' own pattern matching.
+type PublicRoutes struct {
+	mounts []publicMount
+}
+
+type publicMount struct {
+	prefix string
+	mux    *http.ServeMux
+}
+
+func NewPublicRoutes() *PublicRoutes {
+	return &PublicRoutes{}
+}
+
+// Mount registers mux as serving the paths under prefix, e.g. "/api/v1/auth"
+// for a router mounted there with http.StripPrefix.
+func (p *PublicRoutes) Mount(prefix string, mux *http.ServeMux) {
+	p.mounts = append(p.mounts, publicMount{prefix: strings.TrimSuffix(prefix, "/"), mux: mux})
+}
+
+// Match reports whether r is routed to a Public handler.
+func (p *PublicRoutes) Match(r *http.Request) bool {
+	if p == nil {
+		return false
+	}
+	for _, m := range p.mounts {
+		rest, ok := strings.CutPrefix(r.URL.Path, m.prefix)
+		if !ok || !strings.HasPrefix(rest, "/") {
+			continue
+		}
+		stripped := new(http.Request)
+		*stripped = *r
+		u := *r.URL
+		u.Path, u.RawPath = rest, ""
+		stripped.URL = &u
+		if h, _ := m.mux.Handler(stripped); isPublic(h) {
+			return true
+		}
+	}
+	return false
+}
+
+func isPublic(h http.Handler) bool {
+	_, ok := h.(publicHandler)
+	return ok
+}
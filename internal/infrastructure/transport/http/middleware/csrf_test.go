@@ -0,0 +1,74 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Prashant2307200/auth-service/pkg/csrf"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCSRF(t *testing.T) {
+	tokenService := createTestTokenService(t)
+	accessToken, err := tokenService.GenerateAccessTokenForSession(123, "sess-1")
+	require.NoError(t, err)
+	signer, err := csrf.NewSigner([]byte("0123456789abcdef0123456789abcdef"))
+	require.NoError(t, err)
+	validToken, err := signer.Token("session:sess-1")
+	require.NoError(t, err)
+	otherSessionToken, err := signer.Token("session:sess-2")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name           string
+		method         string
+		bearer         bool
+		origin         string
+		referer        string
+		csrfToken      string
+		wantStatusCode int
+	}{
+		{name: "safe method needs no token", method: "GET", wantStatusCode: http.StatusOK},
+		{name: "valid token", method: "PUT", csrfToken: validToken, wantStatusCode: http.StatusOK},
+		{name: "valid token from trusted origin", method: "PUT", origin: "https://app.example.com", csrfToken: validToken, wantStatusCode: http.StatusOK},
+		{name: "valid token from same origin", method: "PUT", origin: "https://api.example.com", csrfToken: validToken, wantStatusCode: http.StatusOK},
+		{name: "missing token", method: "DELETE", wantStatusCode: http.StatusForbidden},
+		{name: "token of another session", method: "POST", csrfToken: otherSessionToken, wantStatusCode: http.StatusForbidden},
+		{name: "untrusted origin", method: "POST", origin: "https://evil.example", csrfToken: validToken, wantStatusCode: http.StatusForbidden},
+		{name: "opaque origin", method: "POST", origin: "null", csrfToken: validToken, wantStatusCode: http.StatusForbidden},
+		{name: "untrusted referer", method: "POST", referer: "https://evil.example/page", csrfToken: validToken, wantStatusCode: http.StatusForbidden},
+		{name: "trusted referer", method: "POST", referer: "https://app.example.com/settings", csrfToken: validToken, wantStatusCode: http.StatusOK},
+		{name: "bearer request skips checks", method: "POST", bearer: true, origin: "https://evil.example", wantStatusCode: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "https://api.example.com/api/v1/auth/profile/", nil)
+			if tt.bearer {
+				req.Header.Set("Authorization", "Bearer "+accessToken)
+			} else {
+				req.AddCookie(&http.Cookie{Name: "access_token", Value: accessToken})
+			}
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			if tt.referer != "" {
+				req.Header.Set("Referer", tt.referer)
+			}
+			if tt.csrfToken != "" {
+				req.Header.Set(CSRFHeader, tt.csrfToken)
+			}
+			rr := httptest.NewRecorder()
+
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+			protect := CSRF(signer, []string{"https://app.example.com/"})
+			Authenticate(tokenService, nil, AuthConfig{})(protect(next)).ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.wantStatusCode, rr.Code)
+		})
+	}
+}
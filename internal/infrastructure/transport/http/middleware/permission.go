@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"slices"
+
+	"github.com/Prashant2307200/auth-service/internal/infrastructure/transport/http/utils/response"
+	"github.com/Prashant2307200/auth-service/internal/usecase"
+)
+
+// PermissionAuthorizer decides whether a user holds a permission in a
+// business. *usecase.Authorizer is one.
+type PermissionAuthorizer interface {
+	Authorize(ctx context.Context, userID, businessID int64, permission string) error
+}
+
+// RequirePermission returns middleware that only lets requests through whose
+// caller holds permission in the request's tenant, so it must run after
+// TenantContext or TenantFromHeader. Service clients need permission among
+// their scopes; users need it in their role in the business.
+func RequirePermission(authz PermissionAuthorizer, permission string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			businessID := GetTenantID(r)
+			if businessID == 0 {
+				response.WriteError(w, http.StatusBadRequest, errors.New("business context required"))
+				return
+			}
+			if client := GetServiceClientFromContext(r.Context()); client != nil {
+				if client.BusinessID != businessID || !slices.Contains(client.Scopes, permission) {
+					response.WriteError(w, http.StatusForbidden, errors.New("insufficient permissions"))
+					return
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+			userID, err := GetUserIDFromContext(r.Context())
+			if err != nil {
+				response.WriteError(w, http.StatusUnauthorized, errors.New("authentication required"))
+				return
+			}
+			if authz == nil {
+				response.WriteError(w, http.StatusForbidden, errors.New("insufficient permissions"))
+				return
+			}
+			if err := authz.Authorize(r.Context(), userID, businessID, permission); err != nil {
+				if errors.Is(err, usecase.ErrPermissionDenied) {
+					response.WriteError(w, http.StatusForbidden, errors.New("insufficient permissions"))
+					return
+				}
+				slog.Error("Failed to authorize request", slog.String("permission", permission), slog.Any("error", err))
+				response.WriteError(w, http.StatusInternalServerError, errors.New("failed to authorize request"))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
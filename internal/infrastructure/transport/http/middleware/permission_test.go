@@ -0,0 +1,87 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Prashant2307200/auth-service/internal/entity"
+	"github.com/Prashant2307200/auth-service/internal/usecase"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeAuthorizer map[int64][]string
+
+func (f fakeAuthorizer) Authorize(_ context.Context, userID, _ int64, permission string) error {
+	perms, ok := f[userID]
+	if !ok {
+		return errors.New("database unavailable")
+	}
+	for _, p := range perms {
+		if p == permission {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: requires %s", usecase.ErrPermissionDenied, permission)
+}
+
+func TestRequirePermission(t *testing.T) {
+	authz := fakeAuthorizer{
+		1: {entity.PermissionMembersRead, entity.PermissionMembersInvite},
+		2: {entity.PermissionMembersRead},
+	}
+	handler := RequirePermission(authz, entity.PermissionMembersInvite)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name     string
+		userID   int64
+		client   *ServiceClient
+		tenantID int64
+		want     int
+	}{
+		{name: "user with permission", userID: 1, tenantID: 10, want: http.StatusOK},
+		{name: "user without permission", userID: 2, tenantID: 10, want: http.StatusForbidden},
+		{name: "authorizer error", userID: 3, tenantID: 10, want: http.StatusInternalServerError},
+		{name: "no tenant", userID: 1, want: http.StatusBadRequest},
+		{name: "unauthenticated", tenantID: 10, want: http.StatusUnauthorized},
+		{name: "client with scope", client: &ServiceClient{BusinessID: 10, Scopes: []string{entity.PermissionMembersInvite}}, tenantID: 10, want: http.StatusOK},
+		{name: "client without scope", client: &ServiceClient{BusinessID: 10, Scopes: []string{entity.PermissionMembersRead}}, tenantID: 10, want: http.StatusForbidden},
+		{name: "client of another business", client: &ServiceClient{BusinessID: 11, Scopes: []string{entity.PermissionMembersInvite}}, tenantID: 10, want: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/invite", nil)
+			ctx := req.Context()
+			if tt.userID != 0 {
+				ctx = WithUserID(ctx, tt.userID)
+			}
+			if tt.client != nil {
+				ctx = WithServiceClient(ctx, tt.client)
+			}
+			req = req.WithContext(ctx)
+			if tt.tenantID != 0 {
+				req = WithTenantID(req, tt.tenantID)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+			require.Equal(t, tt.want, w.Code)
+		})
+	}
+}
+
+func TestRequirePermission_NilAuthorizerDenies(t *testing.T) {
+	handler := RequirePermission(nil, entity.PermissionAuditRead)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/audit-logs", nil)
+	req = WithTenantID(req.WithContext(WithUserID(req.Context(), 1)), 10)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	require.Equal(t, http.StatusForbidden, w.Code)
+}
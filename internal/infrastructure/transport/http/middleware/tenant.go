@@ -2,9 +2,11 @@ package middleware
 
 import (
 	"context"
+	"errors"
 	"net/http"
 	"strconv"
 
+	"github.com/Prashant2307200/auth-service/internal/infrastructure/transport/http/utils/response"
 	"github.com/golang-jwt/jwt/v5"
 )
 
@@ -82,9 +84,18 @@ func WithTenantID(r *http.Request, tenantID int64) *http.Request {
 }
 
 // TenantFromHeader sets tenant (business) ID from X-Tenant-ID after authentication.
-// Use for team/org routes when JWT claims do not carry tenant_id.
+// Use for team/org routes when JWT claims do not carry tenant_id. Service
+// clients are bound to their business and are refused any other tenant.
 func TenantFromHeader(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if client := GetServiceClientFromContext(r.Context()); client != nil {
+			if v := r.Header.Get("X-Tenant-ID"); v != "" && v != strconv.FormatInt(client.BusinessID, 10) {
+				response.WriteError(w, http.StatusForbidden, errors.New("service client cannot access this tenant"))
+				return
+			}
+			next.ServeHTTP(w, WithTenantID(r, client.BusinessID))
+			return
+		}
 		if v := r.Header.Get("X-Tenant-ID"); v != "" {
 			if id, err := strconv.ParseInt(v, 10, 64); err == nil && id > 0 {
 				r = WithTenantID(r, id)
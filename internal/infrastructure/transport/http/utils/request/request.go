@@ -6,11 +6,38 @@ import (
 	"fmt"
 	"io"
 	"mime/multipart"
+	"net"
 	"net/http"
 	"reflect"
 	"strconv"
+	"strings"
 )
 
+// ClientIP returns the address of the client that sent r: the first
+// X-Forwarded-For entry when behind a proxy, otherwise the peer address.
+func ClientIP(r *http.Request) string {
+	if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
+		first, _, _ := strings.Cut(fwd, ",")
+		return strings.TrimSpace(first)
+	}
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return ip
+}
+
+// BearerToken returns the token of an "Authorization: Bearer" header. The
+// scheme is case-insensitive (RFC 7235 §2.1).
+func BearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
 func ParseId(r *http.Request) (int64, error) {
 	// First try query parameter (useful for tests and simple clients)
 	if q := r.URL.Query().Get("id"); q != "" {
@@ -0,0 +1,134 @@
+package response
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/Prashant2307200/auth-service/pkg/securecookie"
+)
+
+const (
+	AccessTokenCookie  = "access_token"
+	RefreshTokenCookie = "refresh_token"
+	// MFATokenCookie carries the MFA challenge token from an SSO callback to
+	// POST /auth/mfa/challenge, so it never appears in a redirect URL.
+	MFATokenCookie = "mfa_token"
+
+	accessTokenCookieMaxAge  = 15 * time.Minute
+	refreshTokenCookieMaxAge = 7 * 24 * time.Hour
+)
+
+// hostPrefix restricts a cookie to Secure, Path=/ and the exact host that
+// set it, so neither a sibling subdomain nor plain HTTP can plant it.
+const hostPrefix = "__Host-"
+
+// Cookies sets and reads the service's cookies. With a Codec their values
+// are signed, or encrypted, and expire server-side; without one they are
+// plain. In prod their names carry the __Host- prefix.
+type Cookies struct {
+	Env   string
+	Codec *securecookie.Codec
+}
+
+func NewCookies(env string, codec *securecookie.Codec) *Cookies {
+	return &Cookies{Env: env, Codec: codec}
+}
+
+// Name returns the name the cookie called name is sent under.
+func (c *Cookies) Name(name string) string {
+	if c.Env == "prod" {
+		return hostPrefix + name
+	}
+	return name
+}
+
+// Set sets the cookie called name to value for maxAge.
+func (c *Cookies) Set(w http.ResponseWriter, name, value string, maxAge time.Duration) {
+	if cookie := c.encoded(name, value, maxAge); cookie != nil {
+		http.SetCookie(w, cookie)
+	}
+}
+
+// SetCrossSite is Set for a cookie that must come back on a cross-site
+// POST, such as an identity provider posting to the SAML assertion consumer
+// service. Browsers only send SameSite=None cookies that are Secure, so it
+// is Secure in dev too; browsers treat http://localhost as secure.
+func (c *Cookies) SetCrossSite(w http.ResponseWriter, name, value string, maxAge time.Duration) {
+	if cookie := c.encoded(name, value, maxAge); cookie != nil {
+		cookie.SameSite, cookie.Secure = http.SameSiteNoneMode, true
+		http.SetCookie(w, cookie)
+	}
+}
+
+// ClearCrossSite deletes a cookie set with SetCrossSite.
+func (c *Cookies) ClearCrossSite(w http.ResponseWriter, name string) {
+	cookie := c.cookie(name, "", -1)
+	cookie.SameSite, cookie.Secure = http.SameSiteNoneMode, true
+	http.SetCookie(w, cookie)
+}
+
+func (c *Cookies) encoded(name, value string, maxAge time.Duration) *http.Cookie {
+	if c.Codec != nil {
+		encoded, err := c.Codec.Encode(name, value, maxAge)
+		if err != nil {
+			slog.Error("Failed to encode cookie", slog.String("cookie", name), slog.Any("error", err))
+			return nil
+		}
+		value = encoded
+	}
+	return c.cookie(name, value, int(maxAge/time.Second))
+}
+
+// Read returns the value of the cookie called name, reporting false when it
+// is absent or fails to decode.
+func (c *Cookies) Read(r *http.Request, name string) (string, bool) {
+	cookie, err := r.Cookie(c.Name(name))
+	if err != nil || cookie.Value == "" {
+		return "", false
+	}
+	if c.Codec == nil {
+		return cookie.Value, true
+	}
+	value, err := c.Codec.Decode(name, cookie.Value)
+	if err != nil {
+		slog.Debug("Rejected cookie", slog.String("cookie", name), slog.Any("error", err))
+		return "", false
+	}
+	return value, true
+}
+
+// Clear deletes the cookie called name.
+func (c *Cookies) Clear(w http.ResponseWriter, name string) {
+	http.SetCookie(w, c.cookie(name, "", -1))
+}
+
+func (c *Cookies) cookie(name, value string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     c.Name(name),
+		Value:    value,
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   c.Env != "dev",
+		Path:     "/",
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+func (c *Cookies) SetTokens(w http.ResponseWriter, accessToken, refreshToken string) {
+	c.Set(w, AccessTokenCookie, accessToken, accessTokenCookieMaxAge)
+	c.Set(w, RefreshTokenCookie, refreshToken, refreshTokenCookieMaxAge)
+}
+
+func (c *Cookies) DeleteTokens(w http.ResponseWriter) {
+	c.Clear(w, AccessTokenCookie)
+	c.Clear(w, RefreshTokenCookie)
+}
+
+func (c *Cookies) SetMFAToken(w http.ResponseWriter, token string, maxAge time.Duration) {
+	c.Set(w, MFATokenCookie, token, maxAge)
+}
+
+func (c *Cookies) ClearMFAToken(w http.ResponseWriter) {
+	c.Clear(w, MFATokenCookie)
+}
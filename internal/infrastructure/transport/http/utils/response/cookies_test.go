@@ -0,0 +1,101 @@
+package response
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Prashant2307200/auth-service/pkg/securecookie"
+)
+
+// roundTrip sends the cookies set on rr back on a new request.
+func roundTrip(rr *httptest.ResponseRecorder) *http.Request {
+	req := httptest.NewRequest("GET", "/", nil)
+	for _, c := range rr.Result().Cookies() {
+		req.AddCookie(&http.Cookie{Name: c.Name, Value: c.Value})
+	}
+	return req
+}
+
+func TestCookies_Encoded(t *testing.T) {
+	codec, err := securecookie.New([][]byte{[]byte(strings.Repeat("k", 32))}, true)
+	if err != nil {
+		t.Fatalf("securecookie.New: %v", err)
+	}
+	cookies := NewCookies("prod", codec)
+
+	rr := httptest.NewRecorder()
+	cookies.SetTokens(rr, "access-1", "refresh-1")
+	for _, c := range rr.Result().Cookies() {
+		if !strings.HasPrefix(c.Name, "__Host-") || !c.Secure || c.Path != "/" || c.Domain != "" {
+			t.Fatalf("cookie %q does not meet the __Host- rules: %+v", c.Name, c)
+		}
+		if strings.Contains(c.Value, "access-1") || strings.Contains(c.Value, "refresh-1") {
+			t.Fatalf("cookie %q stores its value in the clear", c.Name)
+		}
+	}
+
+	req := roundTrip(rr)
+	if got, ok := cookies.Read(req, AccessTokenCookie); !ok || got != "access-1" {
+		t.Fatalf("Read(access) = %q, %v", got, ok)
+	}
+	if got, ok := cookies.Read(req, RefreshTokenCookie); !ok || got != "refresh-1" {
+		t.Fatalf("Read(refresh) = %q, %v", got, ok)
+	}
+
+	// A value encoded for one cookie is not accepted as another.
+	swapped := httptest.NewRequest("GET", "/", nil)
+	refresh, _ := req.Cookie("__Host-refresh_token")
+	swapped.AddCookie(&http.Cookie{Name: "__Host-access_token", Value: refresh.Value})
+	if _, ok := cookies.Read(swapped, AccessTokenCookie); ok {
+		t.Fatal("Read accepted a value encoded for another cookie")
+	}
+
+	forged := httptest.NewRequest("GET", "/", nil)
+	forged.AddCookie(&http.Cookie{Name: "__Host-access_token", Value: "access-1"})
+	if _, ok := cookies.Read(forged, AccessTokenCookie); ok {
+		t.Fatal("Read accepted a plain value")
+	}
+}
+
+func TestCookies_Plain(t *testing.T) {
+	cookies := NewCookies("dev", nil)
+
+	rr := httptest.NewRecorder()
+	cookies.Set(rr, "oauth_state", "state-1", time.Minute)
+	set := rr.Result().Cookies()
+	if len(set) != 1 || set[0].Name != "oauth_state" || set[0].Value != "state-1" || set[0].Secure {
+		t.Fatalf("unexpected cookie: %+v", set)
+	}
+	if got, ok := cookies.Read(roundTrip(rr), "oauth_state"); !ok || got != "state-1" {
+		t.Fatalf("Read = %q, %v", got, ok)
+	}
+
+	rr = httptest.NewRecorder()
+	cookies.Clear(rr, "oauth_state")
+	if set := rr.Result().Cookies(); len(set) != 1 || set[0].MaxAge != -1 {
+		t.Fatalf("Clear did not expire the cookie: %+v", set)
+	}
+}
+
+func TestCookies_CrossSite(t *testing.T) {
+	cookies := NewCookies("dev", nil)
+
+	rr := httptest.NewRecorder()
+	cookies.SetCrossSite(rr, "saml_request", "id-1", time.Minute)
+	set := rr.Result().Cookies()
+	if len(set) != 1 || set[0].SameSite != http.SameSiteNoneMode || !set[0].Secure || !set[0].HttpOnly {
+		t.Fatalf("unexpected cookie: %+v", set)
+	}
+	if got, ok := cookies.Read(roundTrip(rr), "saml_request"); !ok || got != "id-1" {
+		t.Fatalf("Read = %q, %v", got, ok)
+	}
+
+	rr = httptest.NewRecorder()
+	cookies.ClearCrossSite(rr, "saml_request")
+	if set := rr.Result().Cookies(); len(set) != 1 || set[0].MaxAge != -1 || !set[0].Secure {
+		t.Fatalf("ClearCrossSite did not expire the cookie: %+v", set)
+	}
+}
@@ -214,49 +214,3 @@ func FormatValidationErrors(err error) []map[string]string {
 	out = append(out, map[string]string{"field": "request", "message": err.Error()})
 	return out
 }
-
-func SetTokenCookies(w http.ResponseWriter, accessToken, refreshToken string, env string) {
-
-	http.SetCookie(w, &http.Cookie{
-		Name:     "access_token",
-		Value:    accessToken,
-		MaxAge:   15 * 60,
-		HttpOnly: true,
-		Secure:   env != "dev",
-		Path:     "/",
-		SameSite: http.SameSiteLaxMode,
-	})
-
-	http.SetCookie(w, &http.Cookie{
-		Name:     "refresh_token",
-		Value:    refreshToken,
-		MaxAge:   7 * 24 * 60 * 60,
-		HttpOnly: true,
-		Secure:   env != "dev",
-		Path:     "/",
-		SameSite: http.SameSiteLaxMode,
-	})
-}
-
-func DeleteTokenCookies(w http.ResponseWriter, env string) {
-
-	http.SetCookie(w, &http.Cookie{
-		Name:     "access_token",
-		Value:    "",
-		Path:     "/",
-		MaxAge:   -1,
-		HttpOnly: true,
-		Secure:   env != "dev",
-		SameSite: http.SameSiteLaxMode,
-	})
-
-	http.SetCookie(w, &http.Cookie{
-		Name:     "refresh_token",
-		Value:    "",
-		Path:     "/",
-		MaxAge:   -1,
-		HttpOnly: true,
-		Secure:   env != "dev",
-		SameSite: http.SameSiteLaxMode,
-	})
-}
@@ -0,0 +1,408 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/github"
+
+	"github.com/Prashant2307200/auth-service/internal/entity"
+	"github.com/Prashant2307200/auth-service/pkg/jwk"
+)
+
+const (
+	googleIssuer = "https://accounts.google.com"
+	// microsoftIssuer is completed with a tenant: a directory ID, or "common",
+	// "organizations" or "consumers" for multi-tenant sign-in.
+	microsoftIssuer = "https://login.microsoftonline.com/%s/v2.0"
+	// tenantIDPlaceholder stands in for the tid claim in the issuer that
+	// Microsoft's multi-tenant endpoints advertise.
+	tenantIDPlaceholder = "{tenantid}"
+	githubAPIURL        = "https://api.github.com"
+
+	// jwksRefreshInterval bounds how often an unknown key ID triggers a
+	// refetch of the provider's keys.
+	jwksRefreshInterval = time.Minute
+	idTokenLeeway       = time.Minute
+)
+
+// IdentityProviderConfig is the OAuth client registered with an identity
+// provider.
+type IdentityProviderConfig struct {
+	// Name identifies the provider in URLs, e.g. "google" in /sso/google.
+	Name         string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	// Scopes defaults to the provider's scopes for the user's email and profile.
+	Scopes []string
+}
+
+func newIdentityProviderHTTPClient() *http.Client {
+	return &http.Client{Timeout: 10 * time.Second}
+}
+
+// OIDCProvider signs users in with any OpenID Connect issuer, found through
+// its discovery document. ID tokens are verified against the issuer's JWKS.
+type OIDCProvider struct {
+	cfg    IdentityProviderConfig
+	issuer string
+	client *http.Client
+	now    func() time.Time
+
+	mu          sync.Mutex
+	discovery   *oidcDiscovery
+	keys        *jwk.Set
+	keysFetched time.Time
+}
+
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserinfoEndpoint      string `json:"userinfo_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// NewOIDCProvider returns a provider for issuer. The discovery document is
+// fetched on first use. client may be nil.
+func NewOIDCProvider(cfg IdentityProviderConfig, issuer string, client *http.Client) *OIDCProvider {
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{"openid", "email", "profile"}
+	}
+	if client == nil {
+		client = newIdentityProviderHTTPClient()
+	}
+	return &OIDCProvider{cfg: cfg, issuer: strings.TrimSuffix(issuer, "/"), client: client, now: time.Now}
+}
+
+// NewGoogleProvider returns the OIDC provider for Google accounts. Its
+// subjects are the Google account IDs stored before user_identities existed.
+func NewGoogleProvider(cfg IdentityProviderConfig, client *http.Client) *OIDCProvider {
+	if cfg.Name == "" {
+		cfg.Name = "google"
+	}
+	return NewOIDCProvider(cfg, googleIssuer, client)
+}
+
+// NewMicrosoftProvider returns the OIDC provider for Microsoft Entra ID and
+// personal Microsoft accounts. tenant defaults to "common".
+func NewMicrosoftProvider(cfg IdentityProviderConfig, tenant string, client *http.Client) *OIDCProvider {
+	if cfg.Name == "" {
+		cfg.Name = "microsoft"
+	}
+	if tenant == "" {
+		tenant = "common"
+	}
+	return NewOIDCProvider(cfg, fmt.Sprintf(microsoftIssuer, tenant), client)
+}
+
+func (p *OIDCProvider) Name() string {
+	return p.cfg.Name
+}
+
+func (p *OIDCProvider) AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	d, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	return p.oauthConfig(d).AuthCodeURL(state, oauth2.S256ChallengeOption(verifier), oauth2.SetAuthURLParam("nonce", nonce)), nil
+}
+
+func (p *OIDCProvider) Exchange(ctx context.Context, code, nonce, verifier string) (*entity.ExternalIdentity, error) {
+	d, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, p.client)
+	conf := p.oauthConfig(d)
+	token, err := conf.Exchange(ctx, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		return nil, fmt.Errorf("code exchange failed: %w", err)
+	}
+	rawIDToken, _ := token.Extra("id_token").(string)
+	if rawIDToken == "" {
+		return nil, errors.New("token response has no id_token")
+	}
+	claims, err := p.verifyIDToken(ctx, d, rawIDToken, nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	identity := &entity.ExternalIdentity{
+		Provider:      p.cfg.Name,
+		Subject:       claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: bool(claims.EmailVerified),
+		Name:          claims.Name,
+		Picture:       claims.Picture,
+	}
+	if identity.Email == "" && d.UserinfoEndpoint != "" {
+		var info oidcUserInfo
+		if err := getJSON(ctx, conf.Client(ctx, token), d.UserinfoEndpoint, &info); err != nil {
+			return nil, fmt.Errorf("userinfo request failed: %w", err)
+		}
+		if info.Subject != claims.Subject {
+			return nil, errors.New("userinfo subject does not match id_token")
+		}
+		identity.Email, identity.EmailVerified = info.Email, bool(info.EmailVerified)
+		if identity.Name == "" {
+			identity.Name = info.Name
+		}
+		if identity.Picture == "" {
+			identity.Picture = info.Picture
+		}
+	}
+	return identity, nil
+}
+
+func (p *OIDCProvider) oauthConfig(d *oidcDiscovery) *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     p.cfg.ClientID,
+		ClientSecret: p.cfg.ClientSecret,
+		RedirectURL:  p.cfg.RedirectURL,
+		Scopes:       p.cfg.Scopes,
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  d.AuthorizationEndpoint,
+			TokenURL: d.TokenEndpoint,
+		},
+	}
+}
+
+// discover fetches the issuer's discovery document once and caches it.
+func (p *OIDCProvider) discover(ctx context.Context) (*oidcDiscovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+
+	var d oidcDiscovery
+	if err := getJSON(ctx, p.client, p.issuer+"/.well-known/openid-configuration", &d); err != nil {
+		return nil, fmt.Errorf("oidc discovery failed: %w", err)
+	}
+	if d.Issuer != p.issuer && !strings.Contains(d.Issuer, tenantIDPlaceholder) {
+		return nil, fmt.Errorf("oidc discovery returned issuer %q, want %q", d.Issuer, p.issuer)
+	}
+	if d.AuthorizationEndpoint == "" || d.TokenEndpoint == "" || d.JWKSURI == "" {
+		return nil, errors.New("oidc discovery document is incomplete")
+	}
+	p.discovery = &d
+	return p.discovery, nil
+}
+
+// idTokenClaims are the ID token claims read at sign-in.
+type idTokenClaims struct {
+	jwt.RegisteredClaims
+	Nonce         string    `json:"nonce"`
+	Email         string    `json:"email"`
+	EmailVerified claimBool `json:"email_verified"`
+	Name          string    `json:"name"`
+	Picture       string    `json:"picture"`
+	TenantID      string    `json:"tid"`
+}
+
+type oidcUserInfo struct {
+	Subject       string    `json:"sub"`
+	Email         string    `json:"email"`
+	EmailVerified claimBool `json:"email_verified"`
+	Name          string    `json:"name"`
+	Picture       string    `json:"picture"`
+}
+
+// claimBool accepts booleans sent as JSON strings, as some issuers do.
+type claimBool bool
+
+func (b *claimBool) UnmarshalJSON(data []byte) error {
+	v, err := strconv.ParseBool(strings.Trim(string(data), `"`))
+	if err != nil {
+		return fmt.Errorf("invalid boolean claim %s", data)
+	}
+	*b = claimBool(v)
+	return nil
+}
+
+func (p *OIDCProvider) verifyIDToken(ctx context.Context, d *oidcDiscovery, raw, nonce string) (*idTokenClaims, error) {
+	var claims idTokenClaims
+	_, err := jwt.ParseWithClaims(raw, &claims, func(t *jwt.Token) (any, error) {
+		kid, _ := t.Header["kid"].(string)
+		return p.key(ctx, d, kid)
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg()}),
+		jwt.WithAudience(p.cfg.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(idTokenLeeway),
+		jwt.WithTimeFunc(p.now),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("invalid id_token: %w", err)
+	}
+
+	issuer := d.Issuer
+	if strings.Contains(issuer, tenantIDPlaceholder) {
+		if claims.TenantID == "" {
+			return nil, errors.New("invalid id_token: missing tid claim")
+		}
+		issuer = strings.ReplaceAll(issuer, tenantIDPlaceholder, claims.TenantID)
+	}
+	if claims.Issuer != issuer {
+		return nil, fmt.Errorf("invalid id_token: issuer %q, want %q", claims.Issuer, issuer)
+	}
+	if claims.Subject == "" {
+		return nil, errors.New("invalid id_token: missing sub claim")
+	}
+	if claims.Nonce != nonce {
+		return nil, errors.New("invalid id_token: nonce mismatch")
+	}
+	return &claims, nil
+}
+
+// key returns the issuer's signing key with kid, refetching the JWKS when
+// the key is unknown, as happens after the issuer rotates its keys.
+func (p *OIDCProvider) key(ctx context.Context, d *oidcDiscovery, kid string) (any, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.keys != nil {
+		if k, ok := p.keys.Lookup(kid); ok {
+			return k.RSAPublicKey()
+		}
+		if p.now().Sub(p.keysFetched) < jwksRefreshInterval {
+			return nil, fmt.Errorf("unknown signing key %q", kid)
+		}
+	}
+
+	var set jwk.Set
+	if err := getJSON(ctx, p.client, d.JWKSURI, &set); err != nil {
+		return nil, fmt.Errorf("jwks request failed: %w", err)
+	}
+	p.keys, p.keysFetched = &set, p.now()
+	k, ok := set.Lookup(kid)
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	return k.RSAPublicKey()
+}
+
+// GitHubProvider signs users in with GitHub, which offers OAuth 2.0 but not
+// OpenID Connect, so the identity is read from its REST API.
+type GitHubProvider struct {
+	cfg      IdentityProviderConfig
+	client   *http.Client
+	endpoint oauth2.Endpoint
+	apiURL   string
+}
+
+// NewGitHubProvider returns the provider for GitHub accounts. client may be nil.
+func NewGitHubProvider(cfg IdentityProviderConfig, client *http.Client) *GitHubProvider {
+	if cfg.Name == "" {
+		cfg.Name = "github"
+	}
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{"read:user", "user:email"}
+	}
+	if client == nil {
+		client = newIdentityProviderHTTPClient()
+	}
+	return &GitHubProvider{cfg: cfg, client: client, endpoint: github.Endpoint, apiURL: githubAPIURL}
+}
+
+func (p *GitHubProvider) Name() string {
+	return p.cfg.Name
+}
+
+// AuthCodeURL ignores nonce: GitHub issues no ID token to carry it.
+func (p *GitHubProvider) AuthCodeURL(_ context.Context, state, _, verifier string) (string, error) {
+	return p.oauthConfig().AuthCodeURL(state, oauth2.S256ChallengeOption(verifier)), nil
+}
+
+type githubUser struct {
+	ID        int64  `json:"id"`
+	Login     string `json:"login"`
+	Name      string `json:"name"`
+	AvatarURL string `json:"avatar_url"`
+}
+
+type githubEmail struct {
+	Email    string `json:"email"`
+	Primary  bool   `json:"primary"`
+	Verified bool   `json:"verified"`
+}
+
+func (p *GitHubProvider) Exchange(ctx context.Context, code, _, verifier string) (*entity.ExternalIdentity, error) {
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, p.client)
+	conf := p.oauthConfig()
+	token, err := conf.Exchange(ctx, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		return nil, fmt.Errorf("code exchange failed: %w", err)
+	}
+	client := conf.Client(ctx, token)
+
+	var user githubUser
+	if err := getJSON(ctx, client, p.apiURL+"/user", &user); err != nil {
+		return nil, fmt.Errorf("github user request failed: %w", err)
+	}
+	if user.ID == 0 {
+		return nil, errors.New("github user has no id")
+	}
+	var emails []githubEmail
+	if err := getJSON(ctx, client, p.apiURL+"/user/emails", &emails); err != nil {
+		return nil, fmt.Errorf("github emails request failed: %w", err)
+	}
+
+	identity := &entity.ExternalIdentity{
+		Provider: p.cfg.Name,
+		Subject:  strconv.FormatInt(user.ID, 10),
+		Name:     user.Name,
+		Picture:  user.AvatarURL,
+	}
+	if identity.Name == "" {
+		identity.Name = user.Login
+	}
+	for _, e := range emails {
+		if e.Primary && e.Verified {
+			identity.Email, identity.EmailVerified = e.Email, true
+			break
+		}
+	}
+	return identity, nil
+}
+
+func (p *GitHubProvider) oauthConfig() *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     p.cfg.ClientID,
+		ClientSecret: p.cfg.ClientSecret,
+		RedirectURL:  p.cfg.RedirectURL,
+		Scopes:       p.cfg.Scopes,
+		Endpoint:     p.endpoint,
+	}
+}
+
+// getJSON decodes the JSON body of a successful GET of url into v.
+func getJSON(ctx context.Context, client *http.Client, url string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v)
+}
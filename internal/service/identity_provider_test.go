@@ -0,0 +1,304 @@
+package service
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/oauth2"
+
+	"github.com/Prashant2307200/auth-service/pkg/jwk"
+)
+
+// stubIdP is an OpenID Connect issuer serving discovery, JWKS, token and
+// userinfo endpoints. The token endpoint accepts code "good-code" with
+// verifier "verifier" and returns an ID token built from claims.
+type stubIdP struct {
+	*httptest.Server
+	key      *rsa.PrivateKey
+	kid      string
+	issuer   string
+	claims   jwt.MapClaims
+	userinfo map[string]any
+}
+
+func newStubIdP(t *testing.T) *stubIdP {
+	t.Helper()
+	idp := &stubIdP{key: generateKey(t), kid: "key-1"}
+	mux := http.NewServeMux()
+	idp.Server = httptest.NewServer(mux)
+	t.Cleanup(idp.Close)
+	idp.issuer = idp.URL
+
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeTestJSON(w, map[string]string{
+			"issuer":                 idp.issuer,
+			"authorization_endpoint": idp.URL + "/authorize",
+			"token_endpoint":         idp.URL + "/token",
+			"userinfo_endpoint":      idp.URL + "/userinfo",
+			"jwks_uri":               idp.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		writeTestJSON(w, jwk.Set{Keys: []jwk.Key{jwk.FromRSAPublicKey(idp.kid, &idp.key.PublicKey)}})
+	})
+	mux.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("code") != "good-code" || r.FormValue("code_verifier") != "verifier" {
+			w.WriteHeader(http.StatusBadRequest)
+			writeTestJSON(w, map[string]string{"error": "invalid_grant"})
+			return
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, idp.claims)
+		token.Header["kid"] = idp.kid
+		signed, err := token.SignedString(idp.key)
+		if err != nil {
+			t.Errorf("sign id_token: %v", err)
+		}
+		writeTestJSON(w, map[string]any{"access_token": "at", "token_type": "Bearer", "id_token": signed})
+	})
+	mux.HandleFunc("GET /userinfo", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer at" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		writeTestJSON(w, idp.userinfo)
+	})
+	return idp
+}
+
+func (idp *stubIdP) validClaims() jwt.MapClaims {
+	return jwt.MapClaims{
+		"iss":            idp.issuer,
+		"sub":            "subject-1",
+		"aud":            "client-1",
+		"exp":            time.Now().Add(time.Hour).Unix(),
+		"iat":            time.Now().Unix(),
+		"nonce":          "nonce-1",
+		"email":          "ada@example.com",
+		"email_verified": true,
+		"name":           "Ada",
+	}
+}
+
+func writeTestJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func testProviderConfig() IdentityProviderConfig {
+	return IdentityProviderConfig{Name: "stub", ClientID: "client-1", ClientSecret: "secret", RedirectURL: "https://app.example.com/cb"}
+}
+
+func TestOIDCProvider_AuthCodeURL(t *testing.T) {
+	idp := newStubIdP(t)
+	p := NewOIDCProvider(testProviderConfig(), idp.URL, idp.Client())
+
+	raw, err := p.AuthCodeURL(context.Background(), "state-1", "nonce-1", "verifier")
+	if err != nil {
+		t.Fatalf("AuthCodeURL failed: %v", err)
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		t.Fatalf("invalid url %q: %v", raw, err)
+	}
+	q := u.Query()
+	if !strings.HasPrefix(raw, idp.URL+"/authorize?") {
+		t.Errorf("url = %q, want the discovered authorization endpoint", raw)
+	}
+	if q.Get("state") != "state-1" || q.Get("nonce") != "nonce-1" || q.Get("client_id") != "client-1" {
+		t.Errorf("unexpected query %v", q)
+	}
+	if q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") != oauth2.S256ChallengeFromVerifier("verifier") {
+		t.Errorf("missing PKCE challenge in %v", q)
+	}
+	if q.Get("scope") != "openid email profile" {
+		t.Errorf("scope = %q", q.Get("scope"))
+	}
+}
+
+func TestOIDCProvider_Exchange(t *testing.T) {
+	idp := newStubIdP(t)
+	idp.claims = idp.validClaims()
+	p := NewOIDCProvider(testProviderConfig(), idp.URL, idp.Client())
+
+	identity, err := p.Exchange(context.Background(), "good-code", "nonce-1", "verifier")
+	if err != nil {
+		t.Fatalf("Exchange failed: %v", err)
+	}
+	if identity.Provider != "stub" || identity.Subject != "subject-1" || identity.Email != "ada@example.com" || !identity.EmailVerified || identity.Name != "Ada" {
+		t.Errorf("unexpected identity %+v", identity)
+	}
+
+	if _, err := p.Exchange(context.Background(), "bad-code", "nonce-1", "verifier"); err == nil {
+		t.Error("expected an error for a rejected code")
+	}
+	if _, err := p.Exchange(context.Background(), "good-code", "nonce-1", "other-verifier"); err == nil {
+		t.Error("expected an error for a wrong PKCE verifier")
+	}
+}
+
+func TestOIDCProvider_RejectsInvalidIDTokens(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(jwt.MapClaims)
+		nonce  string
+	}{
+		{"wrong nonce", func(jwt.MapClaims) {}, "other-nonce"},
+		{"wrong audience", func(c jwt.MapClaims) { c["aud"] = "other-client" }, "nonce-1"},
+		{"wrong issuer", func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" }, "nonce-1"},
+		{"expired", func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() }, "nonce-1"},
+		{"no expiry", func(c jwt.MapClaims) { delete(c, "exp") }, "nonce-1"},
+		{"no subject", func(c jwt.MapClaims) { delete(c, "sub") }, "nonce-1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idp := newStubIdP(t)
+			idp.claims = idp.validClaims()
+			tt.modify(idp.claims)
+			p := NewOIDCProvider(testProviderConfig(), idp.URL, idp.Client())
+
+			if _, err := p.Exchange(context.Background(), "good-code", tt.nonce, "verifier"); err == nil {
+				t.Error("expected the id_token to be rejected")
+			}
+		})
+	}
+}
+
+func TestOIDCProvider_RefetchesRotatedKeys(t *testing.T) {
+	idp := newStubIdP(t)
+	idp.claims = idp.validClaims()
+	p := NewOIDCProvider(testProviderConfig(), idp.URL, idp.Client())
+	now := time.Now()
+	p.now = func() time.Time { return now }
+
+	if _, err := p.Exchange(context.Background(), "good-code", "nonce-1", "verifier"); err != nil {
+		t.Fatalf("Exchange failed: %v", err)
+	}
+
+	idp.key, idp.kid = generateKey(t), "key-2"
+	if _, err := p.Exchange(context.Background(), "good-code", "nonce-1", "verifier"); err == nil {
+		t.Error("expected keys to be refetched at most once per interval")
+	}
+	now = now.Add(jwksRefreshInterval)
+	if _, err := p.Exchange(context.Background(), "good-code", "nonce-1", "verifier"); err != nil {
+		t.Fatalf("Exchange after key rotation failed: %v", err)
+	}
+}
+
+func TestOIDCProvider_UserinfoFallback(t *testing.T) {
+	idp := newStubIdP(t)
+	idp.claims = idp.validClaims()
+	delete(idp.claims, "email")
+	delete(idp.claims, "email_verified")
+	idp.userinfo = map[string]any{"sub": "subject-1", "email": "ada@example.com", "email_verified": "true"}
+	p := NewOIDCProvider(testProviderConfig(), idp.URL, idp.Client())
+
+	identity, err := p.Exchange(context.Background(), "good-code", "nonce-1", "verifier")
+	if err != nil {
+		t.Fatalf("Exchange failed: %v", err)
+	}
+	if identity.Email != "ada@example.com" || !identity.EmailVerified {
+		t.Errorf("unexpected identity %+v", identity)
+	}
+
+	idp.userinfo["sub"] = "someone-else"
+	if _, err := p.Exchange(context.Background(), "good-code", "nonce-1", "verifier"); err == nil {
+		t.Error("expected a userinfo subject mismatch to be rejected")
+	}
+}
+
+func TestOIDCProvider_MultiTenantIssuer(t *testing.T) {
+	idp := newStubIdP(t)
+	// Microsoft's "common" endpoint advertises an issuer template; tokens
+	// carry the user's own tenant.
+	idp.issuer = idp.URL + "/{tenantid}/v2.0"
+	idp.claims = idp.validClaims()
+	idp.claims["iss"] = idp.URL + "/tenant-a/v2.0"
+	idp.claims["tid"] = "tenant-a"
+	p := NewOIDCProvider(testProviderConfig(), idp.URL, idp.Client())
+
+	if _, err := p.Exchange(context.Background(), "good-code", "nonce-1", "verifier"); err != nil {
+		t.Fatalf("Exchange failed: %v", err)
+	}
+
+	idp.claims["tid"] = "tenant-b"
+	if _, err := p.Exchange(context.Background(), "good-code", "nonce-1", "verifier"); err == nil {
+		t.Error("expected an issuer for another tenant to be rejected")
+	}
+}
+
+func TestOIDCProvider_RejectsMismatchedDiscoveryIssuer(t *testing.T) {
+	idp := newStubIdP(t)
+	idp.issuer = "https://evil.example.com"
+	p := NewOIDCProvider(testProviderConfig(), idp.URL, idp.Client())
+
+	if _, err := p.AuthCodeURL(context.Background(), "s", "n", "v"); err == nil {
+		t.Error("expected discovery for another issuer to fail")
+	}
+}
+
+func TestGitHubProvider_Exchange(t *testing.T) {
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	emails := []map[string]any{
+		{"email": "old@example.com", "primary": false, "verified": true},
+		{"email": "ada@example.com", "primary": true, "verified": true},
+	}
+	mux.HandleFunc("POST /login/oauth/access_token", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("code") != "good-code" || r.FormValue("code_verifier") != "verifier" {
+			w.WriteHeader(http.StatusBadRequest)
+			writeTestJSON(w, map[string]string{"error": "bad_verification_code"})
+			return
+		}
+		writeTestJSON(w, map[string]string{"access_token": "gh-token", "token_type": "bearer"})
+	})
+	authorized := func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "Bearer gh-token" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			next(w, r)
+		}
+	}
+	mux.HandleFunc("GET /user", authorized(func(w http.ResponseWriter, r *http.Request) {
+		writeTestJSON(w, map[string]any{"id": 42, "login": "ada", "avatar_url": "https://avatars.example.com/42"})
+	}))
+	mux.HandleFunc("GET /user/emails", authorized(func(w http.ResponseWriter, r *http.Request) {
+		writeTestJSON(w, emails)
+	}))
+
+	p := NewGitHubProvider(testProviderConfig(), srv.Client())
+	p.endpoint = oauth2.Endpoint{AuthURL: srv.URL + "/login/oauth/authorize", TokenURL: srv.URL + "/login/oauth/access_token"}
+	p.apiURL = srv.URL
+
+	identity, err := p.Exchange(context.Background(), "good-code", "", "verifier")
+	if err != nil {
+		t.Fatalf("Exchange failed: %v", err)
+	}
+	if identity.Subject != "42" || identity.Email != "ada@example.com" || !identity.EmailVerified || identity.Name != "ada" {
+		t.Errorf("unexpected identity %+v", identity)
+	}
+
+	emails[1]["verified"] = false
+	identity, err = p.Exchange(context.Background(), "good-code", "", "verifier")
+	if err != nil {
+		t.Fatalf("Exchange failed: %v", err)
+	}
+	if identity.Email != "" || identity.EmailVerified {
+		t.Errorf("expected no email without a verified primary address, got %+v", identity)
+	}
+
+	if _, err := p.Exchange(context.Background(), "bad-code", "", "verifier"); err == nil {
+		t.Error("expected an error for a rejected code")
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"crypto/rsa"
 	"crypto/x509"
 	"encoding/pem"
+	"errors"
 	"os"
 	"testing"
 	"time"
@@ -53,29 +54,36 @@ func TestGenerateAndVerifyRefreshToken(t *testing.T) {
 		t.Fatalf("failed to create token service: %v", err)
 	}
 
-	token, err := s.GenerateRefreshToken(123)
+	token, err := s.GenerateRefreshToken(123, "sess-1")
 	if err != nil {
 		t.Fatalf("generate refresh token failed: %v", err)
 	}
 
 	// Verify valid token
-	uid, err := s.VerifyRefreshToken(context.Background(), token)
+	claims, err := s.VerifyRefreshToken(context.Background(), token)
 	if err != nil {
 		t.Fatalf("verify refresh token failed: %v", err)
 	}
-	if uid != "123" {
-		t.Fatalf("expected uid 123 got %s", uid)
+	if claims.UserID != 123 || claims.SessionID != "sess-1" {
+		t.Fatalf("expected uid 123 in session sess-1 got %+v", claims)
+	}
+
+	// token without a session
+	noSession, _ := generateJWT("1", "", "refresh-secret-test", time.Hour)
+	_, err = s.VerifyRefreshToken(context.Background(), noSession)
+	if err == nil {
+		t.Fatalf("expected error for token without session")
 	}
 
 	// expired token
-	short, _ := generateJWT("1", "refresh-secret-test", -time.Hour)
+	short, _ := generateJWT("1", "sess-1", "refresh-secret-test", -time.Hour)
 	_, err = s.VerifyRefreshToken(context.Background(), short)
 	if err == nil {
 		t.Fatalf("expected error for expired token")
 	}
 
 	// invalid signature
-	bad, _ := generateJWT("1", "wrong-secret", time.Hour)
+	bad, _ := generateJWT("1", "sess-1", "wrong-secret", time.Hour)
 	_, err = s.VerifyRefreshToken(context.Background(), bad)
 	if err == nil {
 		t.Fatalf("expected error for invalid signature")
@@ -114,6 +122,152 @@ func TestGenerateAccessAndVerifyToken(t *testing.T) {
 	}
 }
 
+func TestAccessToken_CarriesSessionID(t *testing.T) {
+	pub, priv := setupKeys(t)
+	s, err := NewJWTTokenService(nil, pub, priv, "refresh-secret-test")
+	if err != nil {
+		t.Fatalf("failed to create token service: %v", err)
+	}
+
+	token, err := s.GenerateAccessTokenForSession(55, "sess-1", 99)
+	if err != nil {
+		t.Fatalf("generate access token failed: %v", err)
+	}
+	claims, err := s.VerifyAccessToken(context.Background(), token)
+	if err != nil {
+		t.Fatalf("verify access token failed: %v", err)
+	}
+	if claims.UserID != 55 || claims.SessionID != "sess-1" || claims.BusinessID != 99 {
+		t.Fatalf("unexpected claims %+v", claims)
+	}
+
+	if claims.TokenID == "" || time.Until(claims.ExpiresAt) <= 0 {
+		t.Fatalf("expected jti and expiry, got %+v", claims)
+	}
+
+	// Tokens issued outside a session still get a sid of their own.
+	token, _ = s.GenerateAccessToken(55)
+	other, err := s.VerifyAccessToken(context.Background(), token)
+	if err != nil || other.SessionID == "" || other.SessionID == claims.SessionID || other.TokenID == claims.TokenID {
+		t.Fatalf("expected fresh sid and jti, got %+v, %v", other, err)
+	}
+}
+
+func TestClientAccessTokenAndIDToken(t *testing.T) {
+	pub, priv := setupKeys(t)
+	s, err := NewJWTTokenService(nil, pub, priv, "refresh-secret-test")
+	if err != nil {
+		t.Fatalf("failed to create token service: %v", err)
+	}
+	s.Issuer = "https://auth.example.com"
+
+	token, err := s.GenerateClientAccessToken(55, "spa", []string{"openid", "email"})
+	if err != nil {
+		t.Fatalf("generate client access token failed: %v", err)
+	}
+	claims, err := s.VerifyAccessToken(context.Background(), token)
+	if err != nil {
+		t.Fatalf("verify client access token failed: %v", err)
+	}
+	if claims.UserID != 55 || claims.ClientID != "spa" || len(claims.Scopes) != 2 || claims.Scopes[1] != "email" {
+		t.Fatalf("unexpected claims %+v", claims)
+	}
+
+	idToken, err := s.GenerateIDToken(55, "spa", "n-0S6", map[string]any{"email": "a@example.com"})
+	if err != nil {
+		t.Fatalf("generate id token failed: %v", err)
+	}
+	parsed := jwt.MapClaims{}
+	if _, err := jwt.ParseWithClaims(idToken, parsed, s.verificationKey); err != nil {
+		t.Fatalf("id token does not verify: %v", err)
+	}
+	for k, want := range map[string]any{"iss": "https://auth.example.com", "sub": "55", "aud": "spa", "nonce": "n-0S6", "email": "a@example.com"} {
+		if parsed[k] != want {
+			t.Fatalf("claim %s = %v, want %v", k, parsed[k], want)
+		}
+	}
+	if _, err := s.VerifyAccessToken(context.Background(), idToken); err == nil {
+		t.Fatal("an id token must not pass as an access token")
+	}
+}
+
+func TestServiceAccessToken(t *testing.T) {
+	pub, priv := setupKeys(t)
+	s, err := NewJWTTokenService(nil, pub, priv, "refresh-secret-test")
+	if err != nil {
+		t.Fatalf("failed to create token service: %v", err)
+	}
+
+	token, err := s.GenerateServiceAccessToken("billing-worker", 9, []string{"users:read"})
+	if err != nil {
+		t.Fatalf("generate service access token failed: %v", err)
+	}
+	claims, err := s.VerifyAccessToken(context.Background(), token)
+	if err != nil {
+		t.Fatalf("verify service access token failed: %v", err)
+	}
+	if !claims.IsServiceClient() || claims.UserID != 0 || claims.ClientID != "billing-worker" || claims.BusinessID != 9 || claims.TokenID == "" {
+		t.Fatalf("unexpected claims %+v", claims)
+	}
+	if _, err := s.VerifyToken(context.Background(), token); err == nil {
+		t.Fatal("a service token must not pass as a user token")
+	}
+}
+
+type memDenylist map[string]bool
+
+func (d memDenylist) RevokeToken(_ context.Context, tokenID string, _ time.Time) error {
+	d["jti:"+tokenID] = true
+	return nil
+}
+
+func (d memDenylist) RevokeSession(_ context.Context, sessionID string) error {
+	d["sid:"+sessionID] = true
+	return nil
+}
+
+func (d memDenylist) IsRevoked(_ context.Context, tokenID, sessionID string) (bool, error) {
+	return d["jti:"+tokenID] || d["sid:"+sessionID], nil
+}
+
+func TestAccessToken_Revocation(t *testing.T) {
+	pub, priv := setupKeys(t)
+	s, err := NewJWTTokenService(nil, pub, priv, "refresh-secret-test")
+	if err != nil {
+		t.Fatalf("failed to create token service: %v", err)
+	}
+	s.Denylist = memDenylist{}
+	ctx := context.Background()
+
+	first, _ := s.GenerateAccessTokenForSession(55, "sess-1")
+	second, _ := s.GenerateAccessTokenForSession(55, "sess-1")
+	other, _ := s.GenerateAccessTokenForSession(55, "sess-2")
+
+	claims, err := s.VerifyAccessToken(ctx, first)
+	if err != nil {
+		t.Fatalf("verify access token failed: %v", err)
+	}
+	if err := s.RevokeAccessToken(ctx, claims.TokenID, claims.ExpiresAt); err != nil {
+		t.Fatalf("revoke failed: %v", err)
+	}
+	if _, err := s.VerifyToken(ctx, first); !errors.Is(err, ErrTokenRevoked) {
+		t.Fatalf("expected revoked token to be rejected, got %v", err)
+	}
+	if _, err := s.VerifyToken(ctx, second); err != nil {
+		t.Fatalf("other token of the session should still verify: %v", err)
+	}
+
+	if err := s.RevokeSessionAccessTokens(ctx, "sess-1"); err != nil {
+		t.Fatalf("revoke session failed: %v", err)
+	}
+	if _, err := s.VerifyToken(ctx, second); !errors.Is(err, ErrTokenRevoked) {
+		t.Fatalf("expected token of revoked session to be rejected, got %v", err)
+	}
+	if _, err := s.VerifyToken(ctx, other); err != nil {
+		t.Fatalf("token of another session should still verify: %v", err)
+	}
+}
+
 func TestAccessToken_TableDriven(t *testing.T) {
 	pub, priv := setupKeys(t)
 	var rdb *redis.Client = nil
@@ -0,0 +1,165 @@
+package service
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Prashant2307200/auth-service/pkg/jwk"
+)
+
+// verificationSkew is added to the access-token TTL when deciding how long a
+// retired key must remain valid for verification.
+const verificationSkew = time.Minute
+
+var ErrUnknownSigningKey = errors.New("unknown signing key")
+
+// SigningKey is one RSA key pair in the ring. Retired keys carry no private
+// half when they were loaded from a public key file.
+type SigningKey struct {
+	ID        string
+	Private   *rsa.PrivateKey
+	Public    *rsa.PublicKey
+	PEM       []byte
+	RetiredAt time.Time
+}
+
+// KeyRing holds the active signing key plus retired keys that are still
+// accepted for verification until every token they signed has expired.
+type KeyRing struct {
+	mu        sync.RWMutex
+	active    *SigningKey
+	keys      map[string]*SigningKey
+	retention time.Duration
+	now       func() time.Time
+}
+
+func NewKeyRing(retention time.Duration) *KeyRing {
+	return &KeyRing{
+		keys:      make(map[string]*SigningKey),
+		retention: retention,
+		now:       time.Now,
+	}
+}
+
+// Rotate makes priv the active signing key. The previously active key is
+// retired and kept for verification for the retention window.
+func (r *KeyRing) Rotate(priv *rsa.PrivateKey) (*SigningKey, error) {
+	key, err := newSigningKey(priv.Public().(*rsa.PublicKey))
+	if err != nil {
+		return nil, err
+	}
+	key.Private = priv
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.now()
+	if r.active != nil && r.active.ID != key.ID {
+		r.active.RetiredAt = now
+	}
+	r.active = key
+	r.keys[key.ID] = key
+	r.pruneLocked(now)
+	return key, nil
+}
+
+// AddVerificationKey registers a public key that was used before this process
+// started. It is treated as retired as of now, so it stops verifying once the
+// retention window has passed.
+func (r *KeyRing) AddVerificationKey(pub *rsa.PublicKey) (*SigningKey, error) {
+	key, err := newSigningKey(pub)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if existing, ok := r.keys[key.ID]; ok {
+		return existing, nil
+	}
+	key.RetiredAt = r.now()
+	r.keys[key.ID] = key
+	return key, nil
+}
+
+// Active returns the key new tokens are signed with.
+func (r *KeyRing) Active() *SigningKey {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.active
+}
+
+// Lookup returns the key for kid if it is active or still inside its
+// retention window.
+func (r *KeyRing) Lookup(kid string) (*SigningKey, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	key, ok := r.keys[kid]
+	if !ok || r.expiredLocked(key, r.now()) {
+		return nil, ErrUnknownSigningKey
+	}
+	return key, nil
+}
+
+// VerificationKeys returns the active key followed by every retired key that
+// is still accepted, newest retirement first.
+func (r *KeyRing) VerificationKeys() []*SigningKey {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	now := r.now()
+	var retired []*SigningKey
+	for _, k := range r.keys {
+		if k != r.active && !r.expiredLocked(k, now) {
+			retired = append(retired, k)
+		}
+	}
+	sort.Slice(retired, func(i, j int) bool { return retired[i].RetiredAt.After(retired[j].RetiredAt) })
+
+	out := make([]*SigningKey, 0, len(retired)+1)
+	if r.active != nil {
+		out = append(out, r.active)
+	}
+	return append(out, retired...)
+}
+
+// JWKS renders the verification keys as a JWK Set.
+func (r *KeyRing) JWKS() *jwk.Set {
+	keys := r.VerificationKeys()
+	set := &jwk.Set{Keys: make([]jwk.Key, 0, len(keys))}
+	for _, k := range keys {
+		set.Keys = append(set.Keys, jwk.FromRSAPublicKey(k.ID, k.Public))
+	}
+	return set
+}
+
+func (r *KeyRing) expiredLocked(k *SigningKey, now time.Time) bool {
+	return !k.RetiredAt.IsZero() && now.Sub(k.RetiredAt) > r.retention
+}
+
+func (r *KeyRing) pruneLocked(now time.Time) {
+	for id, k := range r.keys {
+		if k != r.active && r.expiredLocked(k, now) {
+			delete(r.keys, id)
+		}
+	}
+}
+
+func newSigningKey(pub *rsa.PublicKey) (*SigningKey, error) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return nil, err
+	}
+	return &SigningKey{
+		ID:     jwk.Thumbprint(pub),
+		Public: pub,
+		PEM:    pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}),
+	}, nil
+}
@@ -0,0 +1,149 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func generateKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate rsa key: %v", err)
+	}
+	return key
+}
+
+func TestKeyRing_RotateRetainsPreviousKey(t *testing.T) {
+	now := time.Now()
+	ring := NewKeyRing(time.Minute)
+	ring.now = func() time.Time { return now }
+
+	first, err := ring.Rotate(generateKey(t))
+	if err != nil {
+		t.Fatalf("rotate failed: %v", err)
+	}
+	second, err := ring.Rotate(generateKey(t))
+	if err != nil {
+		t.Fatalf("rotate failed: %v", err)
+	}
+
+	if ring.Active().ID != second.ID {
+		t.Fatalf("expected second key to be active")
+	}
+	if _, err := ring.Lookup(first.ID); err != nil {
+		t.Fatalf("retired key should still verify: %v", err)
+	}
+	if got := len(ring.JWKS().Keys); got != 2 {
+		t.Fatalf("expected 2 published keys, got %d", got)
+	}
+
+	now = now.Add(2 * time.Minute)
+	if _, err := ring.Lookup(first.ID); !errors.Is(err, ErrUnknownSigningKey) {
+		t.Fatalf("expected retired key to expire, got %v", err)
+	}
+	if _, err := ring.Lookup(second.ID); err != nil {
+		t.Fatalf("active key must never expire: %v", err)
+	}
+	if got := len(ring.JWKS().Keys); got != 1 {
+		t.Fatalf("expected 1 published key after retention, got %d", got)
+	}
+}
+
+func TestJWTTokenService_RotationKeepsOldTokensValid(t *testing.T) {
+	pub, priv := setupKeys(t)
+	s, err := NewJWTTokenService(nil, pub, priv, "refresh-secret-test")
+	if err != nil {
+		t.Fatalf("failed to create token service: %v", err)
+	}
+
+	oldToken, err := s.GenerateAccessToken(1)
+	if err != nil {
+		t.Fatalf("generate failed: %v", err)
+	}
+	parsed, _, err := jwt.NewParser().ParseUnverified(oldToken, jwt.MapClaims{})
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	oldKid, _ := parsed.Header["kid"].(string)
+	if oldKid == "" {
+		t.Fatalf("expected kid header on access token")
+	}
+
+	newKid, err := s.RotateSigningKey(generateKey(t))
+	if err != nil {
+		t.Fatalf("rotate failed: %v", err)
+	}
+	if newKid == oldKid {
+		t.Fatalf("expected a new kid after rotation")
+	}
+
+	newToken, _ := s.GenerateAccessToken(2)
+	for tok, want := range map[string]int64{oldToken: 1, newToken: 2} {
+		uid, err := s.VerifyToken(context.Background(), tok)
+		if err != nil || uid != want {
+			t.Fatalf("expected uid %d, got %d (err %v)", want, uid, err)
+		}
+	}
+
+	pemBytes, _ := s.GetPublicKeyPEM()
+	pubKey, err := jwt.ParseRSAPublicKeyFromPEM(pemBytes)
+	if err != nil {
+		t.Fatalf("public key PEM invalid: %v", err)
+	}
+	if !pubKey.Equal(s.keyRing().Active().Public) {
+		t.Fatalf("GetPublicKeyPEM should return the active key")
+	}
+}
+
+func TestJWTTokenService_RejectsUnknownKid(t *testing.T) {
+	pub, priv := setupKeys(t)
+	s, err := NewJWTTokenService(nil, pub, priv, "refresh-secret-test")
+	if err != nil {
+		t.Fatalf("failed to create token service: %v", err)
+	}
+
+	tok := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{"userId": 1, "exp": time.Now().Add(time.Minute).Unix()})
+	tok.Header["kid"] = "not-a-key"
+	signed, _ := tok.SignedString(s.AccessSecret)
+	if _, err := s.VerifyToken(context.Background(), signed); err == nil {
+		t.Fatalf("expected unknown kid to be rejected")
+	}
+}
+
+func TestJWTTokenService_ReloadSigningKey(t *testing.T) {
+	pub, priv := setupKeys(t)
+	s, err := NewJWTTokenService(nil, pub, priv, "refresh-secret-test")
+	if err != nil {
+		t.Fatalf("failed to create token service: %v", err)
+	}
+
+	kid, rotated, err := s.ReloadSigningKey()
+	if err != nil || rotated {
+		t.Fatalf("reload of unchanged key should be a no-op (rotated=%v, err=%v)", rotated, err)
+	}
+
+	next := generateKey(t)
+	keyPem := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(next)})
+	if err := os.WriteFile(priv, keyPem, 0600); err != nil {
+		t.Fatalf("failed to write key: %v", err)
+	}
+
+	newKid, rotated, err := s.ReloadSigningKey()
+	if err != nil || !rotated || newKid == kid {
+		t.Fatalf("expected rotation to new key (rotated=%v, err=%v)", rotated, err)
+	}
+	set, _ := s.GetJWKS()
+	if len(set.Keys) != 2 || set.Keys[0].Kid != newKid {
+		t.Fatalf("expected JWKS to list new key first, got %+v", set.Keys)
+	}
+}
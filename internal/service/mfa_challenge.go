@@ -0,0 +1,84 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/Prashant2307200/auth-service/internal/entity"
+	"github.com/redis/go-redis/v9"
+)
+
+const mfaChallengePrefix = "mfa_challenge:"
+
+var ErrMFAChallengeNotFound = errors.New("mfa challenge not found")
+
+// MFAChallengeStore keeps pending MFA challenges in Redis, keyed by the hash
+// of the challenge token handed to the client.
+type MFAChallengeStore struct {
+	rdb *redis.Client
+}
+
+func NewMFAChallengeStore(rdb *redis.Client) *MFAChallengeStore {
+	return &MFAChallengeStore{rdb: rdb}
+}
+
+func (s *MFAChallengeStore) Save(ctx context.Context, tokenHash string, challenge *entity.MFAChallenge, ttl time.Duration) error {
+	key := mfaChallengePrefix + tokenHash
+	pipe := s.rdb.TxPipeline()
+	pipe.HSet(ctx, key, "user_id", challenge.UserID, "method", challenge.Method, "attempts", challenge.Attempts)
+	pipe.Expire(ctx, key, ttl)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to store mfa challenge: %w", err)
+	}
+	return nil
+}
+
+func (s *MFAChallengeStore) Get(ctx context.Context, tokenHash string) (*entity.MFAChallenge, error) {
+	fields, err := s.rdb.HGetAll(ctx, mfaChallengePrefix+tokenHash).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get mfa challenge: %w", err)
+	}
+	if len(fields) == 0 {
+		return nil, ErrMFAChallengeNotFound
+	}
+
+	userID, err := strconv.ParseInt(fields["user_id"], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid mfa challenge: %w", err)
+	}
+	attempts, _ := strconv.Atoi(fields["attempts"])
+
+	return &entity.MFAChallenge{UserID: userID, Method: fields["method"], Attempts: attempts}, nil
+}
+
+// incrementAttemptsScript counts an attempt only while the challenge exists:
+// HINCRBY on an expired key would recreate it, half filled and without a TTL.
+var incrementAttemptsScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return -1
+end
+return redis.call('HINCRBY', KEYS[1], 'attempts', 1)
+`)
+
+// IncrementAttempts records a failed code and returns the new attempt count,
+// or ErrMFAChallengeNotFound once the challenge has expired.
+func (s *MFAChallengeStore) IncrementAttempts(ctx context.Context, tokenHash string) (int, error) {
+	n, err := incrementAttemptsScript.Run(ctx, s.rdb, []string{mfaChallengePrefix + tokenHash}).Int()
+	if err != nil {
+		return 0, fmt.Errorf("failed to record mfa challenge attempt: %w", err)
+	}
+	if n < 0 {
+		return 0, ErrMFAChallengeNotFound
+	}
+	return n, nil
+}
+
+// Delete removes the challenge and reports whether this call removed it, so
+// concurrent completions of the same challenge succeed at most once.
+func (s *MFAChallengeStore) Delete(ctx context.Context, tokenHash string) (bool, error) {
+	n, err := s.rdb.Del(ctx, mfaChallengePrefix+tokenHash).Result()
+	return n == 1, err
+}
@@ -0,0 +1,39 @@
+package service
+
+import (
+	"context"
+	"testing"
+)
+
+type reencryptBatch struct {
+	rewritten int
+	failed    []int64
+	lastID    int64
+}
+
+// batchSecretStore answers each ReencryptSecrets call with the next batch.
+type batchSecretStore struct {
+	batches  []reencryptBatch
+	afterIDs []int64
+}
+
+func (s *batchSecretStore) ReencryptSecrets(_ context.Context, afterID int64, _ int) (int, []int64, int64, error) {
+	b := s.batches[len(s.afterIDs)]
+	s.afterIDs = append(s.afterIDs, afterID)
+	return b.rewritten, b.failed, b.lastID, nil
+}
+
+func TestMFASecretReencrypter_SkipsUndecryptableRows(t *testing.T) {
+	store := &batchSecretStore{batches: []reencryptBatch{
+		{rewritten: 1, failed: []int64{3}, lastID: 3},
+		{rewritten: 2},
+	}}
+
+	n, failed, err := NewMFASecretReencrypter(store).RunOnce(context.Background())
+	if err != nil || n != 3 || failed != 1 {
+		t.Fatalf("RunOnce() = %d, %d, %v; want 3, 1, nil", n, failed, err)
+	}
+	if len(store.afterIDs) != 2 || store.afterIDs[1] != 3 {
+		t.Fatalf("expected the second batch to start after the bad row, got %v", store.afterIDs)
+	}
+}
@@ -0,0 +1,25 @@
+package service
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMFAThrottlePolicy_Lockout(t *testing.T) {
+	p := DefaultMFAThrottlePolicy
+	cases := map[int]time.Duration{
+		1:  0,
+		5:  0,
+		6:  30 * time.Second,
+		7:  time.Minute,
+		8:  2 * time.Minute,
+		10: 8 * time.Minute,
+		11: 15 * time.Minute,
+		50: 15 * time.Minute,
+	}
+	for failures, want := range cases {
+		if got := p.Lockout(failures); got != want {
+			t.Fatalf("Lockout(%d) = %v, want %v", failures, got, want)
+		}
+	}
+}
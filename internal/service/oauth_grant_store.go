@@ -0,0 +1,222 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Prashant2307200/auth-service/internal/entity"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	oauthRequestPrefix    = "oauth_request:"
+	oauthCodePrefix       = "oauth_code:"
+	oauthDevicePrefix     = "oauth_device:"
+	oauthUserCodePrefix   = "oauth_user_code:"
+	oauthDevicePollPrefix = "oauth_device_poll:"
+)
+
+// OAuthGrantStore keeps authorization requests awaiting consent, issued
+// authorization codes and device authorizations in Redis, keyed by the hash
+// of the handle given out. Unknown or expired handles return nil and no error.
+type OAuthGrantStore struct {
+	rdb *redis.Client
+}
+
+func NewOAuthGrantStore(rdb *redis.Client) *OAuthGrantStore {
+	return &OAuthGrantStore{rdb: rdb}
+}
+
+func (s *OAuthGrantStore) SaveRequest(ctx context.Context, id string, req *entity.OAuthAuthorizationRequest, ttl time.Duration) error {
+	return s.save(ctx, oauthRequestPrefix+hashHandle(id), req, ttl)
+}
+
+func (s *OAuthGrantStore) GetRequest(ctx context.Context, id string) (*entity.OAuthAuthorizationRequest, error) {
+	var req entity.OAuthAuthorizationRequest
+	data, err := s.rdb.Get(ctx, oauthRequestPrefix+hashHandle(id)).Bytes()
+	if found, err := decodeGrant(data, err, &req); !found || err != nil {
+		return nil, err
+	}
+	return &req, nil
+}
+
+// DeleteRequest removes the request and reports whether this call removed
+// it, so a consent decision is applied at most once.
+func (s *OAuthGrantStore) DeleteRequest(ctx context.Context, id string) (bool, error) {
+	n, err := s.rdb.Del(ctx, oauthRequestPrefix+hashHandle(id)).Result()
+	return n == 1, err
+}
+
+func (s *OAuthGrantStore) SaveCode(ctx context.Context, code string, grant *entity.OAuthAuthorizationCode, ttl time.Duration) error {
+	return s.save(ctx, oauthCodePrefix+hashHandle(code), grant, ttl)
+}
+
+// TakeCode returns and deletes the code's grant in one step; a code can be
+// redeemed at most once.
+func (s *OAuthGrantStore) TakeCode(ctx context.Context, code string) (*entity.OAuthAuthorizationCode, error) {
+	var grant entity.OAuthAuthorizationCode
+	data, err := s.rdb.GetDel(ctx, oauthCodePrefix+hashHandle(code)).Bytes()
+	if found, err := decodeGrant(data, err, &grant); !found || err != nil {
+		return nil, err
+	}
+	return &grant, nil
+}
+
+// SaveDeviceGrant stores the grant under the device code and indexes it by
+// its user code. It reports false, storing nothing, when the user code is
+// already in use.
+func (s *OAuthGrantStore) SaveDeviceGrant(ctx context.Context, deviceCode string, grant *entity.OAuthDeviceGrant, ttl time.Duration) (bool, error) {
+	data, err := json.Marshal(grant)
+	if err != nil {
+		return false, err
+	}
+	key := oauthDevicePrefix + hashHandle(deviceCode)
+	ok, err := s.rdb.SetNX(ctx, oauthUserCodePrefix+hashHandle(grant.UserCode), key, ttl).Result()
+	if err != nil || !ok {
+		return false, err
+	}
+	if err := s.rdb.Set(ctx, key, data, ttl).Err(); err != nil {
+		return false, fmt.Errorf("failed to store oauth grant: %w", err)
+	}
+	return true, nil
+}
+
+func (s *OAuthGrantStore) GetDeviceGrant(ctx context.Context, deviceCode string) (*entity.OAuthDeviceGrant, error) {
+	return s.getDeviceGrant(ctx, oauthDevicePrefix+hashHandle(deviceCode))
+}
+
+func (s *OAuthGrantStore) GetDeviceGrantByUserCode(ctx context.Context, userCode string) (*entity.OAuthDeviceGrant, error) {
+	key, err := s.rdb.Get(ctx, oauthUserCodePrefix+hashHandle(userCode)).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get oauth grant: %w", err)
+	}
+	return s.getDeviceGrant(ctx, key)
+}
+
+// decideDeviceScript replaces the grant a user code refers to only while the
+// stored grant is still pending, so two decisions racing for one code cannot
+// both be stored.
+var decideDeviceScript = redis.NewScript(`
+local key = redis.call('GET', KEYS[1])
+if not key then
+	return 0
+end
+local data = redis.call('GET', key)
+if not data or cjson.decode(data)['status'] ~= ARGV[1] then
+	return 0
+end
+redis.call('SET', key, ARGV[2], 'KEEPTTL')
+return 1
+`)
+
+// DecideDeviceGrant replaces the pending grant the user code refers to,
+// keeping its expiry. It reports false when the grant has expired or was
+// already decided.
+func (s *OAuthGrantStore) DecideDeviceGrant(ctx context.Context, userCode string, grant *entity.OAuthDeviceGrant) (bool, error) {
+	data, err := json.Marshal(grant)
+	if err != nil {
+		return false, err
+	}
+	n, err := decideDeviceScript.Run(ctx, s.rdb, []string{oauthUserCodePrefix + hashHandle(userCode)},
+		string(entity.OAuthDevicePending), data).Int()
+	if err != nil {
+		return false, fmt.Errorf("failed to store oauth grant: %w", err)
+	}
+	return n == 1, nil
+}
+
+// TakeDeviceGrant returns and deletes the grant, with its user code, in one
+// step; an approval can be redeemed at most once.
+func (s *OAuthGrantStore) TakeDeviceGrant(ctx context.Context, deviceCode string) (*entity.OAuthDeviceGrant, error) {
+	var grant entity.OAuthDeviceGrant
+	data, err := s.rdb.GetDel(ctx, oauthDevicePrefix+hashHandle(deviceCode)).Bytes()
+	if found, err := decodeGrant(data, err, &grant); !found || err != nil {
+		return nil, err
+	}
+	if err := s.rdb.Del(ctx, oauthUserCodePrefix+hashHandle(grant.UserCode)).Err(); err != nil {
+		return nil, fmt.Errorf("failed to delete oauth user code: %w", err)
+	}
+	return &grant, nil
+}
+
+// devicePollScript keeps the device's current interval and the time of its
+// last poll, in milliseconds, for as long as the grant lives. A poll within
+// the interval is refused and lengthens the interval by ARGV[2] (RFC 8628
+// §3.5).
+var devicePollScript = redis.NewScript(`
+local ttl = redis.call('PTTL', KEYS[2])
+if ttl <= 0 then
+	return 1
+end
+local t = redis.call('TIME')
+local now = t[1] * 1000 + math.floor(t[2] / 1000)
+local interval = tonumber(redis.call('HGET', KEYS[1], 'interval') or ARGV[1])
+local last = tonumber(redis.call('HGET', KEYS[1], 'last') or 0)
+local allowed = 1
+if last > 0 and now - last < interval then
+	interval = interval + tonumber(ARGV[2])
+	allowed = 0
+end
+redis.call('HSET', KEYS[1], 'interval', interval, 'last', now)
+redis.call('PEXPIRE', KEYS[1], ttl)
+return allowed
+`)
+
+// AllowDevicePoll reports whether the device may poll now, that is whether
+// its interval has passed since it last polled. A device that polls too early
+// must wait backoff longer from then on. An expired grant is always allowed
+// through so that the poll learns the code has expired.
+func (s *OAuthGrantStore) AllowDevicePoll(ctx context.Context, deviceCode string, interval, backoff time.Duration) (bool, error) {
+	keys := []string{oauthDevicePollPrefix + hashHandle(deviceCode), oauthDevicePrefix + hashHandle(deviceCode)}
+	n, err := devicePollScript.Run(ctx, s.rdb, keys, interval.Milliseconds(), backoff.Milliseconds()).Int()
+	if err != nil {
+		return false, fmt.Errorf("failed to record device poll: %w", err)
+	}
+	return n == 1, nil
+}
+
+func (s *OAuthGrantStore) getDeviceGrant(ctx context.Context, key string) (*entity.OAuthDeviceGrant, error) {
+	var grant entity.OAuthDeviceGrant
+	data, err := s.rdb.Get(ctx, key).Bytes()
+	if found, err := decodeGrant(data, err, &grant); !found || err != nil {
+		return nil, err
+	}
+	return &grant, nil
+}
+
+func (s *OAuthGrantStore) save(ctx context.Context, key string, v any, ttl time.Duration) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if err := s.rdb.Set(ctx, key, data, ttl).Err(); err != nil {
+		return fmt.Errorf("failed to store oauth grant: %w", err)
+	}
+	return nil
+}
+
+func decodeGrant(data []byte, err error, v any) (bool, error) {
+	if errors.Is(err, redis.Nil) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to get oauth grant: %w", err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return false, fmt.Errorf("invalid oauth grant: %w", err)
+	}
+	return true, nil
+}
+
+func hashHandle(handle string) string {
+	sum := sha256.Sum256([]byte(handle))
+	return hex.EncodeToString(sum[:])
+}
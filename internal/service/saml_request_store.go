@@ -0,0 +1,62 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Prashant2307200/auth-service/internal/entity"
+	"github.com/redis/go-redis/v9"
+)
+
+const samlRequestPrefix = "saml_request:"
+
+var ErrSAMLRequestNotFound = errors.New("saml request not found")
+
+// SAMLRequestStore keeps the IDs of AuthnRequests sent to identity providers
+// in Redis until their Response arrives. Responses are posted cross-site, so
+// unlike other sign-in state this cannot live in a SameSite cookie.
+type SAMLRequestStore struct {
+	rdb *redis.Client
+}
+
+func NewSAMLRequestStore(rdb *redis.Client) *SAMLRequestStore {
+	return &SAMLRequestStore{rdb: rdb}
+}
+
+func (s *SAMLRequestStore) Save(ctx context.Context, id string, req *entity.SAMLRequest, ttl time.Duration) error {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	if err := s.rdb.Set(ctx, samlRequestKey(id), data, ttl).Err(); err != nil {
+		return fmt.Errorf("failed to store saml request: %w", err)
+	}
+	return nil
+}
+
+// Take returns and deletes the request in one step, so each request is
+// answered at most once.
+func (s *SAMLRequestStore) Take(ctx context.Context, id string) (*entity.SAMLRequest, error) {
+	data, err := s.rdb.GetDel(ctx, samlRequestKey(id)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrSAMLRequestNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get saml request: %w", err)
+	}
+	var req entity.SAMLRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		return nil, fmt.Errorf("invalid saml request: %w", err)
+	}
+	return &req, nil
+}
+
+func samlRequestKey(id string) string {
+	sum := sha256.Sum256([]byte(id))
+	return samlRequestPrefix + hex.EncodeToString(sum[:])
+}
@@ -7,15 +7,15 @@ import (
 	"strings"
 	"time"
 
-	"github.com/google/uuid"
 	"github.com/Prashant2307200/auth-service/internal/entity"
+	"github.com/google/uuid"
 	"github.com/redis/go-redis/v9"
 )
 
 const (
-	sessionPrefix     = "session:"
+	sessionPrefix      = "session:"
 	userSessionsPrefix = "user_sessions:"
-	sessionTTL        = 7 * 24 * time.Hour
+	sessionTTL         = 7 * 24 * time.Hour
 )
 
 type SessionService struct {
@@ -27,32 +27,32 @@ func NewSessionService(rdb *redis.Client) *SessionService {
 }
 
 type sessionData struct {
-	ID           string    `json:"id"`
-	UserID       int64     `json:"user_id"`
-	RefreshToken string    `json:"refresh_token"`
-	DeviceInfo   string    `json:"device_info"`
-	IPAddress    string    `json:"ip_address"`
-	UserAgent    string    `json:"user_agent"`
-	CreatedAt    time.Time `json:"created_at"`
-	LastUsedAt   time.Time `json:"last_used_at"`
-	ExpiresAt    time.Time `json:"expires_at"`
+	ID         string    `json:"id"`
+	UserID     int64     `json:"user_id"`
+	DeviceInfo string    `json:"device_info"`
+	IPAddress  string    `json:"ip_address"`
+	UserAgent  string    `json:"user_agent"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
 }
 
-func (s *SessionService) CreateSession(ctx context.Context, userID int64, refreshToken, deviceInfo, ipAddress, userAgent string) (*entity.UserSession, error) {
+// CreateSession records a new device session. The session's refresh token is
+// stored separately by the token service under the session ID.
+func (s *SessionService) CreateSession(ctx context.Context, userID int64, deviceInfo, ipAddress, userAgent string) (*entity.UserSession, error) {
 	sessionID := uuid.New().String()
 	now := time.Now()
 	expiresAt := now.Add(sessionTTL)
 
 	data := sessionData{
-		ID:           sessionID,
-		UserID:       userID,
-		RefreshToken: refreshToken,
-		DeviceInfo:   deviceInfo,
-		IPAddress:    ipAddress,
-		UserAgent:    userAgent,
-		CreatedAt:    now,
-		LastUsedAt:   now,
-		ExpiresAt:    expiresAt,
+		ID:         sessionID,
+		UserID:     userID,
+		DeviceInfo: deviceInfo,
+		IPAddress:  ipAddress,
+		UserAgent:  userAgent,
+		CreatedAt:  now,
+		LastUsedAt: now,
+		ExpiresAt:  expiresAt,
 	}
 
 	jsonData, err := json.Marshal(data)
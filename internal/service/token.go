@@ -6,21 +6,53 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/Prashant2307200/auth-service/internal/usecase/interfaces"
+	"github.com/Prashant2307200/auth-service/pkg/jwk"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/redis/go-redis/v9"
 	"go.opentelemetry.io/otel"
 )
 
+const (
+	AccessTokenTTL  = 15 * time.Minute
+	RefreshTokenTTL = 7 * 24 * time.Hour
+
+	refreshTokenPrefix  = "refresh_token:"
+	refreshFamilyPrefix = "refresh_family:"
+)
+
+// JWTTokenService signs access tokens with the active key of its KeyRing.
+// PublicAccessSecret and AccessSecret are the key pair loaded at startup and
+// seed the ring; after a rotation they no longer reflect the signing key.
 type JWTTokenService struct {
 	PublicAccessSecret *rsa.PublicKey
 	AccessSecret       *rsa.PrivateKey
 	RefreshSecret      string
 	Rdb                *redis.Client
-	publicKeyPEM       []byte
-	metrics            *TokenMetrics
+	// Denylist, when set, is checked for every access token that verifies.
+	Denylist AccessTokenDenylist
+	// Issuer is the iss of ID tokens and of access tokens issued to OAuth
+	// clients: the public base URL of this service.
+	Issuer  string
+	metrics *TokenMetrics
+
+	privateKeyPath string
+	keys           *KeyRing
+	keysOnce       sync.Once
+}
+
+// AccessTokenDenylist records access tokens revoked before they expire.
+type AccessTokenDenylist interface {
+	RevokeToken(ctx context.Context, tokenID string, expiresAt time.Time) error
+	RevokeSession(ctx context.Context, sessionID string) error
+	IsRevoked(ctx context.Context, tokenID, sessionID string) (bool, error)
 }
 
 type TokenMetrics struct {
@@ -66,44 +98,201 @@ func NewJWTTokenService(rdb *redis.Client, publicAccessSecretPath, accessSecretP
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse RSA public key from %s: %w", publicAccessSecretPath, err)
 	}
+	if !publicAccessSecret.Equal(accessSecret.Public()) {
+		return nil, fmt.Errorf("public key %s does not match private key %s", publicAccessSecretPath, accessSecretPath)
+	}
 
 	metrics, _ := NewTokenMetrics()
 
-	return &JWTTokenService{
+	s := &JWTTokenService{
 		PublicAccessSecret: publicAccessSecret,
 		AccessSecret:       accessSecret,
 		RefreshSecret:      refreshSecret,
 		Rdb:                rdb,
-		publicKeyPEM:       publicAccessSecretBytes,
 		metrics:            metrics,
-	}, nil
+		privateKeyPath:     accessSecretPath,
+	}
+	if s.keyRing().Active() == nil {
+		return nil, errors.New("failed to initialize key ring")
+	}
+	return s, nil
+}
+
+// keyRing returns the service's key ring, creating it on first use and
+// seeding it with AccessSecret, so struct-literal services work as well.
+func (s *JWTTokenService) keyRing() *KeyRing {
+	s.keysOnce.Do(func() {
+		s.keys = NewKeyRing(AccessTokenTTL + verificationSkew)
+		if s.AccessSecret != nil {
+			_, _ = s.keys.Rotate(s.AccessSecret)
+		}
+	})
+	return s.keys
+}
+
+// RotateSigningKey makes priv the signing key for new access tokens. Tokens
+// signed with the previous key keep verifying until they expire.
+func (s *JWTTokenService) RotateSigningKey(priv *rsa.PrivateKey) (string, error) {
+	key, err := s.keyRing().Rotate(priv)
+	if err != nil {
+		return "", err
+	}
+	return key.ID, nil
+}
+
+// ReloadSigningKey re-reads the private key file and rotates to it if it
+// changed. It is safe to call repeatedly, e.g. on SIGHUP.
+func (s *JWTTokenService) ReloadSigningKey() (string, bool, error) {
+	if s.privateKeyPath == "" {
+		return "", false, errors.New("no private key path configured")
+	}
+	keyBytes, err := os.ReadFile(s.privateKeyPath)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to read private key file %s: %w", s.privateKeyPath, err)
+	}
+	priv, err := jwt.ParseRSAPrivateKeyFromPEM(keyBytes)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to parse RSA private key from %s: %w", s.privateKeyPath, err)
+	}
+
+	if active := s.keyRing().Active(); active != nil && active.ID == jwk.Thumbprint(&priv.PublicKey) {
+		return active.ID, false, nil
+	}
+	kid, err := s.RotateSigningKey(priv)
+	return kid, err == nil, err
+}
+
+// LoadRetiredPublicKeys adds public keys of previously used signing keys so
+// tokens they signed before a restart still verify for one access-token TTL.
+func (s *JWTTokenService) LoadRetiredPublicKeys(paths []string) error {
+	for _, path := range paths {
+		keyBytes, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read public key file %s: %w", path, err)
+		}
+		pub, err := jwt.ParseRSAPublicKeyFromPEM(keyBytes)
+		if err != nil {
+			return fmt.Errorf("failed to parse RSA public key from %s: %w", path, err)
+		}
+		if _, err := s.keyRing().AddVerificationKey(pub); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GenerateRefreshToken issues a refresh token bound to one session, so each
+// device rotates and revokes its own token.
+func (s *JWTTokenService) GenerateRefreshToken(userID int64, sessionID string) (string, error) {
+	return generateJWT(fmt.Sprint(userID), sessionID, s.RefreshSecret, RefreshTokenTTL)
+}
+
+// StoreRefreshToken makes token the current refresh token of the session and
+// records it in the session's token family with the token it replaces as its
+// parent. Every token ever issued to the session stays in the family until the
+// session ends, which is what lets a replayed rotated token be recognised.
+func (s *JWTTokenService) StoreRefreshToken(ctx context.Context, sessionID string, token string) error {
+	tokenID, err := refreshTokenID(token)
+	if err != nil {
+		return err
+	}
+
+	var parentID string
+	prev, err := s.Rdb.Get(ctx, refreshTokenKey(sessionID)).Result()
+	switch {
+	case err == nil:
+		parentID, _ = refreshTokenID(prev)
+	case !errors.Is(err, redis.Nil):
+		return fmt.Errorf("failed to read current refresh token: %w", err)
+	}
+
+	pipe := s.Rdb.TxPipeline()
+	pipe.Set(ctx, refreshTokenKey(sessionID), token, RefreshTokenTTL)
+	pipe.HSet(ctx, refreshFamilyKey(sessionID), tokenID, parentID)
+	pipe.Expire(ctx, refreshFamilyKey(sessionID), RefreshTokenTTL)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// rotateRefreshScript swaps the session's refresh token only while the
+// presented token is still the stored one, so two refreshes racing with the
+// same token cannot both win.
+var rotateRefreshScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) ~= ARGV[1] then
+	return 0
+end
+redis.call('SET', KEYS[1], ARGV[2], 'PX', ARGV[5])
+redis.call('HSET', KEYS[2], ARGV[3], ARGV[4])
+redis.call('PEXPIRE', KEYS[2], ARGV[5])
+return 1
+`)
+
+// RotateRefreshToken replaces current with next as the session's refresh token
+// and records next in the family with current as its parent, in one step. It
+// reports false and changes nothing when current is no longer the stored token.
+func (s *JWTTokenService) RotateRefreshToken(ctx context.Context, sessionID, current, next string) (bool, error) {
+	nextID, err := refreshTokenID(next)
+	if err != nil {
+		return false, err
+	}
+	parentID, _ := refreshTokenID(current)
+
+	keys := []string{refreshTokenKey(sessionID), refreshFamilyKey(sessionID)}
+	n, err := rotateRefreshScript.Run(ctx, s.Rdb, keys, current, next, nextID, parentID, RefreshTokenTTL.Milliseconds()).Int()
+	if err != nil {
+		return false, fmt.Errorf("failed to rotate refresh token: %w", err)
+	}
+	return n == 1, nil
+}
+
+// IsRefreshTokenInFamily reports whether tokenID was ever issued to the session.
+func (s *JWTTokenService) IsRefreshTokenInFamily(ctx context.Context, sessionID, tokenID string) (bool, error) {
+	if tokenID == "" {
+		return false, nil
+	}
+	return s.Rdb.HExists(ctx, refreshFamilyKey(sessionID), tokenID).Result()
 }
 
-func (s *JWTTokenService) GenerateRefreshToken(userID int64) (string, error) {
-	return generateJWT(fmt.Sprint(userID), s.RefreshSecret, 7*24*time.Hour)
+func (s *JWTTokenService) GetRefreshToken(ctx context.Context, sessionID string) (string, error) {
+	return s.Rdb.Get(ctx, refreshTokenKey(sessionID)).Result()
 }
 
-func (s *JWTTokenService) StoreRefreshToken(ctx context.Context, userID int64, token string) error {
-	return s.Rdb.Set(ctx, fmt.Sprint(userID), token, 7*24*time.Hour).Err()
+// RemoveRefreshToken drops the session's current refresh token and its family.
+func (s *JWTTokenService) RemoveRefreshToken(ctx context.Context, sessionID string) error {
+	return s.Rdb.Del(ctx, refreshTokenKey(sessionID), refreshFamilyKey(sessionID)).Err()
 }
 
-func (s *JWTTokenService) GetRefreshToken(ctx context.Context, userID int64) (string, error) {
-	return s.Rdb.Get(ctx, fmt.Sprint(userID)).Result()
+func refreshTokenKey(sessionID string) string {
+	return refreshTokenPrefix + sessionID
 }
 
-func (s *JWTTokenService) RemoveRefreshToken(ctx context.Context, userID int64) error {
-	return s.Rdb.Del(ctx, fmt.Sprint(userID)).Err()
+func refreshFamilyKey(sessionID string) string {
+	return refreshFamilyPrefix + sessionID
 }
 
-func generateJWT(userID string, secret string, ttl time.Duration) (string, error) {
+// refreshTokenID reads the jti of a refresh token this service issued. The
+// signature is not checked; callers only pass tokens that were already verified
+// or just generated.
+func refreshTokenID(token string) (string, error) {
+	claims := jwt.MapClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(token, claims); err != nil {
+		return "", fmt.Errorf("failed to parse refresh token: %w", err)
+	}
+	jti, _ := claims["jti"].(string)
+	return jti, nil
+}
+
+func generateJWT(userID, sessionID string, secret string, ttl time.Duration) (string, error) {
 	claims := jwt.MapClaims{
 		"userId": userID,
+		"sid":    sessionID,
+		"jti":    uuid.NewString(),
 		"exp":    time.Now().Add(ttl).Unix(),
 	}
 	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
 }
 
-func (s *JWTTokenService) VerifyRefreshToken(ctx context.Context, tokenStr string) (string, error) {
+func (s *JWTTokenService) VerifyRefreshToken(ctx context.Context, tokenStr string) (*interfaces.RefreshClaims, error) {
 	claims := jwt.MapClaims{}
 
 	token, err := jwt.ParseWithClaims(tokenStr, claims, func(token *jwt.Token) (any, error) {
@@ -114,35 +303,165 @@ func (s *JWTTokenService) VerifyRefreshToken(ctx context.Context, tokenStr strin
 	})
 	if err != nil {
 		if errors.Is(err, jwt.ErrTokenExpired) {
-			return "", jwt.ErrTokenExpired
+			return nil, jwt.ErrTokenExpired
 		}
-		return "", fmt.Errorf("token invalid: %w", err)
+		return nil, fmt.Errorf("token invalid: %w", err)
 	}
 	if !token.Valid {
-		return "", errors.New("token is not valid")
+		return nil, errors.New("token is not valid")
 	}
 
-	userID, ok := claims["userId"].(string)
+	userIDStr, ok := claims["userId"].(string)
 	if !ok {
-		return "", errors.New("invalid token claims")
+		return nil, errors.New("invalid token claims")
+	}
+	userID, err := strconv.ParseInt(userIDStr, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user ID in token: %w", err)
+	}
+	// Tokens issued before per-session refresh have no sid and cannot be rotated.
+	sessionID, ok := claims["sid"].(string)
+	if !ok || sessionID == "" {
+		return nil, errors.New("refresh token has no session")
+	}
+
+	tokenID, _ := claims["jti"].(string)
+	var expiresAt time.Time
+	if exp, err := claims.GetExpirationTime(); err == nil && exp != nil {
+		expiresAt = exp.Time
 	}
 
-	return userID, err
+	return &interfaces.RefreshClaims{UserID: userID, SessionID: sessionID, TokenID: tokenID, ExpiresAt: expiresAt}, nil
 }
 
+// GenerateAccessToken issues an access token outside any session. It gets a
+// sid of its own so it can still be revoked as a whole.
 func (s *JWTTokenService) GenerateAccessToken(userID int64, businessID ...int64) (string, error) {
+	return s.GenerateAccessTokenForSession(userID, uuid.NewString(), businessID...)
+}
+
+func (s *JWTTokenService) GenerateAccessTokenForSession(userID int64, sessionID string, businessID ...int64) (string, error) {
+	now := time.Now()
 	claims := jwt.MapClaims{
 		"userId": userID,
-		"exp":    time.Now().Add(15 * time.Minute).Unix(),
+		"sid":    sessionID,
+		"jti":    uuid.NewString(),
+		"iat":    now.Unix(),
+		"exp":    now.Add(AccessTokenTTL).Unix(),
 	}
 	if len(businessID) > 0 {
 		claims["businessId"] = businessID[0]
 	}
+	return s.signAccessToken(claims)
+}
+
+// GenerateClientAccessToken issues an access token to an OAuth client acting
+// for the user. It has a sid of its own, so revoking it never touches the
+// user's browser sessions, and carries the client as aud and client_id.
+func (s *JWTTokenService) GenerateClientAccessToken(userID int64, clientID string, scopes []string) (string, error) {
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"userId":    userID,
+		"sid":       uuid.NewString(),
+		"jti":       uuid.NewString(),
+		"aud":       clientID,
+		"client_id": clientID,
+		"scope":     strings.Join(scopes, " "),
+		"iat":       now.Unix(),
+		"exp":       now.Add(AccessTokenTTL).Unix(),
+	}
+	if s.Issuer != "" {
+		claims["iss"] = s.Issuer
+	}
+	return s.signAccessToken(claims)
+}
+
+// GenerateServiceAccessToken issues an access token to a service client for
+// the client_credentials grant. Its sub is the client itself; there is no
+// userId claim, and businessId scopes it to the client's business.
+func (s *JWTTokenService) GenerateServiceAccessToken(clientID string, businessID int64, scopes []string) (string, error) {
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"sub":        clientID,
+		"client_id":  clientID,
+		"businessId": businessID,
+		"sid":        uuid.NewString(),
+		"jti":        uuid.NewString(),
+		"scope":      strings.Join(scopes, " "),
+		"iat":        now.Unix(),
+		"exp":        now.Add(AccessTokenTTL).Unix(),
+	}
+	if s.Issuer != "" {
+		claims["iss"] = s.Issuer
+	}
+	return s.signAccessToken(claims)
+}
+
+// GenerateIDToken issues an OpenID Connect ID token for clientID. claims
+// holds the user claims the granted scopes allow; the registered claims are
+// set here. ID tokens have no userId claim, so they never pass as access
+// tokens.
+func (s *JWTTokenService) GenerateIDToken(userID int64, clientID, nonce string, claims map[string]any) (string, error) {
+	now := time.Now()
+	idClaims := jwt.MapClaims{}
+	for k, v := range claims {
+		idClaims[k] = v
+	}
+	idClaims["iss"] = s.Issuer
+	idClaims["sub"] = strconv.FormatInt(userID, 10)
+	idClaims["aud"] = clientID
+	idClaims["iat"] = now.Unix()
+	idClaims["exp"] = now.Add(AccessTokenTTL).Unix()
+	if nonce != "" {
+		idClaims["nonce"] = nonce
+	}
+	return s.signAccessToken(idClaims)
+}
+
+func (s *JWTTokenService) signAccessToken(claims jwt.MapClaims) (string, error) {
+	key := s.keyRing().Active()
+	if key == nil || key.Private == nil {
+		return "", errors.New("no active signing key")
+	}
 	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
-	return token.SignedString(s.AccessSecret)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.Private)
+}
+
+// verificationKey selects the public key for a token by its kid header.
+// Tokens without a kid predate the key ring and were signed by the startup
+// key, so they are held to that key's retention window.
+func (s *JWTTokenService) verificationKey(token *jwt.Token) (any, error) {
+	if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+	kid, ok := token.Header["kid"].(string)
+	if !ok {
+		if s.PublicAccessSecret == nil {
+			return nil, ErrUnknownSigningKey
+		}
+		kid = jwk.Thumbprint(s.PublicAccessSecret)
+	}
+	key, err := s.keyRing().Lookup(kid)
+	if err != nil {
+		return nil, err
+	}
+	return key.Public, nil
 }
 
 func (s *JWTTokenService) VerifyToken(ctx context.Context, tokenStr string) (int64, error) {
+	claims, err := s.VerifyAccessToken(ctx, tokenStr)
+	if err != nil {
+		return 0, err
+	}
+	if claims.IsServiceClient() {
+		return 0, errors.New("token does not belong to a user")
+	}
+	return claims.UserID, nil
+}
+
+// VerifyAccessToken verifies an access token and returns its identity claims.
+func (s *JWTTokenService) VerifyAccessToken(ctx context.Context, tokenStr string) (*interfaces.AccessClaims, error) {
 	tracer := otel.Tracer("auth-service")
 	ctx, span := tracer.Start(ctx, "token.VerifyToken")
 	defer span.End()
@@ -154,24 +473,19 @@ func (s *JWTTokenService) VerifyToken(ctx context.Context, tokenStr string) (int
 		}
 	}()
 
-	token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (any, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return s.PublicAccessSecret, nil
-	})
+	token, err := jwt.Parse(tokenStr, s.verificationKey)
 	if err != nil {
 		if s.metrics != nil {
 			s.metrics.VerificationsTotal.Inc()
 		}
-		return 0, fmt.Errorf("failed to parse token: %w", err)
+		return nil, fmt.Errorf("failed to parse token: %w", err)
 	}
 
 	if !token.Valid {
 		if s.metrics != nil {
 			s.metrics.VerificationsTotal.Inc()
 		}
-		return 0, errors.New("token is not valid")
+		return nil, errors.New("token is not valid")
 	}
 
 	claims, ok := token.Claims.(jwt.MapClaims)
@@ -179,24 +493,82 @@ func (s *JWTTokenService) VerifyToken(ctx context.Context, tokenStr string) (int
 		if s.metrics != nil {
 			s.metrics.VerificationsTotal.Inc()
 		}
-		return 0, errors.New("failed to extract claims from token")
+		return nil, errors.New("failed to extract claims from token")
 	}
 
-	userIDFloat, ok := claims["userId"].(float64)
-	if !ok {
+	userIDFloat, isUser := claims["userId"].(float64)
+	businessID, _ := claims["businessId"].(float64)
+	clientID, _ := claims["client_id"].(string)
+	// Service client tokens have no user: their sub is the client, and they
+	// are always scoped to the client's business.
+	subject, _ := claims["sub"].(string)
+	isService := !isUser && clientID != "" && subject == clientID && businessID > 0
+	if !isUser && !isService {
 		if s.metrics != nil {
 			s.metrics.VerificationsTotal.Inc()
 		}
-		return 0, fmt.Errorf("userId claim not found or invalid type in token")
+		return nil, fmt.Errorf("userId claim not found or invalid type in token")
 	}
 
 	if s.metrics != nil {
 		s.metrics.VerificationsTotal.Inc()
 	}
 
-	return int64(userIDFloat), nil
+	sessionID, _ := claims["sid"].(string)
+	tokenID, _ := claims["jti"].(string)
+	scope, _ := claims["scope"].(string)
+	var expiresAt time.Time
+	if exp, err := claims.GetExpirationTime(); err == nil && exp != nil {
+		expiresAt = exp.Time
+	}
+
+	if s.Denylist != nil {
+		revoked, err := s.Denylist.IsRevoked(ctx, tokenID, sessionID)
+		if err != nil {
+			return nil, err
+		}
+		if revoked {
+			return nil, ErrTokenRevoked
+		}
+	}
+
+	return &interfaces.AccessClaims{
+		UserID:     int64(userIDFloat),
+		SessionID:  sessionID,
+		TokenID:    tokenID,
+		BusinessID: int64(businessID),
+		ExpiresAt:  expiresAt,
+		ClientID:   clientID,
+		Scopes:     strings.Fields(scope),
+	}, nil
+}
+
+// RevokeAccessToken denies one access token until it expires.
+func (s *JWTTokenService) RevokeAccessToken(ctx context.Context, tokenID string, expiresAt time.Time) error {
+	if s.Denylist == nil {
+		return nil
+	}
+	return s.Denylist.RevokeToken(ctx, tokenID, expiresAt)
+}
+
+// RevokeSessionAccessTokens denies every access token issued to the session.
+func (s *JWTTokenService) RevokeSessionAccessTokens(ctx context.Context, sessionID string) error {
+	if s.Denylist == nil {
+		return nil
+	}
+	return s.Denylist.RevokeSession(ctx, sessionID)
 }
 
+// GetPublicKeyPEM returns the PEM of the active signing key.
 func (s *JWTTokenService) GetPublicKeyPEM() ([]byte, error) {
-	return s.publicKeyPEM, nil
+	key := s.keyRing().Active()
+	if key == nil {
+		return nil, errors.New("no active signing key")
+	}
+	return key.PEM, nil
+}
+
+// GetJWKS returns every key currently accepted for verification.
+func (s *JWTTokenService) GetJWKS() (*jwk.Set, error) {
+	return s.keyRing().JWKS(), nil
 }
@@ -0,0 +1,191 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Prashant2307200/auth-service/pkg/bloom"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	revokedTokenPrefix   = "revoked_jti:"
+	revokedSessionPrefix = "revoked_sid:"
+	revocationChannel    = "token_revocations"
+
+	// DefaultDenylistCapacity is how many revocations the local filter is
+	// sized for within one access-token lifetime.
+	DefaultDenylistCapacity = 100_000
+	denylistFalsePositives  = 0.01
+)
+
+// ErrTokenRevoked is returned for an access token that was revoked before it expired.
+var ErrTokenRevoked = errors.New("token has been revoked")
+
+// TokenDenylist records revoked access tokens in Redis, by jti or by the
+// session they belong to, for as long as such a token could still verify.
+//
+// A local Bloom filter of every revocation sits in front of Redis, so tokens
+// that were never revoked, which is almost all of them, are accepted without a
+// round trip. Revocations made by other instances reach the filter over Redis
+// pub/sub, and the filter is rebuilt from Redis periodically, which also drops
+// expired entries and catches up on anything missed while pub/sub was down.
+// Until the first rebuild succeeds every token is checked against Redis.
+type TokenDenylist struct {
+	rdb      *redis.Client
+	capacity int
+
+	filter atomic.Pointer[bloom.Filter]
+	loaded atomic.Bool
+
+	mu   sync.Mutex
+	next *bloom.Filter // filter being rebuilt, if any
+}
+
+func NewTokenDenylist(rdb *redis.Client, capacity int) *TokenDenylist {
+	d := &TokenDenylist{rdb: rdb, capacity: capacity}
+	d.filter.Store(bloom.New(capacity, denylistFalsePositives))
+	return d
+}
+
+// RevokeToken denies the access token with tokenID until expiresAt.
+func (d *TokenDenylist) RevokeToken(ctx context.Context, tokenID string, expiresAt time.Time) error {
+	ttl := time.Until(expiresAt) + verificationSkew
+	if tokenID == "" || ttl <= 0 {
+		return nil
+	}
+	if err := d.rdb.Set(ctx, revokedTokenPrefix+tokenID, 1, ttl).Err(); err != nil {
+		return fmt.Errorf("failed to revoke access token: %w", err)
+	}
+	d.announce(ctx, revokedTokenPrefix+tokenID)
+	return nil
+}
+
+// RevokeSession denies every access token issued to the session so far. The
+// entry outlives the longest-lived access token the session could hold.
+func (d *TokenDenylist) RevokeSession(ctx context.Context, sessionID string) error {
+	if sessionID == "" {
+		return nil
+	}
+	if err := d.rdb.Set(ctx, revokedSessionPrefix+sessionID, 1, AccessTokenTTL+verificationSkew).Err(); err != nil {
+		return fmt.Errorf("failed to revoke session access tokens: %w", err)
+	}
+	d.announce(ctx, revokedSessionPrefix+sessionID)
+	return nil
+}
+
+// IsRevoked reports whether the token with tokenID, or the session it
+// belongs to, has been revoked.
+func (d *TokenDenylist) IsRevoked(ctx context.Context, tokenID, sessionID string) (bool, error) {
+	var keys []string
+	if tokenID != "" && d.mayContain(revokedTokenPrefix+tokenID) {
+		keys = append(keys, revokedTokenPrefix+tokenID)
+	}
+	if sessionID != "" && d.mayContain(revokedSessionPrefix+sessionID) {
+		keys = append(keys, revokedSessionPrefix+sessionID)
+	}
+	if len(keys) == 0 {
+		return false, nil
+	}
+	n, err := d.rdb.Exists(ctx, keys...).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to check token denylist: %w", err)
+	}
+	return n > 0, nil
+}
+
+// Run keeps the local filter in sync with Redis until ctx is done: it applies
+// revocations published by other instances and rebuilds the filter every
+// interval.
+func (d *TokenDenylist) Run(ctx context.Context, interval time.Duration) {
+	pubsub := d.rdb.Subscribe(ctx, revocationChannel)
+	defer pubsub.Close()
+	// Subscribe before the first rebuild so no revocation falls in between.
+	if _, err := pubsub.Receive(ctx); err != nil {
+		slog.Error("Failed to subscribe to token revocations", slog.Any("error", err))
+	}
+	messages := pubsub.Channel()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := d.Rebuild(ctx); err != nil && ctx.Err() == nil {
+			slog.Error("Failed to rebuild token denylist filter", slog.Any("error", err))
+		}
+	wait:
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-messages:
+				if !ok {
+					return
+				}
+				if strings.HasPrefix(msg.Payload, revokedTokenPrefix) || strings.HasPrefix(msg.Payload, revokedSessionPrefix) {
+					d.remember(msg.Payload)
+				}
+			case <-ticker.C:
+				break wait
+			}
+		}
+	}
+}
+
+// Rebuild replaces the local filter with one holding exactly the revocations
+// currently in Redis.
+func (d *TokenDenylist) Rebuild(ctx context.Context) error {
+	next := bloom.New(d.capacity, denylistFalsePositives)
+	d.mu.Lock()
+	d.next = next
+	d.mu.Unlock()
+	defer func() {
+		d.mu.Lock()
+		d.next = nil
+		d.mu.Unlock()
+	}()
+
+	for _, prefix := range []string{revokedTokenPrefix, revokedSessionPrefix} {
+		iter := d.rdb.Scan(ctx, 0, prefix+"*", 1000).Iterator()
+		for iter.Next(ctx) {
+			next.Add(iter.Val())
+		}
+		if err := iter.Err(); err != nil {
+			return err
+		}
+	}
+
+	// Revocations that arrived during the scan were added to next by remember.
+	d.mu.Lock()
+	d.filter.Store(next)
+	d.mu.Unlock()
+	d.loaded.Store(true)
+	return nil
+}
+
+// announce adds a revocation to the local filter and tells other instances.
+// A lost announcement only delays enforcement elsewhere until their next rebuild.
+func (d *TokenDenylist) announce(ctx context.Context, key string) {
+	d.remember(key)
+	if err := d.rdb.Publish(ctx, revocationChannel, key).Err(); err != nil {
+		slog.Warn("Failed to publish token revocation", slog.String("key", key), slog.Any("error", err))
+	}
+}
+
+func (d *TokenDenylist) remember(key string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.filter.Load().Add(key)
+	if d.next != nil {
+		d.next.Add(key)
+	}
+}
+
+func (d *TokenDenylist) mayContain(key string) bool {
+	return !d.loaded.Load() || d.filter.Load().Test(key)
+}
@@ -0,0 +1,62 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Prashant2307200/auth-service/internal/entity"
+	"github.com/redis/go-redis/v9"
+)
+
+const webAuthnSessionPrefix = "webauthn_session:"
+
+var ErrWebAuthnSessionNotFound = errors.New("webauthn session not found")
+
+// WebAuthnSessionStore keeps in-flight WebAuthn ceremonies in Redis, keyed by
+// the hash of their challenge. The client echoes the challenge in its signed
+// client data, so no separate session token is needed.
+type WebAuthnSessionStore struct {
+	rdb *redis.Client
+}
+
+func NewWebAuthnSessionStore(rdb *redis.Client) *WebAuthnSessionStore {
+	return &WebAuthnSessionStore{rdb: rdb}
+}
+
+func (s *WebAuthnSessionStore) Save(ctx context.Context, challenge []byte, session *entity.WebAuthnSession, ttl time.Duration) error {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+	if err := s.rdb.Set(ctx, webAuthnSessionKey(challenge), data, ttl).Err(); err != nil {
+		return fmt.Errorf("failed to store webauthn session: %w", err)
+	}
+	return nil
+}
+
+// Take returns and deletes the session in one step, so each challenge can be
+// answered at most once.
+func (s *WebAuthnSessionStore) Take(ctx context.Context, challenge []byte) (*entity.WebAuthnSession, error) {
+	data, err := s.rdb.GetDel(ctx, webAuthnSessionKey(challenge)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrWebAuthnSessionNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get webauthn session: %w", err)
+	}
+	var session entity.WebAuthnSession
+	if err := json.Unmarshal(data, &session); err != nil {
+		return nil, fmt.Errorf("invalid webauthn session: %w", err)
+	}
+	return &session, nil
+}
+
+func webAuthnSessionKey(challenge []byte) string {
+	sum := sha256.Sum256(challenge)
+	return webAuthnSessionPrefix + hex.EncodeToString(sum[:])
+}
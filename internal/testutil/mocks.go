@@ -3,9 +3,11 @@ package testutil
 import (
 	"context"
 	"errors"
+	"time"
 
 	"github.com/Prashant2307200/auth-service/internal/entity"
 	"github.com/Prashant2307200/auth-service/internal/usecase/interfaces"
+	"github.com/Prashant2307200/auth-service/pkg/jwk"
 	"github.com/stretchr/testify/mock"
 )
 
@@ -71,24 +73,11 @@ func (m *MockUserRepo) Search(ctx context.Context, currentID int64, search strin
 	return args.Get(0).([]*entity.User), args.Error(1)
 }
 
-func (m *MockUserRepo) GetByGoogleID(ctx context.Context, googleID string) (*entity.User, error) {
-	args := m.Called(ctx, googleID)
-	if args.Get(0) == nil {
-		return nil, args.Error(1)
-	}
-	return args.Get(0).(*entity.User), args.Error(1)
-}
-
 func (m *MockUserRepo) MarkEmailVerified(ctx context.Context, id int64) error {
 	args := m.Called(ctx, id)
 	return args.Error(0)
 }
 
-func (m *MockUserRepo) LinkGoogleID(ctx context.Context, id int64, googleID string) error {
-	args := m.Called(ctx, id, googleID)
-	return args.Error(0)
-}
-
 // MockTokenService is a mock implementation of TokenService interface
 type MockTokenService struct {
 	mock.Mock
@@ -103,24 +92,74 @@ func (m *MockTokenService) GenerateAccessToken(userID int64, businessID ...int64
 	return args.String(0), args.Error(1)
 }
 
-func (m *MockTokenService) GenerateRefreshToken(userID int64) (string, error) {
-	args := m.Called(userID)
+func (m *MockTokenService) GenerateClientAccessToken(userID int64, clientID string, scopes []string) (string, error) {
+	args := m.Called(userID, clientID, scopes)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockTokenService) GenerateServiceAccessToken(clientID string, businessID int64, scopes []string) (string, error) {
+	args := m.Called(clientID, businessID, scopes)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockTokenService) GenerateIDToken(userID int64, clientID, nonce string, claims map[string]any) (string, error) {
+	args := m.Called(userID, clientID, nonce, claims)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockTokenService) GenerateAccessTokenForSession(userID int64, sessionID string, businessID ...int64) (string, error) {
+	callArgs := []interface{}{userID, sessionID}
+	for _, id := range businessID {
+		callArgs = append(callArgs, id)
+	}
+	args := m.Called(callArgs...)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockTokenService) GenerateRefreshToken(userID int64, sessionID string) (string, error) {
+	args := m.Called(userID, sessionID)
 	return args.String(0), args.Error(1)
 }
 
-func (m *MockTokenService) StoreRefreshToken(ctx context.Context, userID int64, token string) error {
-	args := m.Called(ctx, userID, token)
+func (m *MockTokenService) StoreRefreshToken(ctx context.Context, sessionID string, token string) error {
+	args := m.Called(ctx, sessionID, token)
 	return args.Error(0)
 }
 
-func (m *MockTokenService) RemoveRefreshToken(ctx context.Context, userID int64) error {
-	args := m.Called(ctx, userID)
+func (m *MockTokenService) RotateRefreshToken(ctx context.Context, sessionID, current, next string) (bool, error) {
+	args := m.Called(ctx, sessionID, current, next)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockTokenService) RemoveRefreshToken(ctx context.Context, sessionID string) error {
+	args := m.Called(ctx, sessionID)
 	return args.Error(0)
 }
 
-func (m *MockTokenService) VerifyRefreshToken(ctx context.Context, tokenStr string) (string, error) {
+func (m *MockTokenService) VerifyAccessToken(ctx context.Context, tokenStr string) (*interfaces.AccessClaims, error) {
 	args := m.Called(ctx, tokenStr)
-	return args.String(0), args.Error(1)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*interfaces.AccessClaims), args.Error(1)
+}
+
+func (m *MockTokenService) RevokeAccessToken(ctx context.Context, tokenID string, expiresAt time.Time) error {
+	args := m.Called(ctx, tokenID, expiresAt)
+	return args.Error(0)
+}
+
+func (m *MockTokenService) RevokeSessionAccessTokens(ctx context.Context, sessionID string) error {
+	args := m.Called(ctx, sessionID)
+	return args.Error(0)
+}
+
+func (m *MockTokenService) VerifyRefreshToken(ctx context.Context, tokenStr string) (*interfaces.RefreshClaims, error) {
+	args := m.Called(ctx, tokenStr)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*interfaces.RefreshClaims), args.Error(1)
 }
 
 func (m *MockTokenService) VerifyToken(ctx context.Context, tokenStr string) (int64, error) {
@@ -128,11 +167,16 @@ func (m *MockTokenService) VerifyToken(ctx context.Context, tokenStr string) (in
 	return args.Get(0).(int64), args.Error(1)
 }
 
-func (m *MockTokenService) GetRefreshToken(ctx context.Context, userID int64) (string, error) {
-	args := m.Called(ctx, userID)
+func (m *MockTokenService) GetRefreshToken(ctx context.Context, sessionID string) (string, error) {
+	args := m.Called(ctx, sessionID)
 	return args.String(0), args.Error(1)
 }
 
+func (m *MockTokenService) IsRefreshTokenInFamily(ctx context.Context, sessionID, tokenID string) (bool, error) {
+	args := m.Called(ctx, sessionID, tokenID)
+	return args.Bool(0), args.Error(1)
+}
+
 func (m *MockTokenService) GetPublicKeyPEM() ([]byte, error) {
 	args := m.Called()
 	if args.Get(0) == nil {
@@ -141,6 +185,58 @@ func (m *MockTokenService) GetPublicKeyPEM() ([]byte, error) {
 	return args.Get(0).([]byte), args.Error(1)
 }
 
+func (m *MockTokenService) GetJWKS() (*jwk.Set, error) {
+	args := m.Called()
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*jwk.Set), args.Error(1)
+}
+
+// MockSessionService is a mock implementation of SessionService interface
+type MockSessionService struct {
+	mock.Mock
+}
+
+func (m *MockSessionService) CreateSession(ctx context.Context, userID int64, deviceInfo, ipAddress, userAgent string) (*entity.UserSession, error) {
+	args := m.Called(ctx, userID, deviceInfo, ipAddress, userAgent)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*entity.UserSession), args.Error(1)
+}
+
+func (m *MockSessionService) GetSession(ctx context.Context, sessionID string) (*entity.UserSession, error) {
+	args := m.Called(ctx, sessionID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*entity.UserSession), args.Error(1)
+}
+
+func (m *MockSessionService) ListUserSessions(ctx context.Context, userID int64) ([]*entity.UserSession, error) {
+	args := m.Called(ctx, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*entity.UserSession), args.Error(1)
+}
+
+func (m *MockSessionService) RevokeSession(ctx context.Context, userID int64, sessionID string) error {
+	args := m.Called(ctx, userID, sessionID)
+	return args.Error(0)
+}
+
+func (m *MockSessionService) RevokeAllSessions(ctx context.Context, userID int64, exceptSessionID string) error {
+	args := m.Called(ctx, userID, exceptSessionID)
+	return args.Error(0)
+}
+
+func (m *MockSessionService) UpdateLastUsed(ctx context.Context, sessionID string) error {
+	args := m.Called(ctx, sessionID)
+	return args.Error(0)
+}
+
 // MockCloudService is a mock implementation of CloudService interface
 type MockCloudService struct {
 	mock.Mock
@@ -315,6 +411,11 @@ func (m *MockBusinessRepo) RemoveUser(ctx context.Context, businessID int64, use
 	return args.Error(0)
 }
 
+func (m *MockBusinessRepo) UpdateUserRole(ctx context.Context, businessID int64, userID int64, role int) error {
+	args := m.Called(ctx, businessID, userID, role)
+	return args.Error(0)
+}
+
 func (m *MockBusinessRepo) GetUsers(ctx context.Context, businessID int64) ([]*entity.User, error) {
 	args := m.Called(ctx, businessID)
 	if args.Get(0) == nil {
@@ -406,16 +507,58 @@ func (m *MockBusinessRepo) FindAutoJoinBusinessByEmailDomain(ctx context.Context
 	return args.Get(0).(*entity.Business), args.Error(1)
 }
 
-func (m *MockBusinessRepo) VerifyDomain(ctx context.Context, domainID int64) error {
-	args := m.Called(ctx, domainID)
+func (m *MockBusinessRepo) FindPasswordLoginDisabledBusinessByEmailDomain(ctx context.Context, emailDomain string) (*entity.Business, error) {
+	args := m.Called(ctx, emailDomain)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*entity.Business), args.Error(1)
+}
+
+func (m *MockBusinessRepo) ListDomains(ctx context.Context, businessID int64) ([]*entity.BusinessDomain, error) {
+	args := m.Called(ctx, businessID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*entity.BusinessDomain), args.Error(1)
+}
+
+func (m *MockBusinessRepo) ClaimDueDomains(ctx context.Context, now, leaseUntil time.Time, limit int) ([]*entity.BusinessDomain, error) {
+	args := m.Called(ctx, now, leaseUntil, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*entity.BusinessDomain), args.Error(1)
+}
+
+func (m *MockBusinessRepo) UpdateDomainCheck(ctx context.Context, domain *entity.BusinessDomain) error {
+	args := m.Called(ctx, domain)
 	return args.Error(0)
 }
 
+func (m *MockBusinessRepo) UpdateClaimedDomainCheck(ctx context.Context, domain *entity.BusinessDomain, leaseUntil time.Time) (bool, error) {
+	args := m.Called(ctx, domain, leaseUntil)
+	return args.Bool(0), args.Error(1)
+}
+
 func (m *MockBusinessRepo) UpdateDomainAutoJoin(ctx context.Context, domainID int64, businessID int64, enabled bool) error {
 	args := m.Called(ctx, domainID, businessID, enabled)
 	return args.Error(0)
 }
 
+func (m *MockBusinessRepo) GetLoginPolicy(ctx context.Context, businessID int64) (*entity.BusinessLoginPolicy, error) {
+	args := m.Called(ctx, businessID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*entity.BusinessLoginPolicy), args.Error(1)
+}
+
+func (m *MockBusinessRepo) UpdateLoginPolicy(ctx context.Context, policy *entity.BusinessLoginPolicy) error {
+	args := m.Called(ctx, policy)
+	return args.Error(0)
+}
+
 type MockEmailService struct {
 	mock.Mock
 }
@@ -29,12 +29,29 @@ func roleNameFromUser(u *entity.User) string {
 	return "user"
 }
 
+// serviceRole is reported for tokens held by service clients, which have no
+// user and therefore no user role.
+const serviceRole = "service"
+
 func (s *TokenService) VerifyToken(ctx context.Context, req *authgrpc.VerifyTokenRequest) (*authgrpc.VerifyTokenResponse, error) {
-	userID, err := s.jwtService.VerifyToken(ctx, req.GetToken())
+	claims, err := s.jwtService.VerifyAccessToken(ctx, req.GetToken())
 	if err != nil {
 		return nil, fmt.Errorf("token verification failed: %w", err)
 	}
 
+	if claims.IsServiceClient() {
+		if tid := req.GetTenantId(); tid != 0 && claims.BusinessID != tid {
+			return nil, fmt.Errorf("tenant mismatch: token tenant %d != requested %d", claims.BusinessID, tid)
+		}
+		return &authgrpc.VerifyTokenResponse{
+			Role:       serviceRole,
+			ClientId:   claims.ClientID,
+			BusinessId: claims.BusinessID,
+			Scopes:     claims.Scopes,
+		}, nil
+	}
+
+	userID := claims.UserID
 	user, err := s.userRepo.GetById(ctx, userID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch user: %w", err)
@@ -44,5 +61,10 @@ func (s *TokenService) VerifyToken(ctx context.Context, req *authgrpc.VerifyToke
 		return nil, fmt.Errorf("tenant mismatch: token tenant %d != requested %d", user.TenantID, tid)
 	}
 
-	return &authgrpc.VerifyTokenResponse{UserId: userID, Role: roleNameFromUser(user)}, nil
+	return &authgrpc.VerifyTokenResponse{
+		UserId:   userID,
+		Role:     roleNameFromUser(user),
+		ClientId: claims.ClientID,
+		Scopes:   claims.Scopes,
+	}, nil
 }
@@ -48,3 +48,24 @@ func TestVerifyToken_TenantMismatch(t *testing.T) {
 	_, err = svc.VerifyToken(context.Background(), &authgrpc.VerifyTokenRequest{Token: token, TenantId: 1})
 	require.Error(t, err)
 }
+
+func TestVerifyToken_ServiceClient(t *testing.T) {
+	jwt := testutil.NewTestTokenService(t)
+	userRepo := &testutil.MockUserRepo{}
+	svc := NewTokenService(jwt, userRepo)
+
+	token, err := jwt.GenerateServiceAccessToken("svc-client", 7, []string{"users:read"})
+	require.NoError(t, err)
+
+	res, err := svc.VerifyToken(context.Background(), &authgrpc.VerifyTokenRequest{Token: token, TenantId: 7})
+	require.NoError(t, err)
+	require.Zero(t, res.UserId)
+	require.Equal(t, "service", res.Role)
+	require.Equal(t, "svc-client", res.ClientId)
+	require.Equal(t, int64(7), res.BusinessId)
+	require.Equal(t, []string{"users:read"}, res.Scopes)
+
+	_, err = svc.VerifyToken(context.Background(), &authgrpc.VerifyTokenRequest{Token: token, TenantId: 8})
+	require.Error(t, err)
+	userRepo.AssertNotCalled(t, "GetById", mock.Anything, mock.Anything)
+}
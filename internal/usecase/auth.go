@@ -7,16 +7,40 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
-	"strconv"
 	"strings"
 	"time"
 
 	"github.com/Prashant2307200/auth-service/internal/entity"
+	"github.com/Prashant2307200/auth-service/internal/infrastructure/repository"
 	"github.com/Prashant2307200/auth-service/internal/usecase/interfaces"
 	"github.com/Prashant2307200/auth-service/pkg/hash"
+	"github.com/Prashant2307200/auth-service/pkg/jwk"
 	v "github.com/Prashant2307200/auth-service/pkg/validator"
+	"github.com/Prashant2307200/auth-service/pkg/webauthn"
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
+// ErrRefreshTokenReused is returned when an already-rotated refresh token is
+// presented again. The session it belonged to has been revoked.
+var ErrRefreshTokenReused = errors.New("refresh token reuse detected")
+
+// AuthMetrics counts security-relevant auth events.
+type AuthMetrics struct {
+	RefreshTokenReuseTotal prometheus.Counter
+}
+
+func NewAuthMetrics() (*AuthMetrics, error) {
+	reuse := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "auth_refresh_token_reuse_total",
+		Help: "Total number of rotated refresh tokens presented again",
+	})
+
+	return &AuthMetrics{
+		RefreshTokenReuseTotal: reuse,
+	}, nil
+}
+
 // RegisterOptions carries optional onboarding params for registration.
 type RegisterOptions struct {
 	InviteToken  string
@@ -28,14 +52,33 @@ type AuthUseCase struct {
 	BusinessRepo interfaces.BusinessRepo
 	TokenService interfaces.TokenService
 	CloudService interfaces.CloudService
+	// Sessions tracks one session per device; each session owns its refresh
+	// token. When nil, sessions get an ID but are not recorded.
+	Sessions interfaces.SessionService
+	// AuditRepo receives security events such as refresh token reuse. Optional.
+	AuditRepo repository.AuditRepository
+	Metrics   *AuthMetrics
+	// MFAGate turns logins of MFA-enabled accounts into challenges. Optional.
+	MFAGate *MFAGate
+	// Passkeys enables WebAuthn login and passkey MFA. Optional.
+	Passkeys WebAuthnUsecase
+	// LoginPolicies makes LoginUser honour businesses that disabled password
+	// login for their domains. Optional.
+	LoginPolicies LoginPolicyFinder
+	// SSO and SAML are the sign-in methods DiscoverLoginMethods offers
+	// besides passwords. Optional.
+	SSO  SSOUsecase
+	SAML SAMLUsecase
 }
 
 func NewAuthUseCase(r interfaces.UserRepo, br interfaces.BusinessRepo, s interfaces.TokenService, c interfaces.CloudService) *AuthUseCase {
+	metrics, _ := NewAuthMetrics()
 	return &AuthUseCase{
 		UserRepo:     r,
 		BusinessRepo: br,
 		TokenService: s,
 		CloudService: c,
+		Metrics:      metrics,
 	}
 }
 
@@ -57,6 +100,14 @@ func (uc *AuthUseCase) RegisterUser(ctx context.Context, user *entity.User, opts
 	if len(ves) > 0 {
 		return "", "", fmt.Errorf("validation failed: %w", ves)
 	}
+	// Registering sets a password, so it is refused where password login is.
+	allowed, err := uc.passwordLoginAllowed(ctx, user.Email)
+	if err != nil {
+		return "", "", err
+	}
+	if !allowed {
+		return "", "", ErrPasswordLoginDisabled
+	}
 	existingUser, err := uc.UserRepo.GetByEmail(ctx, user.Email)
 	if err != nil && err != sql.ErrNoRows {
 		slog.Error("Failed to check existing user", slog.String("email", user.Email), slog.Any("error", err))
@@ -96,26 +147,21 @@ func (uc *AuthUseCase) RegisterUser(ctx context.Context, user *entity.User, opts
 		}
 	}
 
-	refreshToken, err := uc.TokenService.GenerateRefreshToken(id)
-	if err != nil {
-		return "", "", fmt.Errorf("failed to generate refresh token: %w", err)
-	}
-
-	err = uc.TokenService.StoreRefreshToken(ctx, id, refreshToken)
+	sessionID, refreshToken, err := startSession(ctx, uc.TokenService, uc.Sessions, id)
 	if err != nil {
-		return "", "", fmt.Errorf("failed to store refresh token: %w", err)
+		return "", "", err
 	}
 
 	// Generate access token including tenant_id when available
 	if createdBusinessID != 0 {
-		accessToken, err := uc.TokenService.GenerateAccessToken(id, createdBusinessID)
+		accessToken, err := uc.TokenService.GenerateAccessTokenForSession(id, sessionID, createdBusinessID)
 		if err != nil {
 			return "", "", fmt.Errorf("failed to generate access token: %w", err)
 		}
 		return accessToken, refreshToken, nil
 	}
 
-	accessToken, err := uc.TokenService.GenerateAccessToken(id)
+	accessToken, err := uc.TokenService.GenerateAccessTokenForSession(id, sessionID)
 	if err != nil {
 		return "", "", fmt.Errorf("failed to generate access token: %w", err)
 	}
@@ -182,6 +228,16 @@ func (uc *AuthUseCase) LoginUser(ctx context.Context, email string, password str
 		return "", "", fmt.Errorf("validation failed: %w", ves)
 	}
 
+	// The policy depends on the domain alone, so checking it first reveals
+	// nothing about the account.
+	allowed, err := uc.passwordLoginAllowed(ctx, email)
+	if err != nil {
+		return "", "", err
+	}
+	if !allowed {
+		return "", "", ErrPasswordLoginDisabled
+	}
+
 	existingUser, err := uc.UserRepo.GetByEmail(ctx, email)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
@@ -209,17 +265,76 @@ func (uc *AuthUseCase) LoginUser(ctx context.Context, email string, password str
 		}
 	}
 
-	refreshToken, err := uc.TokenService.GenerateRefreshToken(existingUser.ID)
+	if err := uc.MFAGate.Require(ctx, existingUser.ID, entity.MFAMethodPassword); err != nil {
+		return "", "", err
+	}
+
+	return uc.issueTokens(ctx, existingUser.ID)
+}
+
+// CompleteMFAChallenge exchanges a challenge token from LoginUser or SSO plus
+// a TOTP or backup code for a new session.
+func (uc *AuthUseCase) CompleteMFAChallenge(ctx context.Context, mfaToken, code string) (string, string, error) {
+	challenge, err := uc.MFAGate.Complete(ctx, mfaToken, code)
 	if err != nil {
-		return "", "", fmt.Errorf("failed to generate refresh token: %w", err)
+		return "", "", err
 	}
+	return uc.issueTokens(ctx, challenge.UserID)
+}
 
-	err = uc.TokenService.StoreRefreshToken(ctx, existingUser.ID, refreshToken)
+// BeginPasskeyMFA returns assertion options for the user behind a pending
+// MFA challenge.
+func (uc *AuthUseCase) BeginPasskeyMFA(ctx context.Context, mfaToken string) (*webauthn.RequestOptions, error) {
+	if uc.Passkeys == nil {
+		return nil, ErrWebAuthnCredentialNotFound
+	}
+	challenge, err := uc.MFAGate.Peek(ctx, mfaToken)
 	if err != nil {
-		return "", "", fmt.Errorf("failed to store refresh token: %w", err)
+		return nil, err
 	}
+	return uc.Passkeys.BeginSecondFactor(ctx, challenge.UserID)
+}
+
+// CompletePasskeyMFA completes an MFA challenge with a passkey assertion.
+// Failed assertions count towards the challenge's attempt limit.
+func (uc *AuthUseCase) CompletePasskeyMFA(ctx context.Context, mfaToken string, resp *webauthn.AssertionResponse) (string, string, error) {
+	if uc.Passkeys == nil {
+		return "", "", ErrWebAuthnCredentialNotFound
+	}
+	challenge, err := uc.MFAGate.CompleteWith(ctx, mfaToken, func(ctx context.Context, userID int64) error {
+		return uc.Passkeys.FinishSecondFactor(ctx, userID, resp)
+	})
+	if err != nil {
+		return "", "", err
+	}
+	return uc.issueTokens(ctx, challenge.UserID)
+}
+
+// LoginWithPasskey signs a user in with a user-verified passkey. The passkey
+// is itself multi-factor, so no MFA challenge follows.
+func (uc *AuthUseCase) LoginWithPasskey(ctx context.Context, resp *webauthn.AssertionResponse) (string, string, error) {
+	if uc.Passkeys == nil {
+		return "", "", ErrWebAuthnCredentialNotFound
+	}
+	userID, err := uc.Passkeys.FinishLogin(ctx, resp)
+	if err != nil {
+		return "", "", err
+	}
+	return uc.issueTokens(ctx, userID)
+}
+
+func (uc *AuthUseCase) issueTokens(ctx context.Context, userID int64) (string, string, error) {
+	return issueSessionTokens(ctx, uc.TokenService, uc.Sessions, userID)
+}
 
-	accessToken, err := uc.TokenService.GenerateAccessToken(existingUser.ID)
+// issueSessionTokens starts a session and returns its access and refresh tokens.
+func issueSessionTokens(ctx context.Context, tokens interfaces.TokenService, sessions interfaces.SessionService, userID int64) (string, string, error) {
+	sessionID, refreshToken, err := startSession(ctx, tokens, sessions, userID)
+	if err != nil {
+		return "", "", err
+	}
+
+	accessToken, err := tokens.GenerateAccessTokenForSession(userID, sessionID)
 	if err != nil {
 		return "", "", fmt.Errorf("failed to generate access token: %w", err)
 	}
@@ -227,11 +342,63 @@ func (uc *AuthUseCase) LoginUser(ctx context.Context, email string, password str
 	return accessToken, refreshToken, nil
 }
 
-func (uc *AuthUseCase) LogoutUser(ctx context.Context, userID int64) error {
+// startSession records a session for userID on the device described by the
+// context's ClientInfo and stores a refresh token bound to it. Without a
+// session store the session only gets an ID, which still scopes the token.
+func startSession(ctx context.Context, tokens interfaces.TokenService, sessions interfaces.SessionService, userID int64) (string, string, error) {
+	sessionID := uuid.NewString()
+	if sessions != nil {
+		client := ClientInfoFrom(ctx)
+		session, err := sessions.CreateSession(ctx, userID, client.DeviceInfo, client.IPAddress, client.UserAgent)
+		if err != nil {
+			return "", "", fmt.Errorf("failed to create session: %w", err)
+		}
+		sessionID = session.ID
+	}
 
-	err := uc.TokenService.RemoveRefreshToken(ctx, userID)
+	refreshToken, err := tokens.GenerateRefreshToken(userID, sessionID)
 	if err != nil {
-		return fmt.Errorf("failed to remove refresh token: %w", err)
+		return "", "", fmt.Errorf("failed to generate refresh token: %w", err)
+	}
+
+	if err := tokens.StoreRefreshToken(ctx, sessionID, refreshToken); err != nil {
+		return "", "", fmt.Errorf("failed to store refresh token: %w", err)
+	}
+
+	return sessionID, refreshToken, nil
+}
+
+// LogoutUser ends the session the given refresh token belongs to. Other
+// devices stay signed in. An empty or unparseable refresh token leaves
+// nothing to revoke server-side.
+func (uc *AuthUseCase) LogoutUser(ctx context.Context, userID int64, refreshToken string) error {
+	return endRefreshTokenSession(ctx, uc.TokenService, uc.Sessions, userID, refreshToken)
+}
+
+// endRefreshTokenSession ends the session of userID's refreshToken, as on
+// logout.
+func endRefreshTokenSession(ctx context.Context, tokens interfaces.TokenService, sessions interfaces.SessionService, userID int64, refreshToken string) error {
+	if refreshToken == "" {
+		return nil
+	}
+
+	claims, err := tokens.VerifyRefreshToken(ctx, refreshToken)
+	if err != nil {
+		slog.Warn("Logout with invalid refresh token", slog.Int64("user_id", userID), slog.Any("error", err))
+		return nil
+	}
+	if claims.UserID != userID {
+		return errors.New("refresh token does not belong to user")
+	}
+
+	if err := endSessionTokens(ctx, tokens, claims.SessionID); err != nil {
+		return err
+	}
+
+	if sessions != nil {
+		if err := sessions.RevokeSession(ctx, userID, claims.SessionID); err != nil {
+			slog.Warn("Failed to revoke session on logout", slog.String("session_id", claims.SessionID), slog.Any("error", err))
+		}
 	}
 
 	return nil
@@ -269,52 +436,159 @@ func (uc *AuthUseCase) DeleteAuthUser(ctx context.Context, authUserId int64) err
 	return nil
 }
 
+// RefreshSession rotates the refresh token of the session it was issued to.
 func (uc *AuthUseCase) RefreshSession(ctx context.Context, refreshToken string) (string, string, error) {
 
-	userID, err := uc.TokenService.VerifyRefreshToken(ctx, refreshToken)
+	claims, err := uc.TokenService.VerifyRefreshToken(ctx, refreshToken)
 	if err != nil {
 		slog.Error("Failed to verify refresh token", slog.Any("error", err))
 		return "", "", fmt.Errorf("invalid refresh token: %w", err)
 	}
+	userID, sessionID := claims.UserID, claims.SessionID
 
-	parsedUserID, err := strconv.ParseInt(userID, 10, 64)
+	storedToken, err := uc.TokenService.GetRefreshToken(ctx, sessionID)
 	if err != nil {
-		slog.Error("Failed to parse user ID from token", slog.String("user_id", userID), slog.Any("error", err))
-		return "", "", fmt.Errorf("invalid user ID in token: %w", err)
-	}
-
-	storedToken, err := uc.TokenService.GetRefreshToken(ctx, parsedUserID)
-	if err != nil {
-		slog.Error("Failed to get stored refresh token", slog.Int64("user_id", parsedUserID), slog.Any("error", err))
+		slog.Error("Failed to get stored refresh token", slog.Int64("user_id", userID), slog.String("session_id", sessionID), slog.Any("error", err))
 		return "", "", fmt.Errorf("refresh token not found in storage: %w", err)
 	}
 
 	if subtle.ConstantTimeCompare([]byte(storedToken), []byte(refreshToken)) != 1 {
-		slog.Error("Refresh token mismatch", slog.Int64("user_id", parsedUserID))
+		reused, ferr := uc.TokenService.IsRefreshTokenInFamily(ctx, sessionID, claims.TokenID)
+		if ferr != nil {
+			slog.Error("Failed to check refresh token family", slog.String("session_id", sessionID), slog.Any("error", ferr))
+		}
+		if reused {
+			uc.revokeRefreshTokenFamily(ctx, claims)
+			return "", "", ErrRefreshTokenReused
+		}
+		slog.Error("Refresh token mismatch", slog.Int64("user_id", userID), slog.String("session_id", sessionID))
 		return "", "", errors.New("refresh token does not match stored token")
 	}
 
-	newRefreshToken, err := uc.TokenService.GenerateRefreshToken(parsedUserID)
+	if uc.Sessions != nil {
+		// A revoked session must not be revived by a refresh token that outlived it.
+		if _, err := uc.Sessions.GetSession(ctx, sessionID); err != nil {
+			slog.Warn("Refresh for inactive session", slog.Int64("user_id", userID), slog.String("session_id", sessionID), slog.Any("error", err))
+			if rerr := uc.TokenService.RemoveRefreshToken(ctx, sessionID); rerr != nil {
+				slog.Error("Failed to remove refresh token of inactive session", slog.String("session_id", sessionID), slog.Any("error", rerr))
+			}
+			return "", "", fmt.Errorf("session is no longer active: %w", err)
+		}
+		if err := uc.Sessions.UpdateLastUsed(ctx, sessionID); err != nil {
+			slog.Warn("Failed to update session last used", slog.String("session_id", sessionID), slog.Any("error", err))
+		}
+	}
+
+	newRefreshToken, err := uc.TokenService.GenerateRefreshToken(userID, sessionID)
 	if err != nil {
-		slog.Error("Failed to generate new refresh token", slog.Int64("user_id", parsedUserID), slog.Any("error", err))
+		slog.Error("Failed to generate new refresh token", slog.Int64("user_id", userID), slog.Any("error", err))
 		return "", "", fmt.Errorf("failed to generate refresh token: %w", err)
 	}
 
-	newAccessToken, err := uc.TokenService.GenerateAccessToken(parsedUserID)
+	newAccessToken, err := uc.TokenService.GenerateAccessTokenForSession(userID, sessionID)
 	if err != nil {
-		slog.Error("Failed to generate new access token", slog.Int64("user_id", parsedUserID), slog.Any("error", err))
+		slog.Error("Failed to generate new access token", slog.Int64("user_id", userID), slog.Any("error", err))
 		return "", "", fmt.Errorf("failed to generate access token: %w", err)
 	}
 
-	err = uc.TokenService.StoreRefreshToken(ctx, parsedUserID, newRefreshToken)
+	rotated, err := uc.TokenService.RotateRefreshToken(ctx, sessionID, refreshToken, newRefreshToken)
 	if err != nil {
-		slog.Error("Failed to store new refresh token", slog.Int64("user_id", parsedUserID), slog.Any("error", err))
+		slog.Error("Failed to store new refresh token", slog.Int64("user_id", userID), slog.Any("error", err))
 		return "", "", fmt.Errorf("failed to store refresh token: %w", err)
 	}
+	if !rotated {
+		// A concurrent refresh spent the same token first: presenting one
+		// token twice is reuse, however close together the requests were.
+		uc.revokeRefreshTokenFamily(ctx, claims)
+		return "", "", ErrRefreshTokenReused
+	}
 
 	return newRefreshToken, newAccessToken, nil
 }
 
+// ListSessions returns the user's active sessions.
+func (uc *AuthUseCase) ListSessions(ctx context.Context, userID int64) ([]*entity.UserSession, error) {
+	if uc.Sessions == nil {
+		return nil, nil
+	}
+	return uc.Sessions.ListUserSessions(ctx, userID)
+}
+
+// RevokeSession ends one of the user's sessions and invalidates its tokens,
+// signing the device out immediately.
+func (uc *AuthUseCase) RevokeSession(ctx context.Context, userID int64, sessionID string) error {
+	if uc.Sessions == nil {
+		return errors.New("sessions are not enabled")
+	}
+	// RevokeSession checks ownership, so it must run before the token is dropped.
+	if err := uc.Sessions.RevokeSession(ctx, userID, sessionID); err != nil {
+		return err
+	}
+	return endSessionTokens(ctx, uc.TokenService, sessionID)
+}
+
+// RevokeOtherSessions ends every session of the user except keepSessionID.
+func (uc *AuthUseCase) RevokeOtherSessions(ctx context.Context, userID int64, keepSessionID string) error {
+	if uc.Sessions == nil {
+		return errors.New("sessions are not enabled")
+	}
+	return endOtherSessions(ctx, uc.TokenService, uc.Sessions, userID, keepSessionID)
+}
+
+// endOtherSessions ends every session of userID except keepSessionID, which
+// may be empty to end them all.
+func endOtherSessions(ctx context.Context, tokens interfaces.TokenService, sessions interfaces.SessionService, userID int64, keepSessionID string) error {
+	list, err := sessions.ListUserSessions(ctx, userID)
+	if err != nil {
+		return err
+	}
+	for _, s := range list {
+		if s.ID == keepSessionID {
+			continue
+		}
+		if err := endSessionTokens(ctx, tokens, s.ID); err != nil {
+			return err
+		}
+	}
+	return sessions.RevokeAllSessions(ctx, userID, keepSessionID)
+}
+
+// endSessionTokens drops the session's refresh token and denies the access
+// tokens already issued to it.
+func endSessionTokens(ctx context.Context, tokens interfaces.TokenService, sessionID string) error {
+	if err := tokens.RemoveRefreshToken(ctx, sessionID); err != nil {
+		return fmt.Errorf("failed to remove refresh token: %w", err)
+	}
+	if err := tokens.RevokeSessionAccessTokens(ctx, sessionID); err != nil {
+		return fmt.Errorf("failed to revoke access tokens: %w", err)
+	}
+	return nil
+}
+
+// revokeRefreshTokenFamily contains a replayed refresh token: whoever holds
+// the current token of the family may be the attacker, so the whole family and
+// its session are revoked and both parties must sign in again.
+func (uc *AuthUseCase) revokeRefreshTokenFamily(ctx context.Context, claims *interfaces.RefreshClaims) {
+	slog.Warn("Refresh token reuse detected, revoking session",
+		slog.Int64("user_id", claims.UserID), slog.String("session_id", claims.SessionID), slog.String("token_id", claims.TokenID))
+
+	if uc.Metrics != nil {
+		uc.Metrics.RefreshTokenReuseTotal.Inc()
+	}
+
+	if err := endSessionTokens(ctx, uc.TokenService, claims.SessionID); err != nil {
+		slog.Error("Failed to revoke refresh token family", slog.String("session_id", claims.SessionID), slog.Any("error", err))
+	}
+	if uc.Sessions != nil {
+		if err := uc.Sessions.RevokeSession(ctx, claims.UserID, claims.SessionID); err != nil {
+			slog.Error("Failed to revoke session after refresh token reuse", slog.String("session_id", claims.SessionID), slog.Any("error", err))
+		}
+	}
+
+	NewUserAuditor(uc.AuditRepo, uc.BusinessRepo).Record(ctx, claims.UserID, entity.AuditActionUserRefreshTokenReused, "session", nil,
+		map[string]interface{}{"session_id": claims.SessionID, "token_id": claims.TokenID})
+}
+
 func (uc *AuthUseCase) GetPublicKey() ([]byte, error) {
 
 	pubKey, err := uc.TokenService.GetPublicKeyPEM()
@@ -325,6 +599,14 @@ func (uc *AuthUseCase) GetPublicKey() ([]byte, error) {
 	return pubKey, nil
 }
 
+func (uc *AuthUseCase) GetJWKS() (*jwk.Set, error) {
+	set, err := uc.TokenService.GetJWKS()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get signing keys: %w", err)
+	}
+	return set, nil
+}
+
 func (uc *AuthUseCase) GenerateUploadSignature(ctx context.Context, userID int64) (*interfaces.UploadSignature, error) {
 	return uc.CloudService.GenerateUploadSignature(ctx, userID)
 }
@@ -22,9 +22,9 @@ func TestLogin_RehashOldHash(t *testing.T) {
 
 	userRepo.On("GetByEmail", mock.Anything, user.Email).Return(user, nil)
 	userRepo.On("UpdatePassword", mock.Anything, user.ID, mock.AnythingOfType("string")).Return(nil)
-	tokenService.On("GenerateRefreshToken", user.ID).Return("refresh", nil)
-	tokenService.On("StoreRefreshToken", mock.Anything, user.ID, "refresh").Return(nil)
-	tokenService.On("GenerateAccessToken", user.ID).Return("access", nil)
+	tokenService.On("GenerateRefreshToken", user.ID, mock.AnythingOfType("string")).Return("refresh", nil)
+	tokenService.On("StoreRefreshToken", mock.Anything, mock.AnythingOfType("string"), "refresh").Return(nil)
+	tokenService.On("GenerateAccessTokenForSession", user.ID, mock.AnythingOfType("string")).Return("access", nil)
 
 	uc := NewAuthUseCase(userRepo, nil, tokenService, cloudService)
 	access, refresh, err := uc.LoginUser(context.Background(), user.Email, "password123")
@@ -46,9 +46,9 @@ func TestLogin_NoRehashWhenUpToDate(t *testing.T) {
 	user.Password = goodHash
 
 	userRepo.On("GetByEmail", mock.Anything, user.Email).Return(user, nil)
-	tokenService.On("GenerateRefreshToken", user.ID).Return("refresh", nil)
-	tokenService.On("StoreRefreshToken", mock.Anything, user.ID, "refresh").Return(nil)
-	tokenService.On("GenerateAccessToken", user.ID).Return("access", nil)
+	tokenService.On("GenerateRefreshToken", user.ID, mock.AnythingOfType("string")).Return("refresh", nil)
+	tokenService.On("StoreRefreshToken", mock.Anything, mock.AnythingOfType("string"), "refresh").Return(nil)
+	tokenService.On("GenerateAccessTokenForSession", user.ID, mock.AnythingOfType("string")).Return("access", nil)
 
 	uc := NewAuthUseCase(userRepo, nil, tokenService, cloudService)
 	access, refresh, err := uc.LoginUser(context.Background(), user.Email, "password123")
@@ -9,7 +9,9 @@ import (
 
 	"github.com/Prashant2307200/auth-service/internal/entity"
 	"github.com/Prashant2307200/auth-service/internal/testutil"
+	"github.com/Prashant2307200/auth-service/internal/usecase/interfaces"
 	pkghash "github.com/Prashant2307200/auth-service/pkg/hash"
+	promtestutil "github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
@@ -58,9 +60,9 @@ func TestAuthUseCase_RegisterUser(t *testing.T) {
 			setupMocks: func(userRepo *testutil.MockUserRepo, tokenService *testutil.MockTokenService, cloudService *testutil.MockCloudService) {
 				userRepo.On("GetByEmail", mock.Anything, "newuser@example.com").Return(nil, sql.ErrNoRows)
 				userRepo.On("Create", mock.Anything, mock.AnythingOfType("*entity.User")).Return(int64(1), nil)
-				tokenService.On("GenerateRefreshToken", int64(1)).Return("refresh_token", nil)
-				tokenService.On("StoreRefreshToken", mock.Anything, int64(1), "refresh_token").Return(nil)
-				tokenService.On("GenerateAccessToken", int64(1)).Return("access_token", nil)
+				tokenService.On("GenerateRefreshToken", int64(1), mock.AnythingOfType("string")).Return("refresh_token", nil)
+				tokenService.On("StoreRefreshToken", mock.Anything, mock.AnythingOfType("string"), "refresh_token").Return(nil)
+				tokenService.On("GenerateAccessTokenForSession", int64(1), mock.AnythingOfType("string")).Return("access_token", nil)
 			},
 			setupBusinessMocks: func(businessRepo *testutil.MockBusinessRepo) {
 				businessRepo.On("FindAutoJoinBusinessByEmailDomain", mock.Anything, "example.com").Return(nil, nil)
@@ -119,7 +121,7 @@ func TestAuthUseCase_RegisterUser(t *testing.T) {
 			setupMocks: func(userRepo *testutil.MockUserRepo, tokenService *testutil.MockTokenService, cloudService *testutil.MockCloudService) {
 				userRepo.On("GetByEmail", mock.Anything, "test@example.com").Return(nil, sql.ErrNoRows)
 				userRepo.On("Create", mock.Anything, mock.AnythingOfType("*entity.User")).Return(int64(1), nil)
-				tokenService.On("GenerateRefreshToken", int64(1)).Return("", errors.New("token error"))
+				tokenService.On("GenerateRefreshToken", int64(1), mock.AnythingOfType("string")).Return("", errors.New("token error"))
 			},
 			setupBusinessMocks: func(businessRepo *testutil.MockBusinessRepo) {
 				businessRepo.On("FindAutoJoinBusinessByEmailDomain", mock.Anything, "example.com").Return(nil, nil)
@@ -180,9 +182,9 @@ func TestAuthUseCase_RegisterUser_WithInviteToken(t *testing.T) {
 	businessRepo.On("GetInviteByToken", mock.Anything, "tok-abc").Return(inv, nil)
 	businessRepo.On("AddUserIfNotExists", mock.Anything, int64(10), int64(100), 0).Return(nil)
 	businessRepo.On("AcceptInvite", mock.Anything, int64(5)).Return(nil)
-	tokenService.On("GenerateRefreshToken", int64(100)).Return("ref", nil)
-	tokenService.On("StoreRefreshToken", mock.Anything, int64(100), "ref").Return(nil)
-	tokenService.On("GenerateAccessToken", int64(100)).Return("acc", nil)
+	tokenService.On("GenerateRefreshToken", int64(100), mock.AnythingOfType("string")).Return("ref", nil)
+	tokenService.On("StoreRefreshToken", mock.Anything, mock.AnythingOfType("string"), "ref").Return(nil)
+	tokenService.On("GenerateAccessTokenForSession", int64(100), mock.AnythingOfType("string")).Return("acc", nil)
 
 	uc := NewAuthUseCase(userRepo, businessRepo, tokenService, cloudService)
 	opts := &RegisterOptions{InviteToken: "tok-abc"}
@@ -253,9 +255,9 @@ func TestAuthUseCase_RegisterUser_WithBusinessSlug(t *testing.T) {
 	userRepo.On("Create", mock.Anything, mock.AnythingOfType("*entity.User")).Return(int64(101), nil)
 	businessRepo.On("GetBySlug", mock.Anything, "open-biz").Return(biz, nil)
 	businessRepo.On("AddUserIfNotExists", mock.Anything, biz.ID, int64(101), 0).Return(nil)
-	tokenService.On("GenerateRefreshToken", int64(101)).Return("ref", nil)
-	tokenService.On("StoreRefreshToken", mock.Anything, int64(101), "ref").Return(nil)
-	tokenService.On("GenerateAccessToken", int64(101)).Return("acc", nil)
+	tokenService.On("GenerateRefreshToken", int64(101), mock.AnythingOfType("string")).Return("ref", nil)
+	tokenService.On("StoreRefreshToken", mock.Anything, mock.AnythingOfType("string"), "ref").Return(nil)
+	tokenService.On("GenerateAccessTokenForSession", int64(101), mock.AnythingOfType("string")).Return("acc", nil)
 
 	uc := NewAuthUseCase(userRepo, businessRepo, tokenService, cloudService)
 	opts := &RegisterOptions{BusinessSlug: "open-biz"}
@@ -281,9 +283,9 @@ func TestAuthUseCase_RegisterUser_WithDomainAutoJoin(t *testing.T) {
 	userRepo.On("Create", mock.Anything, mock.AnythingOfType("*entity.User")).Return(int64(102), nil)
 	businessRepo.On("FindAutoJoinBusinessByEmailDomain", mock.Anything, "acme.com").Return(biz, nil)
 	businessRepo.On("AddUserIfNotExists", mock.Anything, biz.ID, int64(102), 0).Return(nil)
-	tokenService.On("GenerateRefreshToken", int64(102)).Return("ref", nil)
-	tokenService.On("StoreRefreshToken", mock.Anything, int64(102), "ref").Return(nil)
-	tokenService.On("GenerateAccessToken", int64(102)).Return("acc", nil)
+	tokenService.On("GenerateRefreshToken", int64(102), mock.AnythingOfType("string")).Return("ref", nil)
+	tokenService.On("StoreRefreshToken", mock.Anything, mock.AnythingOfType("string"), "ref").Return(nil)
+	tokenService.On("GenerateAccessTokenForSession", int64(102), mock.AnythingOfType("string")).Return("acc", nil)
 
 	uc := NewAuthUseCase(userRepo, businessRepo, tokenService, cloudService)
 	acc, ref, err := uc.RegisterUser(context.Background(), user, nil)
@@ -326,9 +328,9 @@ func TestAuthUseCase_LoginUser(t *testing.T) {
 				userRepo.On("GetByEmail", mock.Anything, "test@example.com").Return(user, nil)
 				userRepo.On("UpdatePassword", mock.Anything, user.ID, mock.AnythingOfType("string")).Return(nil)
 				// token service expectations for successful login
-				tokenService.On("GenerateRefreshToken", user.ID).Return("refresh_token", nil)
-				tokenService.On("StoreRefreshToken", mock.Anything, user.ID, "refresh_token").Return(nil)
-				tokenService.On("GenerateAccessToken", user.ID).Return("access_token", nil)
+				tokenService.On("GenerateRefreshToken", user.ID, mock.AnythingOfType("string")).Return("refresh_token", nil)
+				tokenService.On("StoreRefreshToken", mock.Anything, mock.AnythingOfType("string"), "refresh_token").Return(nil)
+				tokenService.On("GenerateAccessTokenForSession", user.ID, mock.AnythingOfType("string")).Return("access_token", nil)
 			},
 			wantErr: false,
 		},
@@ -395,7 +397,9 @@ func TestAuthUseCase_LogoutUser(t *testing.T) {
 			name:   "successful logout",
 			userID: 1,
 			setupMocks: func(tokenService *testutil.MockTokenService) {
-				tokenService.On("RemoveRefreshToken", mock.Anything, int64(1)).Return(nil)
+				tokenService.On("VerifyRefreshToken", mock.Anything, "refresh").Return(&interfaces.RefreshClaims{UserID: 1, SessionID: "s1"}, nil)
+				tokenService.On("RemoveRefreshToken", mock.Anything, "s1").Return(nil)
+				tokenService.On("RevokeSessionAccessTokens", mock.Anything, "s1").Return(nil)
 			},
 			wantErr: false,
 		},
@@ -403,7 +407,16 @@ func TestAuthUseCase_LogoutUser(t *testing.T) {
 			name:   "failed to remove token",
 			userID: 1,
 			setupMocks: func(tokenService *testutil.MockTokenService) {
-				tokenService.On("RemoveRefreshToken", mock.Anything, int64(1)).Return(errors.New("redis error"))
+				tokenService.On("VerifyRefreshToken", mock.Anything, "refresh").Return(&interfaces.RefreshClaims{UserID: 1, SessionID: "s1"}, nil)
+				tokenService.On("RemoveRefreshToken", mock.Anything, "s1").Return(errors.New("redis error"))
+			},
+			wantErr: true,
+		},
+		{
+			name:   "token of another user",
+			userID: 1,
+			setupMocks: func(tokenService *testutil.MockTokenService) {
+				tokenService.On("VerifyRefreshToken", mock.Anything, "refresh").Return(&interfaces.RefreshClaims{UserID: 2, SessionID: "s2"}, nil)
 			},
 			wantErr: true,
 		},
@@ -418,7 +431,7 @@ func TestAuthUseCase_LogoutUser(t *testing.T) {
 			tt.setupMocks(tokenService)
 
 			uc := NewAuthUseCase(userRepo, nil, tokenService, cloudService)
-			err := uc.LogoutUser(context.Background(), tt.userID)
+			err := uc.LogoutUser(context.Background(), tt.userID, "refresh")
 
 			if tt.wantErr {
 				assert.Error(t, err)
@@ -567,9 +580,9 @@ func TestAuthUseCase_RegisterUser_WithOnboarding(t *testing.T) {
 		businessRepo.On("GetInviteByToken", mock.Anything, "tok-abc").Return(invite, nil)
 		businessRepo.On("AddUserIfNotExists", mock.Anything, int64(10), int64(100), 0).Return(nil)
 		businessRepo.On("AcceptInvite", mock.Anything, int64(1)).Return(nil)
-		tokenService.On("GenerateRefreshToken", int64(100)).Return("ref", nil)
-		tokenService.On("StoreRefreshToken", mock.Anything, int64(100), "ref").Return(nil)
-		tokenService.On("GenerateAccessToken", int64(100)).Return("acc", nil)
+		tokenService.On("GenerateRefreshToken", int64(100), mock.AnythingOfType("string")).Return("ref", nil)
+		tokenService.On("StoreRefreshToken", mock.Anything, mock.AnythingOfType("string"), "ref").Return(nil)
+		tokenService.On("GenerateAccessTokenForSession", int64(100), mock.AnythingOfType("string")).Return("acc", nil)
 
 		uc := NewAuthUseCase(userRepo, businessRepo, tokenService, cloudService)
 		acc, ref, err := uc.RegisterUser(context.Background(), user, &RegisterOptions{InviteToken: "tok-abc"})
@@ -612,9 +625,9 @@ func TestAuthUseCase_RegisterUser_WithOnboarding(t *testing.T) {
 		businessRepo.On("GetBySlug", mock.Anything, "openco").Return(biz, nil)
 		businessRepo.On("AddUserIfNotExists", mock.Anything, biz.ID, int64(101), 0).Return(nil)
 		businessRepo.On("FindAutoJoinBusinessByEmailDomain", mock.Anything, "test.com").Return(nil, nil)
-		tokenService.On("GenerateRefreshToken", int64(101)).Return("ref", nil)
-		tokenService.On("StoreRefreshToken", mock.Anything, int64(101), "ref").Return(nil)
-		tokenService.On("GenerateAccessToken", int64(101)).Return("acc", nil)
+		tokenService.On("GenerateRefreshToken", int64(101), mock.AnythingOfType("string")).Return("ref", nil)
+		tokenService.On("StoreRefreshToken", mock.Anything, mock.AnythingOfType("string"), "ref").Return(nil)
+		tokenService.On("GenerateAccessTokenForSession", int64(101), mock.AnythingOfType("string")).Return("acc", nil)
 
 		uc := NewAuthUseCase(userRepo, businessRepo, tokenService, cloudService)
 		acc, ref, err := uc.RegisterUser(context.Background(), user, &RegisterOptions{BusinessSlug: "openco"})
@@ -637,9 +650,9 @@ func TestAuthUseCase_RegisterUser_WithOnboarding(t *testing.T) {
 		userRepo.On("Create", mock.Anything, mock.AnythingOfType("*entity.User")).Return(int64(102), nil)
 		businessRepo.On("FindAutoJoinBusinessByEmailDomain", mock.Anything, "company.com").Return(biz, nil)
 		businessRepo.On("AddUserIfNotExists", mock.Anything, int64(20), int64(102), 0).Return(nil)
-		tokenService.On("GenerateRefreshToken", int64(102)).Return("ref", nil)
-		tokenService.On("StoreRefreshToken", mock.Anything, int64(102), "ref").Return(nil)
-		tokenService.On("GenerateAccessToken", int64(102)).Return("acc", nil)
+		tokenService.On("GenerateRefreshToken", int64(102), mock.AnythingOfType("string")).Return("ref", nil)
+		tokenService.On("StoreRefreshToken", mock.Anything, mock.AnythingOfType("string"), "ref").Return(nil)
+		tokenService.On("GenerateAccessTokenForSession", int64(102), mock.AnythingOfType("string")).Return("acc", nil)
 
 		uc := NewAuthUseCase(userRepo, businessRepo, tokenService, cloudService)
 		acc, ref, err := uc.RegisterUser(context.Background(), user, nil)
@@ -648,3 +661,196 @@ func TestAuthUseCase_RegisterUser_WithOnboarding(t *testing.T) {
 		assert.NotEmpty(t, ref)
 	})
 }
+
+func TestAuthUseCase_LoginUser_CreatesSession(t *testing.T) {
+	userRepo := new(testutil.MockUserRepo)
+	tokenService := new(testutil.MockTokenService)
+	sessions := new(testutil.MockSessionService)
+
+	user := testutil.CreateTestUser()
+	hashed, _ := pkghash.HashPassword("password123")
+	user.Password = hashed
+	userRepo.On("GetByEmail", mock.Anything, user.Email).Return(user, nil)
+	sessions.On("CreateSession", mock.Anything, user.ID, "Firefox on Linux", "203.0.113.7", "Mozilla/5.0 (X11; Linux x86_64) Firefox/128.0").
+		Return(&entity.UserSession{ID: "sess-1", UserID: user.ID}, nil)
+	tokenService.On("GenerateRefreshToken", user.ID, "sess-1").Return("refresh_token", nil)
+	tokenService.On("StoreRefreshToken", mock.Anything, "sess-1", "refresh_token").Return(nil)
+	tokenService.On("GenerateAccessTokenForSession", user.ID, "sess-1").Return("access_token", nil)
+
+	uc := NewAuthUseCase(userRepo, nil, tokenService, new(testutil.MockCloudService))
+	uc.Sessions = sessions
+	ctx := WithClientInfo(context.Background(), ClientInfo{
+		IPAddress:  "203.0.113.7",
+		UserAgent:  "Mozilla/5.0 (X11; Linux x86_64) Firefox/128.0",
+		DeviceInfo: "Firefox on Linux",
+	})
+	_, refresh, err := uc.LoginUser(ctx, user.Email, "password123")
+
+	require.NoError(t, err)
+	assert.Equal(t, "refresh_token", refresh)
+	sessions.AssertExpectations(t)
+	tokenService.AssertExpectations(t)
+}
+
+func TestAuthUseCase_RefreshSession_RotatesOnlyItsSession(t *testing.T) {
+	tokenService := new(testutil.MockTokenService)
+	tokenService.On("VerifyRefreshToken", mock.Anything, "old").Return(&interfaces.RefreshClaims{UserID: 5, SessionID: "sess-a"}, nil)
+	tokenService.On("GetRefreshToken", mock.Anything, "sess-a").Return("old", nil)
+	tokenService.On("GenerateRefreshToken", int64(5), "sess-a").Return("new", nil)
+	tokenService.On("GenerateAccessTokenForSession", int64(5), mock.AnythingOfType("string")).Return("access", nil)
+	tokenService.On("RotateRefreshToken", mock.Anything, "sess-a", "old", "new").Return(true, nil)
+
+	uc := NewAuthUseCase(new(testutil.MockUserRepo), nil, tokenService, new(testutil.MockCloudService))
+	refresh, access, err := uc.RefreshSession(context.Background(), "old")
+
+	require.NoError(t, err)
+	assert.Equal(t, "new", refresh)
+	assert.Equal(t, "access", access)
+	tokenService.AssertExpectations(t)
+}
+
+func TestAuthUseCase_RefreshSession_TouchesSession(t *testing.T) {
+	tokenService := new(testutil.MockTokenService)
+	sessions := new(testutil.MockSessionService)
+	tokenService.On("VerifyRefreshToken", mock.Anything, "old").Return(&interfaces.RefreshClaims{UserID: 5, SessionID: "sess-a"}, nil)
+	tokenService.On("GetRefreshToken", mock.Anything, "sess-a").Return("old", nil)
+	sessions.On("GetSession", mock.Anything, "sess-a").Return(&entity.UserSession{ID: "sess-a", UserID: 5}, nil)
+	sessions.On("UpdateLastUsed", mock.Anything, "sess-a").Return(nil)
+	tokenService.On("GenerateRefreshToken", int64(5), "sess-a").Return("new", nil)
+	tokenService.On("GenerateAccessTokenForSession", int64(5), "sess-a").Return("access", nil)
+	tokenService.On("RotateRefreshToken", mock.Anything, "sess-a", "old", "new").Return(true, nil)
+
+	uc := NewAuthUseCase(new(testutil.MockUserRepo), nil, tokenService, new(testutil.MockCloudService))
+	uc.Sessions = sessions
+	_, _, err := uc.RefreshSession(context.Background(), "old")
+
+	require.NoError(t, err)
+	sessions.AssertExpectations(t)
+	tokenService.AssertExpectations(t)
+}
+
+func TestAuthUseCase_RefreshSession_RevokedSession(t *testing.T) {
+	tokenService := new(testutil.MockTokenService)
+	sessions := new(testutil.MockSessionService)
+	tokenService.On("VerifyRefreshToken", mock.Anything, "old").Return(&interfaces.RefreshClaims{UserID: 5, SessionID: "sess-a"}, nil)
+	tokenService.On("GetRefreshToken", mock.Anything, "sess-a").Return("old", nil)
+	tokenService.On("RemoveRefreshToken", mock.Anything, "sess-a").Return(nil)
+	sessions.On("GetSession", mock.Anything, "sess-a").Return(nil, errors.New("session not found"))
+
+	uc := NewAuthUseCase(new(testutil.MockUserRepo), nil, tokenService, new(testutil.MockCloudService))
+	uc.Sessions = sessions
+	_, _, err := uc.RefreshSession(context.Background(), "old")
+
+	require.Error(t, err)
+	tokenService.AssertExpectations(t)
+	tokenService.AssertNotCalled(t, "RotateRefreshToken", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestAuthUseCase_RevokeSession_EndsTokens(t *testing.T) {
+	tokenService := new(testutil.MockTokenService)
+	sessions := new(testutil.MockSessionService)
+	sessions.On("RevokeSession", mock.Anything, int64(5), "sess-b").Return(nil)
+	tokenService.On("RemoveRefreshToken", mock.Anything, "sess-b").Return(nil)
+	tokenService.On("RevokeSessionAccessTokens", mock.Anything, "sess-b").Return(nil)
+
+	uc := NewAuthUseCase(new(testutil.MockUserRepo), nil, tokenService, new(testutil.MockCloudService))
+	uc.Sessions = sessions
+	require.NoError(t, uc.RevokeSession(context.Background(), 5, "sess-b"))
+
+	// Someone else's session is refused before its token is touched.
+	sessions.On("RevokeSession", mock.Anything, int64(6), "sess-b").Return(errors.New("session does not belong to user"))
+	require.Error(t, uc.RevokeSession(context.Background(), 6, "sess-b"))
+	tokenService.AssertNumberOfCalls(t, "RemoveRefreshToken", 1)
+	tokenService.AssertNumberOfCalls(t, "RevokeSessionAccessTokens", 1)
+}
+
+func TestAuthUseCase_RevokeOtherSessions(t *testing.T) {
+	tokenService := new(testutil.MockTokenService)
+	sessions := new(testutil.MockSessionService)
+	sessions.On("ListUserSessions", mock.Anything, int64(5)).Return([]*entity.UserSession{{ID: "sess-a"}, {ID: "sess-b"}, {ID: "sess-c"}}, nil)
+	sessions.On("RevokeAllSessions", mock.Anything, int64(5), "sess-a").Return(nil)
+	tokenService.On("RemoveRefreshToken", mock.Anything, "sess-b").Return(nil)
+	tokenService.On("RevokeSessionAccessTokens", mock.Anything, "sess-b").Return(nil)
+	tokenService.On("RemoveRefreshToken", mock.Anything, "sess-c").Return(nil)
+	tokenService.On("RevokeSessionAccessTokens", mock.Anything, "sess-c").Return(nil)
+
+	uc := NewAuthUseCase(new(testutil.MockUserRepo), nil, tokenService, new(testutil.MockCloudService))
+	uc.Sessions = sessions
+	require.NoError(t, uc.RevokeOtherSessions(context.Background(), 5, "sess-a"))
+
+	tokenService.AssertExpectations(t)
+	tokenService.AssertNotCalled(t, "RemoveRefreshToken", mock.Anything, "sess-a")
+	sessions.AssertExpectations(t)
+}
+
+func TestAuthUseCase_RefreshSession_StaleToken(t *testing.T) {
+	tokenService := new(testutil.MockTokenService)
+	tokenService.On("VerifyRefreshToken", mock.Anything, "stale").Return(&interfaces.RefreshClaims{UserID: 5, SessionID: "sess-a", TokenID: "t-other"}, nil)
+	tokenService.On("GetRefreshToken", mock.Anything, "sess-a").Return("current", nil)
+	tokenService.On("IsRefreshTokenInFamily", mock.Anything, "sess-a", "t-other").Return(false, nil)
+
+	uc := NewAuthUseCase(new(testutil.MockUserRepo), nil, tokenService, new(testutil.MockCloudService))
+	_, _, err := uc.RefreshSession(context.Background(), "stale")
+
+	require.Error(t, err)
+	tokenService.AssertNotCalled(t, "RotateRefreshToken", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestAuthUseCase_RefreshSession_ReuseRevokesFamily(t *testing.T) {
+	tokenService := new(testutil.MockTokenService)
+	sessions := new(testutil.MockSessionService)
+	businessRepo := new(testutil.MockBusinessRepo)
+	auditRepo := new(testutil.MockAuditRepo)
+
+	claims := &interfaces.RefreshClaims{UserID: 5, SessionID: "sess-a", TokenID: "t-1"}
+	tokenService.On("VerifyRefreshToken", mock.Anything, "rotated").Return(claims, nil)
+	tokenService.On("GetRefreshToken", mock.Anything, "sess-a").Return("current", nil)
+	tokenService.On("IsRefreshTokenInFamily", mock.Anything, "sess-a", "t-1").Return(true, nil)
+	tokenService.On("RemoveRefreshToken", mock.Anything, "sess-a").Return(nil)
+	tokenService.On("RevokeSessionAccessTokens", mock.Anything, "sess-a").Return(nil)
+	sessions.On("RevokeSession", mock.Anything, int64(5), "sess-a").Return(nil)
+	businessRepo.On("GetUserBusinesses", mock.Anything, int64(5)).Return([]*entity.Business{{ID: 10}}, nil)
+	auditRepo.On("Log", mock.Anything, mock.MatchedBy(func(a *entity.AuditLog) bool {
+		return a.BusinessID == 10 && a.UserID == 5 && a.Action == entity.AuditActionUserRefreshTokenReused
+	})).Return(nil)
+
+	uc := NewAuthUseCase(new(testutil.MockUserRepo), businessRepo, tokenService, new(testutil.MockCloudService))
+	uc.Sessions = sessions
+	uc.AuditRepo = auditRepo
+	_, _, err := uc.RefreshSession(context.Background(), "rotated")
+
+	require.ErrorIs(t, err, ErrRefreshTokenReused)
+	assert.Equal(t, 1.0, promtestutil.ToFloat64(uc.Metrics.RefreshTokenReuseTotal))
+	tokenService.AssertExpectations(t)
+	sessions.AssertExpectations(t)
+	auditRepo.AssertExpectations(t)
+}
+
+func TestAuthUseCase_RefreshSession_ConcurrentRefreshRevokesFamily(t *testing.T) {
+	tokenService := new(testutil.MockTokenService)
+	sessions := new(testutil.MockSessionService)
+
+	claims := &interfaces.RefreshClaims{UserID: 5, SessionID: "sess-a", TokenID: "t-1"}
+	tokenService.On("VerifyRefreshToken", mock.Anything, "old").Return(claims, nil)
+	tokenService.On("GetRefreshToken", mock.Anything, "sess-a").Return("old", nil)
+	sessions.On("GetSession", mock.Anything, "sess-a").Return(&entity.UserSession{ID: "sess-a", UserID: 5}, nil)
+	sessions.On("UpdateLastUsed", mock.Anything, "sess-a").Return(nil)
+	tokenService.On("GenerateRefreshToken", int64(5), "sess-a").Return("new", nil)
+	tokenService.On("GenerateAccessTokenForSession", int64(5), "sess-a").Return("access", nil)
+	// Another request rotated "old" between the read and the swap.
+	tokenService.On("RotateRefreshToken", mock.Anything, "sess-a", "old", "new").Return(false, nil)
+	tokenService.On("RemoveRefreshToken", mock.Anything, "sess-a").Return(nil)
+	tokenService.On("RevokeSessionAccessTokens", mock.Anything, "sess-a").Return(nil)
+	sessions.On("RevokeSession", mock.Anything, int64(5), "sess-a").Return(nil)
+
+	uc := NewAuthUseCase(new(testutil.MockUserRepo), new(testutil.MockBusinessRepo), tokenService, new(testutil.MockCloudService))
+	uc.Sessions = sessions
+	refresh, access, err := uc.RefreshSession(context.Background(), "old")
+
+	require.ErrorIs(t, err, ErrRefreshTokenReused)
+	assert.Empty(t, refresh)
+	assert.Empty(t, access)
+	assert.Equal(t, 1.0, promtestutil.ToFloat64(uc.Metrics.RefreshTokenReuseTotal))
+	tokenService.AssertExpectations(t)
+	sessions.AssertExpectations(t)
+}
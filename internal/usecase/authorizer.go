@@ -0,0 +1,118 @@
+package usecase
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/Prashant2307200/auth-service/internal/entity"
+	pkgdb "github.com/Prashant2307200/auth-service/pkg/db"
+)
+
+// ErrPermissionDenied means the user is not a member of the business or
+// their role lacks the permission.
+var ErrPermissionDenied = errors.New("permission denied")
+
+// MembershipFinder looks up a user's membership level in a business.
+type MembershipFinder interface {
+	GetUserRole(ctx context.Context, businessID int64, userID int64) (int, error)
+}
+
+// RoleFinder looks up a business's role by name.
+type RoleFinder interface {
+	GetByName(ctx context.Context, businessID int64, name string) (*entity.Role, error)
+}
+
+// Authorizer decides what members may do in their businesses. A member's
+// level names their role, and the business's role of that name lists their
+// permissions. Every business and team operation is checked here.
+type Authorizer struct {
+	memberships MembershipFinder
+	// roles holds the businesses' roles. When nil, or when a business lacks
+	// the role, the role's entity.SystemRoles permissions apply.
+	roles RoleFinder
+}
+
+func NewAuthorizer(memberships MembershipFinder, roles RoleFinder) *Authorizer {
+	return &Authorizer{memberships: memberships, roles: roles}
+}
+
+// BusinessRoleName returns the name of the system role of a membership
+// level.
+func BusinessRoleName(level int) string {
+	switch {
+	case level >= BusinessRoleOwner:
+		return entity.RoleNameOwner
+	case level == BusinessRoleAdmin:
+		return entity.RoleNameAdmin
+	default:
+		return entity.RoleNameMember
+	}
+}
+
+// rolePermissions returns the permissions of the business's role name.
+func (a *Authorizer) rolePermissions(ctx context.Context, businessID int64, name string) ([]string, error) {
+	// Owners cannot be locked out of their business.
+	if name == entity.RoleNameOwner || a.roles == nil {
+		return entity.SystemRoles[name], nil
+	}
+	role, err := a.roles.GetByName(ctx, businessID, name)
+	if errors.Is(err, pkgdb.ErrNotFound) || errors.Is(err, sql.ErrNoRows) {
+		return entity.SystemRoles[name], nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get role: %w", err)
+	}
+	return role.Permissions, nil
+}
+
+// Permissions returns the permissions userID holds in businessID.
+func (a *Authorizer) Permissions(ctx context.Context, userID, businessID int64) ([]string, error) {
+	level, err := a.memberships.GetUserRole(ctx, businessID, userID)
+	if errors.Is(err, pkgdb.ErrNotFound) || errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: not a member of the business", ErrPermissionDenied)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get membership: %w", err)
+	}
+	return a.rolePermissions(ctx, businessID, BusinessRoleName(level))
+}
+
+// Authorize returns an error wrapping ErrPermissionDenied unless userID
+// holds permission in businessID.
+func (a *Authorizer) Authorize(ctx context.Context, userID, businessID int64, permission string) error {
+	permissions, err := a.Permissions(ctx, userID, businessID)
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(permissions, permission) {
+		return fmt.Errorf("%w: requires %s", ErrPermissionDenied, permission)
+	}
+	return nil
+}
+
+// AuthorizeGrant returns an error wrapping ErrPermissionDenied unless
+// userID holds permission in businessID along with every permission of the
+// role of level, so that nobody hands out more than they have.
+func (a *Authorizer) AuthorizeGrant(ctx context.Context, userID, businessID int64, permission string, level int) error {
+	permissions, err := a.Permissions(ctx, userID, businessID)
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(permissions, permission) {
+		return fmt.Errorf("%w: requires %s", ErrPermissionDenied, permission)
+	}
+	name := BusinessRoleName(level)
+	granted, err := a.rolePermissions(ctx, businessID, name)
+	if err != nil {
+		return err
+	}
+	for _, p := range granted {
+		if !slices.Contains(permissions, p) {
+			return fmt.Errorf("%w: granting %s requires %s", ErrPermissionDenied, name, p)
+		}
+	}
+	return nil
+}
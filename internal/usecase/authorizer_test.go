@@ -0,0 +1,105 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/Prashant2307200/auth-service/internal/entity"
+	"github.com/Prashant2307200/auth-service/internal/testutil"
+	pkgdb "github.com/Prashant2307200/auth-service/pkg/db"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeRoles map[string][]string
+
+func (f fakeRoles) GetByName(_ context.Context, businessID int64, name string) (*entity.Role, error) {
+	perms, ok := f[name]
+	if !ok {
+		return nil, fmt.Errorf("role with identifier %v not found: %w", name, pkgdb.ErrNotFound)
+	}
+	return &entity.Role{BusinessID: businessID, Name: name, Permissions: perms}, nil
+}
+
+func TestAuthorizer_SystemRoles(t *testing.T) {
+	businessRepo := new(testutil.MockBusinessRepo)
+	businessRepo.On("GetUserRole", mock.Anything, int64(5), int64(1)).Return(BusinessRoleOwner, nil)
+	businessRepo.On("GetUserRole", mock.Anything, int64(5), int64(2)).Return(BusinessRoleAdmin, nil)
+	businessRepo.On("GetUserRole", mock.Anything, int64(5), int64(3)).Return(BusinessRoleMember, nil)
+	authz := NewAuthorizer(businessRepo, nil)
+	ctx := context.Background()
+
+	for _, p := range entity.Permissions {
+		assert.NoError(t, authz.Authorize(ctx, 1, 5, p), "owner %s", p)
+	}
+	assert.NoError(t, authz.Authorize(ctx, 2, 5, entity.PermissionMembersInvite))
+	assert.ErrorIs(t, authz.Authorize(ctx, 2, 5, entity.PermissionBusinessDelete), ErrPermissionDenied)
+	assert.NoError(t, authz.Authorize(ctx, 3, 5, entity.PermissionMembersRead))
+	assert.ErrorIs(t, authz.Authorize(ctx, 3, 5, entity.PermissionAuditRead), ErrPermissionDenied)
+}
+
+func TestAuthorizer_BusinessRoles(t *testing.T) {
+	businessRepo := new(testutil.MockBusinessRepo)
+	businessRepo.On("GetUserRole", mock.Anything, int64(5), int64(1)).Return(BusinessRoleOwner, nil)
+	businessRepo.On("GetUserRole", mock.Anything, int64(5), int64(2)).Return(BusinessRoleAdmin, nil)
+	businessRepo.On("GetUserRole", mock.Anything, int64(5), int64(3)).Return(BusinessRoleMember, nil)
+	// The business narrowed admins and let members read the audit log; its
+	// owner role is empty but owners keep every permission.
+	authz := NewAuthorizer(businessRepo, fakeRoles{
+		entity.RoleNameOwner:  {},
+		entity.RoleNameAdmin:  {entity.PermissionMembersRead, entity.PermissionMembersInvite},
+		entity.RoleNameMember: {entity.PermissionMembersRead, entity.PermissionAuditRead},
+	})
+	ctx := context.Background()
+
+	assert.NoError(t, authz.Authorize(ctx, 1, 5, entity.PermissionBusinessDelete))
+	assert.ErrorIs(t, authz.Authorize(ctx, 2, 5, entity.PermissionDomainsManage), ErrPermissionDenied)
+	assert.NoError(t, authz.Authorize(ctx, 3, 5, entity.PermissionAuditRead))
+}
+
+func TestAuthorizer_MissingRoleFallsBackToSystemRole(t *testing.T) {
+	businessRepo := new(testutil.MockBusinessRepo)
+	businessRepo.On("GetUserRole", mock.Anything, int64(5), int64(2)).Return(BusinessRoleAdmin, nil)
+	authz := NewAuthorizer(businessRepo, fakeRoles{})
+
+	assert.NoError(t, authz.Authorize(context.Background(), 2, 5, entity.PermissionSSOManage))
+}
+
+func TestAuthorizer_NonMember(t *testing.T) {
+	businessRepo := new(testutil.MockBusinessRepo)
+	businessRepo.On("GetUserRole", mock.Anything, int64(5), int64(9)).Return(0, fmt.Errorf("business user not found: %w", pkgdb.ErrNotFound))
+	businessRepo.On("GetUserRole", mock.Anything, int64(6), int64(9)).Return(0, errors.New("connection refused"))
+	authz := NewAuthorizer(businessRepo, nil)
+
+	assert.ErrorIs(t, authz.Authorize(context.Background(), 9, 5, entity.PermissionMembersRead), ErrPermissionDenied)
+	err := authz.Authorize(context.Background(), 9, 6, entity.PermissionMembersRead)
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, ErrPermissionDenied)
+}
+
+func TestAuthorizer_AuthorizeGrant(t *testing.T) {
+	businessRepo := new(testutil.MockBusinessRepo)
+	businessRepo.On("GetUserRole", mock.Anything, int64(5), int64(1)).Return(BusinessRoleOwner, nil)
+	businessRepo.On("GetUserRole", mock.Anything, int64(5), int64(2)).Return(BusinessRoleAdmin, nil)
+	authz := NewAuthorizer(businessRepo, nil)
+	ctx := context.Background()
+
+	assert.NoError(t, authz.AuthorizeGrant(ctx, 2, 5, entity.PermissionMembersInvite, BusinessRoleAdmin))
+	// Admins lack business:delete, so they cannot make owners.
+	assert.ErrorIs(t, authz.AuthorizeGrant(ctx, 2, 5, entity.PermissionMembersInvite, BusinessRoleOwner), ErrPermissionDenied)
+	assert.NoError(t, authz.AuthorizeGrant(ctx, 1, 5, entity.PermissionMembersInvite, BusinessRoleOwner))
+}
+
+func TestBusinessUseCase_CreateInvite_AdminCannotInviteOwner(t *testing.T) {
+	businessRepo := new(testutil.MockBusinessRepo)
+	uc := NewBusinessUseCase(businessRepo, new(testutil.MockUserRepo))
+	businessRepo.On("GetUserRole", mock.Anything, int64(5), int64(2)).Return(BusinessRoleAdmin, nil)
+
+	_, err := uc.CreateInvite(context.Background(), 2, 5, "new@acme.com", BusinessRoleOwner)
+	require.ErrorIs(t, err, ErrPermissionDenied)
+	assert.Contains(t, err.Error(), "not allowed to create invite")
+	businessRepo.AssertNotCalled(t, "CreateInvite", mock.Anything, mock.Anything)
+}
@@ -4,12 +4,14 @@ import (
 	"context"
 	"crypto/rand"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"strings"
 	"time"
 
 	"github.com/Prashant2307200/auth-service/internal/entity"
 	"github.com/Prashant2307200/auth-service/internal/usecase/interfaces"
+	"github.com/Prashant2307200/auth-service/pkg/domainverify"
 )
 
 const (
@@ -21,15 +23,42 @@ const (
 type BusinessUseCase struct {
 	BusinessRepo interfaces.BusinessRepo
 	UserRepo     interfaces.UserRepo
+	// DomainVerifier looks for the tokens that prove domain ownership.
+	// Without one, domains cannot be verified.
+	DomainVerifier DomainVerifier
+	// Authorizer checks every operation; by default members get their
+	// system role's permissions.
+	Authorizer *Authorizer
 }
 
 func NewBusinessUseCase(businessRepo interfaces.BusinessRepo, userRepo interfaces.UserRepo) *BusinessUseCase {
 	return &BusinessUseCase{
 		BusinessRepo: businessRepo,
 		UserRepo:     userRepo,
+		Authorizer:   NewAuthorizer(businessRepo, nil),
 	}
 }
 
+// authorizeGrant is authorize for operations that give someone the role of
+// level, which requesterID must hold every permission of.
+func (uc *BusinessUseCase) authorizeGrant(ctx context.Context, requesterID, businessID int64, permission string, level int, denied string) error {
+	err := uc.Authorizer.AuthorizeGrant(ctx, requesterID, businessID, permission, level)
+	if errors.Is(err, ErrPermissionDenied) {
+		return fmt.Errorf("%s: %w", denied, err)
+	}
+	return err
+}
+
+// authorize checks that requesterID holds permission in businessID,
+// describing a denial with denied.
+func (uc *BusinessUseCase) authorize(ctx context.Context, requesterID, businessID int64, permission, denied string) error {
+	err := uc.Authorizer.Authorize(ctx, requesterID, businessID, permission)
+	if errors.Is(err, ErrPermissionDenied) {
+		return fmt.Errorf("%s: %w", denied, err)
+	}
+	return err
+}
+
 func (uc *BusinessUseCase) CreateBusiness(ctx context.Context, creatorID int64, business *entity.Business) (*entity.Business, error) {
 	if business == nil {
 		return nil, fmt.Errorf("business cannot be nil")
@@ -52,23 +81,15 @@ func (uc *BusinessUseCase) GetBusinessByID(ctx context.Context, id int64) (*enti
 }
 
 func (uc *BusinessUseCase) UpdateBusiness(ctx context.Context, requesterID int64, businessID int64, business *entity.Business) error {
-	role, err := uc.BusinessRepo.GetUserRole(ctx, businessID, requesterID)
-	if err != nil {
-		return fmt.Errorf("not allowed to update business")
-	}
-	if role < BusinessRoleAdmin {
-		return fmt.Errorf("not allowed to update business")
+	if err := uc.authorize(ctx, requesterID, businessID, entity.PermissionBusinessUpdate, "not allowed to update business"); err != nil {
+		return err
 	}
 	return uc.BusinessRepo.Update(ctx, businessID, business)
 }
 
 func (uc *BusinessUseCase) DeleteBusiness(ctx context.Context, requesterID int64, businessID int64) error {
-	role, err := uc.BusinessRepo.GetUserRole(ctx, businessID, requesterID)
-	if err != nil {
-		return fmt.Errorf("not allowed to delete business")
-	}
-	if role != BusinessRoleOwner {
-		return fmt.Errorf("only owner can delete business")
+	if err := uc.authorize(ctx, requesterID, businessID, entity.PermissionBusinessDelete, "only owner can delete business"); err != nil {
+		return err
 	}
 	return uc.BusinessRepo.Delete(ctx, businessID)
 }
@@ -77,12 +98,8 @@ func (uc *BusinessUseCase) AddUserToBusiness(ctx context.Context, requesterID in
 	if role < BusinessRoleMember || role > BusinessRoleOwner {
 		return fmt.Errorf("invalid role")
 	}
-	requesterRole, err := uc.BusinessRepo.GetUserRole(ctx, businessID, requesterID)
-	if err != nil {
-		return fmt.Errorf("not allowed to add user to business")
-	}
-	if requesterRole < BusinessRoleAdmin {
-		return fmt.Errorf("not allowed to add user to business")
+	if err := uc.authorizeGrant(ctx, requesterID, businessID, entity.PermissionMembersManage, role, "not allowed to add user to business"); err != nil {
+		return err
 	}
 	if _, err := uc.UserRepo.GetById(ctx, userID); err != nil {
 		return fmt.Errorf("failed to validate user: %w", err)
@@ -91,12 +108,8 @@ func (uc *BusinessUseCase) AddUserToBusiness(ctx context.Context, requesterID in
 }
 
 func (uc *BusinessUseCase) RemoveUserFromBusiness(ctx context.Context, requesterID int64, businessID int64, userID int64) error {
-	requesterRole, err := uc.BusinessRepo.GetUserRole(ctx, businessID, requesterID)
-	if err != nil {
-		return fmt.Errorf("not allowed to remove user from business")
-	}
-	if requesterRole < BusinessRoleAdmin {
-		return fmt.Errorf("not allowed to remove user from business")
+	if err := uc.authorize(ctx, requesterID, businessID, entity.PermissionMembersManage, "not allowed to remove user from business"); err != nil {
+		return err
 	}
 
 	targetRole, err := uc.BusinessRepo.GetUserRole(ctx, businessID, userID)
@@ -110,8 +123,8 @@ func (uc *BusinessUseCase) RemoveUserFromBusiness(ctx context.Context, requester
 }
 
 func (uc *BusinessUseCase) GetBusinessUsers(ctx context.Context, requesterID int64, businessID int64) ([]*entity.User, error) {
-	if _, err := uc.BusinessRepo.GetUserRole(ctx, businessID, requesterID); err != nil {
-		return nil, fmt.Errorf("not allowed to access business users")
+	if err := uc.authorize(ctx, requesterID, businessID, entity.PermissionMembersRead, "not allowed to access business users"); err != nil {
+		return nil, err
 	}
 	return uc.BusinessRepo.GetUsers(ctx, businessID)
 }
@@ -121,16 +134,12 @@ func (uc *BusinessUseCase) GetUserBusinesses(ctx context.Context, userID int64)
 }
 
 func (uc *BusinessUseCase) CreateInvite(ctx context.Context, requesterID int64, businessID int64, email string, role int) (*entity.BusinessInvite, error) {
-	requesterRole, err := uc.BusinessRepo.GetUserRole(ctx, businessID, requesterID)
-	if err != nil {
-		return nil, fmt.Errorf("not allowed to create invite")
-	}
-	if requesterRole < BusinessRoleAdmin {
-		return nil, fmt.Errorf("not allowed to create invite")
-	}
 	if role < BusinessRoleMember || role > BusinessRoleOwner {
 		return nil, fmt.Errorf("invalid role")
 	}
+	if err := uc.authorizeGrant(ctx, requesterID, businessID, entity.PermissionMembersInvite, role, "not allowed to create invite"); err != nil {
+		return nil, err
+	}
 	token, err := generateSecureToken(32)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate invite token: %w", err)
@@ -154,39 +163,30 @@ func (uc *BusinessUseCase) CreateInvite(ctx context.Context, requesterID int64,
 }
 
 func (uc *BusinessUseCase) ListInvites(ctx context.Context, requesterID int64, businessID int64) ([]*entity.BusinessInvite, error) {
-	role, err := uc.BusinessRepo.GetUserRole(ctx, businessID, requesterID)
-	if err != nil {
-		return nil, fmt.Errorf("not allowed to list invites")
-	}
-	if role < BusinessRoleAdmin {
-		return nil, fmt.Errorf("not allowed to list invites")
+	if err := uc.authorize(ctx, requesterID, businessID, entity.PermissionMembersInvite, "not allowed to list invites"); err != nil {
+		return nil, err
 	}
 	return uc.BusinessRepo.ListInvites(ctx, businessID)
 }
 
 func (uc *BusinessUseCase) RevokeInvite(ctx context.Context, requesterID int64, businessID int64, inviteID int64) error {
-	requesterRole, err := uc.BusinessRepo.GetUserRole(ctx, businessID, requesterID)
-	if err != nil {
-		return fmt.Errorf("not allowed to revoke invite")
-	}
-	if requesterRole < BusinessRoleAdmin {
-		return fmt.Errorf("not allowed to revoke invite")
+	if err := uc.authorize(ctx, requesterID, businessID, entity.PermissionMembersInvite, "not allowed to revoke invite"); err != nil {
+		return err
 	}
 	return uc.BusinessRepo.RevokeInvite(ctx, inviteID, businessID)
 }
 
 func (uc *BusinessUseCase) AddDomain(ctx context.Context, requesterID int64, businessID int64, domain string) (*entity.BusinessDomain, error) {
-	requesterRole, err := uc.BusinessRepo.GetUserRole(ctx, businessID, requesterID)
-	if err != nil {
-		return nil, fmt.Errorf("not allowed to add domain")
-	}
-	if requesterRole < BusinessRoleAdmin {
-		return nil, fmt.Errorf("not allowed to add domain")
+	if err := uc.authorize(ctx, requesterID, businessID, entity.PermissionDomainsManage, "not allowed to add domain"); err != nil {
+		return nil, err
 	}
-	domain = strings.ToLower(strings.TrimSpace(domain))
+	domain = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(domain)), ".")
 	if domain == "" {
 		return nil, fmt.Errorf("domain cannot be empty")
 	}
+	if !domainverify.ValidDomain(domain) {
+		return nil, fmt.Errorf("invalid domain")
+	}
 	existing, _ := uc.BusinessRepo.GetDomain(ctx, businessID, domain)
 	if existing != nil {
 		return nil, fmt.Errorf("domain already added")
@@ -195,12 +195,15 @@ func (uc *BusinessUseCase) AddDomain(ctx context.Context, requesterID int64, bus
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate verification token: %w", err)
 	}
+	// The first scheduled check gives the admin time to publish the token.
+	firstCheck := time.Now().Add(domainRetryBase)
 	d := &entity.BusinessDomain{
 		BusinessID:        businessID,
 		Domain:            domain,
 		Verified:          false,
 		AutoJoinEnabled:   false,
 		VerificationToken: token,
+		NextCheckAt:       &firstCheck,
 	}
 	id, err := uc.BusinessRepo.CreateDomain(ctx, d)
 	if err != nil {
@@ -210,39 +213,28 @@ func (uc *BusinessUseCase) AddDomain(ctx context.Context, requesterID int64, bus
 	return d, nil
 }
 
-func (uc *BusinessUseCase) VerifyDomain(ctx context.Context, requesterID int64, businessID int64, verificationToken string) (*entity.BusinessDomain, error) {
-	requesterRole, err := uc.BusinessRepo.GetUserRole(ctx, businessID, requesterID)
-	if err != nil {
-		return nil, fmt.Errorf("not allowed to verify domain")
-	}
-	if requesterRole < BusinessRoleAdmin {
-		return nil, fmt.Errorf("not allowed to verify domain")
-	}
-	d, err := uc.BusinessRepo.GetDomainByVerificationToken(ctx, verificationToken)
-	if err != nil {
-		return nil, fmt.Errorf("invalid verification token")
-	}
-	if d.BusinessID != businessID {
-		return nil, fmt.Errorf("domain does not belong to this business")
+func (uc *BusinessUseCase) ToggleDomainAutoJoin(ctx context.Context, requesterID int64, businessID int64, domainID int64, enabled bool) error {
+	if err := uc.authorize(ctx, requesterID, businessID, entity.PermissionDomainsManage, "not allowed to update domain"); err != nil {
+		return err
 	}
-	if err := uc.BusinessRepo.VerifyDomain(ctx, d.ID); err != nil {
+	return uc.BusinessRepo.UpdateDomainAutoJoin(ctx, domainID, businessID, enabled)
+}
+
+func (uc *BusinessUseCase) GetLoginPolicy(ctx context.Context, requesterID int64, businessID int64) (*entity.BusinessLoginPolicy, error) {
+	if err := uc.authorize(ctx, requesterID, businessID, entity.PermissionSSOManage, "not allowed to view login policy"); err != nil {
 		return nil, err
 	}
-	d.Verified = true
-	now := time.Now()
-	d.VerifiedAt = &now
-	return d, nil
+	return uc.BusinessRepo.GetLoginPolicy(ctx, businessID)
 }
 
-func (uc *BusinessUseCase) ToggleDomainAutoJoin(ctx context.Context, requesterID int64, businessID int64, domainID int64, enabled bool) error {
-	requesterRole, err := uc.BusinessRepo.GetUserRole(ctx, businessID, requesterID)
-	if err != nil {
-		return fmt.Errorf("not allowed to update domain")
+// UpdateLoginPolicy sets how users in the business's verified domains sign
+// in. Disabling password login applies to every user with such an email,
+// members or not, admins included.
+func (uc *BusinessUseCase) UpdateLoginPolicy(ctx context.Context, requesterID int64, policy *entity.BusinessLoginPolicy) error {
+	if err := uc.authorize(ctx, requesterID, policy.BusinessID, entity.PermissionSSOManage, "not allowed to update login policy"); err != nil {
+		return err
 	}
-	if requesterRole < BusinessRoleAdmin {
-		return fmt.Errorf("not allowed to update domain")
-	}
-	return uc.BusinessRepo.UpdateDomainAutoJoin(ctx, domainID, businessID, enabled)
+	return uc.BusinessRepo.UpdateLoginPolicy(ctx, policy)
 }
 
 func generateSecureToken(n int) (string, error) {
@@ -155,6 +155,16 @@ func TestBusinessUseCase_AddDomain(t *testing.T) {
 	businessRepo.AssertExpectations(t)
 }
 
+// fakeDomainVerifier maps the domains whose token is published to how.
+type fakeDomainVerifier map[string]string
+
+func (f fakeDomainVerifier) Verify(_ context.Context, domain, _ string) (string, error) {
+	if method, ok := f[domain]; ok {
+		return method, nil
+	}
+	return "", errors.New("verification token not found")
+}
+
 func TestBusinessUseCase_VerifyDomain(t *testing.T) {
 	businessRepo := new(testutil.MockBusinessRepo)
 	userRepo := new(testutil.MockUserRepo)
@@ -164,14 +174,107 @@ func TestBusinessUseCase_VerifyDomain(t *testing.T) {
 	domain.ID = 4
 	businessRepo.On("GetUserRole", mock.Anything, int64(5), int64(1)).Return(BusinessRoleAdmin, nil)
 	businessRepo.On("GetDomainByVerificationToken", mock.Anything, "verify-tok").Return(domain, nil)
-	businessRepo.On("VerifyDomain", mock.Anything, int64(4)).Return(nil)
+	businessRepo.On("UpdateDomainCheck", mock.Anything, domain).Return(nil)
+	uc.DomainVerifier = fakeDomainVerifier{"acme.com": "dns"}
 
 	d, err := uc.VerifyDomain(context.Background(), 1, 5, "verify-tok")
 	require.NoError(t, err)
 	require.NotNil(t, d)
+	assert.True(t, d.Verified)
+	assert.Equal(t, "dns", d.VerificationMethod)
+	businessRepo.AssertExpectations(t)
+}
+
+func TestBusinessUseCase_VerifyDomain_TokenNotPublished(t *testing.T) {
+	businessRepo := new(testutil.MockBusinessRepo)
+	uc := NewBusinessUseCase(businessRepo, new(testutil.MockUserRepo))
+	uc.DomainVerifier = fakeDomainVerifier{}
+
+	domain := testutil.CreateTestDomain(5, "acme.com", false, false)
+	domain.CheckFailures = 9
+	businessRepo.On("GetUserRole", mock.Anything, int64(5), int64(1)).Return(BusinessRoleAdmin, nil)
+	businessRepo.On("GetDomainByVerificationToken", mock.Anything, "verify-tok").Return(domain, nil)
+	businessRepo.On("UpdateDomainCheck", mock.Anything, domain).Return(nil)
+
+	_, err := uc.VerifyDomain(context.Background(), 1, 5, "verify-tok")
+	assert.ErrorIs(t, err, ErrDomainNotVerified)
+	assert.False(t, domain.Verified)
+	// Asking again restarts the retry schedule.
+	assert.Equal(t, 1, domain.CheckFailures)
+	require.NotNil(t, domain.NextCheckAt)
+	assert.WithinDuration(t, time.Now().Add(domainRetryBase), *domain.NextCheckAt, time.Minute)
+	businessRepo.AssertExpectations(t)
+}
+
+func TestBusinessUseCase_CheckDueDomains(t *testing.T) {
+	verifiedAt := time.Now().Add(-48 * time.Hour)
+	published := &entity.BusinessDomain{ID: 1, BusinessID: 5, Domain: "published.com"}
+	pending := &entity.BusinessDomain{ID: 2, BusinessID: 5, Domain: "pending.com", CheckFailures: 3}
+	flaky := &entity.BusinessDomain{ID: 3, BusinessID: 5, Domain: "flaky.com", Verified: true, VerifiedAt: &verifiedAt, VerificationMethod: "dns"}
+	lapsed := &entity.BusinessDomain{ID: 4, BusinessID: 5, Domain: "lapsed.com", Verified: true, VerifiedAt: &verifiedAt, VerificationMethod: "http", CheckFailures: domainLapseChecks - 1}
+	abandoned := &entity.BusinessDomain{ID: 5, BusinessID: 5, Domain: "abandoned.com", CheckFailures: domainMaxPendingChecks - 1}
+	domains := []*entity.BusinessDomain{published, pending, flaky, lapsed, abandoned}
+
+	businessRepo := new(testutil.MockBusinessRepo)
+	businessRepo.On("ClaimDueDomains", mock.Anything, mock.AnythingOfType("time.Time"), mock.AnythingOfType("time.Time"), domainCheckBatch).Return(domains, nil)
+	businessRepo.On("UpdateClaimedDomainCheck", mock.Anything, mock.AnythingOfType("*entity.BusinessDomain"), mock.AnythingOfType("time.Time")).Return(true, nil).Times(len(domains))
+	uc := NewBusinessUseCase(businessRepo, new(testutil.MockUserRepo))
+	uc.DomainVerifier = fakeDomainVerifier{"published.com": "http"}
+
+	n, err := uc.CheckDueDomains(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, len(domains), n)
+	now := time.Now()
+
+	assert.True(t, published.Verified)
+	assert.Equal(t, "http", published.VerificationMethod)
+	assert.WithinDuration(t, now.Add(domainRecheckInterval), *published.NextCheckAt, time.Minute)
+
+	assert.False(t, pending.Verified)
+	assert.Equal(t, 4, pending.CheckFailures)
+	assert.WithinDuration(t, now.Add(8*domainRetryBase), *pending.NextCheckAt, time.Minute)
+
+	assert.True(t, flaky.Verified, "one failed check does not lapse a domain")
+	assert.Equal(t, 1, flaky.CheckFailures)
+	assert.WithinDuration(t, now.Add(domainLapseRetry), *flaky.NextCheckAt, time.Minute)
+
+	assert.False(t, lapsed.Verified)
+	assert.Nil(t, lapsed.VerifiedAt)
+	assert.Empty(t, lapsed.VerificationMethod)
+	assert.Equal(t, 0, lapsed.CheckFailures)
+	assert.WithinDuration(t, now.Add(domainRetryBase), *lapsed.NextCheckAt, time.Minute)
+
+	assert.Nil(t, abandoned.NextCheckAt, "checks stop after too many failures")
 	businessRepo.AssertExpectations(t)
 }
 
+func TestBusinessUseCase_CheckDueDomains_RecordsUnderClaim(t *testing.T) {
+	// The claim returns the lease as stored, which the check must present
+	// when recording, whatever the clock says by then.
+	stored := time.Now().Add(domainCheckLease).Truncate(time.Microsecond)
+	d := &entity.BusinessDomain{ID: 1, BusinessID: 5, Domain: "slow.com", NextCheckAt: &stored}
+
+	businessRepo := new(testutil.MockBusinessRepo)
+	businessRepo.On("ClaimDueDomains", mock.Anything, mock.AnythingOfType("time.Time"), mock.AnythingOfType("time.Time"), domainCheckBatch).
+		Return([]*entity.BusinessDomain{d}, nil)
+	// Another instance claimed it after the lease ran out.
+	businessRepo.On("UpdateClaimedDomainCheck", mock.Anything, d, stored).Return(false, nil)
+	uc := NewBusinessUseCase(businessRepo, new(testutil.MockUserRepo))
+	uc.DomainVerifier = fakeDomainVerifier{}
+
+	n, err := uc.CheckDueDomains(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	businessRepo.AssertExpectations(t)
+	businessRepo.AssertNotCalled(t, "UpdateDomainCheck", mock.Anything, mock.Anything)
+}
+
+func TestDomainRetryDelay(t *testing.T) {
+	assert.Equal(t, domainRetryBase, domainRetryDelay(1))
+	assert.Equal(t, 4*domainRetryBase, domainRetryDelay(3))
+	assert.Equal(t, domainRetryMax, domainRetryDelay(domainMaxPendingChecks))
+}
+
 func TestBusinessUseCase_ToggleDomainAutoJoin(t *testing.T) {
 	businessRepo := new(testutil.MockBusinessRepo)
 	userRepo := new(testutil.MockUserRepo)
@@ -0,0 +1,23 @@
+package usecase
+
+import "context"
+
+// ClientInfo describes the device a request came from. Transports attach it
+// to the request context so new sessions record where they were started.
+type ClientInfo struct {
+	IPAddress  string
+	UserAgent  string
+	DeviceInfo string
+}
+
+type clientInfoKey struct{}
+
+func WithClientInfo(ctx context.Context, info ClientInfo) context.Context {
+	return context.WithValue(ctx, clientInfoKey{}, info)
+}
+
+// ClientInfoFrom returns the client attached to ctx, or the zero value.
+func ClientInfoFrom(ctx context.Context) ClientInfo {
+	info, _ := ctx.Value(clientInfoKey{}).(ClientInfo)
+	return info
+}
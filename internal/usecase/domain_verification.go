@@ -0,0 +1,184 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/Prashant2307200/auth-service/internal/entity"
+)
+
+// DomainVerifier looks for token where whoever controls domain can publish
+// it, returning how it was found. *domainverify.Verifier is one.
+type DomainVerifier interface {
+	Verify(ctx context.Context, domain, token string) (method string, err error)
+}
+
+var (
+	ErrDomainVerificationUnavailable = errors.New("domain verification is not configured")
+	// ErrDomainNotVerified wraps what the verifier found instead of the token.
+	ErrDomainNotVerified = errors.New("domain ownership could not be verified")
+)
+
+const (
+	// Verified domains are checked again daily, so lapsed ones are noticed.
+	domainRecheckInterval = 24 * time.Hour
+	// A verified domain whose token went missing is checked again every
+	// domainLapseRetry and lapses after domainLapseChecks failures in a row,
+	// riding out DNS and hosting hiccups of under a day.
+	domainLapseRetry  = 6 * time.Hour
+	domainLapseChecks = 4
+	// Unverified domains are checked after domainRetryBase, doubling up to
+	// domainRetryMax, until domainMaxPendingChecks failures; VerifyDomain
+	// starts them over.
+	domainRetryBase        = 5 * time.Minute
+	domainRetryMax         = 6 * time.Hour
+	domainMaxPendingChecks = 16
+	// domainCheckLease keeps other instances off domains being checked.
+	domainCheckLease = 5 * time.Minute
+	domainCheckBatch = 50
+)
+
+// domainRetryDelay is the wait before the next check of an unverified
+// domain that failed failures checks.
+func domainRetryDelay(failures int) time.Duration {
+	delay := domainRetryBase
+	for i := 1; i < failures && delay < domainRetryMax; i++ {
+		delay *= 2
+	}
+	return min(delay, domainRetryMax)
+}
+
+// checkDomain looks for d's token, updates d's verification state and
+// schedule with the outcome and records it. It returns the verifier's
+// error, wrapped in ErrDomainNotVerified, when the token was not found.
+func (uc *BusinessUseCase) checkDomain(ctx context.Context, d *entity.BusinessDomain, now time.Time) error {
+	verifyErr := uc.lookForToken(ctx, d, now)
+	if err := uc.BusinessRepo.UpdateDomainCheck(ctx, d); err != nil {
+		return err
+	}
+	return verifyErr
+}
+
+// lookForToken looks for d's token and updates d's verification state and
+// schedule with the outcome, without recording it.
+func (uc *BusinessUseCase) lookForToken(ctx context.Context, d *entity.BusinessDomain, now time.Time) error {
+	method, verifyErr := uc.DomainVerifier.Verify(ctx, d.Domain, d.VerificationToken)
+	d.LastCheckedAt = &now
+	var next time.Time
+	switch {
+	case verifyErr == nil:
+		if !d.Verified {
+			d.Verified = true
+			d.VerifiedAt = &now
+		}
+		d.VerificationMethod = method
+		d.CheckFailures = 0
+		next = now.Add(domainRecheckInterval)
+	case d.Verified:
+		d.CheckFailures++
+		next = now.Add(domainLapseRetry)
+		if d.CheckFailures >= domainLapseChecks {
+			slog.Warn("Domain verification lapsed", slog.Int64("business_id", d.BusinessID), slog.String("domain", d.Domain), slog.Any("error", verifyErr))
+			d.Verified = false
+			d.VerifiedAt = nil
+			d.VerificationMethod = ""
+			d.CheckFailures = 0
+			next = now.Add(domainRetryDelay(1))
+		}
+	default:
+		d.CheckFailures++
+		next = now.Add(domainRetryDelay(d.CheckFailures))
+	}
+	d.NextCheckAt = &next
+	if !d.Verified && d.CheckFailures >= domainMaxPendingChecks {
+		d.NextCheckAt = nil
+	}
+	if verifyErr != nil {
+		return fmt.Errorf("%w: %v", ErrDomainNotVerified, verifyErr)
+	}
+	return nil
+}
+
+// VerifyDomain checks at once for the token of the business's domain that
+// verificationToken belongs to, which the admin has published in DNS or on
+// the domain's website. Until it is found the domain keeps being checked in
+// the background.
+func (uc *BusinessUseCase) VerifyDomain(ctx context.Context, requesterID int64, businessID int64, verificationToken string) (*entity.BusinessDomain, error) {
+	if err := uc.authorize(ctx, requesterID, businessID, entity.PermissionDomainsManage, "not allowed to verify domain"); err != nil {
+		return nil, err
+	}
+	d, err := uc.BusinessRepo.GetDomainByVerificationToken(ctx, verificationToken)
+	if err != nil {
+		return nil, fmt.Errorf("invalid verification token")
+	}
+	if d.BusinessID != businessID {
+		return nil, fmt.Errorf("domain does not belong to this business")
+	}
+	if uc.DomainVerifier == nil {
+		return nil, ErrDomainVerificationUnavailable
+	}
+	if !d.Verified {
+		// An admin asking again restarts the retry schedule.
+		d.CheckFailures = 0
+	}
+	if err := uc.checkDomain(ctx, d, time.Now()); err != nil {
+		return d, err
+	}
+	return d, nil
+}
+
+func (uc *BusinessUseCase) ListDomains(ctx context.Context, requesterID int64, businessID int64) ([]*entity.BusinessDomain, error) {
+	if err := uc.authorize(ctx, requesterID, businessID, entity.PermissionDomainsManage, "not allowed to list domains"); err != nil {
+		return nil, err
+	}
+	return uc.BusinessRepo.ListDomains(ctx, businessID)
+}
+
+// CheckDueDomains checks the domains whose next check is due: unverified
+// ones until their token shows up, verified ones to notice when it goes
+// away. Every instance may run it: each claims its own domains for
+// domainCheckLease, stops checking once the lease has run out and records
+// a check only while its claim holds, so no domain is counted twice. It
+// returns how many were checked; run it periodically.
+func (uc *BusinessUseCase) CheckDueDomains(ctx context.Context) (int, error) {
+	if uc.DomainVerifier == nil {
+		return 0, ErrDomainVerificationUnavailable
+	}
+	now := time.Now()
+	lease := now.Add(domainCheckLease)
+	domains, err := uc.BusinessRepo.ClaimDueDomains(ctx, now, lease, domainCheckBatch)
+	if err != nil {
+		return 0, err
+	}
+	checked := 0
+	for _, d := range domains {
+		if !time.Now().Before(lease) {
+			// The rest are due again and go to whichever instance claims them.
+			break
+		}
+		// The claim stored the lease as the next check, rounded by the
+		// database; that stored value is what proves the claim still holds.
+		claimedUntil := lease
+		if d.NextCheckAt != nil {
+			claimedUntil = *d.NextCheckAt
+		}
+		wasVerified := d.Verified
+		verifyErr := uc.lookForToken(ctx, d, time.Now())
+		checked++
+		recorded, err := uc.BusinessRepo.UpdateClaimedDomainCheck(ctx, d, claimedUntil)
+		switch {
+		case err != nil:
+			slog.Error("Failed to record domain check", slog.Int64("business_id", d.BusinessID), slog.String("domain", d.Domain), slog.Any("error", err))
+		case !recorded:
+			slog.Warn("Domain check outlived its claim, discarded", slog.Int64("business_id", d.BusinessID), slog.String("domain", d.Domain))
+		case verifyErr != nil:
+			slog.Debug("Domain token not found", slog.Int64("business_id", d.BusinessID), slog.String("domain", d.Domain), slog.Any("error", verifyErr))
+		case !wasVerified:
+			slog.Info("Domain verified", slog.Int64("business_id", d.BusinessID), slog.String("domain", d.Domain), slog.String("method", d.VerificationMethod))
+		}
+	}
+	return checked, nil
+}
@@ -2,22 +2,21 @@ package interfaces
 
 import (
 	"context"
+	"time"
 
 	"github.com/Prashant2307200/auth-service/internal/entity"
+	"github.com/Prashant2307200/auth-service/pkg/jwk"
 )
 
 type UserRepo interface {
 	List(ctx context.Context) ([]*entity.User, error)
 	GetById(ctx context.Context, id int64) (*entity.User, error)
 	GetByEmail(ctx context.Context, email string) (*entity.User, error)
-	GetByGoogleID(ctx context.Context, googleID string) (*entity.User, error)
 	UpdateById(ctx context.Context, id int64, user *entity.User) error
 	// UpdatePassword updates only the stored password hash for a user
 	UpdatePassword(ctx context.Context, id int64, hashedPassword string) error
 	// MarkEmailVerified sets email_verified = true and email_verified_at = NOW()
 	MarkEmailVerified(ctx context.Context, id int64) error
-	// LinkGoogleID associates a Google account with the user
-	LinkGoogleID(ctx context.Context, id int64, googleID string) error
 	DeleteById(ctx context.Context, id int64) error
 	Create(ctx context.Context, user *entity.User) (int64, error)
 	Search(ctx context.Context, currentID int64, search string) ([]*entity.User, error)
@@ -35,6 +34,7 @@ type BusinessRepo interface {
 	AddUser(ctx context.Context, businessID int64, userID int64, role int) error
 	AddUserIfNotExists(ctx context.Context, businessID int64, userID int64, role int) error
 	RemoveUser(ctx context.Context, businessID int64, userID int64) error
+	UpdateUserRole(ctx context.Context, businessID int64, userID int64, role int) error
 	GetUsers(ctx context.Context, businessID int64) ([]*entity.User, error)
 	GetUserBusinesses(ctx context.Context, userID int64) ([]*entity.Business, error)
 	GetUserRole(ctx context.Context, businessID int64, userID int64) (int, error)
@@ -49,20 +49,176 @@ type BusinessRepo interface {
 	CreateDomain(ctx context.Context, domain *entity.BusinessDomain) (int64, error)
 	GetDomain(ctx context.Context, businessID int64, domain string) (*entity.BusinessDomain, error)
 	GetDomainByVerificationToken(ctx context.Context, token string) (*entity.BusinessDomain, error)
+	ListDomains(ctx context.Context, businessID int64) ([]*entity.BusinessDomain, error)
+	// ClaimDueDomains returns up to limit domains due for a verification
+	// check at now, leasing them to the caller until leaseUntil.
+	ClaimDueDomains(ctx context.Context, now, leaseUntil time.Time, limit int) ([]*entity.BusinessDomain, error)
 	FindAutoJoinBusinessByEmailDomain(ctx context.Context, emailDomain string) (*entity.Business, error)
-	VerifyDomain(ctx context.Context, domainID int64) error
+	// FindPasswordLoginDisabledBusinessByEmailDomain returns the business
+	// that verified emailDomain and disabled password login for it, or nil.
+	FindPasswordLoginDisabledBusinessByEmailDomain(ctx context.Context, emailDomain string) (*entity.Business, error)
+	// UpdateDomainCheck records a verification check: the verified state,
+	// method, failure count and check times.
+	UpdateDomainCheck(ctx context.Context, domain *entity.BusinessDomain) error
+	// UpdateClaimedDomainCheck records a check made under a claim from
+	// ClaimDueDomains, only while that claim's lease, leaseUntil as stored,
+	// still holds; it reports false once it does not.
+	UpdateClaimedDomainCheck(ctx context.Context, domain *entity.BusinessDomain, leaseUntil time.Time) (bool, error)
 	UpdateDomainAutoJoin(ctx context.Context, domainID int64, businessID int64, enabled bool) error
+
+	GetLoginPolicy(ctx context.Context, businessID int64) (*entity.BusinessLoginPolicy, error)
+	UpdateLoginPolicy(ctx context.Context, policy *entity.BusinessLoginPolicy) error
 }
 
 type TokenService interface {
 	GenerateAccessToken(userID int64, businessID ...int64) (string, error)
-	GenerateRefreshToken(userID int64) (string, error)
-	StoreRefreshToken(ctx context.Context, userID int64, token string) error
-	RemoveRefreshToken(ctx context.Context, userID int64) error
-	VerifyRefreshToken(ctx context.Context, tokenStr string) (string, error)
+	// GenerateAccessTokenForSession issues an access token carrying the ID of
+	// the session it belongs to in its sid claim.
+	GenerateAccessTokenForSession(userID int64, sessionID string, businessID ...int64) (string, error)
+	// GenerateClientAccessToken issues an access token to an OAuth client
+	// acting for the user, limited to scopes. Its aud is the client.
+	GenerateClientAccessToken(userID int64, clientID string, scopes []string) (string, error)
+	// GenerateServiceAccessToken issues an access token to a service client,
+	// acting in its own name on businessID.
+	GenerateServiceAccessToken(clientID string, businessID int64, scopes []string) (string, error)
+	// GenerateIDToken issues an OpenID Connect ID token for clientID with the
+	// given user claims; nonce is echoed when not empty.
+	GenerateIDToken(userID int64, clientID, nonce string, claims map[string]any) (string, error)
+	GenerateRefreshToken(userID int64, sessionID string) (string, error)
+	StoreRefreshToken(ctx context.Context, sessionID string, token string) error
+	// RotateRefreshToken replaces current with next as the session's refresh
+	// token only while current is still stored; it reports false when another
+	// refresh rotated the token first.
+	RotateRefreshToken(ctx context.Context, sessionID, current, next string) (bool, error)
+	RemoveRefreshToken(ctx context.Context, sessionID string) error
+	VerifyRefreshToken(ctx context.Context, tokenStr string) (*RefreshClaims, error)
 	VerifyToken(ctx context.Context, tokenStr string) (int64, error)
-	GetRefreshToken(ctx context.Context, userID int64) (string, error)
+	// VerifyAccessToken verifies an access token, including its revocation
+	// status, and returns its claims.
+	VerifyAccessToken(ctx context.Context, tokenStr string) (*AccessClaims, error)
+	// RevokeAccessToken denies the access token with tokenID until expiresAt.
+	RevokeAccessToken(ctx context.Context, tokenID string, expiresAt time.Time) error
+	// RevokeSessionAccessTokens denies every access token issued to the session.
+	RevokeSessionAccessTokens(ctx context.Context, sessionID string) error
+	GetRefreshToken(ctx context.Context, sessionID string) (string, error)
+	// IsRefreshTokenInFamily reports whether the token with tokenID was ever
+	// issued to the session, i.e. whether a non-current token is a replay.
+	IsRefreshTokenInFamily(ctx context.Context, sessionID, tokenID string) (bool, error)
 	GetPublicKeyPEM() ([]byte, error)
+	// GetJWKS returns every public key currently accepted for access-token verification.
+	GetJWKS() (*jwk.Set, error)
+}
+
+// RefreshClaims identifies the user and session a refresh token was issued to.
+type RefreshClaims struct {
+	UserID    int64
+	SessionID string
+	// TokenID is the jti of this token within the session's token family.
+	TokenID   string
+	ExpiresAt time.Time
+}
+
+// AccessClaims are the identity claims of a verified access token. TokenID
+// and SessionID are empty only for tokens issued before revocation support.
+// ClientID and Scopes are set only for tokens issued to an OAuth client.
+// Tokens of service clients have no user: UserID is 0 and ClientID and
+// BusinessID identify the principal.
+type AccessClaims struct {
+	UserID     int64
+	SessionID  string
+	TokenID    string
+	BusinessID int64
+	ExpiresAt  time.Time
+	ClientID   string
+	Scopes     []string
+}
+
+// IsServiceClient reports whether the token belongs to a service client
+// rather than a user.
+func (c *AccessClaims) IsServiceClient() bool {
+	return c.UserID == 0 && c.ClientID != ""
+}
+
+// SessionService tracks one session per signed-in device.
+type SessionService interface {
+	CreateSession(ctx context.Context, userID int64, deviceInfo, ipAddress, userAgent string) (*entity.UserSession, error)
+	GetSession(ctx context.Context, sessionID string) (*entity.UserSession, error)
+	ListUserSessions(ctx context.Context, userID int64) ([]*entity.UserSession, error)
+	RevokeSession(ctx context.Context, userID int64, sessionID string) error
+	RevokeAllSessions(ctx context.Context, userID int64, exceptSessionID string) error
+	UpdateLastUsed(ctx context.Context, sessionID string) error
+}
+
+// MFAChallengeStore persists pending MFA challenges by token hash.
+type MFAChallengeStore interface {
+	Save(ctx context.Context, tokenHash string, challenge *entity.MFAChallenge, ttl time.Duration) error
+	Get(ctx context.Context, tokenHash string) (*entity.MFAChallenge, error)
+	IncrementAttempts(ctx context.Context, tokenHash string) (int, error)
+	Delete(ctx context.Context, tokenHash string) (bool, error)
+}
+
+// WebAuthnSessionStore holds in-flight WebAuthn ceremonies by challenge.
+type WebAuthnSessionStore interface {
+	Save(ctx context.Context, challenge []byte, session *entity.WebAuthnSession, ttl time.Duration) error
+	// Take returns and removes the session; a challenge is single-use.
+	Take(ctx context.Context, challenge []byte) (*entity.WebAuthnSession, error)
+}
+
+// SAMLRequestStore holds AuthnRequests awaiting their Response by request ID.
+type SAMLRequestStore interface {
+	Save(ctx context.Context, id string, req *entity.SAMLRequest, ttl time.Duration) error
+	// Take returns and removes the request; a Response is accepted once.
+	Take(ctx context.Context, id string) (*entity.SAMLRequest, error)
+}
+
+// OAuthGrantStore holds authorization requests awaiting consent, issued
+// authorization codes and device authorizations. Unknown or expired handles
+// return nil, nil.
+type OAuthGrantStore interface {
+	SaveRequest(ctx context.Context, id string, req *entity.OAuthAuthorizationRequest, ttl time.Duration) error
+	GetRequest(ctx context.Context, id string) (*entity.OAuthAuthorizationRequest, error)
+	// DeleteRequest reports whether this call removed the request.
+	DeleteRequest(ctx context.Context, id string) (bool, error)
+	SaveCode(ctx context.Context, code string, grant *entity.OAuthAuthorizationCode, ttl time.Duration) error
+	// TakeCode returns and removes the grant; a code is single-use.
+	TakeCode(ctx context.Context, code string) (*entity.OAuthAuthorizationCode, error)
+	// SaveDeviceGrant reports false when grant.UserCode is already in use.
+	SaveDeviceGrant(ctx context.Context, deviceCode string, grant *entity.OAuthDeviceGrant, ttl time.Duration) (bool, error)
+	GetDeviceGrant(ctx context.Context, deviceCode string) (*entity.OAuthDeviceGrant, error)
+	GetDeviceGrantByUserCode(ctx context.Context, userCode string) (*entity.OAuthDeviceGrant, error)
+	// DecideDeviceGrant stores the user's decision, keeping the expiry, only
+	// while the grant is still pending; it reports false once the grant has
+	// expired or another decision was stored first.
+	DecideDeviceGrant(ctx context.Context, userCode string, grant *entity.OAuthDeviceGrant) (bool, error)
+	// TakeDeviceGrant returns and removes the grant; an approval is single-use.
+	TakeDeviceGrant(ctx context.Context, deviceCode string) (*entity.OAuthDeviceGrant, error)
+	// AllowDevicePoll reports whether the device's polling interval, initially
+	// interval, has passed since its last poll. Every early poll lengthens the
+	// interval by backoff for the rest of the grant's life.
+	AllowDevicePoll(ctx context.Context, deviceCode string, interval, backoff time.Duration) (bool, error)
+}
+
+// MFAThrottle counts failed second-factor attempts per user and locks the
+// user out, with growing delays, once too many have failed.
+type MFAThrottle interface {
+	// Locked returns how long the user must still wait, or zero.
+	Locked(ctx context.Context, userID int64) (time.Duration, error)
+	// Fail records a failed attempt and returns the lockout it triggered, if any.
+	Fail(ctx context.Context, userID int64) (time.Duration, error)
+	Reset(ctx context.Context, userID int64) error
+}
+
+// IdentityProvider signs users in with an external account through the
+// OAuth 2.0 authorization code flow, e.g. Google or a generic OIDC issuer.
+type IdentityProvider interface {
+	// Name identifies the provider in URLs and in user_identities rows.
+	Name() string
+	// AuthCodeURL returns where to send the user to sign in. state, nonce and
+	// the PKCE verifier must be kept until the callback.
+	AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error)
+	// Exchange redeems the code returned to the callback and returns the
+	// signed-in identity.
+	Exchange(ctx context.Context, code, nonce, verifier string) (*entity.ExternalIdentity, error)
 }
 
 type CloudService interface {
@@ -0,0 +1,95 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Prashant2307200/auth-service/internal/entity"
+	v "github.com/Prashant2307200/auth-service/pkg/validator"
+)
+
+// ErrPasswordLoginDisabled is returned by LoginUser and RegisterUser for
+// emails in a domain whose business only lets its users sign in through
+// other methods.
+var ErrPasswordLoginDisabled = errors.New("password login is disabled for this email domain")
+
+// Login method types returned by DiscoverLoginMethods.
+const (
+	LoginMethodPassword = "password"
+	// LoginMethodSSO is a social identity provider such as Google.
+	LoginMethodSSO = "sso"
+	// LoginMethodSAML is a business's own identity provider.
+	LoginMethodSAML = "saml"
+)
+
+// LoginPolicyFinder finds the business whose login policy applies to an
+// email domain.
+type LoginPolicyFinder interface {
+	FindPasswordLoginDisabledBusinessByEmailDomain(ctx context.Context, emailDomain string) (*entity.Business, error)
+}
+
+// LoginMethod is one way to sign in: Provider names the social identity
+// provider, BusinessID the business whose identity provider signs in.
+type LoginMethod struct {
+	Type       string
+	Provider   string
+	BusinessID int64
+}
+
+// LoginDiscovery lists the ways an email can sign in, the business's
+// identity provider first.
+type LoginDiscovery struct {
+	Domain  string
+	Methods []LoginMethod
+}
+
+func emailDomain(email string) string {
+	_, domain, _ := strings.Cut(email, "@")
+	return strings.ToLower(domain)
+}
+
+func (uc *AuthUseCase) passwordLoginAllowed(ctx context.Context, email string) (bool, error) {
+	if uc.LoginPolicies == nil {
+		return true, nil
+	}
+	biz, err := uc.LoginPolicies.FindPasswordLoginDisabledBusinessByEmailDomain(ctx, emailDomain(email))
+	if err != nil {
+		return false, fmt.Errorf("failed to check login policy: %w", err)
+	}
+	return biz == nil, nil
+}
+
+// DiscoverLoginMethods returns the sign-in methods open to email, for login
+// pages to ask for the email first and then offer only those. The answer
+// depends on the email's domain alone, never on whether an account exists.
+func (uc *AuthUseCase) DiscoverLoginMethods(ctx context.Context, email string) (*LoginDiscovery, error) {
+	if ok, err := v.ValidateEmail(email); !ok {
+		return nil, fmt.Errorf("validation failed: %w", v.ValidationErrors{{Field: "email", Message: err.Error()}})
+	}
+	discovery := &LoginDiscovery{Domain: emailDomain(email)}
+
+	if uc.SAML != nil {
+		businessID, err := uc.SAML.BusinessForEmail(ctx, email)
+		switch {
+		case err == nil:
+			discovery.Methods = append(discovery.Methods, LoginMethod{Type: LoginMethodSAML, BusinessID: businessID})
+		case !errors.Is(err, ErrSAMLNotConfigured):
+			return nil, err
+		}
+	}
+	allowed, err := uc.passwordLoginAllowed(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+	if allowed {
+		discovery.Methods = append(discovery.Methods, LoginMethod{Type: LoginMethodPassword})
+	}
+	if uc.SSO != nil {
+		for _, provider := range uc.SSO.Providers() {
+			discovery.Methods = append(discovery.Methods, LoginMethod{Type: LoginMethodSSO, Provider: provider})
+		}
+	}
+	return discovery, nil
+}
@@ -0,0 +1,97 @@
+package usecase
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Prashant2307200/auth-service/internal/entity"
+	"github.com/Prashant2307200/auth-service/internal/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type stubSSOProviders struct {
+	SSOUsecase
+	names []string
+}
+
+func (s stubSSOProviders) Providers() []string { return s.names }
+
+type stubSAMLDomains struct {
+	SAMLUsecase
+	businesses map[string]int64
+}
+
+func (s stubSAMLDomains) BusinessForEmail(_ context.Context, email string) (int64, error) {
+	if id, ok := s.businesses[emailDomain(email)]; ok {
+		return id, nil
+	}
+	return 0, ErrSAMLNotConfigured
+}
+
+func newDiscoveryTestUseCase(policies *testutil.MockBusinessRepo) *AuthUseCase {
+	uc := NewAuthUseCase(new(testutil.MockUserRepo), nil, new(testutil.MockTokenService), new(testutil.MockCloudService))
+	uc.LoginPolicies = policies
+	uc.SSO = stubSSOProviders{names: []string{"google"}}
+	uc.SAML = stubSAMLDomains{businesses: map[string]int64{"acme.com": 7}}
+	return uc
+}
+
+func TestAuthUseCase_DiscoverLoginMethods(t *testing.T) {
+	t.Run("password and social providers", func(t *testing.T) {
+		policies := new(testutil.MockBusinessRepo)
+		policies.On("FindPasswordLoginDisabledBusinessByEmailDomain", mock.Anything, "example.com").Return(nil, nil)
+
+		discovery, err := newDiscoveryTestUseCase(policies).DiscoverLoginMethods(context.Background(), "ada@Example.com")
+		require.NoError(t, err)
+		assert.Equal(t, "example.com", discovery.Domain)
+		assert.Equal(t, []LoginMethod{
+			{Type: LoginMethodPassword},
+			{Type: LoginMethodSSO, Provider: "google"},
+		}, discovery.Methods)
+	})
+
+	t.Run("business identity provider without passwords", func(t *testing.T) {
+		policies := new(testutil.MockBusinessRepo)
+		policies.On("FindPasswordLoginDisabledBusinessByEmailDomain", mock.Anything, "acme.com").Return(&entity.Business{ID: 7}, nil)
+
+		discovery, err := newDiscoveryTestUseCase(policies).DiscoverLoginMethods(context.Background(), "ada@acme.com")
+		require.NoError(t, err)
+		assert.Equal(t, []LoginMethod{
+			{Type: LoginMethodSAML, BusinessID: 7},
+			{Type: LoginMethodSSO, Provider: "google"},
+		}, discovery.Methods)
+	})
+
+	t.Run("invalid email", func(t *testing.T) {
+		_, err := newDiscoveryTestUseCase(new(testutil.MockBusinessRepo)).DiscoverLoginMethods(context.Background(), "ada")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "validation failed")
+	})
+}
+
+func TestAuthUseCase_LoginUser_PasswordLoginDisabled(t *testing.T) {
+	policies := new(testutil.MockBusinessRepo)
+	policies.On("FindPasswordLoginDisabledBusinessByEmailDomain", mock.Anything, "acme.com").Return(&entity.Business{ID: 7}, nil)
+	uc := newDiscoveryTestUseCase(policies)
+
+	// The account is never looked up, so the mock user repo has no
+	// expectations.
+	_, _, err := uc.LoginUser(context.Background(), "ada@acme.com", "password123")
+	assert.ErrorIs(t, err, ErrPasswordLoginDisabled)
+	policies.AssertExpectations(t)
+}
+
+func TestAuthUseCase_RegisterUser_PasswordLoginDisabled(t *testing.T) {
+	policies := new(testutil.MockBusinessRepo)
+	policies.On("FindPasswordLoginDisabledBusinessByEmailDomain", mock.Anything, "acme.com").Return(&entity.Business{ID: 7}, nil)
+	uc := newDiscoveryTestUseCase(policies)
+
+	// No account is looked up or created, so the mock user repo has no
+	// expectations.
+	user := &entity.User{Username: "ada", Email: "ada@acme.com", Password: "Password123!"}
+	_, _, err := uc.RegisterUser(context.Background(), user, nil)
+	assert.ErrorIs(t, err, ErrPasswordLoginDisabled)
+	policies.AssertExpectations(t)
+}
@@ -9,11 +9,13 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"log/slog"
 	"time"
 
 	"github.com/pquerna/otp"
 	"github.com/pquerna/otp/totp"
 
+	"github.com/Prashant2307200/auth-service/internal/entity"
 	"github.com/Prashant2307200/auth-service/internal/infrastructure/repository"
 	"github.com/Prashant2307200/auth-service/internal/usecase/interfaces"
 )
@@ -26,10 +28,30 @@ var (
 	ErrMFASetupRequired = errors.New("MFA setup required")
 )
 
+// ErrTOTPCodeReused rejects a code whose time-step was already accepted. It
+// wraps ErrInvalidTOTPCode so callers treat it like any other wrong code.
+var ErrTOTPCodeReused = fmt.Errorf("%w: code was already used", ErrInvalidTOTPCode)
+
+var ErrMFALocked = errors.New("too many failed MFA attempts")
+
+// MFALockedError is returned while a user is locked out after repeated wrong
+// codes. RetryAfter is how long they must wait.
+type MFALockedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *MFALockedError) Error() string { return ErrMFALocked.Error() }
+
+func (e *MFALockedError) Unwrap() error { return ErrMFALocked }
+
 const (
 	TOTPIssuer       = "AuthService"
 	BackupCodeCount  = 10
 	BackupCodeLength = 8
+
+	totpPeriod = 30
+	// totpSkew is how many time-steps either side of now are accepted.
+	totpSkew = 1
 )
 
 type MFASetupResult struct {
@@ -44,6 +66,8 @@ type MFAUsecase interface {
 	Disable(ctx context.Context, userID int64, code string) error
 	Verify(ctx context.Context, userID int64, code string) error
 	VerifyBackupCode(ctx context.Context, userID int64, code string) error
+	// VerifyCode accepts either a TOTP or a backup code as one attempt.
+	VerifyCode(ctx context.Context, userID int64, code string) error
 	RegenerateBackupCodes(ctx context.Context, userID int64, code string) ([]string, error)
 	IsEnabled(ctx context.Context, userID int64) (bool, error)
 }
@@ -51,12 +75,16 @@ type MFAUsecase interface {
 type mfaUsecase struct {
 	userRepo interfaces.UserRepo
 	mfaRepo  repository.MFARepository
+	throttle interfaces.MFAThrottle
 }
 
-func NewMFAUsecase(userRepo interfaces.UserRepo, mfaRepo repository.MFARepository) MFAUsecase {
+// NewMFAUsecase returns the MFA usecase. Wrong codes count against throttle;
+// a nil throttle disables lockouts.
+func NewMFAUsecase(userRepo interfaces.UserRepo, mfaRepo repository.MFARepository, throttle interfaces.MFAThrottle) MFAUsecase {
 	return &mfaUsecase{
 		userRepo: userRepo,
 		mfaRepo:  mfaRepo,
+		throttle: throttle,
 	}
 }
 
@@ -69,7 +97,7 @@ func (u *mfaUsecase) Setup(ctx context.Context, userID int64, email string) (*MF
 	key, err := totp.Generate(totp.GenerateOpts{
 		Issuer:      TOTPIssuer,
 		AccountName: email,
-		Period:      30,
+		Period:      totpPeriod,
 		Digits:      otp.DigitsSix,
 		Algorithm:   otp.AlgorithmSHA1,
 	})
@@ -98,8 +126,8 @@ func (u *mfaUsecase) Enable(ctx context.Context, userID int64, code string) ([]s
 		return nil, ErrMFAAlreadyEnabled
 	}
 
-	if !totp.Validate(code, mfa.SecretEncrypted) {
-		return nil, ErrInvalidTOTPCode
+	if err := u.acceptTOTP(ctx, mfa, code); err != nil {
+		return nil, err
 	}
 
 	backupCodes := generateBackupCodes(BackupCodeCount, BackupCodeLength)
@@ -122,10 +150,15 @@ func (u *mfaUsecase) Disable(ctx context.Context, userID int64, code string) err
 		return ErrMFANotEnabled
 	}
 
-	if !totp.Validate(code, mfa.SecretEncrypted) {
-		if !u.verifyBackupCodeInternal(mfa.BackupCodesHash, code) {
-			return ErrInvalidTOTPCode
+	err = u.throttled(ctx, userID, func() error {
+		err := u.acceptTOTP(ctx, mfa, code)
+		if errors.Is(err, ErrInvalidTOTPCode) && u.verifyBackupCodeInternal(mfa.BackupCodesHash, code) {
+			return nil
 		}
+		return err
+	})
+	if err != nil {
+		return err
 	}
 
 	if err := u.mfaRepo.Delete(ctx, userID); err != nil {
@@ -145,13 +178,9 @@ func (u *mfaUsecase) Verify(ctx context.Context, userID int64, code string) erro
 		return ErrMFANotEnabled
 	}
 
-	if !totp.Validate(code, mfa.SecretEncrypted) {
-		return ErrInvalidTOTPCode
-	}
-
-	_ = u.mfaRepo.UpdateLastUsed(ctx, userID)
-
-	return nil
+	return u.throttled(ctx, userID, func() error {
+		return u.acceptTOTP(ctx, mfa, code)
+	})
 }
 
 func (u *mfaUsecase) VerifyBackupCode(ctx context.Context, userID int64, code string) error {
@@ -164,27 +193,34 @@ func (u *mfaUsecase) VerifyBackupCode(ctx context.Context, userID int64, code st
 		return ErrMFANotEnabled
 	}
 
-	codeHash := hashSingleBackupCode(code)
-	foundIdx := -1
-	for i, h := range mfa.BackupCodesHash {
-		if subtle.ConstantTimeCompare([]byte(h), []byte(codeHash)) == 1 {
-			foundIdx = i
-			break
-		}
-	}
+	return u.throttled(ctx, userID, func() error {
+		return u.consumeBackupCode(ctx, mfa, code)
+	})
+}
 
-	if foundIdx == -1 {
-		return ErrInvalidBackupCode
+func (u *mfaUsecase) VerifyCode(ctx context.Context, userID int64, code string) error {
+	mfa, err := u.mfaRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return ErrMFANotEnabled
 	}
 
-	newCodes := append(mfa.BackupCodesHash[:foundIdx], mfa.BackupCodesHash[foundIdx+1:]...)
-	if err := u.mfaRepo.UpdateBackupCodes(ctx, userID, newCodes); err != nil {
-		return fmt.Errorf("failed to update backup codes: %w", err)
+	if !mfa.IsEnabled() {
+		return ErrMFANotEnabled
 	}
 
-	_ = u.mfaRepo.UpdateLastUsed(ctx, userID)
-
-	return nil
+	return u.throttled(ctx, userID, func() error {
+		err := u.acceptTOTP(ctx, mfa, code)
+		if !errors.Is(err, ErrInvalidTOTPCode) {
+			return err
+		}
+		if berr := u.consumeBackupCode(ctx, mfa, code); berr != nil {
+			if errors.Is(berr, ErrInvalidBackupCode) {
+				return err
+			}
+			return berr
+		}
+		return nil
+	})
 }
 
 func (u *mfaUsecase) RegenerateBackupCodes(ctx context.Context, userID int64, code string) ([]string, error) {
@@ -197,8 +233,11 @@ func (u *mfaUsecase) RegenerateBackupCodes(ctx context.Context, userID int64, co
 		return nil, ErrMFANotEnabled
 	}
 
-	if !totp.Validate(code, mfa.SecretEncrypted) {
-		return nil, ErrInvalidTOTPCode
+	err = u.throttled(ctx, userID, func() error {
+		return u.acceptTOTP(ctx, mfa, code)
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	backupCodes := generateBackupCodes(BackupCodeCount, BackupCodeLength)
@@ -222,6 +261,86 @@ func (u *mfaUsecase) IsEnabled(ctx context.Context, userID int64) (bool, error)
 	return mfa.IsEnabled(), nil
 }
 
+// acceptTOTP checks code against the user's secret and claims its time-step,
+// so each code works at most once even inside its validity window.
+func (u *mfaUsecase) acceptTOTP(ctx context.Context, mfa *entity.UserMFA, code string) error {
+	step, ok := matchTOTPStep(mfa.Secret, code, time.Now())
+	if !ok {
+		return ErrInvalidTOTPCode
+	}
+	claimed, err := u.mfaRepo.ClaimTOTPStep(ctx, mfa.UserID, step)
+	if err != nil {
+		return fmt.Errorf("failed to record TOTP use: %w", err)
+	}
+	if !claimed {
+		return ErrTOTPCodeReused
+	}
+	return nil
+}
+
+// consumeBackupCode spends code in a single conditional update, so that
+// concurrent requests presenting the same code cannot both succeed.
+func (u *mfaUsecase) consumeBackupCode(ctx context.Context, mfa *entity.UserMFA, code string) error {
+	claimed, err := u.mfaRepo.ClaimBackupCode(ctx, mfa.UserID, hashSingleBackupCode(code))
+	if err != nil {
+		return fmt.Errorf("failed to update backup codes: %w", err)
+	}
+	if !claimed {
+		return ErrInvalidBackupCode
+	}
+	return nil
+}
+
+// throttled runs check unless the user is locked out. Wrong codes count
+// towards the next lockout and a correct one clears the count.
+func (u *mfaUsecase) throttled(ctx context.Context, userID int64, check func() error) error {
+	if u.throttle == nil {
+		return check()
+	}
+
+	wait, err := u.throttle.Locked(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if wait > 0 {
+		return &MFALockedError{RetryAfter: wait}
+	}
+
+	err = check()
+	switch {
+	case err == nil:
+		if rerr := u.throttle.Reset(ctx, userID); rerr != nil {
+			slog.Warn("Failed to reset MFA failure count", slog.Int64("user_id", userID), slog.Any("error", rerr))
+		}
+	case errors.Is(err, ErrInvalidTOTPCode), errors.Is(err, ErrInvalidBackupCode):
+		wait, ferr := u.throttle.Fail(ctx, userID)
+		if ferr != nil {
+			slog.Error("Failed to record MFA failure", slog.Int64("user_id", userID), slog.Any("error", ferr))
+		} else if wait > 0 {
+			slog.Warn("User locked out of MFA", slog.Int64("user_id", userID), slog.Duration("retry_after", wait))
+			return &MFALockedError{RetryAfter: wait}
+		}
+	}
+	return err
+}
+
+// matchTOTPStep returns the time-step code is valid for, allowing totpSkew
+// steps of clock drift as totp.Validate does.
+func matchTOTPStep(secret, code string, now time.Time) (int64, bool) {
+	opts := totp.ValidateOpts{Period: totpPeriod, Digits: otp.DigitsSix, Algorithm: otp.AlgorithmSHA1}
+	current := now.Unix() / totpPeriod
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		want, err := totp.GenerateCodeCustom(secret, time.Unix(step*totpPeriod, 0), opts)
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(want), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
 func (u *mfaUsecase) verifyBackupCodeInternal(hashedCodes []string, code string) bool {
 	codeHash := hashSingleBackupCode(code)
 	for _, h := range hashedCodes {
@@ -264,8 +383,9 @@ func hashSingleBackupCode(code string) string {
 }
 
 type MFALoginResult struct {
-	MFARequired bool   `json:"mfa_required"`
-	MFAToken    string `json:"mfa_token,omitempty"`
+	MFARequired bool     `json:"mfa_required"`
+	MFAToken    string   `json:"mfa_token,omitempty"`
+	MFAMethods  []string `json:"mfa_methods,omitempty"`
 }
 
 func (u *mfaUsecase) GenerateMFAToken(userID int64, secret string, expiry time.Duration) (string, error) {
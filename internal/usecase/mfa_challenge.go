@@ -0,0 +1,185 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/Prashant2307200/auth-service/internal/entity"
+	"github.com/Prashant2307200/auth-service/internal/usecase/interfaces"
+)
+
+var (
+	ErrMFARequired           = errors.New("MFA verification required")
+	ErrMFAChallengeInvalid   = errors.New("MFA challenge is invalid or expired")
+	ErrMFAChallengeExhausted = errors.New("too many invalid MFA codes, please log in again")
+)
+
+const (
+	MFAChallengeTTL         = 5 * time.Minute
+	MFAChallengeMaxAttempts = 5
+)
+
+// Second factors a challenge can be completed with.
+const (
+	MFAFactorTOTP     = "totp"
+	MFAFactorWebAuthn = "webauthn"
+)
+
+// MFARequiredError is returned by first-factor logins when the account has
+// MFA enabled. Token must be exchanged at POST /auth/mfa/challenge, or at
+// /auth/webauthn/mfa/* when Methods includes a passkey.
+type MFARequiredError struct {
+	Token   string
+	Methods []string
+}
+
+func (e *MFARequiredError) Error() string { return ErrMFARequired.Error() }
+
+func (e *MFARequiredError) Unwrap() error { return ErrMFARequired }
+
+// PasskeyChecker reports whether a user has passkeys that can answer a challenge.
+type PasskeyChecker interface {
+	HasCredentials(ctx context.Context, userID int64) (bool, error)
+}
+
+// MFAGate sits between a successful first factor and token issuance. A nil
+// gate lets every login through, which keeps MFA optional in tests and in
+// deployments without Redis-backed challenges.
+type MFAGate struct {
+	MFA        MFAUsecase
+	Challenges interfaces.MFAChallengeStore
+	// Passkeys, when set, makes a registered passkey count as an enrolled
+	// second factor alongside TOTP.
+	Passkeys PasskeyChecker
+}
+
+func NewMFAGate(mfa MFAUsecase, challenges interfaces.MFAChallengeStore) *MFAGate {
+	return &MFAGate{MFA: mfa, Challenges: challenges}
+}
+
+// Require returns a *MFARequiredError with a fresh challenge token when the
+// user has MFA enabled, and nil when the login may proceed.
+func (g *MFAGate) Require(ctx context.Context, userID int64, method string) error {
+	if g == nil {
+		return nil
+	}
+
+	methods, err := g.factors(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if len(methods) == 0 {
+		return nil
+	}
+
+	token, err := generateSecureToken(32)
+	if err != nil {
+		return fmt.Errorf("failed to generate MFA challenge: %w", err)
+	}
+	challenge := &entity.MFAChallenge{UserID: userID, Method: method}
+	if err := g.Challenges.Save(ctx, hashToken(token), challenge, MFAChallengeTTL); err != nil {
+		return err
+	}
+
+	return &MFARequiredError{Token: token, Methods: methods}
+}
+
+// factors lists the second factors the user has enrolled.
+func (g *MFAGate) factors(ctx context.Context, userID int64) ([]string, error) {
+	var methods []string
+	enabled, err := g.MFA.IsEnabled(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check MFA status: %w", err)
+	}
+	if enabled {
+		methods = append(methods, MFAFactorTOTP)
+	}
+	if g.Passkeys != nil {
+		has, err := g.Passkeys.HasCredentials(ctx, userID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check passkeys: %w", err)
+		}
+		if has {
+			methods = append(methods, MFAFactorWebAuthn)
+		}
+	}
+	return methods, nil
+}
+
+// Peek returns the pending challenge without consuming it, so a passkey
+// assertion can be prepared for its user.
+func (g *MFAGate) Peek(ctx context.Context, token string) (*entity.MFAChallenge, error) {
+	if g == nil || token == "" {
+		return nil, ErrMFAChallengeInvalid
+	}
+	challenge, err := g.Challenges.Get(ctx, hashToken(token))
+	if err != nil || challenge.Attempts >= MFAChallengeMaxAttempts {
+		return nil, ErrMFAChallengeInvalid
+	}
+	return challenge, nil
+}
+
+// Complete checks code against the challenge's user. A correct TOTP or backup
+// code consumes the challenge; wrong codes count towards MFAChallengeMaxAttempts,
+// after which the challenge is discarded and the user must log in again.
+func (g *MFAGate) Complete(ctx context.Context, token, code string) (*entity.MFAChallenge, error) {
+	return g.CompleteWith(ctx, token, func(ctx context.Context, userID int64) error {
+		return g.verifyCode(ctx, userID, code)
+	})
+}
+
+// CompleteWith is Complete with a caller-supplied second-factor check.
+func (g *MFAGate) CompleteWith(ctx context.Context, token string, verify func(ctx context.Context, userID int64) error) (*entity.MFAChallenge, error) {
+	if g == nil || token == "" {
+		return nil, ErrMFAChallengeInvalid
+	}
+	tokenHash := hashToken(token)
+
+	challenge, err := g.Challenges.Get(ctx, tokenHash)
+	if err != nil {
+		return nil, ErrMFAChallengeInvalid
+	}
+	if challenge.Attempts >= MFAChallengeMaxAttempts {
+		_, _ = g.Challenges.Delete(ctx, tokenHash)
+		return nil, ErrMFAChallengeExhausted
+	}
+
+	if err := verify(ctx, challenge.UserID); err != nil {
+		// A locked-out user has not guessed; don't burn the challenge.
+		if errors.Is(err, ErrMFALocked) {
+			return nil, err
+		}
+		attempts, ierr := g.Challenges.IncrementAttempts(ctx, tokenHash)
+		if ierr != nil {
+			slog.Error("Failed to record MFA challenge attempt", slog.Int64("user_id", challenge.UserID), slog.Any("error", ierr))
+		}
+		if attempts >= MFAChallengeMaxAttempts {
+			_, _ = g.Challenges.Delete(ctx, tokenHash)
+			return nil, ErrMFAChallengeExhausted
+		}
+		return nil, err
+	}
+
+	consumed, err := g.Challenges.Delete(ctx, tokenHash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to consume MFA challenge: %w", err)
+	}
+	if !consumed {
+		// Another request completed the same challenge first.
+		return nil, ErrMFAChallengeInvalid
+	}
+
+	return challenge, nil
+}
+
+func (g *MFAGate) verifyCode(ctx context.Context, userID int64, code string) error {
+	err := g.MFA.VerifyCode(ctx, userID, code)
+	// Passkey-only users have no TOTP; their codes are simply wrong.
+	if errors.Is(err, ErrMFANotEnabled) {
+		return ErrInvalidTOTPCode
+	}
+	return err
+}
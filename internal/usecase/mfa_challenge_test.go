@@ -0,0 +1,184 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Prashant2307200/auth-service/internal/entity"
+	"github.com/Prashant2307200/auth-service/internal/testutil"
+	pkghash "github.com/Prashant2307200/auth-service/pkg/hash"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+var errNoChallenge = errors.New("challenge not found")
+
+type memChallengeStore struct {
+	challenges map[string]*entity.MFAChallenge
+}
+
+func newMemChallengeStore() *memChallengeStore {
+	return &memChallengeStore{challenges: make(map[string]*entity.MFAChallenge)}
+}
+
+func (s *memChallengeStore) Save(_ context.Context, tokenHash string, ch *entity.MFAChallenge, _ time.Duration) error {
+	c := *ch
+	s.challenges[tokenHash] = &c
+	return nil
+}
+
+func (s *memChallengeStore) Get(_ context.Context, tokenHash string) (*entity.MFAChallenge, error) {
+	ch, ok := s.challenges[tokenHash]
+	if !ok {
+		return nil, errNoChallenge
+	}
+	c := *ch
+	return &c, nil
+}
+
+func (s *memChallengeStore) IncrementAttempts(_ context.Context, tokenHash string) (int, error) {
+	ch, ok := s.challenges[tokenHash]
+	if !ok {
+		return 0, errNoChallenge
+	}
+	ch.Attempts++
+	return ch.Attempts, nil
+}
+
+func (s *memChallengeStore) Delete(_ context.Context, tokenHash string) (bool, error) {
+	_, ok := s.challenges[tokenHash]
+	delete(s.challenges, tokenHash)
+	return ok, nil
+}
+
+// stubMFA accepts totp as the TOTP code and backup as a backup code.
+type stubMFA struct {
+	MFAUsecase
+	enabled bool
+	totp    string
+	backup  string
+}
+
+func (m *stubMFA) IsEnabled(context.Context, int64) (bool, error) { return m.enabled, nil }
+
+func (m *stubMFA) Verify(_ context.Context, _ int64, code string) error {
+	if code != m.totp {
+		return ErrInvalidTOTPCode
+	}
+	return nil
+}
+
+func (m *stubMFA) VerifyBackupCode(_ context.Context, _ int64, code string) error {
+	if m.backup == "" || code != m.backup {
+		return ErrInvalidBackupCode
+	}
+	m.backup = ""
+	return nil
+}
+
+func (m *stubMFA) VerifyCode(ctx context.Context, userID int64, code string) error {
+	if m.Verify(ctx, userID, code) == nil || m.VerifyBackupCode(ctx, userID, code) == nil {
+		return nil
+	}
+	return ErrInvalidTOTPCode
+}
+
+func TestMFAGate_Require(t *testing.T) {
+	ctx := context.Background()
+
+	var nilGate *MFAGate
+	assert.NoError(t, nilGate.Require(ctx, 1, entity.MFAMethodPassword))
+
+	gate := NewMFAGate(&stubMFA{enabled: false}, newMemChallengeStore())
+	assert.NoError(t, gate.Require(ctx, 1, entity.MFAMethodPassword))
+
+	store := newMemChallengeStore()
+	gate = NewMFAGate(&stubMFA{enabled: true}, store)
+	err := gate.Require(ctx, 1, entity.MFAMethodGoogle)
+	var mfaErr *MFARequiredError
+	require.ErrorAs(t, err, &mfaErr)
+	assert.ErrorIs(t, err, ErrMFARequired)
+	assert.NotEmpty(t, mfaErr.Token)
+
+	stored, ok := store.challenges[hashToken(mfaErr.Token)]
+	require.True(t, ok, "challenge should be stored under the token hash")
+	assert.Equal(t, int64(1), stored.UserID)
+	assert.Equal(t, entity.MFAMethodGoogle, stored.Method)
+}
+
+func TestMFAGate_CompleteIsSingleUse(t *testing.T) {
+	ctx := context.Background()
+	gate := NewMFAGate(&stubMFA{enabled: true, totp: "123456"}, newMemChallengeStore())
+
+	var mfaErr *MFARequiredError
+	require.ErrorAs(t, gate.Require(ctx, 7, entity.MFAMethodPassword), &mfaErr)
+
+	ch, err := gate.Complete(ctx, mfaErr.Token, "123456")
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), ch.UserID)
+
+	_, err = gate.Complete(ctx, mfaErr.Token, "123456")
+	assert.ErrorIs(t, err, ErrMFAChallengeInvalid)
+}
+
+func TestMFAGate_CompleteAcceptsBackupCode(t *testing.T) {
+	ctx := context.Background()
+	gate := NewMFAGate(&stubMFA{enabled: true, totp: "123456", backup: "ABCD-EFGH"}, newMemChallengeStore())
+
+	var mfaErr *MFARequiredError
+	require.ErrorAs(t, gate.Require(ctx, 7, entity.MFAMethodPassword), &mfaErr)
+
+	_, err := gate.Complete(ctx, mfaErr.Token, "ABCD-EFGH")
+	assert.NoError(t, err)
+}
+
+func TestMFAGate_CompleteCapsAttempts(t *testing.T) {
+	ctx := context.Background()
+	store := newMemChallengeStore()
+	gate := NewMFAGate(&stubMFA{enabled: true, totp: "123456"}, store)
+
+	var mfaErr *MFARequiredError
+	require.ErrorAs(t, gate.Require(ctx, 7, entity.MFAMethodPassword), &mfaErr)
+
+	for i := 1; i < MFAChallengeMaxAttempts; i++ {
+		_, err := gate.Complete(ctx, mfaErr.Token, "000000")
+		require.ErrorIs(t, err, ErrInvalidTOTPCode, "attempt %d", i)
+	}
+	_, err := gate.Complete(ctx, mfaErr.Token, "000000")
+	assert.ErrorIs(t, err, ErrMFAChallengeExhausted)
+	assert.Empty(t, store.challenges)
+
+	// The right code no longer helps once the challenge is gone.
+	_, err = gate.Complete(ctx, mfaErr.Token, "123456")
+	assert.ErrorIs(t, err, ErrMFAChallengeInvalid)
+}
+
+func TestAuthUseCase_LoginUser_RequiresMFA(t *testing.T) {
+	userRepo := new(testutil.MockUserRepo)
+	tokenService := new(testutil.MockTokenService)
+
+	user := testutil.CreateTestUser()
+	hashed, _ := pkghash.HashPassword("password123")
+	user.Password = hashed
+	userRepo.On("GetByEmail", mock.Anything, user.Email).Return(user, nil)
+
+	uc := NewAuthUseCase(userRepo, nil, tokenService, new(testutil.MockCloudService))
+	uc.MFAGate = NewMFAGate(&stubMFA{enabled: true, totp: "123456"}, newMemChallengeStore())
+
+	_, _, err := uc.LoginUser(context.Background(), user.Email, "password123")
+	var mfaErr *MFARequiredError
+	require.True(t, errors.As(err, &mfaErr), "expected MFARequiredError, got %v", err)
+	tokenService.AssertNotCalled(t, "GenerateAccessTokenForSession", mock.Anything, mock.Anything)
+
+	tokenService.On("GenerateRefreshToken", user.ID, mock.AnythingOfType("string")).Return("refresh_token", nil)
+	tokenService.On("StoreRefreshToken", mock.Anything, mock.AnythingOfType("string"), "refresh_token").Return(nil)
+	tokenService.On("GenerateAccessTokenForSession", user.ID, mock.AnythingOfType("string")).Return("access_token", nil)
+
+	access, refresh, err := uc.CompleteMFAChallenge(context.Background(), mfaErr.Token, "123456")
+	require.NoError(t, err)
+	assert.Equal(t, "access_token", access)
+	assert.Equal(t, "refresh_token", refresh)
+}
@@ -0,0 +1,177 @@
+package usecase
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/Prashant2307200/auth-service/internal/entity"
+	"github.com/Prashant2307200/auth-service/internal/service"
+	"github.com/pquerna/otp/totp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type memMFARepo struct {
+	rows  map[int64]*entity.UserMFA
+	steps map[int64]int64
+}
+
+func newMemMFARepo() *memMFARepo {
+	return &memMFARepo{rows: map[int64]*entity.UserMFA{}, steps: map[int64]int64{}}
+}
+
+func (r *memMFARepo) Create(_ context.Context, userID int64, secret string) (*entity.UserMFA, error) {
+	m := &entity.UserMFA{UserID: userID, Secret: secret}
+	r.rows[userID] = m
+	delete(r.steps, userID)
+	return m, nil
+}
+
+func (r *memMFARepo) GetByUserID(_ context.Context, userID int64) (*entity.UserMFA, error) {
+	m, ok := r.rows[userID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	cp := *m
+	return &cp, nil
+}
+
+func (r *memMFARepo) Enable(_ context.Context, userID int64, codes []string) error {
+	now := time.Now()
+	r.rows[userID].EnabledAt, r.rows[userID].BackupCodesHash = &now, codes
+	return nil
+}
+
+func (r *memMFARepo) Disable(_ context.Context, userID int64) error {
+	r.rows[userID].EnabledAt = nil
+	return nil
+}
+
+func (r *memMFARepo) UpdateBackupCodes(_ context.Context, userID int64, codes []string) error {
+	r.rows[userID].BackupCodesHash = codes
+	return nil
+}
+
+func (r *memMFARepo) UpdateLastUsed(context.Context, int64) error { return nil }
+
+func (r *memMFARepo) ClaimTOTPStep(_ context.Context, userID int64, step int64) (bool, error) {
+	if last, ok := r.steps[userID]; ok && last >= step {
+		return false, nil
+	}
+	r.steps[userID] = step
+	return true, nil
+}
+
+func (r *memMFARepo) ClaimBackupCode(_ context.Context, userID int64, codeHash string) (bool, error) {
+	m, ok := r.rows[userID]
+	if !ok {
+		return false, nil
+	}
+	for i, h := range m.BackupCodesHash {
+		if h == codeHash {
+			m.BackupCodesHash = append(m.BackupCodesHash[:i:i], m.BackupCodesHash[i+1:]...)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *memMFARepo) Delete(_ context.Context, userID int64) error {
+	delete(r.rows, userID)
+	return nil
+}
+
+func (r *memMFARepo) ReencryptSecrets(context.Context, int64, int) (int, []int64, int64, error) {
+	return 0, nil, 0, nil
+}
+
+// memThrottle applies the default policy without expiry.
+type memThrottle struct {
+	failures map[int64]int
+	locked   map[int64]time.Duration
+}
+
+func newMemThrottle() *memThrottle {
+	return &memThrottle{failures: map[int64]int{}, locked: map[int64]time.Duration{}}
+}
+
+func (t *memThrottle) Locked(_ context.Context, userID int64) (time.Duration, error) {
+	return t.locked[userID], nil
+}
+
+func (t *memThrottle) Fail(_ context.Context, userID int64) (time.Duration, error) {
+	t.failures[userID]++
+	d := service.DefaultMFAThrottlePolicy.Lockout(t.failures[userID])
+	t.locked[userID] = d
+	return d, nil
+}
+
+func (t *memThrottle) Reset(_ context.Context, userID int64) error {
+	delete(t.failures, userID)
+	delete(t.locked, userID)
+	return nil
+}
+
+// enabledMFA enables MFA and returns the secret, the code that enabled it and
+// the backup codes.
+func enabledMFA(t *testing.T, uc MFAUsecase, userID int64) (string, string, []string) {
+	t.Helper()
+	ctx := context.Background()
+	setup, err := uc.Setup(ctx, userID, "user@example.com")
+	require.NoError(t, err)
+	code, err := totp.GenerateCode(setup.Secret, time.Now())
+	require.NoError(t, err)
+	backup, err := uc.Enable(ctx, userID, code)
+	require.NoError(t, err)
+	return setup.Secret, code, backup
+}
+
+func TestMFA_RejectsReplayedTOTPCode(t *testing.T) {
+	ctx := context.Background()
+	uc := NewMFAUsecase(nil, newMemMFARepo(), nil)
+	secret, code, _ := enabledMFA(t, uc, 1)
+
+	// The code used to enable MFA cannot be used again.
+	assert.ErrorIs(t, uc.Verify(ctx, 1, code), ErrTOTPCodeReused)
+	assert.ErrorIs(t, uc.Verify(ctx, 1, code), ErrInvalidTOTPCode, "replays must read as wrong codes")
+
+	next, _ := totp.GenerateCode(secret, time.Now().Add(30*time.Second))
+	require.NoError(t, uc.Verify(ctx, 1, next))
+	assert.ErrorIs(t, uc.Verify(ctx, 1, next), ErrTOTPCodeReused)
+
+	// An older code inside the skew window is also refused once a newer step was used.
+	prev, _ := totp.GenerateCode(secret, time.Now().Add(-30*time.Second))
+	assert.ErrorIs(t, uc.Verify(ctx, 1, prev), ErrInvalidTOTPCode)
+}
+
+func TestMFA_LockoutAfterRepeatedFailures(t *testing.T) {
+	ctx := context.Background()
+	throttle := newMemThrottle()
+	uc := NewMFAUsecase(nil, newMemMFARepo(), throttle)
+	secret, _, backup := enabledMFA(t, uc, 1)
+
+	// Failures count across every endpoint that accepts a code.
+	assert.ErrorIs(t, uc.Verify(ctx, 1, "000000"), ErrInvalidTOTPCode)
+	assert.ErrorIs(t, uc.VerifyBackupCode(ctx, 1, "WRONGONE"), ErrInvalidBackupCode)
+	assert.ErrorIs(t, uc.Disable(ctx, 1, "000000"), ErrInvalidTOTPCode)
+	_, err := uc.RegenerateBackupCodes(ctx, 1, "000000")
+	assert.ErrorIs(t, err, ErrInvalidTOTPCode)
+	assert.ErrorIs(t, uc.VerifyCode(ctx, 1, "000000"), ErrInvalidTOTPCode)
+
+	err = uc.Verify(ctx, 1, "000000")
+	var locked *MFALockedError
+	require.ErrorAs(t, err, &locked)
+	assert.Equal(t, 30*time.Second, locked.RetryAfter)
+
+	// While locked out even a correct code is refused.
+	next, _ := totp.GenerateCode(secret, time.Now().Add(30*time.Second))
+	assert.ErrorIs(t, uc.Verify(ctx, 1, next), ErrMFALocked)
+	assert.ErrorIs(t, uc.VerifyCode(ctx, 1, backup[0]), ErrMFALocked)
+
+	delete(throttle.locked, 1)
+	require.NoError(t, uc.VerifyCode(ctx, 1, backup[0]))
+	assert.Zero(t, throttle.failures[1], "success clears the failure count")
+	assert.ErrorIs(t, uc.VerifyBackupCode(ctx, 1, backup[0]), ErrInvalidBackupCode, "backup codes are single-use")
+}
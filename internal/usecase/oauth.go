@@ -0,0 +1,440 @@
+package usecase
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Prashant2307200/auth-service/internal/entity"
+	"github.com/Prashant2307200/auth-service/internal/infrastructure/repository"
+	"github.com/Prashant2307200/auth-service/internal/usecase/interfaces"
+	"github.com/Prashant2307200/auth-service/internal/utils"
+	pkgdb "github.com/Prashant2307200/auth-service/pkg/db"
+)
+
+var (
+	ErrInvalidClient       = errors.New("invalid client credentials")
+	ErrOAuthClientNotFound = errors.New("oauth client not found")
+	// ErrUnauthorizedClient is returned when a client acts on a token that
+	// was issued to another client.
+	ErrUnauthorizedClient = errors.New("token was not issued to this client")
+)
+
+// Token type hints accepted by introspection and revocation (RFC 7009 §2.1).
+const (
+	TokenTypeHintAccessToken  = "access_token"
+	TokenTypeHintRefreshToken = "refresh_token"
+)
+
+const (
+	oauthClientIDBytes     = 16
+	oauthClientSecretBytes = 32
+	maxOAuthClientName     = 100
+	maxOAuthRedirectURIs   = 10
+	maxOAuthScopes         = 50
+)
+
+// TokenIntrospection is what RFC 7662 introspection reports about a token.
+// Only Active is set for tokens that are expired, revoked or unknown.
+// TenantID is the business an access token is scoped to, if any; ClientID
+// and Scope are set for access tokens issued to an OAuth client.
+type TokenIntrospection struct {
+	Active    bool
+	Subject   string
+	TenantID  int64
+	ClientID  string
+	Scope     string
+	ExpiresAt time.Time
+	SessionID string
+}
+
+// OAuthClientInput describes a client to register.
+type OAuthClientInput struct {
+	Name         string
+	RedirectURIs []string
+	Scopes       []string
+	// Public clients get no secret and must use PKCE with a redirect URI.
+	Public bool
+	// BusinessID makes the client a service client of that business; it
+	// uses the client_credentials grant and has no redirect URIs.
+	BusinessID *int64
+	// FirstParty clients may revoke tokens of the first-party sign-in flow;
+	// they must be confidential and not service clients.
+	FirstParty bool
+}
+
+// OAuthUsecase manages registered OAuth clients and serves the endpoints
+// they call: the authorization code grant with PKCE and the user's consent
+// to it, the device authorization grant, and introspection and revocation of
+// the tokens this service issued.
+type OAuthUsecase interface {
+	// CreateClient registers a client and returns its secret, which is not
+	// stored and cannot be retrieved again. Public clients get no secret.
+	CreateClient(ctx context.Context, adminID int64, in OAuthClientInput) (*entity.OAuthClient, string, error)
+	ListClients(ctx context.Context, adminID int64) ([]*entity.OAuthClient, error)
+	DeleteClient(ctx context.Context, adminID int64, clientID string) error
+	// AuthenticateClient returns the client if secret is its current secret,
+	// or if the client is public and secret is empty, and ErrInvalidClient
+	// otherwise.
+	AuthenticateClient(ctx context.Context, clientID, secret string) (*entity.OAuthClient, error)
+	Introspect(ctx context.Context, token, tokenTypeHint string) (*TokenIntrospection, error)
+	// Revoke invalidates token on behalf of client. Revoking a refresh token
+	// ends its session, including the access tokens issued to it. Unknown or
+	// already invalid tokens are not an error; tokens issued to another
+	// client are, and so are first-party tokens sent by any but a
+	// first-party client.
+	Revoke(ctx context.Context, client *entity.OAuthClient, token, tokenTypeHint string) error
+
+	// Authorize handles an authorization request by userID, who is 0 when
+	// nobody is signed in. Requests that cannot be answered with a redirect
+	// to the client fail with an *OAuthError.
+	Authorize(ctx context.Context, req AuthorizationRequest, userID int64) (*AuthorizationResult, error)
+	// GetConsentRequest returns the pending request the user is asked to
+	// approve, or ErrConsentRequestNotFound.
+	GetConsentRequest(ctx context.Context, userID int64, requestID string) (*ConsentRequest, error)
+	// DecideConsent approves or denies a pending request and returns where to
+	// send the user back to the client. Each request is decided once.
+	DecideConsent(ctx context.Context, userID int64, requestID string, approve bool) (string, error)
+	// ExchangeAuthorizationCode redeems a code for an access token. Failures
+	// the client caused are *OAuthError.
+	ExchangeAuthorizationCode(ctx context.Context, client *entity.OAuthClient, code, redirectURI, codeVerifier string) (*OAuthTokenResponse, error)
+	// ClientCredentials issues a service client an access token for its own
+	// business, limited to scope, or to all its scopes when scope is empty.
+	// Failures the client caused are *OAuthError.
+	ClientCredentials(ctx context.Context, client *entity.OAuthClient, scope string) (*OAuthTokenResponse, error)
+	// StartDeviceAuthorization issues a device code and the user code the
+	// user enters to approve it. Failures the client caused are *OAuthError.
+	StartDeviceAuthorization(ctx context.Context, client *entity.OAuthClient, scope string) (*DeviceAuthorization, error)
+	// GetDeviceRequest returns the pending device authorization a user code
+	// stands for, or ErrUserCodeNotFound.
+	GetDeviceRequest(ctx context.Context, userCode string) (*ConsentRequest, error)
+	// DecideDevice approves or denies a pending device authorization as the
+	// user. Each authorization is decided once.
+	DecideDevice(ctx context.Context, userID int64, userCode string, approve bool) error
+	// ExchangeDeviceCode answers a device polling for its tokens. Until the
+	// user has approved, and when it polls too often, it fails with an
+	// *OAuthError, as do other failures the client caused.
+	ExchangeDeviceCode(ctx context.Context, client *entity.OAuthClient, deviceCode string) (*OAuthTokenResponse, error)
+	ListConsents(ctx context.Context, userID int64) ([]*entity.OAuthConsent, error)
+	// UserInfo returns the OpenID Connect claims about the user of an access
+	// token issued with the openid scope, or ErrInvalidAccessToken or
+	// ErrInsufficientScope.
+	UserInfo(ctx context.Context, accessToken string) (map[string]any, error)
+	// RevokeConsent withdraws the user's consent for the client, so its next
+	// authorization request asks again. Tokens already issued run until they
+	// expire.
+	RevokeConsent(ctx context.Context, userID int64, clientID string) error
+}
+
+type oauthUsecase struct {
+	clients    repository.OAuthClientRepository
+	consents   repository.OAuthConsentRepository
+	grants     interfaces.OAuthGrantStore
+	userRepo   interfaces.UserRepo
+	businesses interfaces.BusinessRepo
+	tokens     interfaces.TokenService
+	sessions   interfaces.SessionService
+}
+
+func NewOAuthUsecase(clients repository.OAuthClientRepository, consents repository.OAuthConsentRepository, grants interfaces.OAuthGrantStore, userRepo interfaces.UserRepo, businesses interfaces.BusinessRepo, tokens interfaces.TokenService, sessions interfaces.SessionService) OAuthUsecase {
+	return &oauthUsecase{clients: clients, consents: consents, grants: grants, userRepo: userRepo, businesses: businesses, tokens: tokens, sessions: sessions}
+}
+
+func (u *oauthUsecase) requireAdmin(ctx context.Context, userID int64) error {
+	user, err := u.userRepo.GetById(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user.Role != entity.RoleAdmin {
+		return utils.ErrForbidden
+	}
+	return nil
+}
+
+func (u *oauthUsecase) CreateClient(ctx context.Context, adminID int64, in OAuthClientInput) (*entity.OAuthClient, string, error) {
+	if err := u.requireAdmin(ctx, adminID); err != nil {
+		return nil, "", err
+	}
+	name := strings.TrimSpace(in.Name)
+	if name == "" || len(name) > maxOAuthClientName {
+		return nil, "", utils.NewValidationError("name", fmt.Sprintf("must be 1 to %d characters", maxOAuthClientName))
+	}
+	if len(in.RedirectURIs) > maxOAuthRedirectURIs {
+		return nil, "", utils.NewValidationError("redirect_uris", fmt.Sprintf("at most %d are allowed", maxOAuthRedirectURIs))
+	}
+	if in.Public && len(in.RedirectURIs) == 0 {
+		return nil, "", utils.NewValidationError("redirect_uris", "public clients need at least one")
+	}
+	if in.BusinessID != nil {
+		if err := u.validateServiceClient(ctx, in); err != nil {
+			return nil, "", err
+		}
+	}
+	if in.FirstParty && (in.Public || in.BusinessID != nil) {
+		return nil, "", utils.NewValidationError("first_party", "first-party clients must be confidential and not service clients")
+	}
+	for _, uri := range in.RedirectURIs {
+		if err := validateRedirectURI(uri); err != nil {
+			return nil, "", err
+		}
+	}
+	scopes, err := normalizeScopes(in.Scopes)
+	if err != nil {
+		return nil, "", err
+	}
+
+	clientID, err := generateSecureToken(oauthClientIDBytes)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to generate client id: %w", err)
+	}
+	client := &entity.OAuthClient{
+		ClientID:     clientID,
+		Name:         name,
+		Public:       in.Public,
+		RedirectURIs: slices.Clone(in.RedirectURIs),
+		Scopes:       scopes,
+		BusinessID:   in.BusinessID,
+		FirstParty:   in.FirstParty,
+	}
+	if client.RedirectURIs == nil {
+		client.RedirectURIs = []string{}
+	}
+
+	var secret string
+	if !in.Public {
+		secret, err = generateSecureToken(oauthClientSecretBytes)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to generate client secret: %w", err)
+		}
+		client.SecretHash = hashToken(secret)
+	}
+
+	if err := u.clients.Create(ctx, client); err != nil {
+		return nil, "", fmt.Errorf("failed to create oauth client: %w", err)
+	}
+	return client, secret, nil
+}
+
+func (u *oauthUsecase) validateServiceClient(ctx context.Context, in OAuthClientInput) error {
+	if in.Public {
+		return utils.NewValidationError("public", "service clients must be confidential")
+	}
+	if len(in.RedirectURIs) > 0 {
+		return utils.NewValidationError("redirect_uris", "service clients do not sign users in")
+	}
+	_, err := u.businesses.GetById(ctx, *in.BusinessID)
+	if errors.Is(err, pkgdb.ErrNotFound) || errors.Is(err, sql.ErrNoRows) {
+		return utils.NewValidationError("business_id", "business does not exist")
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load business: %w", err)
+	}
+	return nil
+}
+
+func (u *oauthUsecase) ListClients(ctx context.Context, adminID int64) ([]*entity.OAuthClient, error) {
+	if err := u.requireAdmin(ctx, adminID); err != nil {
+		return nil, err
+	}
+	return u.clients.List(ctx)
+}
+
+func (u *oauthUsecase) DeleteClient(ctx context.Context, adminID int64, clientID string) error {
+	if err := u.requireAdmin(ctx, adminID); err != nil {
+		return err
+	}
+	err := u.clients.Delete(ctx, clientID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrOAuthClientNotFound
+	}
+	return err
+}
+
+func (u *oauthUsecase) AuthenticateClient(ctx context.Context, clientID, secret string) (*entity.OAuthClient, error) {
+	if clientID == "" {
+		return nil, ErrInvalidClient
+	}
+	client, err := u.clients.GetByClientID(ctx, clientID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvalidClient
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load oauth client: %w", err)
+	}
+	if client.Public {
+		// A public client cannot keep a secret; one that sends one is misconfigured.
+		if secret != "" {
+			return nil, ErrInvalidClient
+		}
+		return client, nil
+	}
+	if secret == "" || subtle.ConstantTimeCompare([]byte(hashToken(secret)), []byte(client.SecretHash)) != 1 {
+		return nil, ErrInvalidClient
+	}
+	return client, nil
+}
+
+func (u *oauthUsecase) Introspect(ctx context.Context, token, tokenTypeHint string) (*TokenIntrospection, error) {
+	if tokenTypeHint == TokenTypeHintRefreshToken {
+		if info, err := u.introspectRefreshToken(ctx, token); info != nil || err != nil {
+			return info, err
+		}
+		return u.orInactive(u.introspectAccessToken(ctx, token))
+	}
+	if info, err := u.introspectAccessToken(ctx, token); info != nil || err != nil {
+		return info, err
+	}
+	return u.orInactive(u.introspectRefreshToken(ctx, token))
+}
+
+func (u *oauthUsecase) orInactive(info *TokenIntrospection, err error) (*TokenIntrospection, error) {
+	if info == nil && err == nil {
+		return &TokenIntrospection{Active: false}, nil
+	}
+	return info, err
+}
+
+// introspectAccessToken returns nil, nil when token is not a valid access token.
+func (u *oauthUsecase) introspectAccessToken(ctx context.Context, token string) (*TokenIntrospection, error) {
+	claims, err := u.tokens.VerifyAccessToken(ctx, token)
+	if err != nil {
+		return nil, nil
+	}
+	if claims.IsServiceClient() {
+		return u.describeServiceClient(ctx, claims)
+	}
+	info, err := u.describe(ctx, claims.UserID, claims.BusinessID, claims.SessionID, claims.ExpiresAt)
+	if info != nil && info.Active {
+		info.ClientID = claims.ClientID
+		info.Scope = strings.Join(claims.Scopes, " ")
+	}
+	return info, err
+}
+
+// introspectRefreshToken returns nil, nil unless token is the current refresh
+// token of its session.
+func (u *oauthUsecase) introspectRefreshToken(ctx context.Context, token string) (*TokenIntrospection, error) {
+	claims, ok := u.currentRefreshToken(ctx, token)
+	if !ok {
+		return nil, nil
+	}
+	return u.describe(ctx, claims.UserID, 0, claims.SessionID, claims.ExpiresAt)
+}
+
+func (u *oauthUsecase) currentRefreshToken(ctx context.Context, token string) (*interfaces.RefreshClaims, bool) {
+	claims, err := u.tokens.VerifyRefreshToken(ctx, token)
+	if err != nil {
+		return nil, false
+	}
+	stored, err := u.tokens.GetRefreshToken(ctx, claims.SessionID)
+	if err != nil || subtle.ConstantTimeCompare([]byte(stored), []byte(token)) != 1 {
+		return nil, false
+	}
+	return claims, true
+}
+
+// describe reports a token of a user that still exists as active.
+func (u *oauthUsecase) describe(ctx context.Context, userID, tenantID int64, sessionID string, expiresAt time.Time) (*TokenIntrospection, error) {
+	user, err := u.userRepo.GetById(ctx, userID)
+	if errors.Is(err, pkgdb.ErrNotFound) || errors.Is(err, sql.ErrNoRows) {
+		return &TokenIntrospection{Active: false}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load token subject: %w", err)
+	}
+	return &TokenIntrospection{
+		Active:    true,
+		Subject:   strconv.FormatInt(user.ID, 10),
+		TenantID:  tenantID,
+		ExpiresAt: expiresAt,
+		SessionID: sessionID,
+	}, nil
+}
+
+// describeServiceClient reports a service client token as active while the
+// client is still registered.
+func (u *oauthUsecase) describeServiceClient(ctx context.Context, claims *interfaces.AccessClaims) (*TokenIntrospection, error) {
+	_, err := u.clients.GetByClientID(ctx, claims.ClientID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return &TokenIntrospection{Active: false}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load oauth client: %w", err)
+	}
+	return &TokenIntrospection{
+		Active:    true,
+		Subject:   claims.ClientID,
+		TenantID:  claims.BusinessID,
+		ClientID:  claims.ClientID,
+		Scope:     strings.Join(claims.Scopes, " "),
+		ExpiresAt: claims.ExpiresAt,
+		SessionID: claims.SessionID,
+	}, nil
+}
+
+func (u *oauthUsecase) Revoke(ctx context.Context, client *entity.OAuthClient, token, tokenTypeHint string) error {
+	if tokenTypeHint == TokenTypeHintRefreshToken {
+		if done, err := u.revokeRefreshToken(ctx, client, token); done || err != nil {
+			return err
+		}
+		_, err := u.revokeAccessToken(ctx, client, token)
+		return err
+	}
+	if done, err := u.revokeAccessToken(ctx, client, token); done || err != nil {
+		return err
+	}
+	_, err := u.revokeRefreshToken(ctx, client, token)
+	return err
+}
+
+// mayRevoke reports whether client may revoke a token issued to
+// tokenClientID, where "" means the first-party sign-in flow. As RFC 7009
+// section 2.1 asks, a client may only revoke its own tokens; those of the
+// sign-in flow belong to the first-party clients.
+func mayRevoke(client *entity.OAuthClient, tokenClientID string) bool {
+	if tokenClientID == "" {
+		return client.FirstParty
+	}
+	return tokenClientID == client.ClientID
+}
+
+func (u *oauthUsecase) revokeAccessToken(ctx context.Context, client *entity.OAuthClient, token string) (bool, error) {
+	claims, err := u.tokens.VerifyAccessToken(ctx, token)
+	if err != nil {
+		return false, nil
+	}
+	if !mayRevoke(client, claims.ClientID) {
+		return true, ErrUnauthorizedClient
+	}
+	if err := u.tokens.RevokeAccessToken(ctx, claims.TokenID, claims.ExpiresAt); err != nil {
+		return true, fmt.Errorf("failed to revoke access token: %w", err)
+	}
+	return true, nil
+}
+
+func (u *oauthUsecase) revokeRefreshToken(ctx context.Context, client *entity.OAuthClient, token string) (bool, error) {
+	claims, ok := u.currentRefreshToken(ctx, token)
+	if !ok {
+		return false, nil
+	}
+	// Refresh tokens only come from the first-party sign-in flow.
+	if !mayRevoke(client, "") {
+		return true, ErrUnauthorizedClient
+	}
+	if err := endSessionTokens(ctx, u.tokens, claims.SessionID); err != nil {
+		return true, err
+	}
+	if u.sessions != nil {
+		if err := u.sessions.RevokeSession(ctx, claims.UserID, claims.SessionID); err != nil {
+			slog.Warn("Failed to revoke session of revoked refresh token", slog.String("session_id", claims.SessionID), slog.Any("error", err))
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,432 @@
+package usecase
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Prashant2307200/auth-service/internal/entity"
+	"github.com/Prashant2307200/auth-service/internal/utils"
+	pkgdb "github.com/Prashant2307200/auth-service/pkg/db"
+)
+
+var (
+	ErrConsentRequestNotFound = errors.New("consent request not found or expired")
+	ErrOAuthConsentNotFound   = errors.New("oauth consent not found")
+)
+
+const (
+	oauthRequestTTL = 10 * time.Minute
+	// Codes are redeemed by the client right after the redirect.
+	oauthCodeTTL   = time.Minute
+	oauthCodeBytes = 32
+	// oauthAccessTokenLifetime matches the access token TTL of the token service.
+	oauthAccessTokenLifetime = 15 * time.Minute
+
+	codeChallengeMethodS256 = "S256"
+	minPKCELength           = 43
+	maxPKCELength           = 128
+	maxNonceLength          = 255
+)
+
+// OAuthError is an error defined by RFC 6749, reported to the client as its
+// error code and description.
+type OAuthError struct {
+	Code        string
+	Description string
+}
+
+func (e *OAuthError) Error() string {
+	return e.Code + ": " + e.Description
+}
+
+// AuthorizationRequest holds the parameters of a request to /oauth/authorize.
+type AuthorizationRequest struct {
+	ResponseType        string
+	ClientID            string
+	RedirectURI         string
+	Scope               string
+	State               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+	// Nonce is the OpenID Connect nonce, returned in the ID token.
+	Nonce string
+}
+
+// AuthorizationResult says how to continue an authorization request. Exactly
+// one field is set.
+type AuthorizationResult struct {
+	// RedirectURL sends the user back to the client with a code or an error.
+	RedirectURL string
+	// LoginRequired means the user must sign in and repeat the request.
+	LoginRequired bool
+	// ConsentRequestID identifies the request waiting for the user's consent.
+	ConsentRequestID string
+}
+
+// ConsentRequest is what the consent screen shows the user.
+type ConsentRequest struct {
+	ClientID    string
+	ClientName  string
+	RedirectURI string
+	Scopes      []string
+}
+
+// OAuthTokenResponse is a successful token endpoint response. Clients get no
+// refresh token; they repeat the authorization request, which skips the
+// consent screen once the user has consented. IDToken is set when the
+// openid scope was granted.
+type OAuthTokenResponse struct {
+	AccessToken string
+	TokenType   string
+	ExpiresIn   int64
+	Scope       string
+	IDToken     string
+}
+
+func (u *oauthUsecase) Authorize(ctx context.Context, req AuthorizationRequest, userID int64) (*AuthorizationResult, error) {
+	client, err := u.clients.GetByClientID(ctx, req.ClientID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, &OAuthError{Code: "invalid_request", Description: "unknown client_id"}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load oauth client: %w", err)
+	}
+
+	// Until the redirect URI is known to belong to the client, errors are
+	// shown to the user instead of being sent to it.
+	redirectURI := req.RedirectURI
+	if redirectURI == "" {
+		if len(client.RedirectURIs) != 1 {
+			return nil, &OAuthError{Code: "invalid_request", Description: "redirect_uri is required"}
+		}
+		redirectURI = client.RedirectURIs[0]
+	} else if !client.HasRedirectURI(redirectURI) {
+		return nil, &OAuthError{Code: "invalid_request", Description: "redirect_uri is not registered for this client"}
+	}
+
+	if req.ResponseType != "code" {
+		return redirectError(redirectURI, req.State, "unsupported_response_type", "only response_type=code is supported"), nil
+	}
+	if req.CodeChallengeMethod != codeChallengeMethodS256 || !validPKCEValue(req.CodeChallenge) {
+		return redirectError(redirectURI, req.State, "invalid_request", "PKCE with code_challenge_method=S256 is required"), nil
+	}
+	scopes, err := normalizeScopes(strings.Fields(req.Scope))
+	if err != nil || !client.AllowsScopes(scopes) {
+		return redirectError(redirectURI, req.State, "invalid_scope", "scope is not allowed for this client"), nil
+	}
+	if len(req.Nonce) > maxNonceLength {
+		return redirectError(redirectURI, req.State, "invalid_request", "nonce is too long"), nil
+	}
+
+	if userID == 0 {
+		return &AuthorizationResult{LoginRequired: true}, nil
+	}
+
+	pending := &entity.OAuthAuthorizationRequest{
+		ClientID:         client.ClientID,
+		UserID:           userID,
+		RedirectURI:      redirectURI,
+		RedirectURIParam: req.RedirectURI,
+		Scopes:           scopes,
+		State:            req.State,
+		CodeChallenge:    req.CodeChallenge,
+		Nonce:            req.Nonce,
+	}
+
+	consent, err := u.consents.Get(ctx, userID, client.ClientID)
+	switch {
+	case err == nil:
+		if consentCovers(consent, scopes) {
+			redirectURL, err := u.issueCode(ctx, pending)
+			if err != nil {
+				return nil, err
+			}
+			return &AuthorizationResult{RedirectURL: redirectURL}, nil
+		}
+	case !errors.Is(err, sql.ErrNoRows):
+		return nil, fmt.Errorf("failed to load oauth consent: %w", err)
+	}
+
+	requestID, err := generateSecureToken(oauthCodeBytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate consent request id: %w", err)
+	}
+	if err := u.grants.SaveRequest(ctx, requestID, pending, oauthRequestTTL); err != nil {
+		return nil, err
+	}
+	return &AuthorizationResult{ConsentRequestID: requestID}, nil
+}
+
+func consentCovers(consent *entity.OAuthConsent, scopes []string) bool {
+	for _, s := range scopes {
+		if !slices.Contains(consent.Scopes, s) {
+			return false
+		}
+	}
+	return true
+}
+
+// pendingRequest returns the user's pending request, or ErrConsentRequestNotFound.
+func (u *oauthUsecase) pendingRequest(ctx context.Context, userID int64, requestID string) (*entity.OAuthAuthorizationRequest, error) {
+	if requestID == "" {
+		return nil, ErrConsentRequestNotFound
+	}
+	req, err := u.grants.GetRequest(ctx, requestID)
+	if err != nil {
+		return nil, err
+	}
+	if req == nil || req.UserID != userID {
+		return nil, ErrConsentRequestNotFound
+	}
+	return req, nil
+}
+
+func (u *oauthUsecase) GetConsentRequest(ctx context.Context, userID int64, requestID string) (*ConsentRequest, error) {
+	req, err := u.pendingRequest(ctx, userID, requestID)
+	if err != nil {
+		return nil, err
+	}
+	client, err := u.clients.GetByClientID(ctx, req.ClientID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrConsentRequestNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load oauth client: %w", err)
+	}
+	return &ConsentRequest{
+		ClientID:    client.ClientID,
+		ClientName:  client.Name,
+		RedirectURI: req.RedirectURI,
+		Scopes:      req.Scopes,
+	}, nil
+}
+
+func (u *oauthUsecase) DecideConsent(ctx context.Context, userID int64, requestID string, approve bool) (string, error) {
+	req, err := u.pendingRequest(ctx, userID, requestID)
+	if err != nil {
+		return "", err
+	}
+	deleted, err := u.grants.DeleteRequest(ctx, requestID)
+	if err != nil {
+		return "", err
+	}
+	if !deleted {
+		// Another decision on the same request got there first.
+		return "", ErrConsentRequestNotFound
+	}
+
+	if !approve {
+		return redirectError(req.RedirectURI, req.State, "access_denied", "the user denied the request").RedirectURL, nil
+	}
+	if err := u.consents.Grant(ctx, userID, req.ClientID, req.Scopes); err != nil {
+		return "", fmt.Errorf("failed to record oauth consent: %w", err)
+	}
+	return u.issueCode(ctx, req)
+}
+
+// issueCode stores an authorization code for req and returns the redirect
+// that delivers it to the client.
+func (u *oauthUsecase) issueCode(ctx context.Context, req *entity.OAuthAuthorizationRequest) (string, error) {
+	code, err := generateSecureToken(oauthCodeBytes)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate authorization code: %w", err)
+	}
+	grant := &entity.OAuthAuthorizationCode{
+		ClientID:         req.ClientID,
+		UserID:           req.UserID,
+		RedirectURIParam: req.RedirectURIParam,
+		Scopes:           req.Scopes,
+		CodeChallenge:    req.CodeChallenge,
+		Nonce:            req.Nonce,
+		AuthTime:         time.Now(),
+	}
+	if err := u.grants.SaveCode(ctx, code, grant, oauthCodeTTL); err != nil {
+		return "", err
+	}
+	return redirectWith(req.RedirectURI, url.Values{"code": {code}}, req.State), nil
+}
+
+func (u *oauthUsecase) ExchangeAuthorizationCode(ctx context.Context, client *entity.OAuthClient, code, redirectURI, codeVerifier string) (*OAuthTokenResponse, error) {
+	if code == "" {
+		return nil, &OAuthError{Code: "invalid_request", Description: "code is required"}
+	}
+	grant, err := u.grants.TakeCode(ctx, code)
+	if err != nil {
+		return nil, err
+	}
+	if grant == nil || grant.ClientID != client.ClientID {
+		return nil, &OAuthError{Code: "invalid_grant", Description: "authorization code is invalid or expired"}
+	}
+	if grant.RedirectURIParam != redirectURI {
+		return nil, &OAuthError{Code: "invalid_grant", Description: "redirect_uri does not match the authorization request"}
+	}
+	if !verifyPKCE(codeVerifier, grant.CodeChallenge) {
+		return nil, &OAuthError{Code: "invalid_grant", Description: "code_verifier does not match the code challenge"}
+	}
+
+	return u.issueUserTokens(ctx, client, grant.UserID, grant.Scopes, grant.Nonce, "authorization code is invalid or expired")
+}
+
+// issueUserTokens issues the tokens of a grant the user approved, with an ID
+// token when the openid scope was granted. If the user no longer exists the
+// grant fails as invalid_grant with the given description.
+func (u *oauthUsecase) issueUserTokens(ctx context.Context, client *entity.OAuthClient, userID int64, scopes []string, nonce, invalidGrant string) (*OAuthTokenResponse, error) {
+	user, err := u.userRepo.GetById(ctx, userID)
+	if errors.Is(err, pkgdb.ErrNotFound) || errors.Is(err, sql.ErrNoRows) {
+		return nil, &OAuthError{Code: "invalid_grant", Description: invalidGrant}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load user: %w", err)
+	}
+
+	accessToken, err := u.tokens.GenerateClientAccessToken(userID, client.ClientID, scopes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate access token: %w", err)
+	}
+	resp := &OAuthTokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(oauthAccessTokenLifetime.Seconds()),
+		Scope:       strings.Join(scopes, " "),
+	}
+	if slices.Contains(scopes, ScopeOpenID) {
+		resp.IDToken, err = u.tokens.GenerateIDToken(user.ID, client.ClientID, nonce, userClaims(user, scopes))
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate id token: %w", err)
+		}
+	}
+	return resp, nil
+}
+
+func (u *oauthUsecase) ListConsents(ctx context.Context, userID int64) ([]*entity.OAuthConsent, error) {
+	return u.consents.ListByUser(ctx, userID)
+}
+
+func (u *oauthUsecase) RevokeConsent(ctx context.Context, userID int64, clientID string) error {
+	err := u.consents.Revoke(ctx, userID, clientID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrOAuthConsentNotFound
+	}
+	return err
+}
+
+func redirectError(redirectURI, state, code, description string) *AuthorizationResult {
+	params := url.Values{"error": {code}, "error_description": {description}}
+	return &AuthorizationResult{RedirectURL: redirectWith(redirectURI, params, state)}
+}
+
+// redirectWith adds params and state to the query of a registered redirect
+// URI, keeping any query it already has.
+func redirectWith(redirectURI string, params url.Values, state string) string {
+	u, err := url.Parse(redirectURI)
+	if err != nil {
+		// Registered URIs were validated when the client was created.
+		return redirectURI
+	}
+	q := u.Query()
+	for k, v := range params {
+		q[k] = v
+	}
+	if state != "" {
+		q.Set("state", state)
+	}
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// validateRedirectURI accepts https URIs, http URIs on the loopback interface
+// for native apps, and private-use schemes such as com.example.app:/cb
+// (RFC 8252 §7). Fragments are never allowed.
+func validateRedirectURI(uri string) error {
+	u, err := url.Parse(uri)
+	if err != nil || !u.IsAbs() {
+		return utils.NewValidationError("redirect_uris", fmt.Sprintf("%q is not an absolute URI", uri))
+	}
+	if u.Fragment != "" || strings.Contains(uri, "#") {
+		return utils.NewValidationError("redirect_uris", fmt.Sprintf("%q must not have a fragment", uri))
+	}
+	switch u.Scheme {
+	case "https":
+		if u.Host == "" {
+			return utils.NewValidationError("redirect_uris", fmt.Sprintf("%q has no host", uri))
+		}
+	case "http":
+		switch u.Hostname() {
+		case "localhost", "127.0.0.1", "::1":
+		default:
+			return utils.NewValidationError("redirect_uris", fmt.Sprintf("%q must use https", uri))
+		}
+	default:
+		if !strings.Contains(u.Scheme, ".") {
+			return utils.NewValidationError("redirect_uris", fmt.Sprintf("%q must use https or a reverse-domain scheme", uri))
+		}
+	}
+	return nil
+}
+
+// normalizeScopes checks each scope is a valid scope-token (RFC 6749 §3.3)
+// and drops duplicates, keeping the first occurrence.
+func normalizeScopes(scopes []string) ([]string, error) {
+	if len(scopes) > maxOAuthScopes {
+		return nil, utils.NewValidationError("scopes", fmt.Sprintf("at most %d are allowed", maxOAuthScopes))
+	}
+	out := make([]string, 0, len(scopes))
+	for _, s := range scopes {
+		if !validScopeToken(s) {
+			return nil, utils.NewValidationError("scopes", fmt.Sprintf("%q is not a valid scope", s))
+		}
+		if !slices.Contains(out, s) {
+			out = append(out, s)
+		}
+	}
+	return out, nil
+}
+
+func validScopeToken(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c < 0x21 || c > 0x7e || c == '"' || c == '\\' {
+			return false
+		}
+	}
+	return true
+}
+
+// validPKCEValue reports whether s is 43 to 128 unreserved characters, the
+// form of both code verifiers and S256 code challenges (RFC 7636 §4.1).
+func validPKCEValue(s string) bool {
+	if len(s) < minPKCELength || len(s) > maxPKCELength {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9':
+		case c == '-', c == '.', c == '_', c == '~':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func verifyPKCE(verifier, challenge string) bool {
+	if !validPKCEValue(verifier) {
+		return false
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	computed := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(challenge)) == 1
+}
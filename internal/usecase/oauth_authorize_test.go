@@ -0,0 +1,422 @@
+package usecase
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Prashant2307200/auth-service/internal/entity"
+	"github.com/Prashant2307200/auth-service/internal/testutil"
+	"github.com/Prashant2307200/auth-service/internal/usecase/interfaces"
+	"github.com/Prashant2307200/auth-service/internal/utils"
+	pkgdb "github.com/Prashant2307200/auth-service/pkg/db"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type memOAuthConsentRepo struct {
+	consents map[string]*entity.OAuthConsent
+}
+
+func consentKey(userID int64, clientID string) string {
+	return fmt.Sprintf("%d/%s", userID, clientID)
+}
+
+func (r *memOAuthConsentRepo) Get(_ context.Context, userID int64, clientID string) (*entity.OAuthConsent, error) {
+	c, ok := r.consents[consentKey(userID, clientID)]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return c, nil
+}
+
+func (r *memOAuthConsentRepo) Grant(_ context.Context, userID int64, clientID string, scopes []string) error {
+	if r.consents == nil {
+		r.consents = map[string]*entity.OAuthConsent{}
+	}
+	c, ok := r.consents[consentKey(userID, clientID)]
+	if !ok {
+		c = &entity.OAuthConsent{ClientID: clientID}
+		r.consents[consentKey(userID, clientID)] = c
+	}
+	for _, s := range scopes {
+		if !slices.Contains(c.Scopes, s) {
+			c.Scopes = append(c.Scopes, s)
+		}
+	}
+	c.GrantedAt = time.Now()
+	return nil
+}
+
+func (r *memOAuthConsentRepo) ListByUser(context.Context, int64) ([]*entity.OAuthConsent, error) {
+	return nil, nil
+}
+
+func (r *memOAuthConsentRepo) Revoke(_ context.Context, userID int64, clientID string) error {
+	if _, ok := r.consents[consentKey(userID, clientID)]; !ok {
+		return sql.ErrNoRows
+	}
+	delete(r.consents, consentKey(userID, clientID))
+	return nil
+}
+
+type memOAuthGrantStore struct {
+	requests  map[string]entity.OAuthAuthorizationRequest
+	codes     map[string]entity.OAuthAuthorizationCode
+	devices   map[string]entity.OAuthDeviceGrant
+	userCodes map[string]string
+	// polled holds the device codes that polled within the interval.
+	polled map[string]bool
+	// intervals holds each device's current polling interval.
+	intervals map[string]time.Duration
+}
+
+func newMemOAuthGrantStore() *memOAuthGrantStore {
+	return &memOAuthGrantStore{
+		requests:  map[string]entity.OAuthAuthorizationRequest{},
+		codes:     map[string]entity.OAuthAuthorizationCode{},
+		devices:   map[string]entity.OAuthDeviceGrant{},
+		userCodes: map[string]string{},
+		polled:    map[string]bool{},
+		intervals: map[string]time.Duration{},
+	}
+}
+
+func (s *memOAuthGrantStore) SaveRequest(_ context.Context, id string, req *entity.OAuthAuthorizationRequest, _ time.Duration) error {
+	s.requests[id] = *req
+	return nil
+}
+
+func (s *memOAuthGrantStore) GetRequest(_ context.Context, id string) (*entity.OAuthAuthorizationRequest, error) {
+	req, ok := s.requests[id]
+	if !ok {
+		return nil, nil
+	}
+	return &req, nil
+}
+
+func (s *memOAuthGrantStore) DeleteRequest(_ context.Context, id string) (bool, error) {
+	_, ok := s.requests[id]
+	delete(s.requests, id)
+	return ok, nil
+}
+
+func (s *memOAuthGrantStore) SaveCode(_ context.Context, code string, grant *entity.OAuthAuthorizationCode, _ time.Duration) error {
+	s.codes[code] = *grant
+	return nil
+}
+
+func (s *memOAuthGrantStore) TakeCode(_ context.Context, code string) (*entity.OAuthAuthorizationCode, error) {
+	grant, ok := s.codes[code]
+	if !ok {
+		return nil, nil
+	}
+	delete(s.codes, code)
+	return &grant, nil
+}
+
+func (s *memOAuthGrantStore) SaveDeviceGrant(_ context.Context, deviceCode string, grant *entity.OAuthDeviceGrant, _ time.Duration) (bool, error) {
+	if _, taken := s.userCodes[grant.UserCode]; taken {
+		return false, nil
+	}
+	s.devices[deviceCode] = *grant
+	s.userCodes[grant.UserCode] = deviceCode
+	return true, nil
+}
+
+func (s *memOAuthGrantStore) GetDeviceGrant(_ context.Context, deviceCode string) (*entity.OAuthDeviceGrant, error) {
+	grant, ok := s.devices[deviceCode]
+	if !ok {
+		return nil, nil
+	}
+	return &grant, nil
+}
+
+func (s *memOAuthGrantStore) GetDeviceGrantByUserCode(ctx context.Context, userCode string) (*entity.OAuthDeviceGrant, error) {
+	return s.GetDeviceGrant(ctx, s.userCodes[userCode])
+}
+
+func (s *memOAuthGrantStore) DecideDeviceGrant(_ context.Context, userCode string, grant *entity.OAuthDeviceGrant) (bool, error) {
+	deviceCode, ok := s.userCodes[userCode]
+	if !ok || s.devices[deviceCode].Status != entity.OAuthDevicePending {
+		return false, nil
+	}
+	s.devices[deviceCode] = *grant
+	return true, nil
+}
+
+func (s *memOAuthGrantStore) TakeDeviceGrant(_ context.Context, deviceCode string) (*entity.OAuthDeviceGrant, error) {
+	grant, ok := s.devices[deviceCode]
+	if !ok {
+		return nil, nil
+	}
+	delete(s.devices, deviceCode)
+	delete(s.userCodes, grant.UserCode)
+	return &grant, nil
+}
+
+func (s *memOAuthGrantStore) AllowDevicePoll(_ context.Context, deviceCode string, interval, backoff time.Duration) (bool, error) {
+	if s.intervals[deviceCode] == 0 {
+		s.intervals[deviceCode] = interval
+	}
+	if s.polled[deviceCode] {
+		s.intervals[deviceCode] += backoff
+		return false, nil
+	}
+	s.polled[deviceCode] = true
+	return true, nil
+}
+
+var _ interfaces.OAuthGrantStore = (*memOAuthGrantStore)(nil)
+
+func pkcePair(verifier string) (string, string) {
+	sum := sha256.Sum256([]byte(verifier))
+	return verifier, base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func TestOAuth_CreateClientValidatesRegistration(t *testing.T) {
+	ctx := context.Background()
+	admin := &entity.User{ID: 1, Role: entity.RoleAdmin}
+	userRepo := new(testutil.MockUserRepo)
+	userRepo.On("GetById", mock.Anything, admin.ID).Return(admin, nil)
+	repo := &memOAuthClientRepo{}
+	uc := NewOAuthUsecase(repo, nil, nil, userRepo, nil, nil, nil)
+
+	for _, in := range []OAuthClientInput{
+		{Name: "SPA", Public: true},
+		{Name: "App", RedirectURIs: []string{"http://app.example.com/cb"}},
+		{Name: "App", RedirectURIs: []string{"https://app.example.com/cb#frag"}},
+		{Name: "App", RedirectURIs: []string{"myapp:/cb"}},
+		{Name: "App", RedirectURIs: []string{"/relative"}},
+		{Name: "App", Scopes: []string{`bad"scope`}},
+	} {
+		_, _, err := uc.CreateClient(ctx, admin.ID, in)
+		assert.ErrorIs(t, err, utils.ErrInvalidInput, "%+v", in)
+	}
+
+	client, secret, err := uc.CreateClient(ctx, admin.ID, OAuthClientInput{
+		Name:         "SPA",
+		Public:       true,
+		RedirectURIs: []string{"https://app.example.com/cb", "http://127.0.0.1:8080/cb", "com.example.app:/cb"},
+		Scopes:       []string{"read", "write", "read"},
+	})
+	require.NoError(t, err)
+	assert.Empty(t, secret)
+	assert.Empty(t, repo.clients[0].SecretHash)
+	assert.Equal(t, []string{"read", "write"}, client.Scopes)
+
+	got, err := uc.AuthenticateClient(ctx, client.ClientID, "")
+	require.NoError(t, err)
+	assert.True(t, got.Public)
+	_, err = uc.AuthenticateClient(ctx, client.ClientID, "anything")
+	assert.ErrorIs(t, err, ErrInvalidClient)
+}
+
+func TestOAuth_CreateServiceClient(t *testing.T) {
+	ctx := context.Background()
+	admin := &entity.User{ID: 1, Role: entity.RoleAdmin}
+	userRepo := new(testutil.MockUserRepo)
+	userRepo.On("GetById", mock.Anything, admin.ID).Return(admin, nil)
+	businesses := new(testutil.MockBusinessRepo)
+	businesses.On("GetById", mock.Anything, int64(9)).Return(&entity.Business{ID: 9}, nil)
+	businesses.On("GetById", mock.Anything, int64(404)).Return(nil, fmt.Errorf("business: %w", pkgdb.ErrNotFound))
+	uc := NewOAuthUsecase(&memOAuthClientRepo{}, nil, nil, userRepo, businesses, nil, nil)
+	business, missing := int64(9), int64(404)
+
+	for _, in := range []OAuthClientInput{
+		{Name: "Worker", BusinessID: &business, Public: true},
+		{Name: "Worker", BusinessID: &business, RedirectURIs: []string{"https://app.example.com/cb"}},
+		{Name: "Worker", BusinessID: &missing},
+	} {
+		_, _, err := uc.CreateClient(ctx, admin.ID, in)
+		assert.ErrorIs(t, err, utils.ErrInvalidInput, "%+v", in)
+	}
+
+	client, secret, err := uc.CreateClient(ctx, admin.ID, OAuthClientInput{Name: "Worker", BusinessID: &business})
+	require.NoError(t, err)
+	assert.NotEmpty(t, secret)
+	assert.True(t, client.IsService())
+}
+
+func TestOAuth_ClientCredentials(t *testing.T) {
+	ctx := context.Background()
+	tokens := new(testutil.MockTokenService)
+	tokens.On("GenerateServiceAccessToken", "worker", int64(9), []string{"users:read"}).Return("svc-token", nil).Once()
+	tokens.On("GenerateServiceAccessToken", "worker", int64(9), []string{"users:read", "users:write"}).Return("svc-token-all", nil).Once()
+	uc := NewOAuthUsecase(&memOAuthClientRepo{}, nil, nil, nil, nil, tokens, nil)
+	business := int64(9)
+	service := &entity.OAuthClient{ClientID: "worker", BusinessID: &business, Scopes: []string{"users:read", "users:write"}}
+
+	res, err := uc.ClientCredentials(ctx, service, "users:read")
+	require.NoError(t, err)
+	assert.Equal(t, "svc-token", res.AccessToken)
+	assert.Equal(t, "users:read", res.Scope)
+
+	res, err = uc.ClientCredentials(ctx, service, "")
+	require.NoError(t, err)
+	assert.Equal(t, "svc-token-all", res.AccessToken)
+
+	var oauthErr *OAuthError
+	_, err = uc.ClientCredentials(ctx, service, "admin")
+	require.ErrorAs(t, err, &oauthErr)
+	assert.Equal(t, "invalid_scope", oauthErr.Code)
+
+	_, err = uc.ClientCredentials(ctx, confidential, "")
+	require.ErrorAs(t, err, &oauthErr)
+	assert.Equal(t, "unauthorized_client", oauthErr.Code)
+	tokens.AssertExpectations(t)
+}
+
+func TestOAuth_AuthorizationCodeFlow(t *testing.T) {
+	ctx := context.Background()
+	const userID = int64(7)
+	clients := &memOAuthClientRepo{}
+	require.NoError(t, clients.Create(ctx, &entity.OAuthClient{
+		ClientID:     "spa",
+		Name:         "SPA",
+		Public:       true,
+		RedirectURIs: []string{"https://app.example.com/cb", "https://app.example.com/other"},
+		Scopes:       []string{"read", "write"},
+	}))
+	grants := newMemOAuthGrantStore()
+	userRepo := new(testutil.MockUserRepo)
+	userRepo.On("GetById", mock.Anything, userID).Return(&entity.User{ID: userID}, nil)
+	tokens := new(testutil.MockTokenService)
+	tokens.On("GenerateClientAccessToken", userID, "spa", []string{"read"}).Return("client-token", nil)
+	uc := NewOAuthUsecase(clients, &memOAuthConsentRepo{}, grants, userRepo, nil, tokens, nil)
+
+	verifier, challenge := pkcePair(strings.Repeat("v", 50))
+	req := AuthorizationRequest{
+		ResponseType:        "code",
+		ClientID:            "spa",
+		RedirectURI:         "https://app.example.com/cb",
+		Scope:               "read",
+		State:               "xyz",
+		CodeChallenge:       challenge,
+		CodeChallengeMethod: "S256",
+	}
+
+	// Errors before the redirect URI is trusted are not redirected.
+	bad := req
+	bad.RedirectURI = "https://evil.example.com/cb"
+	_, err := uc.Authorize(ctx, bad, userID)
+	var oauthErr *OAuthError
+	require.ErrorAs(t, err, &oauthErr)
+	assert.Equal(t, "invalid_request", oauthErr.Code)
+
+	// Later ones go back to the client, with the state.
+	bad = req
+	bad.CodeChallengeMethod = "plain"
+	res, err := uc.Authorize(ctx, bad, userID)
+	require.NoError(t, err)
+	assertRedirect(t, res.RedirectURL, "https://app.example.com/cb", url.Values{"error": {"invalid_request"}, "state": {"xyz"}})
+	bad = req
+	bad.Scope = "admin"
+	res, err = uc.Authorize(ctx, bad, userID)
+	require.NoError(t, err)
+	assertRedirect(t, res.RedirectURL, "https://app.example.com/cb", url.Values{"error": {"invalid_scope"}})
+
+	res, err = uc.Authorize(ctx, req, 0)
+	require.NoError(t, err)
+	assert.True(t, res.LoginRequired)
+
+	res, err = uc.Authorize(ctx, req, userID)
+	require.NoError(t, err)
+	require.NotEmpty(t, res.ConsentRequestID)
+	_, err = uc.GetConsentRequest(ctx, userID+1, res.ConsentRequestID)
+	assert.ErrorIs(t, err, ErrConsentRequestNotFound, "another user cannot see the request")
+	consent, err := uc.GetConsentRequest(ctx, userID, res.ConsentRequestID)
+	require.NoError(t, err)
+	assert.Equal(t, "SPA", consent.ClientName)
+	assert.Equal(t, []string{"read"}, consent.Scopes)
+
+	redirectURL, err := uc.DecideConsent(ctx, userID, res.ConsentRequestID, true)
+	require.NoError(t, err)
+	code := assertRedirect(t, redirectURL, "https://app.example.com/cb", url.Values{"state": {"xyz"}}).Get("code")
+	require.NotEmpty(t, code)
+	_, err = uc.DecideConsent(ctx, userID, res.ConsentRequestID, true)
+	assert.ErrorIs(t, err, ErrConsentRequestNotFound, "a request is decided once")
+
+	client := clients.clients[0]
+	_, err = uc.ExchangeAuthorizationCode(ctx, client, code, req.RedirectURI, strings.Repeat("w", 50))
+	require.ErrorAs(t, err, &oauthErr)
+	assert.Equal(t, "invalid_grant", oauthErr.Code)
+	// A failed attempt uses the code up.
+	_, err = uc.ExchangeAuthorizationCode(ctx, client, code, req.RedirectURI, verifier)
+	require.ErrorAs(t, err, &oauthErr)
+
+	// With consent on record the user goes straight back to the client.
+	res, err = uc.Authorize(ctx, req, userID)
+	require.NoError(t, err)
+	code = assertRedirect(t, res.RedirectURL, "https://app.example.com/cb", nil).Get("code")
+
+	_, err = uc.ExchangeAuthorizationCode(ctx, client, code, "https://app.example.com/other", verifier)
+	require.ErrorAs(t, err, &oauthErr, "redirect_uri must match the authorization request")
+
+	res, err = uc.Authorize(ctx, req, userID)
+	require.NoError(t, err)
+	code = assertRedirect(t, res.RedirectURL, "https://app.example.com/cb", nil).Get("code")
+	tok, err := uc.ExchangeAuthorizationCode(ctx, client, code, req.RedirectURI, verifier)
+	require.NoError(t, err)
+	assert.Equal(t, &OAuthTokenResponse{AccessToken: "client-token", TokenType: "Bearer", ExpiresIn: 900, Scope: "read"}, tok)
+
+	_, err = uc.ExchangeAuthorizationCode(ctx, client, code, req.RedirectURI, verifier)
+	require.ErrorAs(t, err, &oauthErr, "codes are single-use")
+	assert.Equal(t, "invalid_grant", oauthErr.Code)
+}
+
+func TestOAuth_DeniedConsent(t *testing.T) {
+	ctx := context.Background()
+	clients := &memOAuthClientRepo{}
+	require.NoError(t, clients.Create(ctx, &entity.OAuthClient{ClientID: "app", RedirectURIs: []string{"https://app.example.com/cb?tenant=1"}}))
+	consents := &memOAuthConsentRepo{}
+	uc := NewOAuthUsecase(clients, consents, newMemOAuthGrantStore(), nil, nil, nil, nil)
+	_, challenge := pkcePair(strings.Repeat("v", 43))
+
+	// A single registered redirect URI may be omitted.
+	res, err := uc.Authorize(ctx, AuthorizationRequest{ResponseType: "code", ClientID: "app", CodeChallenge: challenge, CodeChallengeMethod: "S256"}, 7)
+	require.NoError(t, err)
+	redirectURL, err := uc.DecideConsent(ctx, 7, res.ConsentRequestID, false)
+	require.NoError(t, err)
+	assertRedirect(t, redirectURL, "https://app.example.com/cb", url.Values{"error": {"access_denied"}, "tenant": {"1"}})
+	assert.Empty(t, consents.consents)
+}
+
+func TestOAuth_RevokeChecksTokenClient(t *testing.T) {
+	ctx := context.Background()
+	exp := time.Now().Add(10 * time.Minute)
+	tokens := new(testutil.MockTokenService)
+	tokens.On("VerifyAccessToken", mock.Anything, "spa-token").Return(&interfaces.AccessClaims{UserID: 7, TokenID: "jti-1", ExpiresAt: exp, ClientID: "spa"}, nil)
+	tokens.On("VerifyAccessToken", mock.Anything, "first-party").Return(&interfaces.AccessClaims{UserID: 7, TokenID: "jti-2", ExpiresAt: exp}, nil)
+	tokens.On("RevokeAccessToken", mock.Anything, "jti-1", exp).Return(nil)
+	uc := NewOAuthUsecase(&memOAuthClientRepo{}, nil, nil, nil, nil, tokens, nil)
+	spa := &entity.OAuthClient{ClientID: "spa", Public: true}
+
+	assert.ErrorIs(t, uc.Revoke(ctx, confidential, "spa-token", ""), ErrUnauthorizedClient)
+	assert.ErrorIs(t, uc.Revoke(ctx, spa, "first-party", ""), ErrUnauthorizedClient)
+	require.NoError(t, uc.Revoke(ctx, spa, "spa-token", ""))
+	tokens.AssertNumberOfCalls(t, "RevokeAccessToken", 1)
+}
+
+// assertRedirect checks that redirectURL points at base with at least the
+// given query values, and returns its query.
+func assertRedirect(t *testing.T, redirectURL, base string, want url.Values) url.Values {
+	t.Helper()
+	u, err := url.Parse(redirectURL)
+	require.NoError(t, err)
+	q := u.Query()
+	u.RawQuery = ""
+	assert.Equal(t, base, u.String())
+	for k := range want {
+		assert.Equal(t, want.Get(k), q.Get(k), k)
+	}
+	return q
+}
@@ -0,0 +1,35 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/Prashant2307200/auth-service/internal/entity"
+)
+
+func (u *oauthUsecase) ClientCredentials(ctx context.Context, client *entity.OAuthClient, scope string) (*OAuthTokenResponse, error) {
+	if !client.IsService() {
+		return nil, &OAuthError{Code: "unauthorized_client", Description: "only service clients may use the client_credentials grant"}
+	}
+
+	scopes := client.Scopes
+	if requested := strings.Fields(scope); len(requested) > 0 {
+		var err error
+		scopes, err = normalizeScopes(requested)
+		if err != nil || !client.AllowsScopes(scopes) {
+			return nil, &OAuthError{Code: "invalid_scope", Description: "scope is not allowed for this client"}
+		}
+	}
+
+	accessToken, err := u.tokens.GenerateServiceAccessToken(client.ClientID, *client.BusinessID, scopes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate access token: %w", err)
+	}
+	return &OAuthTokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(oauthAccessTokenLifetime.Seconds()),
+		Scope:       strings.Join(scopes, " "),
+	}, nil
+}
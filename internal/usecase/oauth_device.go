@@ -0,0 +1,220 @@
+package usecase
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/Prashant2307200/auth-service/internal/entity"
+)
+
+var ErrUserCodeNotFound = errors.New("user code not found or expired")
+
+const (
+	oauthDeviceCodeTTL = 10 * time.Minute
+	// oauthDevicePollInterval is the minimum time between two polls of the
+	// token endpoint by the same device.
+	oauthDevicePollInterval = 5 * time.Second
+	// oauthDeviceSlowDown is added to a device's interval each time it is
+	// told to slow down (RFC 8628 §3.5).
+	oauthDeviceSlowDown  = 5 * time.Second
+	oauthDeviceCodeBytes = 32
+
+	// User codes avoid vowels, so they never spell words, and characters
+	// that are easily confused (RFC 8628 §6.1). Eight of them give about
+	// 2^34 codes, enough for the few codes alive at any time.
+	userCodeAlphabet = "BCDFGHJKLMNPQRSTVWXZ"
+	userCodeLength   = 8
+	// userCodeAttempts bounds retries when a generated user code is in use.
+	userCodeAttempts = 5
+)
+
+// DeviceAuthorization is the response to a device authorization request.
+// The handler adds the verification URIs.
+type DeviceAuthorization struct {
+	DeviceCode string
+	// UserCode is formatted for display, as in BCDF-GHJK.
+	UserCode  string
+	ExpiresIn int64
+	Interval  int64
+}
+
+func (u *oauthUsecase) StartDeviceAuthorization(ctx context.Context, client *entity.OAuthClient, scope string) (*DeviceAuthorization, error) {
+	if client.IsService() {
+		return nil, &OAuthError{Code: "unauthorized_client", Description: "service clients cannot act for users"}
+	}
+	scopes, err := normalizeScopes(strings.Fields(scope))
+	if err != nil || !client.AllowsScopes(scopes) {
+		return nil, &OAuthError{Code: "invalid_scope", Description: "scope is not allowed for this client"}
+	}
+
+	deviceCode, err := generateSecureToken(oauthDeviceCodeBytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate device code: %w", err)
+	}
+	for range userCodeAttempts {
+		userCode, err := generateUserCode()
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate user code: %w", err)
+		}
+		grant := &entity.OAuthDeviceGrant{
+			ClientID: client.ClientID,
+			UserCode: userCode,
+			Scopes:   scopes,
+			Status:   entity.OAuthDevicePending,
+		}
+		saved, err := u.grants.SaveDeviceGrant(ctx, deviceCode, grant, oauthDeviceCodeTTL)
+		if err != nil {
+			return nil, err
+		}
+		if saved {
+			return &DeviceAuthorization{
+				DeviceCode: deviceCode,
+				UserCode:   formatUserCode(userCode),
+				ExpiresIn:  int64(oauthDeviceCodeTTL.Seconds()),
+				Interval:   int64(oauthDevicePollInterval.Seconds()),
+			}, nil
+		}
+	}
+	return nil, errors.New("failed to allocate a free user code")
+}
+
+// pendingDeviceGrant returns the undecided grant of a user code as typed by
+// the user, or ErrUserCodeNotFound.
+func (u *oauthUsecase) pendingDeviceGrant(ctx context.Context, input string) (string, *entity.OAuthDeviceGrant, error) {
+	userCode, ok := normalizeUserCode(input)
+	if !ok {
+		return "", nil, ErrUserCodeNotFound
+	}
+	grant, err := u.grants.GetDeviceGrantByUserCode(ctx, userCode)
+	if err != nil {
+		return "", nil, err
+	}
+	if grant == nil || grant.Status != entity.OAuthDevicePending {
+		return "", nil, ErrUserCodeNotFound
+	}
+	return userCode, grant, nil
+}
+
+func (u *oauthUsecase) GetDeviceRequest(ctx context.Context, userCode string) (*ConsentRequest, error) {
+	_, grant, err := u.pendingDeviceGrant(ctx, userCode)
+	if err != nil {
+		return nil, err
+	}
+	client, err := u.clients.GetByClientID(ctx, grant.ClientID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrUserCodeNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load oauth client: %w", err)
+	}
+	return &ConsentRequest{ClientID: client.ClientID, ClientName: client.Name, Scopes: grant.Scopes}, nil
+}
+
+func (u *oauthUsecase) DecideDevice(ctx context.Context, userID int64, input string, approve bool) error {
+	userCode, grant, err := u.pendingDeviceGrant(ctx, input)
+	if err != nil {
+		return err
+	}
+	grant.UserID = userID
+	grant.AuthTime = time.Now()
+	grant.Status = entity.OAuthDeviceDenied
+	if approve {
+		grant.Status = entity.OAuthDeviceApproved
+		if err := u.consents.Grant(ctx, userID, grant.ClientID, grant.Scopes); err != nil {
+			return fmt.Errorf("failed to record oauth consent: %w", err)
+		}
+	}
+	updated, err := u.grants.DecideDeviceGrant(ctx, userCode, grant)
+	if err != nil {
+		return err
+	}
+	if !updated {
+		return ErrUserCodeNotFound
+	}
+	return nil
+}
+
+func (u *oauthUsecase) ExchangeDeviceCode(ctx context.Context, client *entity.OAuthClient, deviceCode string) (*OAuthTokenResponse, error) {
+	if deviceCode == "" {
+		return nil, &OAuthError{Code: "invalid_request", Description: "device_code is required"}
+	}
+	grant, err := u.grants.GetDeviceGrant(ctx, deviceCode)
+	if err != nil {
+		return nil, err
+	}
+	if grant == nil {
+		return nil, &OAuthError{Code: "expired_token", Description: "device code is invalid or expired"}
+	}
+	if grant.ClientID != client.ClientID {
+		return nil, &OAuthError{Code: "invalid_grant", Description: "device code was issued to another client"}
+	}
+	allowed, err := u.grants.AllowDevicePoll(ctx, deviceCode, oauthDevicePollInterval, oauthDeviceSlowDown)
+	if err != nil {
+		return nil, err
+	}
+	if !allowed {
+		return nil, &OAuthError{Code: "slow_down", Description: "polling too often"}
+	}
+
+	switch grant.Status {
+	case entity.OAuthDevicePending:
+		return nil, &OAuthError{Code: "authorization_pending", Description: "the user has not approved the request yet"}
+	case entity.OAuthDeviceDenied:
+		if _, err := u.grants.TakeDeviceGrant(ctx, deviceCode); err != nil {
+			return nil, err
+		}
+		return nil, &OAuthError{Code: "access_denied", Description: "the user denied the request"}
+	}
+
+	grant, err = u.grants.TakeDeviceGrant(ctx, deviceCode)
+	if err != nil {
+		return nil, err
+	}
+	if grant == nil || grant.Status != entity.OAuthDeviceApproved {
+		// Another poll redeemed the approval first.
+		return nil, &OAuthError{Code: "expired_token", Description: "device code is invalid or expired"}
+	}
+	return u.issueUserTokens(ctx, client, grant.UserID, grant.Scopes, "", "device code is invalid or expired")
+}
+
+func generateUserCode() (string, error) {
+	size := big.NewInt(int64(len(userCodeAlphabet)))
+	var b strings.Builder
+	for range userCodeLength {
+		n, err := rand.Int(rand.Reader, size)
+		if err != nil {
+			return "", err
+		}
+		b.WriteByte(userCodeAlphabet[n.Int64()])
+	}
+	return b.String(), nil
+}
+
+// normalizeUserCode accepts a user code as typed, in any case and with or
+// without separators, and returns it in the stored form.
+func normalizeUserCode(input string) (string, bool) {
+	var b strings.Builder
+	for _, r := range strings.ToUpper(input) {
+		switch {
+		case r == '-' || r == ' ':
+		case strings.ContainsRune(userCodeAlphabet, r):
+			b.WriteRune(r)
+		default:
+			return "", false
+		}
+	}
+	if b.Len() != userCodeLength {
+		return "", false
+	}
+	return b.String(), true
+}
+
+func formatUserCode(code string) string {
+	return code[:userCodeLength/2] + "-" + code[userCodeLength/2:]
+}
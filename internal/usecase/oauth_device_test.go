@@ -0,0 +1,138 @@
+package usecase
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Prashant2307200/auth-service/internal/entity"
+	"github.com/Prashant2307200/auth-service/internal/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func assertOAuthError(t *testing.T, err error, code string) {
+	t.Helper()
+	var oauthErr *OAuthError
+	require.ErrorAs(t, err, &oauthErr)
+	assert.Equal(t, code, oauthErr.Code)
+}
+
+func TestOAuth_DeviceAuthorizationFlow(t *testing.T) {
+	ctx := context.Background()
+	cli := &entity.OAuthClient{ClientID: "cli", Name: "CLI", Public: true, Scopes: []string{"read", "write"}}
+	clients := &memOAuthClientRepo{}
+	require.NoError(t, clients.Create(ctx, cli))
+	consents := &memOAuthConsentRepo{}
+	grants := newMemOAuthGrantStore()
+	userRepo := new(testutil.MockUserRepo)
+	userRepo.On("GetById", mock.Anything, int64(7)).Return(&entity.User{ID: 7}, nil)
+	tokens := new(testutil.MockTokenService)
+	tokens.On("GenerateClientAccessToken", int64(7), "cli", []string{"read"}).Return("at", nil).Once()
+	uc := NewOAuthUsecase(clients, consents, grants, userRepo, nil, tokens, nil)
+
+	auth, err := uc.StartDeviceAuthorization(ctx, cli, "read")
+	require.NoError(t, err)
+	assert.Regexp(t, `^[B-Z]{4}-[B-Z]{4}$`, auth.UserCode)
+	assert.EqualValues(t, 600, auth.ExpiresIn)
+	assert.EqualValues(t, 5, auth.Interval)
+
+	_, err = uc.ExchangeDeviceCode(ctx, cli, auth.DeviceCode)
+	assertOAuthError(t, err, "authorization_pending")
+	_, err = uc.ExchangeDeviceCode(ctx, cli, auth.DeviceCode)
+	assertOAuthError(t, err, "slow_down")
+	assert.Equal(t, 10*time.Second, grants.intervals[auth.DeviceCode])
+	_, err = uc.ExchangeDeviceCode(ctx, &entity.OAuthClient{ClientID: "other"}, auth.DeviceCode)
+	assertOAuthError(t, err, "invalid_grant")
+
+	// Users may type the code in lower case and without the dash.
+	typed := strings.ToLower(strings.ReplaceAll(auth.UserCode, "-", ""))
+	req, err := uc.GetDeviceRequest(ctx, typed)
+	require.NoError(t, err)
+	assert.Equal(t, "CLI", req.ClientName)
+	assert.Equal(t, []string{"read"}, req.Scopes)
+	require.NoError(t, uc.DecideDevice(ctx, 7, typed, true))
+	assert.ErrorIs(t, uc.DecideDevice(ctx, 7, typed, false), ErrUserCodeNotFound)
+	consent, err := consents.Get(ctx, 7, "cli")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"read"}, consent.Scopes)
+
+	clear(grants.polled)
+	res, err := uc.ExchangeDeviceCode(ctx, cli, auth.DeviceCode)
+	require.NoError(t, err)
+	assert.Equal(t, "at", res.AccessToken)
+	assert.Equal(t, "read", res.Scope)
+
+	clear(grants.polled)
+	_, err = uc.ExchangeDeviceCode(ctx, cli, auth.DeviceCode)
+	assertOAuthError(t, err, "expired_token")
+	_, err = uc.GetDeviceRequest(ctx, auth.UserCode)
+	assert.ErrorIs(t, err, ErrUserCodeNotFound)
+	tokens.AssertExpectations(t)
+}
+
+func TestOAuth_DeviceAuthorizationDenied(t *testing.T) {
+	ctx := context.Background()
+	cli := &entity.OAuthClient{ClientID: "cli", Public: true, Scopes: []string{"read"}}
+	grants := newMemOAuthGrantStore()
+	uc := NewOAuthUsecase(&memOAuthClientRepo{}, &memOAuthConsentRepo{}, grants, nil, nil, nil, nil)
+
+	auth, err := uc.StartDeviceAuthorization(ctx, cli, "")
+	require.NoError(t, err)
+	require.NoError(t, uc.DecideDevice(ctx, 7, auth.UserCode, false))
+
+	_, err = uc.ExchangeDeviceCode(ctx, cli, auth.DeviceCode)
+	assertOAuthError(t, err, "access_denied")
+	clear(grants.polled)
+	_, err = uc.ExchangeDeviceCode(ctx, cli, auth.DeviceCode)
+	assertOAuthError(t, err, "expired_token")
+}
+
+// staleDeviceGrants reads every grant as pending, as a decision would that
+// raced another one between reading and storing.
+type staleDeviceGrants struct {
+	*memOAuthGrantStore
+}
+
+func (s staleDeviceGrants) GetDeviceGrantByUserCode(ctx context.Context, userCode string) (*entity.OAuthDeviceGrant, error) {
+	grant, err := s.memOAuthGrantStore.GetDeviceGrantByUserCode(ctx, userCode)
+	if grant != nil {
+		grant.Status = entity.OAuthDevicePending
+	}
+	return grant, err
+}
+
+func TestOAuth_DeviceAuthorizationDecidedOnce(t *testing.T) {
+	ctx := context.Background()
+	cli := &entity.OAuthClient{ClientID: "cli", Public: true, Scopes: []string{"read"}}
+	grants := newMemOAuthGrantStore()
+	uc := NewOAuthUsecase(&memOAuthClientRepo{}, &memOAuthConsentRepo{}, staleDeviceGrants{grants}, nil, nil, nil, nil)
+
+	auth, err := uc.StartDeviceAuthorization(ctx, cli, "")
+	require.NoError(t, err)
+	require.NoError(t, uc.DecideDevice(ctx, 7, auth.UserCode, false))
+	assert.ErrorIs(t, uc.DecideDevice(ctx, 8, auth.UserCode, true), ErrUserCodeNotFound)
+
+	grant, err := grants.GetDeviceGrant(ctx, auth.DeviceCode)
+	require.NoError(t, err)
+	assert.Equal(t, entity.OAuthDeviceDenied, grant.Status)
+	assert.EqualValues(t, 7, grant.UserID)
+}
+
+func TestOAuth_DeviceAuthorizationRejects(t *testing.T) {
+	ctx := context.Background()
+	uc := NewOAuthUsecase(&memOAuthClientRepo{}, &memOAuthConsentRepo{}, newMemOAuthGrantStore(), nil, nil, nil, nil)
+	business := int64(9)
+
+	_, err := uc.StartDeviceAuthorization(ctx, &entity.OAuthClient{ClientID: "worker", BusinessID: &business}, "")
+	assertOAuthError(t, err, "unauthorized_client")
+	_, err = uc.StartDeviceAuthorization(ctx, &entity.OAuthClient{ClientID: "cli", Scopes: []string{"read"}}, "admin")
+	assertOAuthError(t, err, "invalid_scope")
+
+	for _, code := range []string{"", "BCDF-GHJ", "BCDF-GHJKL", "AEIO-UBCD"} {
+		_, err = uc.GetDeviceRequest(ctx, code)
+		assert.ErrorIs(t, err, ErrUserCodeNotFound, code)
+	}
+}
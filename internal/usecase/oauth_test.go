@@ -0,0 +1,183 @@
+package usecase
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Prashant2307200/auth-service/internal/entity"
+	"github.com/Prashant2307200/auth-service/internal/testutil"
+	"github.com/Prashant2307200/auth-service/internal/usecase/interfaces"
+	"github.com/Prashant2307200/auth-service/internal/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type memOAuthClientRepo struct {
+	clients []*entity.OAuthClient
+}
+
+func (r *memOAuthClientRepo) Create(_ context.Context, client *entity.OAuthClient) error {
+	client.ID = int64(len(r.clients) + 1)
+	client.CreatedAt = time.Now()
+	cp := *client
+	r.clients = append(r.clients, &cp)
+	return nil
+}
+
+func (r *memOAuthClientRepo) GetByClientID(_ context.Context, clientID string) (*entity.OAuthClient, error) {
+	for _, c := range r.clients {
+		if c.ClientID == clientID {
+			cp := *c
+			return &cp, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (r *memOAuthClientRepo) List(context.Context) ([]*entity.OAuthClient, error) {
+	return r.clients, nil
+}
+
+func (r *memOAuthClientRepo) Delete(_ context.Context, clientID string) error {
+	for i, c := range r.clients {
+		if c.ClientID == clientID {
+			r.clients = append(r.clients[:i], r.clients[i+1:]...)
+			return nil
+		}
+	}
+	return sql.ErrNoRows
+}
+
+var confidential = &entity.OAuthClient{ClientID: "resource-server"}
+
+var firstParty = &entity.OAuthClient{ClientID: "account-console", FirstParty: true}
+
+func TestOAuth_ClientRegistrationAndAuthentication(t *testing.T) {
+	ctx := context.Background()
+	admin := &entity.User{ID: 1, Role: entity.RoleAdmin}
+	member := &entity.User{ID: 2, Role: entity.RoleUser}
+	userRepo := new(testutil.MockUserRepo)
+	userRepo.On("GetById", mock.Anything, admin.ID).Return(admin, nil)
+	userRepo.On("GetById", mock.Anything, member.ID).Return(member, nil)
+	repo := &memOAuthClientRepo{}
+	uc := NewOAuthUsecase(repo, nil, nil, userRepo, nil, nil, nil)
+
+	_, _, err := uc.CreateClient(ctx, member.ID, OAuthClientInput{Name: "Billing"})
+	assert.ErrorIs(t, err, utils.ErrForbidden)
+	_, _, err = uc.CreateClient(ctx, admin.ID, OAuthClientInput{Name: "  "})
+	assert.ErrorIs(t, err, utils.ErrInvalidInput)
+	_, _, err = uc.CreateClient(ctx, admin.ID, OAuthClientInput{Name: "SPA", Public: true, RedirectURIs: []string{"https://app.example.com/cb"}, FirstParty: true})
+	assert.ErrorIs(t, err, utils.ErrInvalidInput)
+
+	client, secret, err := uc.CreateClient(ctx, admin.ID, OAuthClientInput{Name: " Billing "})
+	require.NoError(t, err)
+	assert.Equal(t, "Billing", client.Name)
+	assert.NotEmpty(t, client.ClientID)
+	assert.Equal(t, hashToken(secret), repo.clients[0].SecretHash, "only the hash is stored")
+
+	got, err := uc.AuthenticateClient(ctx, client.ClientID, secret)
+	require.NoError(t, err)
+	assert.Equal(t, client.ID, got.ID)
+	_, err = uc.AuthenticateClient(ctx, client.ClientID, secret+"x")
+	assert.ErrorIs(t, err, ErrInvalidClient)
+	_, err = uc.AuthenticateClient(ctx, "unknown", secret)
+	assert.ErrorIs(t, err, ErrInvalidClient)
+
+	require.NoError(t, uc.DeleteClient(ctx, admin.ID, client.ClientID))
+	assert.ErrorIs(t, uc.DeleteClient(ctx, admin.ID, client.ClientID), ErrOAuthClientNotFound)
+	_, err = uc.AuthenticateClient(ctx, client.ClientID, secret)
+	assert.ErrorIs(t, err, ErrInvalidClient)
+}
+
+func TestOAuth_IntrospectAccessToken(t *testing.T) {
+	ctx := context.Background()
+	exp := time.Now().Add(10 * time.Minute)
+	tokens := new(testutil.MockTokenService)
+	tokens.On("VerifyAccessToken", mock.Anything, "access").Return(&interfaces.AccessClaims{UserID: 7, SessionID: "sess-1", TokenID: "jti-1", BusinessID: 3, ExpiresAt: exp}, nil)
+	tokens.On("VerifyAccessToken", mock.Anything, mock.Anything).Return(nil, errors.New("invalid token"))
+	tokens.On("VerifyRefreshToken", mock.Anything, mock.Anything).Return(nil, errors.New("invalid token"))
+	userRepo := new(testutil.MockUserRepo)
+	userRepo.On("GetById", mock.Anything, int64(7)).Return(&entity.User{ID: 7}, nil)
+	uc := NewOAuthUsecase(&memOAuthClientRepo{}, nil, nil, userRepo, nil, tokens, nil)
+
+	info, err := uc.Introspect(ctx, "access", "")
+	require.NoError(t, err)
+	assert.Equal(t, &TokenIntrospection{Active: true, Subject: "7", TenantID: 3, ExpiresAt: exp, SessionID: "sess-1"}, info)
+
+	// A wrong hint only changes the order in which token types are tried.
+	info, err = uc.Introspect(ctx, "access", TokenTypeHintRefreshToken)
+	require.NoError(t, err)
+	assert.True(t, info.Active)
+
+	info, err = uc.Introspect(ctx, "garbage", "")
+	require.NoError(t, err)
+	assert.Equal(t, &TokenIntrospection{Active: false}, info)
+}
+
+func TestOAuth_IntrospectRefreshTokenMustBeCurrent(t *testing.T) {
+	ctx := context.Background()
+	tokens := new(testutil.MockTokenService)
+	tokens.On("VerifyAccessToken", mock.Anything, mock.Anything).Return(nil, errors.New("invalid token"))
+	tokens.On("VerifyRefreshToken", mock.Anything, mock.Anything).Return(&interfaces.RefreshClaims{UserID: 7, SessionID: "sess-1", ExpiresAt: time.Now().Add(time.Hour)}, nil)
+	tokens.On("GetRefreshToken", mock.Anything, "sess-1").Return("current", nil)
+	userRepo := new(testutil.MockUserRepo)
+	userRepo.On("GetById", mock.Anything, int64(7)).Return(&entity.User{ID: 7}, nil)
+	uc := NewOAuthUsecase(&memOAuthClientRepo{}, nil, nil, userRepo, nil, tokens, nil)
+
+	info, err := uc.Introspect(ctx, "current", TokenTypeHintRefreshToken)
+	require.NoError(t, err)
+	assert.True(t, info.Active)
+	assert.Equal(t, "sess-1", info.SessionID)
+
+	info, err = uc.Introspect(ctx, "rotated", TokenTypeHintRefreshToken)
+	require.NoError(t, err)
+	assert.False(t, info.Active)
+}
+
+func TestOAuth_RevokeAccessToken(t *testing.T) {
+	ctx := context.Background()
+	exp := time.Now().Add(10 * time.Minute)
+	tokens := new(testutil.MockTokenService)
+	tokens.On("VerifyAccessToken", mock.Anything, "access").Return(&interfaces.AccessClaims{UserID: 7, SessionID: "sess-1", TokenID: "jti-1", ExpiresAt: exp}, nil)
+	tokens.On("RevokeAccessToken", mock.Anything, "jti-1", exp).Return(nil)
+	uc := NewOAuthUsecase(&memOAuthClientRepo{}, nil, nil, new(testutil.MockUserRepo), nil, tokens, nil)
+
+	// Sign-in tokens are not any confidential client's to revoke.
+	assert.ErrorIs(t, uc.Revoke(ctx, confidential, "access", TokenTypeHintAccessToken), ErrUnauthorizedClient)
+	tokens.AssertNotCalled(t, "RevokeAccessToken", mock.Anything, mock.Anything, mock.Anything)
+
+	require.NoError(t, uc.Revoke(ctx, firstParty, "access", TokenTypeHintAccessToken))
+	tokens.AssertExpectations(t)
+	tokens.AssertNotCalled(t, "RevokeSessionAccessTokens", mock.Anything, mock.Anything)
+}
+
+func TestOAuth_RevokeRefreshTokenEndsSession(t *testing.T) {
+	ctx := context.Background()
+	tokens := new(testutil.MockTokenService)
+	sessions := new(testutil.MockSessionService)
+	tokens.On("VerifyRefreshToken", mock.Anything, "refresh").Return(&interfaces.RefreshClaims{UserID: 7, SessionID: "sess-1"}, nil)
+	tokens.On("GetRefreshToken", mock.Anything, "sess-1").Return("refresh", nil)
+	tokens.On("RemoveRefreshToken", mock.Anything, "sess-1").Return(nil)
+	tokens.On("RevokeSessionAccessTokens", mock.Anything, "sess-1").Return(nil)
+	sessions.On("RevokeSession", mock.Anything, int64(7), "sess-1").Return(nil)
+	uc := NewOAuthUsecase(&memOAuthClientRepo{}, nil, nil, new(testutil.MockUserRepo), nil, tokens, sessions)
+
+	businessID := int64(5)
+	service := &entity.OAuthClient{ClientID: "billing", BusinessID: &businessID}
+	assert.ErrorIs(t, uc.Revoke(ctx, service, "refresh", TokenTypeHintRefreshToken), ErrUnauthorizedClient)
+	assert.ErrorIs(t, uc.Revoke(ctx, confidential, "refresh", TokenTypeHintRefreshToken), ErrUnauthorizedClient)
+	tokens.AssertNotCalled(t, "RemoveRefreshToken", mock.Anything, mock.Anything)
+
+	require.NoError(t, uc.Revoke(ctx, firstParty, "refresh", TokenTypeHintRefreshToken))
+	tokens.AssertExpectations(t)
+	sessions.AssertExpectations(t)
+
+	// Unknown tokens are accepted silently.
+	tokens.On("VerifyAccessToken", mock.Anything, "garbage").Return(nil, errors.New("invalid token"))
+	tokens.On("VerifyRefreshToken", mock.Anything, "garbage").Return(nil, errors.New("invalid token"))
+	require.NoError(t, uc.Revoke(ctx, confidential, "garbage", ""))
+}
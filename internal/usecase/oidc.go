@@ -0,0 +1,69 @@
+package usecase
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+
+	"github.com/Prashant2307200/auth-service/internal/entity"
+	pkgdb "github.com/Prashant2307200/auth-service/pkg/db"
+)
+
+// OpenID Connect scopes (OIDC Core §5.4). openid asks for an ID token; the
+// others select which user claims it and userinfo carry.
+const (
+	ScopeOpenID  = "openid"
+	ScopeProfile = "profile"
+	ScopeEmail   = "email"
+)
+
+var (
+	// ErrInvalidAccessToken is returned by UserInfo for tokens that are
+	// malformed, expired, revoked or whose user no longer exists.
+	ErrInvalidAccessToken = errors.New("invalid access token")
+	// ErrInsufficientScope is returned by UserInfo for tokens issued
+	// without the openid scope.
+	ErrInsufficientScope = errors.New("access token lacks the openid scope")
+)
+
+// UserInfo returns the claims about the user of an access token issued with
+// the openid scope, limited to what its other scopes allow (OIDC Core §5.3).
+func (u *oauthUsecase) UserInfo(ctx context.Context, accessToken string) (map[string]any, error) {
+	claims, err := u.tokens.VerifyAccessToken(ctx, accessToken)
+	if err != nil || claims.IsServiceClient() {
+		return nil, ErrInvalidAccessToken
+	}
+	if !slices.Contains(claims.Scopes, ScopeOpenID) {
+		return nil, ErrInsufficientScope
+	}
+	user, err := u.userRepo.GetById(ctx, claims.UserID)
+	if errors.Is(err, pkgdb.ErrNotFound) || errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvalidAccessToken
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load user: %w", err)
+	}
+
+	info := userClaims(user, claims.Scopes)
+	info["sub"] = strconv.FormatInt(user.ID, 10)
+	return info, nil
+}
+
+// userClaims returns the standard claims about user that scopes allow.
+func userClaims(user *entity.User, scopes []string) map[string]any {
+	claims := map[string]any{}
+	if slices.Contains(scopes, ScopeProfile) {
+		claims["name"] = user.Username
+		if user.ProfilePic != "" {
+			claims["picture"] = user.ProfilePic
+		}
+	}
+	if slices.Contains(scopes, ScopeEmail) {
+		claims["email"] = user.Email
+		claims["email_verified"] = user.EmailVerified
+	}
+	return claims
+}
@@ -0,0 +1,76 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/Prashant2307200/auth-service/internal/entity"
+	"github.com/Prashant2307200/auth-service/internal/testutil"
+	"github.com/Prashant2307200/auth-service/internal/usecase/interfaces"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+var oidcUser = &entity.User{ID: 7, Username: "ada", Email: "ada@example.com", EmailVerified: true, ProfilePic: "https://img.example.com/ada.png"}
+
+func TestOIDC_UserInfoFiltersClaimsByScope(t *testing.T) {
+	ctx := context.Background()
+	tokens := new(testutil.MockTokenService)
+	tokens.On("VerifyAccessToken", mock.Anything, "email-only").Return(&interfaces.AccessClaims{UserID: 7, ClientID: "spa", Scopes: []string{"openid", "email"}}, nil)
+	tokens.On("VerifyAccessToken", mock.Anything, "everything").Return(&interfaces.AccessClaims{UserID: 7, ClientID: "spa", Scopes: []string{"openid", "profile", "email"}}, nil)
+	tokens.On("VerifyAccessToken", mock.Anything, "no-openid").Return(&interfaces.AccessClaims{UserID: 7, ClientID: "spa", Scopes: []string{"profile"}}, nil)
+	tokens.On("VerifyAccessToken", mock.Anything, "garbage").Return(nil, errors.New("invalid token"))
+	userRepo := new(testutil.MockUserRepo)
+	userRepo.On("GetById", mock.Anything, int64(7)).Return(oidcUser, nil)
+	uc := NewOAuthUsecase(&memOAuthClientRepo{}, nil, nil, userRepo, nil, tokens, nil)
+
+	info, err := uc.UserInfo(ctx, "email-only")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"sub": "7", "email": "ada@example.com", "email_verified": true}, info)
+
+	info, err = uc.UserInfo(ctx, "everything")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{
+		"sub": "7", "name": "ada", "picture": "https://img.example.com/ada.png",
+		"email": "ada@example.com", "email_verified": true,
+	}, info)
+
+	_, err = uc.UserInfo(ctx, "no-openid")
+	assert.ErrorIs(t, err, ErrInsufficientScope)
+	_, err = uc.UserInfo(ctx, "garbage")
+	assert.ErrorIs(t, err, ErrInvalidAccessToken)
+}
+
+func TestOIDC_CodeExchangeIssuesIDToken(t *testing.T) {
+	ctx := context.Background()
+	clients := &memOAuthClientRepo{}
+	require.NoError(t, clients.Create(ctx, &entity.OAuthClient{
+		ClientID: "spa", RedirectURIs: []string{"https://app.example.com/cb"}, Scopes: []string{"openid", "profile", "email"},
+	}))
+	userRepo := new(testutil.MockUserRepo)
+	userRepo.On("GetById", mock.Anything, int64(7)).Return(oidcUser, nil)
+	tokens := new(testutil.MockTokenService)
+	tokens.On("GenerateClientAccessToken", int64(7), "spa", []string{"openid", "profile"}).Return("at", nil)
+	tokens.On("GenerateIDToken", int64(7), "spa", "n-0S6", map[string]any{"name": "ada", "picture": "https://img.example.com/ada.png"}).Return("id-token", nil)
+	uc := NewOAuthUsecase(clients, &memOAuthConsentRepo{}, newMemOAuthGrantStore(), userRepo, nil, tokens, nil)
+
+	verifier, challenge := pkcePair(strings.Repeat("v", 43))
+	res, err := uc.Authorize(ctx, AuthorizationRequest{
+		ResponseType: "code", ClientID: "spa", Scope: "openid profile", Nonce: "n-0S6",
+		CodeChallenge: challenge, CodeChallengeMethod: "S256",
+	}, 7)
+	require.NoError(t, err)
+	redirectURL, err := uc.DecideConsent(ctx, 7, res.ConsentRequestID, true)
+	require.NoError(t, err)
+	u, err := url.Parse(redirectURL)
+	require.NoError(t, err)
+
+	tok, err := uc.ExchangeAuthorizationCode(ctx, clients.clients[0], u.Query().Get("code"), "", verifier)
+	require.NoError(t, err)
+	assert.Equal(t, "id-token", tok.IDToken)
+	tokens.AssertExpectations(t)
+}
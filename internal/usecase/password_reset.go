@@ -29,6 +29,7 @@ type passwordResetUsecase struct {
 	resetRepo     repository.PasswordResetRepository
 	emailService  EmailService
 	tokenService  interfaces.TokenService
+	sessions      interfaces.SessionService
 }
 
 func NewPasswordResetUsecase(
@@ -36,12 +37,14 @@ func NewPasswordResetUsecase(
 	resetRepo repository.PasswordResetRepository,
 	emailService EmailService,
 	tokenService interfaces.TokenService,
+	sessions interfaces.SessionService,
 ) PasswordResetUsecase {
 	return &passwordResetUsecase{
 		userRepo:     userRepo,
 		resetRepo:    resetRepo,
 		emailService: emailService,
 		tokenService: tokenService,
+		sessions:     sessions,
 	}
 }
 
@@ -103,11 +106,27 @@ func (u *passwordResetUsecase) ResetPassword(ctx context.Context, token string,
 		return err
 	}
 
-	_ = u.tokenService.RemoveRefreshToken(ctx, resetToken.UserID)
+	u.signOutEverywhere(ctx, resetToken.UserID)
 
 	return nil
 }
 
+// signOutEverywhere ends every session of the user, best-effort, so a reset
+// password also locks out devices that were signed in with the old one.
+func (u *passwordResetUsecase) signOutEverywhere(ctx context.Context, userID int64) {
+	if u.sessions == nil {
+		return
+	}
+	sessions, err := u.sessions.ListUserSessions(ctx, userID)
+	if err != nil {
+		return
+	}
+	for _, s := range sessions {
+		_ = endSessionTokens(ctx, u.tokenService, s.ID)
+	}
+	_ = u.sessions.RevokeAllSessions(ctx, userID, "")
+}
+
 func hashToken(token string) string {
 	h := sha256.Sum256([]byte(token))
 	return hex.EncodeToString(h[:])
@@ -0,0 +1,178 @@
+package usecase
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Prashant2307200/auth-service/internal/entity"
+	"github.com/Prashant2307200/auth-service/internal/infrastructure/repository"
+	"github.com/Prashant2307200/auth-service/internal/usecase/interfaces"
+	"github.com/Prashant2307200/auth-service/internal/utils"
+)
+
+var (
+	ErrInvalidPersonalAccessToken  = errors.New("invalid personal access token")
+	ErrPersonalAccessTokenNotFound = errors.New("personal access token not found")
+)
+
+const (
+	personalAccessTokenBytes           = 32
+	maxPersonalAccessTokens            = 50
+	maxPersonalAccessTokenName         = 100
+	defaultPersonalAccessTokenLifetime = 90 * 24 * time.Hour
+	maxPersonalAccessTokenLifetime     = 366 * 24 * time.Hour
+	// personalAccessTokenTouchInterval limits how often the last use is
+	// recorded, so scripts do not cause a write per request.
+	personalAccessTokenTouchInterval = time.Minute
+)
+
+// PersonalAccessTokenInput describes a personal access token to create.
+type PersonalAccessTokenInput struct {
+	Name   string
+	Scopes []string
+	// BusinessID binds the token to a business the user is a member of.
+	BusinessID *int64
+	// ExpiresAt defaults to 90 days from now and may be at most a year away.
+	ExpiresAt *time.Time
+}
+
+// PersonalAccessTokenUsecase manages the long-lived tokens users create to
+// script against the API, and authenticates requests made with them.
+type PersonalAccessTokenUsecase interface {
+	// Create returns the new token's record and the token itself, which is
+	// not stored and cannot be retrieved again.
+	Create(ctx context.Context, userID int64, in PersonalAccessTokenInput) (*entity.PersonalAccessToken, string, error)
+	List(ctx context.Context, userID int64) ([]*entity.PersonalAccessToken, error)
+	Revoke(ctx context.Context, userID, id int64) error
+	// Authenticate returns the record of a token, or
+	// ErrInvalidPersonalAccessToken if it is unknown, expired or bound to a
+	// business its user has left.
+	Authenticate(ctx context.Context, token string) (*entity.PersonalAccessToken, error)
+}
+
+type personalAccessTokenUsecase struct {
+	tokens     repository.PersonalAccessTokenRepository
+	businesses interfaces.BusinessRepo
+}
+
+func NewPersonalAccessTokenUsecase(tokens repository.PersonalAccessTokenRepository, businesses interfaces.BusinessRepo) PersonalAccessTokenUsecase {
+	return &personalAccessTokenUsecase{tokens: tokens, businesses: businesses}
+}
+
+func (u *personalAccessTokenUsecase) Create(ctx context.Context, userID int64, in PersonalAccessTokenInput) (*entity.PersonalAccessToken, string, error) {
+	name := strings.TrimSpace(in.Name)
+	if name == "" || len(name) > maxPersonalAccessTokenName {
+		return nil, "", utils.NewValidationError("name", fmt.Sprintf("must be 1 to %d characters", maxPersonalAccessTokenName))
+	}
+	if len(in.Scopes) == 0 {
+		return nil, "", utils.NewValidationError("scopes", "at least one scope is required")
+	}
+	var scopes []string
+	for _, s := range in.Scopes {
+		if !slices.Contains(entity.PersonalAccessTokenScopes, s) {
+			return nil, "", utils.NewValidationError("scopes", fmt.Sprintf("%q is not a valid scope", s))
+		}
+		if !slices.Contains(scopes, s) {
+			scopes = append(scopes, s)
+		}
+	}
+
+	if in.BusinessID != nil && (slices.Contains(scopes, entity.ScopeUsersRead) || slices.Contains(scopes, entity.ScopeUsersWrite)) {
+		return nil, "", utils.NewValidationError("scopes", "tokens bound to a business can only have business scopes")
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(defaultPersonalAccessTokenLifetime)
+	if in.ExpiresAt != nil {
+		expiresAt = *in.ExpiresAt
+		if !expiresAt.After(now) || expiresAt.After(now.Add(maxPersonalAccessTokenLifetime)) {
+			return nil, "", utils.NewValidationError("expires_at", "must be in the future and at most a year away")
+		}
+	}
+
+	if in.BusinessID != nil {
+		member, err := u.businesses.HasMembership(ctx, *in.BusinessID, userID)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to check business membership: %w", err)
+		}
+		if !member {
+			return nil, "", utils.NewValidationError("business_id", "you are not a member of this business")
+		}
+	}
+
+	count, err := u.tokens.CountByUser(ctx, userID)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to count personal access tokens: %w", err)
+	}
+	if count >= maxPersonalAccessTokens {
+		return nil, "", utils.NewValidationError("tokens", fmt.Sprintf("at most %d personal access tokens are allowed", maxPersonalAccessTokens))
+	}
+
+	secret, err := generateSecureToken(personalAccessTokenBytes)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to generate personal access token: %w", err)
+	}
+	token := entity.PersonalAccessTokenPrefix + secret
+	pat := &entity.PersonalAccessToken{
+		UserID:     userID,
+		Name:       name,
+		TokenHash:  hashToken(token),
+		Scopes:     scopes,
+		BusinessID: in.BusinessID,
+		ExpiresAt:  expiresAt,
+	}
+	if err := u.tokens.Create(ctx, pat); err != nil {
+		return nil, "", fmt.Errorf("failed to store personal access token: %w", err)
+	}
+	return pat, token, nil
+}
+
+func (u *personalAccessTokenUsecase) List(ctx context.Context, userID int64) ([]*entity.PersonalAccessToken, error) {
+	return u.tokens.ListByUser(ctx, userID)
+}
+
+func (u *personalAccessTokenUsecase) Revoke(ctx context.Context, userID, id int64) error {
+	err := u.tokens.Delete(ctx, userID, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrPersonalAccessTokenNotFound
+	}
+	return err
+}
+
+func (u *personalAccessTokenUsecase) Authenticate(ctx context.Context, token string) (*entity.PersonalAccessToken, error) {
+	if !strings.HasPrefix(token, entity.PersonalAccessTokenPrefix) {
+		return nil, ErrInvalidPersonalAccessToken
+	}
+	pat, err := u.tokens.GetByHash(ctx, hashToken(token))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvalidPersonalAccessToken
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load personal access token: %w", err)
+	}
+	if pat.Expired(time.Now()) {
+		return nil, ErrInvalidPersonalAccessToken
+	}
+	if pat.BusinessID != nil {
+		member, err := u.businesses.HasMembership(ctx, *pat.BusinessID, pat.UserID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check business membership: %w", err)
+		}
+		if !member {
+			return nil, ErrInvalidPersonalAccessToken
+		}
+	}
+
+	if pat.LastUsedAt == nil || time.Since(*pat.LastUsedAt) >= personalAccessTokenTouchInterval {
+		if err := u.tokens.TouchLastUsed(ctx, pat.ID); err != nil {
+			slog.Warn("Failed to record personal access token use", slog.Int64("token_id", pat.ID), slog.Any("error", err))
+		}
+	}
+	return pat, nil
+}
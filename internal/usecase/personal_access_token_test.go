@@ -0,0 +1,147 @@
+package usecase
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Prashant2307200/auth-service/internal/entity"
+	"github.com/Prashant2307200/auth-service/internal/infrastructure/repository"
+	"github.com/Prashant2307200/auth-service/internal/testutil"
+	"github.com/Prashant2307200/auth-service/internal/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type memPersonalAccessTokenRepo struct {
+	tokens  []*entity.PersonalAccessToken
+	touched int
+}
+
+func (r *memPersonalAccessTokenRepo) Create(_ context.Context, token *entity.PersonalAccessToken) error {
+	token.ID = int64(len(r.tokens) + 1)
+	token.CreatedAt = time.Now()
+	r.tokens = append(r.tokens, token)
+	return nil
+}
+
+func (r *memPersonalAccessTokenRepo) GetByHash(_ context.Context, tokenHash string) (*entity.PersonalAccessToken, error) {
+	for _, t := range r.tokens {
+		if t.TokenHash == tokenHash {
+			return t, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (r *memPersonalAccessTokenRepo) ListByUser(_ context.Context, userID int64) ([]*entity.PersonalAccessToken, error) {
+	var out []*entity.PersonalAccessToken
+	for _, t := range r.tokens {
+		if t.UserID == userID {
+			out = append(out, t)
+		}
+	}
+	return out, nil
+}
+
+func (r *memPersonalAccessTokenRepo) CountByUser(ctx context.Context, userID int64) (int, error) {
+	tokens, _ := r.ListByUser(ctx, userID)
+	return len(tokens), nil
+}
+
+func (r *memPersonalAccessTokenRepo) TouchLastUsed(_ context.Context, id int64) error {
+	now := time.Now()
+	r.tokens[id-1].LastUsedAt = &now
+	r.touched++
+	return nil
+}
+
+func (r *memPersonalAccessTokenRepo) Delete(_ context.Context, userID, id int64) error {
+	for i, t := range r.tokens {
+		if t.ID == id && t.UserID == userID {
+			r.tokens = append(r.tokens[:i], r.tokens[i+1:]...)
+			return nil
+		}
+	}
+	return sql.ErrNoRows
+}
+
+var _ repository.PersonalAccessTokenRepository = (*memPersonalAccessTokenRepo)(nil)
+
+func TestPersonalAccessToken_CreateAndAuthenticate(t *testing.T) {
+	ctx := context.Background()
+	repo := &memPersonalAccessTokenRepo{}
+	uc := NewPersonalAccessTokenUsecase(repo, nil)
+
+	pat, token, err := uc.Create(ctx, 7, PersonalAccessTokenInput{Name: " deploy ", Scopes: []string{"users:read", "users:read"}})
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(token, "pat_"))
+	assert.Equal(t, "deploy", pat.Name)
+	assert.Equal(t, []string{"users:read"}, pat.Scopes)
+	assert.NotContains(t, pat.TokenHash, token[len("pat_"):], "only the hash is stored")
+	assert.WithinDuration(t, time.Now().Add(90*24*time.Hour), pat.ExpiresAt, time.Minute)
+
+	got, err := uc.Authenticate(ctx, token)
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), got.UserID)
+	require.NotNil(t, got.LastUsedAt)
+	// Uses within a minute of the last are not recorded again.
+	_, err = uc.Authenticate(ctx, token)
+	require.NoError(t, err)
+	assert.Equal(t, 1, repo.touched)
+
+	for _, bad := range []string{"", "pat_unknown", strings.TrimPrefix(token, "pat_")} {
+		_, err = uc.Authenticate(ctx, bad)
+		assert.ErrorIs(t, err, ErrInvalidPersonalAccessToken, bad)
+	}
+	repo.tokens[0].ExpiresAt = time.Now().Add(-time.Second)
+	_, err = uc.Authenticate(ctx, token)
+	assert.ErrorIs(t, err, ErrInvalidPersonalAccessToken)
+
+	assert.ErrorIs(t, uc.Revoke(ctx, 8, pat.ID), ErrPersonalAccessTokenNotFound)
+	require.NoError(t, uc.Revoke(ctx, 7, pat.ID))
+	_, err = uc.Authenticate(ctx, token)
+	assert.ErrorIs(t, err, ErrInvalidPersonalAccessToken)
+}
+
+func TestPersonalAccessToken_CreateValidates(t *testing.T) {
+	ctx := context.Background()
+	businesses := new(testutil.MockBusinessRepo)
+	businesses.On("HasMembership", mock.Anything, int64(3), int64(7)).Return(false, nil)
+	uc := NewPersonalAccessTokenUsecase(&memPersonalAccessTokenRepo{}, businesses)
+	past, tooFar := time.Now().Add(-time.Hour), time.Now().Add(400*24*time.Hour)
+	business := int64(3)
+
+	for _, in := range []PersonalAccessTokenInput{
+		{Name: "", Scopes: []string{"users:read"}},
+		{Name: "ci"},
+		{Name: "ci", Scopes: []string{"admin"}},
+		{Name: "ci", Scopes: []string{"users:read"}, ExpiresAt: &past},
+		{Name: "ci", Scopes: []string{"users:read"}, ExpiresAt: &tooFar},
+		{Name: "ci", Scopes: []string{"users:read"}, BusinessID: &business},
+		{Name: "ci", Scopes: []string{"business:read"}, BusinessID: &business},
+	} {
+		_, _, err := uc.Create(ctx, 7, in)
+		assert.ErrorIs(t, err, utils.ErrInvalidInput, "%+v", in)
+	}
+}
+
+func TestPersonalAccessToken_BusinessBinding(t *testing.T) {
+	ctx := context.Background()
+	businesses := new(testutil.MockBusinessRepo)
+	businesses.On("HasMembership", mock.Anything, int64(3), int64(7)).Return(true, nil).Twice()
+	businesses.On("HasMembership", mock.Anything, int64(3), int64(7)).Return(false, nil)
+	uc := NewPersonalAccessTokenUsecase(&memPersonalAccessTokenRepo{}, businesses)
+	business := int64(3)
+
+	_, token, err := uc.Create(ctx, 7, PersonalAccessTokenInput{Name: "ci", Scopes: []string{"business:read"}, BusinessID: &business})
+	require.NoError(t, err)
+	_, err = uc.Authenticate(ctx, token)
+	require.NoError(t, err)
+	// The user has since left the business.
+	_, err = uc.Authenticate(ctx, token)
+	assert.ErrorIs(t, err, ErrInvalidPersonalAccessToken)
+}
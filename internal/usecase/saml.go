@@ -0,0 +1,566 @@
+package usecase
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/x509"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Prashant2307200/auth-service/internal/entity"
+	"github.com/Prashant2307200/auth-service/internal/infrastructure/repository"
+	"github.com/Prashant2307200/auth-service/internal/usecase/interfaces"
+	"github.com/Prashant2307200/auth-service/pkg/saml"
+)
+
+var (
+	ErrSAMLNotConfigured = errors.New("saml sign-in is not configured for this business")
+	ErrSAMLNotAllowed    = errors.New("not allowed to manage saml sign-in")
+	ErrSAMLInvalidConfig = errors.New("invalid saml configuration")
+	ErrSAMLAuthFailed    = errors.New("saml authentication failed")
+	// ErrSAMLDomainNotVerified is returned when the identity provider asserts
+	// an email outside the business's verified domains, which it has no
+	// authority over.
+	ErrSAMLDomainNotVerified = errors.New("email domain is not verified for this business")
+)
+
+// SAMLServiceProvider is this service's side of every SAML connection: the
+// key pair it signs with and the public base URL of the API.
+type SAMLServiceProvider struct {
+	BaseURL     string
+	Key         *rsa.PrivateKey
+	Certificate *x509.Certificate
+}
+
+// SAMLEndpoints are the service provider URLs a business registers with its
+// identity provider.
+type SAMLEndpoints struct {
+	EntityID    string
+	MetadataURL string
+	ACSURL      string
+	SLOURL      string
+}
+
+type SAMLUsecase interface {
+	// Endpoints returns the service provider URLs of businessID.
+	Endpoints(businessID int64) SAMLEndpoints
+	// Metadata returns the service provider metadata of businessID.
+	Metadata(ctx context.Context, businessID int64) ([]byte, error)
+
+	// Configure creates or replaces the business's connection. When metadata
+	// is set, the identity provider fields are read from it.
+	Configure(ctx context.Context, requesterID, businessID int64, conn *entity.SAMLConnection, metadata []byte) (*entity.SAMLConnection, error)
+	GetConnection(ctx context.Context, requesterID, businessID int64) (*entity.SAMLConnection, error)
+	DeleteConnection(ctx context.Context, requesterID, businessID int64) error
+
+	// BeginLogin returns the identity provider URL that signs a user in to
+	// businessID, and the ID of its AuthnRequest, which the browser must
+	// present with the Response.
+	BeginLogin(ctx context.Context, businessID int64) (authURL, requestID string, err error)
+	// BeginLoginForEmail is BeginLogin for the business that verified the
+	// email's domain.
+	BeginLoginForEmail(ctx context.Context, email string) (authURL, requestID string, err error)
+	// BusinessForEmail returns the business whose enabled connection signs in
+	// the email's domain, or ErrSAMLNotConfigured.
+	BusinessForEmail(ctx context.Context, email string) (int64, error)
+	// HandleResponse signs in the user of a Response posted to businessID's
+	// assertion consumer service, provisioning them on first sign-in. The
+	// Response must answer requestID, the request the posting browser began,
+	// so nobody can sign a victim in to the attacker's account. It returns a
+	// *MFARequiredError instead of tokens when the account has MFA enabled.
+	HandleResponse(ctx context.Context, businessID int64, samlResponse, requestID string) (accessToken, refreshToken string, user *entity.User, isNewUser bool, err error)
+
+	// Logout ends the session of refreshToken and returns the identity
+	// provider URL that ends the user's session there too, or "" when there
+	// is none.
+	Logout(ctx context.Context, userID, businessID int64, refreshToken string) (string, error)
+	// SingleLogout handles a message the identity provider sent to the
+	// single logout service. A LogoutRequest ends all of the user's sessions
+	// and returns the URL of the LogoutResponse to send the browser to; a
+	// LogoutResponse completes Logout and returns "".
+	SingleLogout(ctx context.Context, businessID int64, rawQuery string) (string, error)
+}
+
+type samlUsecase struct {
+	sp           SAMLServiceProvider
+	connections  repository.SAMLConnectionRepository
+	requests     interfaces.SAMLRequestStore
+	businessRepo interfaces.BusinessRepo
+	userRepo     interfaces.UserRepo
+	identities   repository.UserIdentityRepository
+	tokenService interfaces.TokenService
+	sessions     interfaces.SessionService
+	audits       repository.AuditRepository
+	mfaGate      *MFAGate
+	auditor      *UserAuditor
+	authz        *Authorizer
+}
+
+// NewSAMLUsecase builds SAML sign-in for businesses. sessions may be nil to
+// leave SAML logins unrecorded, audits nil to leave configuration changes
+// unaudited and mfaGate nil to skip the second factor. authz may be nil to
+// give members their system role's permissions.
+func NewSAMLUsecase(sp SAMLServiceProvider, connections repository.SAMLConnectionRepository, requests interfaces.SAMLRequestStore, businessRepo interfaces.BusinessRepo, userRepo interfaces.UserRepo, identities repository.UserIdentityRepository, tokenService interfaces.TokenService, sessions interfaces.SessionService, audits repository.AuditRepository, mfaGate *MFAGate, authz *Authorizer) SAMLUsecase {
+	sp.BaseURL = strings.TrimSuffix(sp.BaseURL, "/")
+	if authz == nil {
+		authz = NewAuthorizer(businessRepo, nil)
+	}
+	return &samlUsecase{
+		sp:           sp,
+		connections:  connections,
+		requests:     requests,
+		businessRepo: businessRepo,
+		userRepo:     userRepo,
+		identities:   identities,
+		tokenService: tokenService,
+		sessions:     sessions,
+		audits:       audits,
+		mfaGate:      mfaGate,
+		auditor:      NewUserAuditor(audits, businessRepo),
+		authz:        authz,
+	}
+}
+
+func (u *samlUsecase) Endpoints(businessID int64) SAMLEndpoints {
+	base := u.sp.BaseURL + "/api/v1/auth/saml/" + strconv.FormatInt(businessID, 10)
+	return SAMLEndpoints{
+		EntityID:    base + "/metadata",
+		MetadataURL: base + "/metadata",
+		ACSURL:      base + "/acs",
+		SLOURL:      base + "/slo",
+	}
+}
+
+// serviceProvider returns the service provider of businessID talking to
+// conn's identity provider; conn may be nil for metadata.
+func (u *samlUsecase) serviceProvider(businessID int64, conn *entity.SAMLConnection) (*saml.ServiceProvider, error) {
+	endpoints := u.Endpoints(businessID)
+	sp := &saml.ServiceProvider{
+		EntityID:    endpoints.EntityID,
+		ACSURL:      endpoints.ACSURL,
+		SLOURL:      endpoints.SLOURL,
+		Key:         u.sp.Key,
+		Certificate: u.sp.Certificate,
+	}
+	if conn != nil {
+		certs, err := saml.ParseCertificates(conn.IdPCertificate)
+		if err != nil {
+			return nil, fmt.Errorf("invalid identity provider certificate: %w", err)
+		}
+		sp.IdP = saml.IdentityProvider{
+			EntityID:     conn.IdPEntityID,
+			SSOURL:       conn.IdPSSOURL,
+			SLOURL:       conn.IdPSLOURL,
+			Certificates: certs,
+		}
+	}
+	return sp, nil
+}
+
+func (u *samlUsecase) Metadata(ctx context.Context, businessID int64) ([]byte, error) {
+	if _, err := u.businessRepo.GetById(ctx, businessID); err != nil {
+		return nil, ErrSAMLNotConfigured
+	}
+	sp, err := u.serviceProvider(businessID, nil)
+	if err != nil {
+		return nil, err
+	}
+	return sp.Metadata(), nil
+}
+
+func (u *samlUsecase) requireAdmin(ctx context.Context, requesterID, businessID int64) error {
+	err := u.authz.Authorize(ctx, requesterID, businessID, entity.PermissionSSOManage)
+	if errors.Is(err, ErrPermissionDenied) {
+		return ErrSAMLNotAllowed
+	}
+	return err
+}
+
+func (u *samlUsecase) Configure(ctx context.Context, requesterID, businessID int64, conn *entity.SAMLConnection, metadata []byte) (*entity.SAMLConnection, error) {
+	if err := u.requireAdmin(ctx, requesterID, businessID); err != nil {
+		return nil, err
+	}
+	if len(metadata) > 0 {
+		idp, err := saml.ParseIdPMetadata(metadata)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrSAMLInvalidConfig, err)
+		}
+		conn.IdPEntityID, conn.IdPSSOURL, conn.IdPSLOURL = idp.EntityID, idp.SSOURL, idp.SLOURL
+		conn.IdPCertificate = saml.EncodeCertificates(idp.Certificates)
+	}
+	if err := validateSAMLConnection(conn); err != nil {
+		return nil, err
+	}
+
+	conn.BusinessID = businessID
+	if err := u.connections.Save(ctx, conn); err != nil {
+		return nil, fmt.Errorf("failed to save saml connection: %w", err)
+	}
+	u.audit(ctx, requesterID, businessID, entity.AuditActionBusinessSAMLConfigured, &conn.ID, map[string]interface{}{
+		"idp_entity_id": conn.IdPEntityID,
+		"enabled":       conn.Enabled,
+	})
+	return conn, nil
+}
+
+func validateSAMLConnection(conn *entity.SAMLConnection) error {
+	if conn.IdPEntityID == "" {
+		return fmt.Errorf("%w: identity provider entity ID is required", ErrSAMLInvalidConfig)
+	}
+	if !isAbsoluteURL(conn.IdPSSOURL) {
+		return fmt.Errorf("%w: identity provider SSO URL must be an absolute http(s) URL", ErrSAMLInvalidConfig)
+	}
+	if conn.IdPSLOURL != "" && !isAbsoluteURL(conn.IdPSLOURL) {
+		return fmt.Errorf("%w: identity provider SLO URL must be an absolute http(s) URL", ErrSAMLInvalidConfig)
+	}
+	if _, err := saml.ParseCertificates(conn.IdPCertificate); err != nil {
+		return fmt.Errorf("%w: %v", ErrSAMLInvalidConfig, err)
+	}
+	// Owners are only made by hand; an identity provider cannot mint them.
+	if conn.DefaultRole < BusinessRoleMember || conn.DefaultRole > BusinessRoleAdmin {
+		return fmt.Errorf("%w: default role must be member or admin", ErrSAMLInvalidConfig)
+	}
+	return nil
+}
+
+func isAbsoluteURL(raw string) bool {
+	u, err := url.Parse(raw)
+	return err == nil && (u.Scheme == "https" || u.Scheme == "http") && u.Host != ""
+}
+
+func (u *samlUsecase) GetConnection(ctx context.Context, requesterID, businessID int64) (*entity.SAMLConnection, error) {
+	if err := u.requireAdmin(ctx, requesterID, businessID); err != nil {
+		return nil, err
+	}
+	conn, err := u.connections.GetByBusiness(ctx, businessID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrSAMLNotConfigured
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load saml connection: %w", err)
+	}
+	return conn, nil
+}
+
+func (u *samlUsecase) DeleteConnection(ctx context.Context, requesterID, businessID int64) error {
+	if err := u.requireAdmin(ctx, requesterID, businessID); err != nil {
+		return err
+	}
+	err := u.connections.Delete(ctx, businessID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrSAMLNotConfigured
+	}
+	if err != nil {
+		return fmt.Errorf("failed to delete saml connection: %w", err)
+	}
+	u.audit(ctx, requesterID, businessID, entity.AuditActionBusinessSAMLDeleted, nil, nil)
+	return nil
+}
+
+// audit logs a change to a business's connection. Failures are logged, not
+// returned: the change has already happened.
+func (u *samlUsecase) audit(ctx context.Context, userID, businessID int64, action string, entityID *int64, values map[string]interface{}) {
+	if u.audits == nil {
+		return
+	}
+	client := ClientInfoFrom(ctx)
+	err := u.audits.Log(ctx, &entity.AuditLog{
+		BusinessID: businessID,
+		UserID:     userID,
+		Action:     action,
+		EntityType: "saml_connection",
+		EntityID:   entityID,
+		NewValues:  values,
+		IPAddress:  client.IPAddress,
+		UserAgent:  client.UserAgent,
+		CreatedAt:  time.Now(),
+	})
+	if err != nil {
+		slog.Error("Failed to write audit log", slog.Int64("business_id", businessID), slog.String("action", action), slog.Any("error", err))
+	}
+}
+
+// enabledConnection returns businessID's connection if sign-in through it
+// is enabled.
+func (u *samlUsecase) enabledConnection(ctx context.Context, businessID int64) (*entity.SAMLConnection, error) {
+	conn, err := u.connections.GetByBusiness(ctx, businessID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrSAMLNotConfigured
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load saml connection: %w", err)
+	}
+	if !conn.Enabled {
+		return nil, ErrSAMLNotConfigured
+	}
+	return conn, nil
+}
+
+func (u *samlUsecase) BeginLogin(ctx context.Context, businessID int64) (string, string, error) {
+	conn, err := u.enabledConnection(ctx, businessID)
+	if err != nil {
+		return "", "", err
+	}
+	return u.beginLogin(ctx, conn)
+}
+
+func (u *samlUsecase) BeginLoginForEmail(ctx context.Context, email string) (string, string, error) {
+	conn, err := u.connectionForEmail(ctx, email)
+	if err != nil {
+		return "", "", err
+	}
+	return u.beginLogin(ctx, conn)
+}
+
+func (u *samlUsecase) BusinessForEmail(ctx context.Context, email string) (int64, error) {
+	conn, err := u.connectionForEmail(ctx, email)
+	if err != nil {
+		return 0, err
+	}
+	return conn.BusinessID, nil
+}
+
+func (u *samlUsecase) connectionForEmail(ctx context.Context, email string) (*entity.SAMLConnection, error) {
+	_, domain, ok := strings.Cut(email, "@")
+	if !ok || domain == "" {
+		return nil, ErrSAMLNotConfigured
+	}
+	conn, err := u.connections.FindByEmailDomain(ctx, domain)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrSAMLNotConfigured
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find saml connection: %w", err)
+	}
+	return conn, nil
+}
+
+func (u *samlUsecase) beginLogin(ctx context.Context, conn *entity.SAMLConnection) (string, string, error) {
+	sp, err := u.serviceProvider(conn.BusinessID, conn)
+	if err != nil {
+		return "", "", err
+	}
+	id, err := saml.NewID()
+	if err != nil {
+		return "", "", err
+	}
+	if err := u.requests.Save(ctx, id, &entity.SAMLRequest{BusinessID: conn.BusinessID}, SSOLoginTTL); err != nil {
+		return "", "", err
+	}
+	authURL, err := sp.AuthnRequestURL(id, "", time.Now())
+	if err != nil {
+		return "", "", err
+	}
+	return authURL, id, nil
+}
+
+func (u *samlUsecase) HandleResponse(ctx context.Context, businessID int64, samlResponse, requestID string) (string, string, *entity.User, bool, error) {
+	conn, err := u.enabledConnection(ctx, businessID)
+	if err != nil {
+		return "", "", nil, false, err
+	}
+	sp, err := u.serviceProvider(businessID, conn)
+	if err != nil {
+		return "", "", nil, false, err
+	}
+	assertion, err := sp.ParseResponse(samlResponse, time.Now())
+	if err != nil {
+		return "", "", nil, false, fmt.Errorf("%w: %v", ErrSAMLAuthFailed, err)
+	}
+	// A Response started in another browser, such as the attacker's own
+	// sign-in replayed at a victim, is refused.
+	if requestID == "" || assertion.InResponseTo != requestID {
+		return "", "", nil, false, fmt.Errorf("%w: response does not answer this browser's request", ErrSAMLAuthFailed)
+	}
+	// Only answers to requests this service sent are accepted, each once, and
+	// only at the business that sent it.
+	req, err := u.requests.Take(ctx, assertion.InResponseTo)
+	if err != nil || req.BusinessID != businessID {
+		return "", "", nil, false, fmt.Errorf("%w: unknown or replayed request", ErrSAMLAuthFailed)
+	}
+
+	provider := entity.SAMLIdentityProvider(businessID)
+	identity, err := u.identities.GetByProviderSubject(ctx, provider, assertion.NameID)
+	if err == nil {
+		user, err := u.userRepo.GetById(ctx, identity.UserID)
+		if err != nil {
+			return "", "", nil, false, fmt.Errorf("failed to load linked user: %w", err)
+		}
+		if err := u.identities.TouchLastUsed(ctx, identity.ID); err != nil {
+			slog.Warn("Failed to record identity use", slog.Int64("identity_id", identity.ID), slog.Any("error", err))
+		}
+		return u.signIn(ctx, user, conn)
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return "", "", nil, false, fmt.Errorf("failed to look up identity: %w", err)
+	}
+
+	email := assertion.NameID
+	if conn.EmailAttribute != "" {
+		email = assertion.Attribute(conn.EmailAttribute)
+	}
+	email = strings.TrimSpace(email)
+	_, domain, ok := strings.Cut(email, "@")
+	if !ok || domain == "" {
+		return "", "", nil, false, ErrSSOEmailMissing
+	}
+	// The identity provider speaks for the business, which has only proven
+	// control of its verified domains.
+	verified, err := u.businessRepo.GetDomain(ctx, businessID, strings.ToLower(domain))
+	if err != nil || !verified.Verified {
+		return "", "", nil, false, ErrSAMLDomainNotVerified
+	}
+	external := &entity.ExternalIdentity{Provider: provider, Subject: assertion.NameID, Email: email, EmailVerified: true}
+
+	user, err := u.userRepo.GetByEmail(ctx, email)
+	if err == nil {
+		// As with social sign-in, an account whose email is unverified may
+		// have been registered by someone else ahead of the employee, who
+		// would keep its password or passkeys once it is linked.
+		if !user.EmailVerified {
+			return "", "", nil, false, ErrSSOAccountExists
+		}
+		if _, err := u.link(ctx, user.ID, external, "sign_in"); err != nil {
+			return "", "", nil, false, err
+		}
+		return u.signIn(ctx, user, conn)
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return "", "", nil, false, fmt.Errorf("failed to check existing user: %w", err)
+	}
+
+	username := assertion.Attribute(conn.UsernameAttribute)
+	if conn.UsernameAttribute == "" || username == "" {
+		username = generateUsernameFromEmail(email)
+	}
+	newUser := &entity.User{Username: username, Email: email, Role: entity.RoleUser}
+	userID, err := u.userRepo.Create(ctx, newUser)
+	if err != nil {
+		return "", "", nil, false, fmt.Errorf("failed to create user: %w", err)
+	}
+	newUser.ID = userID
+	if err := u.userRepo.MarkEmailVerified(ctx, userID); err != nil {
+		slog.Warn("Failed to mark email verified", slog.Int64("user_id", userID), slog.Any("error", err))
+	} else {
+		now := time.Now()
+		newUser.EmailVerified, newUser.EmailVerifiedAt = true, &now
+	}
+	// Joining first makes the link's audit event land in the business.
+	if err := u.businessRepo.AddUserIfNotExists(ctx, businessID, userID, conn.DefaultRole); err != nil {
+		return "", "", nil, false, fmt.Errorf("failed to add user to business: %w", err)
+	}
+	if _, err := u.link(ctx, userID, external, "sign_up"); err != nil {
+		return "", "", nil, false, err
+	}
+
+	accessToken, refreshToken, err := issueSessionTokens(ctx, u.tokenService, u.sessions, userID)
+	return accessToken, refreshToken, newUser, true, err
+}
+
+// link records external as userID's and audits it; via says how the link
+// was made.
+func (u *samlUsecase) link(ctx context.Context, userID int64, external *entity.ExternalIdentity, via string) (*entity.UserIdentity, error) {
+	identity := &entity.UserIdentity{
+		UserID:   userID,
+		Provider: external.Provider,
+		Subject:  external.Subject,
+		Email:    external.Email,
+	}
+	if err := u.identities.Create(ctx, identity); err != nil {
+		return nil, fmt.Errorf("failed to link saml identity: %w", err)
+	}
+	u.auditor.Record(ctx, userID, entity.AuditActionUserIdentityLinked, "user_identity", &identity.ID,
+		map[string]interface{}{"provider": identity.Provider, "email": identity.Email, "via": via})
+	return identity, nil
+}
+
+// signIn issues tokens for an existing user once any second factor is met,
+// making sure they belong to the business first.
+func (u *samlUsecase) signIn(ctx context.Context, user *entity.User, conn *entity.SAMLConnection) (string, string, *entity.User, bool, error) {
+	if err := u.businessRepo.AddUserIfNotExists(ctx, conn.BusinessID, user.ID, conn.DefaultRole); err != nil {
+		return "", "", nil, false, fmt.Errorf("failed to add user to business: %w", err)
+	}
+	if err := u.mfaGate.Require(ctx, user.ID, entity.SAMLIdentityProvider(conn.BusinessID)); err != nil {
+		return "", "", user, false, err
+	}
+	accessToken, refreshToken, err := issueSessionTokens(ctx, u.tokenService, u.sessions, user.ID)
+	return accessToken, refreshToken, user, false, err
+}
+
+func (u *samlUsecase) Logout(ctx context.Context, userID, businessID int64, refreshToken string) (string, error) {
+	if err := endRefreshTokenSession(ctx, u.tokenService, u.sessions, userID, refreshToken); err != nil {
+		return "", err
+	}
+
+	conn, err := u.enabledConnection(ctx, businessID)
+	if err != nil || conn.IdPSLOURL == "" {
+		return "", nil
+	}
+	identities, err := u.identities.ListByUser(ctx, userID)
+	if err != nil {
+		return "", fmt.Errorf("failed to list identities: %w", err)
+	}
+	provider := entity.SAMLIdentityProvider(businessID)
+	for _, identity := range identities {
+		if identity.Provider != provider {
+			continue
+		}
+		sp, err := u.serviceProvider(businessID, conn)
+		if err != nil {
+			return "", err
+		}
+		id, err := saml.NewID()
+		if err != nil {
+			return "", err
+		}
+		return sp.LogoutRequestURL(id, identity.Subject, "", "", time.Now())
+	}
+	return "", nil
+}
+
+func (u *samlUsecase) SingleLogout(ctx context.Context, businessID int64, rawQuery string) (string, error) {
+	conn, err := u.enabledConnection(ctx, businessID)
+	if err != nil {
+		return "", err
+	}
+	sp, err := u.serviceProvider(businessID, conn)
+	if err != nil {
+		return "", err
+	}
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrSAMLAuthFailed, err)
+	}
+
+	if !query.Has("SAMLRequest") {
+		if _, err := sp.ParseLogoutResponse(rawQuery); err != nil {
+			return "", fmt.Errorf("%w: %v", ErrSAMLAuthFailed, err)
+		}
+		return "", nil
+	}
+
+	req, err := sp.ParseLogoutRequest(rawQuery, time.Now())
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrSAMLAuthFailed, err)
+	}
+	identity, err := u.identities.GetByProviderSubject(ctx, entity.SAMLIdentityProvider(businessID), req.NameID)
+	switch {
+	case err == nil:
+		// Sessions do not record how they signed in, so the user is signed
+		// out everywhere.
+		if u.sessions != nil {
+			if err := endOtherSessions(ctx, u.tokenService, u.sessions, identity.UserID, ""); err != nil {
+				return "", fmt.Errorf("failed to end sessions: %w", err)
+			}
+		}
+	case !errors.Is(err, sql.ErrNoRows):
+		return "", fmt.Errorf("failed to look up identity: %w", err)
+	}
+	return sp.LogoutResponseURL(req, time.Now())
+}
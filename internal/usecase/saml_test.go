@@ -0,0 +1,402 @@
+package usecase
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"database/sql"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Prashant2307200/auth-service/internal/entity"
+	"github.com/Prashant2307200/auth-service/internal/infrastructure/repository"
+	"github.com/Prashant2307200/auth-service/internal/testutil"
+	"github.com/Prashant2307200/auth-service/internal/usecase/interfaces"
+	"github.com/Prashant2307200/auth-service/pkg/saml"
+	"github.com/Prashant2307200/auth-service/pkg/saml/samltest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type memSAMLConnectionRepo struct {
+	conns   map[int64]*entity.SAMLConnection
+	domains map[string]int64
+}
+
+func (r *memSAMLConnectionRepo) Save(_ context.Context, conn *entity.SAMLConnection) error {
+	conn.ID = conn.BusinessID
+	r.conns[conn.BusinessID] = conn
+	return nil
+}
+
+func (r *memSAMLConnectionRepo) GetByBusiness(_ context.Context, businessID int64) (*entity.SAMLConnection, error) {
+	if conn, ok := r.conns[businessID]; ok {
+		return conn, nil
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (r *memSAMLConnectionRepo) FindByEmailDomain(_ context.Context, domain string) (*entity.SAMLConnection, error) {
+	if conn, ok := r.conns[r.domains[domain]]; ok && conn.Enabled {
+		return conn, nil
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (r *memSAMLConnectionRepo) Delete(_ context.Context, businessID int64) error {
+	if _, ok := r.conns[businessID]; !ok {
+		return sql.ErrNoRows
+	}
+	delete(r.conns, businessID)
+	return nil
+}
+
+var _ repository.SAMLConnectionRepository = (*memSAMLConnectionRepo)(nil)
+
+type memSAMLRequestStore map[string]*entity.SAMLRequest
+
+func (s memSAMLRequestStore) Save(_ context.Context, id string, req *entity.SAMLRequest, _ time.Duration) error {
+	s[id] = req
+	return nil
+}
+
+func (s memSAMLRequestStore) Take(_ context.Context, id string) (*entity.SAMLRequest, error) {
+	req, ok := s[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	delete(s, id)
+	return req, nil
+}
+
+type samlTestEnv struct {
+	idp        *samltest.IdP
+	conns      *memSAMLConnectionRepo
+	users      *testutil.MockUserRepo
+	businesses *testutil.MockBusinessRepo
+	identities *memUserIdentityRepo
+	sessions   *testutil.MockSessionService
+	tokens     *testutil.MockTokenService
+	audits     *testutil.MockAuditRepo
+	uc         SAMLUsecase
+}
+
+// newSAMLTestEnv connects business 1, which verified example.com, to a
+// local identity provider.
+func newSAMLTestEnv(t *testing.T) *samlTestEnv {
+	t.Helper()
+	idp, err := samltest.New("https://idp.example.com")
+	require.NoError(t, err)
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	cert, err := saml.NewCertificate(key, "sp", time.Hour)
+	require.NoError(t, err)
+
+	env := &samlTestEnv{
+		idp:        idp,
+		conns:      &memSAMLConnectionRepo{conns: map[int64]*entity.SAMLConnection{}, domains: map[string]int64{"example.com": 1}},
+		users:      new(testutil.MockUserRepo),
+		businesses: new(testutil.MockBusinessRepo),
+		identities: &memUserIdentityRepo{},
+		sessions:   new(testutil.MockSessionService),
+		tokens:     new(testutil.MockTokenService),
+		audits:     new(testutil.MockAuditRepo),
+	}
+	env.conns.conns[1] = &entity.SAMLConnection{
+		ID: 1, BusinessID: 1, Enabled: true,
+		IdPEntityID: idp.EntityID, IdPSSOURL: idp.SSOURL, IdPSLOURL: idp.SLOURL, IdPCertificate: idp.CertificatePEM(),
+		EmailAttribute: "email",
+	}
+	env.tokens.On("GenerateRefreshToken", mock.Anything, mock.AnythingOfType("string")).Return("refresh", nil)
+	env.tokens.On("StoreRefreshToken", mock.Anything, mock.AnythingOfType("string"), "refresh").Return(nil)
+	env.tokens.On("GenerateAccessTokenForSession", mock.Anything, mock.AnythingOfType("string")).Return("access", nil)
+	env.sessions.On("CreateSession", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(&entity.UserSession{ID: "sess-new"}, nil)
+	env.businesses.On("GetDomain", mock.Anything, int64(1), "example.com").Return(&entity.BusinessDomain{BusinessID: 1, Domain: "example.com", Verified: true}, nil)
+	env.businesses.On("GetDomain", mock.Anything, mock.Anything, mock.Anything).Return(nil, sql.ErrNoRows)
+	env.businesses.On("GetUserBusinesses", mock.Anything, mock.Anything).Return([]*entity.Business{{ID: 1}}, nil)
+	env.audits.On("Log", mock.Anything, mock.Anything).Return(nil)
+
+	sp := SAMLServiceProvider{BaseURL: "https://auth.example.com/", Key: key, Certificate: cert}
+	env.uc = NewSAMLUsecase(sp, env.conns, memSAMLRequestStore{}, env.businesses, env.users, env.identities, env.tokens, env.sessions, env.audits, nil, nil)
+	return env
+}
+
+// respond starts a login at business 1 and returns the identity provider's
+// answer for nameID with attrs, and the ID of the request it answers.
+func (env *samlTestEnv) respond(t *testing.T, nameID string, attrs map[string][]string) (string, string) {
+	t.Helper()
+	authURL, requestID, err := env.uc.BeginLogin(context.Background(), 1)
+	require.NoError(t, err)
+	req, err := samltest.ParseAuthnRequestURL(authURL)
+	require.NoError(t, err)
+	require.True(t, req.Signed)
+	require.Equal(t, req.ID, requestID)
+
+	encoded, err := env.idp.Response(samltest.ResponseOptions{
+		Audience:     req.Issuer,
+		ACSURL:       req.ACSURL,
+		InResponseTo: req.ID,
+		NameID:       nameID,
+		Attributes:   attrs,
+		SignResponse: true,
+	})
+	require.NoError(t, err)
+	return encoded, requestID
+}
+
+func TestSAML_Endpoints(t *testing.T) {
+	env := newSAMLTestEnv(t)
+	endpoints := env.uc.Endpoints(7)
+	assert.Equal(t, "https://auth.example.com/api/v1/auth/saml/7/metadata", endpoints.EntityID)
+	assert.Equal(t, "https://auth.example.com/api/v1/auth/saml/7/acs", endpoints.ACSURL)
+	assert.Equal(t, "https://auth.example.com/api/v1/auth/saml/7/slo", endpoints.SLOURL)
+
+	env.businesses.On("GetById", mock.Anything, int64(7)).Return(&entity.Business{ID: 7}, nil)
+	md, err := env.uc.Metadata(context.Background(), 7)
+	require.NoError(t, err)
+	assert.Contains(t, string(md), `Location="`+endpoints.ACSURL+`"`)
+}
+
+func TestSAML_HandleResponse_ProvisionsUser(t *testing.T) {
+	ctx := context.Background()
+	env := newSAMLTestEnv(t)
+	env.conns.conns[1].UsernameAttribute = "uid"
+	env.conns.conns[1].DefaultRole = BusinessRoleAdmin
+
+	env.users.On("GetByEmail", ctx, "ada@example.com").Return(nil, sql.ErrNoRows)
+	env.users.On("Create", ctx, mock.MatchedBy(func(u *entity.User) bool { return u.Email == "ada@example.com" && u.Username == "ada.l" })).Return(int64(9), nil)
+	env.users.On("MarkEmailVerified", ctx, int64(9)).Return(nil)
+	env.businesses.On("AddUserIfNotExists", ctx, int64(1), int64(9), BusinessRoleAdmin).Return(nil)
+
+	encoded, requestID := env.respond(t, "emp-1", map[string][]string{"email": {"ada@example.com"}, "uid": {"ada.l"}})
+	access, refresh, user, isNew, err := env.uc.HandleResponse(ctx, 1, encoded, requestID)
+	require.NoError(t, err)
+	assert.Equal(t, "access", access)
+	assert.Equal(t, "refresh", refresh)
+	assert.True(t, isNew)
+	assert.True(t, user.EmailVerified)
+
+	require.Len(t, env.identities.identities, 1)
+	assert.Equal(t, "saml:1", env.identities.identities[0].Provider)
+	assert.Equal(t, "emp-1", env.identities.identities[0].Subject)
+	env.users.AssertExpectations(t)
+	env.businesses.AssertExpectations(t)
+
+	// The same Response cannot be used twice.
+	_, _, _, _, err = env.uc.HandleResponse(ctx, 1, encoded, requestID)
+	assert.ErrorIs(t, err, ErrSAMLAuthFailed)
+}
+
+func TestSAML_HandleResponse_LinkedIdentity(t *testing.T) {
+	ctx := context.Background()
+	env := newSAMLTestEnv(t)
+	require.NoError(t, env.identities.Create(ctx, &entity.UserIdentity{UserID: 3, Provider: "saml:1", Subject: "emp-3"}))
+	env.users.On("GetById", ctx, int64(3)).Return(&entity.User{ID: 3, Email: "old@example.com"}, nil)
+	env.businesses.On("AddUserIfNotExists", ctx, int64(1), int64(3), BusinessRoleMember).Return(nil)
+
+	// The email is not consulted once the NameID is linked.
+	encoded, requestID := env.respond(t, "emp-3", map[string][]string{"email": {"someone@elsewhere.com"}})
+	_, _, user, isNew, err := env.uc.HandleResponse(ctx, 1, encoded, requestID)
+	require.NoError(t, err)
+	assert.False(t, isNew)
+	assert.Equal(t, int64(3), user.ID)
+	assert.NotNil(t, env.identities.identities[0].LastUsedAt)
+}
+
+func TestSAML_HandleResponse_ExistingUserInVerifiedDomain(t *testing.T) {
+	ctx := context.Background()
+	env := newSAMLTestEnv(t)
+	env.users.On("GetByEmail", ctx, "bob@example.com").Return(&entity.User{ID: 4, Email: "bob@example.com", EmailVerified: true}, nil)
+	env.businesses.On("AddUserIfNotExists", ctx, int64(1), int64(4), BusinessRoleMember).Return(nil)
+
+	encoded, requestID := env.respond(t, "emp-4", map[string][]string{"email": {"bob@example.com"}})
+	_, _, user, isNew, err := env.uc.HandleResponse(ctx, 1, encoded, requestID)
+	require.NoError(t, err)
+	assert.False(t, isNew)
+	assert.Equal(t, int64(4), user.ID)
+	require.Len(t, env.identities.identities, 1)
+	assert.Equal(t, int64(4), env.identities.identities[0].UserID)
+}
+
+func TestSAML_HandleResponse_Rejects(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("existing account with unverified email", func(t *testing.T) {
+		env := newSAMLTestEnv(t)
+		env.users.On("GetByEmail", ctx, "carol@example.com").Return(&entity.User{ID: 5, Email: "carol@example.com"}, nil)
+		encoded, requestID := env.respond(t, "emp-10", map[string][]string{"email": {"carol@example.com"}})
+		_, _, _, _, err := env.uc.HandleResponse(ctx, 1, encoded, requestID)
+		assert.ErrorIs(t, err, ErrSSOAccountExists)
+		assert.Empty(t, env.identities.identities)
+	})
+
+	t.Run("email outside verified domains", func(t *testing.T) {
+		env := newSAMLTestEnv(t)
+		encoded, requestID := env.respond(t, "emp-5", map[string][]string{"email": {"eve@victim.com"}})
+		_, _, _, _, err := env.uc.HandleResponse(ctx, 1, encoded, requestID)
+		assert.ErrorIs(t, err, ErrSAMLDomainNotVerified)
+		assert.Empty(t, env.identities.identities)
+	})
+
+	t.Run("no email", func(t *testing.T) {
+		env := newSAMLTestEnv(t)
+		encoded, requestID := env.respond(t, "emp-6", nil)
+		_, _, _, _, err := env.uc.HandleResponse(ctx, 1, encoded, requestID)
+		assert.ErrorIs(t, err, ErrSSOEmailMissing)
+	})
+
+	t.Run("posted to another business", func(t *testing.T) {
+		env := newSAMLTestEnv(t)
+		encoded, requestID := env.respond(t, "emp-7", map[string][]string{"email": {"x@example.com"}})
+		other := *env.conns.conns[1]
+		other.BusinessID = 2
+		env.conns.conns[2] = &other
+		_, _, _, _, err := env.uc.HandleResponse(ctx, 2, encoded, requestID)
+		assert.ErrorIs(t, err, ErrSAMLAuthFailed)
+	})
+
+	t.Run("unsolicited", func(t *testing.T) {
+		env := newSAMLTestEnv(t)
+		endpoints := env.uc.Endpoints(1)
+		encoded, err := env.idp.Response(samltest.ResponseOptions{
+			Audience: endpoints.EntityID, ACSURL: endpoints.ACSURL, InResponseTo: "id-never-sent",
+			NameID: "emp-8", SignResponse: true,
+		})
+		require.NoError(t, err)
+		_, _, _, _, err = env.uc.HandleResponse(ctx, 1, encoded, "id-never-sent")
+		assert.ErrorIs(t, err, ErrSAMLAuthFailed)
+	})
+
+	t.Run("started in another browser", func(t *testing.T) {
+		env := newSAMLTestEnv(t)
+		encoded, _ := env.respond(t, "emp-9", map[string][]string{"email": {"mallory@example.com"}})
+		_, victimRequestID, err := env.uc.BeginLogin(ctx, 1)
+		require.NoError(t, err)
+		for _, requestID := range []string{victimRequestID, ""} {
+			_, _, _, _, err = env.uc.HandleResponse(ctx, 1, encoded, requestID)
+			assert.ErrorIs(t, err, ErrSAMLAuthFailed)
+		}
+		assert.Empty(t, env.identities.identities)
+	})
+
+	t.Run("disabled connection", func(t *testing.T) {
+		env := newSAMLTestEnv(t)
+		env.conns.conns[1].Enabled = false
+		_, _, err := env.uc.BeginLogin(ctx, 1)
+		assert.ErrorIs(t, err, ErrSAMLNotConfigured)
+	})
+}
+
+func TestSAML_BeginLoginForEmail(t *testing.T) {
+	env := newSAMLTestEnv(t)
+
+	authURL, requestID, err := env.uc.BeginLoginForEmail(context.Background(), "ada@example.com")
+	require.NoError(t, err)
+	assert.NotEmpty(t, requestID)
+	assert.True(t, strings.HasPrefix(authURL, env.idp.SSOURL+"?"))
+
+	_, _, err = env.uc.BeginLoginForEmail(context.Background(), "ada@other.com")
+	assert.ErrorIs(t, err, ErrSAMLNotConfigured)
+}
+
+func TestSAML_Configure(t *testing.T) {
+	ctx := context.Background()
+	env := newSAMLTestEnv(t)
+	env.businesses.On("GetUserRole", ctx, int64(2), int64(10)).Return(BusinessRoleAdmin, nil)
+	env.businesses.On("GetUserRole", ctx, int64(2), int64(11)).Return(BusinessRoleMember, nil)
+
+	_, err := env.uc.Configure(ctx, 11, 2, &entity.SAMLConnection{}, env.idp.Metadata())
+	assert.ErrorIs(t, err, ErrSAMLNotAllowed)
+
+	conn, err := env.uc.Configure(ctx, 10, 2, &entity.SAMLConnection{Enabled: true, EmailAttribute: "mail"}, env.idp.Metadata())
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), conn.BusinessID)
+	assert.Equal(t, env.idp.EntityID, conn.IdPEntityID)
+	assert.Equal(t, env.idp.SSOURL, conn.IdPSSOURL)
+	assert.Equal(t, env.idp.SLOURL, conn.IdPSLOURL)
+	assert.Equal(t, env.idp.CertificatePEM(), conn.IdPCertificate)
+	assert.Equal(t, entity.AuditActionBusinessSAMLConfigured, env.audits.Calls[0].Arguments.Get(1).(*entity.AuditLog).Action)
+
+	got, err := env.uc.GetConnection(ctx, 10, 2)
+	require.NoError(t, err)
+	assert.Equal(t, "mail", got.EmailAttribute)
+
+	invalid := []*entity.SAMLConnection{
+		{IdPSSOURL: env.idp.SSOURL, IdPCertificate: env.idp.CertificatePEM()},
+		{IdPEntityID: "x", IdPSSOURL: "/relative", IdPCertificate: env.idp.CertificatePEM()},
+		{IdPEntityID: "x", IdPSSOURL: env.idp.SSOURL, IdPCertificate: "not a certificate"},
+		{IdPEntityID: "x", IdPSSOURL: env.idp.SSOURL, IdPCertificate: env.idp.CertificatePEM(), DefaultRole: BusinessRoleOwner},
+	}
+	for _, conn := range invalid {
+		_, err := env.uc.Configure(ctx, 10, 2, conn, nil)
+		assert.ErrorIs(t, err, ErrSAMLInvalidConfig)
+	}
+
+	require.NoError(t, env.uc.DeleteConnection(ctx, 10, 2))
+	_, err = env.uc.GetConnection(ctx, 10, 2)
+	assert.ErrorIs(t, err, ErrSAMLNotConfigured)
+	assert.ErrorIs(t, env.uc.DeleteConnection(ctx, 10, 2), ErrSAMLNotConfigured)
+}
+
+func TestSAML_Logout(t *testing.T) {
+	ctx := context.Background()
+	env := newSAMLTestEnv(t)
+	require.NoError(t, env.identities.Create(ctx, &entity.UserIdentity{UserID: 3, Provider: "saml:1", Subject: "emp-3"}))
+	env.tokens.On("VerifyRefreshToken", ctx, "refresh").Return(&interfaces.RefreshClaims{UserID: 3, SessionID: "sess-1"}, nil)
+	env.tokens.On("RemoveRefreshToken", ctx, "sess-1").Return(nil)
+	env.tokens.On("RevokeSessionAccessTokens", ctx, "sess-1").Return(nil)
+	env.sessions.On("RevokeSession", ctx, int64(3), "sess-1").Return(nil)
+
+	logoutURL, err := env.uc.Logout(ctx, 3, 1, "refresh")
+	require.NoError(t, err)
+	u, err := url.Parse(logoutURL)
+	require.NoError(t, err)
+	assert.Equal(t, env.idp.SLOURL, u.Scheme+"://"+u.Host+u.Path)
+	msg, err := saml.DecodeRedirect(u.Query().Get("SAMLRequest"))
+	require.NoError(t, err)
+	assert.Contains(t, string(msg), ">emp-3</saml:NameID>")
+	env.sessions.AssertCalled(t, "RevokeSession", ctx, int64(3), "sess-1")
+
+	// Without an identity at this business there is nothing to end there.
+	env.tokens.On("VerifyRefreshToken", ctx, "refresh-4").Return(&interfaces.RefreshClaims{UserID: 4, SessionID: "sess-4"}, nil)
+	env.tokens.On("RemoveRefreshToken", ctx, "sess-4").Return(nil)
+	env.tokens.On("RevokeSessionAccessTokens", ctx, "sess-4").Return(nil)
+	env.sessions.On("RevokeSession", ctx, int64(4), "sess-4").Return(nil)
+	logoutURL, err = env.uc.Logout(ctx, 4, 1, "refresh-4")
+	require.NoError(t, err)
+	assert.Empty(t, logoutURL)
+}
+
+func TestSAML_SingleLogout(t *testing.T) {
+	ctx := context.Background()
+	env := newSAMLTestEnv(t)
+	require.NoError(t, env.identities.Create(ctx, &entity.UserIdentity{UserID: 3, Provider: "saml:1", Subject: "emp-3"}))
+	env.sessions.On("ListUserSessions", ctx, int64(3)).Return([]*entity.UserSession{{ID: "sess-a"}, {ID: "sess-b"}}, nil)
+	env.tokens.On("RemoveRefreshToken", ctx, mock.Anything).Return(nil)
+	env.tokens.On("RevokeSessionAccessTokens", ctx, mock.Anything).Return(nil)
+	env.sessions.On("RevokeAllSessions", ctx, int64(3), "").Return(nil)
+
+	sloURL := env.uc.Endpoints(1).SLOURL
+	query, err := env.idp.LogoutRequestQuery(sloURL, "emp-3", "relay")
+	require.NoError(t, err)
+	responseURL, err := env.uc.SingleLogout(ctx, 1, query)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(responseURL, env.idp.SLOURL+"?SAMLResponse="))
+	env.tokens.AssertCalled(t, "RemoveRefreshToken", ctx, "sess-a")
+	env.tokens.AssertCalled(t, "RemoveRefreshToken", ctx, "sess-b")
+	env.sessions.AssertCalled(t, "RevokeAllSessions", ctx, int64(3), "")
+
+	query, err = env.idp.LogoutResponseQuery(sloURL, "id-logout", "")
+	require.NoError(t, err)
+	responseURL, err = env.uc.SingleLogout(ctx, 1, query)
+	require.NoError(t, err)
+	assert.Empty(t, responseURL)
+
+	forged, _ := samltest.New("https://idp.example.com")
+	query, _ = forged.LogoutRequestQuery(sloURL, "emp-3", "")
+	_, err = env.uc.SingleLogout(ctx, 1, query)
+	assert.ErrorIs(t, err, ErrSAMLAuthFailed)
+}
@@ -0,0 +1,988 @@
+package usecase
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Prashant2307200/auth-service/internal/entity"
+	"github.com/Prashant2307200/auth-service/internal/infrastructure/repository"
+	"github.com/Prashant2307200/auth-service/internal/usecase/interfaces"
+	"github.com/Prashant2307200/auth-service/pkg/scim"
+	v "github.com/Prashant2307200/auth-service/pkg/validator"
+)
+
+var (
+	ErrInvalidSCIMToken       = errors.New("invalid scim token")
+	ErrSCIMNotAllowed         = errors.New("not allowed to manage scim provisioning")
+	ErrSCIMNotEnabled         = errors.New("scim provisioning is not enabled")
+	ErrSCIMNotFound           = errors.New("resource not found")
+	ErrSCIMPreconditionFailed = errors.New("resource has changed")
+	ErrSCIMConflict           = errors.New("resource already exists")
+	ErrSCIMInvalidValue       = errors.New("invalid value")
+	ErrSCIMMutability         = errors.New("attribute cannot be changed")
+)
+
+const (
+	scimTokenBytes = 32
+	// scimTokenTouchInterval limits how often the last use is recorded; a
+	// sync sends a request per user.
+	scimTokenTouchInterval = time.Minute
+	maxSCIMAttributeLength = 255
+)
+
+// SCIMUsecase is a SCIM 2.0 service provider for each business: its
+// identity provider creates, updates and deactivates the business's members
+// as Users, and grants roles through Groups. Users map onto accounts, found
+// or created by email, and the business's memberships; an inactive user
+// keeps their account but leaves the business. Members of a group named
+// after the admin role are business admins.
+//
+// Every call but the token management ones acts as client, the token the
+// request was authenticated with, and is scoped to its business.
+type SCIMUsecase interface {
+	// BaseURL is where the SCIM API is served.
+	BaseURL() string
+
+	// CreateToken creates or replaces the business's token and returns its
+	// record and the token itself, which is not stored and cannot be
+	// retrieved again.
+	CreateToken(ctx context.Context, requesterID, businessID int64) (*entity.SCIMToken, string, error)
+	GetToken(ctx context.Context, requesterID, businessID int64) (*entity.SCIMToken, error)
+	RevokeToken(ctx context.Context, requesterID, businessID int64) error
+	// Authenticate returns the record of a token, or ErrInvalidSCIMToken.
+	Authenticate(ctx context.Context, token string) (*entity.SCIMToken, error)
+
+	ListUsers(ctx context.Context, client *entity.SCIMToken, q scim.ListQuery) (*scim.ListResponse[*scim.User], error)
+	GetUser(ctx context.Context, client *entity.SCIMToken, id string) (*scim.User, error)
+	CreateUser(ctx context.Context, client *entity.SCIMToken, in *scim.User) (*scim.User, error)
+	// ReplaceUser, PatchUser and DeleteUser return ErrSCIMPreconditionFailed
+	// unless ifMatch, when not empty, matches the user's ETag.
+	ReplaceUser(ctx context.Context, client *entity.SCIMToken, id string, in *scim.User, ifMatch string) (*scim.User, error)
+	PatchUser(ctx context.Context, client *entity.SCIMToken, id string, ops []scim.Operation, ifMatch string) (*scim.User, error)
+	DeleteUser(ctx context.Context, client *entity.SCIMToken, id string, ifMatch string) error
+
+	ListGroups(ctx context.Context, client *entity.SCIMToken, q scim.ListQuery) (*scim.ListResponse[*scim.Group], error)
+	GetGroup(ctx context.Context, client *entity.SCIMToken, id string) (*scim.Group, error)
+	CreateGroup(ctx context.Context, client *entity.SCIMToken, in *scim.Group) (*scim.Group, error)
+	ReplaceGroup(ctx context.Context, client *entity.SCIMToken, id string, in *scim.Group, ifMatch string) (*scim.Group, error)
+	PatchGroup(ctx context.Context, client *entity.SCIMToken, id string, ops []scim.Operation, ifMatch string) (*scim.Group, error)
+	DeleteGroup(ctx context.Context, client *entity.SCIMToken, id string, ifMatch string) error
+}
+
+type scimUsecase struct {
+	baseURL      string
+	scim         repository.SCIMRepository
+	businessRepo interfaces.BusinessRepo
+	userRepo     interfaces.UserRepo
+	audits       repository.AuditRepository
+	authz        *Authorizer
+}
+
+// NewSCIMUsecase returns the SCIM service provider served at baseURL, e.g.
+// https://auth.example.com/api/v1/scim/v2. authz may be nil to give members
+// their system role's permissions.
+func NewSCIMUsecase(baseURL string, scimRepo repository.SCIMRepository, businessRepo interfaces.BusinessRepo, userRepo interfaces.UserRepo, audits repository.AuditRepository, authz *Authorizer) SCIMUsecase {
+	if authz == nil {
+		authz = NewAuthorizer(businessRepo, nil)
+	}
+	return &scimUsecase{
+		baseURL:      strings.TrimSuffix(baseURL, "/"),
+		scim:         scimRepo,
+		businessRepo: businessRepo,
+		userRepo:     userRepo,
+		audits:       audits,
+		authz:        authz,
+	}
+}
+
+func (u *scimUsecase) BaseURL() string {
+	return u.baseURL
+}
+
+func (u *scimUsecase) requireAdmin(ctx context.Context, requesterID, businessID int64) error {
+	err := u.authz.Authorize(ctx, requesterID, businessID, entity.PermissionSSOManage)
+	if errors.Is(err, ErrPermissionDenied) {
+		return ErrSCIMNotAllowed
+	}
+	return err
+}
+
+func (u *scimUsecase) CreateToken(ctx context.Context, requesterID, businessID int64) (*entity.SCIMToken, string, error) {
+	if err := u.requireAdmin(ctx, requesterID, businessID); err != nil {
+		return nil, "", err
+	}
+	secret, err := generateSecureToken(scimTokenBytes)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to generate scim token: %w", err)
+	}
+	token := entity.SCIMTokenPrefix + secret
+	record := &entity.SCIMToken{BusinessID: businessID, TokenHash: hashToken(token), CreatedBy: &requesterID}
+	if err := u.scim.SaveToken(ctx, record); err != nil {
+		return nil, "", fmt.Errorf("failed to store scim token: %w", err)
+	}
+	u.audit(ctx, requesterID, businessID, entity.AuditActionBusinessSCIMTokenCreated, "scim_token", &record.ID, nil)
+	return record, token, nil
+}
+
+func (u *scimUsecase) GetToken(ctx context.Context, requesterID, businessID int64) (*entity.SCIMToken, error) {
+	if err := u.requireAdmin(ctx, requesterID, businessID); err != nil {
+		return nil, err
+	}
+	token, err := u.scim.GetTokenByBusiness(ctx, businessID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrSCIMNotEnabled
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load scim token: %w", err)
+	}
+	return token, nil
+}
+
+func (u *scimUsecase) RevokeToken(ctx context.Context, requesterID, businessID int64) error {
+	if err := u.requireAdmin(ctx, requesterID, businessID); err != nil {
+		return err
+	}
+	err := u.scim.DeleteToken(ctx, businessID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrSCIMNotEnabled
+	}
+	if err != nil {
+		return fmt.Errorf("failed to delete scim token: %w", err)
+	}
+	u.audit(ctx, requesterID, businessID, entity.AuditActionBusinessSCIMTokenRevoked, "scim_token", nil, nil)
+	return nil
+}
+
+func (u *scimUsecase) Authenticate(ctx context.Context, token string) (*entity.SCIMToken, error) {
+	if !strings.HasPrefix(token, entity.SCIMTokenPrefix) {
+		return nil, ErrInvalidSCIMToken
+	}
+	record, err := u.scim.GetTokenByHash(ctx, hashToken(token))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvalidSCIMToken
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load scim token: %w", err)
+	}
+	if record.LastUsedAt == nil || time.Since(*record.LastUsedAt) >= scimTokenTouchInterval {
+		if err := u.scim.TouchToken(ctx, record.ID); err != nil {
+			slog.Warn("Failed to record scim token use", slog.Int64("business_id", record.BusinessID), slog.Any("error", err))
+		}
+	}
+	return record, nil
+}
+
+// audit logs a change to a business's provisioning. Failures are logged,
+// not returned: the change has already happened.
+func (u *scimUsecase) audit(ctx context.Context, userID, businessID int64, action, entityType string, entityID *int64, values map[string]interface{}) {
+	if u.audits == nil {
+		return
+	}
+	client := ClientInfoFrom(ctx)
+	err := u.audits.Log(ctx, &entity.AuditLog{
+		BusinessID: businessID,
+		UserID:     userID,
+		Action:     action,
+		EntityType: entityType,
+		EntityID:   entityID,
+		NewValues:  values,
+		IPAddress:  client.IPAddress,
+		UserAgent:  client.UserAgent,
+		CreatedAt:  time.Now(),
+	})
+	if err != nil {
+		slog.Error("Failed to write audit log", slog.Int64("business_id", businessID), slog.String("action", action), slog.Any("error", err))
+	}
+}
+
+// auditClient logs a change made through client, attributed to the admin
+// who created its token.
+func (u *scimUsecase) auditClient(ctx context.Context, client *entity.SCIMToken, action, entityType string, entityID int64, values map[string]interface{}) {
+	var actor int64
+	if client.CreatedBy != nil {
+		actor = *client.CreatedBy
+	}
+	u.audit(ctx, actor, client.BusinessID, action, entityType, &entityID, values)
+}
+
+func parseSCIMID(id string) (int64, error) {
+	n, err := strconv.ParseInt(id, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, ErrSCIMNotFound
+	}
+	return n, nil
+}
+
+func checkETag(ifMatch string, version int) error {
+	if ifMatch != "" && !scim.MatchETag(ifMatch, scim.ETag(version)) {
+		return ErrSCIMPreconditionFailed
+	}
+	return nil
+}
+
+func checkSCIMLength(name, value string) error {
+	if len(value) > maxSCIMAttributeLength {
+		return fmt.Errorf("%w: %s is longer than %d characters", ErrSCIMInvalidValue, name, maxSCIMAttributeLength)
+	}
+	return nil
+}
+
+// decodePatched decodes a resource patched in its JSON form into out.
+func decodePatched(resource map[string]any, out any) error {
+	data, err := json.Marshal(resource)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("%w: %v", ErrSCIMInvalidValue, err)
+	}
+	return nil
+}
+
+func (u *scimUsecase) toSCIMUser(user *entity.SCIMUser, groups []*entity.SCIMGroup) *scim.User {
+	id := strconv.FormatInt(user.UserID, 10)
+	active := scim.Bool(user.Active)
+	out := &scim.User{
+		Schemas:     []string{scim.SchemaUser},
+		ID:          id,
+		ExternalID:  user.ExternalID,
+		UserName:    user.UserName,
+		DisplayName: user.DisplayName,
+		Emails:      []scim.Email{{Value: user.Email, Type: "work", Primary: true}},
+		Active:      &active,
+		Meta: &scim.Meta{
+			ResourceType: "User",
+			Created:      user.CreatedAt,
+			LastModified: user.UpdatedAt,
+			Location:     u.baseURL + "/Users/" + id,
+			Version:      scim.ETag(user.Version),
+		},
+	}
+	if user.GivenName != "" || user.FamilyName != "" {
+		out.Name = &scim.Name{GivenName: user.GivenName, FamilyName: user.FamilyName}
+	}
+	for _, g := range groups {
+		if slices.Contains(g.MemberIDs, user.UserID) {
+			gid := strconv.FormatInt(g.ID, 10)
+			out.Groups = append(out.Groups, scim.Reference{Value: gid, Ref: u.baseURL + "/Groups/" + gid, Display: g.DisplayName})
+		}
+	}
+	return out
+}
+
+// applySCIMUser copies the writable attributes of in to user and returns
+// the email they give the user: userName when it is an address, otherwise
+// the primary email.
+func applySCIMUser(user *entity.SCIMUser, in *scim.User) (string, error) {
+	userName := strings.TrimSpace(in.UserName)
+	if userName == "" {
+		return "", fmt.Errorf("%w: userName is required", ErrSCIMInvalidValue)
+	}
+	user.UserName = userName
+	user.ExternalID = strings.TrimSpace(in.ExternalID)
+	user.GivenName, user.FamilyName = "", ""
+	if in.Name != nil {
+		user.GivenName, user.FamilyName = strings.TrimSpace(in.Name.GivenName), strings.TrimSpace(in.Name.FamilyName)
+	}
+	user.DisplayName = strings.TrimSpace(in.DisplayName)
+	user.Active = in.IsActive()
+	for _, attr := range [][2]string{
+		{"userName", user.UserName},
+		{"externalId", user.ExternalID},
+		{"name.givenName", user.GivenName},
+		{"name.familyName", user.FamilyName},
+		{"displayName", user.DisplayName},
+	} {
+		if err := checkSCIMLength(attr[0], attr[1]); err != nil {
+			return "", err
+		}
+	}
+
+	email := userName
+	if !strings.Contains(email, "@") {
+		email = strings.TrimSpace(in.PrimaryEmail())
+	}
+	if ok, _ := v.ValidateEmail(email); !ok || strings.ContainsAny(email, "<> ") {
+		return "", fmt.Errorf("%w: userName or a primary email must be an email address", ErrSCIMInvalidValue)
+	}
+	return email, nil
+}
+
+// requireVerifiedDomain checks that the business has verified the domain of
+// email. The identity provider speaks for the business, which has only
+// proven control of its verified domains.
+func (u *scimUsecase) requireVerifiedDomain(ctx context.Context, businessID int64, email string) error {
+	_, domain, _ := strings.Cut(email, "@")
+	verified, err := u.businessRepo.GetDomain(ctx, businessID, strings.ToLower(domain))
+	if err != nil || !verified.Verified {
+		return fmt.Errorf("%w: %s is not a verified domain of the business", ErrSCIMInvalidValue, domain)
+	}
+	return nil
+}
+
+func (u *scimUsecase) getUser(ctx context.Context, businessID int64, id string) (*entity.SCIMUser, error) {
+	userID, err := parseSCIMID(id)
+	if err != nil {
+		return nil, err
+	}
+	user, err := u.scim.GetUser(ctx, businessID, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrSCIMNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load scim user: %w", err)
+	}
+	return user, nil
+}
+
+// checkUserNameFree checks that no other user of the business has userName.
+func (u *scimUsecase) checkUserNameFree(ctx context.Context, businessID, userID int64, userName string) error {
+	users, err := u.scim.ListUsers(ctx, businessID)
+	if err != nil {
+		return fmt.Errorf("failed to list scim users: %w", err)
+	}
+	for _, other := range users {
+		if other.UserID != userID && strings.EqualFold(other.UserName, userName) {
+			return fmt.Errorf("%w: userName %q is taken", ErrSCIMConflict, userName)
+		}
+	}
+	return nil
+}
+
+// membership returns the user's role in the business, and whether they are
+// a member at all.
+func (u *scimUsecase) membership(ctx context.Context, businessID, userID int64) (int, bool, error) {
+	role, err := u.businessRepo.GetUserRole(ctx, businessID, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to load business role: %w", err)
+	}
+	return role, true, nil
+}
+
+// requireNotOwner keeps the identity provider from removing the business's
+// owner, who can only leave by hand.
+func (u *scimUsecase) requireNotOwner(ctx context.Context, businessID, userID int64) error {
+	role, member, err := u.membership(ctx, businessID, userID)
+	if err != nil {
+		return err
+	}
+	if member && role == BusinessRoleOwner {
+		return fmt.Errorf("%w: the business owner cannot be deactivated or deleted", ErrSCIMMutability)
+	}
+	return nil
+}
+
+// setActive adds the user to the business, as admin when admin, or takes
+// them out of it.
+func (u *scimUsecase) setActive(ctx context.Context, businessID, userID int64, active, admin bool) error {
+	_, member, err := u.membership(ctx, businessID, userID)
+	if err != nil {
+		return err
+	}
+	switch {
+	case active && !member:
+		role := BusinessRoleMember
+		if admin {
+			role = BusinessRoleAdmin
+		}
+		if err := u.businessRepo.AddUserIfNotExists(ctx, businessID, userID, role); err != nil {
+			return fmt.Errorf("failed to add user to business: %w", err)
+		}
+	case !active && member:
+		if err := u.businessRepo.RemoveUser(ctx, businessID, userID); err != nil {
+			return fmt.Errorf("failed to remove user from business: %w", err)
+		}
+	}
+	return nil
+}
+
+func (u *scimUsecase) ListUsers(ctx context.Context, client *entity.SCIMToken, q scim.ListQuery) (*scim.ListResponse[*scim.User], error) {
+	users, err := u.scim.ListUsers(ctx, client.BusinessID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list scim users: %w", err)
+	}
+	groups, err := u.scim.ListGroups(ctx, client.BusinessID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list scim groups: %w", err)
+	}
+	resources := make([]*scim.User, 0, len(users))
+	for _, user := range users {
+		resources = append(resources, u.toSCIMUser(user, groups))
+	}
+	matched, err := scim.FilterResources(resources, q.Filter)
+	if err != nil {
+		return nil, err
+	}
+	return scim.Page(matched, q), nil
+}
+
+func (u *scimUsecase) GetUser(ctx context.Context, client *entity.SCIMToken, id string) (*scim.User, error) {
+	user, err := u.getUser(ctx, client.BusinessID, id)
+	if err != nil {
+		return nil, err
+	}
+	groups, err := u.scim.ListGroups(ctx, client.BusinessID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list scim groups: %w", err)
+	}
+	return u.toSCIMUser(user, groups), nil
+}
+
+func (u *scimUsecase) CreateUser(ctx context.Context, client *entity.SCIMToken, in *scim.User) (*scim.User, error) {
+	businessID := client.BusinessID
+	record := &entity.SCIMUser{BusinessID: businessID}
+	email, err := applySCIMUser(record, in)
+	if err != nil {
+		return nil, err
+	}
+	if err := u.requireVerifiedDomain(ctx, businessID, email); err != nil {
+		return nil, err
+	}
+	if err := u.checkUserNameFree(ctx, businessID, 0, record.UserName); err != nil {
+		return nil, err
+	}
+
+	// An existing account with the email is adopted, e.g. a member invited
+	// before the business turned on provisioning.
+	user, err := u.userRepo.GetByEmail(ctx, email)
+	created := false
+	switch {
+	case err == nil:
+		if _, err := u.scim.GetUser(ctx, businessID, user.ID); err == nil {
+			return nil, fmt.Errorf("%w: %s is already provisioned", ErrSCIMConflict, email)
+		}
+		if !record.Active {
+			if err := u.requireNotOwner(ctx, businessID, user.ID); err != nil {
+				return nil, err
+			}
+		}
+	case errors.Is(err, sql.ErrNoRows):
+		user = &entity.User{Username: generateUsernameFromEmail(email), Email: email, Role: entity.RoleUser}
+		user.ID, err = u.userRepo.Create(ctx, user)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create user: %w", err)
+		}
+		if err := u.userRepo.MarkEmailVerified(ctx, user.ID); err != nil {
+			slog.Warn("Failed to mark email verified", slog.Int64("user_id", user.ID), slog.Any("error", err))
+		}
+		created = true
+	default:
+		return nil, fmt.Errorf("failed to check existing user: %w", err)
+	}
+
+	record.UserID, record.Email = user.ID, user.Email
+	if err := u.scim.CreateUser(ctx, record); err != nil {
+		return nil, fmt.Errorf("failed to store scim user: %w", err)
+	}
+	if err := u.setActive(ctx, businessID, user.ID, record.Active, false); err != nil {
+		return nil, err
+	}
+	u.auditClient(ctx, client, entity.AuditActionSCIMUserCreated, "scim_user", user.ID, map[string]interface{}{
+		"user_name":       record.UserName,
+		"external_id":     record.ExternalID,
+		"active":          record.Active,
+		"account_created": created,
+	})
+	return u.toSCIMUser(record, nil), nil
+}
+
+func (u *scimUsecase) ReplaceUser(ctx context.Context, client *entity.SCIMToken, id string, in *scim.User, ifMatch string) (*scim.User, error) {
+	current, err := u.getUser(ctx, client.BusinessID, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkETag(ifMatch, current.Version); err != nil {
+		return nil, err
+	}
+	return u.updateUser(ctx, client, current, in)
+}
+
+func (u *scimUsecase) PatchUser(ctx context.Context, client *entity.SCIMToken, id string, ops []scim.Operation, ifMatch string) (*scim.User, error) {
+	current, err := u.getUser(ctx, client.BusinessID, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkETag(ifMatch, current.Version); err != nil {
+		return nil, err
+	}
+	resource, err := scim.Resource(u.toSCIMUser(current, nil))
+	if err != nil {
+		return nil, err
+	}
+	if err := scim.ApplyPatch(resource, ops); err != nil {
+		return nil, err
+	}
+	var patched scim.User
+	if err := decodePatched(resource, &patched); err != nil {
+		return nil, err
+	}
+	return u.updateUser(ctx, client, current, &patched)
+}
+
+// updateUser replaces the writable attributes of current with those of in.
+// A changed email is changed on the account, when both addresses are in the
+// business's verified domains.
+func (u *scimUsecase) updateUser(ctx context.Context, client *entity.SCIMToken, current *entity.SCIMUser, in *scim.User) (*scim.User, error) {
+	businessID := client.BusinessID
+	next := *current
+	email, err := applySCIMUser(&next, in)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.EqualFold(next.UserName, current.UserName) {
+		if err := u.checkUserNameFree(ctx, businessID, current.UserID, next.UserName); err != nil {
+			return nil, err
+		}
+	}
+	emailChanged := !strings.EqualFold(email, current.Email)
+	if emailChanged {
+		if err := u.requireVerifiedDomain(ctx, businessID, current.Email); err != nil {
+			return nil, fmt.Errorf("%w: the email of an account outside the business's domains cannot be changed", ErrSCIMMutability)
+		}
+		if err := u.requireVerifiedDomain(ctx, businessID, email); err != nil {
+			return nil, err
+		}
+		if _, err := u.userRepo.GetByEmail(ctx, email); err == nil {
+			return nil, fmt.Errorf("%w: %s is taken", ErrSCIMConflict, email)
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("failed to check existing user: %w", err)
+		}
+	}
+	if current.Active && !next.Active {
+		if err := u.requireNotOwner(ctx, businessID, current.UserID); err != nil {
+			return nil, err
+		}
+	}
+
+	err = u.scim.UpdateUser(ctx, &next, current.Version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrSCIMPreconditionFailed
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to update scim user: %w", err)
+	}
+	if emailChanged {
+		user, err := u.userRepo.GetById(ctx, current.UserID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load user: %w", err)
+		}
+		user.Email = email
+		if err := u.userRepo.UpdateById(ctx, user.ID, user); err != nil {
+			return nil, fmt.Errorf("failed to update user email: %w", err)
+		}
+		next.Email = email
+	}
+
+	groups, err := u.scim.ListGroups(ctx, businessID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list scim groups: %w", err)
+	}
+	action := entity.AuditActionSCIMUserUpdated
+	if next.Active != current.Active {
+		if err := u.setActive(ctx, businessID, current.UserID, next.Active, scimAdmins(groups)[current.UserID]); err != nil {
+			return nil, err
+		}
+		action = entity.AuditActionSCIMUserDeactivated
+		if next.Active {
+			action = entity.AuditActionSCIMUserReactivated
+		}
+	}
+	u.auditClient(ctx, client, action, "scim_user", current.UserID, scimUserChanges(current, &next))
+	return u.toSCIMUser(&next, groups), nil
+}
+
+// scimUserChanges returns the attributes that differ between before and
+// after, with their new values.
+func scimUserChanges(before, after *entity.SCIMUser) map[string]interface{} {
+	changes := map[string]interface{}{}
+	for name, values := range map[string][2]string{
+		"user_name":    {before.UserName, after.UserName},
+		"email":        {before.Email, after.Email},
+		"external_id":  {before.ExternalID, after.ExternalID},
+		"given_name":   {before.GivenName, after.GivenName},
+		"family_name":  {before.FamilyName, after.FamilyName},
+		"display_name": {before.DisplayName, after.DisplayName},
+	} {
+		if values[0] != values[1] {
+			changes[name] = values[1]
+		}
+	}
+	if before.Active != after.Active {
+		changes["active"] = after.Active
+	}
+	return changes
+}
+
+func (u *scimUsecase) DeleteUser(ctx context.Context, client *entity.SCIMToken, id string, ifMatch string) error {
+	current, err := u.getUser(ctx, client.BusinessID, id)
+	if err != nil {
+		return err
+	}
+	if err := checkETag(ifMatch, current.Version); err != nil {
+		return err
+	}
+	if err := u.requireNotOwner(ctx, client.BusinessID, current.UserID); err != nil {
+		return err
+	}
+	err = u.scim.DeleteUser(ctx, client.BusinessID, current.UserID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrSCIMNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to delete scim user: %w", err)
+	}
+	// The account itself stays: it may belong to other businesses.
+	if err := u.setActive(ctx, client.BusinessID, current.UserID, false, false); err != nil {
+		return err
+	}
+	u.auditClient(ctx, client, entity.AuditActionSCIMUserDeleted, "scim_user", current.UserID, map[string]interface{}{
+		"user_name": current.UserName,
+	})
+	return nil
+}
+
+// isSCIMAdminGroup reports whether the group makes its members admins.
+func isSCIMAdminGroup(g *entity.SCIMGroup) bool {
+	return strings.EqualFold(strings.TrimSpace(g.DisplayName), entity.RoleNameAdmin)
+}
+
+// scimAdmins returns the users that groups make admins.
+func scimAdmins(groups []*entity.SCIMGroup) map[int64]bool {
+	admins := map[int64]bool{}
+	for _, g := range groups {
+		if isSCIMAdminGroup(g) {
+			for _, id := range g.MemberIDs {
+				admins[id] = true
+			}
+		}
+	}
+	return admins
+}
+
+// syncAdmins promotes the active members who became admins through a group
+// change and demotes those who stopped being admins. Roles the groups did
+// not grant or take, and the owner's, are left alone.
+func (u *scimUsecase) syncAdmins(ctx context.Context, businessID int64, before, after map[int64]bool) error {
+	changed := map[int64]bool{}
+	for id := range before {
+		changed[id] = true
+	}
+	for id := range after {
+		changed[id] = true
+	}
+	for id := range changed {
+		if before[id] == after[id] {
+			continue
+		}
+		role, member, err := u.membership(ctx, businessID, id)
+		if err != nil {
+			return err
+		}
+		if !member || role == BusinessRoleOwner {
+			continue
+		}
+		want := BusinessRoleMember
+		if after[id] {
+			want = BusinessRoleAdmin
+		}
+		if role != want {
+			if err := u.businessRepo.UpdateUserRole(ctx, businessID, id, want); err != nil {
+				return fmt.Errorf("failed to update business role: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+func (u *scimUsecase) toSCIMGroup(group *entity.SCIMGroup, users map[int64]*entity.SCIMUser) *scim.Group {
+	id := strconv.FormatInt(group.ID, 10)
+	out := &scim.Group{
+		Schemas:     []string{scim.SchemaGroup},
+		ID:          id,
+		ExternalID:  group.ExternalID,
+		DisplayName: group.DisplayName,
+		Meta: &scim.Meta{
+			ResourceType: "Group",
+			Created:      group.CreatedAt,
+			LastModified: group.UpdatedAt,
+			Location:     u.baseURL + "/Groups/" + id,
+			Version:      scim.ETag(group.Version),
+		},
+	}
+	for _, memberID := range group.MemberIDs {
+		mid := strconv.FormatInt(memberID, 10)
+		ref := scim.Reference{Value: mid, Ref: u.baseURL + "/Users/" + mid}
+		if user := users[memberID]; user != nil {
+			ref.Display = user.UserName
+		}
+		out.Members = append(out.Members, ref)
+	}
+	return out
+}
+
+func (u *scimUsecase) usersByID(ctx context.Context, businessID int64) (map[int64]*entity.SCIMUser, error) {
+	users, err := u.scim.ListUsers(ctx, businessID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list scim users: %w", err)
+	}
+	byID := make(map[int64]*entity.SCIMUser, len(users))
+	for _, user := range users {
+		byID[user.UserID] = user
+	}
+	return byID, nil
+}
+
+// applySCIMGroup copies the writable attributes of in to group. Members
+// must be users of the business.
+func applySCIMGroup(group *entity.SCIMGroup, in *scim.Group, users map[int64]*entity.SCIMUser) error {
+	displayName := strings.TrimSpace(in.DisplayName)
+	if displayName == "" {
+		return fmt.Errorf("%w: displayName is required", ErrSCIMInvalidValue)
+	}
+	group.DisplayName = displayName
+	group.ExternalID = strings.TrimSpace(in.ExternalID)
+	for _, attr := range [][2]string{{"displayName", group.DisplayName}, {"externalId", group.ExternalID}} {
+		if err := checkSCIMLength(attr[0], attr[1]); err != nil {
+			return err
+		}
+	}
+	group.MemberIDs = nil
+	for _, m := range in.Members {
+		id, err := strconv.ParseInt(m.Value, 10, 64)
+		if err != nil || users[id] == nil {
+			return fmt.Errorf("%w: member %q is not a user of the business", ErrSCIMInvalidValue, m.Value)
+		}
+		if !slices.Contains(group.MemberIDs, id) {
+			group.MemberIDs = append(group.MemberIDs, id)
+		}
+	}
+	slices.Sort(group.MemberIDs)
+	return nil
+}
+
+// checkDisplayNameFree checks that no other group of groups is named
+// displayName.
+func checkDisplayNameFree(groups []*entity.SCIMGroup, groupID int64, displayName string) error {
+	for _, other := range groups {
+		if other.ID != groupID && strings.EqualFold(other.DisplayName, displayName) {
+			return fmt.Errorf("%w: displayName %q is taken", ErrSCIMConflict, displayName)
+		}
+	}
+	return nil
+}
+
+func (u *scimUsecase) getGroup(ctx context.Context, businessID int64, id string) (*entity.SCIMGroup, error) {
+	groupID, err := parseSCIMID(id)
+	if err != nil {
+		return nil, err
+	}
+	group, err := u.scim.GetGroup(ctx, businessID, groupID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrSCIMNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load scim group: %w", err)
+	}
+	return group, nil
+}
+
+func (u *scimUsecase) ListGroups(ctx context.Context, client *entity.SCIMToken, q scim.ListQuery) (*scim.ListResponse[*scim.Group], error) {
+	groups, err := u.scim.ListGroups(ctx, client.BusinessID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list scim groups: %w", err)
+	}
+	users, err := u.usersByID(ctx, client.BusinessID)
+	if err != nil {
+		return nil, err
+	}
+	resources := make([]*scim.Group, 0, len(groups))
+	for _, group := range groups {
+		resources = append(resources, u.toSCIMGroup(group, users))
+	}
+	matched, err := scim.FilterResources(resources, q.Filter)
+	if err != nil {
+		return nil, err
+	}
+	return scim.Page(matched, q), nil
+}
+
+func (u *scimUsecase) GetGroup(ctx context.Context, client *entity.SCIMToken, id string) (*scim.Group, error) {
+	group, err := u.getGroup(ctx, client.BusinessID, id)
+	if err != nil {
+		return nil, err
+	}
+	users, err := u.usersByID(ctx, client.BusinessID)
+	if err != nil {
+		return nil, err
+	}
+	return u.toSCIMGroup(group, users), nil
+}
+
+func (u *scimUsecase) CreateGroup(ctx context.Context, client *entity.SCIMToken, in *scim.Group) (*scim.Group, error) {
+	businessID := client.BusinessID
+	users, err := u.usersByID(ctx, businessID)
+	if err != nil {
+		return nil, err
+	}
+	group := &entity.SCIMGroup{BusinessID: businessID}
+	if err := applySCIMGroup(group, in, users); err != nil {
+		return nil, err
+	}
+	groups, err := u.scim.ListGroups(ctx, businessID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list scim groups: %w", err)
+	}
+	if err := checkDisplayNameFree(groups, 0, group.DisplayName); err != nil {
+		return nil, err
+	}
+
+	if err := u.scim.CreateGroup(ctx, group); err != nil {
+		return nil, fmt.Errorf("failed to store scim group: %w", err)
+	}
+	if err := u.syncAdmins(ctx, businessID, scimAdmins(groups), scimAdmins(append(groups, group))); err != nil {
+		return nil, err
+	}
+	u.auditClient(ctx, client, entity.AuditActionSCIMGroupCreated, "scim_group", group.ID, map[string]interface{}{
+		"display_name": group.DisplayName,
+		"external_id":  group.ExternalID,
+		"members":      group.MemberIDs,
+	})
+	return u.toSCIMGroup(group, users), nil
+}
+
+func (u *scimUsecase) ReplaceGroup(ctx context.Context, client *entity.SCIMToken, id string, in *scim.Group, ifMatch string) (*scim.Group, error) {
+	current, err := u.getGroup(ctx, client.BusinessID, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkETag(ifMatch, current.Version); err != nil {
+		return nil, err
+	}
+	return u.updateGroup(ctx, client, current, in)
+}
+
+func (u *scimUsecase) PatchGroup(ctx context.Context, client *entity.SCIMToken, id string, ops []scim.Operation, ifMatch string) (*scim.Group, error) {
+	current, err := u.getGroup(ctx, client.BusinessID, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkETag(ifMatch, current.Version); err != nil {
+		return nil, err
+	}
+	resource, err := scim.Resource(u.toSCIMGroup(current, nil))
+	if err != nil {
+		return nil, err
+	}
+	if err := scim.ApplyPatch(resource, ops); err != nil {
+		return nil, err
+	}
+	var patched scim.Group
+	if err := decodePatched(resource, &patched); err != nil {
+		return nil, err
+	}
+	return u.updateGroup(ctx, client, current, &patched)
+}
+
+func (u *scimUsecase) updateGroup(ctx context.Context, client *entity.SCIMToken, current *entity.SCIMGroup, in *scim.Group) (*scim.Group, error) {
+	businessID := client.BusinessID
+	users, err := u.usersByID(ctx, businessID)
+	if err != nil {
+		return nil, err
+	}
+	next := *current
+	if err := applySCIMGroup(&next, in, users); err != nil {
+		return nil, err
+	}
+	groups, err := u.scim.ListGroups(ctx, businessID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list scim groups: %w", err)
+	}
+	if err := checkDisplayNameFree(groups, current.ID, next.DisplayName); err != nil {
+		return nil, err
+	}
+
+	err = u.scim.UpdateGroup(ctx, &next, current.Version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrSCIMPreconditionFailed
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to update scim group: %w", err)
+	}
+	after := make([]*entity.SCIMGroup, 0, len(groups))
+	for _, g := range groups {
+		if g.ID == next.ID {
+			g = &next
+		}
+		after = append(after, g)
+	}
+	if err := u.syncAdmins(ctx, businessID, scimAdmins(groups), scimAdmins(after)); err != nil {
+		return nil, err
+	}
+
+	changes := map[string]interface{}{}
+	if next.DisplayName != current.DisplayName {
+		changes["display_name"] = next.DisplayName
+	}
+	if next.ExternalID != current.ExternalID {
+		changes["external_id"] = next.ExternalID
+	}
+	if added := memberDiff(next.MemberIDs, current.MemberIDs); len(added) > 0 {
+		changes["members_added"] = added
+	}
+	if removed := memberDiff(current.MemberIDs, next.MemberIDs); len(removed) > 0 {
+		changes["members_removed"] = removed
+	}
+	u.auditClient(ctx, client, entity.AuditActionSCIMGroupUpdated, "scim_group", current.ID, changes)
+	return u.toSCIMGroup(&next, users), nil
+}
+
+// memberDiff returns the IDs in a that are not in b.
+func memberDiff(a, b []int64) []int64 {
+	var diff []int64
+	for _, id := range a {
+		if !slices.Contains(b, id) {
+			diff = append(diff, id)
+		}
+	}
+	return diff
+}
+
+func (u *scimUsecase) DeleteGroup(ctx context.Context, client *entity.SCIMToken, id string, ifMatch string) error {
+	current, err := u.getGroup(ctx, client.BusinessID, id)
+	if err != nil {
+		return err
+	}
+	if err := checkETag(ifMatch, current.Version); err != nil {
+		return err
+	}
+	groups, err := u.scim.ListGroups(ctx, client.BusinessID)
+	if err != nil {
+		return fmt.Errorf("failed to list scim groups: %w", err)
+	}
+	err = u.scim.DeleteGroup(ctx, client.BusinessID, current.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrSCIMNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to delete scim group: %w", err)
+	}
+	after := slices.DeleteFunc(slices.Clone(groups), func(g *entity.SCIMGroup) bool { return g.ID == current.ID })
+	if err := u.syncAdmins(ctx, client.BusinessID, scimAdmins(groups), scimAdmins(after)); err != nil {
+		return err
+	}
+	u.auditClient(ctx, client, entity.AuditActionSCIMGroupDeleted, "scim_group", current.ID, map[string]interface{}{
+		"display_name": current.DisplayName,
+	})
+	return nil
+}
@@ -0,0 +1,557 @@
+package usecase
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Prashant2307200/auth-service/internal/entity"
+	"github.com/Prashant2307200/auth-service/internal/infrastructure/repository"
+	"github.com/Prashant2307200/auth-service/internal/testutil"
+	"github.com/Prashant2307200/auth-service/pkg/scim"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// memSCIMUsers is the user repository of the SCIM tests.
+type memSCIMUsers struct {
+	*testutil.MockUserRepo
+	users map[int64]*entity.User
+}
+
+func (r *memSCIMUsers) GetById(_ context.Context, id int64) (*entity.User, error) {
+	if u, ok := r.users[id]; ok {
+		c := *u
+		return &c, nil
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (r *memSCIMUsers) GetByEmail(_ context.Context, email string) (*entity.User, error) {
+	for _, u := range r.users {
+		if strings.EqualFold(u.Email, email) {
+			c := *u
+			return &c, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (r *memSCIMUsers) Create(_ context.Context, user *entity.User) (int64, error) {
+	id := int64(100 + len(r.users))
+	c := *user
+	c.ID = id
+	r.users[id] = &c
+	return id, nil
+}
+
+func (r *memSCIMUsers) MarkEmailVerified(_ context.Context, id int64) error {
+	r.users[id].EmailVerified = true
+	return nil
+}
+
+func (r *memSCIMUsers) UpdateById(_ context.Context, id int64, user *entity.User) error {
+	c := *user
+	r.users[id] = &c
+	return nil
+}
+
+// memSCIMBusinesses tracks the memberships of business 1, which verified
+// example.com.
+type memSCIMBusinesses struct {
+	*testutil.MockBusinessRepo
+	roles map[int64]int
+}
+
+func (r *memSCIMBusinesses) GetDomain(_ context.Context, businessID int64, domain string) (*entity.BusinessDomain, error) {
+	if businessID == 1 && domain == "example.com" {
+		return &entity.BusinessDomain{BusinessID: 1, Domain: domain, Verified: true}, nil
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (r *memSCIMBusinesses) GetUserRole(_ context.Context, _ int64, userID int64) (int, error) {
+	if role, ok := r.roles[userID]; ok {
+		return role, nil
+	}
+	return 0, sql.ErrNoRows
+}
+
+func (r *memSCIMBusinesses) AddUserIfNotExists(_ context.Context, _ int64, userID int64, role int) error {
+	if _, ok := r.roles[userID]; !ok {
+		r.roles[userID] = role
+	}
+	return nil
+}
+
+func (r *memSCIMBusinesses) RemoveUser(_ context.Context, _ int64, userID int64) error {
+	delete(r.roles, userID)
+	return nil
+}
+
+func (r *memSCIMBusinesses) UpdateUserRole(_ context.Context, _ int64, userID int64, role int) error {
+	r.roles[userID] = role
+	return nil
+}
+
+type memSCIMRepo struct {
+	users  *memSCIMUsers
+	tokens map[int64]*entity.SCIMToken
+	scim   map[int64]*entity.SCIMUser
+	groups map[int64]*entity.SCIMGroup
+	nextID int64
+}
+
+func (r *memSCIMRepo) SaveToken(_ context.Context, token *entity.SCIMToken) error {
+	r.nextID++
+	token.ID, token.CreatedAt = r.nextID, time.Now()
+	c := *token
+	r.tokens[token.BusinessID] = &c
+	return nil
+}
+
+func (r *memSCIMRepo) GetTokenByBusiness(_ context.Context, businessID int64) (*entity.SCIMToken, error) {
+	if t, ok := r.tokens[businessID]; ok {
+		return t, nil
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (r *memSCIMRepo) GetTokenByHash(_ context.Context, tokenHash string) (*entity.SCIMToken, error) {
+	for _, t := range r.tokens {
+		if t.TokenHash == tokenHash {
+			return t, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (r *memSCIMRepo) TouchToken(_ context.Context, id int64) error {
+	now := time.Now()
+	for _, t := range r.tokens {
+		if t.ID == id {
+			t.LastUsedAt = &now
+		}
+	}
+	return nil
+}
+
+func (r *memSCIMRepo) DeleteToken(_ context.Context, businessID int64) error {
+	if _, ok := r.tokens[businessID]; !ok {
+		return sql.ErrNoRows
+	}
+	delete(r.tokens, businessID)
+	return nil
+}
+
+func (r *memSCIMRepo) CreateUser(_ context.Context, user *entity.SCIMUser) error {
+	user.Version, user.CreatedAt, user.UpdatedAt = 1, time.Now(), time.Now()
+	c := *user
+	r.scim[user.UserID] = &c
+	return nil
+}
+
+func (r *memSCIMRepo) GetUser(_ context.Context, businessID, userID int64) (*entity.SCIMUser, error) {
+	u, ok := r.scim[userID]
+	if !ok || u.BusinessID != businessID {
+		return nil, sql.ErrNoRows
+	}
+	c := *u
+	c.Email = r.users.users[userID].Email
+	return &c, nil
+}
+
+func (r *memSCIMRepo) ListUsers(ctx context.Context, businessID int64) ([]*entity.SCIMUser, error) {
+	var users []*entity.SCIMUser
+	for id := range r.scim {
+		if u, err := r.GetUser(ctx, businessID, id); err == nil {
+			users = append(users, u)
+		}
+	}
+	slices.SortFunc(users, func(a, b *entity.SCIMUser) int { return int(a.UserID - b.UserID) })
+	return users, nil
+}
+
+func (r *memSCIMRepo) UpdateUser(_ context.Context, user *entity.SCIMUser, version int) error {
+	stored, ok := r.scim[user.UserID]
+	if !ok || stored.Version != version {
+		return sql.ErrNoRows
+	}
+	user.Version, user.UpdatedAt = version+1, time.Now()
+	c := *user
+	r.scim[user.UserID] = &c
+	return nil
+}
+
+func (r *memSCIMRepo) DeleteUser(_ context.Context, businessID, userID int64) error {
+	if _, ok := r.scim[userID]; !ok {
+		return sql.ErrNoRows
+	}
+	delete(r.scim, userID)
+	for _, g := range r.groups {
+		if slices.Contains(g.MemberIDs, userID) {
+			g.MemberIDs = slices.DeleteFunc(g.MemberIDs, func(id int64) bool { return id == userID })
+			g.Version++
+		}
+	}
+	return nil
+}
+
+func (r *memSCIMRepo) CreateGroup(_ context.Context, group *entity.SCIMGroup) error {
+	r.nextID++
+	group.ID, group.Version, group.CreatedAt, group.UpdatedAt = r.nextID, 1, time.Now(), time.Now()
+	c := *group
+	r.groups[group.ID] = &c
+	return nil
+}
+
+func (r *memSCIMRepo) GetGroup(_ context.Context, businessID, id int64) (*entity.SCIMGroup, error) {
+	g, ok := r.groups[id]
+	if !ok || g.BusinessID != businessID {
+		return nil, sql.ErrNoRows
+	}
+	c := *g
+	c.MemberIDs = slices.Clone(g.MemberIDs)
+	return &c, nil
+}
+
+func (r *memSCIMRepo) ListGroups(ctx context.Context, businessID int64) ([]*entity.SCIMGroup, error) {
+	var groups []*entity.SCIMGroup
+	for id := range r.groups {
+		if g, err := r.GetGroup(ctx, businessID, id); err == nil {
+			groups = append(groups, g)
+		}
+	}
+	slices.SortFunc(groups, func(a, b *entity.SCIMGroup) int { return int(a.ID - b.ID) })
+	return groups, nil
+}
+
+func (r *memSCIMRepo) UpdateGroup(_ context.Context, group *entity.SCIMGroup, version int) error {
+	stored, ok := r.groups[group.ID]
+	if !ok || stored.Version != version {
+		return sql.ErrNoRows
+	}
+	group.Version, group.UpdatedAt = version+1, time.Now()
+	c := *group
+	r.groups[group.ID] = &c
+	return nil
+}
+
+func (r *memSCIMRepo) DeleteGroup(_ context.Context, _ int64, id int64) error {
+	if _, ok := r.groups[id]; !ok {
+		return sql.ErrNoRows
+	}
+	delete(r.groups, id)
+	return nil
+}
+
+var _ repository.SCIMRepository = (*memSCIMRepo)(nil)
+
+type scimTestEnv struct {
+	users      *memSCIMUsers
+	businesses *memSCIMBusinesses
+	repo       *memSCIMRepo
+	audits     *testutil.MockAuditRepo
+	uc         SCIMUsecase
+	client     *entity.SCIMToken
+}
+
+// newSCIMTestEnv provisions business 1, owned by user 1, through a token
+// created by its admin, user 2.
+func newSCIMTestEnv(t *testing.T) *scimTestEnv {
+	t.Helper()
+	users := &memSCIMUsers{MockUserRepo: new(testutil.MockUserRepo), users: map[int64]*entity.User{
+		1: {ID: 1, Username: "owner", Email: "owner@example.com"},
+		2: {ID: 2, Username: "admin", Email: "admin@example.com"},
+	}}
+	env := &scimTestEnv{
+		users:      users,
+		businesses: &memSCIMBusinesses{MockBusinessRepo: new(testutil.MockBusinessRepo), roles: map[int64]int{1: BusinessRoleOwner, 2: BusinessRoleAdmin}},
+		repo:       &memSCIMRepo{users: users, tokens: map[int64]*entity.SCIMToken{}, scim: map[int64]*entity.SCIMUser{}, groups: map[int64]*entity.SCIMGroup{}},
+		audits:     new(testutil.MockAuditRepo),
+	}
+	env.audits.On("Log", mock.Anything, mock.Anything).Return(nil)
+	env.uc = NewSCIMUsecase("https://auth.example.com/api/v1/scim/v2/", env.repo, env.businesses, env.users, env.audits, nil)
+
+	_, token, err := env.uc.CreateToken(context.Background(), 2, 1)
+	require.NoError(t, err)
+	env.client, err = env.uc.Authenticate(context.Background(), token)
+	require.NoError(t, err)
+	return env
+}
+
+func (env *scimTestEnv) assertAudited(t *testing.T, action string) {
+	t.Helper()
+	env.audits.AssertCalled(t, "Log", mock.Anything, mock.MatchedBy(func(a *entity.AuditLog) bool {
+		return a.Action == action && a.BusinessID == 1 && a.UserID == 2
+	}))
+}
+
+func scimOps(t *testing.T, ops string) []scim.Operation {
+	t.Helper()
+	var operations []scim.Operation
+	require.NoError(t, json.Unmarshal([]byte(ops), &operations))
+	return operations
+}
+
+func (env *scimTestEnv) createUser(t *testing.T, userName string) *scim.User {
+	t.Helper()
+	user, err := env.uc.CreateUser(context.Background(), env.client, &scim.User{
+		UserName:   userName,
+		ExternalID: "ext-" + userName,
+		Name:       &scim.Name{GivenName: "Ada", FamilyName: "Lovelace"},
+	})
+	require.NoError(t, err)
+	return user
+}
+
+func TestSCIM_Token(t *testing.T) {
+	ctx := context.Background()
+	env := newSCIMTestEnv(t)
+	env.assertAudited(t, entity.AuditActionBusinessSCIMTokenCreated)
+
+	_, _, err := env.uc.CreateToken(ctx, 100, 1)
+	assert.ErrorIs(t, err, ErrSCIMNotAllowed, "only admins manage the token")
+
+	_, err = env.uc.Authenticate(ctx, "scim_wrong")
+	assert.ErrorIs(t, err, ErrInvalidSCIMToken)
+	_, err = env.uc.Authenticate(ctx, "pat_wrong")
+	assert.ErrorIs(t, err, ErrInvalidSCIMToken)
+
+	record, token, err := env.uc.CreateToken(ctx, 1, 1)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(token, entity.SCIMTokenPrefix))
+	assert.NotContains(t, record.TokenHash, token[len(entity.SCIMTokenPrefix):], "only the hash is stored")
+	_, err = env.uc.Authenticate(ctx, token)
+	require.NoError(t, err)
+
+	require.NoError(t, env.uc.RevokeToken(ctx, 2, 1))
+	env.assertAudited(t, entity.AuditActionBusinessSCIMTokenRevoked)
+	_, err = env.uc.Authenticate(ctx, token)
+	assert.ErrorIs(t, err, ErrInvalidSCIMToken)
+	_, err = env.uc.GetToken(ctx, 2, 1)
+	assert.ErrorIs(t, err, ErrSCIMNotEnabled)
+}
+
+func TestSCIM_CreateUser_ProvisionsAccount(t *testing.T) {
+	ctx := context.Background()
+	env := newSCIMTestEnv(t)
+
+	user := env.createUser(t, "ada@example.com")
+	assert.Equal(t, "ada@example.com", user.UserName)
+	assert.Equal(t, "ada@example.com", user.PrimaryEmail())
+	assert.True(t, user.IsActive())
+	assert.Equal(t, `W/"1"`, user.Meta.Version)
+	assert.Equal(t, "https://auth.example.com/api/v1/scim/v2/Users/"+user.ID, user.Meta.Location)
+
+	account, err := env.users.GetByEmail(ctx, "ada@example.com")
+	require.NoError(t, err)
+	assert.True(t, account.EmailVerified)
+	assert.Equal(t, "ada", account.Username)
+	assert.Equal(t, BusinessRoleMember, env.businesses.roles[account.ID])
+	env.assertAudited(t, entity.AuditActionSCIMUserCreated)
+
+	_, err = env.uc.CreateUser(ctx, env.client, &scim.User{UserName: "ADA@example.com"})
+	assert.ErrorIs(t, err, ErrSCIMConflict)
+	_, err = env.uc.CreateUser(ctx, env.client, &scim.User{UserName: "eve@elsewhere.com"})
+	assert.ErrorIs(t, err, ErrSCIMInvalidValue, "only verified domains can be provisioned")
+	_, err = env.uc.CreateUser(ctx, env.client, &scim.User{UserName: "bob"})
+	assert.ErrorIs(t, err, ErrSCIMInvalidValue, "an email is needed")
+
+	bob, err := env.uc.CreateUser(ctx, env.client, &scim.User{UserName: "bob", Emails: []scim.Email{{Value: "bob@example.com", Primary: true}}})
+	require.NoError(t, err)
+	assert.Equal(t, "bob", bob.UserName)
+	assert.Equal(t, "bob@example.com", bob.PrimaryEmail())
+
+	got, err := env.uc.GetUser(ctx, env.client, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, got.ID)
+	assert.Equal(t, "Lovelace", got.Name.FamilyName)
+	_, err = env.uc.GetUser(ctx, env.client, "999")
+	assert.ErrorIs(t, err, ErrSCIMNotFound)
+	_, err = env.uc.GetUser(ctx, &entity.SCIMToken{BusinessID: 2}, user.ID)
+	assert.ErrorIs(t, err, ErrSCIMNotFound, "users of other businesses are invisible")
+}
+
+func TestSCIM_CreateUser_AdoptsExistingAccount(t *testing.T) {
+	ctx := context.Background()
+	env := newSCIMTestEnv(t)
+
+	user := env.createUser(t, "admin@example.com")
+	assert.Equal(t, "2", user.ID)
+	assert.Len(t, env.users.users, 2, "no account is created")
+	assert.Equal(t, BusinessRoleAdmin, env.businesses.roles[2], "the existing role is kept")
+
+	_, err := env.uc.CreateUser(ctx, env.client, &scim.User{UserName: "owner@example.com", Active: new(scim.Bool)})
+	assert.ErrorIs(t, err, ErrSCIMMutability, "the owner cannot be provisioned inactive")
+}
+
+func TestSCIM_ListUsers(t *testing.T) {
+	ctx := context.Background()
+	env := newSCIMTestEnv(t)
+	for _, name := range []string{"a@example.com", "b@example.com", "c@example.com"} {
+		env.createUser(t, name)
+	}
+
+	page, err := env.uc.ListUsers(ctx, env.client, scim.ListQuery{StartIndex: 2, Count: 1})
+	require.NoError(t, err)
+	assert.Equal(t, 3, page.TotalResults)
+	assert.Equal(t, 1, page.ItemsPerPage)
+	assert.Equal(t, "b@example.com", page.Resources[0].UserName)
+
+	page, err = env.uc.ListUsers(ctx, env.client, scim.ListQuery{Filter: `userName eq "C@EXAMPLE.COM"`, StartIndex: 1, Count: 10})
+	require.NoError(t, err)
+	require.Equal(t, 1, page.TotalResults)
+	assert.Equal(t, "c@example.com", page.Resources[0].UserName)
+
+	_, err = env.uc.ListUsers(ctx, env.client, scim.ListQuery{Filter: `userName eq`})
+	var scimErr *scim.Error
+	assert.ErrorAs(t, err, &scimErr)
+}
+
+func TestSCIM_PatchUser_DeactivatesAndReactivates(t *testing.T) {
+	ctx := context.Background()
+	env := newSCIMTestEnv(t)
+	user := env.createUser(t, "ada@example.com")
+	id := user.ID
+	account, _ := env.users.GetByEmail(ctx, "ada@example.com")
+
+	_, err := env.uc.PatchUser(ctx, env.client, id, scimOps(t, `[{"op": "Replace", "path": "active", "value": "False"}]`), `W/"2"`)
+	assert.ErrorIs(t, err, ErrSCIMPreconditionFailed)
+
+	patched, err := env.uc.PatchUser(ctx, env.client, id, scimOps(t, `[{"op": "Replace", "path": "active", "value": "False"}]`), user.Meta.Version)
+	require.NoError(t, err)
+	assert.False(t, patched.IsActive())
+	assert.Equal(t, `W/"2"`, patched.Meta.Version)
+	assert.NotContains(t, env.businesses.roles, account.ID, "an inactive user leaves the business")
+	env.assertAudited(t, entity.AuditActionSCIMUserDeactivated)
+
+	patched, err = env.uc.PatchUser(ctx, env.client, id, scimOps(t, `[{"op": "replace", "value": {"active": true, "displayName": "Ada"}}]`), "")
+	require.NoError(t, err)
+	assert.True(t, patched.IsActive())
+	assert.Equal(t, "Ada", patched.DisplayName)
+	assert.Equal(t, BusinessRoleMember, env.businesses.roles[account.ID])
+	env.assertAudited(t, entity.AuditActionSCIMUserReactivated)
+
+	_, err = env.uc.PatchUser(ctx, env.client, id, scimOps(t, `[{"op": "replace", "path": "userName", "value": ""}]`), "")
+	assert.ErrorIs(t, err, ErrSCIMInvalidValue)
+	_, err = env.uc.PatchUser(ctx, env.client, id, scimOps(t, `[{"op": "replace", "path": "active", "value": "maybe"}]`), "")
+	assert.ErrorIs(t, err, ErrSCIMInvalidValue)
+}
+
+func TestSCIM_ReplaceUser_ChangesEmail(t *testing.T) {
+	ctx := context.Background()
+	env := newSCIMTestEnv(t)
+	user := env.createUser(t, "ada@example.com")
+	env.createUser(t, "bob@example.com")
+
+	_, err := env.uc.ReplaceUser(ctx, env.client, user.ID, &scim.User{UserName: "bob@example.com"}, "")
+	assert.ErrorIs(t, err, ErrSCIMConflict)
+	_, err = env.uc.ReplaceUser(ctx, env.client, user.ID, &scim.User{UserName: "ada@elsewhere.com"}, "")
+	assert.ErrorIs(t, err, ErrSCIMInvalidValue)
+
+	replaced, err := env.uc.ReplaceUser(ctx, env.client, user.ID, &scim.User{UserName: "ada.king@example.com"}, "")
+	require.NoError(t, err)
+	assert.Equal(t, "ada.king@example.com", replaced.PrimaryEmail())
+	assert.Nil(t, replaced.Name, "replace drops attributes not given")
+	_, err = env.users.GetByEmail(ctx, "ada.king@example.com")
+	assert.NoError(t, err, "the account's email changed")
+}
+
+func TestSCIM_OwnerStaysInBusiness(t *testing.T) {
+	ctx := context.Background()
+	env := newSCIMTestEnv(t)
+	owner := env.createUser(t, "owner@example.com")
+
+	_, err := env.uc.PatchUser(ctx, env.client, owner.ID, scimOps(t, `[{"op": "replace", "path": "active", "value": false}]`), "")
+	assert.ErrorIs(t, err, ErrSCIMMutability)
+	assert.ErrorIs(t, env.uc.DeleteUser(ctx, env.client, owner.ID, ""), ErrSCIMMutability)
+	assert.Equal(t, BusinessRoleOwner, env.businesses.roles[1])
+}
+
+func TestSCIM_DeleteUser(t *testing.T) {
+	ctx := context.Background()
+	env := newSCIMTestEnv(t)
+	user := env.createUser(t, "ada@example.com")
+	group, err := env.uc.CreateGroup(ctx, env.client, &scim.Group{DisplayName: "Engineering", Members: []scim.Reference{{Value: user.ID}}})
+	require.NoError(t, err)
+
+	require.NoError(t, env.uc.DeleteUser(ctx, env.client, user.ID, user.Meta.Version))
+	env.assertAudited(t, entity.AuditActionSCIMUserDeleted)
+	_, err = env.uc.GetUser(ctx, env.client, user.ID)
+	assert.ErrorIs(t, err, ErrSCIMNotFound)
+	account, err := env.users.GetByEmail(ctx, "ada@example.com")
+	require.NoError(t, err, "the account stays")
+	assert.NotContains(t, env.businesses.roles, account.ID)
+
+	got, err := env.uc.GetGroup(ctx, env.client, group.ID)
+	require.NoError(t, err)
+	assert.Empty(t, got.Members)
+	assert.NotEqual(t, group.Meta.Version, got.Meta.Version)
+}
+
+func TestSCIM_Groups_GrantAdmin(t *testing.T) {
+	ctx := context.Background()
+	env := newSCIMTestEnv(t)
+	ada := env.createUser(t, "ada@example.com")
+	bob := env.createUser(t, "bob@example.com")
+	owner := env.createUser(t, "owner@example.com")
+	adaAccount, _ := env.users.GetByEmail(ctx, "ada@example.com")
+	bobAccount, _ := env.users.GetByEmail(ctx, "bob@example.com")
+
+	_, err := env.uc.CreateGroup(ctx, env.client, &scim.Group{DisplayName: "Admin", Members: []scim.Reference{{Value: "999"}}})
+	assert.ErrorIs(t, err, ErrSCIMInvalidValue, "members must be provisioned users")
+
+	group, err := env.uc.CreateGroup(ctx, env.client, &scim.Group{DisplayName: "Admin", Members: []scim.Reference{{Value: ada.ID}, {Value: owner.ID}}})
+	require.NoError(t, err)
+	env.assertAudited(t, entity.AuditActionSCIMGroupCreated)
+	assert.Equal(t, BusinessRoleAdmin, env.businesses.roles[adaAccount.ID])
+	assert.Equal(t, BusinessRoleOwner, env.businesses.roles[1], "the owner keeps their role")
+	require.Len(t, group.Members, 2)
+	assert.Equal(t, "owner@example.com", group.Members[0].Display, "members are listed by ID")
+	assert.Equal(t, "ada@example.com", group.Members[1].Display)
+
+	_, err = env.uc.CreateGroup(ctx, env.client, &scim.Group{DisplayName: "admin"})
+	assert.ErrorIs(t, err, ErrSCIMConflict)
+
+	got, err := env.uc.GetUser(ctx, env.client, ada.ID)
+	require.NoError(t, err)
+	require.Len(t, got.Groups, 1)
+	assert.Equal(t, group.ID, got.Groups[0].Value)
+
+	patched, err := env.uc.PatchGroup(ctx, env.client, group.ID, scimOps(t, `[
+		{"op": "add", "path": "members", "value": [{"value": "`+bob.ID+`"}]},
+		{"op": "remove", "path": "members[value eq \"`+ada.ID+`\"]"}
+	]`), group.Meta.Version)
+	require.NoError(t, err)
+	assert.Len(t, patched.Members, 2)
+	assert.Equal(t, BusinessRoleMember, env.businesses.roles[adaAccount.ID])
+	assert.Equal(t, BusinessRoleAdmin, env.businesses.roles[bobAccount.ID])
+	env.assertAudited(t, entity.AuditActionSCIMGroupUpdated)
+
+	_, err = env.uc.PatchGroup(ctx, env.client, group.ID, scimOps(t, `[{"op": "replace", "path": "displayName", "value": "x"}]`), group.Meta.Version)
+	assert.ErrorIs(t, err, ErrSCIMPreconditionFailed)
+
+	// Renaming the group takes the role it granted.
+	_, err = env.uc.ReplaceGroup(ctx, env.client, group.ID, &scim.Group{DisplayName: "Former admins", Members: patched.Members}, patched.Meta.Version)
+	require.NoError(t, err)
+	assert.Equal(t, BusinessRoleMember, env.businesses.roles[bobAccount.ID])
+
+	_, err = env.uc.ReplaceGroup(ctx, env.client, group.ID, &scim.Group{DisplayName: "admin", Members: patched.Members}, "")
+	require.NoError(t, err)
+	assert.Equal(t, BusinessRoleAdmin, env.businesses.roles[bobAccount.ID])
+
+	list, err := env.uc.ListGroups(ctx, env.client, scim.ListQuery{Filter: `displayName eq "ADMIN"`, StartIndex: 1, Count: 10})
+	require.NoError(t, err)
+	assert.Equal(t, 1, list.TotalResults)
+
+	require.NoError(t, env.uc.DeleteGroup(ctx, env.client, group.ID, ""))
+	env.assertAudited(t, entity.AuditActionSCIMGroupDeleted)
+	assert.Equal(t, BusinessRoleMember, env.businesses.roles[bobAccount.ID])
+	assert.ErrorIs(t, env.uc.DeleteGroup(ctx, env.client, group.ID, ""), ErrSCIMNotFound)
+}
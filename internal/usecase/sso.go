@@ -3,174 +3,384 @@ package usecase
 import (
 	"context"
 	"database/sql"
-	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
-	"net/http"
+	"log/slog"
+	"slices"
 	"time"
 
 	"golang.org/x/oauth2"
-	"golang.org/x/oauth2/google"
 
 	"github.com/Prashant2307200/auth-service/internal/entity"
+	"github.com/Prashant2307200/auth-service/internal/infrastructure/repository"
 	"github.com/Prashant2307200/auth-service/internal/usecase/interfaces"
+	"github.com/Prashant2307200/auth-service/pkg/hash"
 )
 
 var (
-	ErrGoogleAuthFailed   = errors.New("google authentication failed")
-	ErrGoogleEmailMissing = errors.New("google email not available")
+	ErrSSOAuthFailed           = errors.New("identity provider authentication failed")
+	ErrSSOEmailMissing         = errors.New("identity provider returned no email")
+	ErrUnknownIdentityProvider = errors.New("unknown identity provider")
+	// ErrSSOAccountExists is returned instead of linking a provider account to
+	// the user with the same email when either side has not verified it.
+	ErrSSOAccountExists         = errors.New("an account with this email already exists")
+	ErrIdentityAlreadyLinked    = errors.New("identity is linked to another user")
+	ErrIdentityNotFound         = errors.New("linked identity not found")
+	ErrLastLoginMethod          = errors.New("cannot remove the last way to sign in")
+	ErrReauthenticationRequired = errors.New("confirm with a recent sign-in, your password or an MFA code")
 )
 
-type GoogleUserInfo struct {
-	ID            string `json:"id"`
-	Email         string `json:"email"`
-	VerifiedEmail bool   `json:"verified_email"`
-	Name          string `json:"name"`
-	GivenName     string `json:"given_name"`
-	FamilyName    string `json:"family_name"`
-	Picture       string `json:"picture"`
+const (
+	// SSOLoginTTL bounds how long a user may take to sign in at the provider.
+	SSOLoginTTL = 10 * time.Minute
+	// ReauthenticationWindow is how long after signing in a session may link
+	// identities without confirming the password or an MFA code.
+	ReauthenticationWindow = 10 * time.Minute
+)
+
+// SSOLogin is a sign-in in progress at an identity provider. The caller keeps
+// it, e.g. in a cookie, and passes it back with the callback.
+type SSOLogin struct {
+	Provider string
+	State    string
+	Nonce    string
+	// Verifier is the PKCE code verifier.
+	Verifier string
+	// LinkUserID is set when the sign-in links the provider account to a
+	// signed-in user rather than signing in.
+	LinkUserID int64
 }
 
-type SSOConfig struct {
-	GoogleClientID     string
-	GoogleClientSecret string
-	GoogleRedirectURL  string
+// Reauthentication proves the signed-in user is present before an identity
+// is linked: the session signed in within ReauthenticationWindow, or the
+// request carries the account password or an MFA code.
+type Reauthentication struct {
+	SessionID string
+	Password  string
+	Code      string
 }
 
 type SSOUsecase interface {
-	GetGoogleAuthURL(state string) string
-	HandleGoogleCallback(ctx context.Context, code string) (accessToken, refreshToken string, user *entity.User, isNewUser bool, err error)
+	// Providers returns the names of the configured identity providers.
+	Providers() []string
+	// BeginLogin starts a sign-in with provider and returns it along with the
+	// URL to send the user to.
+	BeginLogin(ctx context.Context, provider string) (*SSOLogin, string, error)
+	// HandleCallback completes login with the code the provider returned. It
+	// returns a *MFARequiredError instead of tokens when the account has MFA
+	// enabled.
+	HandleCallback(ctx context.Context, login *SSOLogin, code string) (accessToken, refreshToken string, user *entity.User, isNewUser bool, err error)
+
+	ListIdentities(ctx context.Context, userID int64) ([]*entity.UserIdentity, error)
+	// BeginLink starts linking a provider account to userID, like BeginLogin,
+	// once reauth shows the user is present.
+	BeginLink(ctx context.Context, userID int64, provider string, reauth Reauthentication) (*SSOLogin, string, error)
+	// CompleteLink links the account the provider signed in to login.LinkUserID.
+	CompleteLink(ctx context.Context, login *SSOLogin, code string) (*entity.UserIdentity, error)
+	// Unlink removes a linked identity unless it is the user's last way to
+	// sign in.
+	Unlink(ctx context.Context, userID, id int64) error
 }
 
 type ssoUsecase struct {
-	userRepo      interfaces.UserRepo
-	tokenService  interfaces.TokenService
-	oauthConfig   *oauth2.Config
+	userRepo     interfaces.UserRepo
+	identities   repository.UserIdentityRepository
+	tokenService interfaces.TokenService
+	sessions     interfaces.SessionService
+	providers    map[string]interfaces.IdentityProvider
+	names        []string
+	mfaGate      *MFAGate
+	auditor      *UserAuditor
 }
 
-func NewSSOUsecase(userRepo interfaces.UserRepo, tokenService interfaces.TokenService, cfg SSOConfig) SSOUsecase {
-	oauthConfig := &oauth2.Config{
-		ClientID:     cfg.GoogleClientID,
-		ClientSecret: cfg.GoogleClientSecret,
-		RedirectURL:  cfg.GoogleRedirectURL,
-		Scopes: []string{
-			"https://www.googleapis.com/auth/userinfo.email",
-			"https://www.googleapis.com/auth/userinfo.profile",
-		},
-		Endpoint: google.Endpoint,
-	}
-
-	return &ssoUsecase{
+// NewSSOUsecase builds sign-in through the given identity providers.
+// sessions may be nil to leave SSO logins unrecorded, mfaGate nil to skip the
+// second factor, and auditor nil to leave identity changes unaudited.
+func NewSSOUsecase(userRepo interfaces.UserRepo, identities repository.UserIdentityRepository, tokenService interfaces.TokenService, sessions interfaces.SessionService, providers []interfaces.IdentityProvider, mfaGate *MFAGate, auditor *UserAuditor) SSOUsecase {
+	u := &ssoUsecase{
 		userRepo:     userRepo,
+		identities:   identities,
 		tokenService: tokenService,
-		oauthConfig:  oauthConfig,
+		sessions:     sessions,
+		providers:    make(map[string]interfaces.IdentityProvider, len(providers)),
+		mfaGate:      mfaGate,
+		auditor:      auditor,
 	}
+	for _, p := range providers {
+		u.providers[p.Name()] = p
+		u.names = append(u.names, p.Name())
+	}
+	return u
 }
 
-func (u *ssoUsecase) GetGoogleAuthURL(state string) string {
-	return u.oauthConfig.AuthCodeURL(state, oauth2.AccessTypeOffline)
+func (u *ssoUsecase) Providers() []string {
+	return slices.Clone(u.names)
 }
 
-func (u *ssoUsecase) HandleGoogleCallback(ctx context.Context, code string) (string, string, *entity.User, bool, error) {
-	token, err := u.oauthConfig.Exchange(ctx, code)
-	if err != nil {
-		return "", "", nil, false, fmt.Errorf("%w: %v", ErrGoogleAuthFailed, err)
+func (u *ssoUsecase) BeginLogin(ctx context.Context, provider string) (*SSOLogin, string, error) {
+	return u.begin(ctx, provider, 0)
+}
+
+func (u *ssoUsecase) BeginLink(ctx context.Context, userID int64, provider string, reauth Reauthentication) (*SSOLogin, string, error) {
+	if _, ok := u.providers[provider]; !ok {
+		return nil, "", ErrUnknownIdentityProvider
+	}
+	if err := u.reauthenticate(ctx, userID, reauth); err != nil {
+		return nil, "", err
 	}
+	return u.begin(ctx, provider, userID)
+}
 
-	client := u.oauthConfig.Client(ctx, token)
-	resp, err := client.Get("https://www.googleapis.com/oauth2/v2/userinfo")
+func (u *ssoUsecase) begin(ctx context.Context, provider string, linkUserID int64) (*SSOLogin, string, error) {
+	p, ok := u.providers[provider]
+	if !ok {
+		return nil, "", ErrUnknownIdentityProvider
+	}
+	state, err := generateSecureToken(32)
 	if err != nil {
-		return "", "", nil, false, fmt.Errorf("%w: %v", ErrGoogleAuthFailed, err)
+		return nil, "", err
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return "", "", nil, false, ErrGoogleAuthFailed
+	nonce, err := generateSecureToken(32)
+	if err != nil {
+		return nil, "", err
 	}
+	login := &SSOLogin{Provider: provider, State: state, Nonce: nonce, Verifier: oauth2.GenerateVerifier(), LinkUserID: linkUserID}
 
-	body, err := io.ReadAll(resp.Body)
+	authURL, err := p.AuthCodeURL(ctx, login.State, login.Nonce, login.Verifier)
 	if err != nil {
-		return "", "", nil, false, fmt.Errorf("%w: %v", ErrGoogleAuthFailed, err)
+		return nil, "", fmt.Errorf("%w: %v", ErrSSOAuthFailed, err)
 	}
+	return login, authURL, nil
+}
 
-	var googleUser GoogleUserInfo
-	if err := json.Unmarshal(body, &googleUser); err != nil {
-		return "", "", nil, false, fmt.Errorf("%w: %v", ErrGoogleAuthFailed, err)
+// reauthenticate accepts a session that signed in recently, the password or
+// an MFA code, in that order.
+func (u *ssoUsecase) reauthenticate(ctx context.Context, userID int64, in Reauthentication) error {
+	if in.SessionID != "" && u.sessions != nil {
+		session, err := u.sessions.GetSession(ctx, in.SessionID)
+		if err == nil && session.UserID == userID && time.Since(session.CreatedAt) < ReauthenticationWindow {
+			return nil
+		}
+	}
+	if in.Password != "" {
+		user, err := u.userRepo.GetById(ctx, userID)
+		if err != nil {
+			return fmt.Errorf("failed to load user: %w", err)
+		}
+		if user.Password != "" && hash.CheckPassword(user.Password, in.Password) == nil {
+			return nil
+		}
 	}
+	if in.Code != "" && u.mfaGate != nil {
+		err := u.mfaGate.MFA.VerifyCode(ctx, userID, in.Code)
+		if err == nil || errors.Is(err, ErrMFALocked) {
+			return err
+		}
+	}
+	return ErrReauthenticationRequired
+}
 
-	if googleUser.Email == "" {
-		return "", "", nil, false, ErrGoogleEmailMissing
+// exchange redeems code with the provider login was started with.
+func (u *ssoUsecase) exchange(ctx context.Context, login *SSOLogin, code string) (*entity.ExternalIdentity, error) {
+	p, ok := u.providers[login.Provider]
+	if !ok {
+		return nil, ErrUnknownIdentityProvider
+	}
+	external, err := p.Exchange(ctx, code, login.Nonce, login.Verifier)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrSSOAuthFailed, err)
 	}
+	if external.Subject == "" {
+		return nil, ErrSSOAuthFailed
+	}
+	return external, nil
+}
 
-	var user *entity.User
+func (u *ssoUsecase) HandleCallback(ctx context.Context, login *SSOLogin, code string) (string, string, *entity.User, bool, error) {
+	if login.LinkUserID != 0 {
+		return "", "", nil, false, ErrSSOAuthFailed
+	}
+	external, err := u.exchange(ctx, login, code)
+	if err != nil {
+		return "", "", nil, false, err
+	}
 
-	user, err = u.userRepo.GetByGoogleID(ctx, googleUser.ID)
+	identity, err := u.identities.GetByProviderSubject(ctx, external.Provider, external.Subject)
 	if err == nil {
-		accessToken, refreshToken, err := u.generateTokens(ctx, user.ID)
-		return accessToken, refreshToken, user, false, err
+		user, err := u.userRepo.GetById(ctx, identity.UserID)
+		if err != nil {
+			return "", "", nil, false, fmt.Errorf("failed to load linked user: %w", err)
+		}
+		if err := u.identities.TouchLastUsed(ctx, identity.ID); err != nil {
+			slog.Warn("Failed to record identity use", slog.Int64("identity_id", identity.ID), slog.Any("error", err))
+		}
+		return u.signIn(ctx, user, external.Provider)
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return "", "", nil, false, fmt.Errorf("failed to look up identity: %w", err)
 	}
 
-	user, err = u.userRepo.GetByEmail(ctx, googleUser.Email)
+	if external.Email == "" {
+		return "", "", nil, false, ErrSSOEmailMissing
+	}
+
+	user, err := u.userRepo.GetByEmail(ctx, external.Email)
 	if err == nil {
-		if err := u.userRepo.LinkGoogleID(ctx, user.ID, googleUser.ID); err != nil {
-			return "", "", nil, false, fmt.Errorf("failed to link google account: %w", err)
+		// Linking on email alone hands the account to whoever controls the
+		// provider account, so both sides must have proven the address.
+		// Otherwise the user signs in and links the provider explicitly.
+		if !external.EmailVerified || !user.EmailVerified {
+			return "", "", nil, false, ErrSSOAccountExists
 		}
-		if err := u.userRepo.MarkEmailVerified(ctx, user.ID); err != nil {
-			// Non-fatal, just log
+		if _, err := u.link(ctx, user.ID, external, "sign_in"); err != nil {
+			return "", "", nil, false, err
 		}
-		accessToken, refreshToken, err := u.generateTokens(ctx, user.ID)
-		return accessToken, refreshToken, user, false, err
+		return u.signIn(ctx, user, external.Provider)
 	}
-
 	if !errors.Is(err, sql.ErrNoRows) {
 		return "", "", nil, false, fmt.Errorf("failed to check existing user: %w", err)
 	}
 
 	newUser := &entity.User{
-		Username:        generateUsernameFromEmail(googleUser.Email),
-		Email:           googleUser.Email,
-		Password:        "",
-		ProfilePic:      googleUser.Picture,
-		Role:            entity.RoleUser,
-		EmailVerified:   true,
-		EmailVerifiedAt: func() *time.Time { t := time.Now(); return &t }(),
-		GoogleID:        &googleUser.ID,
+		Username:   generateUsernameFromEmail(external.Email),
+		Email:      external.Email,
+		Password:   "",
+		ProfilePic: external.Picture,
+		Role:       entity.RoleUser,
 	}
-
 	userID, err := u.userRepo.Create(ctx, newUser)
 	if err != nil {
 		return "", "", nil, false, fmt.Errorf("failed to create user: %w", err)
 	}
 	newUser.ID = userID
 
-	if err := u.userRepo.LinkGoogleID(ctx, userID, googleUser.ID); err != nil {
-		// Non-fatal, user was created
+	if _, err := u.link(ctx, userID, external, "sign_up"); err != nil {
+		return "", "", nil, false, err
 	}
-	if err := u.userRepo.MarkEmailVerified(ctx, userID); err != nil {
-		// Non-fatal
+	if external.EmailVerified {
+		if err := u.userRepo.MarkEmailVerified(ctx, userID); err != nil {
+			slog.Warn("Failed to mark email verified", slog.Int64("user_id", userID), slog.Any("error", err))
+		} else {
+			now := time.Now()
+			newUser.EmailVerified, newUser.EmailVerifiedAt = true, &now
+		}
 	}
 
 	accessToken, refreshToken, err := u.generateTokens(ctx, userID)
 	return accessToken, refreshToken, newUser, true, err
 }
 
-func (u *ssoUsecase) generateTokens(ctx context.Context, userID int64) (string, string, error) {
-	accessToken, err := u.tokenService.GenerateAccessToken(userID)
+func (u *ssoUsecase) ListIdentities(ctx context.Context, userID int64) ([]*entity.UserIdentity, error) {
+	return u.identities.ListByUser(ctx, userID)
+}
+
+func (u *ssoUsecase) CompleteLink(ctx context.Context, login *SSOLogin, code string) (*entity.UserIdentity, error) {
+	if login.LinkUserID == 0 {
+		return nil, ErrSSOAuthFailed
+	}
+	external, err := u.exchange(ctx, login, code)
 	if err != nil {
-		return "", "", fmt.Errorf("failed to generate access token: %w", err)
+		return nil, err
 	}
 
-	refreshToken, err := u.tokenService.GenerateRefreshToken(userID)
+	identity, err := u.identities.GetByProviderSubject(ctx, external.Provider, external.Subject)
+	if err == nil {
+		if identity.UserID != login.LinkUserID {
+			return nil, ErrIdentityAlreadyLinked
+		}
+		return identity, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("failed to look up identity: %w", err)
+	}
+	return u.link(ctx, login.LinkUserID, external, "explicit")
+}
+
+func (u *ssoUsecase) Unlink(ctx context.Context, userID, id int64) error {
+	identities, err := u.identities.ListByUser(ctx, userID)
 	if err != nil {
-		return "", "", fmt.Errorf("failed to generate refresh token: %w", err)
+		return fmt.Errorf("failed to list identities: %w", err)
+	}
+	var identity *entity.UserIdentity
+	for _, i := range identities {
+		if i.ID == id {
+			identity = i
+		}
+	}
+	if identity == nil {
+		return ErrIdentityNotFound
 	}
 
-	if err := u.tokenService.StoreRefreshToken(ctx, userID, refreshToken); err != nil {
-		return "", "", fmt.Errorf("failed to store refresh token: %w", err)
+	if len(identities) == 1 {
+		ok, err := u.hasOtherLoginMethod(ctx, userID)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return ErrLastLoginMethod
+		}
 	}
 
-	return accessToken, refreshToken, nil
+	if err := u.identities.Delete(ctx, userID, id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrIdentityNotFound
+		}
+		return fmt.Errorf("failed to unlink identity: %w", err)
+	}
+	u.auditor.Record(ctx, userID, entity.AuditActionUserIdentityUnlinked, "user_identity", &identity.ID,
+		map[string]interface{}{"provider": identity.Provider, "email": identity.Email})
+	return nil
+}
+
+// hasOtherLoginMethod reports whether the user can sign in without any
+// linked identity: with a password or a passkey.
+func (u *ssoUsecase) hasOtherLoginMethod(ctx context.Context, userID int64) (bool, error) {
+	user, err := u.userRepo.GetById(ctx, userID)
+	if err != nil {
+		return false, fmt.Errorf("failed to load user: %w", err)
+	}
+	if user.Password != "" {
+		return true, nil
+	}
+	if u.mfaGate == nil || u.mfaGate.Passkeys == nil {
+		return false, nil
+	}
+	has, err := u.mfaGate.Passkeys.HasCredentials(ctx, userID)
+	if err != nil {
+		return false, fmt.Errorf("failed to check passkeys: %w", err)
+	}
+	return has, nil
+}
+
+// link records external as userID's and audits it; via says how the link
+// was made.
+func (u *ssoUsecase) link(ctx context.Context, userID int64, external *entity.ExternalIdentity, via string) (*entity.UserIdentity, error) {
+	identity := &entity.UserIdentity{
+		UserID:   userID,
+		Provider: external.Provider,
+		Subject:  external.Subject,
+		Email:    external.Email,
+	}
+	if err := u.identities.Create(ctx, identity); err != nil {
+		return nil, fmt.Errorf("failed to link %s account: %w", external.Provider, err)
+	}
+	u.auditor.Record(ctx, userID, entity.AuditActionUserIdentityLinked, "user_identity", &identity.ID,
+		map[string]interface{}{"provider": identity.Provider, "email": identity.Email, "via": via})
+	return identity, nil
+}
+
+// signIn issues tokens for an existing user once any second factor is met.
+// The challenge records the provider as the first factor.
+func (u *ssoUsecase) signIn(ctx context.Context, user *entity.User, provider string) (string, string, *entity.User, bool, error) {
+	if err := u.mfaGate.Require(ctx, user.ID, provider); err != nil {
+		return "", "", user, false, err
+	}
+	accessToken, refreshToken, err := u.generateTokens(ctx, user.ID)
+	return accessToken, refreshToken, user, false, err
+}
+
+func (u *ssoUsecase) generateTokens(ctx context.Context, userID int64) (string, string, error) {
+	return issueSessionTokens(ctx, u.tokenService, u.sessions, userID)
 }
 
 func generateUsernameFromEmail(email string) string {
@@ -0,0 +1,354 @@
+package usecase
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Prashant2307200/auth-service/internal/entity"
+	"github.com/Prashant2307200/auth-service/internal/infrastructure/repository"
+	"github.com/Prashant2307200/auth-service/internal/testutil"
+	"github.com/Prashant2307200/auth-service/internal/usecase/interfaces"
+	"github.com/Prashant2307200/auth-service/pkg/hash"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type memUserIdentityRepo struct {
+	identities []*entity.UserIdentity
+	nextID     int64
+}
+
+func (r *memUserIdentityRepo) Create(_ context.Context, identity *entity.UserIdentity) error {
+	r.nextID++
+	identity.ID = r.nextID
+	identity.CreatedAt = time.Now()
+	r.identities = append(r.identities, identity)
+	return nil
+}
+
+func (r *memUserIdentityRepo) GetByProviderSubject(_ context.Context, provider, subject string) (*entity.UserIdentity, error) {
+	for _, i := range r.identities {
+		if i.Provider == provider && i.Subject == subject {
+			return i, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (r *memUserIdentityRepo) ListByUser(_ context.Context, userID int64) ([]*entity.UserIdentity, error) {
+	var out []*entity.UserIdentity
+	for _, i := range r.identities {
+		if i.UserID == userID {
+			out = append(out, i)
+		}
+	}
+	return out, nil
+}
+
+func (r *memUserIdentityRepo) CountByUser(ctx context.Context, userID int64) (int, error) {
+	identities, _ := r.ListByUser(ctx, userID)
+	return len(identities), nil
+}
+
+func (r *memUserIdentityRepo) TouchLastUsed(_ context.Context, id int64) error {
+	for _, i := range r.identities {
+		if i.ID == id {
+			now := time.Now()
+			i.LastUsedAt = &now
+		}
+	}
+	return nil
+}
+
+func (r *memUserIdentityRepo) Delete(_ context.Context, userID, id int64) error {
+	for n, i := range r.identities {
+		if i.ID == id && i.UserID == userID {
+			r.identities = append(r.identities[:n], r.identities[n+1:]...)
+			return nil
+		}
+	}
+	return sql.ErrNoRows
+}
+
+var _ repository.UserIdentityRepository = (*memUserIdentityRepo)(nil)
+
+// fakeIdentityProvider accepts code "good-code" and returns identity.
+type fakeIdentityProvider struct {
+	name     string
+	identity entity.ExternalIdentity
+	nonce    string
+	verifier string
+}
+
+func (p *fakeIdentityProvider) Name() string { return p.name }
+
+func (p *fakeIdentityProvider) AuthCodeURL(_ context.Context, state, nonce, verifier string) (string, error) {
+	return "https://idp.example.com/authorize?state=" + state, nil
+}
+
+func (p *fakeIdentityProvider) Exchange(_ context.Context, code, nonce, verifier string) (*entity.ExternalIdentity, error) {
+	if code != "good-code" {
+		return nil, errors.New("invalid_grant")
+	}
+	p.nonce, p.verifier = nonce, verifier
+	identity := p.identity
+	identity.Provider = p.name
+	return &identity, nil
+}
+
+type ssoTestEnv struct {
+	users      *testutil.MockUserRepo
+	identities *memUserIdentityRepo
+	sessions   *testutil.MockSessionService
+	audits     *testutil.MockAuditRepo
+	mfa        *stubMFA
+	passkeys   *stubPasskeys
+	uc         SSOUsecase
+}
+
+type stubPasskeys struct{ has bool }
+
+func (p *stubPasskeys) HasCredentials(context.Context, int64) (bool, error) { return p.has, nil }
+
+func newSSOTestEnv(provider *fakeIdentityProvider) *ssoTestEnv {
+	env := &ssoTestEnv{
+		users:      new(testutil.MockUserRepo),
+		identities: &memUserIdentityRepo{},
+		sessions:   new(testutil.MockSessionService),
+		audits:     new(testutil.MockAuditRepo),
+		mfa:        &stubMFA{totp: "123456"},
+		passkeys:   &stubPasskeys{},
+	}
+	tokenService := new(testutil.MockTokenService)
+	tokenService.On("GenerateRefreshToken", mock.Anything, mock.AnythingOfType("string")).Return("refresh", nil)
+	tokenService.On("StoreRefreshToken", mock.Anything, mock.AnythingOfType("string"), "refresh").Return(nil)
+	tokenService.On("GenerateAccessTokenForSession", mock.Anything, mock.AnythingOfType("string")).Return("access", nil)
+	env.sessions.On("CreateSession", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(&entity.UserSession{ID: "sess-new"}, nil)
+	businesses := new(testutil.MockBusinessRepo)
+	businesses.On("GetUserBusinesses", mock.Anything, mock.Anything).Return([]*entity.Business{{ID: 1}}, nil)
+	env.audits.On("Log", mock.Anything, mock.Anything).Return(nil)
+
+	gate := NewMFAGate(env.mfa, newMemChallengeStore())
+	gate.Passkeys = env.passkeys
+	env.uc = NewSSOUsecase(env.users, env.identities, tokenService, env.sessions, []interfaces.IdentityProvider{provider}, gate, NewUserAuditor(env.audits, businesses))
+	return env
+}
+
+func (env *ssoTestEnv) auditedActions() []string {
+	var actions []string
+	for _, call := range env.audits.Calls {
+		if call.Method == "Log" {
+			actions = append(actions, call.Arguments.Get(1).(*entity.AuditLog).Action)
+		}
+	}
+	return actions
+}
+
+func TestSSO_BeginLogin(t *testing.T) {
+	env := newSSOTestEnv(&fakeIdentityProvider{name: "github"})
+
+	assert.Equal(t, []string{"github"}, env.uc.Providers())
+
+	login, authURL, err := env.uc.BeginLogin(context.Background(), "github")
+	require.NoError(t, err)
+	assert.Equal(t, "github", login.Provider)
+	assert.NotEmpty(t, login.State)
+	assert.NotEmpty(t, login.Nonce)
+	assert.NotEmpty(t, login.Verifier)
+	assert.Zero(t, login.LinkUserID)
+	assert.Equal(t, "https://idp.example.com/authorize?state="+login.State, authURL)
+
+	_, _, err = env.uc.BeginLogin(context.Background(), "gitlab")
+	assert.ErrorIs(t, err, ErrUnknownIdentityProvider)
+}
+
+func TestSSO_HandleCallback_NewUser(t *testing.T) {
+	ctx := context.Background()
+	provider := &fakeIdentityProvider{name: "github", identity: entity.ExternalIdentity{Subject: "42", Email: "ada@example.com", EmailVerified: true}}
+	env := newSSOTestEnv(provider)
+
+	env.users.On("GetByEmail", ctx, "ada@example.com").Return(nil, sql.ErrNoRows)
+	env.users.On("Create", ctx, mock.MatchedBy(func(u *entity.User) bool { return u.Email == "ada@example.com" && u.Username == "ada" })).Return(int64(9), nil)
+	env.users.On("MarkEmailVerified", ctx, int64(9)).Return(nil)
+
+	login := &SSOLogin{Provider: "github", State: "s", Nonce: "n", Verifier: "v"}
+	access, refresh, user, isNew, err := env.uc.HandleCallback(ctx, login, "good-code")
+	require.NoError(t, err)
+	assert.Equal(t, "access", access)
+	assert.Equal(t, "refresh", refresh)
+	assert.True(t, isNew)
+	assert.Equal(t, int64(9), user.ID)
+	assert.True(t, user.EmailVerified)
+	assert.Equal(t, "n", provider.nonce)
+	assert.Equal(t, "v", provider.verifier)
+
+	require.Len(t, env.identities.identities, 1)
+	assert.Equal(t, int64(9), env.identities.identities[0].UserID)
+	assert.Equal(t, "github", env.identities.identities[0].Provider)
+	assert.Equal(t, "42", env.identities.identities[0].Subject)
+	env.users.AssertExpectations(t)
+}
+
+func TestSSO_HandleCallback_LinkedIdentity(t *testing.T) {
+	ctx := context.Background()
+	// The email changed at the provider; the subject still finds the user.
+	env := newSSOTestEnv(&fakeIdentityProvider{name: "google", identity: entity.ExternalIdentity{Subject: "g-1", Email: "new@example.com", EmailVerified: true}})
+	require.NoError(t, env.identities.Create(ctx, &entity.UserIdentity{UserID: 3, Provider: "google", Subject: "g-1"}))
+
+	env.users.On("GetById", ctx, int64(3)).Return(&entity.User{ID: 3, Email: "old@example.com"}, nil)
+
+	_, _, user, isNew, err := env.uc.HandleCallback(ctx, &SSOLogin{Provider: "google"}, "good-code")
+	require.NoError(t, err)
+	assert.False(t, isNew)
+	assert.Equal(t, int64(3), user.ID)
+	assert.NotNil(t, env.identities.identities[0].LastUsedAt)
+	env.users.AssertNotCalled(t, "GetByEmail", mock.Anything, mock.Anything)
+}
+
+func TestSSO_HandleCallback_ExistingEmail(t *testing.T) {
+	tests := []struct {
+		name             string
+		providerVerified bool
+		accountVerified  bool
+		wantErr          error
+	}{
+		{"both verified", true, true, nil},
+		{"provider unverified", false, true, ErrSSOAccountExists},
+		{"account unverified", true, false, ErrSSOAccountExists},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			env := newSSOTestEnv(&fakeIdentityProvider{name: "microsoft", identity: entity.ExternalIdentity{Subject: "m-1", Email: "ada@example.com", EmailVerified: tt.providerVerified}})
+			env.users.On("GetByEmail", ctx, "ada@example.com").Return(&entity.User{ID: 5, Email: "ada@example.com", EmailVerified: tt.accountVerified}, nil)
+
+			_, _, user, _, err := env.uc.HandleCallback(ctx, &SSOLogin{Provider: "microsoft"}, "good-code")
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				assert.Empty(t, env.identities.identities, "nothing may be linked")
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, int64(5), user.ID)
+			require.Len(t, env.identities.identities, 1)
+			assert.Equal(t, int64(5), env.identities.identities[0].UserID)
+			assert.Equal(t, []string{entity.AuditActionUserIdentityLinked}, env.auditedActions())
+		})
+	}
+}
+
+func TestSSO_HandleCallback_Errors(t *testing.T) {
+	ctx := context.Background()
+	env := newSSOTestEnv(&fakeIdentityProvider{name: "github", identity: entity.ExternalIdentity{Subject: "42"}})
+
+	_, _, _, _, err := env.uc.HandleCallback(ctx, &SSOLogin{Provider: "github"}, "bad-code")
+	assert.ErrorIs(t, err, ErrSSOAuthFailed)
+
+	_, _, _, _, err = env.uc.HandleCallback(ctx, &SSOLogin{Provider: "github"}, "good-code")
+	assert.ErrorIs(t, err, ErrSSOEmailMissing)
+
+	_, _, _, _, err = env.uc.HandleCallback(ctx, &SSOLogin{Provider: "gitlab"}, "good-code")
+	assert.ErrorIs(t, err, ErrUnknownIdentityProvider)
+
+	_, _, _, _, err = env.uc.HandleCallback(ctx, &SSOLogin{Provider: "github", LinkUserID: 1}, "good-code")
+	assert.ErrorIs(t, err, ErrSSOAuthFailed, "a link may not be used to sign in")
+}
+
+func TestSSO_BeginLink_Reauthentication(t *testing.T) {
+	ctx := context.Background()
+	env := newSSOTestEnv(&fakeIdentityProvider{name: "github"})
+	hashed, err := hash.HashPassword("correct horse")
+	require.NoError(t, err)
+	env.users.On("GetById", ctx, int64(7)).Return(&entity.User{ID: 7, Password: hashed}, nil)
+	env.sessions.On("GetSession", ctx, "fresh").Return(&entity.UserSession{ID: "fresh", UserID: 7, CreatedAt: time.Now().Add(-time.Minute)}, nil)
+	env.sessions.On("GetSession", ctx, "stale").Return(&entity.UserSession{ID: "stale", UserID: 7, CreatedAt: time.Now().Add(-time.Hour)}, nil)
+	env.sessions.On("GetSession", ctx, "other-user").Return(&entity.UserSession{ID: "other-user", UserID: 8, CreatedAt: time.Now()}, nil)
+
+	tests := []struct {
+		name    string
+		reauth  Reauthentication
+		wantErr error
+	}{
+		{"fresh session", Reauthentication{SessionID: "fresh"}, nil},
+		{"stale session", Reauthentication{SessionID: "stale"}, ErrReauthenticationRequired},
+		{"another user's session", Reauthentication{SessionID: "other-user"}, ErrReauthenticationRequired},
+		{"password", Reauthentication{SessionID: "stale", Password: "correct horse"}, nil},
+		{"wrong password", Reauthentication{Password: "wrong"}, ErrReauthenticationRequired},
+		{"mfa code", Reauthentication{Code: "123456"}, nil},
+		{"wrong mfa code", Reauthentication{Code: "000000"}, ErrReauthenticationRequired},
+		{"nothing", Reauthentication{}, ErrReauthenticationRequired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			login, _, err := env.uc.BeginLink(ctx, 7, "github", tt.reauth)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, int64(7), login.LinkUserID)
+		})
+	}
+
+	_, _, err = env.uc.BeginLink(ctx, 7, "gitlab", Reauthentication{SessionID: "fresh"})
+	assert.ErrorIs(t, err, ErrUnknownIdentityProvider)
+}
+
+func TestSSO_CompleteLink(t *testing.T) {
+	ctx := context.Background()
+	env := newSSOTestEnv(&fakeIdentityProvider{name: "github", identity: entity.ExternalIdentity{Subject: "42", Email: "ada@users.noreply.example.com"}})
+	login := &SSOLogin{Provider: "github", LinkUserID: 7}
+
+	identity, err := env.uc.CompleteLink(ctx, login, "good-code")
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), identity.UserID)
+	assert.Equal(t, "42", identity.Subject)
+	assert.Equal(t, []string{entity.AuditActionUserIdentityLinked}, env.auditedActions())
+
+	// Linking again is a no-op; linking someone else's account fails.
+	_, err = env.uc.CompleteLink(ctx, login, "good-code")
+	require.NoError(t, err)
+	assert.Len(t, env.identities.identities, 1)
+
+	_, err = env.uc.CompleteLink(ctx, &SSOLogin{Provider: "github", LinkUserID: 8}, "good-code")
+	assert.ErrorIs(t, err, ErrIdentityAlreadyLinked)
+
+	_, err = env.uc.CompleteLink(ctx, &SSOLogin{Provider: "github"}, "good-code")
+	assert.ErrorIs(t, err, ErrSSOAuthFailed, "a sign-in may not be used to link")
+}
+
+func TestSSO_Unlink(t *testing.T) {
+	ctx := context.Background()
+	env := newSSOTestEnv(&fakeIdentityProvider{name: "github"})
+	require.NoError(t, env.identities.Create(ctx, &entity.UserIdentity{UserID: 7, Provider: "github", Subject: "42"}))
+	require.NoError(t, env.identities.Create(ctx, &entity.UserIdentity{UserID: 7, Provider: "google", Subject: "g-1"}))
+	env.users.On("GetById", ctx, int64(7)).Return(&entity.User{ID: 7}, nil)
+
+	assert.ErrorIs(t, env.uc.Unlink(ctx, 8, 1), ErrIdentityNotFound, "another user's identity")
+
+	// With two identities and no password, one can go but not the other.
+	require.NoError(t, env.uc.Unlink(ctx, 7, 1))
+	assert.ErrorIs(t, env.uc.Unlink(ctx, 7, 2), ErrLastLoginMethod)
+
+	// A passkey is another way to sign in.
+	env.passkeys.has = true
+	require.NoError(t, env.uc.Unlink(ctx, 7, 2))
+
+	identities, err := env.uc.ListIdentities(ctx, 7)
+	require.NoError(t, err)
+	assert.Empty(t, identities)
+	assert.Equal(t, []string{entity.AuditActionUserIdentityUnlinked, entity.AuditActionUserIdentityUnlinked}, env.auditedActions())
+}
+
+func TestSSO_Unlink_KeepsIdentityOfPasswordUser(t *testing.T) {
+	ctx := context.Background()
+	env := newSSOTestEnv(&fakeIdentityProvider{name: "github"})
+	require.NoError(t, env.identities.Create(ctx, &entity.UserIdentity{UserID: 7, Provider: "github", Subject: "42"}))
+	env.users.On("GetById", ctx, int64(7)).Return(&entity.User{ID: 7, Password: "$2a$10$hash"}, nil)
+
+	require.NoError(t, env.uc.Unlink(ctx, 7, 1))
+}
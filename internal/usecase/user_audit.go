@@ -0,0 +1,54 @@
+package usecase
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/Prashant2307200/auth-service/internal/entity"
+	"github.com/Prashant2307200/auth-service/internal/infrastructure/repository"
+	"github.com/Prashant2307200/auth-service/internal/usecase/interfaces"
+)
+
+// UserAuditor records security events about a user's own account. Audit logs
+// are tenant-scoped, so each event is recorded in every business the user
+// belongs to. A nil UserAuditor, or one missing either repository, records
+// nothing.
+type UserAuditor struct {
+	Audits     repository.AuditRepository
+	Businesses interfaces.BusinessRepo
+}
+
+func NewUserAuditor(audits repository.AuditRepository, businesses interfaces.BusinessRepo) *UserAuditor {
+	return &UserAuditor{Audits: audits, Businesses: businesses}
+}
+
+// Record logs action on entityType for userID. Failures are logged, not
+// returned: the change being audited has already happened.
+func (a *UserAuditor) Record(ctx context.Context, userID int64, action, entityType string, entityID *int64, values map[string]interface{}) {
+	if a == nil || a.Audits == nil || a.Businesses == nil {
+		return
+	}
+	businesses, err := a.Businesses.GetUserBusinesses(ctx, userID)
+	if err != nil {
+		slog.Error("Failed to list businesses for audit", slog.Int64("user_id", userID), slog.String("action", action), slog.Any("error", err))
+		return
+	}
+	client := ClientInfoFrom(ctx)
+	for _, b := range businesses {
+		audit := &entity.AuditLog{
+			BusinessID: b.ID,
+			UserID:     userID,
+			Action:     action,
+			EntityType: entityType,
+			EntityID:   entityID,
+			NewValues:  values,
+			IPAddress:  client.IPAddress,
+			UserAgent:  client.UserAgent,
+			CreatedAt:  time.Now(),
+		}
+		if err := a.Audits.Log(ctx, audit); err != nil {
+			slog.Error("Failed to write audit log", slog.Int64("business_id", b.ID), slog.String("action", action), slog.Any("error", err))
+		}
+	}
+}
@@ -0,0 +1,286 @@
+package usecase
+
+import (
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/Prashant2307200/auth-service/internal/entity"
+	"github.com/Prashant2307200/auth-service/internal/infrastructure/repository"
+	"github.com/Prashant2307200/auth-service/internal/usecase/interfaces"
+	"github.com/Prashant2307200/auth-service/pkg/webauthn"
+)
+
+var (
+	ErrWebAuthnChallengeInvalid   = errors.New("passkey challenge is invalid or expired")
+	ErrWebAuthnCredentialNotFound = errors.New("passkey not found")
+	ErrWebAuthnVerificationFailed = errors.New("passkey verification failed")
+)
+
+const (
+	WebAuthnChallengeTTL     = 5 * time.Minute
+	maxPasskeyNameLength     = 64
+	defaultPasskeyName       = "Passkey"
+	webAuthnCredentialType   = "public-key"
+	webAuthnUserHandleLength = 8
+)
+
+// WebAuthnUsecase runs passkey registration and assertion ceremonies. Each
+// Begin call stores a single-use challenge that the matching Finish consumes.
+type WebAuthnUsecase interface {
+	BeginRegistration(ctx context.Context, userID int64) (*webauthn.CreationOptions, error)
+	FinishRegistration(ctx context.Context, userID int64, name string, resp *webauthn.AttestationResponse) (*entity.WebAuthnCredential, error)
+	// BeginLogin starts a passwordless login. With an email the allow list is
+	// narrowed to that user's credentials; otherwise any discoverable passkey works.
+	BeginLogin(ctx context.Context, email string) (*webauthn.RequestOptions, error)
+	// FinishLogin verifies a user-verified assertion and returns its owner.
+	FinishLogin(ctx context.Context, resp *webauthn.AssertionResponse) (int64, error)
+	BeginSecondFactor(ctx context.Context, userID int64) (*webauthn.RequestOptions, error)
+	FinishSecondFactor(ctx context.Context, userID int64, resp *webauthn.AssertionResponse) error
+	HasCredentials(ctx context.Context, userID int64) (bool, error)
+	ListCredentials(ctx context.Context, userID int64) ([]*entity.WebAuthnCredential, error)
+	RenameCredential(ctx context.Context, userID, credentialID int64, name string) error
+	DeleteCredential(ctx context.Context, userID, credentialID int64) error
+}
+
+type webAuthnUsecase struct {
+	rp       *webauthn.RelyingParty
+	userRepo interfaces.UserRepo
+	creds    repository.WebAuthnRepository
+	sessions interfaces.WebAuthnSessionStore
+}
+
+func NewWebAuthnUsecase(rp *webauthn.RelyingParty, userRepo interfaces.UserRepo, creds repository.WebAuthnRepository, sessions interfaces.WebAuthnSessionStore) WebAuthnUsecase {
+	return &webAuthnUsecase{rp: rp, userRepo: userRepo, creds: creds, sessions: sessions}
+}
+
+func (u *webAuthnUsecase) BeginRegistration(ctx context.Context, userID int64) (*webauthn.CreationOptions, error) {
+	user, err := u.userRepo.GetById(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	existing, err := u.creds.ListByUser(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list passkeys: %w", err)
+	}
+
+	challenge, err := u.newSession(ctx, userID, entity.WebAuthnPurposeRegister)
+	if err != nil {
+		return nil, err
+	}
+	return u.rp.CreationOptions(challenge, webauthn.UserEntity{
+		ID:          userHandle(userID),
+		Name:        user.Email,
+		DisplayName: user.Username,
+	}, descriptors(existing)), nil
+}
+
+func (u *webAuthnUsecase) FinishRegistration(ctx context.Context, userID int64, name string, resp *webauthn.AttestationResponse) (*entity.WebAuthnCredential, error) {
+	challenge, err := u.takeSession(ctx, resp.Challenge, userID, entity.WebAuthnPurposeRegister)
+	if err != nil {
+		return nil, err
+	}
+
+	verified, err := u.rp.VerifyRegistration(resp, challenge, false)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrWebAuthnVerificationFailed, err)
+	}
+
+	cred := &entity.WebAuthnCredential{
+		UserID:         userID,
+		CredentialID:   verified.ID,
+		PublicKey:      verified.PublicKey,
+		SignCount:      verified.SignCount,
+		AAGUID:         verified.AAGUID,
+		Transports:     verified.Transports,
+		Name:           passkeyName(name),
+		BackupEligible: verified.BackupEligible,
+		BackedUp:       verified.BackedUp,
+		CreatedAt:      time.Now(),
+	}
+	id, err := u.creds.Create(ctx, cred)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store passkey: %w", err)
+	}
+	cred.ID = id
+	return cred, nil
+}
+
+func (u *webAuthnUsecase) BeginLogin(ctx context.Context, email string) (*webauthn.RequestOptions, error) {
+	var allow []webauthn.CredentialDescriptor
+	if email != "" {
+		// An unknown email gets an empty allow list rather than an error so
+		// the endpoint does not reveal which addresses have accounts.
+		if user, err := u.userRepo.GetByEmail(ctx, email); err == nil {
+			creds, err := u.creds.ListByUser(ctx, user.ID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to list passkeys: %w", err)
+			}
+			allow = descriptors(creds)
+		}
+	}
+
+	challenge, err := u.newSession(ctx, 0, entity.WebAuthnPurposeLogin)
+	if err != nil {
+		return nil, err
+	}
+	return u.rp.RequestOptions(challenge, allow, webauthn.VerificationRequired), nil
+}
+
+func (u *webAuthnUsecase) FinishLogin(ctx context.Context, resp *webauthn.AssertionResponse) (int64, error) {
+	challenge, err := u.takeSession(ctx, resp.Challenge, 0, entity.WebAuthnPurposeLogin)
+	if err != nil {
+		return 0, err
+	}
+	// Passwordless login must prove both possession and user verification.
+	cred, err := u.verifyAssertion(ctx, resp, challenge, true)
+	if err != nil {
+		return 0, err
+	}
+	return cred.UserID, nil
+}
+
+func (u *webAuthnUsecase) BeginSecondFactor(ctx context.Context, userID int64) (*webauthn.RequestOptions, error) {
+	creds, err := u.creds.ListByUser(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list passkeys: %w", err)
+	}
+	if len(creds) == 0 {
+		return nil, ErrWebAuthnCredentialNotFound
+	}
+
+	challenge, err := u.newSession(ctx, userID, entity.WebAuthnPurposeMFA)
+	if err != nil {
+		return nil, err
+	}
+	return u.rp.RequestOptions(challenge, descriptors(creds), webauthn.VerificationDiscouraged), nil
+}
+
+func (u *webAuthnUsecase) FinishSecondFactor(ctx context.Context, userID int64, resp *webauthn.AssertionResponse) error {
+	challenge, err := u.takeSession(ctx, resp.Challenge, userID, entity.WebAuthnPurposeMFA)
+	if err != nil {
+		return err
+	}
+	cred, err := u.verifyAssertion(ctx, resp, challenge, false)
+	if err != nil {
+		return err
+	}
+	if cred.UserID != userID {
+		return ErrWebAuthnVerificationFailed
+	}
+	return nil
+}
+
+func (u *webAuthnUsecase) HasCredentials(ctx context.Context, userID int64) (bool, error) {
+	n, err := u.creds.CountByUser(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+func (u *webAuthnUsecase) ListCredentials(ctx context.Context, userID int64) ([]*entity.WebAuthnCredential, error) {
+	return u.creds.ListByUser(ctx, userID)
+}
+
+func (u *webAuthnUsecase) RenameCredential(ctx context.Context, userID, credentialID int64, name string) error {
+	err := u.creds.Rename(ctx, userID, credentialID, passkeyName(name))
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrWebAuthnCredentialNotFound
+	}
+	return err
+}
+
+func (u *webAuthnUsecase) DeleteCredential(ctx context.Context, userID, credentialID int64) error {
+	err := u.creds.Delete(ctx, userID, credentialID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrWebAuthnCredentialNotFound
+	}
+	return err
+}
+
+func (u *webAuthnUsecase) newSession(ctx context.Context, userID int64, purpose string) ([]byte, error) {
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate passkey challenge: %w", err)
+	}
+	session := &entity.WebAuthnSession{UserID: userID, Purpose: purpose}
+	if err := u.sessions.Save(ctx, challenge, session, WebAuthnChallengeTTL); err != nil {
+		return nil, err
+	}
+	return challenge, nil
+}
+
+// takeSession consumes the session for the challenge echoed by the client
+// and checks it was issued to this user for this ceremony.
+func (u *webAuthnUsecase) takeSession(ctx context.Context, echoed func() ([]byte, error), userID int64, purpose string) ([]byte, error) {
+	challenge, err := echoed()
+	if err != nil {
+		return nil, ErrWebAuthnChallengeInvalid
+	}
+	session, err := u.sessions.Take(ctx, challenge)
+	if err != nil {
+		return nil, ErrWebAuthnChallengeInvalid
+	}
+	if session.Purpose != purpose || session.UserID != userID {
+		return nil, ErrWebAuthnChallengeInvalid
+	}
+	return challenge, nil
+}
+
+func (u *webAuthnUsecase) verifyAssertion(ctx context.Context, resp *webauthn.AssertionResponse, challenge []byte, requireUV bool) (*entity.WebAuthnCredential, error) {
+	cred, err := u.creds.GetByCredentialID(ctx, resp.RawID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrWebAuthnVerificationFailed
+		}
+		return nil, err
+	}
+	if len(resp.Response.UserHandle) > 0 && string(resp.Response.UserHandle) != string(userHandle(cred.UserID)) {
+		return nil, ErrWebAuthnVerificationFailed
+	}
+
+	result, err := u.rp.VerifyAssertion(resp, challenge, cred.PublicKey, cred.SignCount, requireUV)
+	if err != nil {
+		if errors.Is(err, webauthn.ErrSignCountRegression) {
+			slog.Warn("Passkey signature counter went backwards; possible cloned authenticator",
+				slog.Int64("user_id", cred.UserID), slog.Int64("credential_id", cred.ID))
+		}
+		return nil, fmt.Errorf("%w: %w", ErrWebAuthnVerificationFailed, err)
+	}
+
+	if err := u.creds.UpdateAfterAssertion(ctx, cred.ID, result.SignCount, result.BackedUp); err != nil {
+		return nil, fmt.Errorf("failed to update passkey: %w", err)
+	}
+	return cred, nil
+}
+
+// userHandle is the opaque user.id given to authenticators. It identifies the
+// account in discoverable logins without exposing the email address.
+func userHandle(userID int64) []byte {
+	return binary.BigEndian.AppendUint64(make([]byte, 0, webAuthnUserHandleLength), uint64(userID))
+}
+
+func descriptors(creds []*entity.WebAuthnCredential) []webauthn.CredentialDescriptor {
+	out := make([]webauthn.CredentialDescriptor, 0, len(creds))
+	for _, c := range creds {
+		out = append(out, webauthn.CredentialDescriptor{Type: webAuthnCredentialType, ID: c.CredentialID, Transports: c.Transports})
+	}
+	return out
+}
+
+func passkeyName(name string) string {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return defaultPasskeyName
+	}
+	if r := []rune(name); len(r) > maxPasskeyNameLength {
+		name = string(r[:maxPasskeyNameLength])
+	}
+	return name
+}
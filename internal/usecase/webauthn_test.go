@@ -0,0 +1,250 @@
+package usecase
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Prashant2307200/auth-service/internal/entity"
+	"github.com/Prashant2307200/auth-service/internal/testutil"
+	pkghash "github.com/Prashant2307200/auth-service/pkg/hash"
+	"github.com/Prashant2307200/auth-service/pkg/webauthn"
+	"github.com/Prashant2307200/auth-service/pkg/webauthn/webauthntest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type memWebAuthnRepo struct {
+	creds  []*entity.WebAuthnCredential
+	nextID int64
+}
+
+func (r *memWebAuthnRepo) Create(_ context.Context, cred *entity.WebAuthnCredential) (int64, error) {
+	r.nextID++
+	c := *cred
+	c.ID = r.nextID
+	r.creds = append(r.creds, &c)
+	return c.ID, nil
+}
+
+func (r *memWebAuthnRepo) GetByCredentialID(_ context.Context, id []byte) (*entity.WebAuthnCredential, error) {
+	for _, c := range r.creds {
+		if string(c.CredentialID) == string(id) {
+			cp := *c
+			return &cp, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (r *memWebAuthnRepo) ListByUser(_ context.Context, userID int64) ([]*entity.WebAuthnCredential, error) {
+	var out []*entity.WebAuthnCredential
+	for _, c := range r.creds {
+		if c.UserID == userID {
+			out = append(out, c)
+		}
+	}
+	return out, nil
+}
+
+func (r *memWebAuthnRepo) CountByUser(ctx context.Context, userID int64) (int, error) {
+	creds, _ := r.ListByUser(ctx, userID)
+	return len(creds), nil
+}
+
+func (r *memWebAuthnRepo) UpdateAfterAssertion(_ context.Context, id int64, signCount uint32, backedUp bool) error {
+	for _, c := range r.creds {
+		if c.ID == id {
+			c.SignCount, c.BackedUp = signCount, backedUp
+			return nil
+		}
+	}
+	return sql.ErrNoRows
+}
+
+func (r *memWebAuthnRepo) Rename(_ context.Context, userID, id int64, name string) error {
+	for _, c := range r.creds {
+		if c.ID == id && c.UserID == userID {
+			c.Name = name
+			return nil
+		}
+	}
+	return sql.ErrNoRows
+}
+
+func (r *memWebAuthnRepo) Delete(_ context.Context, userID, id int64) error {
+	for i, c := range r.creds {
+		if c.ID == id && c.UserID == userID {
+			r.creds = append(r.creds[:i], r.creds[i+1:]...)
+			return nil
+		}
+	}
+	return sql.ErrNoRows
+}
+
+type memWebAuthnSessions map[string]*entity.WebAuthnSession
+
+func (m memWebAuthnSessions) Save(_ context.Context, challenge []byte, s *entity.WebAuthnSession, _ time.Duration) error {
+	m[string(challenge)] = s
+	return nil
+}
+
+func (m memWebAuthnSessions) Take(_ context.Context, challenge []byte) (*entity.WebAuthnSession, error) {
+	s, ok := m[string(challenge)]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	delete(m, string(challenge))
+	return s, nil
+}
+
+const testOrigin = "https://app.example.com"
+
+func newTestWebAuthn(userRepo *testutil.MockUserRepo) (WebAuthnUsecase, *memWebAuthnRepo) {
+	rp := &webauthn.RelyingParty{ID: "example.com", Name: "Example", Origins: []string{testOrigin}}
+	repo := &memWebAuthnRepo{}
+	return NewWebAuthnUsecase(rp, userRepo, repo, memWebAuthnSessions{}), repo
+}
+
+func registerPasskey(t *testing.T, uc WebAuthnUsecase, auth *webauthntest.Authenticator, userID int64) *entity.WebAuthnCredential {
+	t.Helper()
+	opts, err := uc.BeginRegistration(context.Background(), userID)
+	require.NoError(t, err)
+	att, err := auth.Create(opts)
+	require.NoError(t, err)
+	cred, err := uc.FinishRegistration(context.Background(), userID, "  Laptop  ", att)
+	require.NoError(t, err)
+	return cred
+}
+
+func TestWebAuthn_PasswordlessLogin(t *testing.T) {
+	ctx := context.Background()
+	user := testutil.CreateTestUser()
+	userRepo := new(testutil.MockUserRepo)
+	userRepo.On("GetById", mock.Anything, user.ID).Return(user, nil)
+	tokenService := new(testutil.MockTokenService)
+	tokenService.On("GenerateRefreshToken", user.ID, mock.AnythingOfType("string")).Return("refresh_token", nil)
+	tokenService.On("StoreRefreshToken", mock.Anything, mock.AnythingOfType("string"), "refresh_token").Return(nil)
+	tokenService.On("GenerateAccessTokenForSession", user.ID, mock.AnythingOfType("string")).Return("access_token", nil)
+
+	passkeys, _ := newTestWebAuthn(userRepo)
+	auth := webauthntest.New(testOrigin)
+	cred := registerPasskey(t, passkeys, auth, user.ID)
+	assert.Equal(t, "Laptop", cred.Name)
+
+	uc := NewAuthUseCase(userRepo, nil, tokenService, new(testutil.MockCloudService))
+	uc.Passkeys = passkeys
+
+	opts, err := passkeys.BeginLogin(ctx, "")
+	require.NoError(t, err)
+	assert.Equal(t, webauthn.VerificationRequired, opts.UserVerification)
+	assertion, err := auth.Get(opts)
+	require.NoError(t, err)
+
+	access, refresh, err := uc.LoginWithPasskey(ctx, assertion)
+	require.NoError(t, err)
+	assert.Equal(t, "access_token", access)
+	assert.Equal(t, "refresh_token", refresh)
+
+	// The challenge is single-use.
+	_, _, err = uc.LoginWithPasskey(ctx, assertion)
+	assert.ErrorIs(t, err, ErrWebAuthnChallengeInvalid)
+}
+
+func TestWebAuthn_LoginRequiresUserVerification(t *testing.T) {
+	ctx := context.Background()
+	user := testutil.CreateTestUser()
+	userRepo := new(testutil.MockUserRepo)
+	userRepo.On("GetById", mock.Anything, user.ID).Return(user, nil)
+
+	passkeys, _ := newTestWebAuthn(userRepo)
+	auth := webauthntest.New(testOrigin)
+	registerPasskey(t, passkeys, auth, user.ID)
+
+	auth.NoUserVerification = true
+	opts, _ := passkeys.BeginLogin(ctx, "")
+	assertion, _ := auth.Get(opts)
+	_, err := passkeys.FinishLogin(ctx, assertion)
+	assert.ErrorIs(t, err, ErrWebAuthnVerificationFailed)
+	assert.ErrorIs(t, err, webauthn.ErrUserNotVerified)
+}
+
+func TestWebAuthn_SecondFactor(t *testing.T) {
+	ctx := context.Background()
+	user := testutil.CreateTestUser()
+	hashed, _ := pkghash.HashPassword("password123")
+	user.Password = hashed
+	userRepo := new(testutil.MockUserRepo)
+	userRepo.On("GetById", mock.Anything, user.ID).Return(user, nil)
+	userRepo.On("GetByEmail", mock.Anything, user.Email).Return(user, nil)
+	tokenService := new(testutil.MockTokenService)
+	tokenService.On("GenerateRefreshToken", user.ID, mock.AnythingOfType("string")).Return("refresh_token", nil)
+	tokenService.On("StoreRefreshToken", mock.Anything, mock.AnythingOfType("string"), "refresh_token").Return(nil)
+	tokenService.On("GenerateAccessTokenForSession", user.ID, mock.AnythingOfType("string")).Return("access_token", nil)
+
+	passkeys, _ := newTestWebAuthn(userRepo)
+	auth := webauthntest.New(testOrigin)
+	registerPasskey(t, passkeys, auth, user.ID)
+
+	gate := NewMFAGate(&stubMFA{enabled: false}, newMemChallengeStore())
+	gate.Passkeys = passkeys
+	uc := NewAuthUseCase(userRepo, nil, tokenService, new(testutil.MockCloudService))
+	uc.MFAGate = gate
+	uc.Passkeys = passkeys
+
+	_, _, err := uc.LoginUser(ctx, user.Email, "password123")
+	var mfaErr *MFARequiredError
+	require.ErrorAs(t, err, &mfaErr)
+	assert.Equal(t, []string{MFAFactorWebAuthn}, mfaErr.Methods)
+
+	// A passwordless-login challenge cannot answer an MFA challenge.
+	loginOpts, _ := passkeys.BeginLogin(ctx, "")
+	wrong, _ := auth.Get(loginOpts)
+	_, _, err = uc.CompletePasskeyMFA(ctx, mfaErr.Token, wrong)
+	assert.ErrorIs(t, err, ErrWebAuthnChallengeInvalid)
+
+	opts, err := uc.BeginPasskeyMFA(ctx, mfaErr.Token)
+	require.NoError(t, err)
+	require.Len(t, opts.AllowCredentials, 1)
+	assertion, err := auth.Get(opts)
+	require.NoError(t, err)
+
+	access, _, err := uc.CompletePasskeyMFA(ctx, mfaErr.Token, assertion)
+	require.NoError(t, err)
+	assert.Equal(t, "access_token", access)
+
+	_, err = uc.BeginPasskeyMFA(ctx, mfaErr.Token)
+	assert.ErrorIs(t, err, ErrMFAChallengeInvalid)
+}
+
+func TestWebAuthn_ManageCredentials(t *testing.T) {
+	ctx := context.Background()
+	user := testutil.CreateTestUser()
+	userRepo := new(testutil.MockUserRepo)
+	userRepo.On("GetById", mock.Anything, user.ID).Return(user, nil)
+
+	passkeys, _ := newTestWebAuthn(userRepo)
+	auth := webauthntest.New(testOrigin)
+	cred := registerPasskey(t, passkeys, auth, user.ID)
+
+	// Registering the same authenticator again is excluded by the options.
+	opts, err := passkeys.BeginRegistration(ctx, user.ID)
+	require.NoError(t, err)
+	require.Len(t, opts.ExcludeCredentials, 1)
+
+	require.NoError(t, passkeys.RenameCredential(ctx, user.ID, cred.ID, "Work laptop"))
+	assert.ErrorIs(t, passkeys.RenameCredential(ctx, user.ID+1, cred.ID, "stolen"), ErrWebAuthnCredentialNotFound)
+
+	creds, err := passkeys.ListCredentials(ctx, user.ID)
+	require.NoError(t, err)
+	require.Len(t, creds, 1)
+	assert.Equal(t, "Work laptop", creds[0].Name)
+
+	assert.ErrorIs(t, passkeys.DeleteCredential(ctx, user.ID+1, cred.ID), ErrWebAuthnCredentialNotFound)
+	require.NoError(t, passkeys.DeleteCredential(ctx, user.ID, cred.ID))
+	has, _ := passkeys.HasCredentials(ctx, user.ID)
+	assert.False(t, has)
+}
@@ -0,0 +1,70 @@
+// Package bloom implements a fixed-size Bloom filter that is safe for
+// concurrent use without locking.
+package bloom
+
+import (
+	"hash/maphash"
+	"math"
+	"sync/atomic"
+)
+
+// Filter answers "definitely not added" or "possibly added". Keys cannot be
+// removed; callers that need expiry build a fresh filter and swap it in.
+type Filter struct {
+	bits  []uint64
+	m     uint64
+	k     uint64
+	seed1 maphash.Seed
+	seed2 maphash.Seed
+}
+
+// New sizes a filter for n keys at false-positive rate p. Adding more than n
+// keys keeps the filter correct but raises its false-positive rate.
+func New(n int, p float64) *Filter {
+	if n < 1 {
+		n = 1
+	}
+	if p <= 0 || p >= 1 {
+		p = 0.01
+	}
+	m := uint64(math.Ceil(-float64(n) * math.Log(p) / (math.Ln2 * math.Ln2)))
+	m = (m + 63) &^ 63
+	k := uint64(math.Round(float64(m) / float64(n) * math.Ln2))
+	if k < 1 {
+		k = 1
+	}
+	return &Filter{
+		bits:  make([]uint64, m/64),
+		m:     m,
+		k:     k,
+		seed1: maphash.MakeSeed(),
+		seed2: maphash.MakeSeed(),
+	}
+}
+
+// Add records key in the filter.
+func (f *Filter) Add(key string) {
+	h1, h2 := f.hashes(key)
+	for i := uint64(0); i < f.k; i++ {
+		bit := (h1 + i*h2) % f.m
+		atomic.OrUint64(&f.bits[bit/64], 1<<(bit%64))
+	}
+}
+
+// Test reports whether key may have been added. A false result is certain.
+func (f *Filter) Test(key string) bool {
+	h1, h2 := f.hashes(key)
+	for i := uint64(0); i < f.k; i++ {
+		bit := (h1 + i*h2) % f.m
+		if atomic.LoadUint64(&f.bits[bit/64])&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// hashes derives the two base hashes for double hashing; h2 is odd so the
+// probe sequence does not collapse onto a single bit.
+func (f *Filter) hashes(key string) (uint64, uint64) {
+	return maphash.String(f.seed1, key), maphash.String(f.seed2, key) | 1
+}
@@ -0,0 +1,43 @@
+package bloom
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestFilter_NoFalseNegatives(t *testing.T) {
+	f := New(1000, 0.01)
+	for i := 0; i < 1000; i++ {
+		f.Add("key-" + strconv.Itoa(i))
+	}
+	for i := 0; i < 1000; i++ {
+		if !f.Test("key-" + strconv.Itoa(i)) {
+			t.Fatalf("added key-%d not found", i)
+		}
+	}
+}
+
+func TestFilter_FalsePositiveRate(t *testing.T) {
+	f := New(1000, 0.01)
+	for i := 0; i < 1000; i++ {
+		f.Add("key-" + strconv.Itoa(i))
+	}
+	hits := 0
+	const probes = 10000
+	for i := 0; i < probes; i++ {
+		if f.Test("other-" + strconv.Itoa(i)) {
+			hits++
+		}
+	}
+	// Allow generous slack over the 1% target to keep the test stable.
+	if rate := float64(hits) / probes; rate > 0.03 {
+		t.Fatalf("false-positive rate %.3f, want about 0.01", rate)
+	}
+}
+
+func TestFilter_EmptyRejectsEverything(t *testing.T) {
+	f := New(10, 0.01)
+	if f.Test("anything") {
+		t.Fatal("empty filter reported a match")
+	}
+}
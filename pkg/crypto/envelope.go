@@ -0,0 +1,252 @@
+// Package crypto implements envelope encryption for small secrets stored in
+// the database. Each value is sealed with a fresh AES-256-GCM data key, and
+// the data key is wrapped by a versioned master key that never leaves the
+// process.
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// envelopePrefix marks values produced by Envelope.Encrypt. Stored values
+// look like "enc:v1:<key version>:<wrapped data key>:<sealed payload>".
+const envelopePrefix = "enc:v1:"
+
+const keySize = 32
+
+var (
+	ErrUnknownKeyVersion = errors.New("unknown master key version")
+	ErrMalformedEnvelope = errors.New("malformed envelope")
+	ErrDecryptFailed     = errors.New("envelope decryption failed")
+)
+
+// KeyProvider supplies master keys by version. The active version wraps new
+// data keys; older versions stay available so existing values can be read
+// until they are re-encrypted.
+type KeyProvider interface {
+	ActiveVersion() string
+	Key(version string) ([]byte, error)
+}
+
+// StaticKeyProvider serves master keys loaded once at startup.
+type StaticKeyProvider struct {
+	active string
+	keys   map[string][]byte
+}
+
+func NewStaticKeyProvider(active string, keys map[string][]byte) (*StaticKeyProvider, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("no master keys configured")
+	}
+	for version, key := range keys {
+		if err := validateVersion(version); err != nil {
+			return nil, err
+		}
+		if len(key) != keySize {
+			return nil, fmt.Errorf("master key %q must be %d bytes, got %d", version, keySize, len(key))
+		}
+	}
+	if _, ok := keys[active]; !ok {
+		return nil, fmt.Errorf("active master key version %q is not configured", active)
+	}
+	return &StaticKeyProvider{active: active, keys: keys}, nil
+}
+
+func (p *StaticKeyProvider) ActiveVersion() string {
+	return p.active
+}
+
+func (p *StaticKeyProvider) Key(version string) ([]byte, error) {
+	key, ok := p.keys[version]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKeyVersion, version)
+	}
+	return key, nil
+}
+
+// ParseMasterKeys parses "version:base64key" entries separated by commas or
+// newlines, e.g. "v2:3q2+7w...,v1:AAEC...". Blank lines and lines starting
+// with '#' are ignored so the same syntax works for key files.
+func ParseMasterKeys(spec string) (map[string][]byte, error) {
+	keys := make(map[string][]byte)
+	fields := strings.FieldsFunc(spec, func(r rune) bool { return r == ',' || r == '\n' })
+	for _, field := range fields {
+		field = strings.TrimSpace(field)
+		if field == "" || strings.HasPrefix(field, "#") {
+			continue
+		}
+		version, encoded, ok := strings.Cut(field, ":")
+		if !ok {
+			return nil, fmt.Errorf("master key entry must be version:base64key")
+		}
+		version = strings.TrimSpace(version)
+		if err := validateVersion(version); err != nil {
+			return nil, err
+		}
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil {
+			return nil, fmt.Errorf("master key %q is not valid base64: %w", version, err)
+		}
+		if _, dup := keys[version]; dup {
+			return nil, fmt.Errorf("master key %q is defined twice", version)
+		}
+		keys[version] = key
+	}
+	return keys, nil
+}
+
+// LoadMasterKeyFile reads master keys from path using the ParseMasterKeys syntax.
+func LoadMasterKeyFile(path string) (map[string][]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read master key file: %w", err)
+	}
+	return ParseMasterKeys(string(data))
+}
+
+func validateVersion(version string) error {
+	if version == "" || strings.ContainsAny(version, ":,\n") {
+		return fmt.Errorf("invalid master key version %q", version)
+	}
+	return nil
+}
+
+// Envelope encrypts values under the provider's active master key.
+type Envelope struct {
+	keys KeyProvider
+}
+
+func NewEnvelope(keys KeyProvider) *Envelope {
+	return &Envelope{keys: keys}
+}
+
+// Encrypt seals plaintext with a new data key. aad is authenticated but not
+// stored; the same aad must be passed to Decrypt, which binds the value to
+// its owner so ciphertexts cannot be swapped between rows.
+func (e *Envelope) Encrypt(plaintext, aad []byte) (string, error) {
+	version := e.keys.ActiveVersion()
+	master, err := e.keys.Key(version)
+	if err != nil {
+		return "", err
+	}
+
+	dataKey := make([]byte, keySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", fmt.Errorf("failed to generate data key: %w", err)
+	}
+	sealed, err := seal(dataKey, plaintext, aad)
+	if err != nil {
+		return "", err
+	}
+	wrapped, err := seal(master, dataKey, []byte(version))
+	if err != nil {
+		return "", err
+	}
+
+	return envelopePrefix + version + ":" +
+		base64.RawStdEncoding.EncodeToString(wrapped) + ":" +
+		base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt opens a value produced by Encrypt with any configured key version.
+func (e *Envelope) Decrypt(value string, aad []byte) ([]byte, error) {
+	version, wrapped, sealed, err := parseEnvelope(value)
+	if err != nil {
+		return nil, err
+	}
+	master, err := e.keys.Key(version)
+	if err != nil {
+		return nil, err
+	}
+	dataKey, err := open(master, wrapped, []byte(version))
+	if err != nil {
+		return nil, err
+	}
+	return open(dataKey, sealed, aad)
+}
+
+// NeedsReencrypt reports whether value is not yet sealed under the active key.
+// Plaintext values written before encryption was enabled also need it.
+func (e *Envelope) NeedsReencrypt(value string) bool {
+	version, err := KeyVersion(value)
+	return err != nil || version != e.keys.ActiveVersion()
+}
+
+// ActivePrefix is the stored prefix shared by every value sealed under the
+// active key, for selecting stale rows in SQL.
+func (e *Envelope) ActivePrefix() string {
+	return envelopePrefix + e.keys.ActiveVersion() + ":"
+}
+
+// IsEnvelope reports whether value was produced by Encrypt.
+func IsEnvelope(value string) bool {
+	return strings.HasPrefix(value, envelopePrefix)
+}
+
+// KeyVersion returns the master key version that wrapped value's data key.
+func KeyVersion(value string) (string, error) {
+	version, _, _, err := parseEnvelope(value)
+	return version, err
+}
+
+func parseEnvelope(value string) (string, []byte, []byte, error) {
+	if !IsEnvelope(value) {
+		return "", nil, nil, ErrMalformedEnvelope
+	}
+	parts := strings.Split(strings.TrimPrefix(value, envelopePrefix), ":")
+	if len(parts) != 3 || parts[0] == "" {
+		return "", nil, nil, ErrMalformedEnvelope
+	}
+	wrapped, err := base64.RawStdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", nil, nil, ErrMalformedEnvelope
+	}
+	sealed, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", nil, nil, ErrMalformedEnvelope
+	}
+	return parts[0], wrapped, sealed, nil
+}
+
+// seal returns nonce||ciphertext.
+func seal(key, plaintext, aad []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize(), gcm.NonceSize()+len(plaintext)+gcm.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return gcm.Seal(nonce, nonce, plaintext, aad), nil
+}
+
+func open(key, data, aad []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, ErrMalformedEnvelope
+	}
+	plaintext, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], aad)
+	if err != nil {
+		return nil, ErrDecryptFailed
+	}
+	return plaintext, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
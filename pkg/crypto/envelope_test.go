@@ -0,0 +1,109 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"testing"
+)
+
+func newKey(t *testing.T) []byte {
+	t.Helper()
+	key := make([]byte, keySize)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	return key
+}
+
+func newEnvelope(t *testing.T, active string, keys map[string][]byte) *Envelope {
+	t.Helper()
+	provider, err := NewStaticKeyProvider(active, keys)
+	if err != nil {
+		t.Fatalf("failed to create key provider: %v", err)
+	}
+	return NewEnvelope(provider)
+}
+
+func TestEnvelope_RoundTrip(t *testing.T) {
+	env := newEnvelope(t, "v1", map[string][]byte{"v1": newKey(t)})
+
+	ct, err := env.Encrypt([]byte("JBSWY3DPEHPK3PXP"), []byte("42"))
+	if err != nil {
+		t.Fatalf("encrypt failed: %v", err)
+	}
+	if !IsEnvelope(ct) || bytes.Contains([]byte(ct), []byte("JBSWY3DPEHPK3PXP")) {
+		t.Fatalf("unexpected ciphertext %q", ct)
+	}
+
+	pt, err := env.Decrypt(ct, []byte("42"))
+	if err != nil || string(pt) != "JBSWY3DPEHPK3PXP" {
+		t.Fatalf("decrypt failed: %q, %v", pt, err)
+	}
+
+	if _, err := env.Decrypt(ct, []byte("43")); !errors.Is(err, ErrDecryptFailed) {
+		t.Fatalf("expected aad mismatch to fail, got %v", err)
+	}
+}
+
+func TestEnvelope_KeyRotation(t *testing.T) {
+	v1, v2 := newKey(t), newKey(t)
+	old := newEnvelope(t, "v1", map[string][]byte{"v1": v1})
+	ct, _ := old.Encrypt([]byte("secret"), nil)
+
+	rotated := newEnvelope(t, "v2", map[string][]byte{"v1": v1, "v2": v2})
+	if !rotated.NeedsReencrypt(ct) {
+		t.Fatalf("value under v1 should need re-encryption once v2 is active")
+	}
+	pt, err := rotated.Decrypt(ct, nil)
+	if err != nil || string(pt) != "secret" {
+		t.Fatalf("old key version should still decrypt: %q, %v", pt, err)
+	}
+
+	ct2, _ := rotated.Encrypt(pt, nil)
+	if v, _ := KeyVersion(ct2); v != "v2" || rotated.NeedsReencrypt(ct2) {
+		t.Fatalf("expected value sealed under v2, got %q", v)
+	}
+
+	retired := newEnvelope(t, "v2", map[string][]byte{"v2": v2})
+	if _, err := retired.Decrypt(ct, nil); !errors.Is(err, ErrUnknownKeyVersion) {
+		t.Fatalf("expected unknown key version, got %v", err)
+	}
+}
+
+func TestEnvelope_PlaintextNeedsReencrypt(t *testing.T) {
+	env := newEnvelope(t, "v1", map[string][]byte{"v1": newKey(t)})
+	if IsEnvelope("JBSWY3DPEHPK3PXP") || !env.NeedsReencrypt("JBSWY3DPEHPK3PXP") {
+		t.Fatalf("legacy plaintext should be detected and flagged")
+	}
+	if _, err := env.Decrypt("enc:v1:v1:!!:!!", nil); !errors.Is(err, ErrMalformedEnvelope) {
+		t.Fatalf("expected malformed envelope, got %v", err)
+	}
+}
+
+func TestParseMasterKeys(t *testing.T) {
+	k1, k2 := newKey(t), newKey(t)
+	spec := "# rotated 2026-10\nv2:" + base64.StdEncoding.EncodeToString(k2) + "\n,v1:" + base64.StdEncoding.EncodeToString(k1)
+
+	keys, err := ParseMasterKeys(spec)
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	if !bytes.Equal(keys["v1"], k1) || !bytes.Equal(keys["v2"], k2) {
+		t.Fatalf("unexpected keys %v", keys)
+	}
+
+	for _, bad := range []string{"nokey", "v1:not-base64!", "v1:" + base64.StdEncoding.EncodeToString(k1) + ",v1:" + base64.StdEncoding.EncodeToString(k2)} {
+		if _, err := ParseMasterKeys(bad); err == nil {
+			t.Fatalf("expected %q to be rejected", bad)
+		}
+	}
+
+	if _, err := NewStaticKeyProvider("v1", map[string][]byte{"v1": []byte("short")}); err == nil {
+		t.Fatalf("expected short key to be rejected")
+	}
+	if _, err := NewStaticKeyProvider("v3", keys); err == nil {
+		t.Fatalf("expected missing active version to be rejected")
+	}
+}
@@ -0,0 +1,43 @@
+package csrf
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testSecret = []byte("0123456789abcdef0123456789abcdef")
+
+func TestSigner(t *testing.T) {
+	s, err := NewSigner(testSecret)
+	require.NoError(t, err)
+
+	token, err := s.Token("sess-1")
+	require.NoError(t, err)
+	other, err := s.Token("sess-1")
+	require.NoError(t, err)
+	assert.NotEqual(t, token, other)
+
+	assert.True(t, s.Verify("sess-1", token))
+	assert.True(t, s.Verify("sess-1", other))
+	assert.False(t, s.Verify("sess-2", token))
+	assert.False(t, s.Verify("sess-1", ""))
+	assert.False(t, s.Verify("sess-1", strings.Replace(token, ".", ".x", 1)))
+
+	otherSigner, err := NewSigner([]byte(strings.Repeat("z", 32)))
+	require.NoError(t, err)
+	assert.False(t, otherSigner.Verify("sess-1", token))
+
+	rotated, err := NewSigner([]byte(strings.Repeat("z", 32)), testSecret)
+	require.NoError(t, err)
+	assert.True(t, rotated.Verify("sess-1", token))
+}
+
+func TestNewSigner_ShortSecret(t *testing.T) {
+	_, err := NewSigner([]byte("short"))
+	assert.Error(t, err)
+	_, err = NewSigner()
+	assert.Error(t, err)
+}
@@ -1,7 +1,9 @@
 package db
 
 import (
+	"crypto/rand"
 	"database/sql"
+	"encoding/hex"
 	"fmt"
 	"log/slog"
 )
@@ -32,6 +34,30 @@ func RunMigrations(db *sql.DB) error {
 	if err := MigrateUserMFATable(db); err != nil {
 		return err
 	}
+	if err := MigrateWebAuthnCredentialsTable(db); err != nil {
+		return err
+	}
+	if err := MigrateOAuthClientsTable(db); err != nil {
+		return err
+	}
+	if err := MigrateOAuthConsentsTable(db); err != nil {
+		return err
+	}
+	if err := MigratePersonalAccessTokensTable(db); err != nil {
+		return err
+	}
+	if err := MigrateUserIdentitiesTable(db); err != nil {
+		return err
+	}
+	if err := MigrateSAMLConnectionsTable(db); err != nil {
+		return err
+	}
+	if err := MigrateSCIMTables(db); err != nil {
+		return err
+	}
+	if err := MigrateRolesTable(db); err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -85,6 +111,10 @@ func MigrateBusinessesTable(db *sql.DB) error {
 	if _, err := db.Exec(createTableQuery); err != nil {
 		return fmt.Errorf("failed to create businesses table: %w", err)
 	}
+	// Logins check this column; without it they would all fail.
+	if _, err := db.Exec("ALTER TABLE businesses ADD COLUMN IF NOT EXISTS password_login_disabled BOOLEAN NOT NULL DEFAULT FALSE;"); err != nil {
+		return fmt.Errorf("failed to add businesses.password_login_disabled: %w", err)
+	}
 	indexes := []string{
 		"CREATE INDEX IF NOT EXISTS idx_businesses_slug ON businesses(slug);",
 		"CREATE INDEX IF NOT EXISTS idx_businesses_owner_id ON businesses(owner_id);",
@@ -178,9 +208,24 @@ func MigrateBusinessDomainsTable(db *sql.DB) error {
 	if _, err := db.Exec(createTableQuery); err != nil {
 		return fmt.Errorf("failed to create business_domains table: %w", err)
 	}
+	alterQueries := []string{
+		"ALTER TABLE business_domains ADD COLUMN IF NOT EXISTS verification_method VARCHAR(10);",
+		"ALTER TABLE business_domains ADD COLUMN IF NOT EXISTS check_failures INT NOT NULL DEFAULT 0;",
+		"ALTER TABLE business_domains ADD COLUMN IF NOT EXISTS last_checked_at TIMESTAMPTZ;",
+		"ALTER TABLE business_domains ADD COLUMN IF NOT EXISTS next_check_at TIMESTAMPTZ;",
+	}
+	for _, q := range alterQueries {
+		if _, err := db.Exec(q); err != nil {
+			return fmt.Errorf("failed to alter business_domains table: %w", err)
+		}
+	}
+	if err := resetLegacyVerifiedDomains(db); err != nil {
+		return err
+	}
 	indexes := []string{
 		"CREATE INDEX IF NOT EXISTS idx_business_domains_domain ON business_domains(domain);",
 		"CREATE INDEX IF NOT EXISTS idx_business_domains_verified_auto ON business_domains(domain, verified, auto_join_enabled);",
+		"CREATE INDEX IF NOT EXISTS idx_business_domains_next_check ON business_domains(next_check_at) WHERE next_check_at IS NOT NULL;",
 	}
 	for _, idx := range indexes {
 		if _, err := db.Exec(idx); err != nil {
@@ -191,6 +236,49 @@ func MigrateBusinessDomainsTable(db *sql.DB) error {
 	return nil
 }
 
+// resetLegacyVerifiedDomains handles domains verified by posting back their
+// token, which was then cleared, without their control of the domain ever
+// being checked. They get a new token and lose verification, and with it
+// auto-join and SSO, until the token is published; the first check is due
+// at once.
+func resetLegacyVerifiedDomains(db *sql.DB) error {
+	rows, err := db.Query("SELECT id FROM business_domains WHERE verification_token IS NULL")
+	if err != nil {
+		return fmt.Errorf("failed to find domains without a verification token: %w", err)
+	}
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan business domain: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to find domains without a verification token: %w", err)
+	}
+
+	query := `UPDATE business_domains
+		SET verification_token = $1, verified = false, verified_at = NULL, verification_method = NULL,
+			check_failures = 0, next_check_at = CURRENT_TIMESTAMP
+		WHERE id = $2 AND verification_token IS NULL`
+	for _, id := range ids {
+		b := make([]byte, 32)
+		if _, err := rand.Read(b); err != nil {
+			return fmt.Errorf("failed to generate verification token: %w", err)
+		}
+		if _, err := db.Exec(query, hex.EncodeToString(b), id); err != nil {
+			return fmt.Errorf("failed to reset business domain %d: %w", id, err)
+		}
+	}
+	if len(ids) > 0 {
+		slog.Warn("Domains verified without a published token must publish their new one", slog.Int("domains", len(ids)))
+	}
+	return nil
+}
+
 // MigratePasswordResetTokensTable creates the password_reset_tokens table if it doesn't exist
 func MigratePasswordResetTokensTable(db *sql.DB) error {
 	createTableQuery := `
@@ -274,6 +362,14 @@ func MigrateUserMFATable(db *sql.DB) error {
 	if _, err := db.Exec(createTableQuery); err != nil {
 		return fmt.Errorf("failed to create user_mfa table: %w", err)
 	}
+	alterQueries := []string{
+		"ALTER TABLE user_mfa ADD COLUMN IF NOT EXISTS last_totp_step BIGINT;",
+	}
+	for _, q := range alterQueries {
+		if _, err := db.Exec(q); err != nil {
+			slog.Warn("Failed to alter user_mfa table", slog.String("query", q), slog.Any("error", err))
+		}
+	}
 	indexes := []string{
 		"CREATE INDEX IF NOT EXISTS idx_user_mfa_user_id ON user_mfa(user_id);",
 	}
@@ -285,3 +381,290 @@ func MigrateUserMFATable(db *sql.DB) error {
 	slog.Info("User_mfa table migration completed successfully")
 	return nil
 }
+
+// MigrateWebAuthnCredentialsTable creates the webauthn_credentials table for passkeys
+func MigrateWebAuthnCredentialsTable(db *sql.DB) error {
+	createTableQuery := `
+	CREATE TABLE IF NOT EXISTS webauthn_credentials (
+		id BIGSERIAL PRIMARY KEY,
+		user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		credential_id BYTEA NOT NULL UNIQUE,
+		public_key BYTEA NOT NULL,
+		sign_count BIGINT NOT NULL DEFAULT 0,
+		aaguid BYTEA,
+		transports TEXT[],
+		name VARCHAR(64) NOT NULL DEFAULT '',
+		backup_eligible BOOLEAN NOT NULL DEFAULT FALSE,
+		backed_up BOOLEAN NOT NULL DEFAULT FALSE,
+		created_at TIMESTAMPTZ DEFAULT NOW(),
+		last_used_at TIMESTAMPTZ
+	);
+	`
+	if _, err := db.Exec(createTableQuery); err != nil {
+		return fmt.Errorf("failed to create webauthn_credentials table: %w", err)
+	}
+	indexes := []string{
+		"CREATE INDEX IF NOT EXISTS idx_webauthn_credentials_user_id ON webauthn_credentials(user_id);",
+	}
+	for _, idx := range indexes {
+		if _, err := db.Exec(idx); err != nil {
+			slog.Warn("Failed to create index", slog.String("index", idx), slog.Any("error", err))
+		}
+	}
+	slog.Info("Webauthn_credentials table migration completed successfully")
+	return nil
+}
+
+// MigrateOAuthClientsTable creates the oauth_clients table for registered OAuth clients
+func MigrateOAuthClientsTable(db *sql.DB) error {
+	createTableQuery := `
+	CREATE TABLE IF NOT EXISTS oauth_clients (
+		id BIGSERIAL PRIMARY KEY,
+		client_id VARCHAR(64) NOT NULL UNIQUE,
+		name VARCHAR(100) NOT NULL,
+		secret_hash VARCHAR(64) NOT NULL,
+		created_at TIMESTAMPTZ DEFAULT NOW()
+	);
+	`
+	if _, err := db.Exec(createTableQuery); err != nil {
+		return fmt.Errorf("failed to create oauth_clients table: %w", err)
+	}
+	alterQueries := []string{
+		"ALTER TABLE oauth_clients ADD COLUMN IF NOT EXISTS public BOOLEAN NOT NULL DEFAULT FALSE;",
+		"ALTER TABLE oauth_clients ADD COLUMN IF NOT EXISTS redirect_uris TEXT[] NOT NULL DEFAULT '{}';",
+		"ALTER TABLE oauth_clients ADD COLUMN IF NOT EXISTS scopes TEXT[] NOT NULL DEFAULT '{}';",
+		"ALTER TABLE oauth_clients ADD COLUMN IF NOT EXISTS business_id BIGINT REFERENCES businesses(id) ON DELETE CASCADE;",
+		"ALTER TABLE oauth_clients ADD COLUMN IF NOT EXISTS first_party BOOLEAN NOT NULL DEFAULT FALSE;",
+	}
+	for _, q := range alterQueries {
+		if _, err := db.Exec(q); err != nil {
+			slog.Warn("Failed to alter oauth_clients table", slog.String("query", q), slog.Any("error", err))
+		}
+	}
+	slog.Info("Oauth_clients table migration completed successfully")
+	return nil
+}
+
+// MigrateOAuthConsentsTable creates the oauth_consents table for remembered consent decisions
+func MigrateOAuthConsentsTable(db *sql.DB) error {
+	createTableQuery := `
+	CREATE TABLE IF NOT EXISTS oauth_consents (
+		user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		client_id VARCHAR(64) NOT NULL REFERENCES oauth_clients(client_id) ON DELETE CASCADE,
+		scopes TEXT[] NOT NULL DEFAULT '{}',
+		granted_at TIMESTAMPTZ DEFAULT NOW(),
+		PRIMARY KEY (user_id, client_id)
+	);
+	`
+	if _, err := db.Exec(createTableQuery); err != nil {
+		return fmt.Errorf("failed to create oauth_consents table: %w", err)
+	}
+	slog.Info("Oauth_consents table migration completed successfully")
+	return nil
+}
+
+// MigratePersonalAccessTokensTable creates the personal_access_tokens table
+func MigratePersonalAccessTokensTable(db *sql.DB) error {
+	createTableQuery := `
+	CREATE TABLE IF NOT EXISTS personal_access_tokens (
+		id BIGSERIAL PRIMARY KEY,
+		user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		name VARCHAR(100) NOT NULL,
+		token_hash VARCHAR(64) NOT NULL UNIQUE,
+		scopes TEXT[] NOT NULL DEFAULT '{}',
+		business_id BIGINT REFERENCES businesses(id) ON DELETE CASCADE,
+		expires_at TIMESTAMPTZ NOT NULL,
+		last_used_at TIMESTAMPTZ,
+		created_at TIMESTAMPTZ DEFAULT NOW()
+	);
+	`
+	if _, err := db.Exec(createTableQuery); err != nil {
+		return fmt.Errorf("failed to create personal_access_tokens table: %w", err)
+	}
+	indexes := []string{
+		"CREATE INDEX IF NOT EXISTS idx_personal_access_tokens_user_id ON personal_access_tokens(user_id);",
+	}
+	for _, idx := range indexes {
+		if _, err := db.Exec(idx); err != nil {
+			slog.Warn("Failed to create index", slog.String("index", idx), slog.Any("error", err))
+		}
+	}
+	slog.Info("Personal_access_tokens table migration completed successfully")
+	return nil
+}
+
+// MigrateUserIdentitiesTable creates the user_identities table linking users
+// to external identity providers, and copies over accounts linked through the
+// older users.google_id column.
+func MigrateUserIdentitiesTable(db *sql.DB) error {
+	createTableQuery := `
+	CREATE TABLE IF NOT EXISTS user_identities (
+		id BIGSERIAL PRIMARY KEY,
+		user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		provider VARCHAR(50) NOT NULL,
+		subject VARCHAR(255) NOT NULL,
+		email VARCHAR(255) NOT NULL DEFAULT '',
+		created_at TIMESTAMPTZ DEFAULT NOW(),
+		last_used_at TIMESTAMPTZ,
+		UNIQUE (provider, subject)
+	);
+	`
+	if _, err := db.Exec(createTableQuery); err != nil {
+		return fmt.Errorf("failed to create user_identities table: %w", err)
+	}
+	queries := []string{
+		"CREATE INDEX IF NOT EXISTS idx_user_identities_user_id ON user_identities(user_id);",
+		`INSERT INTO user_identities (user_id, provider, subject, email)
+			SELECT id, 'google', google_id, email FROM users WHERE google_id IS NOT NULL
+			ON CONFLICT (provider, subject) DO NOTHING;`,
+		// Users created through an identity provider have no password.
+		"ALTER TABLE users DROP CONSTRAINT IF EXISTS users_password_check;",
+	}
+	for _, q := range queries {
+		if _, err := db.Exec(q); err != nil {
+			slog.Warn("Failed to migrate user identities", slog.String("query", q), slog.Any("error", err))
+		}
+	}
+	slog.Info("User_identities table migration completed successfully")
+	return nil
+}
+
+// MigrateSAMLConnectionsTable creates the saml_connections table holding
+// each business's SAML identity provider.
+func MigrateSAMLConnectionsTable(db *sql.DB) error {
+	createTableQuery := `
+	CREATE TABLE IF NOT EXISTS saml_connections (
+		id BIGSERIAL PRIMARY KEY,
+		business_id BIGINT NOT NULL UNIQUE REFERENCES businesses(id) ON DELETE CASCADE,
+		idp_entity_id VARCHAR(1024) NOT NULL,
+		idp_sso_url VARCHAR(2048) NOT NULL,
+		idp_slo_url VARCHAR(2048) NOT NULL DEFAULT '',
+		idp_certificate TEXT NOT NULL,
+		email_attribute VARCHAR(255) NOT NULL DEFAULT '',
+		username_attribute VARCHAR(255) NOT NULL DEFAULT '',
+		default_role INTEGER NOT NULL DEFAULT 0,
+		enabled BOOLEAN NOT NULL DEFAULT TRUE,
+		created_at TIMESTAMPTZ DEFAULT NOW(),
+		updated_at TIMESTAMPTZ DEFAULT NOW()
+	);
+	`
+	if _, err := db.Exec(createTableQuery); err != nil {
+		return fmt.Errorf("failed to create saml_connections table: %w", err)
+	}
+	slog.Info("Saml_connections table migration completed successfully")
+	return nil
+}
+
+// MigrateSCIMTables creates the tables of SCIM provisioning: each business's
+// token, and the users and groups its identity provider has provisioned.
+func MigrateSCIMTables(db *sql.DB) error {
+	queries := []string{`
+	CREATE TABLE IF NOT EXISTS scim_tokens (
+		id BIGSERIAL PRIMARY KEY,
+		business_id BIGINT NOT NULL UNIQUE REFERENCES businesses(id) ON DELETE CASCADE,
+		token_hash VARCHAR(64) NOT NULL UNIQUE,
+		created_by BIGINT REFERENCES users(id) ON DELETE SET NULL,
+		last_used_at TIMESTAMPTZ,
+		created_at TIMESTAMPTZ DEFAULT NOW()
+	);
+	`, `
+	CREATE TABLE IF NOT EXISTS scim_users (
+		business_id BIGINT NOT NULL REFERENCES businesses(id) ON DELETE CASCADE,
+		user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		user_name VARCHAR(255) NOT NULL,
+		external_id VARCHAR(255) NOT NULL DEFAULT '',
+		given_name VARCHAR(255) NOT NULL DEFAULT '',
+		family_name VARCHAR(255) NOT NULL DEFAULT '',
+		display_name VARCHAR(255) NOT NULL DEFAULT '',
+		active BOOLEAN NOT NULL DEFAULT TRUE,
+		version INTEGER NOT NULL DEFAULT 1,
+		created_at TIMESTAMPTZ DEFAULT NOW(),
+		updated_at TIMESTAMPTZ DEFAULT NOW(),
+		PRIMARY KEY (business_id, user_id)
+	);
+	`, `
+	CREATE TABLE IF NOT EXISTS scim_groups (
+		id BIGSERIAL PRIMARY KEY,
+		business_id BIGINT NOT NULL REFERENCES businesses(id) ON DELETE CASCADE,
+		display_name VARCHAR(255) NOT NULL,
+		external_id VARCHAR(255) NOT NULL DEFAULT '',
+		version INTEGER NOT NULL DEFAULT 1,
+		created_at TIMESTAMPTZ DEFAULT NOW(),
+		updated_at TIMESTAMPTZ DEFAULT NOW()
+	);
+	`, `
+	CREATE TABLE IF NOT EXISTS scim_group_members (
+		group_id BIGINT NOT NULL REFERENCES scim_groups(id) ON DELETE CASCADE,
+		user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		PRIMARY KEY (group_id, user_id)
+	);
+	`}
+	for _, q := range queries {
+		if _, err := db.Exec(q); err != nil {
+			return fmt.Errorf("failed to create scim tables: %w", err)
+		}
+	}
+	indexes := []string{
+		"CREATE UNIQUE INDEX IF NOT EXISTS idx_scim_users_user_name ON scim_users(business_id, LOWER(user_name));",
+		"CREATE UNIQUE INDEX IF NOT EXISTS idx_scim_groups_display_name ON scim_groups(business_id, LOWER(display_name));",
+		"CREATE INDEX IF NOT EXISTS idx_scim_group_members_user_id ON scim_group_members(user_id);",
+	}
+	for _, idx := range indexes {
+		if _, err := db.Exec(idx); err != nil {
+			slog.Warn("Failed to create index", slog.String("index", idx), slog.Any("error", err))
+		}
+	}
+	slog.Info("SCIM tables migration completed successfully")
+	return nil
+}
+
+// MigrateRolesTable creates the roles table, holding each business's roles
+// and their permissions as a JSON array, and gives businesses without them
+// the system roles of entity.SystemRoles.
+func MigrateRolesTable(db *sql.DB) error {
+	createTableQuery := `
+	CREATE TABLE IF NOT EXISTS roles (
+		id BIGSERIAL PRIMARY KEY,
+		business_id BIGINT NOT NULL REFERENCES businesses(id) ON DELETE CASCADE,
+		name VARCHAR(50) NOT NULL,
+		permissions TEXT NOT NULL DEFAULT '[]',
+		created_at TIMESTAMPTZ DEFAULT NOW(),
+		updated_at TIMESTAMPTZ DEFAULT NOW(),
+		UNIQUE (business_id, name)
+	);
+	`
+	if _, err := db.Exec(createTableQuery); err != nil {
+		return fmt.Errorf("failed to create roles table: %w", err)
+	}
+	// The tenant migration script created permissions as TEXT[].
+	convertQuery := `
+	DO $$
+	BEGIN
+		IF EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'roles' AND column_name = 'permissions' AND data_type = 'ARRAY') THEN
+			ALTER TABLE roles ALTER COLUMN permissions DROP DEFAULT;
+			ALTER TABLE roles ALTER COLUMN permissions TYPE TEXT USING COALESCE(array_to_json(permissions)::TEXT, '[]');
+			ALTER TABLE roles ALTER COLUMN permissions SET DEFAULT '[]';
+		END IF;
+	END $$;
+	`
+	if _, err := db.Exec(convertQuery); err != nil {
+		return fmt.Errorf("failed to convert role permissions: %w", err)
+	}
+	backfillQuery := `
+	INSERT INTO roles (business_id, name, permissions)
+	SELECT b.id, r.name, r.permissions FROM businesses b CROSS JOIN (VALUES
+		('owner', '["business:update","business:delete","members:read","members:invite","members:manage","domains:manage","sso:manage","audit:read"]'),
+		('admin', '["business:update","members:read","members:invite","members:manage","domains:manage","sso:manage","audit:read"]'),
+		('member', '["members:read"]')
+	) AS r(name, permissions)
+	ON CONFLICT (business_id, name) DO NOTHING;
+	`
+	if _, err := db.Exec(backfillQuery); err != nil {
+		return fmt.Errorf("failed to seed system roles: %w", err)
+	}
+	if _, err := db.Exec("CREATE INDEX IF NOT EXISTS idx_roles_business ON roles(business_id);"); err != nil {
+		slog.Warn("Failed to create index", slog.String("index", "idx_roles_business"), slog.Any("error", err))
+	}
+	slog.Info("Roles table migration completed successfully")
+	return nil
+}
@@ -0,0 +1,231 @@
+// Package domainverify proves control of a domain: whoever controls it
+// publishes a token, either in a TXT record at _auth-verify.<domain> or in a
+// file served at https://<domain>/.well-known/auth-verify.txt.
+package domainverify
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	// RecordPrefix is prepended to the domain to name the TXT record.
+	RecordPrefix = "_auth-verify."
+	// RecordValuePrefix starts the TXT record's value, followed by the token.
+	RecordValuePrefix = "auth-verify="
+	// WellKnownPath is where the file holding the token is served.
+	WellKnownPath = "/.well-known/auth-verify.txt"
+
+	MethodDNS  = "dns"
+	MethodHTTP = "http"
+
+	maxFileSize  = 4 << 10
+	maxRedirects = 3
+)
+
+// ErrNotVerified means the token was published neither way.
+var ErrNotVerified = errors.New("verification token not found")
+
+// Resolver looks up TXT records. *net.Resolver is one; tests use fakes.
+type Resolver interface {
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+}
+
+// Verifier checks both methods, DNS first.
+type Verifier struct {
+	Resolver Resolver
+	// HTTPClient fetches the well-known file. When nil only DNS is checked.
+	HTTPClient *http.Client
+}
+
+// New returns a Verifier that looks records up with server, a "host:port",
+// or with the system resolver when server is empty, and fetches files with
+// NewHTTPClient unless httpMethod is false.
+func New(server string, httpMethod bool) *Verifier {
+	v := &Verifier{Resolver: NewResolver(server)}
+	if httpMethod {
+		v.HTTPClient = NewHTTPClient(10 * time.Second)
+	}
+	return v
+}
+
+// NewResolver returns a resolver that queries server, or the system
+// resolver when server is empty. A public resolver keeps split-horizon DNS
+// from answering differently than the rest of the internet would.
+func NewResolver(server string) *net.Resolver {
+	if server == "" {
+		return net.DefaultResolver
+	}
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, server)
+		},
+	}
+}
+
+// NewHTTPClient returns a client for fetching well-known files from
+// domains admins name. It only connects to public addresses over HTTPS, so
+// a domain resolving to an internal service cannot make this service reach
+// it.
+func NewHTTPClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout, Control: publicAddressOnly}
+	transport := &http.Transport{
+		Proxy:               nil,
+		DialContext:         dialer.DialContext,
+		TLSHandshakeTimeout: timeout,
+		MaxIdleConns:        10,
+		IdleConnTimeout:     30 * time.Second,
+	}
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return errors.New("too many redirects")
+			}
+			if req.URL.Scheme != "https" {
+				return errors.New("redirect away from https")
+			}
+			return nil
+		},
+	}
+}
+
+// withinDomain refuses redirects to hosts other than the domain being
+// verified and its subdomains: a file served by whoever controls another
+// host proves nothing about the domain. It then applies next, the client's
+// own policy, if any.
+func withinDomain(next func(*http.Request, []*http.Request) error) func(*http.Request, []*http.Request) error {
+	return func(req *http.Request, via []*http.Request) error {
+		domain := strings.ToLower(via[0].URL.Hostname())
+		host := strings.ToLower(req.URL.Hostname())
+		if host != domain && !strings.HasSuffix(host, "."+domain) {
+			return fmt.Errorf("redirect to %s, outside %s", host, domain)
+		}
+		if next != nil {
+			return next(req, via)
+		}
+		if len(via) >= maxRedirects {
+			return errors.New("too many redirects")
+		}
+		return nil
+	}
+}
+
+func publicAddressOnly(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !IsPublic(ip) {
+		return fmt.Errorf("refusing to connect to non-public address %s", host)
+	}
+	return nil
+}
+
+// IsPublic reports whether ip is a globally routable unicast address.
+func IsPublic(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsMulticast() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() {
+		return false
+	}
+	// Carrier-grade NAT space is not covered by IsPrivate.
+	if ip4 := ip.To4(); ip4 != nil && ip4[0] == 100 && ip4[1]&0xc0 == 64 {
+		return false
+	}
+	return true
+}
+
+// ValidDomain reports whether domain is a lower-case DNS name of at least
+// two labels, as AddDomain stores them.
+func ValidDomain(domain string) bool {
+	if len(domain) > 253 || !strings.Contains(domain, ".") {
+		return false
+	}
+	for _, label := range strings.Split(domain, ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, c := range label {
+			if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '-' {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Verify returns the method by which token is published for domain. The
+// error wraps ErrNotVerified, with what each method found.
+func (v *Verifier) Verify(ctx context.Context, domain, token string) (string, error) {
+	if token == "" {
+		return "", fmt.Errorf("%w: no token", ErrNotVerified)
+	}
+	dnsErr := v.checkDNS(ctx, domain, token)
+	if dnsErr == nil {
+		return MethodDNS, nil
+	}
+	if v.HTTPClient == nil {
+		return "", fmt.Errorf("%w: dns: %v", ErrNotVerified, dnsErr)
+	}
+	httpErr := v.checkHTTP(ctx, domain, token)
+	if httpErr == nil {
+		return MethodHTTP, nil
+	}
+	return "", fmt.Errorf("%w: dns: %v; http: %v", ErrNotVerified, dnsErr, httpErr)
+}
+
+func (v *Verifier) checkDNS(ctx context.Context, domain, token string) error {
+	records, err := v.Resolver.LookupTXT(ctx, RecordPrefix+domain)
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+		return fmt.Errorf("no TXT record at %s%s", RecordPrefix, domain)
+	}
+	if err != nil {
+		return err
+	}
+	for _, record := range records {
+		if strings.TrimSpace(record) == RecordValuePrefix+token {
+			return nil
+		}
+	}
+	return fmt.Errorf("no TXT record at %s%s holds the token", RecordPrefix, domain)
+}
+
+func (v *Verifier) checkHTTP(ctx context.Context, domain, token string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://"+domain+WellKnownPath, nil)
+	if err != nil {
+		return err
+	}
+	client := *v.HTTPClient
+	client.CheckRedirect = withinDomain(v.HTTPClient.CheckRedirect)
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s answered %d", WellKnownPath, resp.StatusCode)
+	}
+	scanner := bufio.NewScanner(io.LimitReader(resp.Body, maxFileSize))
+	for scanner.Scan() {
+		if strings.TrimSpace(scanner.Text()) == token {
+			return nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return fmt.Errorf("%s does not hold the token", WellKnownPath)
+}
@@ -0,0 +1,149 @@
+package domainverify_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Prashant2307200/auth-service/pkg/domainverify"
+)
+
+type fakeResolver map[string][]string
+
+func (f fakeResolver) LookupTXT(_ context.Context, name string) ([]string, error) {
+	records, ok := f[name]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+	}
+	return records, nil
+}
+
+func TestVerify_DNS(t *testing.T) {
+	v := &domainverify.Verifier{Resolver: fakeResolver{
+		"_auth-verify.acme.com":  {"v=spf1 -all", "auth-verify=tok123"},
+		"_auth-verify.other.com": {"auth-verify=nope"},
+	}}
+	method, err := v.Verify(context.Background(), "acme.com", "tok123")
+	if err != nil || method != domainverify.MethodDNS {
+		t.Fatalf("Verify(acme.com) = %q, %v", method, err)
+	}
+	for _, domain := range []string{"other.com", "missing.com"} {
+		if _, err := v.Verify(context.Background(), domain, "tok123"); !errors.Is(err, domainverify.ErrNotVerified) {
+			t.Errorf("Verify(%s) = %v, want ErrNotVerified", domain, err)
+		}
+	}
+	if _, err := v.Verify(context.Background(), "acme.com", ""); !errors.Is(err, domainverify.ErrNotVerified) {
+		t.Errorf("empty token: %v", err)
+	}
+}
+
+func TestVerify_HTTP(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != domainverify.WellKnownPath {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprintln(w, "# auth-service")
+		fmt.Fprintln(w, "tok123")
+	}))
+	defer srv.Close()
+	host := strings.TrimPrefix(srv.URL, "https://")
+
+	v := &domainverify.Verifier{Resolver: fakeResolver{}, HTTPClient: srv.Client()}
+	method, err := v.Verify(context.Background(), host, "tok123")
+	if err != nil || method != domainverify.MethodHTTP {
+		t.Fatalf("Verify = %q, %v", method, err)
+	}
+	if _, err := v.Verify(context.Background(), host, "other"); !errors.Is(err, domainverify.ErrNotVerified) {
+		t.Fatalf("wrong token: %v", err)
+	}
+}
+
+func TestVerify_HTTPRedirects(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case domainverify.WellKnownPath:
+			http.Redirect(w, r, "/moved.txt", http.StatusFound)
+		case "/moved.txt":
+			fmt.Fprintln(w, "tok123")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	host := strings.TrimPrefix(srv.URL, "https://")
+
+	// A redirect within the domain is followed.
+	v := &domainverify.Verifier{Resolver: fakeResolver{}, HTTPClient: srv.Client()}
+	method, err := v.Verify(context.Background(), host, "tok123")
+	if err != nil || method != domainverify.MethodHTTP {
+		t.Fatalf("Verify = %q, %v", method, err)
+	}
+
+	// One to another host is not, even when that host serves the token.
+	other := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, port, _ := net.SplitHostPort(r.Host)
+		http.Redirect(w, r, "https://localhost:"+port+"/moved.txt", http.StatusFound)
+	}))
+	defer other.Close()
+	_, err = v.Verify(context.Background(), strings.TrimPrefix(other.URL, "https://"), "tok123")
+	if !errors.Is(err, domainverify.ErrNotVerified) || !strings.Contains(err.Error(), "outside") {
+		t.Fatalf("Verify through a foreign redirect = %v", err)
+	}
+}
+
+func TestNewHTTPClient_RefusesInternalAddresses(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "tok123")
+	}))
+	defer srv.Close()
+
+	v := &domainverify.Verifier{Resolver: fakeResolver{}, HTTPClient: domainverify.NewHTTPClient(time.Second)}
+	_, err := v.Verify(context.Background(), strings.TrimPrefix(srv.URL, "https://"), "tok123")
+	if !errors.Is(err, domainverify.ErrNotVerified) || !strings.Contains(err.Error(), "non-public") {
+		t.Fatalf("Verify against loopback = %v", err)
+	}
+}
+
+func TestIsPublic(t *testing.T) {
+	for addr, want := range map[string]bool{
+		"93.184.216.34": true,
+		"2606:4700::1":  true,
+		"127.0.0.1":     false,
+		"10.1.2.3":      false,
+		"192.168.0.1":   false,
+		"169.254.1.1":   false,
+		"100.64.0.1":    false,
+		"0.0.0.0":       false,
+		"::1":           false,
+		"fd00::1":       false,
+	} {
+		if got := domainverify.IsPublic(net.ParseIP(addr)); got != want {
+			t.Errorf("IsPublic(%s) = %v, want %v", addr, got, want)
+		}
+	}
+}
+
+func TestValidDomain(t *testing.T) {
+	for domain, want := range map[string]bool{
+		"acme.com":         true,
+		"mail.acme.co.uk":  true,
+		"xn--bcher-kva.de": true,
+		"localhost":        false,
+		"acme.com/path":    false,
+		"acme.com:443":     false,
+		"-acme.com":        false,
+		"acme..com":        false,
+		"ACME.com":         false,
+	} {
+		if got := domainverify.ValidDomain(domain); got != want {
+			t.Errorf("ValidDomain(%s) = %v, want %v", domain, got, want)
+		}
+	}
+}
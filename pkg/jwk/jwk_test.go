@@ -0,0 +1,47 @@
+package jwk
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Example key and expected thumbprint from RFC 7638, section 3.1.
+const (
+	rfcModulus    = "0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw"
+	rfcThumbprint = "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs"
+)
+
+func TestThumbprint_RFC7638Example(t *testing.T) {
+	pub, err := Key{Kty: "RSA", N: rfcModulus, E: "AQAB"}.RSAPublicKey()
+	require.NoError(t, err)
+	require.Equal(t, rfcThumbprint, Thumbprint(pub))
+}
+
+func TestFromRSAPublicKey_RoundTrip(t *testing.T) {
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	k := FromRSAPublicKey("kid-1", &priv.PublicKey)
+	require.Equal(t, "RSA", k.Kty)
+	require.Equal(t, "RS256", k.Alg)
+	require.Equal(t, "sig", k.Use)
+
+	pub, err := k.RSAPublicKey()
+	require.NoError(t, err)
+	require.True(t, pub.Equal(&priv.PublicKey))
+
+	set := Set{Keys: []Key{k}}
+	got, ok := set.Lookup("kid-1")
+	require.True(t, ok)
+	require.Equal(t, k, got)
+	_, ok = set.Lookup("missing")
+	require.False(t, ok)
+}
+
+func TestRSAPublicKey_RejectsNonRSA(t *testing.T) {
+	_, err := Key{Kty: "EC"}.RSAPublicKey()
+	require.Error(t, err)
+}
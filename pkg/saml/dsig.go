@@ -0,0 +1,223 @@
+package saml
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	nsDSig = "http://www.w3.org/2000/09/xmldsig#"
+
+	algExcC14N      = "http://www.w3.org/2001/10/xml-exc-c14n#"
+	algEnveloped    = "http://www.w3.org/2000/09/xmldsig#enveloped-signature"
+	algSHA256       = "http://www.w3.org/2001/04/xmlenc#sha256"
+	algSHA512       = "http://www.w3.org/2001/04/xmlenc#sha512"
+	algRSASHA256    = "http://www.w3.org/2001/04/xmldsig-more#rsa-sha256"
+	algRSASHA512    = "http://www.w3.org/2001/04/xmldsig-more#rsa-sha512"
+	maxSignedIDSize = 256
+)
+
+var (
+	// ErrNotSigned is returned for a message that carries no signature.
+	ErrNotSigned = errors.New("saml: message is not signed")
+	// ErrInvalidSignature is returned when a signature does not verify with
+	// any of the identity provider's certificates.
+	ErrInvalidSignature = errors.New("saml: invalid signature")
+)
+
+// digestHash and signatureHash map the algorithms this package accepts to
+// their hash. SHA-1 is not among them.
+func digestHash(alg string) (crypto.Hash, bool) {
+	switch alg {
+	case algSHA256:
+		return crypto.SHA256, true
+	case algSHA512:
+		return crypto.SHA512, true
+	}
+	return 0, false
+}
+
+func signatureHash(alg string) (crypto.Hash, bool) {
+	switch alg {
+	case algRSASHA256:
+		return crypto.SHA256, true
+	case algRSASHA512:
+		return crypto.SHA512, true
+	}
+	return 0, false
+}
+
+func sum(h crypto.Hash, data []byte) []byte {
+	if h == crypto.SHA512 {
+		s := sha512.Sum512(data)
+		return s[:]
+	}
+	s := sha256.Sum256(data)
+	return s[:]
+}
+
+// verifySignature checks the enveloped signature that is a direct child of
+// e and must cover exactly e, so whatever the caller reads from e is what
+// was signed.
+func verifySignature(e *element, certs []*x509.Certificate) error {
+	sig := e.child(nsDSig, "Signature")
+	if sig == nil {
+		return ErrNotSigned
+	}
+	id := e.attr("ID")
+	if id == "" || len(id) > maxSignedIDSize {
+		return fmt.Errorf("%w: signed element has no ID", ErrInvalidSignature)
+	}
+
+	signedInfo := sig.child(nsDSig, "SignedInfo")
+	if signedInfo == nil {
+		return fmt.Errorf("%w: missing SignedInfo", ErrInvalidSignature)
+	}
+	c14nMethod := signedInfo.child(nsDSig, "CanonicalizationMethod")
+	if c14nMethod == nil || c14nMethod.attr("Algorithm") != algExcC14N {
+		return fmt.Errorf("%w: unsupported canonicalization", ErrInvalidSignature)
+	}
+	sigMethod := signedInfo.child(nsDSig, "SignatureMethod")
+	if sigMethod == nil {
+		return fmt.Errorf("%w: missing SignatureMethod", ErrInvalidSignature)
+	}
+	sigHash, ok := signatureHash(sigMethod.attr("Algorithm"))
+	if !ok {
+		return fmt.Errorf("%w: unsupported signature algorithm %q", ErrInvalidSignature, sigMethod.attr("Algorithm"))
+	}
+
+	refs := signedInfo.childrenNamed(nsDSig, "Reference")
+	if len(refs) != 1 || refs[0].attr("URI") != "#"+id {
+		return fmt.Errorf("%w: signature does not reference the signed element", ErrInvalidSignature)
+	}
+	ref := refs[0]
+	var enveloped, excC14N bool
+	var prefixes []string
+	if transforms := ref.child(nsDSig, "Transforms"); transforms != nil {
+		for _, t := range transforms.childrenNamed(nsDSig, "Transform") {
+			switch t.attr("Algorithm") {
+			case algEnveloped:
+				enveloped = true
+			case algExcC14N:
+				excC14N = true
+				prefixes = inclusivePrefixes(t)
+			default:
+				return fmt.Errorf("%w: unsupported transform %q", ErrInvalidSignature, t.attr("Algorithm"))
+			}
+		}
+	}
+	if !enveloped || !excC14N {
+		return fmt.Errorf("%w: signature must be enveloped and use exclusive canonicalization", ErrInvalidSignature)
+	}
+	digestMethod := ref.child(nsDSig, "DigestMethod")
+	digestValue := ref.child(nsDSig, "DigestValue")
+	if digestMethod == nil || digestValue == nil {
+		return fmt.Errorf("%w: missing digest", ErrInvalidSignature)
+	}
+	refHash, ok := digestHash(digestMethod.attr("Algorithm"))
+	if !ok {
+		return fmt.Errorf("%w: unsupported digest algorithm %q", ErrInvalidSignature, digestMethod.attr("Algorithm"))
+	}
+	want, err := decodeBase64(digestValue.text())
+	if err != nil {
+		return fmt.Errorf("%w: malformed digest", ErrInvalidSignature)
+	}
+	if subtle.ConstantTimeCompare(want, sum(refHash, canonicalize(e, sig, prefixes))) != 1 {
+		return fmt.Errorf("%w: digest mismatch", ErrInvalidSignature)
+	}
+
+	sigValue := sig.child(nsDSig, "SignatureValue")
+	if sigValue == nil {
+		return fmt.Errorf("%w: missing SignatureValue", ErrInvalidSignature)
+	}
+	signature, err := decodeBase64(sigValue.text())
+	if err != nil {
+		return fmt.Errorf("%w: malformed signature value", ErrInvalidSignature)
+	}
+	signed := sum(sigHash, canonicalize(signedInfo, nil, inclusivePrefixes(c14nMethod)))
+	if !verifyRSA(certs, sigHash, signed, signature) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+func verifyRSA(certs []*x509.Certificate, h crypto.Hash, digest, signature []byte) bool {
+	for _, cert := range certs {
+		pub, ok := cert.PublicKey.(*rsa.PublicKey)
+		if ok && rsa.VerifyPKCS1v15(pub, h, digest, signature) == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// inclusivePrefixes reads the InclusiveNamespaces PrefixList of an
+// exclusive canonicalization transform.
+func inclusivePrefixes(e *element) []string {
+	if in := e.child(algExcC14N, "InclusiveNamespaces"); in != nil {
+		return strings.Fields(in.attr("PrefixList"))
+	}
+	return nil
+}
+
+func decodeBase64(s string) ([]byte, error) {
+	return base64.StdEncoding.DecodeString(strings.Join(strings.Fields(s), ""))
+}
+
+// Sign adds an enveloped RSA-SHA256 signature, with cert in its KeyInfo, to
+// the element of doc whose ID attribute is id. The signature goes after the
+// element's Issuer, where SAML schemas expect it. The returned document is
+// in canonical form.
+func Sign(doc []byte, id string, key *rsa.PrivateKey, cert *x509.Certificate) ([]byte, error) {
+	root, err := parseXML(doc)
+	if err != nil {
+		return nil, err
+	}
+	e := root.findByID(id)
+	if e == nil {
+		return nil, fmt.Errorf("saml: no element with ID %q", id)
+	}
+	digest := sha256.Sum256(canonicalize(e, nil, nil))
+
+	sig, err := parseXML([]byte(`<ds:Signature xmlns:ds="` + nsDSig + `"><ds:SignedInfo>` +
+		`<ds:CanonicalizationMethod Algorithm="` + algExcC14N + `"></ds:CanonicalizationMethod>` +
+		`<ds:SignatureMethod Algorithm="` + algRSASHA256 + `"></ds:SignatureMethod>` +
+		`<ds:Reference URI="#` + escapeAttr(id) + `"><ds:Transforms>` +
+		`<ds:Transform Algorithm="` + algEnveloped + `"></ds:Transform>` +
+		`<ds:Transform Algorithm="` + algExcC14N + `"></ds:Transform>` +
+		`</ds:Transforms><ds:DigestMethod Algorithm="` + algSHA256 + `"></ds:DigestMethod>` +
+		`<ds:DigestValue>` + base64.StdEncoding.EncodeToString(digest[:]) + `</ds:DigestValue>` +
+		`</ds:Reference></ds:SignedInfo><ds:SignatureValue></ds:SignatureValue>` +
+		`<ds:KeyInfo><ds:X509Data><ds:X509Certificate>` + base64.StdEncoding.EncodeToString(cert.Raw) +
+		`</ds:X509Certificate></ds:X509Data></ds:KeyInfo></ds:Signature>`))
+	if err != nil {
+		return nil, err
+	}
+	sig.parent = e
+	at := 0
+	for i, c := range e.children {
+		if child, ok := c.(*element); ok && child.is(nsAssertion, "Issuer") {
+			at = i + 1
+			break
+		}
+	}
+	e.children = append(e.children[:at], append([]any{sig}, e.children[at:]...)...)
+
+	signed := sha256.Sum256(canonicalize(sig.child(nsDSig, "SignedInfo"), nil, nil))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, signed[:])
+	if err != nil {
+		return nil, err
+	}
+	sigValue := sig.child(nsDSig, "SignatureValue")
+	sigValue.children = []any{base64.StdEncoding.EncodeToString(signature)}
+	return canonicalize(root, nil, nil), nil
+}
@@ -0,0 +1,200 @@
+package saml_test
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Prashant2307200/auth-service/pkg/saml"
+	"github.com/Prashant2307200/auth-service/pkg/saml/samltest"
+)
+
+const nsAssertion = "urn:oasis:names:tc:SAML:2.0:assertion"
+
+// signedDoc returns the XML of a Response issued by idp, signed as opts say.
+func signedDoc(t *testing.T, sp *saml.ServiceProvider, idp *samltest.IdP, opts samltest.ResponseOptions) string {
+	t.Helper()
+	encoded, err := idp.Response(responseFor(sp, opts))
+	if err != nil {
+		t.Fatalf("response: %v", err)
+	}
+	data, _ := base64.StdEncoding.DecodeString(encoded)
+	return string(data)
+}
+
+// splitAssertion cuts doc around its one saml:Assertion element.
+func splitAssertion(t *testing.T, doc string) (before, assertion, after string) {
+	t.Helper()
+	start := strings.Index(doc, "<saml:Assertion")
+	end := strings.Index(doc, "</saml:Assertion>") + len("</saml:Assertion>")
+	if start < 0 || end < start {
+		t.Fatalf("no assertion in %s", doc)
+	}
+	return doc[:start], doc[start:end], doc[end:]
+}
+
+func replaceOnce(t *testing.T, s, old, new string) string {
+	t.Helper()
+	if !strings.Contains(s, old) {
+		t.Fatalf("%q not in %s", old, s)
+	}
+	return strings.Replace(s, old, new, 1)
+}
+
+func parse(sp *saml.ServiceProvider, doc string) (*saml.Assertion, error) {
+	return sp.ParseResponse(base64.StdEncoding.EncodeToString([]byte(doc)), time.Now())
+}
+
+// Whatever is moved around a signed message, the NameID read must be the
+// one that was signed, or the message must be refused.
+func TestParseResponse_SignatureWrapping(t *testing.T) {
+	sp, idp := newPair(t)
+	assertionSigned := signedDoc(t, sp, idp, samltest.ResponseOptions{SignAssertion: true})
+	responseSigned := signedDoc(t, sp, idp, samltest.ResponseOptions{SignResponse: true})
+
+	before, signed, after := splitAssertion(t, assertionSigned)
+	evil := replaceOnce(t, signed, ">u-123<", ">admin<")
+	sigStart := strings.Index(signed, "<ds:Signature")
+	sigEnd := strings.Index(signed, "</ds:Signature>") + len("</ds:Signature>")
+	evilUnsigned := replaceOnce(t, evil, signed[sigStart:sigEnd], "")
+	signedID := attrValue(t, signed, "ID")
+	evilRenamed := replaceOnce(t, evil, `ID="`+signedID+`"`, `ID="id-evil"`)
+	extensions := func(inner string) string {
+		return `<samlp:Extensions>` + inner + `</samlp:Extensions>`
+	}
+
+	rBefore, rAssertion, rAfter := splitAssertion(t, responseSigned)
+	responseStart := strings.Index(responseSigned, ">") + 1
+
+	tests := []struct {
+		name string
+		doc  string
+	}{
+		{"forged assertion, signed one moved into Extensions", before + extensions(signed) + evil + after},
+		{"forged assertion without signature, signed one moved into Extensions", before + extensions(signed) + evilUnsigned + after},
+		{"forged assertion pointing at the signed one's signature", before + extensions(signed) + evilRenamed + after},
+		{"forged assertion sharing the signed one's ID", before + signed + replaceOnce(t, after, "</samlp:Response>", extensions(evilUnsigned)+"</samlp:Response>")},
+		{"signed assertion's signature moved to the Response", replaceOnce(t, before, "<samlp:Status>", signed[sigStart:sigEnd]+"<samlp:Status>") + evilUnsigned + after},
+		{"signed Response wrapped in a forged one", `<samlp:Response xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol" ID="id-outer" Version="2.0" InResponseTo="id-request">` +
+			`<samlp:Status><samlp:StatusCode Value="` + saml.StatusSuccess + `"></samlp:StatusCode></samlp:Status>` +
+			replaceOnce(t, evilUnsigned, `ID="`+signedID+`"`, `ID="id-evil"`) + extensions(responseSigned) + `</samlp:Response>`},
+		{"assertion of a signed Response replaced", rBefore + replaceOnce(t, rAssertion, ">u-123<", ">admin<") + rAfter},
+		{"second assertion added to a signed Response", responseSigned[:responseStart] + replaceOnce(t, rAssertion, ">u-123<", ">admin<") + responseSigned[responseStart:]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if a, err := parse(sp, tt.doc); err == nil {
+				t.Errorf("accepted, NameID %q", a.NameID)
+			}
+		})
+	}
+}
+
+// Comments and processing instructions are not covered by the signature,
+// so text split by one must be read whole, as it was signed.
+func TestParseResponse_CommentInNameID(t *testing.T) {
+	sp, idp := newPair(t)
+	const signedName = "ada@example.com.evil.org"
+	doc := signedDoc(t, sp, idp, samltest.ResponseOptions{
+		SignAssertion: true,
+		NameID:        signedName,
+		Attributes:    map[string][]string{"email": {signedName}},
+	})
+	for _, split := range []string{"<!---->", "<!-- .evil.org -->", "<?x?>"} {
+		t.Run(split, func(t *testing.T) {
+			injected := strings.ReplaceAll(doc, "ada@example.com.evil.org<", "ada@example.com"+split+".evil.org<")
+			a, err := parse(sp, injected)
+			if err != nil {
+				t.Fatalf("ParseResponse failed: %v", err)
+			}
+			if a.NameID != signedName || a.Attribute("email") != signedName {
+				t.Errorf("read NameID %q and email %q, want %q", a.NameID, a.Attribute("email"), signedName)
+			}
+		})
+	}
+}
+
+func TestParseResponse_DuplicateIDs(t *testing.T) {
+	sp, idp := newPair(t)
+	doc := signedDoc(t, sp, idp, samltest.ResponseOptions{SignResponse: true, SignAssertion: true})
+	_, signed, _ := splitAssertion(t, doc)
+	responseID := attrValue(t, doc, "ID")
+
+	tests := []struct {
+		name string
+		doc  string
+	}{
+		// The Response's own signature still verifies: only the ID check
+		// stands between the copy and the reader.
+		{"unsigned element sharing the Response's ID", replaceOnce(t, doc, "</samlp:Response>", `<samlp:Extensions><x ID="`+responseID+`"></x></samlp:Extensions></samlp:Response>`)},
+		{"assertion copied next to itself", replaceOnce(t, doc, signed, signed+signed)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if a, err := parse(sp, tt.doc); err == nil {
+				t.Errorf("accepted, NameID %q", a.NameID)
+			}
+		})
+	}
+}
+
+// Elements are matched by namespace URI, never by prefix, and a prefix
+// rebound inside signed content changes what was signed.
+func TestParseResponse_NamespaceConfusion(t *testing.T) {
+	sp, idp := newPair(t)
+	doc := signedDoc(t, sp, idp, samltest.ResponseOptions{SignAssertion: true})
+	before, signed, after := splitAssertion(t, doc)
+	forged := func(name, open string) string {
+		return open + `<saml:Issuer>` + idp.EntityID + `</saml:Issuer><saml:Subject><saml:NameID>admin</saml:NameID></saml:Subject></` + name + `>`
+	}
+
+	rejected := []struct {
+		name string
+		doc  string
+	}{
+		{"NameID rebound to another namespace", before + replaceOnce(t, signed, "<saml:NameID", `<saml:NameID xmlns:saml="urn:evil"`) + after},
+		{"NameID given another prefix", before + strings.ReplaceAll(replaceOnce(t, signed, "<saml:NameID", `<evil:NameID xmlns:evil="`+nsAssertion+`"`), "</saml:NameID>", "</evil:NameID>") + after},
+		{"forged assertion under another prefix", before + forged("evil:Assertion", `<evil:Assertion xmlns:evil="`+nsAssertion+`" xmlns:saml="`+nsAssertion+`" ID="id-evil" Version="2.0">`) + signed + after},
+		{"forged assertion in the default namespace", before + forged("Assertion", `<Assertion xmlns="`+nsAssertion+`" xmlns:saml="`+nsAssertion+`" ID="id-evil" Version="2.0">`) + signed + after},
+	}
+	for _, tt := range rejected {
+		t.Run(tt.name, func(t *testing.T) {
+			if a, err := parse(sp, tt.doc); err == nil {
+				t.Errorf("accepted, NameID %q", a.NameID)
+			}
+		})
+	}
+
+	// Lookalikes in foreign namespaces are not SAML elements at all: the
+	// signed assertion is still the one, and the only one, read.
+	ignored := []struct {
+		name string
+		doc  string
+	}{
+		{"assertion prefix bound to a foreign namespace", before + forged("saml:Assertion", `<saml:Assertion xmlns:saml="urn:evil" ID="id-evil" Version="2.0">`) + signed + after},
+		{"Subject next to the signed assertion", before + `<saml:Subject xmlns:saml="` + nsAssertion + `"><saml:NameID>admin</saml:NameID></saml:Subject>` + signed + after},
+	}
+	for _, tt := range ignored {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := parse(sp, tt.doc)
+			if err != nil {
+				t.Fatalf("ParseResponse failed: %v", err)
+			}
+			if a.NameID != "u-123" || a.ID != attrValue(t, signed, "ID") {
+				t.Errorf("read assertion %q with NameID %q, not the signed one", a.ID, a.NameID)
+			}
+		})
+	}
+}
+
+// attrValue returns the first value of the attribute name in doc.
+func attrValue(t *testing.T, doc, name string) string {
+	t.Helper()
+	_, rest, ok := strings.Cut(doc, " "+name+`="`)
+	value, _, ok2 := strings.Cut(rest, `"`)
+	if !ok || !ok2 {
+		t.Fatalf("no %s attribute in %s", name, doc)
+	}
+	return value
+}
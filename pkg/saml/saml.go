@@ -0,0 +1,655 @@
+// Package saml implements the service-provider side of SAML 2.0 Web Browser
+// SSO: signed AuthnRequests over the HTTP-Redirect binding, Responses over
+// HTTP-POST, single logout over HTTP-Redirect, and metadata. Responses must
+// be signed with XML-DSig by the identity provider, either as a whole or on
+// their one assertion; encrypted assertions are not supported.
+package saml
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	nsAssertion = "urn:oasis:names:tc:SAML:2.0:assertion"
+	nsProtocol  = "urn:oasis:names:tc:SAML:2.0:protocol"
+	nsMetadata  = "urn:oasis:names:tc:SAML:2.0:metadata"
+
+	BindingRedirect = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-Redirect"
+	BindingPOST     = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST"
+
+	StatusSuccess = "urn:oasis:names:tc:SAML:2.0:status:Success"
+
+	NameIDFormatUnspecified = "urn:oasis:names:tc:SAML:1.1:nameid-format:unspecified"
+	NameIDFormatEmail       = "urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress"
+	NameIDFormatPersistent  = "urn:oasis:names:tc:SAML:2.0:nameid-format:persistent"
+
+	confirmationBearer = "urn:oasis:names:tc:SAML:2.0:cm:bearer"
+
+	// MaxClockSkew is how far the identity provider's clock may be off.
+	MaxClockSkew = 3 * time.Minute
+	// maxMessageSize bounds decoded messages, before and after inflating.
+	maxMessageSize = 1 << 20
+)
+
+var (
+	ErrInvalidMessage = errors.New("saml: invalid message")
+	// ErrStatus is returned for a Response or LogoutResponse whose status is
+	// not Success, such as a user who cancelled at the identity provider.
+	ErrStatus = errors.New("saml: identity provider returned an error status")
+)
+
+// IdentityProvider is what the service provider knows about an identity
+// provider, typically from its metadata.
+type IdentityProvider struct {
+	EntityID string
+	// SSOURL receives AuthnRequests over the HTTP-Redirect binding.
+	SSOURL string
+	// SLOURL receives logout messages over the HTTP-Redirect binding; empty
+	// when the identity provider does not support single logout.
+	SLOURL string
+	// Certificates verify the identity provider's signatures; more than one
+	// allows for rotation.
+	Certificates []*x509.Certificate
+}
+
+// ServiceProvider is one SAML service provider talking to one identity
+// provider.
+type ServiceProvider struct {
+	EntityID string
+	ACSURL   string
+	SLOURL   string
+	// Key signs AuthnRequests and logout messages; Certificate publishes it
+	// in the metadata.
+	Key         *rsa.PrivateKey
+	Certificate *x509.Certificate
+	IdP         IdentityProvider
+}
+
+// Assertion is what a verified Response says about the user.
+type Assertion struct {
+	ID           string
+	InResponseTo string
+	NameID       string
+	NameIDFormat string
+	SessionIndex string
+	Attributes   map[string][]string
+}
+
+// Attribute returns the first value of the named attribute.
+func (a *Assertion) Attribute(name string) string {
+	if v := a.Attributes[name]; len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+// LogoutRequest is a verified logout request from the identity provider.
+type LogoutRequest struct {
+	ID             string
+	NameID         string
+	SessionIndexes []string
+	RelayState     string
+}
+
+// NewID returns a random message ID. IDs are xs:ID values, which may not
+// start with a digit.
+func NewID() (string, error) {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "id-" + hex.EncodeToString(b), nil
+}
+
+// AuthnRequestURL returns the URL that sends the browser to the identity
+// provider with a signed AuthnRequest with the given ID.
+func (sp *ServiceProvider) AuthnRequestURL(id, relayState string, now time.Time) (string, error) {
+	msg := `<samlp:AuthnRequest xmlns:samlp="` + nsProtocol + `" xmlns:saml="` + nsAssertion + `"` +
+		` ID="` + escapeAttr(id) + `" Version="2.0" IssueInstant="` + formatTime(now) + `"` +
+		` Destination="` + escapeAttr(sp.IdP.SSOURL) + `"` +
+		` AssertionConsumerServiceURL="` + escapeAttr(sp.ACSURL) + `" ProtocolBinding="` + BindingPOST + `">` +
+		`<saml:Issuer>` + escapeText(sp.EntityID) + `</saml:Issuer>` +
+		`<samlp:NameIDPolicy Format="` + NameIDFormatUnspecified + `" AllowCreate="true"></samlp:NameIDPolicy>` +
+		`</samlp:AuthnRequest>`
+	return EncodeRedirect(sp.IdP.SSOURL, "SAMLRequest", []byte(msg), relayState, sp.Key)
+}
+
+// ParseResponse verifies a base64 Response from the HTTP-POST binding and
+// returns its assertion. The caller must check that InResponseTo is a
+// request it sent and has not seen answered before.
+func (sp *ServiceProvider) ParseResponse(encoded string, now time.Time) (*Assertion, error) {
+	if len(encoded) > maxMessageSize {
+		return nil, fmt.Errorf("%w: too large", ErrInvalidMessage)
+	}
+	data, err := decodeBase64(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("%w: not base64", ErrInvalidMessage)
+	}
+	root, err := parseXML(data)
+	if err != nil {
+		return nil, err
+	}
+	if !root.is(nsProtocol, "Response") {
+		return nil, fmt.Errorf("%w: not a Response", ErrInvalidMessage)
+	}
+	if err := sp.checkMessage(root, sp.ACSURL); err != nil {
+		return nil, err
+	}
+
+	if root.child(nsAssertion, "EncryptedAssertion") != nil {
+		return nil, fmt.Errorf("%w: encrypted assertions are not supported", ErrInvalidMessage)
+	}
+	assertions := root.childrenNamed(nsAssertion, "Assertion")
+	if len(assertions) != 1 {
+		return nil, fmt.Errorf("%w: expected exactly one assertion", ErrInvalidMessage)
+	}
+	assertion := assertions[0]
+
+	// Either signature vouches for the assertion, as long as whatever is
+	// read below comes from the very elements that were verified.
+	responseSigned := root.child(nsDSig, "Signature") != nil
+	if responseSigned {
+		if err := verifySignature(root, sp.IdP.Certificates); err != nil {
+			return nil, err
+		}
+	}
+	if err := verifySignature(assertion, sp.IdP.Certificates); err != nil && (!responseSigned || !errors.Is(err, ErrNotSigned)) {
+		return nil, err
+	}
+
+	if err := checkStatus(root); err != nil {
+		return nil, err
+	}
+	inResponseTo := root.attr("InResponseTo")
+	if inResponseTo == "" {
+		return nil, fmt.Errorf("%w: unsolicited responses are not accepted", ErrInvalidMessage)
+	}
+	return sp.readAssertion(assertion, inResponseTo, now)
+}
+
+// checkMessage checks the Issuer and Destination common to protocol
+// messages; both are optional on a message but must match when present.
+func (sp *ServiceProvider) checkMessage(msg *element, destination string) error {
+	if issuer := msg.child(nsAssertion, "Issuer"); issuer != nil && issuer.text() != sp.IdP.EntityID {
+		return fmt.Errorf("%w: unexpected issuer %q", ErrInvalidMessage, issuer.text())
+	}
+	if d := msg.attr("Destination"); d != "" && d != destination {
+		return fmt.Errorf("%w: unexpected destination %q", ErrInvalidMessage, d)
+	}
+	if msg.attr("Version") != "2.0" {
+		return fmt.Errorf("%w: unsupported version", ErrInvalidMessage)
+	}
+	return nil
+}
+
+func checkStatus(msg *element) error {
+	status := msg.child(nsProtocol, "Status")
+	if status == nil {
+		return fmt.Errorf("%w: missing status", ErrInvalidMessage)
+	}
+	code := status.child(nsProtocol, "StatusCode")
+	if code == nil {
+		return fmt.Errorf("%w: missing status code", ErrInvalidMessage)
+	}
+	if code.attr("Value") != StatusSuccess {
+		detail := code.attr("Value")
+		if sub := code.child(nsProtocol, "StatusCode"); sub != nil {
+			detail += " " + sub.attr("Value")
+		}
+		return fmt.Errorf("%w: %s", ErrStatus, detail)
+	}
+	return nil
+}
+
+func (sp *ServiceProvider) readAssertion(a *element, inResponseTo string, now time.Time) (*Assertion, error) {
+	if a.attr("Version") != "2.0" {
+		return nil, fmt.Errorf("%w: unsupported assertion version", ErrInvalidMessage)
+	}
+	if issuer := a.child(nsAssertion, "Issuer"); issuer == nil || issuer.text() != sp.IdP.EntityID {
+		return nil, fmt.Errorf("%w: assertion from an unexpected issuer", ErrInvalidMessage)
+	}
+
+	subject := a.child(nsAssertion, "Subject")
+	if subject == nil {
+		return nil, fmt.Errorf("%w: missing subject", ErrInvalidMessage)
+	}
+	nameID := subject.child(nsAssertion, "NameID")
+	if nameID == nil || nameID.text() == "" {
+		return nil, fmt.Errorf("%w: missing NameID", ErrInvalidMessage)
+	}
+	confirmed := false
+	for _, c := range subject.childrenNamed(nsAssertion, "SubjectConfirmation") {
+		data := c.child(nsAssertion, "SubjectConfirmationData")
+		if c.attr("Method") != confirmationBearer || data == nil {
+			continue
+		}
+		if data.attr("Recipient") != sp.ACSURL || data.attr("InResponseTo") != inResponseTo {
+			continue
+		}
+		if notOnOrAfter, err := parseTime(data.attr("NotOnOrAfter")); err != nil || !now.Before(notOnOrAfter.Add(MaxClockSkew)) {
+			continue
+		}
+		confirmed = true
+		break
+	}
+	if !confirmed {
+		return nil, fmt.Errorf("%w: no valid bearer subject confirmation", ErrInvalidMessage)
+	}
+
+	conditions := a.child(nsAssertion, "Conditions")
+	if conditions == nil {
+		return nil, fmt.Errorf("%w: missing conditions", ErrInvalidMessage)
+	}
+	if v := conditions.attr("NotBefore"); v != "" {
+		notBefore, err := parseTime(v)
+		if err != nil || now.Add(MaxClockSkew).Before(notBefore) {
+			return nil, fmt.Errorf("%w: assertion not yet valid", ErrInvalidMessage)
+		}
+	}
+	if v := conditions.attr("NotOnOrAfter"); v != "" {
+		notOnOrAfter, err := parseTime(v)
+		if err != nil || !now.Before(notOnOrAfter.Add(MaxClockSkew)) {
+			return nil, fmt.Errorf("%w: assertion expired", ErrInvalidMessage)
+		}
+	}
+	restrictions := conditions.childrenNamed(nsAssertion, "AudienceRestriction")
+	if len(restrictions) == 0 {
+		return nil, fmt.Errorf("%w: assertion has no audience", ErrInvalidMessage)
+	}
+	for _, r := range restrictions {
+		ok := false
+		for _, audience := range r.childrenNamed(nsAssertion, "Audience") {
+			ok = ok || audience.text() == sp.EntityID
+		}
+		if !ok {
+			return nil, fmt.Errorf("%w: assertion is for another audience", ErrInvalidMessage)
+		}
+	}
+
+	out := &Assertion{
+		ID:           a.attr("ID"),
+		InResponseTo: inResponseTo,
+		NameID:       nameID.text(),
+		NameIDFormat: nameID.attr("Format"),
+		Attributes:   make(map[string][]string),
+	}
+	statement := a.child(nsAssertion, "AuthnStatement")
+	if statement == nil {
+		return nil, fmt.Errorf("%w: missing AuthnStatement", ErrInvalidMessage)
+	}
+	out.SessionIndex = statement.attr("SessionIndex")
+	if v := statement.attr("SessionNotOnOrAfter"); v != "" {
+		if end, err := parseTime(v); err != nil || !now.Before(end) {
+			return nil, fmt.Errorf("%w: identity provider session has ended", ErrInvalidMessage)
+		}
+	}
+	for _, statement := range a.childrenNamed(nsAssertion, "AttributeStatement") {
+		for _, attribute := range statement.childrenNamed(nsAssertion, "Attribute") {
+			name := attribute.attr("Name")
+			for _, value := range attribute.childrenNamed(nsAssertion, "AttributeValue") {
+				out.Attributes[name] = append(out.Attributes[name], value.text())
+			}
+		}
+	}
+	return out, nil
+}
+
+// LogoutRequestURL returns the URL that sends the browser to the identity
+// provider's single logout service with a signed LogoutRequest for nameID.
+func (sp *ServiceProvider) LogoutRequestURL(id, nameID, sessionIndex, relayState string, now time.Time) (string, error) {
+	if sp.IdP.SLOURL == "" {
+		return "", errors.New("saml: identity provider has no single logout service")
+	}
+	msg := `<samlp:LogoutRequest xmlns:samlp="` + nsProtocol + `" xmlns:saml="` + nsAssertion + `"` +
+		` ID="` + escapeAttr(id) + `" Version="2.0" IssueInstant="` + formatTime(now) + `"` +
+		` Destination="` + escapeAttr(sp.IdP.SLOURL) + `">` +
+		`<saml:Issuer>` + escapeText(sp.EntityID) + `</saml:Issuer>` +
+		`<saml:NameID>` + escapeText(nameID) + `</saml:NameID>`
+	if sessionIndex != "" {
+		msg += `<samlp:SessionIndex>` + escapeText(sessionIndex) + `</samlp:SessionIndex>`
+	}
+	msg += `</samlp:LogoutRequest>`
+	return EncodeRedirect(sp.IdP.SLOURL, "SAMLRequest", []byte(msg), relayState, sp.Key)
+}
+
+// LogoutResponseURL returns the URL that answers the identity provider's
+// LogoutRequest with a signed success.
+func (sp *ServiceProvider) LogoutResponseURL(req *LogoutRequest, now time.Time) (string, error) {
+	if sp.IdP.SLOURL == "" {
+		return "", errors.New("saml: identity provider has no single logout service")
+	}
+	id, err := NewID()
+	if err != nil {
+		return "", err
+	}
+	msg := `<samlp:LogoutResponse xmlns:samlp="` + nsProtocol + `" xmlns:saml="` + nsAssertion + `"` +
+		` ID="` + id + `" InResponseTo="` + escapeAttr(req.ID) + `" Version="2.0" IssueInstant="` + formatTime(now) + `"` +
+		` Destination="` + escapeAttr(sp.IdP.SLOURL) + `">` +
+		`<saml:Issuer>` + escapeText(sp.EntityID) + `</saml:Issuer>` +
+		`<samlp:Status><samlp:StatusCode Value="` + StatusSuccess + `"></samlp:StatusCode></samlp:Status>` +
+		`</samlp:LogoutResponse>`
+	return EncodeRedirect(sp.IdP.SLOURL, "SAMLResponse", []byte(msg), req.RelayState, sp.Key)
+}
+
+// ParseLogoutRequest verifies a LogoutRequest the identity provider sent
+// over the HTTP-Redirect binding; rawQuery is the request's undecoded query,
+// over which the signature was made.
+func (sp *ServiceProvider) ParseLogoutRequest(rawQuery string, now time.Time) (*LogoutRequest, error) {
+	root, relayState, err := sp.parseRedirect(rawQuery, "SAMLRequest")
+	if err != nil {
+		return nil, err
+	}
+	if !root.is(nsProtocol, "LogoutRequest") {
+		return nil, fmt.Errorf("%w: not a LogoutRequest", ErrInvalidMessage)
+	}
+	if err := sp.checkMessage(root, sp.SLOURL); err != nil {
+		return nil, err
+	}
+	if v := root.attr("NotOnOrAfter"); v != "" {
+		if end, err := parseTime(v); err != nil || !now.Before(end.Add(MaxClockSkew)) {
+			return nil, fmt.Errorf("%w: logout request expired", ErrInvalidMessage)
+		}
+	}
+	nameID := root.child(nsAssertion, "NameID")
+	if nameID == nil || nameID.text() == "" || root.attr("ID") == "" {
+		return nil, fmt.Errorf("%w: logout request without NameID", ErrInvalidMessage)
+	}
+	req := &LogoutRequest{ID: root.attr("ID"), NameID: nameID.text(), RelayState: relayState}
+	for _, index := range root.childrenNamed(nsProtocol, "SessionIndex") {
+		req.SessionIndexes = append(req.SessionIndexes, index.text())
+	}
+	return req, nil
+}
+
+// ParseLogoutResponse verifies the identity provider's answer to a
+// LogoutRequest and returns its RelayState.
+func (sp *ServiceProvider) ParseLogoutResponse(rawQuery string) (string, error) {
+	root, relayState, err := sp.parseRedirect(rawQuery, "SAMLResponse")
+	if err != nil {
+		return "", err
+	}
+	if !root.is(nsProtocol, "LogoutResponse") {
+		return "", fmt.Errorf("%w: not a LogoutResponse", ErrInvalidMessage)
+	}
+	if err := sp.checkMessage(root, sp.SLOURL); err != nil {
+		return "", err
+	}
+	return relayState, checkStatus(root)
+}
+
+// parseRedirect verifies and decodes the param message of an HTTP-Redirect
+// binding query. The signature covers the query parameters exactly as they
+// were encoded, so they are taken from the raw query.
+func (sp *ServiceProvider) parseRedirect(rawQuery, param string) (*element, string, error) {
+	raw := make(map[string]string)
+	for _, pair := range strings.Split(rawQuery, "&") {
+		k, v, _ := strings.Cut(pair, "=")
+		if _, dup := raw[k]; dup {
+			return nil, "", fmt.Errorf("%w: repeated parameter %q", ErrInvalidMessage, k)
+		}
+		raw[k] = v
+	}
+	if raw[param] == "" {
+		return nil, "", fmt.Errorf("%w: missing %s", ErrInvalidMessage, param)
+	}
+	if raw["Signature"] == "" {
+		return nil, "", ErrNotSigned
+	}
+
+	signed := param + "=" + raw[param]
+	if v, ok := raw["RelayState"]; ok {
+		signed += "&RelayState=" + v
+	}
+	signed += "&SigAlg=" + raw["SigAlg"]
+	sigAlg, err := url.QueryUnescape(raw["SigAlg"])
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: malformed SigAlg", ErrInvalidSignature)
+	}
+	h, ok := signatureHash(sigAlg)
+	if !ok {
+		return nil, "", fmt.Errorf("%w: unsupported signature algorithm %q", ErrInvalidSignature, sigAlg)
+	}
+	encodedSig, err := url.QueryUnescape(raw["Signature"])
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: malformed signature", ErrInvalidSignature)
+	}
+	signature, err := decodeBase64(encodedSig)
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: malformed signature", ErrInvalidSignature)
+	}
+	if !verifyRSA(sp.IdP.Certificates, h, sum(h, []byte(signed)), signature) {
+		return nil, "", ErrInvalidSignature
+	}
+
+	relayState, err := url.QueryUnescape(raw["RelayState"])
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: malformed RelayState", ErrInvalidMessage)
+	}
+	encoded, err := url.QueryUnescape(raw[param])
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: malformed %s", ErrInvalidMessage, param)
+	}
+	msg, err := DecodeRedirect(encoded)
+	if err != nil {
+		return nil, "", err
+	}
+	root, err := parseXML(msg)
+	return root, relayState, err
+}
+
+// EncodeRedirect returns endpoint with msg deflated into the param query
+// parameter of the HTTP-Redirect binding, signed with RSA-SHA256 when key is
+// set.
+func EncodeRedirect(endpoint, param string, msg []byte, relayState string, key *rsa.PrivateKey) (string, error) {
+	var buf bytes.Buffer
+	w, err := flate.NewWriter(&buf, flate.BestCompression)
+	if err != nil {
+		return "", err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return "", err
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+
+	query := param + "=" + url.QueryEscape(base64.StdEncoding.EncodeToString(buf.Bytes()))
+	if relayState != "" {
+		query += "&RelayState=" + url.QueryEscape(relayState)
+	}
+	if key != nil {
+		query += "&SigAlg=" + url.QueryEscape(algRSASHA256)
+		digest := sha256.Sum256([]byte(query))
+		signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+		if err != nil {
+			return "", err
+		}
+		query += "&Signature=" + url.QueryEscape(base64.StdEncoding.EncodeToString(signature))
+	}
+	if strings.Contains(endpoint, "?") {
+		return endpoint + "&" + query, nil
+	}
+	return endpoint + "?" + query, nil
+}
+
+// DecodeRedirect reverses the encoding of an HTTP-Redirect binding message,
+// given its already URL-decoded parameter value.
+func DecodeRedirect(encoded string) ([]byte, error) {
+	compressed, err := decodeBase64(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("%w: not base64", ErrInvalidMessage)
+	}
+	msg, err := io.ReadAll(io.LimitReader(flate.NewReader(bytes.NewReader(compressed)), maxMessageSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("%w: not deflated", ErrInvalidMessage)
+	}
+	if len(msg) > maxMessageSize {
+		return nil, fmt.Errorf("%w: too large", ErrInvalidMessage)
+	}
+	return msg, nil
+}
+
+// Metadata returns the service provider's SAML metadata.
+func (sp *ServiceProvider) Metadata() []byte {
+	var sb strings.Builder
+	sb.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+	sb.WriteString(`<md:EntityDescriptor xmlns:md="` + nsMetadata + `" entityID="` + escapeAttr(sp.EntityID) + `">`)
+	sb.WriteString(`<md:SPSSODescriptor AuthnRequestsSigned="` + fmt.Sprint(sp.Key != nil) + `" WantAssertionsSigned="true" protocolSupportEnumeration="` + nsProtocol + `">`)
+	if sp.Certificate != nil {
+		sb.WriteString(`<md:KeyDescriptor use="signing"><ds:KeyInfo xmlns:ds="` + nsDSig + `"><ds:X509Data><ds:X509Certificate>`)
+		sb.WriteString(base64.StdEncoding.EncodeToString(sp.Certificate.Raw))
+		sb.WriteString(`</ds:X509Certificate></ds:X509Data></ds:KeyInfo></md:KeyDescriptor>`)
+	}
+	if sp.SLOURL != "" {
+		sb.WriteString(`<md:SingleLogoutService Binding="` + BindingRedirect + `" Location="` + escapeAttr(sp.SLOURL) + `"></md:SingleLogoutService>`)
+	}
+	sb.WriteString(`<md:NameIDFormat>` + NameIDFormatPersistent + `</md:NameIDFormat>`)
+	sb.WriteString(`<md:NameIDFormat>` + NameIDFormatEmail + `</md:NameIDFormat>`)
+	sb.WriteString(`<md:AssertionConsumerService Binding="` + BindingPOST + `" Location="` + escapeAttr(sp.ACSURL) + `" index="0" isDefault="true"></md:AssertionConsumerService>`)
+	sb.WriteString(`</md:SPSSODescriptor></md:EntityDescriptor>`)
+	return []byte(sb.String())
+}
+
+// ParseIdPMetadata reads an identity provider's entity ID, HTTP-Redirect
+// endpoints and signing certificates from its metadata. The metadata's own
+// signature, if any, is not checked; it must come from a trusted source.
+func ParseIdPMetadata(data []byte) (*IdentityProvider, error) {
+	root, err := parseXML(data)
+	if err != nil {
+		return nil, err
+	}
+	entity := root
+	if root.is(nsMetadata, "EntitiesDescriptor") {
+		entities := root.childrenNamed(nsMetadata, "EntityDescriptor")
+		if len(entities) != 1 {
+			return nil, errors.New("saml: metadata must describe exactly one entity")
+		}
+		entity = entities[0]
+	}
+	if !entity.is(nsMetadata, "EntityDescriptor") {
+		return nil, errors.New("saml: not SAML metadata")
+	}
+	descriptor := entity.child(nsMetadata, "IDPSSODescriptor")
+	if descriptor == nil {
+		return nil, errors.New("saml: metadata describes no identity provider")
+	}
+
+	idp := &IdentityProvider{EntityID: entity.attr("entityID")}
+	for _, s := range descriptor.childrenNamed(nsMetadata, "SingleSignOnService") {
+		if s.attr("Binding") == BindingRedirect && idp.SSOURL == "" {
+			idp.SSOURL = s.attr("Location")
+		}
+	}
+	for _, s := range descriptor.childrenNamed(nsMetadata, "SingleLogoutService") {
+		if s.attr("Binding") == BindingRedirect && idp.SLOURL == "" {
+			idp.SLOURL = s.attr("Location")
+		}
+	}
+	for _, kd := range descriptor.childrenNamed(nsMetadata, "KeyDescriptor") {
+		if use := kd.attr("use"); use != "" && use != "signing" {
+			continue
+		}
+		keyInfo := kd.child(nsDSig, "KeyInfo")
+		if keyInfo == nil {
+			continue
+		}
+		for _, data := range keyInfo.childrenNamed(nsDSig, "X509Data") {
+			for _, c := range data.childrenNamed(nsDSig, "X509Certificate") {
+				der, err := decodeBase64(c.text())
+				if err != nil {
+					return nil, fmt.Errorf("saml: malformed certificate: %w", err)
+				}
+				cert, err := x509.ParseCertificate(der)
+				if err != nil {
+					return nil, fmt.Errorf("saml: malformed certificate: %w", err)
+				}
+				idp.Certificates = append(idp.Certificates, cert)
+			}
+		}
+	}
+	if idp.EntityID == "" || idp.SSOURL == "" || len(idp.Certificates) == 0 {
+		return nil, errors.New("saml: metadata needs an entityID, an HTTP-Redirect SingleSignOnService and a signing certificate")
+	}
+	return idp, nil
+}
+
+// ParseCertificates parses the PEM certificates in data.
+func ParseCertificates(data string) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	rest := []byte(data)
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("saml: malformed certificate: %w", err)
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, errors.New("saml: no PEM certificate found")
+	}
+	return certs, nil
+}
+
+// EncodeCertificates returns certs as PEM.
+func EncodeCertificates(certs []*x509.Certificate) string {
+	var buf bytes.Buffer
+	for _, cert := range certs {
+		_ = pem.Encode(&buf, &pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+	}
+	return buf.String()
+}
+
+// NewCertificate returns a self-signed certificate for key, as SAML only
+// uses certificates to carry keys.
+func NewCertificate(key *rsa.PrivateKey, commonName string, validFor time.Duration) (*x509.Certificate, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(validFor),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+	return x509.ParseCertificate(der)
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05Z")
+}
+
+func parseTime(s string) (time.Time, error) {
+	return time.Parse(time.RFC3339Nano, s)
+}
@@ -0,0 +1,242 @@
+package saml_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Prashant2307200/auth-service/pkg/saml"
+	"github.com/Prashant2307200/auth-service/pkg/saml/samltest"
+)
+
+func newPair(t *testing.T) (*saml.ServiceProvider, *samltest.IdP) {
+	t.Helper()
+	idp, err := samltest.New("https://idp.example.com")
+	if err != nil {
+		t.Fatalf("idp: %v", err)
+	}
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("key: %v", err)
+	}
+	cert, err := saml.NewCertificate(key, "sp", time.Hour)
+	if err != nil {
+		t.Fatalf("certificate: %v", err)
+	}
+	sp := &saml.ServiceProvider{
+		EntityID:    "https://sp.example.com/saml/1/metadata",
+		ACSURL:      "https://sp.example.com/saml/1/acs",
+		SLOURL:      "https://sp.example.com/saml/1/slo",
+		Key:         key,
+		Certificate: cert,
+		IdP: saml.IdentityProvider{
+			EntityID:     idp.EntityID,
+			SSOURL:       idp.SSOURL,
+			SLOURL:       idp.SLOURL,
+			Certificates: []*x509.Certificate{idp.Certificate},
+		},
+	}
+	return sp, idp
+}
+
+func responseFor(sp *saml.ServiceProvider, opts samltest.ResponseOptions) samltest.ResponseOptions {
+	opts.ACSURL = sp.ACSURL
+	if opts.Audience == "" {
+		opts.Audience = sp.EntityID
+	}
+	if opts.InResponseTo == "" {
+		opts.InResponseTo = "id-request"
+	}
+	if opts.NameID == "" {
+		opts.NameID = "u-123"
+	}
+	return opts
+}
+
+func TestAuthnRequestURL(t *testing.T) {
+	sp, idp := newPair(t)
+	u, err := sp.AuthnRequestURL("id-abc", "relay", time.Now())
+	if err != nil {
+		t.Fatalf("AuthnRequestURL failed: %v", err)
+	}
+	if !strings.HasPrefix(u, idp.SSOURL+"?SAMLRequest=") {
+		t.Fatalf("unexpected URL %s", u)
+	}
+	req, err := samltest.ParseAuthnRequestURL(u)
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	if req.ID != "id-abc" || req.Issuer != sp.EntityID || req.ACSURL != sp.ACSURL || req.RelayState != "relay" || !req.Signed {
+		t.Errorf("unexpected request %+v", req)
+	}
+}
+
+func TestParseResponse(t *testing.T) {
+	tests := []struct {
+		name string
+		opts samltest.ResponseOptions
+	}{
+		{"response signed", samltest.ResponseOptions{SignResponse: true}},
+		{"assertion signed", samltest.ResponseOptions{SignAssertion: true}},
+		{"both signed", samltest.ResponseOptions{SignResponse: true, SignAssertion: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sp, idp := newPair(t)
+			opts := tt.opts
+			opts.SessionIndex = "s-1"
+			opts.Attributes = map[string][]string{"email": {"ada@example.com"}, "groups": {"a", "b"}}
+			encoded, err := idp.Response(responseFor(sp, opts))
+			if err != nil {
+				t.Fatalf("response: %v", err)
+			}
+			a, err := sp.ParseResponse(encoded, time.Now())
+			if err != nil {
+				t.Fatalf("ParseResponse failed: %v", err)
+			}
+			if a.NameID != "u-123" || a.InResponseTo != "id-request" || a.SessionIndex != "s-1" {
+				t.Errorf("unexpected assertion %+v", a)
+			}
+			if a.Attribute("email") != "ada@example.com" || len(a.Attributes["groups"]) != 2 {
+				t.Errorf("unexpected attributes %v", a.Attributes)
+			}
+		})
+	}
+}
+
+func TestParseResponse_Rejects(t *testing.T) {
+	sp, idp := newPair(t)
+	other, _ := samltest.New("https://idp.example.com")
+
+	sign := func(opts samltest.ResponseOptions) string {
+		t.Helper()
+		opts.SignResponse = true
+		encoded, err := idp.Response(responseFor(sp, opts))
+		if err != nil {
+			t.Fatalf("response: %v", err)
+		}
+		return encoded
+	}
+	tamper := func(encoded, old, new string) string {
+		data, _ := base64.StdEncoding.DecodeString(encoded)
+		if !strings.Contains(string(data), old) {
+			t.Fatalf("%q not in response", old)
+		}
+		return base64.StdEncoding.EncodeToString([]byte(strings.Replace(string(data), old, new, 1)))
+	}
+	unsigned, _ := idp.Response(responseFor(sp, samltest.ResponseOptions{}))
+	forged, _ := other.Response(responseFor(sp, samltest.ResponseOptions{SignResponse: true}))
+
+	tests := []struct {
+		name    string
+		encoded string
+		wantErr error
+	}{
+		{"unsigned", unsigned, saml.ErrNotSigned},
+		{"signed by another key", forged, saml.ErrInvalidSignature},
+		{"tampered NameID", tamper(sign(samltest.ResponseOptions{}), ">u-123<", ">admin<"), saml.ErrInvalidSignature},
+		{"wrong audience", sign(samltest.ResponseOptions{Audience: "x"}), saml.ErrInvalidMessage},
+		{"wrong issuer", sign(samltest.ResponseOptions{Issuer: "https://evil.example.com"}), saml.ErrInvalidMessage},
+		{"expired", sign(samltest.ResponseOptions{Now: time.Now().Add(-time.Hour)}), saml.ErrInvalidMessage},
+		{"not yet valid", sign(samltest.ResponseOptions{Now: time.Now().Add(time.Hour)}), saml.ErrInvalidMessage},
+		{"error status", sign(samltest.ResponseOptions{Status: "urn:oasis:names:tc:SAML:2.0:status:Responder"}), saml.ErrStatus},
+		{"not base64", "%%%", saml.ErrInvalidMessage},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := sp.ParseResponse(tt.encoded, time.Now()); !errors.Is(err, tt.wantErr) {
+				t.Errorf("got %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// A second, unsigned assertion next to a signed one must not be read.
+func TestParseResponse_RejectsWrappedAssertion(t *testing.T) {
+	sp, idp := newPair(t)
+	encoded, _ := idp.Response(responseFor(sp, samltest.ResponseOptions{SignAssertion: true}))
+	data, _ := base64.StdEncoding.DecodeString(encoded)
+	doc := string(data)
+	start := strings.Index(doc, "<saml:Assertion")
+	end := strings.Index(doc, "</saml:Assertion>") + len("</saml:Assertion>")
+	evil := strings.Replace(doc[start:end], ">u-123<", ">admin<", 1)
+	wrapped := doc[:start] + evil + doc[start:]
+
+	if _, err := sp.ParseResponse(base64.StdEncoding.EncodeToString([]byte(wrapped)), time.Now()); !errors.Is(err, saml.ErrInvalidMessage) {
+		t.Errorf("got %v, want ErrInvalidMessage", err)
+	}
+}
+
+func TestLogout(t *testing.T) {
+	sp, idp := newPair(t)
+
+	query, err := idp.LogoutRequestQuery(sp.SLOURL, "u-123", "relay")
+	if err != nil {
+		t.Fatalf("logout request: %v", err)
+	}
+	req, err := sp.ParseLogoutRequest(query, time.Now())
+	if err != nil {
+		t.Fatalf("ParseLogoutRequest failed: %v", err)
+	}
+	if req.NameID != "u-123" || req.RelayState != "relay" {
+		t.Errorf("unexpected request %+v", req)
+	}
+	if _, err := sp.ParseLogoutRequest(strings.Replace(query, "Signature=", "Signature=AA", 1), time.Now()); !errors.Is(err, saml.ErrInvalidSignature) {
+		t.Errorf("tampered signature: got %v", err)
+	}
+	unsigned, _, _ := strings.Cut(query, "&SigAlg=")
+	if _, err := sp.ParseLogoutRequest(unsigned, time.Now()); !errors.Is(err, saml.ErrNotSigned) {
+		t.Errorf("unsigned: got %v", err)
+	}
+
+	u, err := sp.LogoutResponseURL(req, time.Now())
+	if err != nil {
+		t.Fatalf("LogoutResponseURL failed: %v", err)
+	}
+	parsed, _ := url.Parse(u)
+	msg, err := saml.DecodeRedirect(parsed.Query().Get("SAMLResponse"))
+	if err != nil || !strings.Contains(string(msg), `InResponseTo="`+req.ID+`"`) || parsed.Query().Get("Signature") == "" {
+		t.Errorf("unexpected logout response %s (%v)", msg, err)
+	}
+
+	query, _ = idp.LogoutResponseQuery(sp.SLOURL, "id-logout", "")
+	if _, err := sp.ParseLogoutResponse(query); err != nil {
+		t.Errorf("ParseLogoutResponse failed: %v", err)
+	}
+}
+
+func TestMetadata(t *testing.T) {
+	sp, idp := newPair(t)
+
+	parsed, err := saml.ParseIdPMetadata(idp.Metadata())
+	if err != nil {
+		t.Fatalf("ParseIdPMetadata failed: %v", err)
+	}
+	if parsed.EntityID != idp.EntityID || parsed.SSOURL != idp.SSOURL || parsed.SLOURL != idp.SLOURL {
+		t.Errorf("unexpected identity provider %+v", parsed)
+	}
+	if len(parsed.Certificates) != 1 || !parsed.Certificates[0].Equal(idp.Certificate) {
+		t.Error("signing certificate not read")
+	}
+
+	md := string(sp.Metadata())
+	for _, want := range []string{`entityID="` + sp.EntityID + `"`, `Location="` + sp.ACSURL + `"`, `Location="` + sp.SLOURL + `"`, `AuthnRequestsSigned="true"`} {
+		if !strings.Contains(md, want) {
+			t.Errorf("metadata lacks %s", want)
+		}
+	}
+	if _, err := saml.ParseIdPMetadata(sp.Metadata()); err == nil {
+		t.Error("service provider metadata accepted as an identity provider's")
+	}
+
+	certs, err := saml.ParseCertificates(idp.CertificatePEM())
+	if err != nil || len(certs) != 1 {
+		t.Errorf("ParseCertificates: %v", err)
+	}
+}
@@ -0,0 +1,245 @@
+// Package samltest provides an in-memory SAML identity provider with its
+// own key pair, for exercising a service provider in tests.
+package samltest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"html"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Prashant2307200/auth-service/pkg/saml"
+)
+
+const (
+	nsAssertion = "urn:oasis:names:tc:SAML:2.0:assertion"
+	nsProtocol  = "urn:oasis:names:tc:SAML:2.0:protocol"
+)
+
+// IdP signs Responses and logout messages with a freshly generated key.
+type IdP struct {
+	EntityID    string
+	SSOURL      string
+	SLOURL      string
+	Key         *rsa.PrivateKey
+	Certificate *x509.Certificate
+}
+
+// New returns an identity provider whose endpoints live under baseURL.
+func New(baseURL string) (*IdP, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := saml.NewCertificate(key, "samltest", 24*time.Hour)
+	if err != nil {
+		return nil, err
+	}
+	return &IdP{
+		EntityID:    baseURL + "/metadata",
+		SSOURL:      baseURL + "/sso",
+		SLOURL:      baseURL + "/slo",
+		Key:         key,
+		Certificate: cert,
+	}, nil
+}
+
+// CertificatePEM returns the signing certificate as PEM.
+func (idp *IdP) CertificatePEM() string {
+	return saml.EncodeCertificates([]*x509.Certificate{idp.Certificate})
+}
+
+// Metadata returns the identity provider's SAML metadata.
+func (idp *IdP) Metadata() []byte {
+	return []byte(`<md:EntityDescriptor xmlns:md="urn:oasis:names:tc:SAML:2.0:metadata" entityID="` + html.EscapeString(idp.EntityID) + `">` +
+		`<md:IDPSSODescriptor protocolSupportEnumeration="` + nsProtocol + `">` +
+		`<md:KeyDescriptor use="signing"><ds:KeyInfo xmlns:ds="http://www.w3.org/2000/09/xmldsig#"><ds:X509Data><ds:X509Certificate>` +
+		base64.StdEncoding.EncodeToString(idp.Certificate.Raw) +
+		`</ds:X509Certificate></ds:X509Data></ds:KeyInfo></md:KeyDescriptor>` +
+		`<md:SingleLogoutService Binding="` + saml.BindingRedirect + `" Location="` + html.EscapeString(idp.SLOURL) + `"/>` +
+		`<md:SingleSignOnService Binding="` + saml.BindingPOST + `" Location="` + html.EscapeString(idp.SSOURL) + `/post"/>` +
+		`<md:SingleSignOnService Binding="` + saml.BindingRedirect + `" Location="` + html.EscapeString(idp.SSOURL) + `"/>` +
+		`</md:IDPSSODescriptor></md:EntityDescriptor>`)
+}
+
+// AuthnRequest is what the identity provider read from an AuthnRequest URL.
+type AuthnRequest struct {
+	ID         string
+	Issuer     string
+	ACSURL     string
+	RelayState string
+	Signed     bool
+}
+
+// ParseAuthnRequestURL decodes the AuthnRequest a service provider
+// redirected to. It does not verify the signature, only that there is one.
+func ParseAuthnRequestURL(rawURL string) (*AuthnRequest, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	q := u.Query()
+	msg, err := saml.DecodeRedirect(q.Get("SAMLRequest"))
+	if err != nil {
+		return nil, err
+	}
+	s := string(msg)
+	return &AuthnRequest{
+		ID:         attrValue(s, "ID"),
+		Issuer:     elementText(s, "saml:Issuer"),
+		ACSURL:     attrValue(s, "AssertionConsumerServiceURL"),
+		RelayState: q.Get("RelayState"),
+		Signed:     q.Get("Signature") != "",
+	}, nil
+}
+
+// ResponseOptions describes the Response to issue.
+type ResponseOptions struct {
+	// Audience and ACSURL identify the service provider.
+	Audience     string
+	ACSURL       string
+	InResponseTo string
+	NameID       string
+	SessionIndex string
+	Attributes   map[string][]string
+	// SignResponse and SignAssertion choose what is signed; with neither
+	// the Response is unsigned.
+	SignResponse  bool
+	SignAssertion bool
+	// Issuer overrides the identity provider's entity ID.
+	Issuer string
+	// Status overrides the Success status code.
+	Status string
+	// Now overrides the issue instant.
+	Now time.Time
+}
+
+// Response returns a base64 Response as posted to the assertion consumer
+// service.
+func (idp *IdP) Response(opts ResponseOptions) (string, error) {
+	now := opts.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+	issuer := opts.Issuer
+	if issuer == "" {
+		issuer = idp.EntityID
+	}
+	status := opts.Status
+	if status == "" {
+		status = saml.StatusSuccess
+	}
+	responseID, err := saml.NewID()
+	if err != nil {
+		return "", err
+	}
+	assertionID, err := saml.NewID()
+	if err != nil {
+		return "", err
+	}
+
+	var attrs strings.Builder
+	for name, values := range opts.Attributes {
+		attrs.WriteString(`<saml:Attribute Name="` + html.EscapeString(name) + `">`)
+		for _, v := range values {
+			attrs.WriteString(`<saml:AttributeValue xsi:type="xs:string">` + html.EscapeString(v) + `</saml:AttributeValue>`)
+		}
+		attrs.WriteString(`</saml:Attribute>`)
+	}
+	doc := `<samlp:Response xmlns:samlp="` + nsProtocol + `" xmlns:saml="` + nsAssertion + `"` +
+		` ID="` + responseID + `" Version="2.0" IssueInstant="` + formatTime(now) + `"` +
+		` Destination="` + html.EscapeString(opts.ACSURL) + `" InResponseTo="` + html.EscapeString(opts.InResponseTo) + `">` +
+		`<saml:Issuer>` + html.EscapeString(issuer) + `</saml:Issuer>` +
+		`<samlp:Status><samlp:StatusCode Value="` + html.EscapeString(status) + `"/></samlp:Status>` +
+		`<saml:Assertion xmlns:xs="http://www.w3.org/2001/XMLSchema" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance"` +
+		` ID="` + assertionID + `" Version="2.0" IssueInstant="` + formatTime(now) + `">` +
+		`<saml:Issuer>` + html.EscapeString(issuer) + `</saml:Issuer>` +
+		`<saml:Subject><saml:NameID Format="` + saml.NameIDFormatPersistent + `">` + html.EscapeString(opts.NameID) + `</saml:NameID>` +
+		`<saml:SubjectConfirmation Method="urn:oasis:names:tc:SAML:2.0:cm:bearer">` +
+		`<saml:SubjectConfirmationData InResponseTo="` + html.EscapeString(opts.InResponseTo) + `" NotOnOrAfter="` + formatTime(now.Add(5*time.Minute)) + `" Recipient="` + html.EscapeString(opts.ACSURL) + `"/>` +
+		`</saml:SubjectConfirmation></saml:Subject>` +
+		`<saml:Conditions NotBefore="` + formatTime(now.Add(-time.Minute)) + `" NotOnOrAfter="` + formatTime(now.Add(5*time.Minute)) + `">` +
+		`<saml:AudienceRestriction><saml:Audience>` + html.EscapeString(opts.Audience) + `</saml:Audience></saml:AudienceRestriction>` +
+		`</saml:Conditions>` +
+		`<saml:AuthnStatement AuthnInstant="` + formatTime(now) + `" SessionIndex="` + html.EscapeString(opts.SessionIndex) + `">` +
+		`<saml:AuthnContext><saml:AuthnContextClassRef>urn:oasis:names:tc:SAML:2.0:ac:classes:PasswordProtectedTransport</saml:AuthnContextClassRef></saml:AuthnContext>` +
+		`</saml:AuthnStatement>` +
+		`<saml:AttributeStatement>` + attrs.String() + `</saml:AttributeStatement>` +
+		`</saml:Assertion></samlp:Response>`
+
+	out := []byte(doc)
+	if opts.SignAssertion {
+		if out, err = saml.Sign(out, assertionID, idp.Key, idp.Certificate); err != nil {
+			return "", err
+		}
+	}
+	if opts.SignResponse {
+		if out, err = saml.Sign(out, responseID, idp.Key, idp.Certificate); err != nil {
+			return "", err
+		}
+	}
+	return base64.StdEncoding.EncodeToString(out), nil
+}
+
+// LogoutRequestQuery returns the signed query of a LogoutRequest for nameID
+// sent to the service provider's single logout URL.
+func (idp *IdP) LogoutRequestQuery(sloURL, nameID, relayState string) (string, error) {
+	id, err := saml.NewID()
+	if err != nil {
+		return "", err
+	}
+	msg := `<samlp:LogoutRequest xmlns:samlp="` + nsProtocol + `" xmlns:saml="` + nsAssertion + `"` +
+		` ID="` + id + `" Version="2.0" IssueInstant="` + formatTime(time.Now()) + `" Destination="` + html.EscapeString(sloURL) + `">` +
+		`<saml:Issuer>` + html.EscapeString(idp.EntityID) + `</saml:Issuer>` +
+		`<saml:NameID>` + html.EscapeString(nameID) + `</saml:NameID></samlp:LogoutRequest>`
+	return idp.query(sloURL, "SAMLRequest", msg, relayState)
+}
+
+// LogoutResponseQuery returns the signed query of a successful
+// LogoutResponse sent to the service provider's single logout URL.
+func (idp *IdP) LogoutResponseQuery(sloURL, inResponseTo, relayState string) (string, error) {
+	id, err := saml.NewID()
+	if err != nil {
+		return "", err
+	}
+	msg := `<samlp:LogoutResponse xmlns:samlp="` + nsProtocol + `" xmlns:saml="` + nsAssertion + `"` +
+		` ID="` + id + `" InResponseTo="` + html.EscapeString(inResponseTo) + `" Version="2.0" IssueInstant="` + formatTime(time.Now()) + `" Destination="` + html.EscapeString(sloURL) + `">` +
+		`<saml:Issuer>` + html.EscapeString(idp.EntityID) + `</saml:Issuer>` +
+		`<samlp:Status><samlp:StatusCode Value="` + saml.StatusSuccess + `"/></samlp:Status></samlp:LogoutResponse>`
+	return idp.query(sloURL, "SAMLResponse", msg, relayState)
+}
+
+func (idp *IdP) query(endpoint, param, msg, relayState string) (string, error) {
+	u, err := saml.EncodeRedirect(endpoint, param, []byte(msg), relayState, idp.Key)
+	if err != nil {
+		return "", err
+	}
+	_, query, _ := strings.Cut(u, "?")
+	return query, nil
+}
+
+func attrValue(doc, name string) string {
+	_, rest, ok := strings.Cut(doc, " "+name+`="`)
+	if !ok {
+		return ""
+	}
+	v, _, _ := strings.Cut(rest, `"`)
+	return html.UnescapeString(v)
+}
+
+func elementText(doc, name string) string {
+	_, rest, ok := strings.Cut(doc, "<"+name+">")
+	if !ok {
+		return ""
+	}
+	v, _, _ := strings.Cut(rest, "</"+name+">")
+	return html.UnescapeString(v)
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05Z")
+}
@@ -0,0 +1,332 @@
+package saml
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+)
+
+const xmlNamespace = "http://www.w3.org/XML/1998/namespace"
+
+// element is a parsed XML element that keeps namespace prefixes and
+// declarations as written, which canonicalization needs and encoding/xml's
+// Unmarshal throws away.
+type element struct {
+	prefix   string
+	name     string
+	attrs    []attr
+	children []any // *element or string
+	parent   *element
+}
+
+type attr struct {
+	prefix string
+	name   string
+	value  string
+}
+
+// parseXML parses a document into a tree. DTDs are refused outright, which
+// also rules out entity expansion attacks; comments and processing
+// instructions are dropped. So are documents in which two elements share
+// an ID, which a signature reference could then point at either of.
+func parseXML(data []byte) (*element, error) {
+	d := xml.NewDecoder(bytes.NewReader(data))
+	var root, cur *element
+	for {
+		tok, err := d.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("saml: invalid XML: %w", err)
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			e := &element{prefix: t.Name.Space, name: t.Name.Local, parent: cur}
+			for _, a := range t.Attr {
+				e.attrs = append(e.attrs, attr{prefix: a.Name.Space, name: a.Name.Local, value: a.Value})
+			}
+			if cur == nil {
+				if root != nil {
+					return nil, errors.New("saml: invalid XML: more than one root element")
+				}
+				root = e
+			} else {
+				cur.children = append(cur.children, e)
+			}
+			cur = e
+		case xml.EndElement:
+			if cur == nil || t.Name.Space != cur.prefix || t.Name.Local != cur.name {
+				return nil, errors.New("saml: invalid XML: mismatched end element")
+			}
+			cur = cur.parent
+		case xml.CharData:
+			if cur != nil {
+				cur.children = append(cur.children, string(t))
+			} else if len(bytes.TrimSpace(t)) > 0 {
+				return nil, errors.New("saml: invalid XML: text outside the root element")
+			}
+		case xml.Directive:
+			return nil, errors.New("saml: invalid XML: DTDs are not allowed")
+		}
+	}
+	if root == nil || cur != nil {
+		return nil, errors.New("saml: invalid XML: incomplete document")
+	}
+	if err := root.checkNamespaces(); err != nil {
+		return nil, err
+	}
+	if err := root.checkIDs(map[string]bool{}); err != nil {
+		return nil, err
+	}
+	return root, nil
+}
+
+// checkIDs makes sure no two elements in e's subtree have the same ID.
+func (e *element) checkIDs(seen map[string]bool) error {
+	if id := e.attr("ID"); id != "" {
+		if seen[id] {
+			return fmt.Errorf("%w: duplicate ID %q", ErrInvalidMessage, id)
+		}
+		seen[id] = true
+	}
+	for _, c := range e.children {
+		if child, ok := c.(*element); ok {
+			if err := child.checkIDs(seen); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// checkNamespaces makes sure every prefix in use is declared.
+func (e *element) checkNamespaces() error {
+	if _, ok := e.namespace(e.prefix); !ok {
+		return fmt.Errorf("saml: invalid XML: undeclared prefix %q", e.prefix)
+	}
+	for _, a := range e.attrs {
+		if a.prefix == "" || a.prefix == "xmlns" {
+			continue
+		}
+		if _, ok := e.namespace(a.prefix); !ok {
+			return fmt.Errorf("saml: invalid XML: undeclared prefix %q", a.prefix)
+		}
+	}
+	for _, c := range e.children {
+		if child, ok := c.(*element); ok {
+			if err := child.checkNamespaces(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// namespace resolves prefix in e's scope; "" is the default namespace,
+// which is always bound, if only to no namespace.
+func (e *element) namespace(prefix string) (string, bool) {
+	if prefix == "xml" {
+		return xmlNamespace, true
+	}
+	for el := e; el != nil; el = el.parent {
+		for _, a := range el.attrs {
+			if (prefix == "" && a.prefix == "" && a.name == "xmlns") || (prefix != "" && a.prefix == "xmlns" && a.name == prefix) {
+				return a.value, true
+			}
+		}
+	}
+	return "", prefix == ""
+}
+
+func (e *element) is(space, name string) bool {
+	uri, _ := e.namespace(e.prefix)
+	return e.name == name && uri == space
+}
+
+func (e *element) child(space, name string) *element {
+	for _, c := range e.children {
+		if child, ok := c.(*element); ok && child.is(space, name) {
+			return child
+		}
+	}
+	return nil
+}
+
+func (e *element) childrenNamed(space, name string) []*element {
+	var out []*element
+	for _, c := range e.children {
+		if child, ok := c.(*element); ok && child.is(space, name) {
+			out = append(out, child)
+		}
+	}
+	return out
+}
+
+// attr returns the value of the unqualified attribute name.
+func (e *element) attr(name string) string {
+	for _, a := range e.attrs {
+		if a.prefix == "" && a.name == name {
+			return a.value
+		}
+	}
+	return ""
+}
+
+// text returns e's own character data with surrounding space trimmed.
+func (e *element) text() string {
+	var sb strings.Builder
+	for _, c := range e.children {
+		if s, ok := c.(string); ok {
+			sb.WriteString(s)
+		}
+	}
+	return strings.TrimSpace(sb.String())
+}
+
+// findByID returns the element in e's subtree whose ID attribute is id.
+func (e *element) findByID(id string) *element {
+	if e.attr("ID") == id {
+		return e
+	}
+	for _, c := range e.children {
+		if child, ok := c.(*element); ok {
+			if found := child.findByID(id); found != nil {
+				return found
+			}
+		}
+	}
+	return nil
+}
+
+// canonicalize serializes e with Exclusive XML Canonicalization 1.0,
+// omitting comments and the exclude subtree (an enveloped signature).
+// inclusive lists prefixes, "#default" for the default namespace, to render
+// as in inclusive canonicalization.
+func canonicalize(e *element, exclude *element, inclusive []string) []byte {
+	c := &canonicalizer{exclude: exclude}
+	for _, p := range inclusive {
+		if p == "#default" {
+			p = ""
+		}
+		c.inclusive = append(c.inclusive, p)
+	}
+	c.element(e, map[string]string{})
+	return c.buf.Bytes()
+}
+
+type canonicalizer struct {
+	buf       bytes.Buffer
+	exclude   *element
+	inclusive []string
+}
+
+func (c *canonicalizer) element(e *element, rendered map[string]string) {
+	// Exclusive canonicalization renders only the namespaces the element
+	// and its attributes use, and only where an output ancestor has not
+	// already rendered the same binding.
+	used := []string{e.prefix}
+	for _, a := range e.attrs {
+		if a.prefix != "" && a.prefix != "xmlns" {
+			used = append(used, a.prefix)
+		}
+	}
+	used = append(used, c.inclusive...)
+
+	var decls []attr
+	scope, copied := rendered, false
+	for _, prefix := range used {
+		if prefix == "xml" || slices.ContainsFunc(decls, func(d attr) bool { return d.name == prefix }) {
+			continue
+		}
+		uri, ok := e.namespace(prefix)
+		if !ok {
+			continue
+		}
+		prev, had := scope[prefix]
+		if uri == prev && (had || uri == "") {
+			continue
+		}
+		if !copied {
+			scope, copied = maps.Clone(rendered), true
+		}
+		scope[prefix] = uri
+		decls = append(decls, attr{name: prefix, value: uri})
+	}
+	sort.Slice(decls, func(i, j int) bool { return decls[i].name < decls[j].name })
+
+	type qualified struct {
+		attr
+		space string
+	}
+	var attrs []qualified
+	for _, a := range e.attrs {
+		if a.prefix == "xmlns" || (a.prefix == "" && a.name == "xmlns") {
+			continue
+		}
+		space := ""
+		if a.prefix != "" {
+			space, _ = e.namespace(a.prefix)
+		}
+		attrs = append(attrs, qualified{a, space})
+	}
+	sort.Slice(attrs, func(i, j int) bool {
+		if attrs[i].space != attrs[j].space {
+			return attrs[i].space < attrs[j].space
+		}
+		return attrs[i].name < attrs[j].name
+	})
+
+	c.buf.WriteByte('<')
+	c.writeName(e.prefix, e.name)
+	for _, d := range decls {
+		if d.name == "" {
+			c.buf.WriteString(` xmlns="`)
+		} else {
+			c.buf.WriteString(` xmlns:` + d.name + `="`)
+		}
+		c.buf.WriteString(escapeAttr(d.value))
+		c.buf.WriteByte('"')
+	}
+	for _, a := range attrs {
+		c.buf.WriteByte(' ')
+		c.writeName(a.prefix, a.name)
+		c.buf.WriteString(`="` + escapeAttr(a.value) + `"`)
+	}
+	c.buf.WriteByte('>')
+	for _, child := range e.children {
+		switch child := child.(type) {
+		case string:
+			c.buf.WriteString(escapeText(child))
+		case *element:
+			if child != c.exclude {
+				c.element(child, scope)
+			}
+		}
+	}
+	c.buf.WriteString("</")
+	c.writeName(e.prefix, e.name)
+	c.buf.WriteByte('>')
+}
+
+func (c *canonicalizer) writeName(prefix, name string) {
+	if prefix != "" {
+		c.buf.WriteString(prefix + ":")
+	}
+	c.buf.WriteString(name)
+}
+
+var (
+	attrEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", `"`, "&quot;", "\t", "&#x9;", "\n", "&#xA;", "\r", "&#xD;")
+	textEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "\r", "&#xD;")
+)
+
+func escapeAttr(s string) string { return attrEscaper.Replace(s) }
+
+func escapeText(s string) string { return textEscaper.Replace(s) }
@@ -0,0 +1,86 @@
+package saml
+
+import "testing"
+
+// The expected forms were produced with xmllint --exc-c14n, minus comments.
+const c14nInput = `<?xml version="1.0"?>
+<samlp:Response xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol" xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion" xmlns:xs="http://www.w3.org/2001/XMLSchema" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xmlns="urn:default" ID="r1" Version="2.0">
+  <!-- a comment -->
+  <saml:Issuer>https://idp &amp; co</saml:Issuer>
+  <saml:Assertion ID="a1" b="2" a='1 "q" &lt; &gt;'>
+    <saml:AttributeValue xsi:type="xs:string">x &gt; y
+    </saml:AttributeValue>
+    <plain xmlns=""><inner/></plain>
+    <dflt attr="v" xml:lang="en"><x:y xmlns:x="urn:x" x:b="1" a="2" xmlns:z="urn:unused"/></dflt>
+  </saml:Assertion>
+</samlp:Response>`
+
+func TestCanonicalize(t *testing.T) {
+	root, err := parseXML([]byte(c14nInput))
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+
+	assertion := `<saml:Assertion xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion" ID="a1" a="1 &quot;q&quot; &lt; >" b="2">
+    <saml:AttributeValue xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xsi:type="xs:string">x &gt; y
+    </saml:AttributeValue>
+    <plain><inner></inner></plain>
+    <dflt xmlns="urn:default" attr="v" xml:lang="en"><x:y xmlns:x="urn:x" a="2" x:b="1"></x:y></dflt>
+  </saml:Assertion>`
+	tests := []struct {
+		name      string
+		el        *element
+		inclusive []string
+		want      string
+	}{
+		{
+			name: "document",
+			el:   root,
+			want: `<samlp:Response xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol" ID="r1" Version="2.0">
+  ` + `
+  <saml:Issuer xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion">https://idp &amp; co</saml:Issuer>
+  ` + assertion + `
+</samlp:Response>`,
+		},
+		{name: "subtree", el: root.findByID("a1"), want: assertion},
+		{
+			name:      "inclusive prefixes",
+			el:        root.findByID("a1"),
+			inclusive: []string{"xs", "#default"},
+			want: `<saml:Assertion xmlns="urn:default" xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion" xmlns:xs="http://www.w3.org/2001/XMLSchema" ID="a1" a="1 &quot;q&quot; &lt; >" b="2">
+    <saml:AttributeValue xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xsi:type="xs:string">x &gt; y
+    </saml:AttributeValue>
+    <plain xmlns=""><inner></inner></plain>
+    <dflt attr="v" xml:lang="en"><x:y xmlns:x="urn:x" a="2" x:b="1"></x:y></dflt>
+  </saml:Assertion>`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(canonicalize(tt.el, nil, tt.inclusive)); got != tt.want {
+				t.Errorf("canonical form mismatch\ngot:  %s\nwant: %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseXML_Rejects(t *testing.T) {
+	tests := map[string]string{
+		"doctype":          `<!DOCTYPE r [<!ENTITY x "y">]><r>&x;</r>`,
+		"undeclared":       `<p:r/>`,
+		"two roots":        `<a/><b/>`,
+		"trailing text":    `<a/>text`,
+		"unclosed":         `<a><b></a>`,
+		"undeclared attr":  `<a p:x="1"/>`,
+		"unknown entity":   `<a>&nope;</a>`,
+		"empty":            ``,
+		"mismatched close": `<a></b>`,
+	}
+	for name, doc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := parseXML([]byte(doc)); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
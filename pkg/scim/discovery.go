@@ -0,0 +1,45 @@
+package scim
+
+// ServiceProviderConfig describes the features this package supports
+// (RFC 7643 §5). documentationURI may be empty.
+func ServiceProviderConfig(documentationURI string) map[string]any {
+	return map[string]any{
+		"schemas":          []string{SchemaServiceProviderConfig},
+		"documentationUri": documentationURI,
+		"patch":            map[string]any{"supported": true},
+		"bulk":             map[string]any{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+		"filter":           map[string]any{"supported": true, "maxResults": MaxCount},
+		"changePassword":   map[string]any{"supported": false},
+		"sort":             map[string]any{"supported": false},
+		"etag":             map[string]any{"supported": true},
+		"authenticationSchemes": []map[string]any{{
+			"type":        "oauthbearertoken",
+			"name":        "Bearer token",
+			"description": "A provisioning token sent in the Authorization header",
+			"primary":     true,
+		}},
+	}
+}
+
+// ResourceTypes describes the User and Group resources served under
+// baseURL (RFC 7643 §6).
+func ResourceTypes(baseURL string) []map[string]any {
+	return []map[string]any{
+		{
+			"schemas":  []string{SchemaResourceType},
+			"id":       "User",
+			"name":     "User",
+			"endpoint": "/Users",
+			"schema":   SchemaUser,
+			"meta":     map[string]any{"resourceType": "ResourceType", "location": baseURL + "/ResourceTypes/User"},
+		},
+		{
+			"schemas":  []string{SchemaResourceType},
+			"id":       "Group",
+			"name":     "Group",
+			"endpoint": "/Groups",
+			"schema":   SchemaGroup,
+			"meta":     map[string]any{"resourceType": "ResourceType", "location": baseURL + "/ResourceTypes/Group"},
+		},
+	}
+}
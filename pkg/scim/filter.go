@@ -0,0 +1,490 @@
+package scim
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// maxFilterLength bounds filters, which are parsed recursively.
+const maxFilterLength = 4096
+
+// Filter is a parsed filter expression (RFC 7644 §3.4.2.2). It matches
+// resources in their JSON form.
+type Filter interface {
+	Match(resource map[string]any) bool
+}
+
+// ParseFilter parses a filter. Attribute names and string comparisons are
+// case-insensitive. Attributes may be prefixed with the core schema URN;
+// attributes of other schemas never match.
+func ParseFilter(s string) (Filter, error) {
+	if len(s) > maxFilterLength {
+		return nil, BadRequest(ErrorInvalidFilter, "filter is longer than %d characters", maxFilterLength)
+	}
+	toks, err := tokenize(s)
+	if err != nil {
+		return nil, err
+	}
+	p := &filterParser{toks: toks}
+	f, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t, ok := p.peek(); ok {
+		return nil, BadRequest(ErrorInvalidFilter, "unexpected %q", t.text)
+	}
+	return f, nil
+}
+
+type tokenKind int
+
+const (
+	tokenWord tokenKind = iota
+	tokenString
+	tokenPunct
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+// tokenize splits a filter into words, JSON strings and the punctuation
+// "(", ")", "[" and "]".
+func tokenize(s string) ([]token, error) {
+	var toks []token
+	for i := 0; i < len(s); {
+		switch c := s[i]; {
+		case c == ' ' || c == '\t':
+			i++
+		case c == '(' || c == ')' || c == '[' || c == ']':
+			toks = append(toks, token{tokenPunct, string(c)})
+			i++
+		case c == '"':
+			end := i + 1
+			for ; end < len(s) && s[end] != '"'; end++ {
+				if s[end] == '\\' {
+					end++
+				}
+			}
+			if end >= len(s) {
+				return nil, BadRequest(ErrorInvalidFilter, "unterminated string")
+			}
+			var str string
+			if err := json.Unmarshal([]byte(s[i:end+1]), &str); err != nil {
+				return nil, BadRequest(ErrorInvalidFilter, "invalid string %s", s[i:end+1])
+			}
+			toks = append(toks, token{tokenString, str})
+			i = end + 1
+		default:
+			end := i
+			for end < len(s) && !strings.ContainsRune(" \t()[]\"", rune(s[end])) {
+				end++
+			}
+			toks = append(toks, token{tokenWord, s[i:end]})
+			i = end
+		}
+	}
+	return toks, nil
+}
+
+type filterParser struct {
+	toks []token
+	pos  int
+}
+
+func (p *filterParser) peek() (token, bool) {
+	if p.pos >= len(p.toks) {
+		return token{}, false
+	}
+	return p.toks[p.pos], true
+}
+
+func (p *filterParser) next() (token, bool) {
+	t, ok := p.peek()
+	if ok {
+		p.pos++
+	}
+	return t, ok
+}
+
+func (p *filterParser) peekWord(word string) bool {
+	t, ok := p.peek()
+	return ok && t.kind == tokenWord && strings.EqualFold(t.text, word)
+}
+
+func (p *filterParser) peekPunct(punct string) bool {
+	t, ok := p.peek()
+	return ok && t.kind == tokenPunct && t.text == punct
+}
+
+func (p *filterParser) expect(punct string) error {
+	if !p.peekPunct(punct) {
+		return BadRequest(ErrorInvalidFilter, "expected %q", punct)
+	}
+	p.pos++
+	return nil
+}
+
+func (p *filterParser) parseOr() (Filter, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peekWord("or") {
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orFilter{left, right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseAnd() (Filter, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peekWord("and") {
+		p.pos++
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = andFilter{left, right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseUnary() (Filter, error) {
+	if p.peekWord("not") {
+		p.pos++
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		f, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		return notFilter{f}, p.expect(")")
+	}
+	if p.peekPunct("(") {
+		p.pos++
+		f, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		return f, p.expect(")")
+	}
+
+	t, ok := p.next()
+	if !ok || t.kind != tokenWord {
+		return nil, BadRequest(ErrorInvalidFilter, "expected an attribute")
+	}
+	path, ok := parseAttrPath(t.text)
+	if !ok {
+		return nil, BadRequest(ErrorInvalidFilter, "invalid attribute %q", t.text)
+	}
+	if p.peekPunct("[") {
+		p.pos++
+		f, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if path.sub != "" {
+			return nil, BadRequest(ErrorInvalidFilter, "invalid attribute %q", t.text)
+		}
+		return valueFilter{attr: path.attr, filter: f}, p.expect("]")
+	}
+
+	op, ok := p.next()
+	if !ok || op.kind != tokenWord {
+		return nil, BadRequest(ErrorInvalidFilter, "expected an operator after %q", t.text)
+	}
+	switch strings.ToLower(op.text) {
+	case "pr":
+		return presentFilter{path}, nil
+	case "eq", "ne", "co", "sw", "ew", "gt", "ge", "lt", "le":
+	default:
+		return nil, BadRequest(ErrorInvalidFilter, "unknown operator %q", op.text)
+	}
+	v, ok := p.next()
+	if !ok || v.kind == tokenPunct {
+		return nil, BadRequest(ErrorInvalidFilter, "expected a value after %q", op.text)
+	}
+	value, err := filterValue(v)
+	if err != nil {
+		return nil, err
+	}
+	return compareFilter{path: path, op: strings.ToLower(op.text), value: value}, nil
+}
+
+// filterValue decodes a comparison value: a string, true, false, null or a
+// number.
+func filterValue(t token) (any, error) {
+	if t.kind == tokenString {
+		return t.text, nil
+	}
+	var v any
+	if err := json.Unmarshal([]byte(strings.ToLower(t.text)), &v); err != nil {
+		return nil, BadRequest(ErrorInvalidFilter, "invalid value %q", t.text)
+	}
+	if _, isObject := v.(map[string]any); isObject {
+		return nil, BadRequest(ErrorInvalidFilter, "invalid value %q", t.text)
+	}
+	if _, isArray := v.([]any); isArray {
+		return nil, BadRequest(ErrorInvalidFilter, "invalid value %q", t.text)
+	}
+	return v, nil
+}
+
+// attrPath names an attribute and optionally one of its sub-attributes.
+type attrPath struct {
+	attr, sub string
+}
+
+// parseAttrPath parses "attr" or "attr.sub", optionally prefixed with the
+// core User or Group schema URN.
+func parseAttrPath(s string) (attrPath, bool) {
+	if strings.HasPrefix(strings.ToLower(s), "urn:") {
+		for _, schema := range []string{SchemaUser, SchemaGroup} {
+			if len(s) > len(schema)+1 && strings.EqualFold(s[:len(schema)+1], schema+":") {
+				s = s[len(schema)+1:]
+				break
+			}
+		}
+		if strings.HasPrefix(strings.ToLower(s), "urn:") {
+			// An extension attribute: keep it whole so that it finds nothing.
+			return attrPath{attr: s}, true
+		}
+	}
+	attr, sub, _ := strings.Cut(s, ".")
+	if attr == "" || strings.Contains(sub, ".") || (strings.Contains(s, ".") && sub == "") {
+		return attrPath{}, false
+	}
+	return attrPath{attr: attr, sub: sub}, true
+}
+
+// lookup returns the value of key in m, matching the name case-insensitively.
+func lookup(m map[string]any, key string) (string, any, bool) {
+	if v, ok := m[key]; ok {
+		return key, v, true
+	}
+	for k, v := range m {
+		if strings.EqualFold(k, key) {
+			return k, v, true
+		}
+	}
+	return key, nil, false
+}
+
+// values returns the values path selects in resource. A multi-valued
+// attribute yields each of its values; without a sub-attribute, the
+// "value" sub-attribute of complex values is compared.
+func (path attrPath) values(resource map[string]any) []any {
+	_, v, ok := lookup(resource, path.attr)
+	if !ok || v == nil {
+		return nil
+	}
+	items, multi := v.([]any)
+	if !multi {
+		items = []any{v}
+	}
+	var out []any
+	for _, item := range items {
+		sub := path.sub
+		if sub == "" && multi {
+			sub = "value"
+		}
+		if m, ok := item.(map[string]any); ok && sub != "" {
+			if _, sv, ok := lookup(m, sub); ok && sv != nil {
+				out = append(out, sv)
+			}
+			continue
+		}
+		if path.sub == "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+type compareFilter struct {
+	path  attrPath
+	op    string
+	value any
+}
+
+func (f compareFilter) Match(resource map[string]any) bool {
+	values := f.path.values(resource)
+	if f.value == nil {
+		// Only "eq null" and "ne null" are meaningful: absence and presence.
+		switch f.op {
+		case "eq":
+			return len(values) == 0
+		case "ne":
+			return len(values) > 0
+		}
+		return false
+	}
+	if f.op == "ne" {
+		return !(compareFilter{path: f.path, op: "eq", value: f.value}).Match(resource)
+	}
+	for _, v := range values {
+		if compare(v, f.op, f.value) {
+			return true
+		}
+	}
+	return false
+}
+
+func compare(actual any, op string, want any) bool {
+	switch want := want.(type) {
+	case string:
+		a, ok := actual.(string)
+		if !ok {
+			return false
+		}
+		a, w := strings.ToLower(a), strings.ToLower(want)
+		switch op {
+		case "eq":
+			return a == w
+		case "co":
+			return strings.Contains(a, w)
+		case "sw":
+			return strings.HasPrefix(a, w)
+		case "ew":
+			return strings.HasSuffix(a, w)
+		case "gt":
+			return a > w
+		case "ge":
+			return a >= w
+		case "lt":
+			return a < w
+		case "le":
+			return a <= w
+		}
+	case bool:
+		a, ok := actual.(bool)
+		return ok && op == "eq" && a == want
+	case float64:
+		a, ok := actual.(float64)
+		if !ok {
+			return false
+		}
+		switch op {
+		case "eq":
+			return a == want
+		case "gt":
+			return a > want
+		case "ge":
+			return a >= want
+		case "lt":
+			return a < want
+		case "le":
+			return a <= want
+		}
+	}
+	return false
+}
+
+type presentFilter struct {
+	path attrPath
+}
+
+func (f presentFilter) Match(resource map[string]any) bool {
+	for _, v := range f.path.values(resource) {
+		switch v := v.(type) {
+		case string:
+			if v != "" {
+				return true
+			}
+		case []any:
+			if len(v) > 0 {
+				return true
+			}
+		default:
+			return true
+		}
+	}
+	return false
+}
+
+// valueFilter matches resources with a value of a multi-valued attribute
+// that matches filter, e.g. emails[type eq "work"].
+type valueFilter struct {
+	attr   string
+	filter Filter
+}
+
+func (f valueFilter) Match(resource map[string]any) bool {
+	_, v, _ := lookup(resource, f.attr)
+	switch v := v.(type) {
+	case []any:
+		for _, item := range v {
+			if m, ok := item.(map[string]any); ok && f.filter.Match(m) {
+				return true
+			}
+		}
+	case map[string]any:
+		return f.filter.Match(v)
+	}
+	return false
+}
+
+type andFilter struct{ left, right Filter }
+
+func (f andFilter) Match(resource map[string]any) bool {
+	return f.left.Match(resource) && f.right.Match(resource)
+}
+
+type orFilter struct{ left, right Filter }
+
+func (f orFilter) Match(resource map[string]any) bool {
+	return f.left.Match(resource) || f.right.Match(resource)
+}
+
+type notFilter struct{ f Filter }
+
+func (f notFilter) Match(resource map[string]any) bool {
+	return !f.f.Match(resource)
+}
+
+// Resource returns v, a resource, in the JSON form filters and patches work
+// on.
+func Resource(v any) (map[string]any, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]any
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// FilterResources returns the resources that match filter, which may be
+// empty to match all of them.
+func FilterResources[T any](resources []T, filter string) ([]T, error) {
+	if strings.TrimSpace(filter) == "" {
+		return resources, nil
+	}
+	f, err := ParseFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+	var out []T
+	for _, r := range resources {
+		m, err := Resource(r)
+		if err != nil {
+			return nil, err
+		}
+		if f.Match(m) {
+			out = append(out, r)
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,163 @@
+package scim_test
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Prashant2307200/auth-service/pkg/scim"
+)
+
+func testUser() map[string]any {
+	active := scim.Bool(true)
+	m, err := scim.Resource(&scim.User{
+		Schemas:    []string{scim.SchemaUser},
+		ID:         "42",
+		ExternalID: "00u1",
+		UserName:   "Ada@Example.com",
+		Name:       &scim.Name{GivenName: "Ada", FamilyName: "Lovelace"},
+		Emails:     []scim.Email{{Value: "ada@example.com", Type: "work", Primary: true}},
+		Active:     &active,
+	})
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+func TestParseFilter(t *testing.T) {
+	tests := []struct {
+		filter string
+		want   bool
+	}{
+		{`userName eq "ada@example.com"`, true},
+		{`USERNAME Eq "ADA@EXAMPLE.COM"`, true},
+		{`urn:ietf:params:scim:schemas:core:2.0:User:userName eq "ada@example.com"`, true},
+		{`userName eq "bob@example.com"`, false},
+		{`userName ne "bob@example.com"`, true},
+		{`userName sw "ada"`, true},
+		{`userName ew "example.com"`, true},
+		{`userName co "@exa"`, true},
+		{`externalId eq "00u1"`, true},
+		{`name.familyName eq "Lovelace"`, true},
+		{`emails eq "ada@example.com"`, true},
+		{`emails.value eq "ada@example.com"`, true},
+		{`emails[type eq "work" and primary eq true]`, true},
+		{`emails[type eq "home"]`, false},
+		{`active eq true`, true},
+		{`active eq false`, false},
+		{`title pr`, false},
+		{`externalId pr`, true},
+		{`title eq null`, true},
+		{`userName eq "x" or externalId eq "00u1"`, true},
+		{`userName eq "x" or externalId eq "00u1" and active eq false`, false},
+		{`(userName eq "x" or externalId eq "00u1") and active eq true`, true},
+		{`not (userName eq "x")`, true},
+		{`urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:department eq "x"`, false},
+	}
+	resource := testUser()
+	for _, tt := range tests {
+		f, err := scim.ParseFilter(tt.filter)
+		if err != nil {
+			t.Errorf("ParseFilter(%s): %v", tt.filter, err)
+			continue
+		}
+		if got := f.Match(resource); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.filter, got, tt.want)
+		}
+	}
+}
+
+func TestParseFilter_Invalid(t *testing.T) {
+	for _, filter := range []string{
+		`userName`,
+		`userName eq`,
+		`userName like "a"`,
+		`userName eq "a`,
+		`(userName eq "a"`,
+		`userName eq "a" extra`,
+		`emails[type eq "work"`,
+		`userName eq {}`,
+	} {
+		_, err := scim.ParseFilter(filter)
+		var scimErr *scim.Error
+		if !errors.As(err, &scimErr) || scimErr.Type != scim.ErrorInvalidFilter {
+			t.Errorf("ParseFilter(%s) = %v, want an invalidFilter error", filter, err)
+		}
+	}
+}
+
+func TestFilterResources(t *testing.T) {
+	users := []*scim.User{
+		{UserName: "ada@example.com"},
+		{UserName: "bob@example.com"},
+	}
+	got, err := scim.FilterResources(users, `userName eq "bob@example.com"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].UserName != "bob@example.com" {
+		t.Fatalf("got %v", got)
+	}
+	all, err := scim.FilterResources(users, "")
+	if err != nil || len(all) != 2 {
+		t.Fatalf("empty filter: %v, %v", all, err)
+	}
+}
+
+func TestPage(t *testing.T) {
+	items := []int{1, 2, 3, 4, 5}
+	tests := []struct {
+		startIndex, count int
+		want              []int
+	}{
+		{1, 100, []int{1, 2, 3, 4, 5}},
+		{2, 2, []int{2, 3}},
+		{5, 10, []int{5}},
+		{9, 10, []int{}},
+		{1, 0, []int{}},
+	}
+	for _, tt := range tests {
+		page := scim.Page(items, scim.ListQuery{StartIndex: tt.startIndex, Count: tt.count})
+		if page.TotalResults != 5 || page.StartIndex != tt.startIndex || page.ItemsPerPage != len(tt.want) {
+			t.Errorf("Page(%d, %d) = %+v", tt.startIndex, tt.count, page)
+		}
+		for i := range tt.want {
+			if page.Resources[i] != tt.want[i] {
+				t.Errorf("Page(%d, %d) = %v, want %v", tt.startIndex, tt.count, page.Resources, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestParseListQuery(t *testing.T) {
+	q := scim.ParseListQuery(httptest.NewRequest("GET", "/Users?startIndex=0&count=5000&filter=userName+pr", nil))
+	if q.StartIndex != 1 || q.Count != scim.MaxCount || q.Filter != "userName pr" {
+		t.Fatalf("got %+v", q)
+	}
+	q = scim.ParseListQuery(httptest.NewRequest("GET", "/Users", nil))
+	if q.StartIndex != 1 || q.Count != scim.DefaultCount {
+		t.Fatalf("defaults: got %+v", q)
+	}
+}
+
+func TestMatchETag(t *testing.T) {
+	etag := scim.ETag(3)
+	if etag != `W/"3"` {
+		t.Fatalf("ETag(3) = %s", etag)
+	}
+	for header, want := range map[string]bool{
+		`W/"3"`:        true,
+		`"3"`:          true,
+		`W/"2", W/"3"`: true,
+		`*`:            true,
+		`W/"4"`:        false,
+		`W/"33"`:       false,
+		`W/"2" , "1"`:  false,
+	} {
+		if got := scim.MatchETag(header, etag); got != want {
+			t.Errorf("MatchETag(%s) = %v, want %v", header, got, want)
+		}
+	}
+}
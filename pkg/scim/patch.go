@@ -0,0 +1,324 @@
+package scim
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// PatchRequest is the body of a PATCH request (RFC 7644 §3.5.2).
+type PatchRequest struct {
+	Schemas    []string    `json:"schemas"`
+	Operations []Operation `json:"Operations"`
+}
+
+// Operation is one operation of a PATCH request. Op is "add", "replace" or
+// "remove", in any case.
+type Operation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// Path is the target of an operation: an attribute, optionally narrowed to
+// the values matching Filter, and optionally one of their sub-attributes.
+type Path struct {
+	Attr   string
+	Filter Filter
+	Sub    string
+	// eq is the attribute and value of a Filter of the form
+	// `attr eq "value"`, used to add a value that matches nothing yet.
+	eq *compareFilter
+}
+
+// ParsePath parses an operation path: "attr", "attr.sub", "attr[filter]" or
+// "attr[filter].sub", optionally prefixed with the core schema URN.
+func ParsePath(s string) (*Path, error) {
+	head, rest, hasFilter := strings.Cut(s, "[")
+	if !hasFilter {
+		path, ok := parseAttrPath(s)
+		if !ok {
+			return nil, BadRequest(ErrorInvalidPath, "invalid path %q", s)
+		}
+		return &Path{Attr: path.attr, Sub: path.sub}, nil
+	}
+
+	path, ok := parseAttrPath(head)
+	if !ok || path.sub != "" {
+		return nil, BadRequest(ErrorInvalidPath, "invalid path %q", s)
+	}
+	end := strings.LastIndex(rest, "]")
+	if end < 0 {
+		return nil, BadRequest(ErrorInvalidPath, "invalid path %q", s)
+	}
+	filter, err := ParseFilter(rest[:end])
+	if err != nil {
+		return nil, BadRequest(ErrorInvalidPath, "invalid path %q", s)
+	}
+	p := &Path{Attr: path.attr, Filter: filter}
+	if tail := rest[end+1:]; tail != "" {
+		sub, ok := strings.CutPrefix(tail, ".")
+		if !ok || sub == "" || strings.Contains(sub, ".") {
+			return nil, BadRequest(ErrorInvalidPath, "invalid path %q", s)
+		}
+		p.Sub = sub
+	}
+	if cf, ok := filter.(compareFilter); ok && cf.op == "eq" && cf.path.sub == "" {
+		p.eq = &cf
+	}
+	return p, nil
+}
+
+// ApplyPatch applies ops, in order, to resource in its JSON form. It does
+// not know the schema: the caller decodes the result and validates it, and
+// ignores changes to read-only attributes.
+func ApplyPatch(resource map[string]any, ops []Operation) error {
+	if len(ops) == 0 {
+		return BadRequest(ErrorInvalidValue, "no operations")
+	}
+	for _, op := range ops {
+		name := strings.ToLower(op.Op)
+		if name != "add" && name != "replace" && name != "remove" {
+			return BadRequest(ErrorInvalidSyntax, "unknown operation %q", op.Op)
+		}
+		var value any
+		if len(op.Value) > 0 {
+			if err := json.Unmarshal(op.Value, &value); err != nil {
+				return BadRequest(ErrorInvalidValue, "invalid value: %v", err)
+			}
+		} else if name != "remove" {
+			return BadRequest(ErrorInvalidValue, "%s needs a value", op.Op)
+		}
+
+		if op.Path == "" {
+			if name == "remove" {
+				return BadRequest(ErrorNoTarget, "remove needs a path")
+			}
+			// Without a path the value holds the attributes to change, some
+			// identity providers using paths as their keys.
+			attrs, ok := value.(map[string]any)
+			if !ok {
+				return BadRequest(ErrorInvalidValue, "%s without a path needs an object value", op.Op)
+			}
+			keys := make([]string, 0, len(attrs))
+			for k := range attrs {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				path, err := ParsePath(k)
+				if err != nil {
+					return err
+				}
+				if err := apply(resource, name, path, attrs[k]); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		path, err := ParsePath(op.Path)
+		if err != nil {
+			return err
+		}
+		if err := apply(resource, name, path, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func apply(resource map[string]any, op string, path *Path, value any) error {
+	key, current, _ := lookup(resource, path.Attr)
+	if path.Filter != nil {
+		return applyFiltered(resource, key, current, op, path, value)
+	}
+	if path.Sub != "" {
+		switch current := current.(type) {
+		case map[string]any:
+			return apply(current, op, &Path{Attr: path.Sub}, value)
+		case []any:
+			for _, item := range current {
+				if m, ok := item.(map[string]any); ok {
+					if err := apply(m, op, &Path{Attr: path.Sub}, value); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		case nil:
+			if op == "remove" {
+				return nil
+			}
+			resource[key] = map[string]any{path.Sub: value}
+			return nil
+		default:
+			return BadRequest(ErrorInvalidPath, "%s has no sub-attributes", path.Attr)
+		}
+	}
+
+	switch op {
+	case "remove":
+		// Some identity providers name the values to remove from a
+		// multi-valued attribute in the value rather than in a filter.
+		if items, ok := current.([]any); ok && value != nil {
+			removed, ok := value.([]any)
+			if !ok {
+				removed = []any{value}
+			}
+			kept := make([]any, 0, len(items))
+			for _, item := range items {
+				if !containsMember(removed, item) {
+					kept = append(kept, item)
+				}
+			}
+			resource[key] = kept
+			return nil
+		}
+		delete(resource, key)
+	case "replace":
+		// Replacing a complex attribute replaces the sub-attributes given
+		// and leaves the others (RFC 7644 §3.5.2.3).
+		current, isComplex := current.(map[string]any)
+		fields, ok := value.(map[string]any)
+		if !isComplex || !ok {
+			resource[key] = value
+			return nil
+		}
+		for k, v := range fields {
+			k, _, _ = lookup(current, k)
+			current[k] = v
+		}
+	case "add":
+		switch current := current.(type) {
+		case []any:
+			// Adding to a multi-valued attribute adds the values it lacks.
+			added, ok := value.([]any)
+			if !ok {
+				added = []any{value}
+			}
+			for _, v := range added {
+				if !containsMember(current, v) {
+					current = append(current, v)
+				}
+			}
+			resource[key] = current
+		case map[string]any:
+			fields, ok := value.(map[string]any)
+			if !ok {
+				return BadRequest(ErrorInvalidValue, "%s needs an object value", path.Attr)
+			}
+			for k, v := range fields {
+				k, _, _ = lookup(current, k)
+				current[k] = v
+			}
+		default:
+			resource[key] = value
+		}
+	}
+	return nil
+}
+
+// applyFiltered applies op to the values of the multi-valued attribute key
+// that match path.Filter.
+func applyFiltered(resource map[string]any, key string, current any, op string, path *Path, value any) error {
+	items, _ := current.([]any)
+	var matched []int
+	for i, item := range items {
+		if m, ok := item.(map[string]any); ok && path.Filter.Match(m) {
+			matched = append(matched, i)
+		}
+	}
+
+	if len(matched) == 0 {
+		if op == "remove" {
+			return nil
+		}
+		// Setting a value selected by equality, e.g. emails[type eq
+		// "work"].value, creates it when there is none.
+		if path.eq == nil {
+			return BadRequest(ErrorNoTarget, "no values of %s match the filter", path.Attr)
+		}
+		item := map[string]any{path.eq.path.attr: path.eq.value}
+		if path.Sub != "" {
+			item[path.Sub] = value
+		} else if fields, ok := value.(map[string]any); ok {
+			for k, v := range fields {
+				item[k] = v
+			}
+		} else {
+			return BadRequest(ErrorInvalidValue, "%s needs an object value", path.Attr)
+		}
+		resource[key] = append(items, item)
+		return nil
+	}
+
+	if op == "remove" && path.Sub == "" {
+		kept := make([]any, 0, len(items)-len(matched))
+		for i, item := range items {
+			if !containsIndex(matched, i) {
+				kept = append(kept, item)
+			}
+		}
+		resource[key] = kept
+		return nil
+	}
+	for _, i := range matched {
+		m := items[i].(map[string]any)
+		if path.Sub != "" {
+			if err := apply(m, op, &Path{Attr: path.Sub}, value); err != nil {
+				return err
+			}
+			continue
+		}
+		fields, ok := value.(map[string]any)
+		if !ok {
+			return BadRequest(ErrorInvalidValue, "%s needs an object value", path.Attr)
+		}
+		if op == "replace" {
+			items[i] = fields
+			continue
+		}
+		for k, v := range fields {
+			m[k] = v
+		}
+	}
+	return nil
+}
+
+func containsValue(values []any, v any) bool {
+	for _, existing := range values {
+		if reflect.DeepEqual(existing, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// containsMember reports whether item is one of values, comparing complex
+// values by their "value" sub-attribute.
+func containsMember(values []any, item any) bool {
+	m, ok := item.(map[string]any)
+	if !ok {
+		return containsValue(values, item)
+	}
+	_, id, _ := lookup(m, "value")
+	for _, v := range values {
+		if vm, ok := v.(map[string]any); ok {
+			if _, vid, _ := lookup(vm, "value"); vid != nil && reflect.DeepEqual(vid, id) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func containsIndex(indexes []int, i int) bool {
+	for _, j := range indexes {
+		if j == i {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,175 @@
+package scim_test
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/Prashant2307200/auth-service/pkg/scim"
+)
+
+func patch(t *testing.T, resource map[string]any, ops string) error {
+	t.Helper()
+	var req scim.PatchRequest
+	if err := json.Unmarshal([]byte(ops), &req); err != nil {
+		t.Fatalf("ops: %v", err)
+	}
+	return scim.ApplyPatch(resource, req.Operations)
+}
+
+func decodeUser(t *testing.T, resource map[string]any) *scim.User {
+	t.Helper()
+	data, err := json.Marshal(resource)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var u scim.User
+	if err := json.Unmarshal(data, &u); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	return &u
+}
+
+func TestApplyPatch_User(t *testing.T) {
+	resource := testUser()
+	err := patch(t, resource, `{"Operations": [
+		{"op": "Replace", "path": "active", "value": "False"},
+		{"op": "replace", "path": "name.givenName", "value": "Augusta"},
+		{"op": "replace", "path": "emails[type eq \"work\"].value", "value": "augusta@example.com"},
+		{"op": "add", "path": "displayName", "value": "Augusta Ada"},
+		{"op": "remove", "path": "externalId"}
+	]}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u := decodeUser(t, resource)
+	if u.IsActive() {
+		t.Error("active should be false")
+	}
+	if u.Name.GivenName != "Augusta" || u.Name.FamilyName != "Lovelace" {
+		t.Errorf("name = %+v", u.Name)
+	}
+	if u.PrimaryEmail() != "augusta@example.com" || len(u.Emails) != 1 {
+		t.Errorf("emails = %+v", u.Emails)
+	}
+	if u.DisplayName != "Augusta Ada" || u.ExternalID != "" {
+		t.Errorf("displayName = %q, externalId = %q", u.DisplayName, u.ExternalID)
+	}
+}
+
+func TestApplyPatch_NoPath(t *testing.T) {
+	resource := testUser()
+	err := patch(t, resource, `{"Operations": [
+		{"op": "replace", "value": {"active": false, "name.familyName": "King", "userName": "ada.king@example.com"}}
+	]}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u := decodeUser(t, resource)
+	if u.IsActive() || u.Name.FamilyName != "King" || u.UserName != "ada.king@example.com" {
+		t.Errorf("got %+v", u)
+	}
+}
+
+func TestApplyPatch_AddsValueSelectedByEquality(t *testing.T) {
+	resource := testUser()
+	if err := patch(t, resource, `{"Operations": [
+		{"op": "add", "path": "emails[type eq \"home\"].value", "value": "ada@home.example"}
+	]}`); err != nil {
+		t.Fatal(err)
+	}
+	u := decodeUser(t, resource)
+	if len(u.Emails) != 2 || u.Emails[1].Type != "home" || u.Emails[1].Value != "ada@home.example" {
+		t.Errorf("emails = %+v", u.Emails)
+	}
+}
+
+func groupMembers(t *testing.T, resource map[string]any) []string {
+	t.Helper()
+	data, _ := json.Marshal(resource)
+	var g scim.Group
+	if err := json.Unmarshal(data, &g); err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, m := range g.Members {
+		ids = append(ids, m.Value)
+	}
+	return ids
+}
+
+func TestApplyPatch_GroupMembers(t *testing.T) {
+	resource, _ := scim.Resource(&scim.Group{
+		DisplayName: "admin",
+		Members:     []scim.Reference{{Value: "1", Display: "ada"}, {Value: "2"}},
+	})
+
+	steps := []struct {
+		ops  string
+		want []string
+	}{
+		{`{"Operations": [{"op": "add", "path": "members", "value": [{"value": "3"}, {"value": "1"}]}]}`, []string{"1", "2", "3"}},
+		{`{"Operations": [{"op": "remove", "path": "members[value eq \"2\"]"}]}`, []string{"1", "3"}},
+		{`{"Operations": [{"op": "Remove", "path": "members", "value": [{"value": "1"}]}]}`, []string{"3"}},
+		{`{"Operations": [{"op": "replace", "path": "members", "value": [{"value": "4"}, {"value": "5"}]}]}`, []string{"4", "5"}},
+		{`{"Operations": [{"op": "remove", "path": "members[value eq \"9\"]"}]}`, []string{"4", "5"}},
+		{`{"Operations": [{"op": "remove", "path": "members"}]}`, nil},
+	}
+	for i, step := range steps {
+		if err := patch(t, resource, step.ops); err != nil {
+			t.Fatalf("step %d: %v", i, err)
+		}
+		if got := groupMembers(t, resource); !reflect.DeepEqual(got, step.want) {
+			t.Fatalf("step %d: members = %v, want %v", i, got, step.want)
+		}
+	}
+}
+
+func TestApplyPatch_Invalid(t *testing.T) {
+	tests := []struct {
+		ops      string
+		scimType string
+	}{
+		{`{"Operations": []}`, scim.ErrorInvalidValue},
+		{`{"Operations": [{"op": "move", "path": "active", "value": true}]}`, scim.ErrorInvalidSyntax},
+		{`{"Operations": [{"op": "replace", "path": "active"}]}`, scim.ErrorInvalidValue},
+		{`{"Operations": [{"op": "remove"}]}`, scim.ErrorNoTarget},
+		{`{"Operations": [{"op": "replace", "value": "x"}]}`, scim.ErrorInvalidValue},
+		{`{"Operations": [{"op": "replace", "path": "emails[type eq", "value": "x"}]}`, scim.ErrorInvalidPath},
+		{`{"Operations": [{"op": "replace", "path": "name..givenName", "value": "x"}]}`, scim.ErrorInvalidPath},
+		{`{"Operations": [{"op": "replace", "path": "emails[type ne \"work\"].value", "value": "x"}]}`, scim.ErrorNoTarget},
+		{`{"Operations": [{"op": "replace", "path": "userName.first", "value": "x"}]}`, scim.ErrorInvalidPath},
+	}
+	for _, tt := range tests {
+		err := patch(t, testUser(), tt.ops)
+		var scimErr *scim.Error
+		if !errors.As(err, &scimErr) || scimErr.Type != tt.scimType || scimErr.Status != 400 {
+			t.Errorf("%s: got %v, want a %s error", tt.ops, err, tt.scimType)
+		}
+	}
+}
+
+func TestBool(t *testing.T) {
+	for input, want := range map[string]bool{`true`: true, `"True"`: true, `"false"`: false, `false`: false} {
+		var b scim.Bool
+		if err := json.Unmarshal([]byte(input), &b); err != nil || bool(b) != want {
+			t.Errorf("%s: got %v, %v", input, b, err)
+		}
+	}
+	var b scim.Bool
+	if err := json.Unmarshal([]byte(`"yes"`), &b); err == nil {
+		t.Error(`"yes" should not be a boolean`)
+	}
+}
+
+func TestErrorJSON(t *testing.T) {
+	data, err := json.Marshal(scim.BadRequest(scim.ErrorUniqueness, "userName %q is taken", "ada"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"schemas":["urn:ietf:params:scim:api:messages:2.0:Error"],"status":"400","scimType":"uniqueness","detail":"userName \"ada\" is taken"}`
+	if string(data) != want {
+		t.Errorf("got %s", data)
+	}
+}
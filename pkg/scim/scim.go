@@ -0,0 +1,244 @@
+// Package scim implements the protocol side of a SCIM 2.0 service provider
+// (RFC 7643, RFC 7644): the User and Group resources, list responses with
+// index-based pagination, filters, PATCH operations, weak ETags and errors.
+// Storage and the meaning of resources are left to the caller.
+package scim
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	SchemaUser                  = "urn:ietf:params:scim:schemas:core:2.0:User"
+	SchemaGroup                 = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	SchemaListResponse          = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	SchemaPatchOp               = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	SchemaError                 = "urn:ietf:params:scim:api:messages:2.0:Error"
+	SchemaServiceProviderConfig = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+	SchemaResourceType          = "urn:ietf:params:scim:schemas:core:2.0:ResourceType"
+
+	// ContentType is the media type of SCIM requests and responses.
+	ContentType = "application/scim+json"
+)
+
+// Error types of RFC 7644 §3.12, sent as scimType.
+const (
+	ErrorInvalidFilter = "invalidFilter"
+	ErrorTooMany       = "tooMany"
+	ErrorUniqueness    = "uniqueness"
+	ErrorMutability    = "mutability"
+	ErrorInvalidSyntax = "invalidSyntax"
+	ErrorInvalidPath   = "invalidPath"
+	ErrorNoTarget      = "noTarget"
+	ErrorInvalidValue  = "invalidValue"
+)
+
+// Error is a SCIM error response.
+type Error struct {
+	Status int
+	// Type is one of the Error* types; it is empty for errors without one,
+	// such as 404s.
+	Type   string
+	Detail string
+}
+
+// NewError returns an error with the given status, SCIM type and detail.
+func NewError(status int, scimType, detail string) *Error {
+	return &Error{Status: status, Type: scimType, Detail: detail}
+}
+
+// BadRequest returns a 400 error of the given SCIM type.
+func BadRequest(scimType, format string, args ...any) *Error {
+	return NewError(http.StatusBadRequest, scimType, fmt.Sprintf(format, args...))
+}
+
+func (e *Error) Error() string {
+	if e.Type == "" {
+		return "scim: " + e.Detail
+	}
+	return "scim: " + e.Type + ": " + e.Detail
+}
+
+func (e *Error) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Schemas []string `json:"schemas"`
+		Status  string   `json:"status"`
+		Type    string   `json:"scimType,omitempty"`
+		Detail  string   `json:"detail,omitempty"`
+	}{[]string{SchemaError}, strconv.Itoa(e.Status), e.Type, e.Detail})
+}
+
+// Meta is the metadata common to all resources.
+type Meta struct {
+	ResourceType string    `json:"resourceType"`
+	Created      time.Time `json:"created"`
+	LastModified time.Time `json:"lastModified"`
+	Location     string    `json:"location,omitempty"`
+	// Version is the resource's ETag.
+	Version string `json:"version,omitempty"`
+}
+
+// Bool is a boolean that also accepts the strings "true" and "false" in any
+// case, which some identity providers send for active.
+type Bool bool
+
+func (b *Bool) UnmarshalJSON(data []byte) error {
+	var v any
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	switch v := v.(type) {
+	case bool:
+		*b = Bool(v)
+	case string:
+		parsed, err := strconv.ParseBool(strings.ToLower(v))
+		if err != nil {
+			return fmt.Errorf("scim: %q is not a boolean", v)
+		}
+		*b = Bool(parsed)
+	default:
+		return fmt.Errorf("scim: %s is not a boolean", data)
+	}
+	return nil
+}
+
+// User is the core User resource, limited to the attributes this package's
+// users support.
+type User struct {
+	Schemas     []string    `json:"schemas"`
+	ID          string      `json:"id,omitempty"`
+	ExternalID  string      `json:"externalId,omitempty"`
+	UserName    string      `json:"userName"`
+	Name        *Name       `json:"name,omitempty"`
+	DisplayName string      `json:"displayName,omitempty"`
+	Emails      []Email     `json:"emails,omitempty"`
+	Active      *Bool       `json:"active,omitempty"`
+	Groups      []Reference `json:"groups,omitempty"`
+	Meta        *Meta       `json:"meta,omitempty"`
+}
+
+// IsActive reports whether the user is active; active defaults to true.
+func (u *User) IsActive() bool {
+	return u.Active == nil || bool(*u.Active)
+}
+
+type Name struct {
+	Formatted  string `json:"formatted,omitempty"`
+	GivenName  string `json:"givenName,omitempty"`
+	FamilyName string `json:"familyName,omitempty"`
+}
+
+type Email struct {
+	Value   string `json:"value"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+}
+
+// PrimaryEmail returns the primary email, else the first one.
+func (u *User) PrimaryEmail() string {
+	for _, e := range u.Emails {
+		if e.Primary {
+			return e.Value
+		}
+	}
+	if len(u.Emails) > 0 {
+		return u.Emails[0].Value
+	}
+	return ""
+}
+
+// Group is the core Group resource.
+type Group struct {
+	Schemas     []string    `json:"schemas"`
+	ID          string      `json:"id,omitempty"`
+	ExternalID  string      `json:"externalId,omitempty"`
+	DisplayName string      `json:"displayName"`
+	Members     []Reference `json:"members,omitempty"`
+	Meta        *Meta       `json:"meta,omitempty"`
+}
+
+// Reference is a member of a group, or a group of a user.
+type Reference struct {
+	Value   string `json:"value"`
+	Ref     string `json:"$ref,omitempty"`
+	Display string `json:"display,omitempty"`
+}
+
+// ListResponse is a page of the resources matching a query.
+type ListResponse[T any] struct {
+	Schemas      []string `json:"schemas"`
+	TotalResults int      `json:"totalResults"`
+	StartIndex   int      `json:"startIndex"`
+	ItemsPerPage int      `json:"itemsPerPage"`
+	Resources    []T      `json:"Resources"`
+}
+
+const (
+	DefaultCount = 100
+	MaxCount     = 1000
+)
+
+// ListQuery is a query on a resource list: a filter and a page of at most
+// Count resources starting at the 1-based StartIndex.
+type ListQuery struct {
+	Filter     string
+	StartIndex int
+	Count      int
+}
+
+// ParseListQuery reads filter, startIndex and count from the query string.
+// Out of range values are clamped, as RFC 7644 §3.4.2.4 asks.
+func ParseListQuery(r *http.Request) ListQuery {
+	q := ListQuery{Filter: r.URL.Query().Get("filter"), StartIndex: 1, Count: DefaultCount}
+	if v, err := strconv.Atoi(r.URL.Query().Get("startIndex")); err == nil && v > 1 {
+		q.StartIndex = v
+	}
+	if v, err := strconv.Atoi(r.URL.Query().Get("count")); err == nil {
+		q.Count = min(max(v, 0), MaxCount)
+	}
+	return q
+}
+
+// Page returns the page of resources that q asks for, as a list response.
+func Page[T any](resources []T, q ListQuery) *ListResponse[T] {
+	start := max(q.StartIndex, 1)
+	count := q.Count
+	if count < 0 {
+		count = 0
+	}
+	from := min(start-1, len(resources))
+	to := min(from+count, len(resources))
+	page := resources[from:to]
+	if page == nil {
+		page = []T{}
+	}
+	return &ListResponse[T]{
+		Schemas:      []string{SchemaListResponse},
+		TotalResults: len(resources),
+		StartIndex:   start,
+		ItemsPerPage: len(page),
+		Resources:    page,
+	}
+}
+
+// ETag returns the weak entity tag of a resource's version.
+func ETag(version int) string {
+	return `W/"` + strconv.Itoa(version) + `"`
+}
+
+// MatchETag reports whether the If-Match or If-None-Match header value
+// names etag, comparing weakly (RFC 9110 §8.8.3.2). "*" matches any tag.
+func MatchETag(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
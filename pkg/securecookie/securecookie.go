@@ -0,0 +1,165 @@
+// Package securecookie encodes cookie values so clients can neither read nor
+// forge them. Values are signed with HMAC-SHA256 or, when encryption is on,
+// sealed with AES-256-GCM, and carry an expiry checked on decode. Several
+// secrets may be configured for rotation: the first encodes, all decode.
+package securecookie
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrInvalid is returned for values that were tampered with, encoded for
+	// another cookie or with an unknown secret, or are not encoded at all.
+	ErrInvalid = errors.New("securecookie: invalid value")
+	// ErrExpired is returned for values past the max age they were encoded with.
+	ErrExpired = errors.New("securecookie: value expired")
+)
+
+const (
+	signedPrefix    = "s."
+	encryptedPrefix = "e."
+)
+
+type key struct {
+	mac  []byte
+	aead cipher.AEAD
+}
+
+// Codec encodes and decodes cookie values.
+type Codec struct {
+	keys    []key
+	encrypt bool
+	now     func() time.Time
+}
+
+// New returns a Codec for secrets, each at least 32 bytes, the first of which
+// encodes. With encrypt set, values are encrypted as well as authenticated.
+// Values encoded either way decode, so encryption can be turned on without
+// invalidating cookies already issued.
+func New(secrets [][]byte, encrypt bool) (*Codec, error) {
+	if len(secrets) == 0 {
+		return nil, errors.New("securecookie: at least one secret is required")
+	}
+	c := &Codec{encrypt: encrypt, now: time.Now}
+	for _, secret := range secrets {
+		if len(secret) < 32 {
+			return nil, errors.New("securecookie: secrets must be at least 32 bytes")
+		}
+		block, err := aes.NewCipher(derive(secret, "encrypt"))
+		if err != nil {
+			return nil, err
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		c.keys = append(c.keys, key{mac: derive(secret, "sign"), aead: aead})
+	}
+	return c, nil
+}
+
+// derive separates the signing and encryption keys taken from one secret.
+func derive(secret []byte, purpose string) []byte {
+	h := hmac.New(sha256.New, secret)
+	h.Write([]byte("securecookie\x00" + purpose))
+	return h.Sum(nil)
+}
+
+// Encode returns value encoded for the cookie called name, valid for maxAge.
+func (c *Codec) Encode(name, value string, maxAge time.Duration) (string, error) {
+	payload := make([]byte, 8, 8+len(value))
+	binary.BigEndian.PutUint64(payload, uint64(c.now().Add(maxAge).Unix()))
+	payload = append(payload, value...)
+
+	k := c.keys[0]
+	if !c.encrypt {
+		return signedPrefix + encode(payload) + "." + encode(sign(k.mac, name, payload)), nil
+	}
+	nonce := make([]byte, k.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return encryptedPrefix + encode(k.aead.Seal(nonce, nonce, payload, []byte(name))), nil
+}
+
+// Decode returns the value encoded for the cookie called name.
+func (c *Codec) Decode(name, encoded string) (string, error) {
+	var payload []byte
+	switch {
+	case strings.HasPrefix(encoded, signedPrefix):
+		payload = c.verify(name, strings.TrimPrefix(encoded, signedPrefix))
+	case strings.HasPrefix(encoded, encryptedPrefix):
+		payload = c.open(name, strings.TrimPrefix(encoded, encryptedPrefix))
+	}
+	if len(payload) < 8 {
+		return "", ErrInvalid
+	}
+	if c.now().Unix() >= int64(binary.BigEndian.Uint64(payload)) {
+		return "", ErrExpired
+	}
+	return string(payload[8:]), nil
+}
+
+func (c *Codec) verify(name, encoded string) []byte {
+	encPayload, encMAC, ok := strings.Cut(encoded, ".")
+	if !ok {
+		return nil
+	}
+	payload, err := decode(encPayload)
+	if err != nil {
+		return nil
+	}
+	mac, err := decode(encMAC)
+	if err != nil {
+		return nil
+	}
+	for _, k := range c.keys {
+		if hmac.Equal(mac, sign(k.mac, name, payload)) {
+			return payload
+		}
+	}
+	return nil
+}
+
+func (c *Codec) open(name, encoded string) []byte {
+	sealed, err := decode(encoded)
+	if err != nil {
+		return nil
+	}
+	for _, k := range c.keys {
+		size := k.aead.NonceSize()
+		if len(sealed) < size {
+			return nil
+		}
+		if payload, err := k.aead.Open(nil, sealed[:size], sealed[size:], []byte(name)); err == nil {
+			return payload
+		}
+	}
+	return nil
+}
+
+func sign(macKey []byte, name string, payload []byte) []byte {
+	h := hmac.New(sha256.New, macKey)
+	h.Write([]byte(name))
+	h.Write([]byte{0})
+	h.Write(payload)
+	return h.Sum(nil)
+}
+
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decode(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(s)
+}
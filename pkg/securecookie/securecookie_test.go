@@ -0,0 +1,80 @@
+package securecookie
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	oldSecret = []byte(strings.Repeat("o", 32))
+	newSecret = []byte(strings.Repeat("n", 32))
+)
+
+func TestCodec_RoundTrip(t *testing.T) {
+	for _, encrypt := range []bool{false, true} {
+		c, err := New([][]byte{newSecret}, encrypt)
+		require.NoError(t, err)
+
+		encoded, err := c.Encode("session", "value-1", time.Minute)
+		require.NoError(t, err)
+		assert.NotContains(t, encoded, "value-1")
+
+		got, err := c.Decode("session", encoded)
+		require.NoError(t, err)
+		assert.Equal(t, "value-1", got)
+
+		_, err = c.Decode("other", encoded)
+		assert.ErrorIs(t, err, ErrInvalid, "encoded for another cookie")
+		_, err = c.Decode("session", encoded[:len(encoded)-2]+"AA")
+		assert.ErrorIs(t, err, ErrInvalid, "tampered")
+		_, err = c.Decode("session", "value-1")
+		assert.ErrorIs(t, err, ErrInvalid, "plain value")
+	}
+}
+
+func TestCodec_Expiry(t *testing.T) {
+	c, err := New([][]byte{newSecret}, true)
+	require.NoError(t, err)
+	encoded, err := c.Encode("session", "v", time.Minute)
+	require.NoError(t, err)
+
+	c.now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+	_, err = c.Decode("session", encoded)
+	assert.ErrorIs(t, err, ErrExpired)
+}
+
+func TestCodec_Rotation(t *testing.T) {
+	old, err := New([][]byte{oldSecret}, false)
+	require.NoError(t, err)
+	signed, err := old.Encode("session", "v", time.Minute)
+	require.NoError(t, err)
+
+	// After rotation the old secret still decodes, and turning encryption
+	// on keeps signed values valid.
+	rotated, err := New([][]byte{newSecret, oldSecret}, true)
+	require.NoError(t, err)
+	got, err := rotated.Decode("session", signed)
+	require.NoError(t, err)
+	assert.Equal(t, "v", got)
+
+	encrypted, err := rotated.Encode("session", "w", time.Minute)
+	require.NoError(t, err)
+	_, err = old.Decode("session", encrypted)
+	assert.ErrorIs(t, err, ErrInvalid)
+
+	retired, err := New([][]byte{newSecret}, true)
+	require.NoError(t, err)
+	_, err = retired.Decode("session", signed)
+	assert.ErrorIs(t, err, ErrInvalid)
+}
+
+func TestNew_RejectsShortSecrets(t *testing.T) {
+	_, err := New(nil, false)
+	assert.Error(t, err)
+	_, err = New([][]byte{[]byte("short")}, false)
+	assert.Error(t, err)
+}
@@ -0,0 +1,138 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// COSE algorithm identifiers (RFC 9053) accepted for credentials.
+const (
+	AlgES256 int64 = -7
+	AlgEdDSA int64 = -8
+	AlgRS256 int64 = -257
+)
+
+// SupportedAlgorithms is the pubKeyCredParams preference order sent to clients.
+var SupportedAlgorithms = []int64{AlgES256, AlgEdDSA, AlgRS256}
+
+var ErrUnsupportedKey = errors.New("webauthn: unsupported credential public key")
+
+// COSE key parameters.
+const (
+	coseKty   int64 = 1
+	coseAlg   int64 = 3
+	coseCrv   int64 = -1
+	coseX     int64 = -2
+	coseY     int64 = -3
+	coseRSA_N int64 = -1
+	coseRSA_E int64 = -2
+
+	ktyOKP int64 = 1
+	ktyEC2 int64 = 2
+	ktyRSA int64 = 3
+
+	crvP256    int64 = 1
+	crvEd25519 int64 = 6
+)
+
+// PublicKey is a parsed COSE_Key that can check assertion signatures.
+type PublicKey struct {
+	Alg int64
+	key crypto.PublicKey
+}
+
+// ParsePublicKey decodes a COSE_Key as stored with a credential.
+func ParsePublicKey(cose []byte) (*PublicKey, error) {
+	v, rest, err := decodeCBOR(cose)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) != 0 {
+		return nil, errCBOR
+	}
+	m, ok := v.(map[any]any)
+	if !ok {
+		return nil, ErrUnsupportedKey
+	}
+	return publicKeyFromMap(m)
+}
+
+func publicKeyFromMap(m map[any]any) (*PublicKey, error) {
+	kty, _ := m[coseKty].(int64)
+	alg, _ := m[coseAlg].(int64)
+
+	switch {
+	case kty == ktyEC2 && alg == AlgES256:
+		crv, _ := m[coseCrv].(int64)
+		x, _ := m[coseX].([]byte)
+		y, _ := m[coseY].([]byte)
+		if crv != crvP256 || len(x) != 32 || len(y) != 32 {
+			return nil, ErrUnsupportedKey
+		}
+		pub := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !pub.Curve.IsOnCurve(pub.X, pub.Y) {
+			return nil, ErrUnsupportedKey
+		}
+		return &PublicKey{Alg: alg, key: pub}, nil
+	case kty == ktyOKP && alg == AlgEdDSA:
+		crv, _ := m[coseCrv].(int64)
+		x, _ := m[coseX].([]byte)
+		if crv != crvEd25519 || len(x) != ed25519.PublicKeySize {
+			return nil, ErrUnsupportedKey
+		}
+		return &PublicKey{Alg: alg, key: ed25519.PublicKey(x)}, nil
+	case kty == ktyRSA && alg == AlgRS256:
+		n, _ := m[coseRSA_N].([]byte)
+		e, _ := m[coseRSA_E].([]byte)
+		if len(n) < 256 || len(e) == 0 || len(e) > 4 {
+			return nil, ErrUnsupportedKey
+		}
+		exp := new(big.Int).SetBytes(e)
+		return &PublicKey{Alg: alg, key: &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exp.Int64())}}, nil
+	}
+	return nil, fmt.Errorf("%w: kty %d alg %d", ErrUnsupportedKey, kty, alg)
+}
+
+// Verify checks sig over data with the key's algorithm.
+func (k *PublicKey) Verify(data, sig []byte) error {
+	return verifySignature(k.key, k.Alg, data, sig)
+}
+
+func verifySignature(key crypto.PublicKey, alg int64, data, sig []byte) error {
+	switch pub := key.(type) {
+	case *ecdsa.PublicKey:
+		if alg != AlgES256 {
+			break
+		}
+		digest := sha256.Sum256(data)
+		if ecdsa.VerifyASN1(pub, digest[:], sig) {
+			return nil
+		}
+		return ErrInvalidSignature
+	case ed25519.PublicKey:
+		if alg != AlgEdDSA {
+			break
+		}
+		if ed25519.Verify(pub, data, sig) {
+			return nil
+		}
+		return ErrInvalidSignature
+	case *rsa.PublicKey:
+		if alg != AlgRS256 {
+			break
+		}
+		digest := sha256.Sum256(data)
+		if rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], sig) == nil {
+			return nil
+		}
+		return ErrInvalidSignature
+	}
+	return ErrUnsupportedKey
+}
@@ -0,0 +1,517 @@
+// Package webauthn implements the relying-party side of WebAuthn Level 2
+// registration and authentication ceremonies. It verifies client data,
+// authenticator data and signatures; storing credentials and challenges is
+// left to the caller.
+package webauthn
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	challengeSize      = 32
+	maxCredentialIDLen = 1023
+
+	flagUserPresent    = 0x01
+	flagUserVerified   = 0x04
+	flagBackupEligible = 0x08
+	flagBackupState    = 0x10
+	flagAttestedData   = 0x40
+	flagExtensionData  = 0x80
+)
+
+// User verification requirements.
+const (
+	VerificationRequired    = "required"
+	VerificationPreferred   = "preferred"
+	VerificationDiscouraged = "discouraged"
+)
+
+var (
+	ErrInvalidClientData   = errors.New("webauthn: invalid client data")
+	ErrChallengeMismatch   = errors.New("webauthn: challenge mismatch")
+	ErrOriginMismatch      = errors.New("webauthn: origin not allowed")
+	ErrRPIDMismatch        = errors.New("webauthn: relying party ID mismatch")
+	ErrUserNotPresent      = errors.New("webauthn: user presence not asserted")
+	ErrUserNotVerified     = errors.New("webauthn: user verification required")
+	ErrInvalidSignature    = errors.New("webauthn: invalid signature")
+	ErrInvalidAttestation  = errors.New("webauthn: invalid attestation")
+	ErrInvalidAuthData     = errors.New("webauthn: invalid authenticator data")
+	ErrSignCountRegression = errors.New("webauthn: signature counter did not increase, credential may be cloned")
+)
+
+// URLEncodedBytes marshals as unpadded base64url, the encoding browsers use
+// in PublicKeyCredential.toJSON(). Padded input is accepted too.
+type URLEncodedBytes []byte
+
+func (b URLEncodedBytes) MarshalJSON() ([]byte, error) {
+	return json.Marshal(base64.RawURLEncoding.EncodeToString(b))
+}
+
+func (b *URLEncodedBytes) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return fmt.Errorf("webauthn: invalid base64url: %w", err)
+	}
+	*b = decoded
+	return nil
+}
+
+// RelyingParty holds the identity browsers bind credentials to.
+type RelyingParty struct {
+	// ID is the effective domain, e.g. "example.com".
+	ID   string
+	Name string
+	// Origins lists the exact origins ceremonies may come from,
+	// e.g. "https://app.example.com".
+	Origins []string
+	Timeout time.Duration
+}
+
+// NewChallenge returns a random challenge for one ceremony.
+func NewChallenge() ([]byte, error) {
+	c := make([]byte, challengeSize)
+	if _, err := rand.Read(c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+type RPEntity struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type UserEntity struct {
+	ID          URLEncodedBytes `json:"id"`
+	Name        string          `json:"name"`
+	DisplayName string          `json:"displayName"`
+}
+
+type CredentialParameter struct {
+	Type string `json:"type"`
+	Alg  int64  `json:"alg"`
+}
+
+type CredentialDescriptor struct {
+	Type       string          `json:"type"`
+	ID         URLEncodedBytes `json:"id"`
+	Transports []string        `json:"transports,omitempty"`
+}
+
+type AuthenticatorSelection struct {
+	ResidentKey        string `json:"residentKey,omitempty"`
+	RequireResidentKey bool   `json:"requireResidentKey"`
+	UserVerification   string `json:"userVerification,omitempty"`
+}
+
+// CreationOptions is PublicKeyCredentialCreationOptions for navigator.credentials.create.
+type CreationOptions struct {
+	RP                     RPEntity               `json:"rp"`
+	User                   UserEntity             `json:"user"`
+	Challenge              URLEncodedBytes        `json:"challenge"`
+	PubKeyCredParams       []CredentialParameter  `json:"pubKeyCredParams"`
+	Timeout                int64                  `json:"timeout,omitempty"`
+	ExcludeCredentials     []CredentialDescriptor `json:"excludeCredentials,omitempty"`
+	AuthenticatorSelection AuthenticatorSelection `json:"authenticatorSelection"`
+	Attestation            string                 `json:"attestation"`
+}
+
+// RequestOptions is PublicKeyCredentialRequestOptions for navigator.credentials.get.
+type RequestOptions struct {
+	Challenge        URLEncodedBytes        `json:"challenge"`
+	Timeout          int64                  `json:"timeout,omitempty"`
+	RPID             string                 `json:"rpId"`
+	AllowCredentials []CredentialDescriptor `json:"allowCredentials,omitempty"`
+	UserVerification string                 `json:"userVerification"`
+}
+
+// CreationOptions asks for a discoverable credential so it can later be used
+// without a username. Credentials in exclude are not registered again.
+func (rp *RelyingParty) CreationOptions(challenge []byte, user UserEntity, exclude []CredentialDescriptor) *CreationOptions {
+	params := make([]CredentialParameter, 0, len(SupportedAlgorithms))
+	for _, alg := range SupportedAlgorithms {
+		params = append(params, CredentialParameter{Type: "public-key", Alg: alg})
+	}
+	return &CreationOptions{
+		RP:                 RPEntity{ID: rp.ID, Name: rp.Name},
+		User:               user,
+		Challenge:          challenge,
+		PubKeyCredParams:   params,
+		Timeout:            rp.Timeout.Milliseconds(),
+		ExcludeCredentials: exclude,
+		AuthenticatorSelection: AuthenticatorSelection{
+			ResidentKey:      "preferred",
+			UserVerification: VerificationPreferred,
+		},
+		Attestation: "none",
+	}
+}
+
+// RequestOptions builds assertion options. An empty allow list lets the
+// authenticator pick any discoverable credential for this RP.
+func (rp *RelyingParty) RequestOptions(challenge []byte, allow []CredentialDescriptor, userVerification string) *RequestOptions {
+	return &RequestOptions{
+		Challenge:        challenge,
+		Timeout:          rp.Timeout.Milliseconds(),
+		RPID:             rp.ID,
+		AllowCredentials: allow,
+		UserVerification: userVerification,
+	}
+}
+
+type AuthenticatorAttestationResponse struct {
+	ClientDataJSON    URLEncodedBytes `json:"clientDataJSON"`
+	AttestationObject URLEncodedBytes `json:"attestationObject"`
+	Transports        []string        `json:"transports,omitempty"`
+
+	// Convenience copies browsers add in toJSON(); the attestation object is
+	// authoritative and these are ignored.
+	AuthenticatorData  URLEncodedBytes `json:"authenticatorData,omitempty"`
+	PublicKey          URLEncodedBytes `json:"publicKey,omitempty"`
+	PublicKeyAlgorithm int64           `json:"publicKeyAlgorithm,omitempty"`
+}
+
+// AttestationResponse is the JSON form of the PublicKeyCredential returned
+// by navigator.credentials.create.
+type AttestationResponse struct {
+	ID                      string                           `json:"id"`
+	RawID                   URLEncodedBytes                  `json:"rawId"`
+	Type                    string                           `json:"type"`
+	Response                AuthenticatorAttestationResponse `json:"response"`
+	AuthenticatorAttachment string                           `json:"authenticatorAttachment,omitempty"`
+	ClientExtensionResults  map[string]any                   `json:"clientExtensionResults,omitempty"`
+}
+
+type AuthenticatorAssertionResponse struct {
+	ClientDataJSON    URLEncodedBytes `json:"clientDataJSON"`
+	AuthenticatorData URLEncodedBytes `json:"authenticatorData"`
+	Signature         URLEncodedBytes `json:"signature"`
+	UserHandle        URLEncodedBytes `json:"userHandle,omitempty"`
+}
+
+// AssertionResponse is the JSON form of the PublicKeyCredential returned by
+// navigator.credentials.get.
+type AssertionResponse struct {
+	ID                      string                         `json:"id"`
+	RawID                   URLEncodedBytes                `json:"rawId"`
+	Type                    string                         `json:"type"`
+	Response                AuthenticatorAssertionResponse `json:"response"`
+	AuthenticatorAttachment string                         `json:"authenticatorAttachment,omitempty"`
+	ClientExtensionResults  map[string]any                 `json:"clientExtensionResults,omitempty"`
+}
+
+type collectedClientData struct {
+	Type        string `json:"type"`
+	Challenge   string `json:"challenge"`
+	Origin      string `json:"origin"`
+	CrossOrigin bool   `json:"crossOrigin"`
+}
+
+// Challenge returns the challenge echoed in the client data, which callers
+// use to find the ceremony's stored session before verifying it.
+func (r *AttestationResponse) Challenge() ([]byte, error) {
+	return clientDataChallenge(r.Response.ClientDataJSON)
+}
+
+// Challenge returns the challenge echoed in the client data.
+func (r *AssertionResponse) Challenge() ([]byte, error) {
+	return clientDataChallenge(r.Response.ClientDataJSON)
+}
+
+func clientDataChallenge(raw []byte) ([]byte, error) {
+	var cd collectedClientData
+	if err := json.Unmarshal(raw, &cd); err != nil {
+		return nil, ErrInvalidClientData
+	}
+	c, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(cd.Challenge, "="))
+	if err != nil || len(c) == 0 {
+		return nil, ErrInvalidClientData
+	}
+	return c, nil
+}
+
+// Credential is a newly registered public key credential.
+type Credential struct {
+	ID                []byte
+	PublicKey         []byte // COSE_Key
+	SignCount         uint32
+	AAGUID            []byte
+	Transports        []string
+	AttestationFormat string
+	UserVerified      bool
+	BackupEligible    bool
+	BackedUp          bool
+}
+
+// VerifyRegistration runs the registration ceremony checks (WebAuthn §7.1)
+// against the challenge that was issued for it.
+func (rp *RelyingParty) VerifyRegistration(resp *AttestationResponse, challenge []byte, requireUV bool) (*Credential, error) {
+	if resp.Type != "public-key" {
+		return nil, ErrInvalidClientData
+	}
+	if err := rp.verifyClientData(resp.Response.ClientDataJSON, "webauthn.create", challenge); err != nil {
+		return nil, err
+	}
+
+	v, rest, err := decodeCBOR(resp.Response.AttestationObject)
+	if err != nil || len(rest) != 0 {
+		return nil, ErrInvalidAttestation
+	}
+	obj, ok := v.(map[any]any)
+	if !ok {
+		return nil, ErrInvalidAttestation
+	}
+	format, _ := obj["fmt"].(string)
+	attStmt, _ := obj["attStmt"].(map[any]any)
+	rawAuthData, _ := obj["authData"].([]byte)
+	if format == "" || attStmt == nil {
+		return nil, ErrInvalidAttestation
+	}
+
+	authData, err := parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return nil, err
+	}
+	if err := rp.verifyAuthenticatorData(authData, requireUV); err != nil {
+		return nil, err
+	}
+	if authData.flags&flagAttestedData == 0 || authData.credentialID == nil {
+		return nil, ErrInvalidAuthData
+	}
+	if len(resp.RawID) > 0 && !bytes.Equal(resp.RawID, authData.credentialID) {
+		return nil, ErrInvalidAttestation
+	}
+
+	pub, err := ParsePublicKey(authData.publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	clientDataHash := sha256.Sum256(resp.Response.ClientDataJSON)
+	if err := verifyAttestationStatement(format, attStmt, rawAuthData, clientDataHash[:], pub, authData.aaguid); err != nil {
+		return nil, err
+	}
+
+	return &Credential{
+		ID:                authData.credentialID,
+		PublicKey:         authData.publicKey,
+		SignCount:         authData.signCount,
+		AAGUID:            authData.aaguid,
+		Transports:        resp.Response.Transports,
+		AttestationFormat: format,
+		UserVerified:      authData.flags&flagUserVerified != 0,
+		BackupEligible:    authData.flags&flagBackupEligible != 0,
+		BackedUp:          authData.flags&flagBackupState != 0,
+	}, nil
+}
+
+// AssertionResult carries the state to persist after a successful assertion.
+type AssertionResult struct {
+	SignCount    uint32
+	UserVerified bool
+	BackedUp     bool
+}
+
+// VerifyAssertion runs the authentication ceremony checks (WebAuthn §7.2)
+// for a credential the caller has already looked up by resp.RawID.
+func (rp *RelyingParty) VerifyAssertion(resp *AssertionResponse, challenge, publicKey []byte, storedSignCount uint32, requireUV bool) (*AssertionResult, error) {
+	if resp.Type != "public-key" {
+		return nil, ErrInvalidClientData
+	}
+	if err := rp.verifyClientData(resp.Response.ClientDataJSON, "webauthn.get", challenge); err != nil {
+		return nil, err
+	}
+
+	authData, err := parseAuthenticatorData(resp.Response.AuthenticatorData)
+	if err != nil {
+		return nil, err
+	}
+	if err := rp.verifyAuthenticatorData(authData, requireUV); err != nil {
+		return nil, err
+	}
+
+	pub, err := ParsePublicKey(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	clientDataHash := sha256.Sum256(resp.Response.ClientDataJSON)
+	signed := append(append([]byte(nil), resp.Response.AuthenticatorData...), clientDataHash[:]...)
+	if err := pub.Verify(signed, resp.Response.Signature); err != nil {
+		return nil, err
+	}
+
+	// Authenticators that do not implement a counter always report zero.
+	if (authData.signCount != 0 || storedSignCount != 0) && authData.signCount <= storedSignCount {
+		return nil, ErrSignCountRegression
+	}
+
+	return &AssertionResult{
+		SignCount:    authData.signCount,
+		UserVerified: authData.flags&flagUserVerified != 0,
+		BackedUp:     authData.flags&flagBackupState != 0,
+	}, nil
+}
+
+func (rp *RelyingParty) verifyClientData(raw []byte, ceremony string, challenge []byte) error {
+	var cd collectedClientData
+	if err := json.Unmarshal(raw, &cd); err != nil {
+		return ErrInvalidClientData
+	}
+	if cd.Type != ceremony {
+		return ErrInvalidClientData
+	}
+	got, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(cd.Challenge, "="))
+	if err != nil || subtle.ConstantTimeCompare(got, challenge) != 1 {
+		return ErrChallengeMismatch
+	}
+	if cd.CrossOrigin || !slices.Contains(rp.Origins, cd.Origin) {
+		return ErrOriginMismatch
+	}
+	return nil
+}
+
+func (rp *RelyingParty) verifyAuthenticatorData(ad *authenticatorData, requireUV bool) error {
+	rpIDHash := sha256.Sum256([]byte(rp.ID))
+	if subtle.ConstantTimeCompare(ad.rpIDHash, rpIDHash[:]) != 1 {
+		return ErrRPIDMismatch
+	}
+	if ad.flags&flagUserPresent == 0 {
+		return ErrUserNotPresent
+	}
+	if requireUV && ad.flags&flagUserVerified == 0 {
+		return ErrUserNotVerified
+	}
+	if ad.flags&flagBackupState != 0 && ad.flags&flagBackupEligible == 0 {
+		return ErrInvalidAuthData
+	}
+	return nil
+}
+
+type authenticatorData struct {
+	rpIDHash     []byte
+	flags        byte
+	signCount    uint32
+	aaguid       []byte
+	credentialID []byte
+	publicKey    []byte
+}
+
+func parseAuthenticatorData(raw []byte) (*authenticatorData, error) {
+	if len(raw) < 37 {
+		return nil, ErrInvalidAuthData
+	}
+	ad := &authenticatorData{
+		rpIDHash:  raw[:32],
+		flags:     raw[32],
+		signCount: binary.BigEndian.Uint32(raw[33:37]),
+	}
+	rest := raw[37:]
+
+	if ad.flags&flagAttestedData != 0 {
+		if len(rest) < 18 {
+			return nil, ErrInvalidAuthData
+		}
+		ad.aaguid = rest[:16]
+		idLen := int(binary.BigEndian.Uint16(rest[16:18]))
+		rest = rest[18:]
+		if idLen == 0 || idLen > maxCredentialIDLen || len(rest) < idLen {
+			return nil, ErrInvalidAuthData
+		}
+		ad.credentialID = rest[:idLen]
+		rest = rest[idLen:]
+
+		_, after, err := decodeCBOR(rest)
+		if err != nil {
+			return nil, ErrInvalidAuthData
+		}
+		ad.publicKey = rest[:len(rest)-len(after)]
+		rest = after
+	}
+	if ad.flags&flagExtensionData != 0 {
+		_, after, err := decodeCBOR(rest)
+		if err != nil {
+			return nil, ErrInvalidAuthData
+		}
+		rest = after
+	}
+	if len(rest) != 0 {
+		return nil, ErrInvalidAuthData
+	}
+	return ad, nil
+}
+
+// idFidoGenCeAAGUID is the certificate extension carrying the authenticator model.
+var idFidoGenCeAAGUID = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 45724, 1, 1, 4}
+
+// verifyAttestationStatement accepts "none" and "packed" attestation. Packed
+// statements are checked cryptographically, but attestation certificates are
+// not chained to a trust anchor: credentials are trusted on first use.
+func verifyAttestationStatement(format string, stmt map[any]any, authData, clientDataHash []byte, credKey *PublicKey, aaguid []byte) error {
+	switch format {
+	case "none":
+		if len(stmt) != 0 {
+			return ErrInvalidAttestation
+		}
+		return nil
+	case "packed":
+		alg, _ := stmt["alg"].(int64)
+		sig, _ := stmt["sig"].([]byte)
+		if sig == nil {
+			return ErrInvalidAttestation
+		}
+		signed := append(append([]byte(nil), authData...), clientDataHash...)
+
+		x5c, hasX5C := stmt["x5c"].([]any)
+		if !hasX5C {
+			// Self attestation: signed by the credential key itself.
+			if alg != credKey.Alg {
+				return ErrInvalidAttestation
+			}
+			if err := credKey.Verify(signed, sig); err != nil {
+				return ErrInvalidAttestation
+			}
+			return nil
+		}
+
+		if len(x5c) == 0 {
+			return ErrInvalidAttestation
+		}
+		der, _ := x5c[0].([]byte)
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return ErrInvalidAttestation
+		}
+		if err := verifySignature(cert.PublicKey, alg, signed, sig); err != nil {
+			return ErrInvalidAttestation
+		}
+		for _, ext := range cert.Extensions {
+			if !ext.Id.Equal(idFidoGenCeAAGUID) {
+				continue
+			}
+			var certAAGUID []byte
+			if _, err := asn1.Unmarshal(ext.Value, &certAAGUID); err != nil || !bytes.Equal(certAAGUID, aaguid) {
+				return ErrInvalidAttestation
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("%w: unsupported format %q", ErrInvalidAttestation, format)
+}
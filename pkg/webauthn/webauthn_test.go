@@ -0,0 +1,104 @@
+package webauthn_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Prashant2307200/auth-service/pkg/webauthn"
+	"github.com/Prashant2307200/auth-service/pkg/webauthn/webauthntest"
+)
+
+var rp = &webauthn.RelyingParty{ID: "example.com", Name: "Example", Origins: []string{"https://app.example.com"}}
+
+func register(t *testing.T, auth *webauthntest.Authenticator) *webauthn.Credential {
+	t.Helper()
+	challenge, _ := webauthn.NewChallenge()
+	opts := rp.CreationOptions(challenge, webauthn.UserEntity{ID: []byte{1}, Name: "alice"}, nil)
+	resp, err := auth.Create(opts)
+	if err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+	cred, err := rp.VerifyRegistration(resp, challenge, false)
+	if err != nil {
+		t.Fatalf("registration failed: %v", err)
+	}
+	return cred
+}
+
+func TestRegistrationAndAssertion(t *testing.T) {
+	auth := webauthntest.New("https://app.example.com")
+	cred := register(t, auth)
+	if !cred.UserVerified || cred.AttestationFormat != "none" {
+		t.Fatalf("unexpected credential %+v", cred)
+	}
+
+	challenge, _ := webauthn.NewChallenge()
+	resp, err := auth.Get(rp.RequestOptions(challenge, nil, webauthn.VerificationRequired))
+	if err != nil {
+		t.Fatalf("get failed: %v", err)
+	}
+	got, err := resp.Challenge()
+	if err != nil || string(got) != string(challenge) {
+		t.Fatalf("challenge not echoed: %v", err)
+	}
+
+	res, err := rp.VerifyAssertion(resp, challenge, cred.PublicKey, cred.SignCount, true)
+	if err != nil {
+		t.Fatalf("assertion failed: %v", err)
+	}
+	if res.SignCount != 1 {
+		t.Fatalf("expected sign count 1, got %d", res.SignCount)
+	}
+
+	// Replaying the same assertion must fail the counter check.
+	if _, err := rp.VerifyAssertion(resp, challenge, cred.PublicKey, res.SignCount, true); !errors.Is(err, webauthn.ErrSignCountRegression) {
+		t.Fatalf("expected sign count regression, got %v", err)
+	}
+}
+
+func TestAssertionRejections(t *testing.T) {
+	auth := webauthntest.New("https://app.example.com")
+	cred := register(t, auth)
+
+	challenge, _ := webauthn.NewChallenge()
+	resp, _ := auth.Get(rp.RequestOptions(challenge, nil, webauthn.VerificationRequired))
+
+	other, _ := webauthn.NewChallenge()
+	if _, err := rp.VerifyAssertion(resp, other, cred.PublicKey, 0, true); !errors.Is(err, webauthn.ErrChallengeMismatch) {
+		t.Fatalf("expected challenge mismatch, got %v", err)
+	}
+
+	otherRP := &webauthn.RelyingParty{ID: "evil.com", Origins: rp.Origins}
+	if _, err := otherRP.VerifyAssertion(resp, challenge, cred.PublicKey, 0, true); !errors.Is(err, webauthn.ErrRPIDMismatch) {
+		t.Fatalf("expected rp id mismatch, got %v", err)
+	}
+
+	tampered := *resp
+	tampered.Response.Signature = append([]byte(nil), resp.Response.Signature...)
+	tampered.Response.Signature[len(tampered.Response.Signature)-1] ^= 0xff
+	if _, err := rp.VerifyAssertion(&tampered, challenge, cred.PublicKey, 0, true); err == nil {
+		t.Fatalf("expected tampered signature to fail")
+	}
+
+	phishing := webauthntest.New("https://app.example.com.evil.net")
+	c2, _ := webauthn.NewChallenge()
+	opts := rp.CreationOptions(c2, webauthn.UserEntity{ID: []byte{2}}, nil)
+	att, _ := phishing.Create(opts)
+	if _, err := rp.VerifyRegistration(att, c2, false); !errors.Is(err, webauthn.ErrOriginMismatch) {
+		t.Fatalf("expected origin mismatch, got %v", err)
+	}
+}
+
+func TestUserVerificationRequired(t *testing.T) {
+	auth := webauthntest.New("https://app.example.com")
+	auth.NoUserVerification = true
+	challenge, _ := webauthn.NewChallenge()
+	resp, _ := auth.Create(rp.CreationOptions(challenge, webauthn.UserEntity{ID: []byte{1}}, nil))
+
+	if _, err := rp.VerifyRegistration(resp, challenge, true); !errors.Is(err, webauthn.ErrUserNotVerified) {
+		t.Fatalf("expected user verification error, got %v", err)
+	}
+	if _, err := rp.VerifyRegistration(resp, challenge, false); err != nil {
+		t.Fatalf("presence-only registration should pass when UV is not required: %v", err)
+	}
+}
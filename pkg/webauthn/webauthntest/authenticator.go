@@ -0,0 +1,235 @@
+// Package webauthntest provides a software authenticator for exercising
+// WebAuthn ceremonies in tests without a browser.
+package webauthntest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/Prashant2307200/auth-service/pkg/webauthn"
+)
+
+// Authenticator is an in-memory ES256 passkey provider with "none" attestation.
+type Authenticator struct {
+	Origin string
+	AAGUID []byte
+	// NoUserVerification makes the authenticator report presence only.
+	NoUserVerification bool
+
+	credentials []*credential
+}
+
+type credential struct {
+	id         []byte
+	rpID       string
+	userHandle []byte
+	key        *ecdsa.PrivateKey
+	signCount  uint32
+}
+
+func New(origin string) *Authenticator {
+	return &Authenticator{Origin: origin, AAGUID: make([]byte, 16)}
+}
+
+// Create answers navigator.credentials.create with a new credential.
+func (a *Authenticator) Create(opts *webauthn.CreationOptions) (*webauthn.AttestationResponse, error) {
+	for _, ex := range opts.ExcludeCredentials {
+		if a.find(opts.RP.ID, ex.ID) != nil {
+			return nil, errors.New("webauthntest: credential already registered")
+		}
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	cred := &credential{id: id, rpID: opts.RP.ID, userHandle: opts.User.ID, key: key}
+	a.credentials = append(a.credentials, cred)
+
+	authData := a.authData(cred, true)
+	attObj := encodeCBOR(map[any]any{
+		"fmt":      "none",
+		"attStmt":  map[any]any{},
+		"authData": authData,
+	})
+
+	resp := &webauthn.AttestationResponse{
+		ID:    base64.RawURLEncoding.EncodeToString(id),
+		RawID: id,
+		Type:  "public-key",
+	}
+	resp.Response.ClientDataJSON = a.clientData("webauthn.create", opts.Challenge)
+	resp.Response.AttestationObject = attObj
+	resp.Response.Transports = []string{"internal"}
+	return resp, nil
+}
+
+// Get answers navigator.credentials.get, using the first allowed credential
+// or, with an empty allow list, the first discoverable one for the RP.
+func (a *Authenticator) Get(opts *webauthn.RequestOptions) (*webauthn.AssertionResponse, error) {
+	var cred *credential
+	if len(opts.AllowCredentials) == 0 {
+		for _, c := range a.credentials {
+			if c.rpID == opts.RPID {
+				cred = c
+				break
+			}
+		}
+	}
+	for _, allowed := range opts.AllowCredentials {
+		if cred = a.find(opts.RPID, allowed.ID); cred != nil {
+			break
+		}
+	}
+	if cred == nil {
+		return nil, errors.New("webauthntest: no matching credential")
+	}
+
+	cred.signCount++
+	authData := a.authData(cred, false)
+	clientData := a.clientData("webauthn.get", opts.Challenge)
+	hash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte(nil), authData...), hash[:]...))
+	sig, err := ecdsa.SignASN1(rand.Reader, cred.key, digest[:])
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &webauthn.AssertionResponse{
+		ID:    base64.RawURLEncoding.EncodeToString(cred.id),
+		RawID: cred.id,
+		Type:  "public-key",
+	}
+	resp.Response.ClientDataJSON = clientData
+	resp.Response.AuthenticatorData = authData
+	resp.Response.Signature = sig
+	resp.Response.UserHandle = cred.userHandle
+	return resp, nil
+}
+
+// ResetSignCount rewinds every counter, as a cloned authenticator would.
+func (a *Authenticator) ResetSignCount() {
+	for _, c := range a.credentials {
+		c.signCount = 0
+	}
+}
+
+func (a *Authenticator) find(rpID string, id []byte) *credential {
+	for _, c := range a.credentials {
+		if c.rpID == rpID && string(c.id) == string(id) {
+			return c
+		}
+	}
+	return nil
+}
+
+func (a *Authenticator) clientData(ceremony string, challenge []byte) []byte {
+	data, _ := json.Marshal(map[string]any{
+		"type":        ceremony,
+		"challenge":   base64.RawURLEncoding.EncodeToString(challenge),
+		"origin":      a.Origin,
+		"crossOrigin": false,
+	})
+	return data
+}
+
+func (a *Authenticator) authData(cred *credential, attested bool) []byte {
+	rpIDHash := sha256.Sum256([]byte(cred.rpID))
+	flags := byte(0x01) // UP
+	if !a.NoUserVerification {
+		flags |= 0x04
+	}
+	if attested {
+		flags |= 0x40
+	}
+
+	out := append([]byte(nil), rpIDHash[:]...)
+	out = append(out, flags)
+	out = binary.BigEndian.AppendUint32(out, cred.signCount)
+	if attested {
+		out = append(out, a.AAGUID...)
+		out = binary.BigEndian.AppendUint16(out, uint16(len(cred.id)))
+		out = append(out, cred.id...)
+		out = append(out, encodeCBOR(map[any]any{
+			int64(1):  int64(2),  // kty: EC2
+			int64(3):  int64(-7), // alg: ES256
+			int64(-1): int64(1),  // crv: P-256
+			int64(-2): cred.key.X.FillBytes(make([]byte, 32)),
+			int64(-3): cred.key.Y.FillBytes(make([]byte, 32)),
+		})...)
+	}
+	return out
+}
+
+// encodeCBOR writes the subset of CBOR the authenticator needs.
+func encodeCBOR(v any) []byte {
+	switch x := v.(type) {
+	case int64:
+		if x < 0 {
+			return cborHead(1, uint64(-1-x))
+		}
+		return cborHead(0, uint64(x))
+	case []byte:
+		return append(cborHead(2, uint64(len(x))), x...)
+	case string:
+		return append(cborHead(3, uint64(len(x))), x...)
+	case map[any]any:
+		out := cborHead(5, uint64(len(x)))
+		// Integer keys first, then text keys, each in a stable order.
+		for _, k := range sortedKeys(x) {
+			out = append(out, encodeCBOR(k)...)
+			out = append(out, encodeCBOR(x[k])...)
+		}
+		return out
+	}
+	panic(fmt.Sprintf("webauthntest: cannot encode %T", v))
+}
+
+func cborHead(major byte, n uint64) []byte {
+	switch {
+	case n < 24:
+		return []byte{major<<5 | byte(n)}
+	case n <= 0xff:
+		return []byte{major<<5 | 24, byte(n)}
+	case n <= 0xffff:
+		return binary.BigEndian.AppendUint16([]byte{major<<5 | 25}, uint16(n))
+	case n <= 0xffffffff:
+		return binary.BigEndian.AppendUint32([]byte{major<<5 | 26}, uint32(n))
+	}
+	return binary.BigEndian.AppendUint64([]byte{major<<5 | 27}, n)
+}
+
+func sortedKeys(m map[any]any) []any {
+	var ints []int64
+	var strs []string
+	for k := range m {
+		switch kk := k.(type) {
+		case int64:
+			ints = append(ints, kk)
+		case string:
+			strs = append(strs, kk)
+		}
+	}
+	slices.Sort(ints)
+	slices.Sort(strs)
+	keys := make([]any, 0, len(m))
+	for _, k := range ints {
+		keys = append(keys, k)
+	}
+	for _, k := range strs {
+		keys = append(keys, k)
+	}
+	return keys
+}